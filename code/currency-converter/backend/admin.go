@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// requireAdmin guards /api/admin with a bearer token. Without ADMIN_TOKEN the
+// admin endpoints are turned off.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+		if token == "" {
+			writeError(w, http.StatusForbidden, "admin_disabled", "admin endpoints are disabled, set ADMIN_TOKEN to enable them")
+			return
+		}
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid_admin_token", "admin token required")
+			return
+		}
+		next(w, r)
+	}
+}
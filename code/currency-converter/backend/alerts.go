@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	alertAbove = "above"
+	alertBelow = "below"
+
+	// maxAlertsPerKey caps the alerts one API key can register.
+	maxAlertsPerKey = 50
+	// maxAlertBody caps the size of a POST /api/alerts body, in bytes.
+	maxAlertBody = 16 << 10
+)
+
+// alert asks for a webhook call or an email when a pair's rate crosses
+// Threshold. It fires once each time the condition becomes true.
+type alert struct {
+	ID              string     `json:"id"`
+	Base            string     `json:"base"`
+	Target          string     `json:"target"`
+	Condition       string     `json:"condition"`
+	Threshold       float64    `json:"threshold"`
+	WebhookURL      string     `json:"webhook_url,omitempty"`
+	Email           string     `json:"email,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+
+	// owner is the name of the API key that registered the alert.
+	owner string
+	// secret signs the alert's webhook calls.
+	secret string
+	// triggered is set while the condition holds, so it fires only once.
+	triggered bool
+}
+
+func (a *alert) matches(rate float64) bool {
+	if a.Condition == alertAbove {
+		return rate > a.Threshold
+	}
+	return rate < a.Threshold
+}
+
+// alertEvent is the body of a webhook call and the content of an email.
+type alertEvent struct {
+	AlertID   string    `json:"alert_id"`
+	Base      string    `json:"base"`
+	Target    string    `json:"target"`
+	Condition string    `json:"condition"`
+	Threshold float64   `json:"threshold"`
+	Rate      float64   `json:"rate"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// alertRegistry keeps alerts in memory; they do not survive a restart.
+type alertRegistry struct {
+	notifier *alertNotifier
+
+	mu     sync.Mutex
+	alerts map[string]*alert
+}
+
+func newAlertRegistry(notifier *alertNotifier) *alertRegistry {
+	return &alertRegistry{notifier: notifier, alerts: map[string]*alert{}}
+}
+
+// evaluate fires the alerts on pair whose condition has just become true,
+// and re-arms those whose condition no longer holds.
+func (r *alertRegistry) evaluate(pair ratePair, quote rateQuote) {
+	r.mu.Lock()
+	var fired []alert
+	for _, a := range r.alerts {
+		if a.Base != pair.Base || a.Target != pair.Target {
+			continue
+		}
+		if !a.matches(quote.Rate) {
+			a.triggered = false
+			continue
+		}
+		if a.triggered {
+			continue
+		}
+		a.triggered = true
+		now := time.Now().UTC()
+		a.LastTriggeredAt = &now
+		fired = append(fired, *a)
+	}
+	r.mu.Unlock()
+
+	for _, a := range fired {
+		log.Printf("alert %s fired: %s %s %v at %v", a.ID, pair, a.Condition, a.Threshold, quote.Rate)
+		go r.notifier.deliver(a, alertEvent{
+			AlertID:   a.ID,
+			Base:      a.Base,
+			Target:    a.Target,
+			Condition: a.Condition,
+			Threshold: a.Threshold,
+			Rate:      quote.Rate,
+			Source:    quote.Source,
+			FetchedAt: quote.FetchedAt.UTC(),
+		})
+	}
+}
+
+// list returns owner's alerts, oldest first.
+func (r *alertRegistry) list(owner string) []alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alerts := []alert{}
+	for _, a := range r.alerts {
+		if a.owner == owner {
+			alerts = append(alerts, *a)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].CreatedAt.Before(alerts[j].CreatedAt) })
+	return alerts
+}
+
+// add registers a unless its owner already has maxAlertsPerKey alerts.
+func (r *alertRegistry) add(a *alert) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owned := 0
+	for _, existing := range r.alerts {
+		if existing.owner == a.owner {
+			owned++
+		}
+	}
+	if owned >= maxAlertsPerKey {
+		return false
+	}
+	r.alerts[a.ID] = a
+	return true
+}
+
+// remove deletes owner's alert id, reporting whether there was one.
+func (r *alertRegistry) remove(owner, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.alerts[id]
+	if !ok || a.owner != owner {
+		return false
+	}
+	delete(r.alerts, id)
+	return true
+}
+
+type alertRequest struct {
+	Base       string  `json:"base"`
+	Target     string  `json:"target"`
+	Condition  string  `json:"condition"`
+	Threshold  float64 `json:"threshold"`
+	WebhookURL string  `json:"webhook_url"`
+	Email      string  `json:"email"`
+}
+
+// newAlert validates req into an alert for owner on a pair the refresher
+// covers.
+func (r *alertRegistry) newAlert(ctx context.Context, owner string, req alertRequest, refresher *rateRefresher) (*alert, error) {
+	a := &alert{
+		Base:       strings.ToUpper(strings.TrimSpace(req.Base)),
+		Target:     strings.ToUpper(strings.TrimSpace(req.Target)),
+		Condition:  strings.ToLower(strings.TrimSpace(req.Condition)),
+		Threshold:  req.Threshold,
+		WebhookURL: strings.TrimSpace(req.WebhookURL),
+		Email:      strings.TrimSpace(req.Email),
+		CreatedAt:  time.Now().UTC(),
+		owner:      owner,
+	}
+	if err := validateCurrency("base", a.Base); err != nil {
+		return nil, err
+	}
+	if err := validateCurrency("target", a.Target); err != nil {
+		return nil, err
+	}
+	if pair := (ratePair{Base: a.Base, Target: a.Target}); !refresher.refreshes(pair) {
+		return nil, fmt.Errorf("%s is not refreshed, add it to RATE_REFRESH_PAIRS", pair)
+	}
+	if a.Condition != alertAbove && a.Condition != alertBelow {
+		return nil, &paramError{Field: "condition", Message: fmt.Sprintf("must be %s or %s", alertAbove, alertBelow)}
+	}
+	if a.Threshold <= 0 {
+		return nil, &paramError{Field: "threshold", Message: "must be a positive rate"}
+	}
+
+	switch {
+	case (a.WebhookURL == "") == (a.Email == ""):
+		return nil, errors.New("set exactly one of webhook_url and email")
+	case a.WebhookURL != "":
+		u, err := url.Parse(a.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return nil, &paramError{Field: "webhook_url", Message: "must be an http or https URL"}
+		}
+		if err := r.notifier.checkWebhookHost(ctx, u.Hostname()); err != nil {
+			return nil, &paramError{Field: "webhook_url", Message: err.Error()}
+		}
+	default:
+		if !r.notifier.smtp.enabled() {
+			return nil, errors.New("email alerts are disabled, set SMTP_ADDR and SMTP_FROM to enable them")
+		}
+		address, err := mail.ParseAddress(a.Email)
+		if err != nil {
+			return nil, &paramError{Field: "email", Message: "must be an email address"}
+		}
+		a.Email = address.Address
+	}
+
+	a.ID = randomHex(8)
+	a.secret = randomHex(32)
+	return a, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// alertsHandler serves GET and POST /api/alerts and DELETE /api/alerts/{id}.
+// Each API key sees and removes only the alerts it registered, so alerts
+// need API keys.
+func alertsHandler(registry *alertRegistry, refresher *rateRefresher, keys *apiKeyRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if refresher == nil {
+			writeError(w, http.StatusServiceUnavailable, "refresher_disabled", "alerts need the background refresher, set RATE_REFRESH_PAIRS")
+			return
+		}
+		if keys == nil {
+			writeError(w, http.StatusServiceUnavailable, "api_keys_disabled", "alerts need API keys, set API_KEYS, API_KEYS_FILE, or API_KEYS_DB")
+			return
+		}
+		key, ok := keys.authenticate(r)
+		if !ok {
+			writeUnauthorized(w)
+			return
+		}
+
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/alerts"), "/")
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string][]alert{"alerts": registry.list(key.Name)})
+		case id == "" && r.Method == http.MethodPost:
+			var req alertRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertBody)).Decode(&req); err != nil {
+				writeBadRequest(w, errors.New("invalid JSON body"))
+				return
+			}
+			a, err := registry.newAlert(r.Context(), key.Name, req, refresher)
+			if err != nil {
+				writeBadRequest(w, err)
+				return
+			}
+			if !registry.add(a) {
+				writeError(w, http.StatusConflict, "alert_limit_reached", fmt.Sprintf("an API key can register at most %d alerts", maxAlertsPerKey))
+				return
+			}
+
+			// The secret is only shown here, for the receiver to check
+			// signatures with.
+			writeJSON(w, http.StatusCreated, struct {
+				alert
+				Secret string `json:"secret,omitempty"`
+			}{alert: *a, Secret: secretFor(a)})
+		case id != "" && r.Method == http.MethodDelete:
+			if !registry.remove(key.Name, id) {
+				writeError(w, http.StatusNotFound, "alert_not_found", "alert not found")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case id == "":
+			writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		default:
+			writeMethodNotAllowed(w, http.MethodDelete)
+		}
+	}
+}
+
+// secretFor returns the signing secret of a webhook alert.
+func secretFor(a *alert) string {
+	if a.WebhookURL == "" {
+		return ""
+	}
+	return a.secret
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestAlerts(t *testing.T) (*alertRegistry, *rateRefresher, *fakeUpstream) {
+	t.Helper()
+	notifier := &alertNotifier{
+		client:   http.DefaultClient,
+		attempts: 3,
+		backoff:  time.Millisecond,
+		lookupIP: func(_ context.Context, _, host string) ([]net.IP, error) {
+			if ip := net.ParseIP(host); ip != nil {
+				return []net.IP{ip}, nil
+			}
+			if host == "intranet.example.com" {
+				return []net.IP{net.ParseIP("10.0.0.5")}, nil
+			}
+			return []net.IP{net.ParseIP("93.184.215.14")}, nil
+		},
+		webhookAllowed: publicAddress,
+	}
+	registry := newAlertRegistry(notifier)
+	upstream := &fakeUpstream{rate: 15900}
+	config := refresherConfig{pairs: []ratePair{{Base: "USD", Target: "IDR"}}, interval: time.Hour}
+	refresher := newRateRefresher(config, newRateCache(cacheConfig{}, upstream.fetch).Refresh)
+	refresher.onRefresh = registry.evaluate
+	return registry, refresher, upstream
+}
+
+func newTestAlertKeys(t *testing.T) *apiKeyRegistry {
+	t.Helper()
+	now := time.Now()
+	return newTestKeys(t, "alice:alice-key:0:0,bob:bob-key:0:0", &now)
+}
+
+func callAlerts(handler http.HandlerFunc, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	res := httptest.NewRecorder()
+	handler(res, req)
+	return res
+}
+
+func postAlert(t *testing.T, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return callAlerts(handler, http.MethodPost, "/api/alerts", "alice-key", body)
+}
+
+func TestAlertsHandlerValidation(t *testing.T) {
+	registry, refresher, _ := newTestAlerts(t)
+	handler := alertsHandler(registry, refresher, newTestAlertKeys(t))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "pair not refreshed", body: `{"base":"EUR","target":"USD","condition":"above","threshold":1.1,"webhook_url":"https://example.com/hook"}`},
+		{name: "unknown condition", body: `{"base":"USD","target":"IDR","condition":"over","threshold":16000,"webhook_url":"https://example.com/hook"}`},
+		{name: "no destination", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000}`},
+		{name: "bad webhook url", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"ftp://example.com"}`},
+		{name: "loopback webhook", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"http://127.0.0.1:8080/hook"}`},
+		{name: "ipv6 loopback webhook", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"http://[::1]/hook"}`},
+		{name: "link-local webhook", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"http://169.254.169.254/latest/meta-data"}`},
+		{name: "webhook resolving to a private address", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"https://intranet.example.com/hook"}`},
+		{name: "email without smtp", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"email":"me@example.com"}`},
+		{name: "body too large", body: `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"https://example.com/` + strings.Repeat("a", maxAlertBody) + `"}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := postAlert(t, handler, tc.body); res.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestAlertsNeedAPIKeys(t *testing.T) {
+	registry, refresher, _ := newTestAlerts(t)
+
+	if res := callAlerts(alertsHandler(registry, refresher, nil), http.MethodGet, "/api/alerts", "", ""); res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d without API keys, got %d", http.StatusServiceUnavailable, res.Code)
+	}
+	if res := callAlerts(alertsHandler(registry, refresher, newTestAlertKeys(t)), http.MethodGet, "/api/alerts", "", ""); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without a key, got %d", http.StatusUnauthorized, res.Code)
+	}
+}
+
+func TestAlertsListAndDelete(t *testing.T) {
+	registry, refresher, _ := newTestAlerts(t)
+	handler := alertsHandler(registry, refresher, newTestAlertKeys(t))
+
+	res := postAlert(t, handler, `{"base":"usd","target":"idr","condition":"above","threshold":16000,"webhook_url":"https://example.com/hook"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var created struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil || created.ID == "" || created.Secret == "" {
+		t.Fatalf("expected an id and a signing secret, got %+v (%v)", created, err)
+	}
+
+	res = callAlerts(handler, http.MethodGet, "/api/alerts", "alice-key", "")
+	if !strings.Contains(res.Body.String(), created.ID) || strings.Contains(res.Body.String(), created.Secret) {
+		t.Fatalf("expected the alert listed without its secret, got %s", res.Body.String())
+	}
+	res = callAlerts(handler, http.MethodGet, "/api/alerts", "bob-key", "")
+	if strings.Contains(res.Body.String(), created.ID) || strings.Contains(res.Body.String(), "example.com") {
+		t.Fatalf("expected another key not to see the alert, got %s", res.Body.String())
+	}
+
+	for _, step := range []struct {
+		key  string
+		want int
+	}{
+		{key: "bob-key", want: http.StatusNotFound},
+		{key: "alice-key", want: http.StatusNoContent},
+		{key: "alice-key", want: http.StatusNotFound},
+	} {
+		if res := callAlerts(handler, http.MethodDelete, "/api/alerts/"+created.ID, step.key, ""); res.Code != step.want {
+			t.Fatalf("expected status %d deleting with %s, got %d", step.want, step.key, res.Code)
+		}
+	}
+}
+
+func TestAlertsLimitPerKey(t *testing.T) {
+	registry, refresher, _ := newTestAlerts(t)
+	handler := alertsHandler(registry, refresher, newTestAlertKeys(t))
+	body := `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"https://example.com/hook"}`
+
+	for i := 0; i < maxAlertsPerKey; i++ {
+		if res := postAlert(t, handler, body); res.Code != http.StatusCreated {
+			t.Fatalf("expected alert %d to be created, got %d: %s", i+1, res.Code, res.Body.String())
+		}
+	}
+	if res := postAlert(t, handler, body); res.Code != http.StatusConflict {
+		t.Fatalf("expected status %d past the limit, got %d", http.StatusConflict, res.Code)
+	}
+	if res := callAlerts(handler, http.MethodPost, "/api/alerts", "bob-key", body); res.Code != http.StatusCreated {
+		t.Fatalf("expected another key to be under its own limit, got %d", res.Code)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer hook.Close()
+
+	notifier := &alertNotifier{client: newWebhookClient(publicAddress)}
+	retry, err := notifier.postWebhook(alert{ID: "a1", WebhookURL: hook.URL}, alertEvent{AlertID: "a1"})
+	if !errors.Is(err, errWebhookAddress) || retry {
+		t.Fatalf("expected a refused dial that is not retried, got retry=%v err=%v", retry, err)
+	}
+	if called {
+		t.Fatalf("expected the loopback webhook not to be called")
+	}
+}
+
+func TestAlertWebhookIsSignedAndRetried(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer hook.Close()
+
+	registry, refresher, upstream := newTestAlerts(t)
+	// The test server listens on loopback.
+	registry.notifier.webhookAllowed = func(net.IP) bool { return true }
+	handler := alertsHandler(registry, refresher, newTestAlertKeys(t))
+	res := postAlert(t, handler, `{"base":"USD","target":"IDR","condition":"above","threshold":16000,"webhook_url":"`+hook.URL+`"}`)
+	var created struct {
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(res.Body).Decode(&created)
+
+	refresher.refreshAll(context.Background())
+	upstream.rate = 16050
+	refresher.refreshAll(context.Background())
+	// Still above the threshold: the alert has fired and must not fire again.
+	upstream.rate = 16100
+	refresher.refreshAll(context.Background())
+
+	select {
+	case req := <-received:
+		body := <-bodies
+		want := "sha256=" + signWebhook(created.Secret, req.Header.Get("X-Alert-Timestamp"), body)
+		if req.Header.Get("X-Alert-Signature") != want {
+			t.Fatalf("expected signature %s, got %s", want, req.Header.Get("X-Alert-Signature"))
+		}
+		if !strings.Contains(string(body), `"rate":16050`) {
+			t.Fatalf("expected the rate that crossed the threshold, got %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the webhook to be delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Fatalf("expected one retry and no second alert, got %d attempts", attempts)
+	}
+}
+
+func TestAlertEmail(t *testing.T) {
+	sent := make(chan string, 1)
+	notifier := &alertNotifier{
+		smtp:     smtpConfig{addr: "smtp.example.com:587", from: "alerts@example.com"},
+		attempts: 1,
+		sendMail: func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+			sent <- to[0] + "\n" + string(msg)
+			return nil
+		},
+	}
+	registry := newAlertRegistry(notifier)
+	config := refresherConfig{pairs: []ratePair{{Base: "USD", Target: "IDR"}}, interval: time.Hour}
+	refresher := newRateRefresher(config, nil)
+
+	res := postAlert(t, alertsHandler(registry, refresher, newTestAlertKeys(t)), `{"base":"USD","target":"IDR","condition":"below","threshold":16000,"email":"Me <me@example.com>"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	registry.evaluate(ratePair{Base: "USD", Target: "IDR"}, rateQuote{Rate: 15950, Source: "frankfurter", FetchedAt: time.Now()})
+
+	select {
+	case msg := <-sent:
+		if !strings.HasPrefix(msg, "me@example.com\n") || !strings.Contains(msg, "Subject: USD/IDR is below 16000") {
+			t.Fatalf("unexpected email: %s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected an email")
+	}
+}
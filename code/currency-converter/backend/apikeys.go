@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiKeyReloadInterval is how often keys are read again from their file and
+// the database, so keys can be added or revoked without a restart.
+const apiKeyReloadInterval = time.Minute
+
+// apiKey is a client allowed to call the API. A quota or limit of zero is
+// unlimited.
+type apiKey struct {
+	Name string
+	// hash is the hex SHA-256 of the key, which is all that is kept.
+	hash string
+	// DailyQuota is how many requests the key may make per UTC day.
+	DailyQuota int
+	// RateLimit is how many requests the key may make per minute.
+	RateLimit int
+}
+
+// apiKeySource is implemented by stores that keep API keys.
+type apiKeySource interface {
+	APIKeys(ctx context.Context) ([]apiKey, error)
+}
+
+type apiKeyConfig struct {
+	// keys is API_KEYS, a comma-separated list of key specs.
+	keys string
+	// file is API_KEYS_FILE, a file with a key spec per line.
+	file string
+	// fromDB reads keys from the api_keys table as well.
+	fromDB bool
+	// dailyQuota and rateLimit apply to keys that do not set their own.
+	dailyQuota int
+	rateLimit  int
+}
+
+func loadAPIKeyConfig() (apiKeyConfig, error) {
+	config := apiKeyConfig{
+		keys:       os.Getenv("API_KEYS"),
+		file:       os.Getenv("API_KEYS_FILE"),
+		dailyQuota: 1000,
+		rateLimit:  60,
+	}
+	if value := os.Getenv("API_KEYS_DB"); value != "" {
+		fromDB, err := strconv.ParseBool(value)
+		if err != nil {
+			return apiKeyConfig{}, fmt.Errorf("API_KEYS_DB must be true or false, got %q", value)
+		}
+		config.fromDB = fromDB
+	}
+	for key, target := range map[string]*int{
+		"API_KEY_DAILY_QUOTA": &config.dailyQuota,
+		"API_KEY_RATE_LIMIT":  &config.rateLimit,
+	} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return apiKeyConfig{}, fmt.Errorf("%s must be a whole number, got %q", key, value)
+		}
+		*target = n
+	}
+	return config, nil
+}
+
+// enabled reports whether any key source is set up, which turns on key
+// authentication.
+func (c apiKeyConfig) enabled() bool {
+	return strings.TrimSpace(c.keys) != "" || c.file != "" || c.fromDB
+}
+
+// parseAPIKey reads a key spec, "name:key" with an optional daily quota and
+// per-minute rate limit: "name:key:1000:60".
+func parseAPIKey(spec string, config apiKeyConfig) (apiKey, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] == "" || parts[1] == "" {
+		return apiKey{}, errors.New("must be name:key, optionally followed by :daily-quota:rate-limit")
+	}
+	key := apiKey{Name: parts[0], hash: hashAPIKey(parts[1]), DailyQuota: config.dailyQuota, RateLimit: config.rateLimit}
+	for i, target := range []*int{&key.DailyQuota, &key.RateLimit} {
+		if len(parts) <= i+2 || parts[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(parts[i+2])
+		if err != nil || n < 0 {
+			return apiKey{}, fmt.Errorf("%s: quota and rate limit must be whole numbers", key.Name)
+		}
+		*target = n
+	}
+	return key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyUsage counts a key's requests. Counters are kept in memory and start
+// over on a restart.
+type keyUsage struct {
+	day    string
+	today  int
+	window time.Time
+	minute int
+	total  int64
+}
+
+// apiKeyRegistry authenticates requests and enforces each key's quota and
+// rate limit.
+type apiKeyRegistry struct {
+	config apiKeyConfig
+	db     apiKeySource
+	now    func() time.Time
+
+	mu    sync.Mutex
+	keys  map[string]apiKey
+	usage map[string]*keyUsage
+}
+
+func newAPIKeyRegistry(config apiKeyConfig, db apiKeySource) *apiKeyRegistry {
+	return &apiKeyRegistry{
+		config: config,
+		db:     db,
+		now:    time.Now,
+		keys:   map[string]apiKey{},
+		usage:  map[string]*keyUsage{},
+	}
+}
+
+// reload reads the keys from every source. On error the keys already loaded
+// stay in use.
+func (k *apiKeyRegistry) reload(ctx context.Context) error {
+	var keys []apiKey
+	for _, spec := range strings.Split(k.config.keys, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		key, err := parseAPIKey(spec, k.config)
+		if err != nil {
+			return fmt.Errorf("API_KEYS: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if k.config.file != "" {
+		fromFile, err := readAPIKeyFile(k.config.file, k.config)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, fromFile...)
+	}
+	if k.db != nil {
+		fromDB, err := k.db.APIKeys(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read API keys from the database: %w", err)
+		}
+		for _, key := range fromDB {
+			if key.DailyQuota < 0 {
+				key.DailyQuota = k.config.dailyQuota
+			}
+			if key.RateLimit < 0 {
+				key.RateLimit = k.config.rateLimit
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	byHash := make(map[string]apiKey, len(keys))
+	for _, key := range keys {
+		byHash[key.hash] = key
+	}
+	k.mu.Lock()
+	k.keys = byHash
+	k.mu.Unlock()
+	return nil
+}
+
+// readAPIKeyFile reads a key spec per line. Blank lines and lines starting
+// with # are skipped.
+func readAPIKeyFile(path string, config apiKeyConfig) ([]apiKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open API_KEYS_FILE: %w", err)
+	}
+	defer f.Close()
+
+	var keys []apiKey
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		spec := strings.TrimSpace(scanner.Text())
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		key, err := parseAPIKey(spec, config)
+		if err != nil {
+			return nil, fmt.Errorf("API_KEYS_FILE line %d: %w", line, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API_KEYS_FILE: %w", err)
+	}
+	return keys, nil
+}
+
+// Run reloads the keys every apiKeyReloadInterval until ctx is done.
+func (k *apiKeyRegistry) Run(ctx context.Context) {
+	ticker := time.NewTicker(apiKeyReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.reload(ctx); err != nil {
+				log.Printf("failed to reload API keys: %v", err)
+			}
+		}
+	}
+}
+
+// authenticate finds the key in the X-API-Key header, or in the api_key query
+// parameter for clients such as EventSource that cannot set headers.
+func (k *apiKeyRegistry) authenticate(r *http.Request) (apiKey, bool) {
+	presented := r.Header.Get("X-API-Key")
+	if presented == "" {
+		presented = r.URL.Query().Get("api_key")
+	}
+	return k.lookup(presented)
+}
+
+// lookup finds the key a client presented, over HTTP or gRPC.
+func (k *apiKeyRegistry) lookup(presented string) (apiKey, bool) {
+	if presented == "" {
+		return apiKey{}, false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[hashAPIKey(presented)]
+	return key, ok
+}
+
+// keyStatus is where a key stands against its quota and rate limit.
+type keyStatus struct {
+	Name           string    `json:"name"`
+	DailyQuota     int       `json:"daily_quota"`
+	UsedToday      int       `json:"used_today"`
+	QuotaResetsAt  time.Time `json:"quota_resets_at"`
+	RateLimit      int       `json:"rate_limit"`
+	UsedThisMinute int       `json:"used_this_minute"`
+	RateResetsAt   time.Time `json:"rate_resets_at"`
+	Total          int64     `json:"total"`
+}
+
+func (s keyStatus) quotaExceeded() bool {
+	return s.DailyQuota > 0 && s.UsedToday >= s.DailyQuota
+}
+
+func (s keyStatus) rateLimited() bool {
+	return s.RateLimit > 0 && s.UsedThisMinute >= s.RateLimit
+}
+
+// status returns key's usage, starting a new day or minute when one has
+// begun. k.mu must be held.
+func (k *apiKeyRegistry) status(key apiKey) (keyStatus, *keyUsage) {
+	now := k.now().UTC()
+	usage, ok := k.usage[key.Name]
+	if !ok {
+		usage = &keyUsage{}
+		k.usage[key.Name] = usage
+	}
+	if day := now.Format(time.DateOnly); usage.day != day {
+		usage.day = day
+		usage.today = 0
+	}
+	if window := now.Truncate(time.Minute); !usage.window.Equal(window) {
+		usage.window = window
+		usage.minute = 0
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return keyStatus{
+		Name:           key.Name,
+		DailyQuota:     key.DailyQuota,
+		UsedToday:      usage.today,
+		QuotaResetsAt:  midnight,
+		RateLimit:      key.RateLimit,
+		UsedThisMinute: usage.minute,
+		RateResetsAt:   usage.window.Add(time.Minute),
+		Total:          usage.total,
+	}, usage
+}
+
+// use counts a request by key unless its quota or rate limit is used up, and
+// returns the key's status either way.
+func (k *apiKeyRegistry) use(key apiKey) (keyStatus, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	status, usage := k.status(key)
+	if status.quotaExceeded() || status.rateLimited() {
+		return status, false
+	}
+	usage.today++
+	usage.minute++
+	usage.total++
+	status.UsedToday, status.UsedThisMinute, status.Total = usage.today, usage.minute, usage.total
+	return status, true
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `ApiKey header="X-API-Key"`)
+	writeJSON(w, http.StatusUnauthorized, apiError{Code: "invalid_api_key", Message: "a valid API key is required in the X-API-Key header"})
+}
+
+// setLimitHeaders tells the client how much of its rate limit and quota is
+// left, and when each resets, in seconds.
+func setLimitHeaders(w http.ResponseWriter, status keyStatus, now time.Time) {
+	if status.RateLimit > 0 {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.RateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(status.RateLimit-status.UsedThisMinute, 0)))
+		w.Header().Set("X-RateLimit-Reset", secondsUntil(status.RateResetsAt, now))
+	}
+	if status.DailyQuota > 0 {
+		w.Header().Set("X-Quota-Limit", strconv.Itoa(status.DailyQuota))
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(max(status.DailyQuota-status.UsedToday, 0)))
+		w.Header().Set("X-Quota-Reset", secondsUntil(status.QuotaResetsAt, now))
+	}
+}
+
+func secondsUntil(t, now time.Time) string {
+	return strconv.Itoa(int(t.Sub(now).Seconds() + 0.999))
+}
+
+// requireAPIKey counts each request against its key. A nil registry leaves
+// the API open.
+func requireAPIKey(keys *apiKeyRegistry, next http.HandlerFunc) http.HandlerFunc {
+	if keys == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := keys.authenticate(r)
+		if !ok {
+			writeUnauthorized(w)
+			return
+		}
+		status, ok := keys.use(key)
+		now := keys.now()
+		setLimitHeaders(w, status, now)
+		if !ok {
+			if status.quotaExceeded() {
+				w.Header().Set("Retry-After", secondsUntil(status.QuotaResetsAt, now))
+				writeJSON(w, http.StatusTooManyRequests, apiError{Code: "quota_exceeded", Message: fmt.Sprintf("daily quota of %d requests used up", status.DailyQuota)})
+				return
+			}
+			w.Header().Set("Retry-After", secondsUntil(status.RateResetsAt, now))
+			writeJSON(w, http.StatusTooManyRequests, apiError{Code: "rate_limited", Message: fmt.Sprintf("rate limit of %d requests per minute reached", status.RateLimit)})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// usageHandler serves GET /api/usage, the calling key's usage. It is not
+// counted against the key.
+func usageHandler(keys *apiKeyRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if keys == nil {
+			writeJSON(w, http.StatusNotFound, apiError{Code: "api_keys_disabled", Message: "API keys are disabled, set API_KEYS, API_KEYS_FILE, or API_KEYS_DB to enable them"})
+			return
+		}
+		key, ok := keys.authenticate(r)
+		if !ok {
+			writeUnauthorized(w)
+			return
+		}
+		keys.mu.Lock()
+		status, _ := keys.status(key)
+		keys.mu.Unlock()
+		setLimitHeaders(w, status, keys.now())
+		writeJSON(w, http.StatusOK, status)
+	}
+}
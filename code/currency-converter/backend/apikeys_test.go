@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type stubKeySource []apiKey
+
+func (s stubKeySource) APIKeys(context.Context) ([]apiKey, error) { return s, nil }
+
+func newTestKeys(t *testing.T, keys string, now *time.Time) *apiKeyRegistry {
+	t.Helper()
+	registry := newAPIKeyRegistry(apiKeyConfig{keys: keys, dailyQuota: 1000, rateLimit: 60}, nil)
+	registry.now = func() time.Time { return *now }
+	if err := registry.reload(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return registry
+}
+
+func callWithKey(handler http.HandlerFunc, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/convert?base=USD&target=IDR", nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	res := httptest.NewRecorder()
+	handler(res, req)
+	return res
+}
+
+func TestParseAPIKey(t *testing.T) {
+	config := apiKeyConfig{dailyQuota: 1000, rateLimit: 60}
+	tests := []struct {
+		spec      string
+		wantQuota int
+		wantLimit int
+		wantErr   bool
+	}{
+		{spec: "alice:secret", wantQuota: 1000, wantLimit: 60},
+		{spec: "alice:secret:50000", wantQuota: 50000, wantLimit: 60},
+		{spec: "alice:secret::0", wantQuota: 1000, wantLimit: 0},
+		{spec: "secret", wantErr: true},
+		{spec: "alice:", wantErr: true},
+		{spec: "alice:secret:lots", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			key, err := parseAPIKey(tc.spec, config)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key.Name != "alice" || key.hash != hashAPIKey("secret") {
+				t.Fatalf("expected alice's key, got %+v", key)
+			}
+			if key.DailyQuota != tc.wantQuota || key.RateLimit != tc.wantLimit {
+				t.Fatalf("expected quota %d and limit %d, got %d and %d", tc.wantQuota, tc.wantLimit, key.DailyQuota, key.RateLimit)
+			}
+		})
+	}
+}
+
+func TestAPIKeySources(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(file, []byte("# partners\nbob:bob-key:10\n\n"), 0o600); err != nil {
+		t.Fatalf("failed to write keys: %v", err)
+	}
+	registry := newAPIKeyRegistry(apiKeyConfig{keys: "alice:alice-key", file: file, dailyQuota: 1000, rateLimit: 60},
+		stubKeySource{{Name: "carol", hash: hashAPIKey("carol-key"), DailyQuota: -1, RateLimit: 5}})
+	if err := registry.reload(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for key, want := range map[string]apiKey{
+		"alice-key": {Name: "alice", DailyQuota: 1000, RateLimit: 60},
+		"bob-key":   {Name: "bob", DailyQuota: 10, RateLimit: 60},
+		"carol-key": {Name: "carol", DailyQuota: 1000, RateLimit: 5},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/usage", nil)
+		req.Header.Set("X-API-Key", key)
+		got, ok := registry.authenticate(req)
+		if !ok || got.Name != want.Name || got.DailyQuota != want.DailyQuota || got.RateLimit != want.RateLimit {
+			t.Fatalf("expected %+v for %s, got %+v", want, key, got)
+		}
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	now := time.Date(2026, 10, 18, 23, 58, 30, 0, time.UTC)
+	keys := newTestKeys(t, "alice:alice-key:3:2", &now)
+	handler := requireAPIKey(keys, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if res := callWithKey(handler, ""); res.Code != http.StatusUnauthorized || res.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 with WWW-Authenticate, got %d", res.Code)
+	}
+	if res := callWithKey(handler, "wrong"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, res.Code)
+	}
+
+	res := callWithKey(handler, "alice-key")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if got := res.Header().Get("X-RateLimit-Remaining"); got != "1" {
+		t.Fatalf("expected 1 request left this minute, got %q", got)
+	}
+	if got := res.Header().Get("X-Quota-Remaining"); got != "2" {
+		t.Fatalf("expected 2 requests left today, got %q", got)
+	}
+
+	callWithKey(handler, "alice-key")
+	res = callWithKey(handler, "alice-key")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected 429 with Retry-After 30, got %d and %q", res.Code, res.Header().Get("Retry-After"))
+	}
+	var body apiError
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.Code != "rate_limited" {
+		t.Fatalf("expected code rate_limited, got %+v (%v)", body, err)
+	}
+
+	// A new minute lifts the rate limit, but the daily quota has one left.
+	now = now.Add(30 * time.Second)
+	if res := callWithKey(handler, "alice-key"); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	res = callWithKey(handler, "alice-key")
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil || res.Code != http.StatusTooManyRequests || body.Code != "quota_exceeded" {
+		t.Fatalf("expected 429 quota_exceeded, got %d %+v", res.Code, body)
+	}
+
+	// The quota starts over at midnight UTC.
+	now = now.Add(time.Hour)
+	if res := callWithKey(handler, "alice-key"); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	keys := newTestKeys(t, "alice:alice-key", &now)
+	counted := requireAPIKey(keys, func(http.ResponseWriter, *http.Request) {})
+	callWithKey(counted, "alice-key")
+	callWithKey(counted, "alice-key")
+
+	res := callWithKey(usageHandler(keys), "alice-key")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var status keyStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if status.Name != "alice" || status.UsedToday != 2 || status.DailyQuota != 1000 || status.Total != 2 {
+		t.Fatalf("expected 2 of 1000 used by alice, got %+v", status)
+	}
+	if !status.QuotaResetsAt.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the quota to reset at midnight, got %s", status.QuotaResetsAt)
+	}
+
+	if res := callWithKey(usageHandler(nil), "alice-key"); res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d without keys, got %d", http.StatusNotFound, res.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// backgroundRefreshTimeout bounds a refresh that no request is waiting for.
+const backgroundRefreshTimeout = 30 * time.Second
+
+// rateQuote is a rate with where and when it was fetched.
+type rateQuote struct {
+	Rate      float64
+	Source    string
+	FetchedAt time.Time
+	// Stale is set when the rate is older than the cache TTL.
+	Stale bool
+}
+
+type cacheConfig struct {
+	// ttl is how long a rate is served without asking upstream. Zero turns
+	// the cache off.
+	ttl time.Duration
+	// staleWhileRevalidate is how long past the TTL a rate is still served
+	// at once while a background refresh fetches a new one.
+	staleWhileRevalidate time.Duration
+	// staleIfError is how long past the TTL a rate is served when every
+	// provider fails.
+	staleIfError time.Duration
+}
+
+func loadCacheConfig() (cacheConfig, error) {
+	config := cacheConfig{ttl: time.Minute}
+	for key, target := range map[string]*time.Duration{
+		"RATE_CACHE_TTL":                    &config.ttl,
+		"RATE_CACHE_STALE_WHILE_REVALIDATE": &config.staleWhileRevalidate,
+		"RATE_CACHE_STALE_IF_ERROR":         &config.staleIfError,
+	} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return cacheConfig{}, fmt.Errorf("%s must be a duration such as 30s or 5m, got %q", key, value)
+		}
+		*target = d
+	}
+	return config, nil
+}
+
+type cacheEntry struct {
+	quote      rateQuote
+	refreshing bool
+}
+
+// inflightFetch lets concurrent misses for a pair share one upstream call.
+type inflightFetch struct {
+	done  chan struct{}
+	quote rateQuote
+	err   error
+	// waiters counts the callers still waiting. The call is canceled when
+	// the last of them gives up, so an upstream fetch does not outlive the
+	// requests that wanted it.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// rateCache keeps the last rate of each pair in memory.
+type rateCache struct {
+	config cacheConfig
+	fetch  func(ctx context.Context, base, target string) (float64, string, error)
+	now    func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*cacheEntry
+	inflight map[string]*inflightFetch
+}
+
+func newRateCache(config cacheConfig, fetch func(ctx context.Context, base, target string) (float64, string, error)) *rateCache {
+	return &rateCache{
+		config:   config,
+		fetch:    fetch,
+		now:      time.Now,
+		entries:  map[string]*cacheEntry{},
+		inflight: map[string]*inflightFetch{},
+	}
+}
+
+// Quote serves the cached rate while it is fresh, a stale one while it is
+// revalidated or when upstream fails within the configured windows, and
+// fetches otherwise.
+func (c *rateCache) Quote(ctx context.Context, base, target string) (rateQuote, error) {
+	key := base + "/" + target
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	var age time.Duration
+	if ok {
+		age = c.now().Sub(entry.quote.FetchedAt)
+	}
+	switch {
+	case ok && age < c.config.ttl:
+		quote := entry.quote
+		c.mu.Unlock()
+		return quote, nil
+	case ok && age < c.config.ttl+c.config.staleWhileRevalidate:
+		quote := entry.quote
+		quote.Stale = true
+		if !entry.refreshing {
+			entry.refreshing = true
+			go c.refresh(base, target)
+		}
+		c.mu.Unlock()
+		return quote, nil
+	}
+	c.mu.Unlock()
+
+	quote, err := c.load(ctx, base, target)
+	if err == nil {
+		return quote, nil
+	}
+	if ok && age < c.config.ttl+c.config.staleIfError {
+		log.Printf("serving a %s old %s rate: %v", age.Round(time.Second), key, err)
+		quote := entry.quote
+		quote.Stale = true
+		return quote, nil
+	}
+	return rateQuote{}, err
+}
+
+// Refresh fetches the pair now and caches it, whatever the age of the
+// cached rate.
+func (c *rateCache) Refresh(ctx context.Context, base, target string) (rateQuote, error) {
+	return c.load(ctx, base, target)
+}
+
+// load fetches the pair, joining a fetch already under way.
+func (c *rateCache) load(ctx context.Context, base, target string) (rateQuote, error) {
+	key := base + "/" + target
+
+	c.mu.Lock()
+	call, ok := c.inflight[key]
+	if !ok {
+		// The call outlives a first caller that gives up while others
+		// still wait, but keeps its deadline.
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		if deadline, ok := ctx.Deadline(); ok {
+			callCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		}
+		call = &inflightFetch{done: make(chan struct{}), cancel: cancel}
+		c.inflight[key] = call
+		go c.run(callCtx, call, key, base, target)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.quote, call.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			// Callers from now on start a fetch of their own.
+			if c.inflight[key] == call {
+				delete(c.inflight, key)
+			}
+		}
+		c.mu.Unlock()
+		return rateQuote{}, ctx.Err()
+	}
+}
+
+func (c *rateCache) run(ctx context.Context, call *inflightFetch, key, base, target string) {
+	defer call.cancel()
+	rate, source, err := c.fetch(ctx, base, target)
+	call.quote, call.err = rateQuote{Rate: rate, Source: source, FetchedAt: c.now()}, err
+
+	c.mu.Lock()
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+	}
+	if err == nil && c.config.ttl > 0 {
+		c.entries[key] = &cacheEntry{quote: call.quote}
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+func (c *rateCache) refresh(base, target string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundRefreshTimeout)
+	defer cancel()
+	if _, err := c.load(ctx, base, target); err != nil {
+		log.Printf("background refresh of %s/%s failed: %v", base, target, err)
+		c.mu.Lock()
+		if entry, ok := c.entries[base+"/"+target]; ok {
+			entry.refreshing = false
+		}
+		c.mu.Unlock()
+	}
+}
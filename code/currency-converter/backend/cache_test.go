@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUpstream counts fetches and answers with rate, or err when it is set.
+type fakeUpstream struct {
+	mu    sync.Mutex
+	calls int
+	rate  float64
+	err   error
+}
+
+func (f *fakeUpstream) fetch(context.Context, string, string) (float64, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return 0, "", f.err
+	}
+	return f.rate, "frankfurter", nil
+}
+
+func (f *fakeUpstream) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newTestCache(config cacheConfig, upstream *fakeUpstream, now *time.Time) *rateCache {
+	cache := newRateCache(config, upstream.fetch)
+	cache.now = func() time.Time { return *now }
+	return cache
+}
+
+func TestRateCacheServesFreshRates(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+	upstream := &fakeUpstream{rate: 16250}
+	cache := newTestCache(cacheConfig{ttl: time.Minute}, upstream, &now)
+
+	for i := 0; i < 3; i++ {
+		quote, err := cache.Quote(context.Background(), "USD", "IDR")
+		if err != nil || quote.Rate != 16250 || quote.Stale {
+			t.Fatalf("expected a fresh 16250, got %+v (%v)", quote, err)
+		}
+		now = now.Add(20 * time.Second)
+	}
+	if upstream.callCount() != 1 {
+		t.Fatalf("expected one upstream fetch, got %d", upstream.callCount())
+	}
+
+	upstream.rate = 16300
+	quote, _ := cache.Quote(context.Background(), "USD", "IDR")
+	if quote.Rate != 16300 || upstream.callCount() != 2 {
+		t.Fatalf("expected an expired rate fetched again, got %+v after %d fetches", quote, upstream.callCount())
+	}
+}
+
+func TestRateCacheStaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+	upstream := &fakeUpstream{rate: 16250}
+	cache := newTestCache(cacheConfig{ttl: time.Minute, staleWhileRevalidate: time.Minute}, upstream, &now)
+	cache.Quote(context.Background(), "USD", "IDR")
+
+	now = now.Add(90 * time.Second)
+	upstream.rate = 16300
+	quote, err := cache.Quote(context.Background(), "USD", "IDR")
+	if err != nil || quote.Rate != 16250 || !quote.Stale {
+		t.Fatalf("expected the stale 16250 served at once, got %+v (%v)", quote, err)
+	}
+
+	// The refresh runs in the background; stale answers until it lands do not start another.
+	deadline := time.Now().Add(time.Second)
+	for quote.Stale && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		quote, _ = cache.Quote(context.Background(), "USD", "IDR")
+	}
+	if quote.Rate != 16300 || quote.Stale || upstream.callCount() != 2 {
+		t.Fatalf("expected the refreshed 16300 after one refresh, got %+v after %d fetches", quote, upstream.callCount())
+	}
+}
+
+func TestRateCacheStaleIfError(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+	upstream := &fakeUpstream{rate: 16250}
+	cache := newTestCache(cacheConfig{ttl: time.Minute, staleIfError: time.Hour}, upstream, &now)
+	cache.Quote(context.Background(), "USD", "IDR")
+
+	upstream.err = errors.New("upstream down")
+	now = now.Add(30 * time.Minute)
+	quote, err := cache.Quote(context.Background(), "USD", "IDR")
+	if err != nil || quote.Rate != 16250 || !quote.Stale {
+		t.Fatalf("expected the stale rate while upstream is down, got %+v (%v)", quote, err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := cache.Quote(context.Background(), "USD", "IDR"); err == nil {
+		t.Fatalf("expected an error once the rate is too old to serve")
+	}
+}
+
+func TestLoadCacheConfig(t *testing.T) {
+	t.Setenv("RATE_CACHE_TTL", "30s")
+	t.Setenv("RATE_CACHE_STALE_IF_ERROR", "10m")
+	config, err := loadCacheConfig()
+	if err != nil || config.ttl != 30*time.Second || config.staleIfError != 10*time.Minute || config.staleWhileRevalidate != 0 {
+		t.Fatalf("expected the configured durations, got %+v (%v)", config, err)
+	}
+
+	t.Setenv("RATE_CACHE_TTL", "soon")
+	if _, err := loadCacheConfig(); err == nil {
+		t.Fatalf("expected an error for an invalid duration")
+	}
+}
+
+func TestRateCacheCancelsFetchWhenEveryCallerLeaves(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	cache := newRateCache(cacheConfig{ttl: time.Minute}, func(ctx context.Context, base, target string) (float64, string, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return 0, "", ctx.Err()
+	})
+	waiters := func() int {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		if call, ok := cache.inflight["USD/IDR"]; ok {
+			return call.waiters
+		}
+		return 0
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{first, second} {
+		go func(ctx context.Context) {
+			_, err := cache.Quote(ctx, "USD", "IDR")
+			errs <- err
+		}(ctx)
+	}
+	<-started
+	for deadline := time.Now().Add(time.Second); waiters() != 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected both callers to wait on one fetch, got %d", waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelFirst()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the first caller to give up, got %v", err)
+	}
+	select {
+	case <-canceled:
+		t.Fatal("expected the fetch to go on while a caller waits")
+	default:
+	}
+
+	cancelSecond()
+	<-errs
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the fetch to be canceled once no caller waits")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// runConvert serves the convert subcommand:
+//
+//	currency-converter convert 100 USD IDR [--date 2025-10-23] [--json]
+//
+// It converts through the same providers, cache, store, and fees as the
+// server, and returns the exit code: 2 for invalid arguments and 1 when the
+// rate cannot be fetched.
+func runConvert(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: currency-converter convert <amount> <base> <target> [flags]")
+		flags.PrintDefaults()
+	}
+	query := url.Values{}
+	for _, name := range []string{"date", "rounding", "spread", "fee"} {
+		name := name
+		flags.Func(name, convertFlagUsage[name], func(value string) error {
+			query.Set(name, value)
+			return nil
+		})
+	}
+	asJSON := flags.Bool("json", false, "print the result as the API's JSON")
+
+	// Flags may come before, between, or after the arguments.
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return 2
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) != 3 {
+		flags.Usage()
+		return 2
+	}
+	query.Set("amount", positional[0])
+	query.Set("base", positional[1])
+	query.Set("target", positional[2])
+
+	c, err := parseConversion(query, time.Now())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	quote, err := quoteOn(ctx, c.base, c.target, c.date)
+	if err != nil {
+		_, failure := upstreamError(err)
+		fmt.Fprintf(stderr, "%s: %v\n", failure.Message, err)
+		return 1
+	}
+	resp := c.response(quote)
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(resp); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintln(stdout, formatConversion(resp))
+	return 0
+}
+
+var convertFlagUsage = map[string]string{
+	"date":     "convert at the rate of this past day, YYYY-MM-DD",
+	"rounding": "half-even, half-up, half-down, up, down, ceiling, or floor",
+	"spread":   "spread percentage in place of FEE_SPREAD_PERCENT",
+	"fee":      "fixed fee in the base currency in place of FEE_FIXED",
+}
+
+// formatConversion describes a conversion on one line, e.g.
+// "100 USD = 1625000.00 IDR at 16250 (frankfurter, 2026-10-18 12:00 UTC)".
+func formatConversion(resp convertResponse) string {
+	line := fmt.Sprintf("%s %s = %s %s at %v", formatDecimal(ratFromFloat(resp.Amount)), resp.Base, resp.Converted, resp.Target, resp.Rate)
+	if resp.Fees != nil {
+		line += fmt.Sprintf(", %v after fees of %s %s", resp.EffectiveRate, resp.Fees.Cost, resp.Target)
+	}
+	line += fmt.Sprintf(" (%s, %s", resp.Source, resp.FetchedAt.Format("2006-01-02 15:04 MST"))
+	if resp.Stale {
+		line += ", stale"
+	}
+	return line + ")"
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunConvert(t *testing.T) {
+	originalFetcher, originalPast := rateFetcher, pastRateFetcher
+	fetchedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	rateFetcher = func(_ context.Context, base, target string) (rateQuote, error) {
+		if base == "USD" && target == "IDR" {
+			return rateQuote{Rate: 16250, Source: "frankfurter", FetchedAt: fetchedAt}, nil
+		}
+		return rateQuote{}, errors.New("boom")
+	}
+	pastRateFetcher = func(context.Context, string, string, time.Time) (rateQuote, error) {
+		return rateQuote{Rate: 16570, Source: "frankfurter", FetchedAt: time.Date(2025, 10, 23, 15, 0, 0, 0, time.UTC)}, nil
+	}
+	defer func() { rateFetcher, pastRateFetcher = originalFetcher, originalPast }()
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+		wantErr  string
+	}{
+		{name: "plain", args: []string{"100", "usd", "IDR"}, wantOut: "100 USD = 1625000.00 IDR at 16250 (frankfurter, 2026-10-18 12:00 UTC)\n"},
+		{name: "flags after arguments", args: []string{"10", "USD", "IDR", "--date", "2025-10-23", "--rounding=up"}, wantOut: "10 USD = 165700.00 IDR at 16570"},
+		{name: "fees", args: []string{"--spread", "1", "100", "USD", "IDR"}, wantOut: "after fees of 16250.00 IDR"},
+		{name: "missing target", args: []string{"100", "USD"}, wantCode: 2, wantErr: "usage:"},
+		{name: "unknown currency", args: []string{"100", "USS", "IDR"}, wantCode: 2, wantErr: "did you mean USD"},
+		{name: "unknown flag", args: []string{"100", "USD", "IDR", "--verbose"}, wantCode: 2, wantErr: "flag provided but not defined"},
+		{name: "fetch fails", args: []string{"100", "USD", "EUR"}, wantCode: 1, wantErr: "failed to fetch rate"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runConvert(context.Background(), tc.args, &stdout, &stderr)
+			if code != tc.wantCode {
+				t.Fatalf("expected exit code %d, got %d: %s", tc.wantCode, code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tc.wantOut) || !strings.Contains(stderr.String(), tc.wantErr) {
+				t.Fatalf("expected %q and %q, got %q and %q", tc.wantOut, tc.wantErr, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunConvertJSON(t *testing.T) {
+	originalFetcher := rateFetcher
+	rateFetcher = func(context.Context, string, string) (rateQuote, error) {
+		return rateQuote{Rate: 16250, Source: "frankfurter", FetchedAt: time.Now()}, nil
+	}
+	defer func() { rateFetcher = originalFetcher }()
+
+	var stdout, stderr bytes.Buffer
+	if code := runConvert(context.Background(), []string{"--json", "2", "USD", "IDR"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	var payload convertResponse
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if payload.Converted != "32500.00" || payload.Source != "frankfurter" {
+		t.Fatalf("expected the API's conversion, got %+v", payload)
+	}
+}
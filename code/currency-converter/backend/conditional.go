@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pastRateMaxAge is how long browsers and CDNs may keep a conversion at a
+// past day's rate. Those rarely change, but the latest working day's rate
+// can still be published late.
+const pastRateMaxAge = time.Hour
+
+// rateCacheTTL is how long the rate cache keeps a rate, which responses may
+// be cached for too.
+var rateCacheTTL time.Duration
+
+// rateETag identifies the rate a conversion used. It is weak because the
+// body also carries the rate's age, which changes with every second.
+func rateETag(quote rateQuote) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%v|%d", quote.Source, quote.Rate, quote.FetchedAt.UnixNano())))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// rateCacheControl lets a live rate be cached for what is left of its TTL,
+// and a past day's rate for pastRateMaxAge. Stale rates are not cached, so a
+// fresh one is picked up as soon as a provider answers again.
+func rateCacheControl(quote rateQuote, past bool, now time.Time) string {
+	if quote.Stale {
+		return "no-cache"
+	}
+	maxAge := pastRateMaxAge
+	if !past {
+		maxAge = quote.FetchedAt.Add(rateCacheTTL).Sub(now)
+	}
+	if seconds := int(maxAge.Seconds()); seconds > 0 {
+		return fmt.Sprintf("public, max-age=%d", seconds)
+	}
+	return "no-cache"
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as GET requests do.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
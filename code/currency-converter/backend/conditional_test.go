@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateCacheControl(t *testing.T) {
+	originalTTL := rateCacheTTL
+	rateCacheTTL = time.Minute
+	defer func() { rateCacheTTL = originalTTL }()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		quote rateQuote
+		past  bool
+		want  string
+	}{
+		{"fresh rate", rateQuote{FetchedAt: now.Add(-20 * time.Second)}, false, "public, max-age=40"},
+		{"rate past its TTL", rateQuote{FetchedAt: now.Add(-2 * time.Minute)}, false, "no-cache"},
+		{"stale rate", rateQuote{FetchedAt: now, Stale: true}, false, "no-cache"},
+		{"past day", rateQuote{FetchedAt: now.Add(-48 * time.Hour)}, true, "public, max-age=3600"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rateCacheControl(tc.quote, tc.past, now); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"xyz", W/"abc"`, true},
+		{`"xyz"`, false},
+		{"*", true},
+	}
+	for _, tc := range tests {
+		if got := etagMatches(tc.header, `W/"abc"`); got != tc.want {
+			t.Fatalf("expected %t for %q, got %t", tc.want, tc.header, got)
+		}
+	}
+}
+
+func TestConvertHandlerConditionalGet(t *testing.T) {
+	originalFetcher, originalTTL := rateFetcher, rateCacheTTL
+	quote := rateQuote{Rate: 16250, Source: "frankfurter", FetchedAt: time.Now().Add(-10 * time.Second)}
+	rateFetcher = func(context.Context, string, string) (rateQuote, error) { return quote, nil }
+	rateCacheTTL = time.Minute
+	defer func() { rateFetcher, rateCacheTTL = originalFetcher, originalTTL }()
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/convert?base=USD&target=IDR&amount=2", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res := httptest.NewRecorder()
+		convertHandler(res, req)
+		return res
+	}
+
+	res := get("")
+	etag := res.Header().Get("ETag")
+	if res.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d and %q", res.Code, etag)
+	}
+	if cc := res.Header().Get("Cache-Control"); cc != "public, max-age=50" && cc != "public, max-age=49" {
+		t.Fatalf("expected the rest of the TTL as max-age, got %q", cc)
+	}
+
+	res = get(etag)
+	if res.Code != http.StatusNotModified || res.Body.Len() != 0 || res.Header().Get("ETag") != etag {
+		t.Fatalf("expected 304 without a body for the same rate, got %d with %q", res.Code, res.Body.String())
+	}
+
+	quote.Rate = 16260
+	quote.FetchedAt = time.Now()
+	if res = get(etag); res.Code != http.StatusOK || res.Header().Get("ETag") == etag {
+		t.Fatalf("expected 200 with a new ETag once the rate changes, got %d", res.Code)
+	}
+}
@@ -0,0 +1,150 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: currencyconverter/v1/converter.proto
+
+package converterpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CurrencyConverter_Convert_FullMethodName        = "/currencyconverter.v1.CurrencyConverter/Convert"
+	CurrencyConverter_ListCurrencies_FullMethodName = "/currencyconverter.v1.CurrencyConverter/ListCurrencies"
+)
+
+// CurrencyConverterClient is the client API for CurrencyConverter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CurrencyConverterClient interface {
+	// Convert converts one amount, like GET /api/convert.
+	Convert(ctx context.Context, in *ConvertRequest, opts ...grpc.CallOption) (*ConvertResponse, error)
+	// ListCurrencies lists the supported currencies, like GET /api/currencies.
+	ListCurrencies(ctx context.Context, in *ListCurrenciesRequest, opts ...grpc.CallOption) (*ListCurrenciesResponse, error)
+}
+
+type currencyConverterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCurrencyConverterClient(cc grpc.ClientConnInterface) CurrencyConverterClient {
+	return &currencyConverterClient{cc}
+}
+
+func (c *currencyConverterClient) Convert(ctx context.Context, in *ConvertRequest, opts ...grpc.CallOption) (*ConvertResponse, error) {
+	out := new(ConvertResponse)
+	err := c.cc.Invoke(ctx, CurrencyConverter_Convert_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *currencyConverterClient) ListCurrencies(ctx context.Context, in *ListCurrenciesRequest, opts ...grpc.CallOption) (*ListCurrenciesResponse, error) {
+	out := new(ListCurrenciesResponse)
+	err := c.cc.Invoke(ctx, CurrencyConverter_ListCurrencies_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CurrencyConverterServer is the server API for CurrencyConverter service.
+// All implementations must embed UnimplementedCurrencyConverterServer
+// for forward compatibility
+type CurrencyConverterServer interface {
+	// Convert converts one amount, like GET /api/convert.
+	Convert(context.Context, *ConvertRequest) (*ConvertResponse, error)
+	// ListCurrencies lists the supported currencies, like GET /api/currencies.
+	ListCurrencies(context.Context, *ListCurrenciesRequest) (*ListCurrenciesResponse, error)
+	mustEmbedUnimplementedCurrencyConverterServer()
+}
+
+// UnimplementedCurrencyConverterServer must be embedded to have forward compatible implementations.
+type UnimplementedCurrencyConverterServer struct {
+}
+
+func (UnimplementedCurrencyConverterServer) Convert(context.Context, *ConvertRequest) (*ConvertResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Convert not implemented")
+}
+func (UnimplementedCurrencyConverterServer) ListCurrencies(context.Context, *ListCurrenciesRequest) (*ListCurrenciesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCurrencies not implemented")
+}
+func (UnimplementedCurrencyConverterServer) mustEmbedUnimplementedCurrencyConverterServer() {}
+
+// UnsafeCurrencyConverterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CurrencyConverterServer will
+// result in compilation errors.
+type UnsafeCurrencyConverterServer interface {
+	mustEmbedUnimplementedCurrencyConverterServer()
+}
+
+func RegisterCurrencyConverterServer(s grpc.ServiceRegistrar, srv CurrencyConverterServer) {
+	s.RegisterService(&CurrencyConverter_ServiceDesc, srv)
+}
+
+func _CurrencyConverter_Convert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConvertRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CurrencyConverterServer).Convert(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CurrencyConverter_Convert_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CurrencyConverterServer).Convert(ctx, req.(*ConvertRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CurrencyConverter_ListCurrencies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCurrenciesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CurrencyConverterServer).ListCurrencies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CurrencyConverter_ListCurrencies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CurrencyConverterServer).ListCurrencies(ctx, req.(*ListCurrenciesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CurrencyConverter_ServiceDesc is the grpc.ServiceDesc for CurrencyConverter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CurrencyConverter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "currencyconverter.v1.CurrencyConverter",
+	HandlerType: (*CurrencyConverterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Convert",
+			Handler:    _CurrencyConverter_Convert_Handler,
+		},
+		{
+			MethodName: "ListCurrencies",
+			Handler:    _CurrencyConverter_ListCurrencies_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "currencyconverter/v1/converter.proto",
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxSuggestions caps the codes offered for an unknown currency.
+const maxSuggestions = 3
+
+// Asset classes, which decide the providers a pair is routed to.
+const (
+	classFiat   = "fiat"
+	classCrypto = "crypto"
+	classMetal  = "metal"
+)
+
+// Currency is an ISO 4217 currency, a precious metal, or a cryptocurrency.
+// Decimals is the places amounts are rounded to, such as 2 for cents or 0 for
+// JPY.
+type Currency struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+	Class    string `json:"class"`
+}
+
+//go:embed currencies.json
+var currenciesJSON []byte
+
+// currencies lists the supported currencies in code order; currencyByCode
+// indexes them.
+var (
+	currencies     []Currency
+	currencyByCode = map[string]Currency{}
+)
+
+func init() {
+	if err := json.Unmarshal(currenciesJSON, &currencies); err != nil {
+		panic(fmt.Sprintf("parse currencies.json: %v", err))
+	}
+	for _, currency := range currencies {
+		currencyByCode[currency.Code] = currency
+	}
+}
+
+func currenciesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]Currency{"currencies": currencies}); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
+
+// parsePair reads a pair written "USD/IDR", "BTC-USD", or "USDIDR". Without
+// a separator the codes are told apart by the supported ones, so "DOGEUSD"
+// works too.
+func parsePair(value string) (ratePair, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if base, target, ok := strings.Cut(strings.ReplaceAll(value, "-", "/"), "/"); ok {
+		for _, code := range []string{base, target} {
+			if err := validateCurrency("pair", code); err != nil {
+				return ratePair{}, err
+			}
+		}
+		return ratePair{Base: base, Target: target}, nil
+	}
+	for split := 3; split <= 4 && split < len(value); split++ {
+		base, target := value[:split], value[split:]
+		if currencyByCode[base].Code != "" && currencyByCode[target].Code != "" {
+			return ratePair{Base: base, Target: target}, nil
+		}
+	}
+	return ratePair{}, fmt.Errorf("pair: %q must look like USD/IDR or BTC-USD", value)
+}
+
+// validateCurrency returns an error naming the closest codes when code is not
+// a supported currency.
+func validateCurrency(param, code string) error {
+	if _, ok := currencyByCode[code]; ok {
+		return nil
+	}
+	err := &paramError{Field: param, Message: fmt.Sprintf("unknown currency %q", code), Suggestions: suggestCurrencies(code)}
+	if len(err.Suggestions) > 0 {
+		err.Message += fmt.Sprintf(", did you mean %s?", strings.Join(err.Suggestions, ", "))
+	}
+	return err
+}
+
+// suggestCurrencies returns the codes one edit away from code, or two when
+// none is one away.
+func suggestCurrencies(code string) []string {
+	for distance := 1; distance <= 2; distance++ {
+		var suggestions []string
+		for _, currency := range currencies {
+			if editDistance(code, currency.Code) == distance {
+				suggestions = append(suggestions, currency.Code)
+				if len(suggestions) == maxSuggestions {
+					break
+				}
+			}
+		}
+		if len(suggestions) > 0 {
+			return suggestions
+		}
+	}
+	return nil
+}
+
+// editDistance is the edit distance between a and b, counting an insertion,
+// deletion, substitution, or swap of adjacent letters as one edit.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCurrenciesHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/currencies", nil)
+	res := httptest.NewRecorder()
+
+	currenciesHandler(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var payload struct {
+		Currencies []Currency `json:"currencies"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	found := map[string]Currency{}
+	for _, currency := range payload.Currencies {
+		found[currency.Code] = currency
+	}
+	if usd := found["USD"]; usd.Name != "US Dollar" || usd.Symbol != "$" || usd.Decimals != 2 {
+		t.Fatalf("expected USD with 2 decimals, got %+v", usd)
+	}
+	if found["JPY"].Decimals != 0 || found["KWD"].Decimals != 3 {
+		t.Fatalf("expected JPY with 0 decimals and KWD with 3, got %+v and %+v", found["JPY"], found["KWD"])
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	tests := []struct {
+		code     string
+		wantErr  bool
+		contains string
+	}{
+		{code: "USD"},
+		{code: "USS", wantErr: true, contains: "did you mean USD"},
+		{code: "IRD", wantErr: true, contains: "IDR"},
+		{code: "QQQQQ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.code, func(t *testing.T) {
+			err := validateCurrency("base", tc.code)
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.contains) {
+				t.Fatalf("expected an error containing %q, got %v", tc.contains, err)
+			}
+		})
+	}
+}
+
+func TestParsePair(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ratePair
+		wantErr bool
+	}{
+		{value: "USD/IDR", want: ratePair{Base: "USD", Target: "IDR"}},
+		{value: "btc-usd", want: ratePair{Base: "BTC", Target: "USD"}},
+		{value: "XAUIDR", want: ratePair{Base: "XAU", Target: "IDR"}},
+		{value: "DOGEUSD", want: ratePair{Base: "DOGE", Target: "USD"}},
+		{value: "USDUSDT", want: ratePair{Base: "USD", Target: "USDT"}},
+		{value: "BTC-USS", wantErr: true},
+		{value: "USDXYZ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			pair, err := parsePair(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", pair)
+				}
+				return
+			}
+			if err != nil || pair != tc.want {
+				t.Fatalf("expected %+v, got %+v (%v)", tc.want, pair, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	// The runtime image has no zoneinfo, so DAILY_SNAPSHOT_TIMEZONE is read
+	// from the copy embedded in the binary.
+	_ "time/tzdata"
+)
+
+const (
+	// dailyRetryDelay and dailyRetries bound how long a pair that could not
+	// be fetched at snapshot time is tried again.
+	dailyRetryDelay = 5 * time.Minute
+	dailyRetries    = 6
+)
+
+type dailyConfig struct {
+	pairs []ratePair
+	// hour and minute, in location, are when the snapshot is taken.
+	hour, minute int
+	location     *time.Location
+}
+
+// loadDailyConfig reads DAILY_SNAPSHOT_PAIRS, DAILY_SNAPSHOT_TIME, and
+// DAILY_SNAPSHOT_TIMEZONE. The default time is 16:00 in Frankfurt, when the
+// ECB publishes its reference rates. No pairs leaves the snapshot off.
+func loadDailyConfig() (dailyConfig, error) {
+	config := dailyConfig{hour: 16}
+	if value := os.Getenv("DAILY_SNAPSHOT_TIME"); value != "" {
+		at, err := time.Parse("15:04", value)
+		if err != nil {
+			return dailyConfig{}, fmt.Errorf("DAILY_SNAPSHOT_TIME must be a time of day such as 16:00, got %q", value)
+		}
+		config.hour, config.minute = at.Hour(), at.Minute()
+	}
+	zone := os.Getenv("DAILY_SNAPSHOT_TIMEZONE")
+	if zone == "" {
+		zone = "Europe/Berlin"
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return dailyConfig{}, fmt.Errorf("DAILY_SNAPSHOT_TIMEZONE must be a time zone such as Europe/Berlin, got %q", zone)
+	}
+	config.location = location
+
+	for _, item := range strings.Split(os.Getenv("DAILY_SNAPSHOT_PAIRS"), ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pair, err := parsePair(item)
+		if err != nil {
+			return dailyConfig{}, fmt.Errorf("DAILY_SNAPSHOT_PAIRS: %w", err)
+		}
+		config.pairs = append(config.pairs, pair)
+	}
+	return config, nil
+}
+
+// dailyRate is a pair's rate in the snapshot of Date, a UTC midnight.
+type dailyRate struct {
+	Date      time.Time
+	Base      string
+	Target    string
+	Rate      float64
+	Source    string
+	FetchedAt time.Time
+}
+
+// dailyRateStore keeps the daily snapshots.
+type dailyRateStore interface {
+	// SaveDaily keeps the first rate saved for each pair and day.
+	SaveDaily(ctx context.Context, rates []dailyRate) error
+	// Daily returns base's rates on the last day on or before date with a
+	// snapshot, or none.
+	Daily(ctx context.Context, base string, date time.Time) ([]dailyRate, error)
+}
+
+// dailySnapshotter saves the rate of each configured pair once a day, as a
+// reference rate for that day.
+type dailySnapshotter struct {
+	config     dailyConfig
+	store      dailyRateStore
+	fetch      func(ctx context.Context, base, target string) (rateQuote, error)
+	now        func() time.Time
+	retryDelay time.Duration
+}
+
+func newDailySnapshotter(config dailyConfig, store dailyRateStore, fetch func(ctx context.Context, base, target string) (rateQuote, error)) *dailySnapshotter {
+	return &dailySnapshotter{config: config, store: store, fetch: fetch, now: time.Now, retryDelay: dailyRetryDelay}
+}
+
+// Run takes a snapshot at the configured time each day, until ctx is done.
+// Started after today's time, it first takes the pairs today's snapshot is
+// missing, such as after a restart.
+func (s *dailySnapshotter) Run(ctx context.Context) {
+	if at := s.scheduledOn(s.now()); !at.After(s.now()) {
+		s.snapshot(ctx, at)
+	}
+	for {
+		next := s.next(s.now())
+		log.Printf("taking the daily snapshot of %d pairs at %s", len(s.config.pairs), next.Format(time.RFC3339))
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.snapshot(ctx, next)
+	}
+}
+
+// scheduledOn returns the snapshot time on the local day of t.
+func (s *dailySnapshotter) scheduledOn(t time.Time) time.Time {
+	local := t.In(s.config.location)
+	return time.Date(local.Year(), local.Month(), local.Day(), s.config.hour, s.config.minute, 0, 0, s.config.location)
+}
+
+// next returns the first snapshot time after t.
+func (s *dailySnapshotter) next(t time.Time) time.Time {
+	at := s.scheduledOn(t)
+	if !at.After(t) {
+		local := t.In(s.config.location)
+		at = time.Date(local.Year(), local.Month(), local.Day()+1, s.config.hour, s.config.minute, 0, 0, s.config.location)
+	}
+	return at
+}
+
+// snapshot saves the pairs missing from the snapshot of at's local day. Pairs
+// whose rate cannot be fetched are tried again every retryDelay, up to
+// dailyRetries times.
+func (s *dailySnapshotter) snapshot(ctx context.Context, at time.Time) {
+	local := at.In(s.config.location)
+	date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	pending := s.missing(ctx, date)
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == dailyRetries+1 {
+			log.Printf("gave up on the %s daily snapshot of %d pairs", date.Format(time.DateOnly), len(pending))
+			return
+		}
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.retryDelay):
+			}
+		}
+		pending = s.take(ctx, date, pending)
+	}
+}
+
+// missing returns the pairs the snapshot of date does not have yet.
+func (s *dailySnapshotter) missing(ctx context.Context, date time.Time) []ratePair {
+	saved := map[ratePair]bool{}
+	checked := map[string]bool{}
+	for _, pair := range s.config.pairs {
+		if checked[pair.Base] {
+			continue
+		}
+		checked[pair.Base] = true
+		lookupCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		rates, err := s.store.Daily(lookupCtx, pair.Base, date)
+		cancel()
+		if err != nil {
+			log.Printf("failed to look up the %s daily rates: %v", pair.Base, err)
+			continue
+		}
+		for _, rate := range rates {
+			if rate.Date.Equal(date) {
+				saved[ratePair{Base: rate.Base, Target: rate.Target}] = true
+			}
+		}
+	}
+
+	var missing []ratePair
+	for _, pair := range s.config.pairs {
+		if !saved[pair] {
+			missing = append(missing, pair)
+		}
+	}
+	return missing
+}
+
+// take fetches pairs and saves their rates as the snapshot of date. It
+// returns the pairs that were not saved.
+func (s *dailySnapshotter) take(ctx context.Context, date time.Time, pairs []ratePair) []ratePair {
+	var rates []dailyRate
+	var failed []ratePair
+	for _, pair := range pairs {
+		pairCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		quote, err := s.fetch(pairCtx, pair.Base, pair.Target)
+		cancel()
+		// A stale rate is some earlier day's, not this one's.
+		if err == nil && quote.Stale {
+			err = fmt.Errorf("only a stale rate from %s", quote.FetchedAt.Format(time.RFC3339))
+		}
+		if err != nil {
+			log.Printf("daily snapshot of %s failed: %v", pair, err)
+			failed = append(failed, pair)
+			continue
+		}
+		rates = append(rates, dailyRate{Date: date, Base: pair.Base, Target: pair.Target, Rate: quote.Rate, Source: quote.Source, FetchedAt: quote.FetchedAt})
+	}
+	if len(rates) == 0 {
+		return failed
+	}
+
+	saveCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	if err := s.store.SaveDaily(saveCtx, rates); err != nil {
+		log.Printf("failed to save the %s daily snapshot: %v", date.Format(time.DateOnly), err)
+		return pairs
+	}
+	return failed
+}
+
+type dailyResponse struct {
+	Base string `json:"base"`
+	// Date is the day of the snapshot, the last on or before the day asked
+	// for that has one.
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+	// Sources names the provider of each rate.
+	Sources map[string]string `json:"sources"`
+}
+
+// dailyHandler serves GET /api/daily?base=EUR&date=2026-10-16 from the daily
+// snapshots. A nil store means the snapshot is off.
+func dailyHandler(store dailyRateStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if store == nil {
+			writeError(w, http.StatusServiceUnavailable, "daily_rates_disabled", "daily rates need DAILY_SNAPSHOT_PAIRS and DATABASE_URL")
+			return
+		}
+
+		query := r.URL.Query()
+		base := strings.ToUpper(query.Get("base"))
+		if base == "" {
+			writeBadRequest(w, &paramError{Field: "base", Message: "query parameter is required"})
+			return
+		}
+		if err := validateCurrency("base", base); err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		now := time.Now().UTC()
+		date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		if value := query.Get("date"); value != "" {
+			var err error
+			if date, err = parseRateDate(value, now); err != nil {
+				writeBadRequest(w, invalidParam("date", err))
+				return
+			}
+		}
+
+		rates, err := store.Daily(r.Context(), base, date)
+		if err != nil {
+			log.Printf("failed to read daily rates: %v", err)
+			writeError(w, http.StatusServiceUnavailable, "store_unavailable", "daily rates could not be read")
+			return
+		}
+		if len(rates) == 0 {
+			writeError(w, http.StatusNotFound, "daily_rates_not_found", fmt.Sprintf("no daily %s rates on or before %s", base, date.Format(time.DateOnly)))
+			return
+		}
+
+		resp := dailyResponse{Base: base, Date: rates[0].Date.Format(time.DateOnly), Rates: map[string]float64{}, Sources: map[string]string{}}
+		for _, rate := range rates {
+			resp.Rates[rate.Target] = rate.Rate
+			resp.Sources[rate.Target] = rate.Source
+		}
+		// A past day's snapshot is not changed once taken.
+		if date.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)) {
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(pastRateMaxAge.Seconds())))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// SaveDaily inserts rates, leaving those a snapshot of the day already has.
+func (s postgresStore) SaveDaily(ctx context.Context, rates []dailyRate) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, rate := range rates {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO daily_rates (date, base, target, rate, source, fetched_at) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (base, date, target) DO NOTHING`,
+			rate.Date, rate.Base, rate.Target, rate.Rate, rate.Source, rate.FetchedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Daily reads base's rates on the last day on or before date with any.
+func (s postgresStore) Daily(ctx context.Context, base string, date time.Time) ([]dailyRate, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT date, target, rate, source, fetched_at FROM daily_rates
+		WHERE base = $1 AND date = (SELECT max(date) FROM daily_rates WHERE base = $1 AND date <= $2)
+		ORDER BY target`,
+		base, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []dailyRate
+	for rows.Next() {
+		rate := dailyRate{Base: base}
+		if err := rows.Scan(&rate.Date, &rate.Target, &rate.Rate, &rate.Source, &rate.FetchedAt); err != nil {
+			return nil, err
+		}
+		rate.Date = rate.Date.UTC()
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryDailyStore keeps daily rates in a slice.
+type memoryDailyStore struct {
+	mu    sync.Mutex
+	rates []dailyRate
+}
+
+func (s *memoryDailyStore) SaveDaily(_ context.Context, rates []dailyRate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rate := range rates {
+		if len(s.find(rate.Base, rate.Target, rate.Date)) == 0 {
+			s.rates = append(s.rates, rate)
+		}
+	}
+	return nil
+}
+
+func (s *memoryDailyStore) Daily(_ context.Context, base string, date time.Time) ([]dailyRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var last time.Time
+	for _, rate := range s.rates {
+		if rate.Base == base && !rate.Date.After(date) && rate.Date.After(last) {
+			last = rate.Date
+		}
+	}
+	return s.find(base, "", last), nil
+}
+
+func (s *memoryDailyStore) find(base, target string, date time.Time) []dailyRate {
+	var found []dailyRate
+	for _, rate := range s.rates {
+		if rate.Base == base && (target == "" || rate.Target == target) && rate.Date.Equal(date) {
+			found = append(found, rate)
+		}
+	}
+	return found
+}
+
+func TestLoadDailyConfig(t *testing.T) {
+	t.Setenv("DAILY_SNAPSHOT_PAIRS", "eur/usd, EUR/IDR")
+	config, err := loadDailyConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.pairs) != 2 || config.hour != 16 || config.minute != 0 || config.location.String() != "Europe/Berlin" {
+		t.Fatalf("expected two pairs at 16:00 in Europe/Berlin, got %+v", config)
+	}
+
+	for name, value := range map[string]string{"DAILY_SNAPSHOT_TIME": "4pm", "DAILY_SNAPSHOT_TIMEZONE": "Mars/Olympus", "DAILY_SNAPSHOT_PAIRS": "EUR/USS"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := loadDailyConfig(); err == nil {
+				t.Fatalf("expected an error for %s=%q", name, value)
+			}
+		})
+	}
+}
+
+func TestDailySnapshotterNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := newDailySnapshotter(dailyConfig{hour: 16, location: berlin}, nil, nil)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{name: "later today", now: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC), want: time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC)},
+		{name: "at the time", now: time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC), want: time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC)},
+		{name: "across the end of summer time", now: time.Date(2026, 10, 24, 15, 0, 0, 0, time.UTC), want: time.Date(2026, 10, 25, 15, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := s.next(tc.now); !got.Equal(tc.want) {
+				t.Fatalf("expected %s, got %s", tc.want, got.UTC())
+			}
+		})
+	}
+}
+
+func TestDailySnapshotTakesMissingPairs(t *testing.T) {
+	date := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	store := &memoryDailyStore{rates: []dailyRate{{Date: date, Base: "EUR", Target: "USD", Rate: 1.08, Source: "frankfurter"}}}
+	var mu sync.Mutex
+	calls := map[string]int{}
+	fetch := func(_ context.Context, base, target string) (rateQuote, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[target]++
+		switch {
+		case target == "IDR" && calls[target] == 1:
+			return rateQuote{}, errors.New("upstream down")
+		case target == "JPY":
+			return rateQuote{Rate: 160, Source: "cache", Stale: true}, nil
+		}
+		return rateQuote{Rate: 17650, Source: "frankfurter", FetchedAt: time.Now()}, nil
+	}
+	config := dailyConfig{pairs: []ratePair{{Base: "EUR", Target: "USD"}, {Base: "EUR", Target: "IDR"}, {Base: "EUR", Target: "JPY"}}, hour: 16, location: time.UTC}
+	s := newDailySnapshotter(config, store, fetch)
+	s.retryDelay = 0
+
+	s.snapshot(context.Background(), date.Add(16*time.Hour))
+
+	if calls["USD"] != 0 || calls["IDR"] != 2 || calls["JPY"] != dailyRetries+1 {
+		t.Fatalf("expected USD kept, IDR retried once, and JPY retried until giving up, got %v", calls)
+	}
+	rates, _ := store.Daily(context.Background(), "EUR", date)
+	if len(rates) != 2 || rates[0].Rate != 1.08 || rates[1].Target != "IDR" || rates[1].Rate != 17650 {
+		t.Fatalf("expected the kept USD rate and the retried IDR rate, got %+v", rates)
+	}
+}
+
+func TestDailyHandler(t *testing.T) {
+	store := &memoryDailyStore{rates: []dailyRate{
+		{Date: time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC), Base: "EUR", Target: "USD", Rate: 1.07, Source: "frankfurter"},
+		{Date: time.Date(2025, 10, 16, 0, 0, 0, 0, time.UTC), Base: "EUR", Target: "USD", Rate: 1.08, Source: "frankfurter"},
+		{Date: time.Date(2025, 10, 16, 0, 0, 0, 0, time.UTC), Base: "EUR", Target: "IDR", Rate: 17650, Source: "yahoo"},
+	}}
+	tests := []struct {
+		name       string
+		store      dailyRateStore
+		query      string
+		wantStatus int
+		wantDate   string
+		wantRates  int
+	}{
+		{name: "snapshot of the day", store: store, query: "?base=eur&date=2025-10-16", wantStatus: http.StatusOK, wantDate: "2025-10-16", wantRates: 2},
+		{name: "last snapshot before the day", store: store, query: "?base=EUR&date=2025-10-17", wantStatus: http.StatusOK, wantDate: "2025-10-16", wantRates: 2},
+		{name: "earlier snapshot", store: store, query: "?base=EUR&date=2025-10-15", wantStatus: http.StatusOK, wantDate: "2025-10-15", wantRates: 1},
+		{name: "no snapshot", store: store, query: "?base=EUR&date=2025-10-01", wantStatus: http.StatusNotFound},
+		{name: "base not snapshotted", store: store, query: "?base=USD&date=2025-10-16", wantStatus: http.StatusNotFound},
+		{name: "missing base", store: store, query: "?date=2025-10-16", wantStatus: http.StatusBadRequest},
+		{name: "future date", store: store, query: "?base=EUR&date=2999-01-01", wantStatus: http.StatusBadRequest},
+		{name: "disabled", query: "?base=EUR", wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/daily"+tc.query, nil)
+			res := httptest.NewRecorder()
+
+			dailyHandler(tc.store)(res, req)
+
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, res.Code, res.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var body dailyResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if body.Base != "EUR" || body.Date != tc.wantDate || len(body.Rates) != tc.wantRates {
+				t.Fatalf("expected %d EUR rates on %s, got %+v", tc.wantRates, tc.wantDate, body)
+			}
+			if res.Header().Get("Cache-Control") == "" {
+				t.Fatalf("expected a past day's snapshot to be cacheable")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// apiError is the body of an error response. Code is stable for clients to
+// branch on; Message is for people.
+type apiError struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Details *errorDetails `json:"details,omitempty"`
+}
+
+// errorDetails says which part of a request was invalid.
+type errorDetails struct {
+	// Field names the query parameter or body field, e.g. "items[1].base".
+	Field string `json:"field,omitempty"`
+	// Suggestions are currency codes close to an unknown one.
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// paramError is an invalid query parameter or body field.
+type paramError struct {
+	Field       string
+	Message     string
+	Suggestions []string
+}
+
+func (e *paramError) Error() string { return e.Field + ": " + e.Message }
+
+// invalidParam reports err about field. When err names a field of its own,
+// that field is taken to be within field, as a fee is within an item.
+func invalidParam(field string, err error) *paramError {
+	var param *paramError
+	if errors.As(err, &param) {
+		copied := *param
+		copied.Field = field + "." + param.Field
+		return &copied
+	}
+	return &paramError{Field: field, Message: err.Error()}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Code: code, Message: message})
+}
+
+// writeBadRequest answers 400 for err, naming the invalid field when err is a
+// paramError.
+func writeBadRequest(w http.ResponseWriter, err error) {
+	body := apiError{Code: "invalid_request", Message: err.Error()}
+	var param *paramError
+	if errors.As(err, &param) {
+		body.Code = "invalid_parameter"
+		body.Details = &errorDetails{Field: param.Field, Suggestions: param.Suggestions}
+	}
+	writeJSON(w, http.StatusBadRequest, body)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+}
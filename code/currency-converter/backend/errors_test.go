@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteBadRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    string
+		wantMessage string
+		wantField   string
+	}{
+		{"plain error", errors.New("invalid JSON body"), "invalid_request", "invalid JSON body", ""},
+		{"unknown currency", validateCurrency("base", "USS"), "invalid_parameter", `base: unknown currency "USS", did you mean USD, UZS?`, "base"},
+		{"nested field", invalidParam("items[2]", &paramError{Field: "fee", Message: "must be a positive amount"}), "invalid_parameter", "items[2].fee: must be a positive amount", "items[2].fee"},
+		{"wrapped error", invalidParam("date", errors.New("must not be in the future")), "invalid_parameter", "date: must not be in the future", "date"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			writeBadRequest(res, tc.err)
+
+			if res.Code != http.StatusBadRequest || res.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("expected a JSON 400, got %d %q", res.Code, res.Header().Get("Content-Type"))
+			}
+			var body apiError
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if body.Code != tc.wantCode || body.Message != tc.wantMessage {
+				t.Fatalf("expected %s %q, got %s %q", tc.wantCode, tc.wantMessage, body.Code, body.Message)
+			}
+			if tc.wantField == "" {
+				if body.Details != nil {
+					t.Fatalf("expected no details, got %+v", body.Details)
+				}
+				return
+			}
+			if body.Details == nil || body.Details.Field != tc.wantField {
+				t.Fatalf("expected details naming %s, got %+v", tc.wantField, body.Details)
+			}
+		})
+	}
+}
+
+func TestConvertHandlerErrorsAreJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/convert?base=USS&target=IDR", nil)
+	res := httptest.NewRecorder()
+
+	convertHandler(res, req)
+
+	var body apiError
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if res.Code != http.StatusBadRequest || body.Code != "invalid_parameter" || body.Details == nil {
+		t.Fatalf("expected a JSON error, got %d %+v", res.Code, body)
+	}
+	if len(body.Details.Suggestions) == 0 || body.Details.Suggestions[0] != "USD" {
+		t.Fatalf("expected USD suggested, got %+v", body.Details)
+	}
+
+	res = httptest.NewRecorder()
+	convertHandler(res, httptest.NewRequest(http.MethodPut, "/api/convert", nil))
+	if res.Code != http.StatusMethodNotAllowed || res.Header().Get("Allow") != "GET, POST" {
+		t.Fatalf("expected 405 allowing GET and POST, got %d %q", res.Code, res.Header().Get("Allow"))
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	res := httptest.NewRecorder()
+	openAPIHandler(res, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&spec); err != nil {
+		t.Fatalf("failed to decode the spec: %v", err)
+	}
+	if spec.OpenAPI == "" {
+		t.Fatal("expected an OpenAPI version")
+	}
+	for _, path := range []string{"/api/convert", "/api/table", "/api/currencies", "/api/stream", "/api/alerts", "/api/alerts/{id}", "/api/usage", "/api/admin/refresher", "/healthz", "/readyz"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Fatalf("expected %s in the spec", path)
+		}
+	}
+}
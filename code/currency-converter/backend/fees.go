@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// feeSchedule is what a conversion costs on top of the mid-market rate, as a
+// card or bank would charge it.
+type feeSchedule struct {
+	// spread is the percentage taken off the mid-market rate.
+	spread *big.Rat
+	// fixed is a flat fee per conversion, charged in the base currency, by
+	// currency code. A base currency without one is not charged.
+	fixed map[string]*big.Rat
+}
+
+// defaultFees applies to conversions that do not set their own.
+var defaultFees = feeSchedule{spread: new(big.Rat), fixed: map[string]*big.Rat{}}
+
+// loadFeeSchedule reads FEE_SPREAD_PERCENT and FEE_FIXED, a comma-separated
+// list of fees per base currency such as "USD:2,EUR:1.5".
+func loadFeeSchedule() (feeSchedule, error) {
+	fees := feeSchedule{spread: new(big.Rat), fixed: map[string]*big.Rat{}}
+	if value := os.Getenv("FEE_SPREAD_PERCENT"); value != "" {
+		spread, err := parseSpread(value)
+		if err != nil {
+			return feeSchedule{}, fmt.Errorf("FEE_SPREAD_PERCENT %w, got %q", err, value)
+		}
+		fees.spread = spread
+	}
+	for _, item := range strings.Split(os.Getenv("FEE_FIXED"), ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		code, amount, ok := strings.Cut(strings.TrimSpace(item), ":")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !ok {
+			return feeSchedule{}, fmt.Errorf("FEE_FIXED entries must look like USD:2, got %q", item)
+		}
+		if err := validateCurrency("FEE_FIXED", code); err != nil {
+			return feeSchedule{}, err
+		}
+		fee, err := parseFee(strings.TrimSpace(amount))
+		if err != nil {
+			return feeSchedule{}, fmt.Errorf("FEE_FIXED %s %w", code, err)
+		}
+		fees.fixed[code] = fee
+	}
+	return fees, nil
+}
+
+// parseSpread reads a percentage from 0 up to, but not including, 100.
+func parseSpread(value string) (*big.Rat, error) {
+	spread, err := parseDecimal(value)
+	if err != nil || spread.Sign() < 0 || spread.Cmp(big.NewRat(100, 1)) >= 0 {
+		return nil, errors.New("must be a percentage from 0 to below 100")
+	}
+	return spread, nil
+}
+
+func parseFee(value string) (*big.Rat, error) {
+	fee, err := parseDecimal(value)
+	if err != nil || fee.Sign() < 0 {
+		return nil, errors.New("must be a positive amount")
+	}
+	return fee, nil
+}
+
+// withOverrides returns the schedule with the spread and fixed fee a request
+// asked for, if it did. A fixed fee asked for applies to base.
+func (f feeSchedule) withOverrides(spread, fee, base string) (feeSchedule, error) {
+	if spread != "" {
+		rate, err := parseSpread(spread)
+		if err != nil {
+			return feeSchedule{}, &paramError{Field: "spread", Message: err.Error()}
+		}
+		f.spread = rate
+	}
+	if fee != "" {
+		amount, err := parseFee(fee)
+		if err != nil {
+			return feeSchedule{}, &paramError{Field: "fee", Message: err.Error()}
+		}
+		f.fixed = map[string]*big.Rat{base: amount}
+	}
+	return f, nil
+}
+
+// feeBreakdown shows what the fees of a conversion came to.
+type feeBreakdown struct {
+	SpreadPercent json.Number `json:"spread_percent"`
+	// Fixed is charged in the base currency, before converting.
+	Fixed json.Number `json:"fixed"`
+	// Cost is what the fees took, in the target currency.
+	Cost json.Number `json:"cost"`
+}
+
+// feeQuote is a conversion after fees.
+type feeQuote struct {
+	// converted is the exact amount received.
+	converted *big.Rat
+	// effectiveRate is what the amount was converted at, all fees included.
+	effectiveRate float64
+	// breakdown is nil when no fee applied.
+	breakdown *feeBreakdown
+}
+
+func (f feeSchedule) fixedFee(base string) *big.Rat {
+	if fixed, ok := f.fixed[base]; ok {
+		return fixed
+	}
+	return new(big.Rat)
+}
+
+// check rejects an amount smaller than the fixed fee on it.
+func (f feeSchedule) check(amount *big.Rat, base string) error {
+	if fixed := f.fixedFee(base); amount.Cmp(fixed) < 0 {
+		return fmt.Errorf("must be at least the fixed fee of %s %s", formatDecimal(fixed), base)
+	}
+	return nil
+}
+
+// convert takes the fixed fee off amount, which must have passed check, and
+// converts the rest at the mid-market rate less the spread. The fees' cost
+// is rounded like the converted amount, so the two add up to the mid-market
+// conversion.
+func (f feeSchedule) convert(amount, rate *big.Rat, base, target string, mode roundingMode) feeQuote {
+	fixed := f.fixedFee(base)
+	if fixed.Sign() == 0 && f.spread.Sign() == 0 {
+		return feeQuote{converted: new(big.Rat).Mul(amount, rate), effectiveRate: ratToFloat(rate)}
+	}
+	net := new(big.Rat).Sub(amount, fixed)
+
+	keep := new(big.Rat).Sub(big.NewRat(1, 1), new(big.Rat).Quo(f.spread, big.NewRat(100, 1)))
+	converted := new(big.Rat).Mul(net, new(big.Rat).Mul(rate, keep))
+	effective := new(big.Rat).Mul(rate, keep)
+	if amount.Sign() != 0 {
+		effective = new(big.Rat).Quo(converted, amount)
+	}
+
+	decimals := currencyByCode[target].Decimals
+	mid := roundRat(new(big.Rat).Mul(amount, rate), decimals, mode)
+	cost := new(big.Rat).Sub(mid, roundRat(converted, decimals, mode))
+	return feeQuote{
+		converted:     converted,
+		effectiveRate: ratToFloat(effective),
+		breakdown: &feeBreakdown{
+			SpreadPercent: json.Number(formatDecimal(f.spread)),
+			Fixed:         json.Number(formatDecimal(fixed)),
+			Cost:          json.Number(cost.FloatString(decimals)),
+		},
+	}
+}
+
+func ratToFloat(x *big.Rat) float64 {
+	f, _ := x.Float64()
+	return f
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestLoadFeeSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		spread     string
+		fixed      string
+		wantSpread string
+		wantFixed  map[string]string
+		wantErr    bool
+	}{
+		{name: "none", wantSpread: "0", wantFixed: map[string]string{}},
+		{name: "spread and fees", spread: "2.5", fixed: "usd:2, EUR:1.50", wantSpread: "2.5", wantFixed: map[string]string{"USD": "2", "EUR": "1.5"}},
+		{name: "spread of 100", spread: "100", wantErr: true},
+		{name: "negative spread", spread: "-1", wantErr: true},
+		{name: "missing amount", fixed: "USD", wantErr: true},
+		{name: "unknown currency", fixed: "USS:2", wantErr: true},
+		{name: "negative fee", fixed: "USD:-2", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("FEE_SPREAD_PERCENT", tc.spread)
+			t.Setenv("FEE_FIXED", tc.fixed)
+			fees, err := loadFeeSchedule()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := formatDecimal(fees.spread); got != tc.wantSpread {
+				t.Fatalf("expected spread %s, got %s", tc.wantSpread, got)
+			}
+			if len(fees.fixed) != len(tc.wantFixed) {
+				t.Fatalf("expected fees %v, got %v", tc.wantFixed, fees.fixed)
+			}
+			for code, want := range tc.wantFixed {
+				if got := fees.fixed[code]; got == nil || formatDecimal(got) != want {
+					t.Fatalf("expected a %s fee of %s, got %v", code, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFeeScheduleConvert(t *testing.T) {
+	tests := []struct {
+		name          string
+		spread        string
+		fee           string
+		amount        string
+		wantConverted string
+		wantEffective float64
+		wantCost      string
+	}{
+		{name: "no fees", amount: "100", wantConverted: "1600000", wantEffective: 16000},
+		{name: "spread", spread: "2.5", amount: "100", wantConverted: "1560000", wantEffective: 15600, wantCost: "40000.00"},
+		{name: "spread and fee", spread: "2.5", fee: "2", amount: "100", wantConverted: "1528800", wantEffective: 15288, wantCost: "71200.00"},
+		{name: "fee takes it all", fee: "2", amount: "2", wantConverted: "0", wantEffective: 0, wantCost: "32000.00"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fees, err := defaultFees.withOverrides(tc.spread, tc.fee, "USD")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			amount, _ := new(big.Rat).SetString(tc.amount)
+			result := fees.convert(amount, big.NewRat(16000, 1), "USD", "IDR", roundHalfEven)
+			if got := formatDecimal(result.converted); got != tc.wantConverted {
+				t.Fatalf("expected %s, got %s", tc.wantConverted, got)
+			}
+			if result.effectiveRate != tc.wantEffective {
+				t.Fatalf("expected an effective rate of %f, got %f", tc.wantEffective, result.effectiveRate)
+			}
+			if tc.wantCost == "" {
+				if result.breakdown != nil {
+					t.Fatalf("expected no fees, got %+v", result.breakdown)
+				}
+				return
+			}
+			if result.breakdown == nil || result.breakdown.Cost.String() != tc.wantCost {
+				t.Fatalf("expected fees costing %s, got %+v", tc.wantCost, result.breakdown)
+			}
+		})
+	}
+}
+
+func TestFeeScheduleCheck(t *testing.T) {
+	fees, _ := defaultFees.withOverrides("", "2", "USD")
+	if err := fees.check(big.NewRat(3, 2), "USD"); err == nil {
+		t.Fatal("expected an amount below the fixed fee to be rejected")
+	}
+	if err := fees.check(big.NewRat(3, 2), "EUR"); err != nil {
+		t.Fatalf("expected no fee on EUR, got %v", err)
+	}
+}
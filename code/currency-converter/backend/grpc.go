@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"currencyconverter/converterpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcConverter serves the CurrencyConverter service defined in
+// proto/currencyconverter/v1/converter.proto. It converts like the HTTP API,
+// through the same rate fetchers and fees.
+type grpcConverter struct {
+	converterpb.UnimplementedCurrencyConverterServer
+}
+
+func (grpcConverter) Convert(ctx context.Context, req *converterpb.ConvertRequest) (*converterpb.ConvertResponse, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"base": req.GetBase(), "target": req.GetTarget(), "amount": req.GetAmount(), "rounding": req.GetRounding(),
+		"date": req.GetDate(), "spread": req.GetSpread(), "fee": req.GetFee(),
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	c, err := parseConversion(query, time.Now())
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	quote, err := quoteOn(ctx, c.base, c.target, c.date)
+	if err != nil {
+		log.Printf("failed to fetch rate over gRPC: %v", err)
+		return nil, upstreamStatus(ctx, err)
+	}
+
+	resp := c.response(quote)
+	out := &converterpb.ConvertResponse{
+		Base:          resp.Base,
+		Target:        resp.Target,
+		Amount:        formatDecimal(c.amount),
+		Rate:          resp.Rate,
+		EffectiveRate: resp.EffectiveRate,
+		Converted:     resp.Converted.String(),
+		ConvertedRaw:  resp.ConvertedRaw.String(),
+		Rounding:      string(resp.Rounding),
+		Source:        resp.Source,
+		Date:          resp.Date,
+		FetchedAt:     timestamppb.New(resp.FetchedAt),
+		Stale:         resp.Stale,
+	}
+	if resp.Fees != nil {
+		out.Fees = &converterpb.FeeBreakdown{
+			SpreadPercent: resp.Fees.SpreadPercent.String(),
+			Fixed:         resp.Fees.Fixed.String(),
+			Cost:          resp.Fees.Cost.String(),
+		}
+	}
+	return out, nil
+}
+
+func (grpcConverter) ListCurrencies(context.Context, *converterpb.ListCurrenciesRequest) (*converterpb.ListCurrenciesResponse, error) {
+	out := &converterpb.ListCurrenciesResponse{Currencies: make([]*converterpb.Currency, len(currencies))}
+	for i, currency := range currencies {
+		out.Currencies[i] = &converterpb.Currency{
+			Code:     currency.Code,
+			Name:     currency.Name,
+			Symbol:   currency.Symbol,
+			Decimals: int32(currency.Decimals),
+			Class:    currency.Class,
+		}
+	}
+	return out, nil
+}
+
+// invalidArgument reports a request error, naming the field in a BadRequest
+// detail as the HTTP API does in details.field.
+func invalidArgument(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	var param *paramError
+	if errors.As(err, &param) {
+		detailed, detailErr := st.WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: param.Field, Description: param.Message}},
+		})
+		if detailErr == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// upstreamStatus maps a failed fetch like upstreamError does: DeadlineExceeded
+// for 504 and Unavailable for 502.
+func upstreamStatus(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	code, failure := upstreamError(err)
+	if code == http.StatusGatewayTimeout {
+		return status.Error(codes.DeadlineExceeded, failure.Message)
+	}
+	return status.Error(codes.Unavailable, failure.Message)
+}
+
+// apiKeyInterceptor counts each call against the key in its x-api-key
+// metadata, as requireAPIKey does for HTTP. A nil registry leaves gRPC open.
+func apiKeyInterceptor(keys *apiKeyRegistry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if keys == nil {
+			return handler(ctx, req)
+		}
+		var presented string
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("x-api-key")) > 0 {
+			presented = md.Get("x-api-key")[0]
+		}
+		key, ok := keys.lookup(presented)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "a valid API key is required in the x-api-key metadata")
+		}
+		if usage, ok := keys.use(key); !ok {
+			if usage.quotaExceeded() {
+				return nil, status.Errorf(codes.ResourceExhausted, "daily quota of %d requests used up", usage.DailyQuota)
+			}
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit of %d requests per minute reached", usage.RateLimit)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func newGRPCServer(keys *apiKeyRegistry) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(apiKeyInterceptor(keys)))
+	converterpb.RegisterCurrencyConverterServer(server, grpcConverter{})
+	return server
+}
+
+// serveGRPC runs server on listener until ctx is done, then lets calls in
+// flight finish for up to shutdownTimeout.
+func serveGRPC(ctx context.Context, server *grpc.Server, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("gRPC server: %w", err)
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		server.Stop()
+	}
+	return nil
+}
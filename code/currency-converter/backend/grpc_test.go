@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"currencyconverter/converterpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestGRPCClient(t *testing.T, keys *apiKeyRegistry) converterpb.CurrencyConverterClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(keys)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return converterpb.NewCurrencyConverterClient(conn)
+}
+
+func TestGRPCConvert(t *testing.T) {
+	originalFetcher := rateFetcher
+	fetchedAt := time.Now().Add(-time.Minute).UTC()
+	rateFetcher = func(_ context.Context, base, target string) (rateQuote, error) {
+		if base == "USD" && target == "IDR" {
+			return rateQuote{Rate: 16250, Source: "frankfurter", FetchedAt: fetchedAt}, nil
+		}
+		return rateQuote{}, errors.New("boom")
+	}
+	defer func() { rateFetcher = originalFetcher }()
+	client := newTestGRPCClient(t, nil)
+
+	resp, err := client.Convert(context.Background(), &converterpb.ConvertRequest{Base: "usd", Target: "IDR", Amount: "2.5", Spread: "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Converted != "40218.75" || resp.Rate != 16250 || resp.Source != "frankfurter" || !resp.FetchedAt.AsTime().Equal(fetchedAt) {
+		t.Fatalf("expected the HTTP API's conversion, got %+v", resp)
+	}
+	if resp.Amount != "2.5" || resp.Fees.GetCost() != "406.25" {
+		t.Fatalf("expected the amount and fees, got %+v", resp)
+	}
+
+	_, err = client.Convert(context.Background(), &converterpb.ConvertRequest{Base: "USS", Target: "IDR"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+		t.Fatalf("expected InvalidArgument with details, got %v", err)
+	}
+	if bad, ok := st.Details()[0].(*errdetails.BadRequest); !ok || bad.FieldViolations[0].Field != "base" {
+		t.Fatalf("expected a BadRequest naming base, got %+v", st.Details()[0])
+	}
+
+	_, err = client.Convert(context.Background(), &converterpb.ConvertRequest{Base: "USD", Target: "EUR"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable when the providers fail, got %v", err)
+	}
+}
+
+func TestGRPCListCurrencies(t *testing.T) {
+	client := newTestGRPCClient(t, nil)
+
+	resp, err := client.ListCurrencies(context.Background(), &converterpb.ListCurrenciesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Currencies) != len(currencies) || resp.Currencies[0].Code != currencies[0].Code {
+		t.Fatalf("expected the %d supported currencies, got %d", len(currencies), len(resp.Currencies))
+	}
+}
+
+func TestGRPCRequiresAPIKey(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	client := newTestGRPCClient(t, newTestKeys(t, "blog:s3cret:0:1", &now))
+
+	if _, err := client.ListCurrencies(context.Background(), &converterpb.ListCurrenciesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a key, got %v", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "s3cret")
+	if _, err := client.ListCurrencies(ctx, &converterpb.ListCurrenciesRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.ListCurrencies(ctx, &converterpb.ListCurrenciesRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted past the rate limit, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxCachedPastRates bounds the past rates kept in memory. Past rates do not
+// change, so they are kept until the cache is full and then dropped together.
+const maxCachedPastRates = 10000
+
+// pastRateLookback is how far before a day without a rate the sources look
+// for the last one, enough to cover weekends and holidays.
+const pastRateLookback = 7 * 24 * time.Hour
+
+// pastRateProvider returns the rate on a past UTC day: its last rate of the
+// day, or of the last day before it with one.
+type pastRateProvider interface {
+	Name() string
+	FetchRateOn(ctx context.Context, base, target string, date time.Time) (rateQuote, error)
+}
+
+// pastRates asks each source in turn for a rate on a past day.
+type pastRates struct {
+	sources []pastRateProvider
+
+	mu     sync.Mutex
+	cached map[string]rateQuote
+}
+
+func newPastRates(sources ...pastRateProvider) *pastRates {
+	return &pastRates{sources: sources, cached: map[string]rateQuote{}}
+}
+
+// RateOn returns the pair's rate on date.
+func (p *pastRates) RateOn(ctx context.Context, base, target string, date time.Time) (rateQuote, error) {
+	key := base + "/" + target + "@" + date.Format(time.DateOnly)
+	p.mu.Lock()
+	quote, ok := p.cached[key]
+	p.mu.Unlock()
+	if ok {
+		return quote, nil
+	}
+
+	var errs []error
+	for _, source := range p.sources {
+		if provider, ok := source.(RateProvider); ok && !covers(provider, base, target) {
+			continue
+		}
+		quote, err := source.FetchRateOn(ctx, base, target, date)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		p.mu.Lock()
+		if len(p.cached) >= maxCachedPastRates {
+			p.cached = map[string]rateQuote{}
+		}
+		p.cached[key] = quote
+		p.mu.Unlock()
+		return quote, nil
+	}
+	if len(errs) == 0 {
+		return rateQuote{}, fmt.Errorf("no source of past rates covers %s/%s", base, target)
+	}
+	return rateQuote{}, errors.Join(errs...)
+}
+
+// pastRateFetcher returns the rate on a past day; nil turns dated conversions
+// off.
+var pastRateFetcher func(ctx context.Context, base, target string, date time.Time) (rateQuote, error)
+
+// parseRateDate reads a YYYY-MM-DD date, which must not be in the future.
+func parseRateDate(value string, now time.Time) (time.Time, error) {
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("must be a date such as 2026-01-31")
+	}
+	if date.After(now.UTC()) {
+		return time.Time{}, errors.New("must not be in the future")
+	}
+	return date, nil
+}
+
+// quoteOn returns the live rate when date is zero or today, and the rate on
+// date otherwise.
+func quoteOn(ctx context.Context, base, target string, date time.Time) (rateQuote, error) {
+	if date.IsZero() || date.Format(time.DateOnly) == time.Now().UTC().Format(time.DateOnly) {
+		return rateFetcher(ctx, base, target)
+	}
+	if pastRateFetcher == nil {
+		return rateQuote{}, errors.New("no source of past rates")
+	}
+	return pastRateFetcher(ctx, base, target, date)
+}
+
+// FetchRateOn reads the last stored rate fetched on date, or in the week
+// before it.
+func (s postgresStore) FetchRateOn(ctx context.Context, base, target string, date time.Time) (rateQuote, error) {
+	quote := rateQuote{Source: s.Name()}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT rate, fetched_at FROM rates
+		WHERE base = $1 AND target = $2 AND fetched_at >= $3 AND fetched_at < $4
+		ORDER BY fetched_at DESC LIMIT 1`,
+		base, target, date.Add(-pastRateLookback), date.Add(24*time.Hour)).Scan(&quote.Rate, &quote.FetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rateQuote{}, fmt.Errorf("no rate stored on or in the week before %s", date.Format(time.DateOnly))
+	}
+	if err != nil {
+		return rateQuote{}, err
+	}
+	return quote, nil
+}
+
+// FetchRateOn reads the reference rate of date, or of the last working day
+// before it.
+func (p frankfurterProvider) FetchRateOn(ctx context.Context, base, target string, date time.Time) (rateQuote, error) {
+	endpoint := fmt.Sprintf("%s/%s?from=%s&to=%s", p.baseURL, date.Format(time.DateOnly), url.QueryEscape(base), url.QueryEscape(target))
+
+	var payload struct {
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(ctx, endpoint, &payload); err != nil {
+		return rateQuote{}, err
+	}
+	published, err := time.Parse(time.DateOnly, payload.Date)
+	if err != nil || payload.Rates[target] == 0 {
+		return rateQuote{}, fmt.Errorf("no %s rate in response", target)
+	}
+	return rateQuote{Rate: payload.Rates[target], Source: p.Name(), FetchedAt: published.Add(15 * time.Hour)}, nil
+}
+
+// FetchRateOn reads the closing rate of date, or of the last trading day in
+// the week before it.
+func (p yahooProvider) FetchRateOn(ctx context.Context, base, target string, date time.Time) (rateQuote, error) {
+	end := date.Add(24 * time.Hour)
+	points, err := p.dailyCloses(ctx, base, target, date.Add(-pastRateLookback), end)
+	if err != nil {
+		return rateQuote{}, err
+	}
+	var last *historyPoint
+	for i := range points {
+		if points[i].At.Before(end) {
+			last = &points[i]
+		}
+	}
+	if last == nil {
+		return rateQuote{}, fmt.Errorf("no rate on %s", date.Format(time.DateOnly))
+	}
+	return rateQuote{Rate: last.Rate, Source: p.Name(), FetchedAt: last.At}, nil
+}
+
+// pastRateSources lists the chain's providers that can read past rates.
+func (c *providerChain) pastRateSources() []pastRateProvider {
+	var sources []pastRateProvider
+	for _, provider := range c.providers {
+		if source, ok := provider.(pastRateProvider); ok {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type stubPastRates struct {
+	name  string
+	quote rateQuote
+	err   error
+	calls int
+}
+
+func (s *stubPastRates) Name() string { return s.name }
+
+func (s *stubPastRates) FetchRateOn(context.Context, string, string, time.Time) (rateQuote, error) {
+	s.calls++
+	return s.quote, s.err
+}
+
+func TestPastRatesFallsBackAndCaches(t *testing.T) {
+	stored := &stubPastRates{name: "stored", err: errors.New("no rate stored on 2025-10-23")}
+	provider := &stubPastRates{name: "frankfurter", quote: rateQuote{Rate: 16580.5, Source: "frankfurter"}}
+	rates := newPastRates(stored, provider)
+	date := time.Date(2025, 10, 23, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		quote, err := rates.RateOn(context.Background(), "USD", "IDR", date)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if quote.Rate != 16580.5 || quote.Source != "frankfurter" {
+			t.Fatalf("expected 16580.5 from frankfurter, got %+v", quote)
+		}
+	}
+	if stored.calls != 1 || provider.calls != 1 {
+		t.Fatalf("expected one lookup per source, got %d and %d", stored.calls, provider.calls)
+	}
+}
+
+func TestParseRateDate(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "2026-10-18"},
+		{value: "2020-02-29"},
+		{value: "2026-10-19", wantErr: true},
+		{value: "18/10/2026", wantErr: true},
+		{value: "2026-02-30", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			_, err := parseRateDate(tc.value, now)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProvidersParsePastRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		provider func(baseURL string) pastRateProvider
+		wantRate float64
+		wantAt   time.Time
+	}{
+		{
+			name:     "yahoo falls back to the last trading day",
+			body:     `{"chart":{"result":[{"timestamp":[1761091200,1761177600,1761264000],"indicators":{"quote":[{"close":[16580.5,null,16610]}]}}],"error":null}}`,
+			provider: func(baseURL string) pastRateProvider { return yahooProvider{baseURL: baseURL} },
+			wantRate: 16580.5,
+			wantAt:   time.Date(2025, 10, 22, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "frankfurter",
+			body:     `{"amount":1.0,"base":"USD","date":"2025-10-23","rates":{"IDR":16570}}`,
+			provider: func(baseURL string) pastRateProvider { return frankfurterProvider{baseURL: baseURL} },
+			wantRate: 16570,
+			wantAt:   time.Date(2025, 10, 23, 15, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			quote, err := tc.provider(server.URL).FetchRateOn(context.Background(), "USD", "IDR", time.Date(2025, 10, 23, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if quote.Rate != tc.wantRate || !quote.FetchedAt.Equal(tc.wantAt) {
+				t.Fatalf("expected %f at %s, got %f at %s", tc.wantRate, tc.wantAt, quote.Rate, quote.FetchedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxConvertItems caps the line items of one request.
+	maxConvertItems = 200
+	// maxConvertBody caps the size of a request body, in bytes.
+	maxConvertBody = 1 << 20
+)
+
+type convertItemRequest struct {
+	Amount json.Number `json:"amount"`
+	Base   string      `json:"base"`
+	Target string      `json:"target"`
+	// Date, YYYY-MM-DD, converts at the rate of that day.
+	Date string `json:"date"`
+	// Fee is a fixed fee in the base currency, in place of the default.
+	Fee json.Number `json:"fee"`
+}
+
+type convertItemsRequest struct {
+	Items    []convertItemRequest `json:"items"`
+	Rounding string               `json:"rounding"`
+	// Spread is a percentage in place of the default spread.
+	Spread json.Number `json:"spread"`
+}
+
+type convertItem struct {
+	Base          string        `json:"base"`
+	Target        string        `json:"target"`
+	Amount        json.Number   `json:"amount"`
+	Date          string        `json:"date,omitempty"`
+	Rate          float64       `json:"rate,omitempty"`
+	EffectiveRate float64       `json:"effective_rate,omitempty"`
+	Fees          *feeBreakdown `json:"fees,omitempty"`
+	Converted     json.Number   `json:"converted,omitempty"`
+	ConvertedRaw  json.Number   `json:"converted_raw,omitempty"`
+	Source        string        `json:"source,omitempty"`
+	FetchedAt     *time.Time    `json:"fetched_at,omitempty"`
+	Stale         bool          `json:"stale,omitempty"`
+	// Error is set instead of the conversion when its rate could not be
+	// fetched.
+	Error string `json:"error,omitempty"`
+}
+
+// convertTotal adds up the converted items in one currency.
+type convertTotal struct {
+	Currency string      `json:"currency"`
+	Total    json.Number `json:"total"`
+	Items    int         `json:"items"`
+}
+
+type convertItemsResponse struct {
+	Items    []convertItem  `json:"items"`
+	Totals   []convertTotal `json:"totals"`
+	Rounding roundingMode   `json:"rounding"`
+	// Code says why the request failed, when no item could be converted.
+	Code string `json:"code,omitempty"`
+}
+
+// rateKey is a rate the items need; items on the same pair and day share it.
+type rateKey struct {
+	base, target string
+	date         time.Time
+}
+
+// convertItemsHandler serves POST /api/convert: it converts each line item
+// and totals the results per target currency. Totals add up the rounded
+// amounts, so they match the items. An item whose rate cannot be fetched
+// gets an error of its own and is left out of the totals; the request fails
+// only when no item can be converted.
+func convertItemsHandler(w http.ResponseWriter, r *http.Request) {
+	var req convertItemsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConvertBody)).Decode(&req); err != nil {
+		writeBadRequest(w, errors.New("invalid JSON body"))
+		return
+	}
+	if len(req.Items) == 0 {
+		writeBadRequest(w, &paramError{Field: "items", Message: "at least one item is required"})
+		return
+	}
+	if len(req.Items) > maxConvertItems {
+		writeBadRequest(w, &paramError{Field: "items", Message: fmt.Sprintf("at most %d items", maxConvertItems)})
+		return
+	}
+	rounding, err := parseRoundingMode(req.Rounding)
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+	fees, err := defaultFees.withOverrides(req.Spread.String(), "", "")
+	if err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+
+	items := make([]convertItem, len(req.Items))
+	amounts := make([]*big.Rat, len(req.Items))
+	keys := make([]rateKey, len(req.Items))
+	schedules := make([]feeSchedule, len(req.Items))
+	now := time.Now()
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		key := rateKey{
+			base:   strings.ToUpper(strings.TrimSpace(item.Base)),
+			target: strings.ToUpper(strings.TrimSpace(item.Target)),
+		}
+		for _, param := range []struct{ name, code string }{{field + ".base", key.base}, {field + ".target", key.target}} {
+			if err := validateCurrency(param.name, param.code); err != nil {
+				writeBadRequest(w, err)
+				return
+			}
+		}
+		amount, err := parseDecimal(item.Amount.String())
+		if err != nil {
+			writeBadRequest(w, &paramError{Field: field + ".amount", Message: "must be a number"})
+			return
+		}
+		if schedules[i], err = fees.withOverrides("", item.Fee.String(), key.base); err != nil {
+			writeBadRequest(w, invalidParam(field, err))
+			return
+		}
+		if err := schedules[i].check(amount, key.base); err != nil {
+			writeBadRequest(w, invalidParam(field+".amount", err))
+			return
+		}
+		if item.Date != "" {
+			if key.date, err = parseRateDate(item.Date, now); err != nil {
+				writeBadRequest(w, invalidParam(field+".date", err))
+				return
+			}
+		}
+		keys[i] = key
+		amounts[i] = amount
+		items[i] = convertItem{Base: key.base, Target: key.target, Amount: json.Number(formatDecimal(amount)), Date: item.Date}
+	}
+
+	quotes := fetchRates(r, keys)
+	response := convertItemsResponse{Items: items, Totals: []convertTotal{}, Rounding: rounding}
+	// Totals are kept in the order their currencies first appear.
+	totalAt := map[string]int{}
+	var (
+		sums []*big.Rat
+		errs []error
+	)
+	for i, key := range keys {
+		result := quotes[key]
+		if result.err != nil {
+			_, failure := upstreamError(result.err)
+			items[i].Error = failure.Message
+			errs = append(errs, result.err)
+			continue
+		}
+		converted := schedules[i].convert(amounts[i], ratFromFloat(result.quote.Rate), key.base, key.target, rounding)
+		decimals := currencyByCode[key.target].Decimals
+		rounded := roundRat(converted.converted, decimals, rounding)
+		fetchedAt := result.quote.FetchedAt.UTC()
+		items[i].Rate = result.quote.Rate
+		if converted.breakdown != nil {
+			items[i].EffectiveRate = converted.effectiveRate
+			items[i].Fees = converted.breakdown
+		}
+		items[i].Converted = json.Number(rounded.FloatString(decimals))
+		items[i].ConvertedRaw = json.Number(formatDecimal(converted.converted))
+		items[i].Source = result.quote.Source
+		items[i].FetchedAt = &fetchedAt
+		items[i].Stale = result.quote.Stale
+
+		j, ok := totalAt[key.target]
+		if !ok {
+			j = len(response.Totals)
+			totalAt[key.target] = j
+			sums = append(sums, new(big.Rat))
+			response.Totals = append(response.Totals, convertTotal{Currency: key.target})
+		}
+		sums[j].Add(sums[j], rounded)
+		response.Totals[j].Items++
+	}
+	for j, total := range response.Totals {
+		response.Totals[j].Total = json.Number(sums[j].FloatString(currencyByCode[total.Currency].Decimals))
+	}
+
+	if len(errs) == len(items) {
+		status, failure := upstreamError(errors.Join(errs...))
+		response.Code = failure.Code
+		writeJSON(w, status, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+type rateResult struct {
+	quote rateQuote
+	err   error
+}
+
+// fetchRates fetches each distinct rate the items need, a few at a time.
+func fetchRates(r *http.Request, keys []rateKey) map[rateKey]rateResult {
+	var distinct []rateKey
+	seen := map[rateKey]bool{}
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, key)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, tableConcurrency)
+		results = make(map[rateKey]rateResult, len(distinct))
+	)
+	for _, key := range distinct {
+		wg.Add(1)
+		go func(key rateKey) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			quote, err := quoteOn(r.Context(), key.base, key.target, key.date)
+			if err != nil {
+				log.Printf("failed to fetch %s/%s rate for line items: %v", key.base, key.target, err)
+			}
+			mu.Lock()
+			results[key] = rateResult{quote: quote, err: err}
+			mu.Unlock()
+		}(key)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func postItems(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/convert", strings.NewReader(body))
+	res := httptest.NewRecorder()
+	convertHandler(res, req)
+	return res
+}
+
+func TestConvertItems(t *testing.T) {
+	var calls atomic.Int32
+	originalFetcher, originalPast := rateFetcher, pastRateFetcher
+	rateFetcher = func(_ context.Context, base, target string) (rateQuote, error) {
+		calls.Add(1)
+		switch base + target {
+		case "EURUSD":
+			return rateQuote{Rate: 1.085, Source: "frankfurter", FetchedAt: time.Now()}, nil
+		case "JPYUSD":
+			return rateQuote{Rate: 0.0067, Source: "frankfurter", FetchedAt: time.Now()}, nil
+		}
+		return rateQuote{}, errors.New("boom")
+	}
+	pastRateFetcher = func(_ context.Context, base, target string, date time.Time) (rateQuote, error) {
+		if date.Format(time.DateOnly) != "2025-10-23" {
+			t.Errorf("expected the rate of 2025-10-23, got %s", date)
+		}
+		return rateQuote{Rate: 16570, Source: "frankfurter", FetchedAt: date.Add(15 * time.Hour)}, nil
+	}
+	defer func() { rateFetcher, pastRateFetcher = originalFetcher, originalPast }()
+
+	res := postItems(`{"items":[
+		{"amount":"12.50","base":"eur","target":"USD"},
+		{"amount":1500,"base":"JPY","target":"USD"},
+		{"amount":"7.25","base":"EUR","target":"USD"},
+		{"amount":"10","base":"USD","target":"IDR","date":"2025-10-23"},
+		{"amount":"3","base":"USD","target":"KWD"}
+	]}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected one fetch per distinct pair, got %d", calls.Load())
+	}
+
+	var payload convertItemsResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for i, want := range []string{"13.56", "10.05", "7.87", "165700.00", ""} {
+		if got := payload.Items[i].Converted.String(); got != want {
+			t.Fatalf("expected item %d converted to %q, got %q", i, want, got)
+		}
+	}
+	if payload.Items[0].Base != "EUR" || payload.Items[1].Amount != "1500" {
+		t.Fatalf("expected normalized items, got %+v", payload.Items[:2])
+	}
+	if payload.Items[3].Date != "2025-10-23" || payload.Items[4].Error == "" {
+		t.Fatalf("expected a dated item and a failed one, got %+v", payload.Items[3:])
+	}
+
+	want := []convertTotal{{Currency: "USD", Total: "31.48", Items: 3}, {Currency: "IDR", Total: "165700.00", Items: 1}}
+	if len(payload.Totals) != len(want) {
+		t.Fatalf("expected totals %+v, got %+v", want, payload.Totals)
+	}
+	for i := range want {
+		if payload.Totals[i] != want[i] {
+			t.Fatalf("expected totals %+v, got %+v", want, payload.Totals)
+		}
+	}
+}
+
+func TestConvertItemsErrors(t *testing.T) {
+	originalFetcher := rateFetcher
+	rateFetcher = func(context.Context, string, string) (rateQuote, error) {
+		return rateQuote{}, errors.New("boom")
+	}
+	defer func() { rateFetcher = originalFetcher }()
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantMessage string
+	}{
+		{name: "invalid JSON", body: `{"items":`, wantStatus: http.StatusBadRequest, wantMessage: "invalid JSON body"},
+		{name: "no items", body: `{"items":[]}`, wantStatus: http.StatusBadRequest, wantMessage: "items: at least one item is required"},
+		{name: "unknown currency", body: `{"items":[{"amount":1,"base":"USD","target":"IDR"},{"amount":1,"base":"USS","target":"IDR"}]}`, wantStatus: http.StatusBadRequest, wantMessage: `items[1].base: unknown currency "USS"`},
+		{name: "bad amount", body: `{"items":[{"amount":"lots","base":"USD","target":"IDR"}]}`, wantStatus: http.StatusBadRequest, wantMessage: "invalid JSON body"},
+		{name: "missing amount", body: `{"items":[{"base":"USD","target":"IDR"}]}`, wantStatus: http.StatusBadRequest, wantMessage: "items[0].amount: must be a number"},
+		{name: "future date", body: `{"items":[{"amount":1,"base":"USD","target":"IDR","date":"2999-01-01"}]}`, wantStatus: http.StatusBadRequest, wantMessage: "items[0].date: must not be in the future"},
+		{name: "negative fee", body: `{"items":[{"amount":1,"base":"USD","target":"IDR","fee":-1}]}`, wantStatus: http.StatusBadRequest, wantMessage: "items[0].fee: must be a positive amount"},
+		{name: "amount below fee", body: `{"items":[{"amount":1,"base":"USD","target":"IDR","fee":2}]}`, wantStatus: http.StatusBadRequest, wantMessage: "items[0].amount: must be at least the fixed fee of 2 USD"},
+		{name: "bad spread", body: `{"items":[{"amount":1,"base":"USD","target":"IDR"}],"spread":150}`, wantStatus: http.StatusBadRequest, wantMessage: "spread: must be a percentage"},
+		{name: "bad rounding", body: `{"items":[{"amount":1,"base":"USD","target":"IDR"}],"rounding":"sideways"}`, wantStatus: http.StatusBadRequest},
+		{name: "every rate fails", body: `{"items":[{"amount":1,"base":"USD","target":"IDR"}]}`, wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := postItems(tc.body)
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, res.Code)
+			}
+			var body apiError
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !strings.Contains(body.Message, tc.wantMessage) {
+				t.Fatalf("expected %q in the message, got %q", tc.wantMessage, body.Message)
+			}
+		})
+	}
+}
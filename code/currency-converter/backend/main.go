@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -24,17 +28,160 @@ type chartResponse struct {
 }
 
 type convertResponse struct {
-	Base      string  `json:"base"`
-	Target    string  `json:"target"`
-	Amount    float64 `json:"amount"`
-	Rate      float64 `json:"rate"`
-	Converted float64 `json:"converted"`
-	Source    string  `json:"source"`
+	Base   string  `json:"base"`
+	Target string  `json:"target"`
+	Amount float64 `json:"amount"`
+	// Rate is the mid-market rate. EffectiveRate is what the amount was
+	// converted at after Fees, which are left out when none apply.
+	Rate          float64       `json:"rate"`
+	EffectiveRate float64       `json:"effective_rate,omitempty"`
+	Fees          *feeBreakdown `json:"fees,omitempty"`
+	// Converted is rounded to the target currency's decimal places with
+	// Rounding; ConvertedRaw is the exact product.
+	Converted    json.Number  `json:"converted"`
+	ConvertedRaw json.Number  `json:"converted_raw"`
+	Rounding     roundingMode `json:"rounding"`
+	Source       string       `json:"source"`
+	// Date is the day whose rate was asked for, when it was.
+	Date string `json:"date,omitempty"`
+	// FetchedAt is when the rate was fetched, or published for a past day;
+	// Age is the seconds since.
+	FetchedAt time.Time `json:"fetched_at"`
+	Age       int       `json:"age"`
+	Stale     bool      `json:"stale,omitempty"`
+	// Trend is left out when no history could be read.
+	Trend *rateTrend `json:"trend,omitempty"`
 }
 
 func main() {
+	// SIGTERM stops the background jobs and drains the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Without a command the server starts; "convert" converts once and exits.
+	var command string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	if command != "" && command != "convert" {
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected convert or none to start the server\n", command)
+		os.Exit(2)
+	}
+
+	providers, err := loadProviderChain()
+	if err != nil {
+		log.Fatalf("failed to set up rate providers: %v", err)
+	}
+	if defaultFees, err = loadFeeSchedule(); err != nil {
+		log.Fatalf("failed to set up fees: %v", err)
+	}
+	cacheConfig, err := loadCacheConfig()
+	if err != nil {
+		log.Fatalf("failed to set up rate cache: %v", err)
+	}
+	upstreamConfig, err := loadUpstreamConfig()
+	if err != nil {
+		log.Fatalf("failed to set up rate providers: %v", err)
+	}
+	upstreamRetry = upstreamConfig.retry
+	store, err := openRateStore()
+	if err != nil {
+		log.Fatalf("failed to set up rate store: %v", err)
+	}
+
+	historySources := providers.historySources()
+	if source, ok := store.(historyProvider); ok {
+		historySources = append([]historyProvider{source}, historySources...)
+	}
+	trendFetcher = newTrendService(historySources...).Trend
+
+	pastSources := providers.pastRateSources()
+	if source, ok := store.(pastRateProvider); ok {
+		pastSources = append([]pastRateProvider{source}, pastSources...)
+	}
+	pastRates := newPastRates(pastSources...)
+
+	fetch := providers.FetchRate
+	if store != nil {
+		fetch = recordRates(store, fetch)
+	}
+	cache := newRateCache(cacheConfig, fetch)
+	rateCacheTTL = cacheConfig.ttl
+	rateFetcher = cache.Quote
+	if store != nil {
+		rateFetcher = withOfflineFallback(store, rateFetcher)
+	}
+	rateFetcher = withUpstreamDeadline(upstreamConfig.timeout, rateFetcher)
+	pastRateFetcher = func(ctx context.Context, base, target string, date time.Time) (rateQuote, error) {
+		return withUpstreamDeadline(upstreamConfig.timeout, func(ctx context.Context, base, target string) (rateQuote, error) {
+			return pastRates.RateOn(ctx, base, target, date)
+		})(ctx, base, target)
+	}
+	if command == "convert" {
+		os.Exit(runConvert(ctx, os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	refresherConfig, err := loadRefresherConfig()
+	if err != nil {
+		log.Fatalf("failed to set up rate refresher: %v", err)
+	}
+	alerts := newAlertRegistry(loadAlertNotifier())
+	var refresher *rateRefresher
+	if len(refresherConfig.pairs) > 0 {
+		refresher = newRateRefresher(refresherConfig, cache.Refresh)
+		refresher.onRefresh = alerts.evaluate
+		go refresher.Run(ctx)
+	}
+
+	dailyConfig, err := loadDailyConfig()
+	if err != nil {
+		log.Fatalf("failed to set up daily rates: %v", err)
+	}
+	var dailyStore dailyRateStore
+	if len(dailyConfig.pairs) > 0 {
+		var ok bool
+		if dailyStore, ok = store.(dailyRateStore); !ok {
+			log.Fatalf("failed to set up daily rates: DAILY_SNAPSHOT_PAIRS needs DATABASE_URL")
+		}
+		go newDailySnapshotter(dailyConfig, dailyStore, cache.Refresh).Run(ctx)
+	}
+
+	apiKeyConfig, err := loadAPIKeyConfig()
+	if err != nil {
+		log.Fatalf("failed to set up API keys: %v", err)
+	}
+	var keys *apiKeyRegistry
+	if apiKeyConfig.enabled() {
+		var source apiKeySource
+		if apiKeyConfig.fromDB {
+			var ok bool
+			if source, ok = store.(apiKeySource); !ok {
+				log.Fatalf("failed to set up API keys: API_KEYS_DB needs DATABASE_URL")
+			}
+		}
+		keys = newAPIKeyRegistry(apiKeyConfig, source)
+		if err := keys.reload(ctx); err != nil {
+			log.Fatalf("failed to set up API keys: %v", err)
+		}
+		go keys.Run(ctx)
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/convert", convertHandler)
+	mux.HandleFunc("/api/convert", requireAPIKey(keys, convertHandler))
+	mux.HandleFunc("/api/currencies", requireAPIKey(keys, currenciesHandler))
+	mux.HandleFunc("/api/daily", requireAPIKey(keys, dailyHandler(dailyStore)))
+	mux.HandleFunc("/api/table", requireAPIKey(keys, tableHandler))
+	mux.HandleFunc("/api/stream", requireAPIKey(keys, streamHandler(refresher)))
+	mux.HandleFunc("/api/alerts", requireAPIKey(keys, alertsHandler(alerts, refresher, keys)))
+	mux.HandleFunc("/api/alerts/", requireAPIKey(keys, alertsHandler(alerts, refresher, keys)))
+	mux.HandleFunc("/api/usage", usageHandler(keys))
+	mux.HandleFunc("/api/openapi.json", openAPIHandler)
+	mux.HandleFunc("/api/admin/refresher", requireAdmin(refresherStatusHandler(refresher)))
+	var storePing pinger
+	if store, ok := store.(pinger); ok {
+		storePing = store
+	}
+	mux.HandleFunc("/readyz", readyHandler(newReadinessChecker(providers, storePing)))
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
@@ -47,51 +194,80 @@ func main() {
 		addr = ":" + port
 	}
 
-	log.Printf("currency-converter backend listening on %s", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	server := newServer(addr, handler)
+	if refresher != nil {
+		server.RegisterOnShutdown(refresher.updates.close)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+
+	grpcAddr := ":9090"
+	if port := os.Getenv("GRPC_PORT"); port != "" {
+		grpcAddr = ":" + port
+	}
+	grpcListener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", grpcAddr, err)
+	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		if err := serveGRPC(ctx, newGRPCServer(keys), grpcListener); err != nil {
+			log.Fatalf("server error: %v", err)
+		}
+		close(grpcStopped)
+	}()
+
+	log.Printf("currency-converter backend listening on %s, gRPC on %s", addr, grpcAddr)
+	if err := serve(ctx, server, listener); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
+	<-grpcStopped
 }
 
 func convertHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		convertItemsHandler(w, r)
 		return
-	}
-
-	base := strings.ToUpper(r.URL.Query().Get("base"))
-	target := strings.ToUpper(r.URL.Query().Get("target"))
-	amountStr := r.URL.Query().Get("amount")
-
-	if base == "" || target == "" {
-		http.Error(w, "base and target query parameters are required", http.StatusBadRequest)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
 		return
 	}
 
-	amount := 1.0
-	if amountStr != "" {
-		parsed, err := strconv.ParseFloat(amountStr, 64)
-		if err != nil {
-			http.Error(w, "amount must be a number", http.StatusBadRequest)
-			return
-		}
-		amount = parsed
+	c, err := parseConversion(r.URL.Query(), time.Now())
+	if err != nil {
+		writeBadRequest(w, err)
+		return
 	}
-
-	rate, err := rateFetcher(base, target)
+	quote, err := quoteOn(r.Context(), c.base, c.target, c.date)
 	if err != nil {
 		log.Printf("failed to fetch rate: %v", err)
-		http.Error(w, "failed to fetch rate", http.StatusBadGateway)
+		status, body := upstreamError(err)
+		writeJSON(w, status, body)
 		return
 	}
 
-	resp := convertResponse{
-		Base:      base,
-		Target:    target,
-		Amount:    amount,
-		Rate:      rate,
-		Converted: rate * amount,
-		Source:    "yahoo-finance",
+	// The query names everything else the response depends on, so the rate
+	// is all the ETag needs to tell apart. Keys sent as a header are not in
+	// the query, hence the Vary.
+	past := !c.date.IsZero() && c.date.Format(time.DateOnly) != time.Now().UTC().Format(time.DateOnly)
+	etag := rateETag(quote)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", rateCacheControl(quote, past, time.Now()))
+	w.Header().Set("Vary", "X-API-Key")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	resp := c.response(quote)
+	// Trends compare with the live rate, so past conversions go without.
+	if c.date.IsZero() {
+		resp.Trend = lookupTrend(r.Context(), c.base, c.target, quote.Rate)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -100,56 +276,94 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-var rateFetcher = fetchRate
-
-func fetchRate(base, target string) (float64, error) {
-	symbol := base + target + "=X"
-	endpoint := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?range=1d&interval=1m", symbol)
+// conversion is a validated request to convert one amount.
+type conversion struct {
+	base, target string
+	amount       *big.Rat
+	rounding     roundingMode
+	fees         feeSchedule
+	// date is zero for the live rate.
+	date time.Time
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
-	if err != nil {
-		return 0, err
+// parseConversion validates the parameters of GET /api/convert.
+func parseConversion(query url.Values, now time.Time) (conversion, error) {
+	c := conversion{
+		base:   strings.ToUpper(query.Get("base")),
+		target: strings.ToUpper(query.Get("target")),
 	}
-
-	req.Header.Set("User-Agent", "currency-converter-agent/1.0")
-
-	res, err := client.Do(req)
-	if err != nil {
-		return 0, err
+	for _, param := range []struct{ name, code string }{{"base", c.base}, {"target", c.target}} {
+		if param.code == "" {
+			return conversion{}, &paramError{Field: param.name, Message: "query parameter is required"}
+		}
+		if err := validateCurrency(param.name, param.code); err != nil {
+			return conversion{}, err
+		}
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	amount := query.Get("amount")
+	if amount == "" {
+		amount = "1"
 	}
-
-	var payload chartResponse
-	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
-		return 0, err
+	var err error
+	if c.amount, err = parseDecimal(amount); err != nil {
+		return conversion{}, &paramError{Field: "amount", Message: "must be a number"}
 	}
-
-	if payload.Chart.Error != nil {
-		return 0, errors.New("chart api returned an error")
+	if c.rounding, err = parseRoundingMode(query.Get("rounding")); err != nil {
+		return conversion{}, err
 	}
-
-	if len(payload.Chart.Result) == 0 {
-		return 0, errors.New("chart api returned no results")
+	if c.fees, err = defaultFees.withOverrides(query.Get("spread"), query.Get("fee"), c.base); err != nil {
+		return conversion{}, err
 	}
-
-	price := payload.Chart.Result[0].Meta.RegularMarketPrice
-	if price == 0 {
-		return 0, errors.New("received zero price from api")
+	if err := c.fees.check(c.amount, c.base); err != nil {
+		return conversion{}, invalidParam("amount", err)
+	}
+	if value := query.Get("date"); value != "" {
+		if c.date, err = parseRateDate(value, now); err != nil {
+			return conversion{}, invalidParam("date", err)
+		}
 	}
+	return c, nil
+}
+
+// response converts the amount at quote. It leaves the trend out.
+func (c conversion) response(quote rateQuote) convertResponse {
+	result := c.fees.convert(c.amount, ratFromFloat(quote.Rate), c.base, c.target, c.rounding)
+	decimals := currencyByCode[c.target].Decimals
+	amount, _ := c.amount.Float64()
 
-	return price, nil
+	resp := convertResponse{
+		Base:         c.base,
+		Target:       c.target,
+		Amount:       amount,
+		Rate:         quote.Rate,
+		Fees:         result.breakdown,
+		Converted:    json.Number(roundRat(result.converted, decimals, c.rounding).FloatString(decimals)),
+		ConvertedRaw: json.Number(formatDecimal(result.converted)),
+		Rounding:     c.rounding,
+		Source:       quote.Source,
+		FetchedAt:    quote.FetchedAt.UTC(),
+		Age:          int(time.Since(quote.FetchedAt).Seconds()),
+		Stale:        quote.Stale,
+	}
+	if result.breakdown != nil {
+		resp.EffectiveRate = result.effectiveRate
+	}
+	if !c.date.IsZero() {
+		resp.Date = c.date.Format(time.DateOnly)
+	}
+	return resp
 }
 
+// rateFetcher returns a rate, usually from the cache in front of the providers.
+var rateFetcher func(ctx context.Context, base, target string) (rateQuote, error)
+
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
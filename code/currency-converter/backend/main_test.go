@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConvertHandlerMethodNotAllowed(t *testing.T) {
-	req := httptest.NewRequest(http.MethodPost, "/api/convert?base=USD&target=IDR", nil)
+	req := httptest.NewRequest(http.MethodPut, "/api/convert?base=USD&target=IDR", nil)
 	res := httptest.NewRecorder()
 
 	convertHandler(res, req)
@@ -36,6 +40,26 @@ func TestConvertHandlerValidationErrors(t *testing.T) {
 			url:        "/api/convert?base=USD&target=IDR&amount=abc",
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:       "invalid rounding",
+			url:        "/api/convert?base=USD&target=IDR&rounding=nearest",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown currency",
+			url:        "/api/convert?base=USS&target=IDR",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid date",
+			url:        "/api/convert?base=USD&target=IDR&date=23-10-2025",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "future date",
+			url:        "/api/convert?base=USD&target=IDR&date=2999-01-01",
+			wantStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tc := range tests {
@@ -54,11 +78,11 @@ func TestConvertHandlerValidationErrors(t *testing.T) {
 
 func TestConvertHandlerSuccess(t *testing.T) {
 	originalFetcher := rateFetcher
-	rateFetcher = func(base, target string) (float64, error) {
+	rateFetcher = func(_ context.Context, base, target string) (rateQuote, error) {
 		if base != "USD" || target != "IDR" {
 			t.Fatalf("unexpected arguments: %s, %s", base, target)
 		}
-		return 15000.5, nil
+		return rateQuote{Rate: 15000.5, Source: "frankfurter", FetchedAt: time.Now().Add(-90 * time.Second)}, nil
 	}
 	defer func() { rateFetcher = originalFetcher }()
 
@@ -80,25 +104,146 @@ func TestConvertHandlerSuccess(t *testing.T) {
 		t.Fatalf("expected rate 15000.5, got %f", payload.Rate)
 	}
 
-	if payload.Converted != 30001 {
-		t.Fatalf("expected converted 30001, got %f", payload.Converted)
+	if payload.Converted != "30001.00" || payload.ConvertedRaw != "30001" || payload.Rounding != roundHalfEven {
+		t.Fatalf("expected converted 30001.00 rounded half-even, got %s (raw %s, %s)", payload.Converted, payload.ConvertedRaw, payload.Rounding)
+	}
+
+	if payload.Source != "frankfurter" {
+		t.Fatalf("expected source frankfurter, got %q", payload.Source)
+	}
+
+	if payload.Age != 90 || payload.Stale {
+		t.Fatalf("expected a fresh rate fetched 90 seconds ago, got age %d and stale %t", payload.Age, payload.Stale)
 	}
 }
 
-func TestConvertHandlerFetchError(t *testing.T) {
-	originalFetcher := rateFetcher
-	rateFetcher = func(string, string) (float64, error) {
-		return 0, errors.New("boom")
+func TestConvertHandlerPastDate(t *testing.T) {
+	originalFetcher, originalPast, originalTrend := rateFetcher, pastRateFetcher, trendFetcher
+	rateFetcher = func(context.Context, string, string) (rateQuote, error) {
+		t.Fatal("expected the past rate, not the live one")
+		return rateQuote{}, nil
 	}
-	defer func() { rateFetcher = originalFetcher }()
+	pastRateFetcher = func(_ context.Context, base, target string, date time.Time) (rateQuote, error) {
+		if date.Format(time.DateOnly) != "2025-10-23" {
+			t.Fatalf("expected the rate of 2025-10-23, got %s", date)
+		}
+		return rateQuote{Rate: 16570, Source: "frankfurter", FetchedAt: date.Add(15 * time.Hour)}, nil
+	}
+	trendFetcher = func(context.Context, string, string, float64) (*rateTrend, error) {
+		t.Fatal("expected no trend for a past date")
+		return nil, nil
+	}
+	defer func() { rateFetcher, pastRateFetcher, trendFetcher = originalFetcher, originalPast, originalTrend }()
 
-	req := httptest.NewRequest(http.MethodGet, "/api/convert?base=USD&target=IDR", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/convert?base=USD&target=IDR&amount=10&date=2025-10-23", nil)
 	res := httptest.NewRecorder()
 
 	convertHandler(res, req)
 
-	if res.Code != http.StatusBadGateway {
-		t.Fatalf("expected status %d, got %d", http.StatusBadGateway, res.Code)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var payload convertResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Date != "2025-10-23" || payload.Converted != "165700.00" || payload.Trend != nil {
+		t.Fatalf("expected 165700.00 on 2025-10-23 without a trend, got %+v", payload)
+	}
+	if want := time.Date(2025, 10, 23, 15, 0, 0, 0, time.UTC); !payload.FetchedAt.Equal(want) {
+		t.Fatalf("expected the rate published at %s, got %s", want, payload.FetchedAt)
+	}
+}
+
+func TestConvertHandlerFees(t *testing.T) {
+	originalFetcher, originalFees := rateFetcher, defaultFees
+	rateFetcher = func(context.Context, string, string) (rateQuote, error) {
+		return rateQuote{Rate: 16000, Source: "frankfurter", FetchedAt: time.Now()}, nil
+	}
+	defaultFees = feeSchedule{spread: big.NewRat(5, 2), fixed: map[string]*big.Rat{"EUR": big.NewRat(1, 1)}}
+	defer func() { rateFetcher, defaultFees = originalFetcher, originalFees }()
+
+	tests := []struct {
+		name          string
+		url           string
+		wantConverted string
+		wantEffective float64
+		wantFixed     string
+	}{
+		{name: "default spread", url: "/api/convert?base=USD&target=IDR&amount=100", wantConverted: "1560000.00", wantEffective: 15600, wantFixed: "0"},
+		{name: "fee asked for", url: "/api/convert?base=USD&target=IDR&amount=100&fee=2", wantConverted: "1528800.00", wantEffective: 15288, wantFixed: "2"},
+		{name: "no spread", url: "/api/convert?base=USD&target=IDR&amount=100&spread=0", wantConverted: "1600000.00"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			convertHandler(res, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+			}
+			var payload convertResponse
+			if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if payload.Rate != 16000 || payload.Converted.String() != tc.wantConverted || payload.EffectiveRate != tc.wantEffective {
+				t.Fatalf("expected %s at %f, got %+v", tc.wantConverted, tc.wantEffective, payload)
+			}
+			if tc.wantFixed == "" {
+				if payload.Fees != nil {
+					t.Fatalf("expected no fees, got %+v", payload.Fees)
+				}
+				return
+			}
+			if payload.Fees == nil || payload.Fees.Fixed.String() != tc.wantFixed {
+				t.Fatalf("expected a fixed fee of %s, got %+v", tc.wantFixed, payload.Fees)
+			}
+		})
+	}
+
+	res := httptest.NewRecorder()
+	convertHandler(res, httptest.NewRequest(http.MethodGet, "/api/convert?base=EUR&target=IDR&amount=0.5", nil))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected an amount below the fixed fee to be rejected, got %d", res.Code)
+	}
+}
+
+func TestConvertHandlerFetchError(t *testing.T) {
+	originalFetcher := rateFetcher
+	defer func() { rateFetcher = originalFetcher }()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "providers fail", err: errors.New("boom"), wantStatus: http.StatusBadGateway, wantCode: "upstream_unavailable"},
+		{name: "deadline passes", err: fmt.Errorf("%w: boom", errUpstreamTimeout), wantStatus: http.StatusGatewayTimeout, wantCode: "upstream_timeout"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rateFetcher = func(context.Context, string, string) (rateQuote, error) {
+				return rateQuote{}, tc.err
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/convert?base=USD&target=IDR", nil)
+			res := httptest.NewRecorder()
+
+			convertHandler(res, req)
+
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, res.Code)
+			}
+			var body apiError
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if body.Code != tc.wantCode {
+				t.Fatalf("expected code %s, got %q", tc.wantCode, body.Code)
+			}
+		})
 	}
 }
 
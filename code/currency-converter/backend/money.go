@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is computed with exact rationals from math/big rather than a decimal
+// library, which keeps the backend on the standard library.
+
+// maxDecimalPlaces bounds the digits of an unrounded amount. The product of
+// two decimals always terminates well within it.
+const maxDecimalPlaces = 40
+
+type roundingMode string
+
+const (
+	roundHalfEven roundingMode = "half-even"
+	roundHalfUp   roundingMode = "half-up"
+	roundHalfDown roundingMode = "half-down"
+	roundUp       roundingMode = "up"
+	roundDown     roundingMode = "down"
+	roundCeiling  roundingMode = "ceiling"
+	roundFloor    roundingMode = "floor"
+)
+
+var roundingModes = []roundingMode{roundHalfEven, roundHalfUp, roundHalfDown, roundUp, roundDown, roundCeiling, roundFloor}
+
+// parseRoundingMode reads the rounding parameter, which defaults to half-even.
+func parseRoundingMode(value string) (roundingMode, error) {
+	if value == "" {
+		return roundHalfEven, nil
+	}
+	for _, mode := range roundingModes {
+		if roundingMode(strings.ToLower(value)) == mode {
+			return mode, nil
+		}
+	}
+	names := make([]string, len(roundingModes))
+	for i, mode := range roundingModes {
+		names[i] = string(mode)
+	}
+	return "", &paramError{Field: "rounding", Message: "must be one of " + strings.Join(names, ", ")}
+}
+
+// parseDecimal reads a decimal such as "12.50" exactly.
+func parseDecimal(value string) (*big.Rat, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, errors.New("not a number")
+	}
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, errors.New("not a number")
+	}
+	return r, nil
+}
+
+// ratFromFloat returns the decimal a float64 prints as, so a rate of 0.1
+// is 1/10 rather than the nearest binary fraction.
+func ratFromFloat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return r
+}
+
+// roundRat rounds x to places decimal places using mode.
+func roundRat(x *big.Rat, places int, mode roundingMode) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	scaled := new(big.Rat).Mul(x, new(big.Rat).SetInt(scale))
+
+	// QuoRem truncates toward zero, leaving a remainder with the sign of x.
+	q, r := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if r.Sign() != 0 {
+		negative := x.Sign() < 0
+		// Compare twice the remainder with the denominator to place it
+		// below, at, or above the halfway point.
+		half := new(big.Int).Abs(r)
+		half.Lsh(half, 1)
+		cmp := half.Cmp(scaled.Denom())
+
+		var away bool
+		switch mode {
+		case roundHalfEven:
+			away = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+		case roundHalfUp:
+			away = cmp >= 0
+		case roundHalfDown:
+			away = cmp > 0
+		case roundUp:
+			away = true
+		case roundDown:
+			away = false
+		case roundCeiling:
+			away = !negative
+		case roundFloor:
+			away = negative
+		}
+		if away {
+			if negative {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	return new(big.Rat).SetFrac(q, scale)
+}
+
+// formatDecimal prints x with as few decimal places as it needs.
+func formatDecimal(x *big.Rat) string {
+	if x.IsInt() {
+		return x.Num().String()
+	}
+	scaled := new(big.Rat).Set(x)
+	ten := big.NewRat(10, 1)
+	for places := 1; places < maxDecimalPlaces; places++ {
+		scaled.Mul(scaled, ten)
+		if scaled.IsInt() {
+			return x.FloatString(places)
+		}
+	}
+	return x.FloatString(maxDecimalPlaces)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestRoundRat(t *testing.T) {
+	tests := []struct {
+		value  string
+		places int
+		mode   roundingMode
+		want   string
+	}{
+		{value: "2.345", places: 2, mode: roundHalfEven, want: "2.34"},
+		{value: "2.355", places: 2, mode: roundHalfEven, want: "2.36"},
+		{value: "2.345", places: 2, mode: roundHalfUp, want: "2.35"},
+		{value: "2.345", places: 2, mode: roundHalfDown, want: "2.34"},
+		{value: "2.341", places: 2, mode: roundUp, want: "2.35"},
+		{value: "2.349", places: 2, mode: roundDown, want: "2.34"},
+		{value: "-2.341", places: 2, mode: roundCeiling, want: "-2.34"},
+		{value: "-2.341", places: 2, mode: roundFloor, want: "-2.35"},
+		{value: "-2.345", places: 2, mode: roundHalfUp, want: "-2.35"},
+		{value: "1234.5", places: 0, mode: roundHalfEven, want: "1234"},
+		{value: "0.0005", places: 3, mode: roundHalfEven, want: "0.000"},
+		{value: "7.1", places: 2, mode: roundHalfEven, want: "7.10"},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.mode)+" "+tc.value, func(t *testing.T) {
+			value, err := parseDecimal(tc.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := roundRat(value, tc.places, tc.mode).FloatString(tc.places); got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDecimalProductIsExact(t *testing.T) {
+	amount, _ := parseDecimal("0.1")
+	product := amount.Mul(amount, ratFromFloat(0.2))
+	if got := formatDecimal(product); got != "0.02" {
+		t.Fatalf("expected 0.02, got %s", got)
+	}
+}
+
+func TestParseDecimalRejectsNonNumbers(t *testing.T) {
+	for _, value := range []string{"abc", "1/3", "NaN", "Inf", ""} {
+		if _, err := parseDecimal(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+}
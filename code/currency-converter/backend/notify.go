@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	deliveryAttempts = 4
+	deliveryBackoff  = 2 * time.Second
+)
+
+type smtpConfig struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func (c smtpConfig) enabled() bool {
+	return c.addr != "" && c.from != ""
+}
+
+// errWebhookAddress is returned for webhooks that point into the network the
+// service runs in.
+var errWebhookAddress = errors.New("must not point at a loopback, private, or link-local address")
+
+// alertNotifier delivers fired alerts by webhook or email, retrying with
+// exponential backoff.
+type alertNotifier struct {
+	client   *http.Client
+	smtp     smtpConfig
+	attempts int
+	backoff  time.Duration
+	// sendMail is smtp.SendMail, swapped in tests.
+	sendMail func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+	// lookupIP is net.DefaultResolver.LookupIP and webhookAllowed is
+	// publicAddress, both swapped in tests.
+	lookupIP       func(ctx context.Context, network, host string) ([]net.IP, error)
+	webhookAllowed func(ip net.IP) bool
+}
+
+// loadAlertNotifier reads the SMTP settings; without SMTP_ADDR and SMTP_FROM
+// only webhook alerts can be registered.
+func loadAlertNotifier() *alertNotifier {
+	return &alertNotifier{
+		client: newWebhookClient(publicAddress),
+		smtp: smtpConfig{
+			addr:     os.Getenv("SMTP_ADDR"),
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     os.Getenv("SMTP_FROM"),
+		},
+		attempts:       deliveryAttempts,
+		backoff:        deliveryBackoff,
+		sendMail:       smtp.SendMail,
+		lookupIP:       net.DefaultResolver.LookupIP,
+		webhookAllowed: publicAddress,
+	}
+}
+
+// publicAddress reports whether ip is outside loopback, private, link-local,
+// and unspecified ranges, and so may be called as a webhook.
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// checkWebhookHost rejects a webhook host that resolves to an address
+// webhookAllowed refuses.
+func (n *alertNotifier) checkWebhookHost(ctx context.Context, host string) error {
+	ips, err := n.lookupIP(ctx, "ip", host)
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("host %s could not be resolved", host)
+	}
+	for _, ip := range ips {
+		if !n.webhookAllowed(ip) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// newWebhookClient checks every address it dials with allowed, so a webhook
+// host that resolves differently after the alert was created, or redirects,
+// still cannot reach the service's own network.
+func newWebhookClient(allowed func(ip net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("webhook address %s: %w", host, errWebhookAddress)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+func (n *alertNotifier) deliver(a alert, event alertEvent) {
+	send := func() (bool, error) { return n.postWebhook(a, event) }
+	if a.Email != "" {
+		send = func() (bool, error) { return true, n.sendEmail(a, event) }
+	}
+
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := send()
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= n.attempts {
+			log.Printf("giving up on alert %s after %d attempts: %v", a.ID, attempt, err)
+			return
+		}
+		log.Printf("delivering alert %s failed (attempt %d/%d): %v; retrying in %s", a.ID, attempt, n.attempts, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// signWebhook is the hex HMAC-SHA256 of the timestamp, a dot, and the body,
+// keyed with the alert's secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook reports whether a failed call is worth retrying: network
+// errors, 429, and 5xx are; blocked addresses and other statuses are not.
+func (n *alertNotifier) postWebhook(a alert, event alertEvent) (bool, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "currency-converter-agent/1.0")
+	req.Header.Set("X-Alert-Timestamp", timestamp)
+	req.Header.Set("X-Alert-Signature", "sha256="+signWebhook(a.secret, timestamp, body))
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, errWebhookAddress), err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook answered %d", res.StatusCode)
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
+
+func (n *alertNotifier) sendEmail(a alert, event alertEvent) error {
+	subject := fmt.Sprintf("%s/%s is %s %v", event.Base, event.Target, event.Condition, event.Threshold)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", n.smtp.from, a.Email, subject)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s/%s is %v, %s your alert threshold of %v.\r\n", event.Base, event.Target, event.Rate, event.Condition, event.Threshold)
+	fmt.Fprintf(&msg, "Rate from %s at %s.\r\n", event.Source, event.FetchedAt.Format(time.RFC1123))
+
+	var auth smtp.Auth
+	if n.smtp.username != "" {
+		host, _, _ := net.SplitHostPort(n.smtp.addr)
+		auth = smtp.PlainAuth("", n.smtp.username, n.smtp.password, host)
+	}
+	return n.sendMail(n.smtp.addr, auth, n.smtp.from, []string{a.Email}, []byte(msg.String()))
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRateProviders = "yahoo,frankfurter,exchangerate-host,coinbase"
+
+// rateLimitCooldown is how long a provider that answered 429 without a
+// Retry-After header is skipped.
+const rateLimitCooldown = time.Minute
+
+// RateProvider fetches the live rate for one unit of base in target.
+type RateProvider interface {
+	Name() string
+	FetchRate(ctx context.Context, base, target string) (float64, error)
+}
+
+// assetClassProvider is implemented by providers that only cover some asset
+// classes. Providers without it are asked for every pair.
+type assetClassProvider interface {
+	AssetClasses() []string
+}
+
+// covers reports whether provider can quote both sides of the pair.
+func covers(provider RateProvider, base, target string) bool {
+	restricted, ok := provider.(assetClassProvider)
+	if !ok {
+		return true
+	}
+	classes := restricted.AssetClasses()
+	for _, code := range []string{base, target} {
+		currency, known := currencyByCode[code]
+		if known && !slices.Contains(classes, currency.Class) {
+			return false
+		}
+	}
+	return true
+}
+
+// rateLimitError reports a 429, so the chain can skip the provider for a while.
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return "rate limited"
+}
+
+// statusError reports a response other than 200 or 429.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.code)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// getJSON fetches endpoint and decodes a 200 response into out. Timeouts,
+// 5xx responses and 429s with a short Retry-After are retried.
+func getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	return withRetries(ctx, upstreamRetry, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, upstreamAttemptTimeout)
+		defer cancel()
+		return getJSONOnce(ctx, endpoint, out)
+	})
+}
+
+func getJSONOnce(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "currency-converter-agent/1.0")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		retryAfter := rateLimitCooldown
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return &rateLimitError{retryAfter: retryAfter}
+	}
+	if res.StatusCode != http.StatusOK {
+		return &statusError{code: res.StatusCode}
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// yahooProvider reads the Yahoo Finance chart API, which is unofficial.
+type yahooProvider struct {
+	baseURL string
+}
+
+func (p yahooProvider) Name() string { return "yahoo-finance" }
+
+func (p yahooProvider) AssetClasses() []string { return []string{classFiat, classCrypto, classMetal} }
+
+// yahooSymbol names the pair's chart. Currencies and metals are quoted as
+// "USDIDR=X", cryptocurrencies as "BTC-USD". A pair with only the target in
+// crypto is read from the inverse chart, so invert is set.
+func yahooSymbol(base, target string) (symbol string, invert bool) {
+	switch {
+	case currencyByCode[base].Class == classCrypto:
+		return base + "-" + target, false
+	case currencyByCode[target].Class == classCrypto:
+		return target + "-" + base, true
+	}
+	return base + target + "=X", false
+}
+
+func (p yahooProvider) FetchRate(ctx context.Context, base, target string) (float64, error) {
+	symbol, invert := yahooSymbol(base, target)
+	endpoint := fmt.Sprintf("%s/v8/finance/chart/%s?range=1d&interval=1m", p.baseURL, url.PathEscape(symbol))
+
+	var payload chartResponse
+	if err := getJSON(ctx, endpoint, &payload); err != nil {
+		return 0, err
+	}
+
+	if payload.Chart.Error != nil {
+		return 0, errors.New("chart api returned an error")
+	}
+
+	if len(payload.Chart.Result) == 0 {
+		return 0, errors.New("chart api returned no results")
+	}
+
+	price := payload.Chart.Result[0].Meta.RegularMarketPrice
+	if price == 0 {
+		return 0, errors.New("received zero price from api")
+	}
+
+	if invert {
+		return 1 / price, nil
+	}
+	return price, nil
+}
+
+// frankfurterProvider reads the European Central Bank reference rates, which
+// are published once per working day.
+type frankfurterProvider struct {
+	baseURL string
+}
+
+func (p frankfurterProvider) Name() string { return "frankfurter" }
+
+func (p frankfurterProvider) AssetClasses() []string { return []string{classFiat} }
+
+func (p frankfurterProvider) FetchRate(ctx context.Context, base, target string) (float64, error) {
+	endpoint := fmt.Sprintf("%s/latest?from=%s&to=%s", p.baseURL, url.QueryEscape(base), url.QueryEscape(target))
+
+	var payload struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(ctx, endpoint, &payload); err != nil {
+		return 0, err
+	}
+
+	rate := payload.Rates[target]
+	if rate == 0 {
+		return 0, fmt.Errorf("no %s rate in response", target)
+	}
+	return rate, nil
+}
+
+// exchangeRateHostProvider reads exchangerate.host, which needs an access key
+// on its current plans.
+type exchangeRateHostProvider struct {
+	baseURL   string
+	accessKey string
+}
+
+func (p exchangeRateHostProvider) Name() string { return "exchangerate.host" }
+
+func (p exchangeRateHostProvider) AssetClasses() []string {
+	return []string{classFiat, classCrypto, classMetal}
+}
+
+func (p exchangeRateHostProvider) FetchRate(ctx context.Context, base, target string) (float64, error) {
+	query := url.Values{"from": {base}, "to": {target}, "amount": {"1"}}
+	if p.accessKey != "" {
+		query.Set("access_key", p.accessKey)
+	}
+
+	var payload struct {
+		Success *bool   `json:"success"`
+		Result  float64 `json:"result"`
+		Error   struct {
+			Info string `json:"info"`
+		} `json:"error"`
+	}
+	if err := getJSON(ctx, p.baseURL+"/convert?"+query.Encode(), &payload); err != nil {
+		return 0, err
+	}
+
+	if payload.Success != nil && !*payload.Success {
+		return 0, fmt.Errorf("api returned an error: %s", payload.Error.Info)
+	}
+	if payload.Result == 0 {
+		return 0, errors.New("received zero rate from api")
+	}
+	return payload.Result, nil
+}
+
+// coinbaseProvider reads Coinbase's public exchange rates, which cover
+// cryptocurrencies against currencies and each other without a key.
+type coinbaseProvider struct {
+	baseURL string
+}
+
+func (p coinbaseProvider) Name() string { return "coinbase" }
+
+func (p coinbaseProvider) AssetClasses() []string { return []string{classFiat, classCrypto} }
+
+func (p coinbaseProvider) FetchRate(ctx context.Context, base, target string) (float64, error) {
+	endpoint := fmt.Sprintf("%s/v2/exchange-rates?currency=%s", p.baseURL, url.QueryEscape(base))
+
+	var payload struct {
+		Data struct {
+			Rates map[string]string `json:"rates"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, endpoint, &payload); err != nil {
+		return 0, err
+	}
+
+	rate, err := strconv.ParseFloat(payload.Data.Rates[target], 64)
+	if err != nil || rate == 0 {
+		return 0, fmt.Errorf("no %s rate in response", target)
+	}
+	return rate, nil
+}
+
+func newRateProvider(name string) (RateProvider, error) {
+	switch name {
+	case "yahoo":
+		return yahooProvider{baseURL: getenv("YAHOO_FINANCE_URL", "https://query1.finance.yahoo.com")}, nil
+	case "frankfurter":
+		return frankfurterProvider{baseURL: getenv("FRANKFURTER_URL", "https://api.frankfurter.app")}, nil
+	case "exchangerate-host":
+		return exchangeRateHostProvider{
+			baseURL:   getenv("EXCHANGERATE_HOST_URL", "https://api.exchangerate.host"),
+			accessKey: os.Getenv("EXCHANGERATE_HOST_ACCESS_KEY"),
+		}, nil
+	case "coinbase":
+		return coinbaseProvider{baseURL: getenv("COINBASE_URL", "https://api.coinbase.com")}, nil
+	}
+	return nil, fmt.Errorf("unknown rate provider %q, must be yahoo, frankfurter, exchangerate-host, or coinbase", name)
+}
+
+// providerChain asks each provider in turn until one answers. A provider that
+// is rate limited is skipped until its Retry-After has passed.
+type providerChain struct {
+	providers []RateProvider
+
+	mu          sync.Mutex
+	coolingDown map[string]time.Time
+}
+
+func newProviderChain(providers ...RateProvider) *providerChain {
+	return &providerChain{providers: providers, coolingDown: map[string]time.Time{}}
+}
+
+// loadProviderChain builds the chain from RATE_PROVIDERS, a comma-separated
+// list in priority order.
+func loadProviderChain() (*providerChain, error) {
+	var providers []RateProvider
+	for _, name := range strings.Split(getenv("RATE_PROVIDERS", defaultRateProviders), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		provider, err := newRateProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("RATE_PROVIDERS lists no providers")
+	}
+	return newProviderChain(providers...), nil
+}
+
+// FetchRate returns the rate and the name of the provider that gave it. Only
+// providers that cover the pair's asset classes are asked.
+func (c *providerChain) FetchRate(ctx context.Context, base, target string) (float64, string, error) {
+	var errs []error
+	for _, provider := range c.providers {
+		if !covers(provider, base, target) {
+			continue
+		}
+		name := provider.Name()
+		if until, ok := c.cooldown(name); ok {
+			errs = append(errs, fmt.Errorf("%s: rate limited until %s", name, until.Format(time.RFC3339)))
+			continue
+		}
+
+		rate, err := provider.FetchRate(ctx, base, target)
+		if err == nil {
+			return rate, name, nil
+		}
+		var limited *rateLimitError
+		if errors.As(err, &limited) {
+			c.coolDown(name, limited.retryAfter)
+		}
+		log.Printf("rate provider %s failed for %s/%s: %v", name, base, target, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return 0, "", fmt.Errorf("no rate provider covers %s/%s, check RATE_PROVIDERS", base, target)
+	}
+	return 0, "", errors.Join(errs...)
+}
+
+func (c *providerChain) cooldown(name string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.coolingDown[name]
+	if ok && time.Now().After(until) {
+		delete(c.coolingDown, name)
+		return time.Time{}, false
+	}
+	return until, ok
+}
+
+func (c *providerChain) coolDown(name string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.coolingDown[name] = time.Now().Add(d)
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type stubProvider struct {
+	name  string
+	rate  float64
+	err   error
+	calls int
+}
+
+func (p *stubProvider) Name() string { return p.name }
+
+func (p *stubProvider) FetchRate(context.Context, string, string) (float64, error) {
+	p.calls++
+	return p.rate, p.err
+}
+
+func TestProviderChainFailsOver(t *testing.T) {
+	failing := &stubProvider{name: "yahoo-finance", err: errors.New("boom")}
+	backup := &stubProvider{name: "frankfurter", rate: 16250}
+	chain := newProviderChain(failing, backup)
+
+	rate, source, err := chain.FetchRate(context.Background(), "USD", "IDR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rate != 16250 || source != "frankfurter" {
+		t.Fatalf("expected 16250 from frankfurter, got %f from %q", rate, source)
+	}
+}
+
+func TestProviderChainSkipsRateLimitedProvider(t *testing.T) {
+	limited := &stubProvider{name: "yahoo-finance", err: &rateLimitError{retryAfter: rateLimitCooldown}}
+	backup := &stubProvider{name: "frankfurter", rate: 16250}
+	chain := newProviderChain(limited, backup)
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := chain.FetchRate(context.Background(), "USD", "IDR"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if limited.calls != 1 || backup.calls != 3 {
+		t.Fatalf("expected the rate limited provider asked once, got %d calls and %d to the backup", limited.calls, backup.calls)
+	}
+}
+
+// fiatOnlyProvider is a stubProvider that covers currencies only.
+type fiatOnlyProvider struct {
+	*stubProvider
+}
+
+func (fiatOnlyProvider) AssetClasses() []string { return []string{classFiat} }
+
+func TestProviderChainRoutesByAssetClass(t *testing.T) {
+	fiat := fiatOnlyProvider{&stubProvider{name: "frankfurter", rate: 16250}}
+	crypto := &stubProvider{name: "coinbase", rate: 1.7e9}
+	chain := newProviderChain(fiat, crypto)
+
+	rate, source, err := chain.FetchRate(context.Background(), "BTC", "IDR")
+	if err != nil || rate != 1.7e9 || source != "coinbase" || fiat.calls != 0 {
+		t.Fatalf("expected BTC/IDR from coinbase only, got %f from %q (%v) after %d fiat calls", rate, source, err, fiat.calls)
+	}
+	if _, source, _ := chain.FetchRate(context.Background(), "USD", "IDR"); source != "frankfurter" {
+		t.Fatalf("expected USD/IDR from frankfurter, got %q", source)
+	}
+
+	if _, _, err := newProviderChain(fiat).FetchRate(context.Background(), "XAU", "USD"); err == nil || !strings.Contains(err.Error(), "no rate provider covers") {
+		t.Fatalf("expected an error naming the uncovered pair, got %v", err)
+	}
+}
+
+func TestYahooSymbol(t *testing.T) {
+	tests := []struct {
+		base, target string
+		want         string
+		invert       bool
+	}{
+		{base: "USD", target: "IDR", want: "USDIDR=X"},
+		{base: "XAU", target: "USD", want: "XAUUSD=X"},
+		{base: "BTC", target: "IDR", want: "BTC-IDR"},
+		{base: "USD", target: "ETH", want: "ETH-USD", invert: true},
+	}
+
+	for _, tc := range tests {
+		if symbol, invert := yahooSymbol(tc.base, tc.target); symbol != tc.want || invert != tc.invert {
+			t.Fatalf("expected %s (invert %t) for %s/%s, got %s (%t)", tc.want, tc.invert, tc.base, tc.target, symbol, invert)
+		}
+	}
+}
+
+func TestProviderChainAllFail(t *testing.T) {
+	chain := newProviderChain(&stubProvider{name: "a", err: errors.New("down")}, &stubProvider{name: "b", err: errors.New("down")})
+
+	if _, _, err := chain.FetchRate(context.Background(), "USD", "IDR"); err == nil {
+		t.Fatalf("expected an error when every provider fails")
+	}
+}
+
+func TestProvidersParseResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		provider func(baseURL string) RateProvider
+		wantRate float64
+		wantErr  bool
+	}{
+		{
+			name:     "yahoo",
+			body:     `{"chart":{"result":[{"meta":{"regularMarketPrice":16250.5}}],"error":null}}`,
+			provider: func(baseURL string) RateProvider { return yahooProvider{baseURL: baseURL} },
+			wantRate: 16250.5,
+		},
+		{
+			name:     "frankfurter",
+			body:     `{"amount":1.0,"base":"USD","date":"2025-10-24","rates":{"IDR":16240}}`,
+			provider: func(baseURL string) RateProvider { return frankfurterProvider{baseURL: baseURL} },
+			wantRate: 16240,
+		},
+		{
+			name:     "exchangerate.host",
+			body:     `{"success":true,"result":16245.2}`,
+			provider: func(baseURL string) RateProvider { return exchangeRateHostProvider{baseURL: baseURL} },
+			wantRate: 16245.2,
+		},
+		{
+			name:     "exchangerate.host error",
+			body:     `{"success":false,"error":{"info":"missing access key"}}`,
+			provider: func(baseURL string) RateProvider { return exchangeRateHostProvider{baseURL: baseURL} },
+			wantErr:  true,
+		},
+		{
+			name:     "coinbase",
+			body:     `{"data":{"currency":"USD","rates":{"IDR":"16251.75","BTC":"0.0000094"}}}`,
+			provider: func(baseURL string) RateProvider { return coinbaseProvider{baseURL: baseURL} },
+			wantRate: 16251.75,
+		},
+		{
+			name:     "rate limited",
+			status:   http.StatusTooManyRequests,
+			provider: func(baseURL string) RateProvider { return frankfurterProvider{baseURL: baseURL} },
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+					return
+				}
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			rate, err := tc.provider(server.URL).FetchRate(context.Background(), "USD", "IDR")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got rate %f", rate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rate != tc.wantRate {
+				t.Fatalf("expected rate %f, got %f", tc.wantRate, rate)
+			}
+		})
+	}
+}
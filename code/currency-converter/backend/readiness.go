@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// readyCheckInterval is how long a provider check is trusted, so frequent
+	// probes do not turn into traffic to the providers.
+	readyCheckInterval = 30 * time.Second
+	// readyCheckTimeout bounds one round of provider checks.
+	readyCheckTimeout = 5 * time.Second
+)
+
+// readyProbePairs are tried in order; each provider is checked with the first
+// it covers.
+var readyProbePairs = []ratePair{{Base: "USD", Target: "EUR"}, {Base: "BTC", Target: "USD"}, {Base: "XAU", Target: "USD"}}
+
+// pinger is implemented by stores that can report whether they are reachable.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type dependencyStatus struct {
+	Name      string    `json:"name"`
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// readinessReport is "ready" when a provider and the store answer,
+// "degraded" when only a provider does, and "unavailable" when none does.
+type readinessReport struct {
+	Status    string             `json:"status"`
+	Providers []dependencyStatus `json:"providers"`
+	// Store is left out when persistence is off.
+	Store *dependencyStatus `json:"store,omitempty"`
+}
+
+// readinessChecker checks the providers at most once per readyCheckInterval
+// and the store on every probe.
+type readinessChecker struct {
+	chain *providerChain
+	store pinger
+	now   func() time.Time
+
+	// mu is held through a check, so probes arriving meanwhile wait for its
+	// result instead of starting their own.
+	mu        sync.Mutex
+	providers []dependencyStatus
+	checkedAt time.Time
+}
+
+func newReadinessChecker(chain *providerChain, store pinger) *readinessChecker {
+	return &readinessChecker{chain: chain, store: store, now: time.Now}
+}
+
+// Report returns the status of each dependency.
+func (c *readinessChecker) Report(ctx context.Context) readinessReport {
+	report := readinessReport{Status: "unavailable", Providers: c.providerStatus(ctx)}
+	for _, provider := range report.Providers {
+		if provider.OK {
+			report.Status = "ready"
+			break
+		}
+	}
+	if c.store != nil {
+		pingCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		defer cancel()
+		status := dependencyStatus{Name: "postgres", OK: true, CheckedAt: c.now()}
+		if err := c.store.Ping(pingCtx); err != nil {
+			status.OK = false
+			status.Error = err.Error()
+			if report.Status == "ready" {
+				report.Status = "degraded"
+			}
+		}
+		report.Store = &status
+	}
+	return report
+}
+
+func (c *readinessChecker) providerStatus(ctx context.Context) []dependencyStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.providers != nil && c.now().Sub(c.checkedAt) < readyCheckInterval {
+		return c.providers
+	}
+
+	// A probe that gives up must not leave a cut-short check behind for the
+	// probes after it.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readyCheckTimeout)
+	defer cancel()
+	c.providers = c.chain.check(ctx, c.now)
+	c.checkedAt = c.now()
+	return c.providers
+}
+
+// check fetches a rate from each provider at once. Providers cooling down
+// after a 429 are reported as such and left alone.
+func (c *providerChain) check(ctx context.Context, now func() time.Time) []dependencyStatus {
+	statuses := make([]dependencyStatus, len(c.providers))
+	var wg sync.WaitGroup
+	for i, provider := range c.providers {
+		statuses[i] = dependencyStatus{Name: provider.Name()}
+		if until, ok := c.cooldown(provider.Name()); ok {
+			statuses[i].Error = fmt.Sprintf("rate limited until %s", until.Format(time.RFC3339))
+			statuses[i].CheckedAt = now()
+			continue
+		}
+		pair, ok := probePair(provider)
+		if !ok {
+			statuses[i].Error = "covers none of the probe pairs"
+			statuses[i].CheckedAt = now()
+			continue
+		}
+
+		wg.Add(1)
+		go func(status *dependencyStatus, provider RateProvider) {
+			defer wg.Done()
+			_, err := provider.FetchRate(ctx, pair.Base, pair.Target)
+			status.CheckedAt = now()
+			if err != nil {
+				var limited *rateLimitError
+				if errors.As(err, &limited) {
+					c.coolDown(provider.Name(), limited.retryAfter)
+				}
+				log.Printf("readiness check of %s failed: %v", provider.Name(), err)
+				status.Error = err.Error()
+				return
+			}
+			status.OK = true
+		}(&statuses[i], provider)
+	}
+	wg.Wait()
+	return statuses
+}
+
+func probePair(provider RateProvider) (ratePair, bool) {
+	for _, pair := range readyProbePairs {
+		if covers(provider, pair.Base, pair.Target) {
+			return pair, true
+		}
+	}
+	return ratePair{}, false
+}
+
+// readyHandler serves /readyz: 200 while a provider answers, even without
+// the store, whose rates are only a fallback, and 503 once none does.
+func readyHandler(checker *readinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		report := checker.Report(r.Context())
+		status := http.StatusOK
+		if report.Status == "unavailable" {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, status, report)
+	}
+}
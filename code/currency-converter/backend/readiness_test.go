@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type stubPinger struct{ err error }
+
+func (p stubPinger) Ping(context.Context) error { return p.err }
+
+func readyz(checker *readinessChecker) (int, readinessReport) {
+	res := httptest.NewRecorder()
+	readyHandler(checker)(res, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report readinessReport
+	_ = json.Unmarshal(res.Body.Bytes(), &report)
+	return res.Code, report
+}
+
+func TestReadinessCachesProviderChecks(t *testing.T) {
+	failing := &stubProvider{name: "yahoo-finance", err: errors.New("boom")}
+	working := &stubProvider{name: "frankfurter", rate: 0.92}
+	checker := newReadinessChecker(newProviderChain(failing, working), nil)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+
+	status, report := readyz(checker)
+	if status != http.StatusOK || report.Status != "ready" {
+		t.Fatalf("expected ready while a provider answers, got %d %+v", status, report)
+	}
+	if report.Providers[0].OK || report.Providers[0].Error != "boom" || !report.Providers[1].OK {
+		t.Fatalf("expected the status of each provider, got %+v", report.Providers)
+	}
+	if report.Store != nil {
+		t.Fatalf("expected no store status without persistence, got %+v", report.Store)
+	}
+
+	working.err = errors.New("down")
+	now = now.Add(readyCheckInterval / 2)
+	if status, _ := readyz(checker); status != http.StatusOK || working.calls != 1 {
+		t.Fatalf("expected the cached check to be reused, got status %d after %d calls", status, working.calls)
+	}
+
+	now = now.Add(readyCheckInterval)
+	status, report = readyz(checker)
+	if status != http.StatusServiceUnavailable || report.Status != "unavailable" || working.calls != 2 {
+		t.Fatalf("expected unavailable once every provider fails, got %d %+v after %d calls", status, report, working.calls)
+	}
+}
+
+func TestReadinessSkipsRateLimitedProviders(t *testing.T) {
+	limited := &stubProvider{name: "yahoo-finance", err: &rateLimitError{retryAfter: time.Minute}}
+	chain := newProviderChain(limited)
+	checker := newReadinessChecker(chain, nil)
+
+	checker.Report(context.Background())
+	checker.checkedAt = time.Time{}
+	report := checker.Report(context.Background())
+	if limited.calls != 1 || report.Providers[0].OK {
+		t.Fatalf("expected a provider cooling down to be left alone, got %d calls and %+v", limited.calls, report.Providers)
+	}
+}
+
+func TestReadinessReportsStore(t *testing.T) {
+	chain := newProviderChain(&stubProvider{name: "frankfurter", rate: 0.92})
+
+	status, report := readyz(newReadinessChecker(chain, stubPinger{}))
+	if status != http.StatusOK || report.Status != "ready" || report.Store == nil || !report.Store.OK {
+		t.Fatalf("expected ready with the store up, got %d %+v", status, report)
+	}
+
+	status, report = readyz(newReadinessChecker(chain, stubPinger{err: errors.New("connection refused")}))
+	if status != http.StatusOK || report.Status != "degraded" || report.Store.OK || report.Store.Error != "connection refused" {
+		t.Fatalf("expected degraded with the store down, got %d %+v", status, report)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshTimeout bounds the refresh of one pair.
+const refreshTimeout = 30 * time.Second
+
+type ratePair struct {
+	Base   string
+	Target string
+}
+
+func (p ratePair) String() string { return p.Base + "/" + p.Target }
+
+type refresherConfig struct {
+	pairs    []ratePair
+	interval time.Duration
+	// threshold is the change, in percent, a refreshed rate needs before it
+	// is pushed to streams. Zero pushes every change.
+	threshold float64
+}
+
+// loadRefresherConfig reads RATE_REFRESH_PAIRS, a comma-separated list such as
+// "USD/IDR,EUR/USD", RATE_REFRESH_INTERVAL, and RATE_STREAM_THRESHOLD. No
+// pairs leaves the refresher off.
+func loadRefresherConfig() (refresherConfig, error) {
+	config := refresherConfig{interval: 5 * time.Minute}
+	if value := os.Getenv("RATE_REFRESH_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return refresherConfig{}, fmt.Errorf("RATE_REFRESH_INTERVAL must be a positive duration such as 5m, got %q", value)
+		}
+		config.interval = d
+	}
+	if value := os.Getenv("RATE_STREAM_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 {
+			return refresherConfig{}, fmt.Errorf("RATE_STREAM_THRESHOLD must be a percentage such as 0.1, got %q", value)
+		}
+		config.threshold = threshold
+	}
+
+	for _, item := range strings.Split(os.Getenv("RATE_REFRESH_PAIRS"), ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pair, err := parsePair(item)
+		if err != nil {
+			return refresherConfig{}, fmt.Errorf("RATE_REFRESH_PAIRS: %w", err)
+		}
+		config.pairs = append(config.pairs, pair)
+	}
+	return config, nil
+}
+
+type pairStatus struct {
+	Base        string     `json:"base"`
+	Target      string     `json:"target"`
+	Rate        float64    `json:"rate,omitempty"`
+	Source      string     `json:"source,omitempty"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// Failures counts the refreshes that failed in a row.
+	Failures int `json:"failures"`
+}
+
+// rateRefresher fetches a fixed set of pairs on an interval, keeping them warm
+// in the cache and, with a store, adding to their history. Rates that move
+// past the threshold are published to updates.
+type rateRefresher struct {
+	config  refresherConfig
+	refresh func(ctx context.Context, base, target string) (rateQuote, error)
+	updates *rateBroadcaster
+	// onRefresh, when set, sees every successful refresh.
+	onRefresh func(pair ratePair, quote rateQuote)
+
+	mu      sync.Mutex
+	running bool
+	lastRun time.Time
+	nextRun time.Time
+	pairs   []pairStatus
+	// published is the last rate of each pair pushed to streams.
+	published []float64
+}
+
+func newRateRefresher(config refresherConfig, refresh func(ctx context.Context, base, target string) (rateQuote, error)) *rateRefresher {
+	pairs := make([]pairStatus, len(config.pairs))
+	for i, pair := range config.pairs {
+		pairs[i] = pairStatus{Base: pair.Base, Target: pair.Target}
+	}
+	return &rateRefresher{
+		config:    config,
+		refresh:   refresh,
+		updates:   newRateBroadcaster(),
+		pairs:     pairs,
+		published: make([]float64, len(config.pairs)),
+	}
+}
+
+// Run refreshes every pair at once and then on each tick, until ctx is done.
+func (r *rateRefresher) Run(ctx context.Context) {
+	r.mu.Lock()
+	r.running = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.nextRun = time.Time{}
+		r.mu.Unlock()
+	}()
+
+	log.Printf("refreshing %d rate pairs every %s", len(r.config.pairs), r.config.interval)
+	ticker := time.NewTicker(r.config.interval)
+	defer ticker.Stop()
+	for {
+		r.refreshAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *rateRefresher) refreshAll(ctx context.Context) {
+	for i, pair := range r.config.pairs {
+		pairCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		quote, err := r.refresh(pairCtx, pair.Base, pair.Target)
+		cancel()
+
+		r.mu.Lock()
+		status := &r.pairs[i]
+		if err != nil {
+			log.Printf("scheduled refresh of %s failed: %v", pair, err)
+			status.LastError = err.Error()
+			status.Failures++
+			r.mu.Unlock()
+			continue
+		}
+		refreshedAt := quote.FetchedAt.UTC()
+		status.Rate, status.Source, status.RefreshedAt = quote.Rate, quote.Source, &refreshedAt
+		status.LastError, status.Failures = "", 0
+		previous := r.published[i]
+		changed := r.changed(previous, quote.Rate)
+		if changed {
+			r.published[i] = quote.Rate
+		}
+		r.mu.Unlock()
+
+		if changed {
+			r.updates.publish(rateUpdate{
+				Base:      pair.Base,
+				Target:    pair.Target,
+				Rate:      quote.Rate,
+				Previous:  previous,
+				Source:    quote.Source,
+				FetchedAt: refreshedAt,
+			})
+		}
+		if r.onRefresh != nil {
+			r.onRefresh(pair, quote)
+		}
+	}
+
+	r.mu.Lock()
+	r.lastRun = time.Now().UTC()
+	r.nextRun = r.lastRun.Add(r.config.interval)
+	r.mu.Unlock()
+}
+
+// changed reports whether rate moved past the threshold from previous, the
+// last published rate. The first rate of a pair always counts.
+func (r *rateRefresher) changed(previous, rate float64) bool {
+	if previous == 0 {
+		return true
+	}
+	if rate == previous {
+		return false
+	}
+	return math.Abs(rate-previous)/previous*100 >= r.config.threshold
+}
+
+func (r *rateRefresher) refreshes(pair ratePair) bool {
+	for _, refreshed := range r.config.pairs {
+		if refreshed == pair {
+			return true
+		}
+	}
+	return false
+}
+
+// latest returns the last refreshed rate of each of pairs that has one.
+func (r *rateRefresher) latest(pairs []ratePair) []rateUpdate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var updates []rateUpdate
+	for _, pair := range pairs {
+		for _, status := range r.pairs {
+			if status.Base == pair.Base && status.Target == pair.Target && status.RefreshedAt != nil {
+				updates = append(updates, rateUpdate{
+					Base:      status.Base,
+					Target:    status.Target,
+					Rate:      status.Rate,
+					Source:    status.Source,
+					FetchedAt: *status.RefreshedAt,
+				})
+			}
+		}
+	}
+	return updates
+}
+
+type refresherStatus struct {
+	Enabled  bool         `json:"enabled"`
+	Running  bool         `json:"running"`
+	Interval string       `json:"interval,omitempty"`
+	LastRun  *time.Time   `json:"last_run,omitempty"`
+	NextRun  *time.Time   `json:"next_run,omitempty"`
+	Pairs    []pairStatus `json:"pairs"`
+}
+
+// Status reports the refresher's schedule and the last refresh of each pair.
+// A nil refresher is reported as disabled.
+func (r *rateRefresher) Status() refresherStatus {
+	if r == nil {
+		return refresherStatus{Pairs: []pairStatus{}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := refresherStatus{
+		Enabled:  true,
+		Running:  r.running,
+		Interval: r.config.interval.String(),
+		Pairs:    append([]pairStatus(nil), r.pairs...),
+	}
+	if !r.lastRun.IsZero() {
+		lastRun := r.lastRun
+		status.LastRun = &lastRun
+	}
+	if !r.nextRun.IsZero() {
+		nextRun := r.nextRun
+		status.NextRun = &nextRun
+	}
+	return status
+}
+
+func refresherStatusHandler(refresher *rateRefresher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(refresher.Status()); err != nil {
+			log.Printf("failed to encode response: %v", err)
+		}
+	}
+}
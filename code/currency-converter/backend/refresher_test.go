@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadRefresherConfig(t *testing.T) {
+	t.Setenv("RATE_REFRESH_PAIRS", "usd/idr, EUR/USD")
+	t.Setenv("RATE_REFRESH_INTERVAL", "1m")
+	config, err := loadRefresherConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.pairs) != 2 || config.pairs[0] != (ratePair{Base: "USD", Target: "IDR"}) || config.interval != time.Minute {
+		t.Fatalf("expected two pairs every minute, got %+v", config)
+	}
+
+	for _, pairs := range []string{"USD", "USD/USS"} {
+		t.Setenv("RATE_REFRESH_PAIRS", pairs)
+		if _, err := loadRefresherConfig(); err == nil {
+			t.Fatalf("expected an error for %q", pairs)
+		}
+	}
+}
+
+func TestRateRefresherKeepsCacheWarm(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+	upstream := &fakeUpstream{rate: 16250}
+	cache := newTestCache(cacheConfig{ttl: time.Minute}, upstream, &now)
+	config := refresherConfig{pairs: []ratePair{{Base: "USD", Target: "IDR"}}, interval: time.Hour}
+	refresher := newRateRefresher(config, cache.Refresh)
+
+	refresher.refreshAll(context.Background())
+	if _, err := cache.Quote(context.Background(), "USD", "IDR"); err != nil || upstream.callCount() != 1 {
+		t.Fatalf("expected the refreshed rate served from the cache, got %d fetches (%v)", upstream.callCount(), err)
+	}
+
+	upstream.err = errors.New("upstream down")
+	refresher.refreshAll(context.Background())
+	status := refresher.Status()
+	pair := status.Pairs[0]
+	if !status.Enabled || pair.Rate != 16250 || pair.Failures != 1 || pair.LastError == "" || status.NextRun == nil {
+		t.Fatalf("expected the last good rate and one failure, got %+v", status)
+	}
+}
+
+func TestRefresherStatusRequiresAdmin(t *testing.T) {
+	handler := requireAdmin(refresherStatusHandler(nil))
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		wantStatus int
+	}{
+		{name: "disabled without ADMIN_TOKEN", header: "Bearer anything", wantStatus: http.StatusForbidden},
+		{name: "missing token", adminToken: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", adminToken: "secret", header: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "admin", adminToken: "secret", header: "Bearer secret", wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ADMIN_TOKEN", tc.adminToken)
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/refresher", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			res := httptest.NewRecorder()
+
+			handler(res, req)
+
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, res.Code)
+			}
+			if tc.wantStatus == http.StatusOK {
+				var status refresherStatus
+				if err := json.NewDecoder(res.Body).Decode(&status); err != nil || status.Enabled {
+					t.Fatalf("expected a disabled refresher, got %+v (%v)", status, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// readHeaderTimeout and readTimeout bound how long a client may take to
+	// send a request, so slow clients cannot hold connections open.
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	// writeTimeout bounds a response. It covers the upstream timeout with
+	// room to spare; streams extend their own deadline as they write.
+	writeTimeout = 30 * time.Second
+	// idleTimeout closes keep-alive connections left unused.
+	idleTimeout = 2 * time.Minute
+	// maxHeaderBytes caps request headers, in bytes.
+	maxHeaderBytes = 64 << 10
+	// shutdownTimeout is how long requests in flight get to finish on
+	// shutdown, within the 30 seconds Docker and Kubernetes wait by default.
+	shutdownTimeout = 25 * time.Second
+)
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+}
+
+// serve runs server on listener until ctx is done, then stops taking
+// connections and waits up to shutdownTimeout for requests in flight.
+func serve(ctx context.Context, server *http.Server, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, draining requests for up to %s", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
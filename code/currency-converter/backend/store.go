@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// storeTimeout bounds a write or lookup so a slow database does not hold up
+// a conversion.
+const storeTimeout = 2 * time.Second
+
+// rateStore keeps every fetched rate, so the last known one can be served
+// when no provider answers.
+type rateStore interface {
+	Save(ctx context.Context, base, target string, quote rateQuote) error
+	// Latest returns the newest rate for the pair, or false when there is none.
+	Latest(ctx context.Context, base, target string) (rateQuote, bool, error)
+}
+
+type postgresStore struct {
+	db *sql.DB
+}
+
+// openRateStore connects to DATABASE_URL. It returns nil when the variable is
+// unset, which leaves persistence off.
+func openRateStore() (rateStore, error) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return nil, nil
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS rates (
+			base       TEXT NOT NULL,
+			target     TEXT NOT NULL,
+			rate       DOUBLE PRECISION NOT NULL,
+			source     TEXT NOT NULL,
+			fetched_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS rates_pair_fetched_at ON rates (base, target, fetched_at DESC);
+		CREATE TABLE IF NOT EXISTS api_keys (
+			name        TEXT PRIMARY KEY,
+			key_sha256  TEXT NOT NULL UNIQUE,
+			daily_quota INTEGER,
+			rate_limit  INTEGER
+		);
+		CREATE TABLE IF NOT EXISTS daily_rates (
+			date       DATE NOT NULL,
+			base       TEXT NOT NULL,
+			target     TEXT NOT NULL,
+			rate       DOUBLE PRECISION NOT NULL,
+			source     TEXT NOT NULL,
+			fetched_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (base, date, target)
+		);
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+	return postgresStore{db: db}, nil
+}
+
+func (s postgresStore) Save(ctx context.Context, base, target string, quote rateQuote) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO rates (base, target, rate, source, fetched_at) VALUES ($1, $2, $3, $4, $5)`,
+		base, target, quote.Rate, quote.Source, quote.FetchedAt)
+	return err
+}
+
+func (s postgresStore) Latest(ctx context.Context, base, target string) (rateQuote, bool, error) {
+	var quote rateQuote
+	err := s.db.QueryRowContext(ctx,
+		`SELECT rate, source, fetched_at FROM rates WHERE base = $1 AND target = $2 ORDER BY fetched_at DESC LIMIT 1`,
+		base, target).Scan(&quote.Rate, &quote.Source, &quote.FetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rateQuote{}, false, nil
+	}
+	if err != nil {
+		return rateQuote{}, false, err
+	}
+	return quote, true, nil
+}
+
+func (s postgresStore) Name() string { return "stored" }
+
+func (s postgresStore) Ping(ctx context.Context) error { return s.db.PingContext(ctx) }
+
+// FetchHistory reads the last stored rate of each hour since since.
+func (s postgresStore) FetchHistory(ctx context.Context, base, target string, since time.Time) ([]historyPoint, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (date_trunc('hour', fetched_at)) fetched_at, rate
+		FROM rates
+		WHERE base = $1 AND target = $2 AND fetched_at >= $3
+		ORDER BY date_trunc('hour', fetched_at), fetched_at DESC`,
+		base, target, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []historyPoint
+	for rows.Next() {
+		var point historyPoint
+		if err := rows.Scan(&point.At, &point.Rate); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// APIKeys reads the api_keys table. Keys are stored as the hex SHA-256 of
+// the key; a null quota or limit is returned as -1, for the default.
+func (s postgresStore) APIKeys(ctx context.Context) ([]apiKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, key_sha256, COALESCE(daily_quota, -1), COALESCE(rate_limit, -1)
+		FROM api_keys`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []apiKey
+	for rows.Next() {
+		var key apiKey
+		if err := rows.Scan(&key.Name, &key.hash, &key.DailyQuota, &key.RateLimit); err != nil {
+			return nil, err
+		}
+		key.hash = strings.ToLower(key.hash)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// recordRates saves every rate fetch returns. A failed save is logged and
+// does not fail the fetch.
+func recordRates(store rateStore, fetch func(ctx context.Context, base, target string) (float64, string, error)) func(ctx context.Context, base, target string) (float64, string, error) {
+	return func(ctx context.Context, base, target string) (float64, string, error) {
+		rate, source, err := fetch(ctx, base, target)
+		if err != nil {
+			return rate, source, err
+		}
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+		defer cancel()
+		if err := store.Save(saveCtx, base, target, rateQuote{Rate: rate, Source: source, FetchedAt: time.Now()}); err != nil {
+			log.Printf("failed to save %s/%s rate: %v", base, target, err)
+		}
+		return rate, source, nil
+	}
+}
+
+// withOfflineFallback answers from the last stored rate when quote fails. The
+// rate is marked stale with source "cache", and keeps its original fetch time
+// so its age shows how old it is.
+func withOfflineFallback(store rateStore, quote func(ctx context.Context, base, target string) (rateQuote, error)) func(ctx context.Context, base, target string) (rateQuote, error) {
+	return func(ctx context.Context, base, target string) (rateQuote, error) {
+		live, err := quote(ctx, base, target)
+		if err == nil {
+			return live, nil
+		}
+		// A caller that went away has no use for the stored rate.
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return rateQuote{}, err
+		}
+
+		lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+		defer cancel()
+		stored, ok, lookupErr := store.Latest(lookupCtx, base, target)
+		if lookupErr != nil {
+			log.Printf("failed to look up stored %s/%s rate: %v", base, target, lookupErr)
+			return rateQuote{}, err
+		}
+		if !ok {
+			return rateQuote{}, err
+		}
+		log.Printf("serving the stored %s/%s rate from %s: %v", base, target, stored.FetchedAt.Format(time.RFC3339), err)
+		stored.Source = "cache"
+		stored.Stale = true
+		return stored, nil
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps saved rates in a slice, newest last.
+type memoryStore struct {
+	mu     sync.Mutex
+	quotes map[string][]rateQuote
+	err    error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{quotes: map[string][]rateQuote{}}
+}
+
+func (s *memoryStore) Save(_ context.Context, base, target string, quote rateQuote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotes[base+"/"+target] = append(s.quotes[base+"/"+target], quote)
+	return s.err
+}
+
+func (s *memoryStore) Latest(_ context.Context, base, target string) (rateQuote, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return rateQuote{}, false, s.err
+	}
+	quotes := s.quotes[base+"/"+target]
+	if len(quotes) == 0 {
+		return rateQuote{}, false, nil
+	}
+	return quotes[len(quotes)-1], true, nil
+}
+
+func TestRecordRatesSavesEveryFetch(t *testing.T) {
+	store := newMemoryStore()
+	upstream := &fakeUpstream{rate: 16250}
+	fetch := recordRates(store, upstream.fetch)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := fetch(context.Background(), "USD", "IDR"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if saved := store.quotes["USD/IDR"]; len(saved) != 2 || saved[1].Rate != 16250 || saved[1].Source != "frankfurter" {
+		t.Fatalf("expected both fetches saved, got %+v", saved)
+	}
+
+	store.err = errors.New("database down")
+	if rate, _, err := fetch(context.Background(), "USD", "IDR"); err != nil || rate != 16250 {
+		t.Fatalf("expected the rate despite a failed save, got %f (%v)", rate, err)
+	}
+}
+
+func TestOfflineFallbackServesStoredRate(t *testing.T) {
+	store := newMemoryStore()
+	fetchedAt := time.Now().Add(-3 * time.Hour)
+	store.Save(context.Background(), "USD", "IDR", rateQuote{Rate: 16200, Source: "frankfurter", FetchedAt: fetchedAt})
+
+	offline := func(context.Context, string, string) (rateQuote, error) {
+		return rateQuote{}, errors.New("upstream unreachable")
+	}
+	quote, err := withOfflineFallback(store, offline)(context.Background(), "USD", "IDR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quote.Rate != 16200 || quote.Source != "cache" || !quote.Stale || !quote.FetchedAt.Equal(fetchedAt) {
+		t.Fatalf("expected the stored rate marked as cache, got %+v", quote)
+	}
+
+	if _, err := withOfflineFallback(store, offline)(context.Background(), "USD", "SGD"); err == nil {
+		t.Fatalf("expected an error when no rate is stored for the pair")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamHeartbeat keeps idle streams from being closed by proxies.
+const streamHeartbeat = 15 * time.Second
+
+// streamWriteTimeout bounds each write to a stream. The server's write timeout
+// would cut streams off, so they push their deadline forward as they go.
+const streamWriteTimeout = 30 * time.Second
+
+// streamBuffer is how many updates a slow client can fall behind before
+// updates to it are dropped.
+const streamBuffer = 16
+
+// rateUpdate is pushed to streams when a refreshed rate moves past the
+// change threshold.
+type rateUpdate struct {
+	Base      string    `json:"base"`
+	Target    string    `json:"target"`
+	Rate      float64   `json:"rate"`
+	Previous  float64   `json:"previous,omitempty"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// rateBroadcaster fans rate updates out to the streams subscribed to the pair.
+type rateBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan rateUpdate]map[ratePair]bool
+	// closed is set on shutdown; streams subscribing after it end at once.
+	closed bool
+}
+
+func newRateBroadcaster() *rateBroadcaster {
+	return &rateBroadcaster{subscribers: map[chan rateUpdate]map[ratePair]bool{}}
+}
+
+func (b *rateBroadcaster) subscribe(pairs []ratePair) chan rateUpdate {
+	set := map[ratePair]bool{}
+	for _, pair := range pairs {
+		set[pair] = true
+	}
+	updates := make(chan rateUpdate, streamBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(updates)
+		return updates
+	}
+	b.subscribers[updates] = set
+	return updates
+}
+
+func (b *rateBroadcaster) unsubscribe(updates chan rateUpdate) {
+	b.mu.Lock()
+	delete(b.subscribers, updates)
+	b.mu.Unlock()
+}
+
+// close ends every stream, which would otherwise hold a shutting down server
+// open until its clients leave.
+func (b *rateBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for updates := range b.subscribers {
+		close(updates)
+		delete(b.subscribers, updates)
+	}
+}
+
+func (b *rateBroadcaster) publish(update rateUpdate) {
+	pair := ratePair{Base: update.Base, Target: update.Target}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for updates, pairs := range b.subscribers {
+		if !pairs[pair] {
+			continue
+		}
+		select {
+		case updates <- update:
+		default:
+			log.Printf("dropping a %s update for a slow stream", pair)
+		}
+	}
+}
+
+// parseStreamPairs reads pairs such as "USDIDR,EURUSD"; "USD/IDR" and
+// "BTC-USD" also work.
+func parseStreamPairs(value string) ([]ratePair, error) {
+	var pairs []ratePair
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pair, err := parsePair(item)
+		if err != nil {
+			return nil, &paramError{Field: "pairs", Message: err.Error()}
+		}
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		return nil, &paramError{Field: "pairs", Message: "query parameter is required"}
+	}
+	return pairs, nil
+}
+
+// streamHandler serves Server-Sent Events: a "rate" event with the latest
+// known rate of each pair on connect, then one whenever the refresher sees a
+// pair move past the change threshold.
+func streamHandler(refresher *rateRefresher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if refresher == nil {
+			writeError(w, http.StatusServiceUnavailable, "refresher_disabled", "streaming needs the background refresher, set RATE_REFRESH_PAIRS")
+			return
+		}
+		pairs, err := parseStreamPairs(r.URL.Query().Get("pairs"))
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		for _, pair := range pairs {
+			if !refresher.refreshes(pair) {
+				writeBadRequest(w, &paramError{Field: "pairs", Message: fmt.Sprintf("%s is not refreshed, add it to RATE_REFRESH_PAIRS", pair)})
+				return
+			}
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming_unsupported", "streaming unsupported")
+			return
+		}
+
+		updates := refresher.updates.subscribe(pairs)
+		defer refresher.updates.unsubscribe(updates)
+
+		control := http.NewResponseController(w)
+		// Writers that cannot set deadlines are not under the server's
+		// timeouts either.
+		extendDeadline := func() { _ = control.SetWriteDeadline(time.Now().Add(streamWriteTimeout)) }
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		extendDeadline()
+		w.WriteHeader(http.StatusOK)
+
+		for _, update := range refresher.latest(pairs) {
+			if err := writeRateEvent(w, update); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				extendDeadline()
+				if err := writeRateEvent(w, update); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				extendDeadline()
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeRateEvent(w http.ResponseWriter, update rateUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: rate\ndata: %s\n\n", data)
+	return err
+}
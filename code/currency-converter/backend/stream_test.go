@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStreamPairs(t *testing.T) {
+	pairs, err := parseStreamPairs("usdidr, EUR/USD")
+	if err != nil || len(pairs) != 2 || pairs[1] != (ratePair{Base: "EUR", Target: "USD"}) {
+		t.Fatalf("expected USD/IDR and EUR/USD, got %+v (%v)", pairs, err)
+	}
+	for _, value := range []string{"", "USDID", "USSIDR"} {
+		if _, err := parseStreamPairs(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestRateRefresherPublishesChangesPastThreshold(t *testing.T) {
+	upstream := &fakeUpstream{rate: 16000}
+	config := refresherConfig{pairs: []ratePair{{Base: "USD", Target: "IDR"}}, interval: time.Hour, threshold: 0.5}
+	refresher := newRateRefresher(config, newRateCache(cacheConfig{}, upstream.fetch).Refresh)
+	updates := refresher.updates.subscribe(config.pairs)
+
+	for _, rate := range []float64{16000, 16050, 16100} {
+		upstream.rate = rate
+		refresher.refreshAll(context.Background())
+	}
+
+	// 16050 is within 0.5% of 16000; 16100 is not.
+	for _, want := range []struct{ rate, previous float64 }{{16000, 0}, {16100, 16000}} {
+		select {
+		case update := <-updates:
+			if update.Rate != want.rate || update.Previous != want.previous {
+				t.Fatalf("expected %v after %v, got %+v", want.rate, want.previous, update)
+			}
+		default:
+			t.Fatalf("expected an update to %v", want.rate)
+		}
+	}
+	if len(updates) != 0 {
+		t.Fatalf("expected no update for a change within the threshold, got %+v", <-updates)
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	upstream := &fakeUpstream{rate: 16000}
+	config := refresherConfig{pairs: []ratePair{{Base: "USD", Target: "IDR"}}, interval: time.Hour}
+	refresher := newRateRefresher(config, newRateCache(cacheConfig{}, upstream.fetch).Refresh)
+	refresher.refreshAll(context.Background())
+	server := httptest.NewServer(streamHandler(refresher))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "?pairs=EURUSD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a pair that is not refreshed, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?pairs=USDIDR", nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", res.Header.Get("Content-Type"))
+	}
+
+	events := bufio.NewScanner(res.Body)
+	readData := func() string {
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatalf("stream ended: %v", events.Err())
+		return ""
+	}
+	if data := readData(); !strings.Contains(data, `"rate":16000`) {
+		t.Fatalf("expected the current rate on connect, got %s", data)
+	}
+
+	upstream.rate = 16100
+	refresher.refreshAll(context.Background())
+	if data := readData(); !strings.Contains(data, `"rate":16100`) || !strings.Contains(data, `"previous":16000`) {
+		t.Fatalf("expected the pushed update, got %s", data)
+	}
+
+	refresher.updates.close()
+	for events.Scan() {
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected closing the broadcaster to end the stream")
+	}
+	if _, ok := <-refresher.updates.subscribe(config.pairs); ok {
+		t.Fatal("expected a closed broadcaster to end new streams")
+	}
+}
+
+func TestStreamHandlerNeedsRefresher(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/stream?pairs=USDIDR", nil)
+	res := httptest.NewRecorder()
+
+	streamHandler(nil)(res, req)
+
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, res.Code)
+	}
+}
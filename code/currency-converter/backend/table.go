@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTableTargets caps the currencies one table can ask for.
+	maxTableTargets = 50
+	// tableConcurrency is how many rates of a table are fetched at once.
+	tableConcurrency = 8
+)
+
+type tableRate struct {
+	Target    string     `json:"target"`
+	Rate      float64    `json:"rate,omitempty"`
+	Source    string     `json:"source,omitempty"`
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+	Age       int        `json:"age,omitempty"`
+	Stale     bool       `json:"stale,omitempty"`
+	// Error is set instead of the rate when it could not be fetched.
+	Error string `json:"error,omitempty"`
+}
+
+type tableResponse struct {
+	Base  string      `json:"base"`
+	Rates []tableRate `json:"rates"`
+	// Code says why the table failed, when no rate could be fetched.
+	Code string `json:"code,omitempty"`
+}
+
+// tableHandler returns the rate from base to each of targets, in the order
+// asked for. A rate that cannot be fetched gets an error of its own; the
+// table fails only when none can be, with 504 when every fetch timed out.
+func tableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	base := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("base")))
+	if base == "" {
+		writeBadRequest(w, &paramError{Field: "base", Message: "query parameter is required"})
+		return
+	}
+	if err := validateCurrency("base", base); err != nil {
+		writeBadRequest(w, err)
+		return
+	}
+
+	var targets []string
+	seen := map[string]bool{base: true}
+	for _, target := range strings.Split(r.URL.Query().Get("targets"), ",") {
+		target = strings.ToUpper(strings.TrimSpace(target))
+		if target == "" || seen[target] {
+			continue
+		}
+		if err := validateCurrency("targets", target); err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		writeBadRequest(w, &paramError{Field: "targets", Message: "query parameter is required"})
+		return
+	}
+	if len(targets) > maxTableTargets {
+		writeBadRequest(w, &paramError{Field: "targets", Message: fmt.Sprintf("at most %d currencies", maxTableTargets)})
+		return
+	}
+
+	rates := make([]tableRate, len(targets))
+	errs := make([]error, len(targets))
+	slots := make(chan struct{}, tableConcurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			rates[i] = tableRate{Target: target}
+			quote, err := rateFetcher(r.Context(), base, target)
+			if err != nil {
+				log.Printf("failed to fetch %s/%s rate for table: %v", base, target, err)
+				_, failure := upstreamError(err)
+				rates[i].Error = failure.Message
+				errs[i] = err
+				return
+			}
+			fetchedAt := quote.FetchedAt.UTC()
+			rates[i].Rate = quote.Rate
+			rates[i].Source = quote.Source
+			rates[i].FetchedAt = &fetchedAt
+			rates[i].Age = int(time.Since(quote.FetchedAt).Seconds())
+			rates[i].Stale = quote.Stale
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			writeJSON(w, http.StatusOK, tableResponse{Base: base, Rates: rates})
+			return
+		}
+	}
+	status, failure := upstreamError(errors.Join(errs...))
+	writeJSON(w, status, tableResponse{Base: base, Rates: rates, Code: failure.Code})
+}
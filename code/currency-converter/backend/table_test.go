@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTableHandler(t *testing.T) {
+	var calls atomic.Int32
+	originalFetcher := rateFetcher
+	rateFetcher = func(_ context.Context, base, target string) (rateQuote, error) {
+		calls.Add(1)
+		switch target {
+		case "IDR":
+			return rateQuote{Rate: 16250, Source: "frankfurter", FetchedAt: time.Now()}, nil
+		case "JPY":
+			return rateQuote{Rate: 151.2, Source: "yahoo-finance", FetchedAt: time.Now()}, nil
+		}
+		return rateQuote{}, errors.New("boom")
+	}
+	defer func() { rateFetcher = originalFetcher }()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/table?base=usd&targets=IDR,jpy,EUR,IDR,USD", nil)
+	res := httptest.NewRecorder()
+
+	tableHandler(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var payload tableResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Base != "USD" || len(payload.Rates) != 3 || calls.Load() != 3 {
+		t.Fatalf("expected three distinct targets fetched once each, got %+v after %d fetches", payload, calls.Load())
+	}
+	if payload.Rates[0].Target != "IDR" || payload.Rates[0].Rate != 16250 || payload.Rates[1].Rate != 151.2 {
+		t.Fatalf("expected the rates in the order asked for, got %+v", payload.Rates)
+	}
+	if payload.Rates[2].Target != "EUR" || payload.Rates[2].Error == "" || payload.Rates[2].Rate != 0 {
+		t.Fatalf("expected an error for EUR alone, got %+v", payload.Rates[2])
+	}
+}
+
+func TestTableHandlerErrors(t *testing.T) {
+	originalFetcher := rateFetcher
+	rateFetcher = func(context.Context, string, string) (rateQuote, error) {
+		return rateQuote{}, errors.New("boom")
+	}
+	defer func() { rateFetcher = originalFetcher }()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{name: "missing targets", url: "/api/table?base=USD", wantStatus: http.StatusBadRequest},
+		{name: "unknown target", url: "/api/table?base=USD&targets=IDR,USS", wantStatus: http.StatusBadRequest},
+		{name: "every rate fails", url: "/api/table?base=USD&targets=IDR,JPY", wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			tableHandler(res, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, res.Code)
+			}
+		})
+	}
+}
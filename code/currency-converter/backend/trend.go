@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// trendWindow is how far back history is read for changes and sparklines.
+	trendWindow = 30 * 24 * time.Hour
+	// trendTimeout bounds the history lookup, which a conversion waits for.
+	trendTimeout = 3 * time.Second
+	// historyTTL is how long a pair's history is reused, and historyRetry how
+	// long a failure to read it is.
+	historyTTL   = 15 * time.Minute
+	historyRetry = time.Minute
+)
+
+type historyPoint struct {
+	At   time.Time
+	Rate float64
+}
+
+// historyProvider returns a pair's past rates since a time, oldest first.
+type historyProvider interface {
+	Name() string
+	FetchHistory(ctx context.Context, base, target string, since time.Time) ([]historyPoint, error)
+}
+
+type sparkPoint struct {
+	Date string  `json:"date"`
+	Rate float64 `json:"rate"`
+}
+
+// rateTrend is how a rate has moved. A change is left out when the history
+// does not reach back far enough.
+type rateTrend struct {
+	Change24h *float64     `json:"change_24h,omitempty"`
+	Change7d  *float64     `json:"change_7d,omitempty"`
+	Change30d *float64     `json:"change_30d,omitempty"`
+	Sparkline []sparkPoint `json:"sparkline"`
+	Source    string       `json:"source"`
+}
+
+type cachedHistory struct {
+	points    []historyPoint
+	source    string
+	err       error
+	fetchedAt time.Time
+}
+
+// trendService reads history from the first source that covers the trend
+// window, or the one that reaches furthest back.
+type trendService struct {
+	sources []historyProvider
+	now     func() time.Time
+
+	mu     sync.Mutex
+	cached map[string]cachedHistory
+}
+
+func newTrendService(sources ...historyProvider) *trendService {
+	return &trendService{sources: sources, now: time.Now, cached: map[string]cachedHistory{}}
+}
+
+// Trend compares current with the pair's history.
+func (s *trendService) Trend(ctx context.Context, base, target string, current float64) (*rateTrend, error) {
+	history, err := s.history(ctx, base, target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	trend := &rateTrend{Source: history.source}
+	for _, change := range []struct {
+		ago time.Duration
+		to  **float64
+	}{
+		{24 * time.Hour, &trend.Change24h},
+		{7 * 24 * time.Hour, &trend.Change7d},
+		{30 * 24 * time.Hour, &trend.Change30d},
+	} {
+		if past, ok := rateAt(history.points, now.Add(-change.ago)); ok {
+			percent := math.Round((current-past)/past*10000) / 100
+			*change.to = &percent
+		}
+	}
+	trend.Sparkline = sparkline(history.points, now, current)
+	return trend, nil
+}
+
+func (s *trendService) history(ctx context.Context, base, target string) (cachedHistory, error) {
+	key := base + "/" + target
+	s.mu.Lock()
+	cached, ok := s.cached[key]
+	s.mu.Unlock()
+	if ok && cached.err == nil && s.now().Sub(cached.fetchedAt) < historyTTL {
+		return cached, nil
+	}
+	if ok && cached.err != nil && s.now().Sub(cached.fetchedAt) < historyRetry {
+		return cachedHistory{}, cached.err
+	}
+
+	since := s.now().Add(-trendWindow)
+	var (
+		best cachedHistory
+		errs []error
+	)
+	for _, source := range s.sources {
+		if provider, ok := source.(RateProvider); ok && !covers(provider, base, target) {
+			continue
+		}
+		points, err := source.FetchHistory(ctx, base, target, since)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if len(points) == 0 {
+			continue
+		}
+		if best.points == nil || points[0].At.Before(best.points[0].At) {
+			best = cachedHistory{points: points, source: source.Name()}
+		}
+		// A day of slack allows for weekends and daily closing times.
+		if !points[0].At.After(since.Add(24 * time.Hour)) {
+			break
+		}
+	}
+	if best.points == nil {
+		if len(errs) == 0 {
+			errs = append(errs, errors.New("no history"))
+		}
+		best.err = errors.Join(errs...)
+	}
+
+	best.fetchedAt = s.now()
+	s.mu.Lock()
+	s.cached[key] = best
+	s.mu.Unlock()
+	return best, best.err
+}
+
+// rateAt is the last rate at or before t.
+func rateAt(points []historyPoint, t time.Time) (float64, bool) {
+	i := sort.Search(len(points), func(i int) bool { return points[i].At.After(t) })
+	if i == 0 {
+		return 0, false
+	}
+	return points[i-1].Rate, true
+}
+
+// sparkline keeps the last rate of each UTC day, ending with current today.
+func sparkline(points []historyPoint, now time.Time, current float64) []sparkPoint {
+	today := now.UTC().Format(time.DateOnly)
+	var series []sparkPoint
+	for _, point := range points {
+		date := point.At.UTC().Format(time.DateOnly)
+		if date == today {
+			break
+		}
+		if n := len(series); n > 0 && series[n-1].Date == date {
+			series[n-1].Rate = point.Rate
+			continue
+		}
+		series = append(series, sparkPoint{Date: date, Rate: point.Rate})
+	}
+	return append(series, sparkPoint{Date: today, Rate: current})
+}
+
+// trendFetcher adds trend data to conversions; nil leaves it out.
+var trendFetcher func(ctx context.Context, base, target string, current float64) (*rateTrend, error)
+
+// lookupTrend is best effort: a conversion without trend data beats a failed
+// or slow one.
+func lookupTrend(ctx context.Context, base, target string, current float64) *rateTrend {
+	if trendFetcher == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, trendTimeout)
+	defer cancel()
+	trend, err := trendFetcher(ctx, base, target, current)
+	if err != nil {
+		log.Printf("no trend for %s/%s: %v", base, target, err)
+		return nil
+	}
+	return trend
+}
+
+func (p yahooProvider) FetchHistory(ctx context.Context, base, target string, since time.Time) ([]historyPoint, error) {
+	return p.dailyCloses(ctx, base, target, since, time.Now())
+}
+
+// dailyCloses reads the pair's daily closing rates between from and to.
+func (p yahooProvider) dailyCloses(ctx context.Context, base, target string, from, to time.Time) ([]historyPoint, error) {
+	query := url.Values{
+		"period1":  {fmt.Sprint(from.Unix())},
+		"period2":  {fmt.Sprint(to.Unix())},
+		"interval": {"1d"},
+	}
+	symbol, invert := yahooSymbol(base, target)
+	endpoint := fmt.Sprintf("%s/v8/finance/chart/%s?%s", p.baseURL, url.PathEscape(symbol), query.Encode())
+
+	var payload struct {
+		Chart struct {
+			Result []struct {
+				Timestamp  []int64 `json:"timestamp"`
+				Indicators struct {
+					Quote []struct {
+						Close []*float64 `json:"close"`
+					} `json:"quote"`
+				} `json:"indicators"`
+			} `json:"result"`
+			Error interface{} `json:"error"`
+		} `json:"chart"`
+	}
+	if err := getJSON(ctx, endpoint, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Chart.Error != nil {
+		return nil, errors.New("chart api returned an error")
+	}
+	if len(payload.Chart.Result) == 0 || len(payload.Chart.Result[0].Indicators.Quote) == 0 {
+		return nil, errors.New("chart api returned no results")
+	}
+
+	result := payload.Chart.Result[0]
+	closes := result.Indicators.Quote[0].Close
+	var points []historyPoint
+	for i, ts := range result.Timestamp {
+		// Days without trading have a null close.
+		if i < len(closes) && closes[i] != nil && *closes[i] > 0 {
+			rate := *closes[i]
+			if invert {
+				rate = 1 / rate
+			}
+			points = append(points, historyPoint{At: time.Unix(ts, 0).UTC(), Rate: rate})
+		}
+	}
+	return points, nil
+}
+
+func (p frankfurterProvider) FetchHistory(ctx context.Context, base, target string, since time.Time) ([]historyPoint, error) {
+	endpoint := fmt.Sprintf("%s/%s..?from=%s&to=%s", p.baseURL, since.UTC().Format(time.DateOnly), url.QueryEscape(base), url.QueryEscape(target))
+
+	var payload struct {
+		Rates map[string]map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(ctx, endpoint, &payload); err != nil {
+		return nil, err
+	}
+
+	var points []historyPoint
+	for date, rates := range payload.Rates {
+		at, err := time.Parse(time.DateOnly, date)
+		if err != nil || rates[target] == 0 {
+			continue
+		}
+		// Reference rates are published at about 16:00 CET.
+		points = append(points, historyPoint{At: at.Add(15 * time.Hour), Rate: rates[target]})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].At.Before(points[j].At) })
+	return points, nil
+}
+
+// historySources lists the chain's providers that can read history.
+func (c *providerChain) historySources() []historyProvider {
+	var sources []historyProvider
+	for _, provider := range c.providers {
+		if source, ok := provider.(historyProvider); ok {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type stubHistory struct {
+	name   string
+	points []historyPoint
+	err    error
+	calls  int
+}
+
+func (s *stubHistory) Name() string { return s.name }
+
+func (s *stubHistory) FetchHistory(context.Context, string, string, time.Time) ([]historyPoint, error) {
+	s.calls++
+	return s.points, s.err
+}
+
+func dailyHistory(now time.Time, days int, rate func(daysAgo int) float64) []historyPoint {
+	var points []historyPoint
+	for ago := days; ago >= 1; ago-- {
+		points = append(points, historyPoint{At: now.Add(-time.Duration(ago) * 24 * time.Hour), Rate: rate(ago)})
+	}
+	return points
+}
+
+func TestTrendServiceChanges(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+	// The rate was 16000 30 days ago and rose 10 a day since.
+	source := &stubHistory{name: "stored", points: dailyHistory(now, 31, func(ago int) float64 { return 16300 - 10*float64(ago) })}
+	service := newTrendService(source)
+	service.now = func() time.Time { return now }
+
+	trend, err := service.Trend(context.Background(), "USD", "IDR", 16300)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trend.Change24h == nil || *trend.Change24h != 0.06 || trend.Change7d == nil || *trend.Change7d != 0.43 || trend.Change30d == nil || *trend.Change30d != 1.88 {
+		t.Fatalf("expected changes of 0.06%%, 0.43%%, and 1.88%%, got %+v", trend)
+	}
+	if len(trend.Sparkline) != 32 || trend.Sparkline[31] != (sparkPoint{Date: "2025-10-25", Rate: 16300}) {
+		t.Fatalf("expected a daily sparkline ending with today, got %+v", trend.Sparkline)
+	}
+
+	service.Trend(context.Background(), "USD", "IDR", 16310)
+	if source.calls != 1 {
+		t.Fatalf("expected the history reused, got %d lookups", source.calls)
+	}
+}
+
+func TestTrendServicePrefersCoveringSource(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+	// Stored history only goes back two days, so the chart API is asked.
+	stored := &stubHistory{name: "stored", points: dailyHistory(now, 2, func(int) float64 { return 16250 })}
+	down := &stubHistory{name: "yahoo-finance", err: errors.New("down")}
+	chart := &stubHistory{name: "frankfurter", points: dailyHistory(now, 31, func(int) float64 { return 16000 })}
+	service := newTrendService(stored, down, chart)
+	service.now = func() time.Time { return now }
+
+	trend, err := service.Trend(context.Background(), "USD", "IDR", 16000)
+	if err != nil || trend.Source != "frankfurter" || trend.Change30d == nil {
+		t.Fatalf("expected the 30 day history from frankfurter, got %+v (%v)", trend, err)
+	}
+
+	short := newTrendService(stored)
+	short.now = service.now
+	trend, err = short.Trend(context.Background(), "USD", "IDR", 16250)
+	if err != nil || trend.Change24h == nil || trend.Change7d != nil || trend.Change30d != nil {
+		t.Fatalf("expected only the 24h change from two days of history, got %+v (%v)", trend, err)
+	}
+}
+
+func TestProvidersParseHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		provider func(baseURL string) historyProvider
+		want     []float64
+	}{
+		{
+			name:     "yahoo",
+			body:     `{"chart":{"result":[{"timestamp":[1761091200,1761177600,1761264000],"indicators":{"quote":[{"close":[16580.5,null,16610]}]}}],"error":null}}`,
+			provider: func(baseURL string) historyProvider { return yahooProvider{baseURL: baseURL} },
+			want:     []float64{16580.5, 16610},
+		},
+		{
+			name:     "frankfurter",
+			body:     `{"amount":1.0,"base":"USD","start_date":"2025-10-22","end_date":"2025-10-24","rates":{"2025-10-24":{"IDR":16600},"2025-10-22":{"IDR":16570}}}`,
+			provider: func(baseURL string) historyProvider { return frankfurterProvider{baseURL: baseURL} },
+			want:     []float64{16570, 16600},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			points, err := tc.provider(server.URL).FetchHistory(context.Background(), "USD", "IDR", time.Now().Add(-trendWindow))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(points) != len(tc.want) {
+				t.Fatalf("expected %d points, got %+v", len(tc.want), points)
+			}
+			for i, want := range tc.want {
+				if points[i].Rate != want {
+					t.Fatalf("expected rate %f at %d, got %f", want, i, points[i].Rate)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// upstreamAttemptTimeout bounds one call to a provider, so a hung provider
+// leaves time to retry or ask the next one.
+const upstreamAttemptTimeout = 4 * time.Second
+
+// errUpstreamTimeout marks a fetch that ran out of its deadline.
+var errUpstreamTimeout = errors.New("timed out waiting for rate providers")
+
+// retryPolicy bounds how a failed provider call is retried.
+type retryPolicy struct {
+	// retries is how many times a call is repeated after the first attempt.
+	retries int
+	// baseDelay doubles with each retry up to maxDelay. The wait is a random
+	// duration below it, so clients that failed together do not retry
+	// together.
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// upstreamRetry is the policy getJSON retries with.
+var upstreamRetry = retryPolicy{retries: 2, baseDelay: 200 * time.Millisecond, maxDelay: 2 * time.Second}
+
+type upstreamConfig struct {
+	retry retryPolicy
+	// timeout bounds how long a request waits for a rate, retries included.
+	timeout time.Duration
+}
+
+func loadUpstreamConfig() (upstreamConfig, error) {
+	config := upstreamConfig{retry: upstreamRetry, timeout: 10 * time.Second}
+	if value := os.Getenv("UPSTREAM_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			return upstreamConfig{}, fmt.Errorf("UPSTREAM_RETRIES must be a whole number, got %q", value)
+		}
+		config.retry.retries = retries
+	}
+	if value := os.Getenv("UPSTREAM_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return upstreamConfig{}, fmt.Errorf("UPSTREAM_TIMEOUT must be a duration such as 10s, got %q", value)
+		}
+		config.timeout = d
+	}
+	return config, nil
+}
+
+// delay returns how long to wait before retrying after err, or false when
+// err is not worth retrying. 429s are retried only when their Retry-After is
+// short; otherwise the chain moves on and cools the provider down.
+func (p retryPolicy) delay(err error, attempt int) (time.Duration, bool) {
+	var limited *rateLimitError
+	if errors.As(err, &limited) {
+		return limited.retryAfter, limited.retryAfter <= p.maxDelay
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return p.backoff(attempt), status.code >= http.StatusInternalServerError
+	}
+	return p.backoff(attempt), isTimeout(err)
+}
+
+// backoff is a random wait below baseDelay doubled attempt times, capped at
+// maxDelay.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.maxDelay
+	if attempt < 32 {
+		if d := p.baseDelay << attempt; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// withRetries calls attempt until it succeeds, fails in a way not worth
+// retrying, or runs out of retries. It gives up early rather than wait past
+// ctx's deadline.
+func withRetries(ctx context.Context, policy retryPolicy, attempt func(ctx context.Context) error) error {
+	for n := 0; ; n++ {
+		err := attempt(ctx)
+		if err == nil || n >= policy.retries || ctx.Err() != nil {
+			return err
+		}
+		wait, ok := policy.delay(err, n)
+		if !ok {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// upstreamTimedOut reports whether a failed fetch ran out of time, rather than
+// being refused: the deadline passed, or every provider asked timed out.
+func upstreamTimedOut(err error) bool {
+	if errors.Is(err, errUpstreamTimeout) {
+		return true
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, err := range errs {
+			if !upstreamTimedOut(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	return isTimeout(err)
+}
+
+// withUpstreamDeadline gives each call to quote at most timeout, within the
+// caller's own deadline.
+func withUpstreamDeadline(timeout time.Duration, quote func(ctx context.Context, base, target string) (rateQuote, error)) func(ctx context.Context, base, target string) (rateQuote, error) {
+	return func(ctx context.Context, base, target string) (rateQuote, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		result, err := quote(ctx, base, target)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return rateQuote{}, fmt.Errorf("%w: %v", errUpstreamTimeout, err)
+		}
+		return result, err
+	}
+}
+
+// upstreamError describes a rate that could not be fetched: 504 when it
+// timed out, 502 when the providers failed.
+func upstreamError(err error) (int, apiError) {
+	if upstreamTimedOut(err) {
+		return http.StatusGatewayTimeout, apiError{Code: "upstream_timeout", Message: "timed out fetching rate"}
+	}
+	return http.StatusBadGateway, apiError{Code: "upstream_unavailable", Message: "failed to fetch rate"}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetJSONRetries(t *testing.T) {
+	originalRetry := upstreamRetry
+	upstreamRetry = retryPolicy{retries: 2, baseDelay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+	defer func() { upstreamRetry = originalRetry }()
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "recovers from 5xx", statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, wantCalls: 3},
+		{name: "gives up after retries", statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK}, wantCalls: 3, wantErr: true},
+		{name: "does not retry 4xx", statuses: []int{http.StatusNotFound, http.StatusOK}, wantCalls: 1, wantErr: true},
+		{name: "does not retry a long rate limit", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[calls]
+				calls++
+				if status != http.StatusOK {
+					w.WriteHeader(status)
+					return
+				}
+				fmt.Fprint(w, `{"rate": 1.5}`)
+			}))
+			defer server.Close()
+
+			var payload struct {
+				Rate float64 `json:"rate"`
+			}
+			err := getJSON(context.Background(), server.URL, &payload)
+			if calls != tc.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tc.wantCalls, calls)
+			}
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && payload.Rate != 1.5 {
+				t.Fatalf("expected rate 1.5, got %f", payload.Rate)
+			}
+		})
+	}
+}
+
+func TestWithRetriesStopsAtDeadline(t *testing.T) {
+	policy := retryPolicy{retries: 5, baseDelay: time.Second, maxDelay: time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	started := time.Now()
+	err := withRetries(ctx, policy, func(context.Context) error {
+		calls++
+		return &statusError{code: http.StatusServiceUnavailable}
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected to give up before the deadline, took %s", elapsed)
+	}
+	if calls > 2 {
+		t.Fatalf("expected at most 2 calls, got %d", calls)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := policy.backoff(attempt); d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: expected a wait up to %s, got %s", attempt, ceiling, d)
+			}
+		}
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "deadline", err: fmt.Errorf("%w: boom", errUpstreamTimeout), wantStatus: http.StatusGatewayTimeout, wantCode: "upstream_timeout"},
+		{name: "every provider timed out", err: errors.Join(
+			fmt.Errorf("yahoo-finance: %w", context.DeadlineExceeded),
+			fmt.Errorf("frankfurter: %w", context.DeadlineExceeded),
+		), wantStatus: http.StatusGatewayTimeout, wantCode: "upstream_timeout"},
+		{name: "some providers refused", err: errors.Join(
+			fmt.Errorf("yahoo-finance: %w", context.DeadlineExceeded),
+			fmt.Errorf("frankfurter: %w", &statusError{code: http.StatusInternalServerError}),
+		), wantStatus: http.StatusBadGateway, wantCode: "upstream_unavailable"},
+		{name: "provider error", err: errors.New("boom"), wantStatus: http.StatusBadGateway, wantCode: "upstream_unavailable"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := upstreamError(tc.err)
+			if status != tc.wantStatus || body.Code != tc.wantCode {
+				t.Fatalf("expected %d %s, got %d %s", tc.wantStatus, tc.wantCode, status, body.Code)
+			}
+		})
+	}
+}
+
+func TestWithUpstreamDeadline(t *testing.T) {
+	quote := withUpstreamDeadline(10*time.Millisecond, func(ctx context.Context, base, target string) (rateQuote, error) {
+		<-ctx.Done()
+		return rateQuote{}, ctx.Err()
+	})
+
+	_, err := quote(context.Background(), "USD", "IDR")
+	if !errors.Is(err, errUpstreamTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
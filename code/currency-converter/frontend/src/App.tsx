@@ -1,28 +1,106 @@
-import { useMemo, useState } from 'react';
+import { useEffect, useMemo, useState } from 'react';
 
 type ConversionResult = {
   base: string;
   target: string;
   amount: number;
   rate: number;
+  effective_rate?: number;
+  fees?: { spread_percent: number; fixed: number; cost: number };
   converted: number;
+  converted_raw: number;
+  rounding: string;
   source: string;
+  date?: string;
+  fetched_at: string;
+  age: number;
+  stale?: boolean;
+  trend?: RateTrend;
 };
 
-const currencies = ['USD', 'IDR', 'SGD', 'JPY', 'KRW'] as const;
+type ApiError = {
+  code: string;
+  message: string;
+  details?: { field?: string; suggestions?: string[] };
+};
+
+type RateTrend = {
+  change_24h?: number;
+  change_7d?: number;
+  change_30d?: number;
+  sparkline: { date: string; rate: number }[];
+  source: string;
+};
+
+type RateUpdate = {
+  base: string;
+  target: string;
+  rate: number;
+  previous?: number;
+  source: string;
+  fetched_at: string;
+};
+
+type TableRate = {
+  target: string;
+  rate?: number;
+  source?: string;
+  stale?: boolean;
+  error?: string;
+};
+
+const currencies = ['USD', 'IDR', 'SGD', 'JPY', 'KRW', 'BTC', 'ETH', 'XAU'] as const;
 
 type Currency = (typeof currencies)[number];
 
 const defaultBase: Currency = 'USD';
 const defaultTarget: Currency = 'IDR';
 
+// Rates run from fractions of a cent for USD to BTC to billions the other way.
+const formatRate = (rate: number) => rate.toLocaleString(undefined, { maximumSignificantDigits: 6 });
+
+function Sparkline({ points }: { points: RateTrend['sparkline'] }) {
+  if (points.length < 2) {
+    return null;
+  }
+  const rates = points.map((point) => point.rate);
+  const min = Math.min(...rates);
+  const range = Math.max(...rates) - min || 1;
+  const path = rates
+    .map((rate, index) => `${(index / (rates.length - 1)) * 100},${30 - ((rate - min) / range) * 30}`)
+    .join(' ');
+  const rising = rates[rates.length - 1] >= rates[0];
+  return (
+    <svg className="sparkline" viewBox="0 -2 100 34" preserveAspectRatio="none" aria-hidden="true">
+      <polyline points={path} className={rising ? 'up' : 'down'} />
+    </svg>
+  );
+}
+
+function Change({ label, value }: { label: string; value?: number }) {
+  if (value === undefined) {
+    return null;
+  }
+  const direction = value > 0 ? 'up' : value < 0 ? 'down' : 'flat';
+  const arrow = value > 0 ? '▲' : value < 0 ? '▼' : '■';
+  return (
+    <span className={`change ${direction}`}>
+      {label} {arrow} {Math.abs(value).toFixed(2)}%
+    </span>
+  );
+}
+
 export default function App() {
   const [base, setBase] = useState<Currency>(defaultBase);
   const [target, setTarget] = useState<Currency>(defaultTarget);
   const [amount, setAmount] = useState<string>('1');
+  // An empty date converts at the live rate.
+  const [date, setDate] = useState<string>('');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
   const [result, setResult] = useState<ConversionResult | null>(null);
+  const [liveRate, setLiveRate] = useState<RateUpdate | null>(null);
+  const [overview, setOverview] = useState<TableRate[]>([]);
 
   const isSwapDisabled = useMemo(() => base === target, [base, target]);
 
@@ -42,11 +120,15 @@ export default function App() {
       const params = new URLSearchParams({
         base,
         target,
-        amount: numericAmount.toString()
+        amount: amount.trim()
       });
+      if (date) {
+        params.set('date', date);
+      }
       const response = await fetch(`/api/convert?${params.toString()}`);
       if (!response.ok) {
-        throw new Error('Conversion failed. Please try again.');
+        const failure: ApiError | null = await response.json().catch(() => null);
+        throw new Error(failure?.message ?? 'Conversion failed. Please try again.');
       }
       const payload: ConversionResult = await response.json();
       setResult(payload);
@@ -61,6 +143,30 @@ export default function App() {
     }
   };
 
+  // Follow the converted pair's rate when the backend refreshes it; the stream
+  // is refused for pairs it does not refresh, and EventSource then gives up.
+  useEffect(() => {
+    setLiveRate(null);
+    if (!result || result.date) {
+      return;
+    }
+    const source = new EventSource(`/api/stream?pairs=${result.base}${result.target}`);
+    source.addEventListener('rate', (event) => {
+      setLiveRate(JSON.parse((event as MessageEvent<string>).data) as RateUpdate);
+    });
+    return () => source.close();
+  }, [result]);
+
+  useEffect(() => {
+    const controller = new AbortController();
+    const targets = currencies.filter((currency) => currency !== base).join(',');
+    fetch(`/api/table?base=${base}&targets=${targets}`, { signal: controller.signal })
+      .then((response) => (response.ok ? response.json() : { rates: [] }))
+      .then((payload: { rates: TableRate[] }) => setOverview(payload.rates))
+      .catch(() => setOverview([]));
+    return () => controller.abort();
+  }, [base]);
+
   const swapCurrencies = () => {
     setBase(target);
     setTarget(base);
@@ -70,7 +176,7 @@ export default function App() {
     <div className="app-container">
       <header>
         <h1>Currency Converter</h1>
-        <p>Convert between supported currencies with live Yahoo Finance rates.</p>
+        <p>Convert between supported currencies with live market rates.</p>
       </header>
 
       <section className="card">
@@ -86,6 +192,17 @@ export default function App() {
           />
         </div>
 
+        <div className="field-group">
+          <label htmlFor="date">Date (optional)</label>
+          <input
+            id="date"
+            type="date"
+            max={new Date().toISOString().slice(0, 10)}
+            value={date}
+            onChange={(event) => setDate(event.target.value)}
+          />
+        </div>
+
         <div className="field-row">
           <div className="field-group">
             <label htmlFor="base">From</label>
@@ -122,18 +239,62 @@ export default function App() {
         {result && !error && (
           <div className="result" role="status">
             <p>
-              {result.amount.toLocaleString(undefined, { maximumFractionDigits: 2 })} {result.base} =
+              {result.amount.toLocaleString(undefined, { maximumFractionDigits: 8 })} {result.base} =
             </p>
             <p className="converted-value">
-              {result.converted.toLocaleString(undefined, { maximumFractionDigits: 2 })} {result.target}
+              {result.converted.toLocaleString(undefined, { maximumFractionDigits: 8 })} {result.target}
+            </p>
+            <p className="rate">
+              {result.date
+                ? `Rate on ${result.date}: ${formatRate(result.rate)} (${result.source}, from ${result.fetched_at.slice(0, 10)})`
+                : `Rate: ${formatRate(result.rate)} (${result.source}, ${result.age}s old)`}
             </p>
-            <p className="rate">Rate: {result.rate.toFixed(4)} ({result.source})</p>
+            {result.fees && result.effective_rate !== undefined && (
+              <p className="rate">
+                Effective rate: {formatRate(result.effective_rate)} after{' '}
+                {result.fees.cost.toLocaleString(undefined, { maximumFractionDigits: 8 })} {result.target} in fees
+              </p>
+            )}
+            {result.trend && (
+              <div className="trend">
+                <Sparkline points={result.trend.sparkline} />
+                <p>
+                  <Change label="24h" value={result.trend.change_24h} />
+                  <Change label="7d" value={result.trend.change_7d} />
+                  <Change label="30d" value={result.trend.change_30d} />
+                </p>
+              </div>
+            )}
+            {liveRate && (
+              <p className="live-rate">
+                Live: {formatRate(liveRate.rate)} ({liveRate.source}, {new Date(liveRate.fetched_at).toLocaleTimeString()})
+              </p>
+            )}
+            {result.stale && <p className="stale">This rate is older than usual and may be out of date.</p>}
           </div>
         )}
       </section>
 
+      {overview.length > 0 && (
+        <section className="card overview">
+          <h2>1 {base} equals</h2>
+          <table>
+            <tbody>
+              {overview.map((row) => (
+                <tr key={row.target}>
+                  <th scope="row">{row.target}</th>
+                  <td className={row.stale ? 'stale' : undefined}>
+                    {row.rate !== undefined ? formatRate(row.rate) : 'unavailable'}
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </section>
+      )}
+
       <footer>
-        <small>Backend proxy fetches data from Yahoo Finance.</small>
+        <small>Backend proxy fetches rates from Yahoo Finance, falling back to the ECB, exchangerate.host, and Coinbase.</small>
       </footer>
     </div>
   );
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	alertIndex = "alerts"
+	// maxAlertsPerUser keeps one account from making every new movie fan
+	// out into hundreds of notifications.
+	maxAlertsPerUser = 20
+	// alertQueueSize bounds new movies waiting for percolation. When the
+	// queue is full, alerts for the overflow are dropped and logged.
+	alertQueueSize = 256
+)
+
+type Alert struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user"`
+	Name       string    `json:"name" binding:"required,max=100"`
+	Genre      string    `json:"genre" binding:"max=100"`
+	Keywords   string    `json:"keywords" binding:"max=500"`
+	WebhookURL string    `json:"webhook_url" binding:"omitempty,url"`
+	Email      string    `json:"email" binding:"omitempty,email"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func alertQuery(alert Alert) map[string]interface{} {
+	query := map[string]interface{}{}
+	if alert.Genre != "" {
+		query["filter"] = map[string]interface{}{
+			"term": map[string]interface{}{"genre": map[string]interface{}{"value": alert.Genre, "case_insensitive": true}},
+		}
+	}
+	if alert.Keywords != "" {
+		query["must"] = map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    alert.Keywords,
+				"fields":   []string{"title", "description"},
+				"operator": "and",
+			},
+		}
+	}
+	return map[string]interface{}{"bool": query}
+}
+
+func ensureAlertIndex(ctx context.Context, es *elasticsearch.Client) error {
+	exists, err := es.Indices.Exists([]string{alertIndex}, es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("check alert index exists: %w", err)
+	}
+	exists.Body.Close()
+	if exists.StatusCode != http.StatusNotFound {
+		return nil
+	}
+
+	text := map[string]interface{}{
+		"type":            "text",
+		"analyzer":        movieTextAnalyzer,
+		"search_analyzer": movieSearchAnalyzer,
+	}
+	body, err := encodeBody(map[string]interface{}{
+		"settings": movieSettings(),
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"query":       map[string]interface{}{"type": "percolator"},
+				"title":       text,
+				"description": text,
+				"genre":       map[string]interface{}{"type": "keyword"},
+				// Alert details are only stored; the owner is the one
+				// field alerts are looked up by.
+				"alert": map[string]interface{}{
+					"type":       "object",
+					"dynamic":    false,
+					"properties": map[string]interface{}{"user": map[string]interface{}{"type": "keyword"}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.Create(alertIndex, es.Indices.Create.WithBody(body), es.Indices.Create.WithContext(ctx))
+	return esCall(res, err, "create alert index")
+}
+
+type alertDispatcher struct {
+	es     *elasticsearch.Client
+	queue  chan []Movie
+	client *http.Client
+
+	// allowHTTP lets webhooks use plain http, for local receivers.
+	allowHTTP bool
+	smtpAddr  string
+	smtpAuth  smtp.Auth
+	emailFrom string
+}
+
+func newAlertDispatcher(es *elasticsearch.Client) *alertDispatcher {
+	d := &alertDispatcher{
+		es:        es,
+		queue:     make(chan []Movie, alertQueueSize),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		allowHTTP: os.Getenv("ALERTS_ALLOW_HTTP_WEBHOOKS") == "true",
+		smtpAddr:  os.Getenv("SMTP_ADDR"),
+		emailFrom: getenv("ALERTS_EMAIL_FROM", "alerts@localhost"),
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" && d.smtpAddr != "" {
+		host, _, _ := strings.Cut(d.smtpAddr, ":")
+		d.smtpAuth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	go d.run()
+	return d
+}
+
+// moviesAdded never blocks the request that created the movies.
+func (d *alertDispatcher) moviesAdded(movies ...Movie) {
+	if len(movies) == 0 {
+		return
+	}
+	select {
+	case d.queue <- movies:
+	default:
+		log.Printf("alert queue full, skipped alerts for %d new movies", len(movies))
+	}
+}
+
+func (d *alertDispatcher) run() {
+	for movies := range d.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := d.dispatch(ctx, movies); err != nil {
+			log.Printf("alerts: %v", err)
+		}
+		cancel()
+	}
+}
+
+func (d *alertDispatcher) dispatch(ctx context.Context, movies []Movie) error {
+	documents := make([]map[string]interface{}, len(movies))
+	for i, movie := range movies {
+		documents[i] = map[string]interface{}{
+			"title":       movie.Title,
+			"description": movie.Description,
+			// The alert field holds one genre; given a list it matches any of them.
+			"genre": movie.Genres,
+		}
+	}
+	body, err := encodeBody(map[string]interface{}{
+		"size":    1000,
+		"_source": []string{"alert"},
+		"query": map[string]interface{}{
+			"percolate": map[string]interface{}{"field": "query", "documents": documents},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := d.es.Search(d.es.Search.WithContext(ctx), d.es.Search.WithIndex(alertIndex), d.es.Search.WithBody(body))
+	if err != nil {
+		return fmt.Errorf("percolate: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("percolate response error: %s", res.String())
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					Alert Alert `json:"alert"`
+				} `json:"_source"`
+				Fields struct {
+					Slots []int `json:"_percolator_document_slot"`
+				} `json:"fields"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return fmt.Errorf("decode percolate response: %w", err)
+	}
+
+	for _, hit := range result.Hits.Hits {
+		alert := hit.Source.Alert
+		alert.ID = hit.ID
+		slots := hit.Fields.Slots
+		if len(slots) == 0 && len(movies) == 1 {
+			// A lone document may come back without slots.
+			slots = []int{0}
+		}
+		matched := make([]Movie, 0, len(slots))
+		for _, slot := range slots {
+			if slot >= 0 && slot < len(movies) {
+				matched = append(matched, movies[slot])
+			}
+		}
+		if len(matched) > 0 {
+			d.notify(ctx, alert, matched)
+		}
+	}
+	return nil
+}
+
+// notify sends an alert's webhook and email. Failures are logged and not
+// retried.
+func (d *alertDispatcher) notify(ctx context.Context, alert Alert, movies []Movie) {
+	if alert.WebhookURL != "" {
+		if err := d.sendWebhook(ctx, alert, movies); err != nil {
+			log.Printf("alert %s webhook: %v", alert.ID, err)
+		}
+	}
+
+	if alert.Email != "" && d.smtpAddr != "" {
+		var text bytes.Buffer
+		fmt.Fprintf(&text, "From: %s\r\nTo: %s\r\nSubject: New movies for \"%s\"\r\n\r\n",
+			d.emailFrom, alert.Email, strings.NewReplacer("\r", " ", "\n", " ").Replace(alert.Name))
+		for _, movie := range movies {
+			fmt.Fprintf(&text, "- %s (%d) %s\r\n", movie.Title, movie.ReleaseYear, strings.Join(movie.Genres, ", "))
+		}
+		if err := smtp.SendMail(d.smtpAddr, d.smtpAuth, d.emailFrom, []string{alert.Email}, text.Bytes()); err != nil {
+			log.Printf("alert %s email: %v", alert.ID, err)
+		}
+	}
+}
+
+func (d *alertDispatcher) sendWebhook(ctx context.Context, alert Alert, movies []Movie) error {
+	payload, err := encodeBody(gin.H{
+		"alert":  gin.H{"id": alert.ID, "name": alert.Name},
+		"movies": movies,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, alert.WebhookURL, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (d *alertDispatcher) checkWebhook(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("webhook_url must be an absolute URL")
+	}
+	if parsed.Scheme == "https" || (parsed.Scheme == "http" && d.allowHTTP) {
+		return nil
+	}
+	return fmt.Errorf("webhook_url must use https")
+}
+
+func handleCreateAlert(es *elasticsearch.Client, alerts *alertDispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input Alert
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Genre = strings.TrimSpace(input.Genre)
+		input.Keywords = strings.TrimSpace(input.Keywords)
+		switch {
+		case input.Genre == "" && input.Keywords == "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an alert needs a genre, keywords, or both"})
+			return
+		case input.WebhookURL == "" && input.Email == "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an alert needs a webhook_url or an email"})
+			return
+		case input.Email != "" && alerts.smtpAddr == "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email alerts are not enabled on this server"})
+			return
+		}
+		if input.WebhookURL != "" {
+			if err := alerts.checkWebhook(input.WebhookURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		existing, err := listAlerts(c, es)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list alerts"})
+			return
+		}
+		if len(existing) >= maxAlertsPerUser {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("at most %d alerts per user", maxAlertsPerUser)})
+			return
+		}
+
+		input.ID = uuid.NewString()
+		input.User = currentUser(c)
+		input.CreatedAt = time.Now().UTC()
+		body, err := encodeBody(map[string]interface{}{"query": alertQuery(input), "alert": input})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode alert"})
+			return
+		}
+		res, err := es.Index(alertIndex, body,
+			es.Index.WithDocumentID(input.ID),
+			es.Index.WithRefresh("true"),
+			es.Index.WithContext(c.Request.Context()))
+		if err := esCall(res, err, "index alert"); err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create alert"})
+			return
+		}
+		c.JSON(http.StatusCreated, input)
+	}
+}
+
+func handleListAlerts(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alerts, err := listAlerts(c, es)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list alerts"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+	}
+}
+
+func listAlerts(c *gin.Context, es *elasticsearch.Client) ([]Alert, error) {
+	body, err := encodeBody(map[string]interface{}{
+		"size":    maxAlertsPerUser,
+		"_source": []string{"alert"},
+		"query":   map[string]interface{}{"term": map[string]interface{}{"alert.user": currentUser(c)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(alertIndex), es.Search.WithBody(body))
+	if err != nil {
+		return nil, fmt.Errorf("search alerts: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("search alerts response error: %s", res.String())
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					Alert Alert `json:"alert"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode alerts: %w", err)
+	}
+	alerts := make([]Alert, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		alert := hit.Source.Alert
+		alert.ID = hit.ID
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func handleDeleteAlert(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alerts, err := listAlerts(c, es)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list alerts"})
+			return
+		}
+		owned := false
+		for _, alert := range alerts {
+			owned = owned || alert.ID == c.Param("alertId")
+		}
+		if !owned {
+			c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+			return
+		}
+		res, err := es.Delete(alertIndex, c.Param("alertId"),
+			es.Delete.WithRefresh("true"),
+			es.Delete.WithContext(c.Request.Context()))
+		if err := esCall(res, err, "delete alert"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete alert"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
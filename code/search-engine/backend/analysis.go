@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	movieTextAnalyzer   = "movie_text"
+	movieSearchAnalyzer = "movie_search"
+)
+
+// defaultSynonyms are in Solr format: comma-separated equivalents, or
+// "a => b" to rewrite one way.
+var defaultSynonyms = []string{
+	"sci-fi, scifi, science fiction",
+	"film, movie, picture",
+	"cop, police, detective",
+	"mafia, mob, organized crime",
+	"space, outer space, cosmos",
+	"funny, comedy, comedic",
+	"scary, horror, frightening",
+	"romance, romantic, love story",
+	"musical, music",
+	"batman, caped crusader",
+}
+
+var synonyms = defaultSynonyms
+
+func loadSynonyms() error {
+	path := os.Getenv("SEARCH_SYNONYMS_FILE")
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open synonyms file: %w", err)
+	}
+	defer file.Close()
+
+	var rules []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read synonyms file: %w", err)
+	}
+	synonyms = rules
+	return nil
+}
+
+// movieSettings expands synonyms only at search time, where synonym_graph
+// handles multi-word rules.
+func movieSettings() map[string]interface{} {
+	baseFilters := []string{"lowercase", "asciifolding", "movie_possessive"}
+	return map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"movie_possessive": map[string]interface{}{"type": "stemmer", "language": "possessive_english"},
+				"movie_stemmer":    map[string]interface{}{"type": "stemmer", "language": "light_english"},
+				"movie_synonyms": map[string]interface{}{
+					"type":     "synonym_graph",
+					"synonyms": synonyms,
+					"lenient":  true,
+				},
+			},
+			"analyzer": map[string]interface{}{
+				movieTextAnalyzer: map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    append(append([]string{}, baseFilters...), "movie_stemmer"),
+				},
+				movieSearchAnalyzer: map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    append(append([]string{}, baseFilters...), "movie_synonyms", "movie_stemmer"),
+				},
+			},
+		},
+	}
+}
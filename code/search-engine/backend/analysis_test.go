@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadSynonymsFromFile(t *testing.T) {
+	original := synonyms
+	defer func() { synonyms = original }()
+
+	path := filepath.Join(t.TempDir(), "synonyms.txt")
+	content := "# genres\nsci-fi, science fiction\n\n  flick => film  \n# end\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write synonyms file: %v", err)
+	}
+	t.Setenv("SEARCH_SYNONYMS_FILE", path)
+
+	if err := loadSynonyms(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"sci-fi, science fiction", "flick => film"}
+	if !reflect.DeepEqual(synonyms, want) {
+		t.Fatalf("expected %q, got %q", want, synonyms)
+	}
+}
+
+func TestLoadSynonymsKeepsDefaultsWithoutFile(t *testing.T) {
+	original := synonyms
+	defer func() { synonyms = original }()
+	t.Setenv("SEARCH_SYNONYMS_FILE", "")
+
+	if err := loadSynonyms(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(synonyms, defaultSynonyms) {
+		t.Fatalf("expected the default synonyms, got %q", synonyms)
+	}
+}
+
+func TestLoadSynonymsMissingFile(t *testing.T) {
+	t.Setenv("SEARCH_SYNONYMS_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+
+	if err := loadSynonyms(); err == nil {
+		t.Fatalf("expected an error for a missing file")
+	}
+}
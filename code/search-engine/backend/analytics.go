@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	searchLogIndex = "search_logs"
+
+	// Context keys shared by logSearches and the search handlers.
+	searchIDKey   = "search_id"
+	searchPageKey = "search_page"
+	searchHitsKey = "search_hits"
+
+	// Log entries are written in bulk once searchLogBatch are waiting or
+	// searchLogFlush has passed, whichever comes first.
+	searchLogBatch = 200
+	searchLogFlush = 2 * time.Second
+	// searchLogQueueSize bounds entries waiting to be written. Entries that
+	// do not fit are dropped rather than slowing searches down.
+	searchLogQueueSize = 2000
+)
+
+type searchLogEntry struct {
+	Event     string    `json:"event"`
+	SearchID  string    `json:"search_id"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Query     string  `json:"query,omitempty"`
+	Person    string  `json:"person,omitempty"`
+	Sort      string  `json:"sort,omitempty"`
+	Order     string  `json:"order,omitempty"`
+	Mode      string  `json:"mode,omitempty"`
+	Fuzziness string  `json:"fuzziness,omitempty"`
+	Page      int     `json:"page,omitempty"`
+	Hits      int     `json:"hits"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Status    int     `json:"status,omitempty"`
+
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+
+	MovieID  string `json:"movie_id,omitempty"`
+	Position int    `json:"position,omitempty"`
+}
+
+func ensureSearchLogIndex(ctx context.Context, es *elasticsearch.Client) error {
+	exists, err := es.Indices.Exists([]string{searchLogIndex}, es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("check search log index exists: %w", err)
+	}
+	exists.Body.Close()
+	keyword := map[string]interface{}{"type": "keyword"}
+	if exists.StatusCode != http.StatusNotFound {
+		// Logs from before experiments lack these fields; map them before
+		// dynamic mapping makes them text.
+		body, err := encodeBody(map[string]interface{}{"properties": map[string]interface{}{"experiment": keyword, "variant": keyword}})
+		if err != nil {
+			return err
+		}
+		res, err := es.Indices.PutMapping([]string{searchLogIndex}, body, es.Indices.PutMapping.WithContext(ctx))
+		return esCall(res, err, "map search log experiment fields")
+	}
+
+	body, err := encodeBody(map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"event":      keyword,
+				"search_id":  keyword,
+				"timestamp":  map[string]interface{}{"type": "date"},
+				"query":      map[string]interface{}{"type": "keyword", "normalizer": "lowercase", "ignore_above": 256},
+				"person":     map[string]interface{}{"type": "keyword", "normalizer": "lowercase"},
+				"sort":       keyword,
+				"order":      keyword,
+				"mode":       keyword,
+				"fuzziness":  keyword,
+				"page":       map[string]interface{}{"type": "integer"},
+				"hits":       map[string]interface{}{"type": "integer"},
+				"latency_ms": map[string]interface{}{"type": "float"},
+				"status":     map[string]interface{}{"type": "short"},
+				"movie_id":   keyword,
+				"position":   map[string]interface{}{"type": "integer"},
+				"experiment": keyword,
+				"variant":    keyword,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.Create(searchLogIndex, es.Indices.Create.WithBody(body), es.Indices.Create.WithContext(ctx))
+	return esCall(res, err, "create search log index")
+}
+
+type searchLogger struct {
+	es    *elasticsearch.Client
+	queue chan searchLogEntry
+	done  chan struct{}
+	// mu keeps record from sending on the queue once stop has closed it.
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func newSearchLogger(es *elasticsearch.Client) *searchLogger {
+	if os.Getenv("SEARCH_ANALYTICS") == "off" {
+		return nil
+	}
+	l := &searchLogger{es: es, queue: make(chan searchLogEntry, searchLogQueueSize), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+func (l *searchLogger) record(entry searchLogEntry) {
+	if l == nil {
+		return
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.stopped {
+		return
+	}
+	select {
+	case l.queue <- entry:
+	default:
+		log.Printf("search log queue full, dropped a %s entry", entry.Event)
+	}
+}
+
+func (l *searchLogger) run() {
+	ticker := time.NewTicker(searchLogFlush)
+	defer ticker.Stop()
+	batch := make([]searchLogEntry, 0, searchLogBatch)
+	for {
+		select {
+		case entry, ok := <-l.queue:
+			if !ok {
+				if len(batch) > 0 {
+					if err := l.flush(batch); err != nil {
+						log.Printf("search log: %v", err)
+					}
+				}
+				close(l.done)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < searchLogBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := l.flush(batch); err != nil {
+			log.Printf("search log: %v", err)
+		}
+		batch = batch[:0]
+	}
+}
+
+// stop writes the entries still queued and returns once they are written.
+func (l *searchLogger) stop() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if !l.stopped {
+		l.stopped = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+	<-l.done
+}
+
+func (l *searchLogger) flush(batch []searchLogEntry) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, entry := range batch {
+		encoder.Encode(map[string]interface{}{"index": map[string]interface{}{}})
+		encoder.Encode(entry)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := l.es.Bulk(&body, l.es.Bulk.WithIndex(searchLogIndex), l.es.Bulk.WithContext(ctx))
+	return esCall(res, err, "write search logs")
+}
+
+func logSearches(logger *searchLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if logger == nil {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		id := uuid.NewString()
+		c.Set(searchIDKey, id)
+		c.Next()
+
+		// Read the query after the handler, which may have rewritten it
+		// to run a saved search.
+		logger.record(searchLogEntry{
+			Event:     "search",
+			SearchID:  id,
+			Timestamp: start.UTC(),
+			Query:     strings.TrimSpace(c.Query("q")),
+			Person:    strings.TrimSpace(c.Query("person")),
+			Sort:      c.Query("sort"),
+			Order:     c.Query("order"),
+			Mode:      c.DefaultQuery("mode", "keyword"),
+			Fuzziness: c.Query("fuzziness"),
+			Page:      c.GetInt(searchPageKey),
+			Hits:      c.GetInt(searchHitsKey),
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			Status:    c.Writer.Status(),
+
+			Experiment: experimentName(c),
+			Variant:    c.GetString(experimentVariantKey),
+		})
+	}
+}
+
+func noteSearch(c *gin.Context, response gin.H, page, totalHits int) {
+	c.Set(searchPageKey, page)
+	c.Set(searchHitsKey, totalHits)
+	if id := c.GetString(searchIDKey); id != "" {
+		response["search_id"] = id
+	}
+	if variant := c.GetString(experimentVariantKey); variant != "" {
+		response["experiment"] = gin.H{"name": experimentName(c), "variant": variant}
+	}
+}
+
+// handleRecordClick takes the search_id of the results, the query they were
+// for, or both. Clicks with a query count towards its click-through rate.
+func handleRecordClick(logger *searchLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			SearchID string `json:"search_id" binding:"max=64"`
+			Query    string `json:"query" binding:"max=256"`
+			MovieID  string `json:"movie_id" binding:"required,max=512"`
+			Position int    `json:"position" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Query = strings.TrimSpace(input.Query)
+		if input.SearchID == "" && input.Query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "search_id or query is required"})
+			return
+		}
+		logger.record(searchLogEntry{
+			Event:     "click",
+			SearchID:  input.SearchID,
+			Timestamp: time.Now().UTC(),
+			Query:     input.Query,
+			MovieID:   input.MovieID,
+			Position:  input.Position,
+
+			Experiment: experimentName(c),
+			Variant:    c.GetString(experimentVariantKey),
+		})
+		c.Status(http.StatusAccepted)
+	}
+}
+
+func parseRange(c *gin.Context, defaultFrom string) (string, string, error) {
+	from, to := c.DefaultQuery("from", defaultFrom), c.DefaultQuery("to", "now")
+	for _, value := range []string{from, to} {
+		if strings.HasPrefix(value, "now") {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "", "", fmt.Errorf("from and to must be RFC 3339 times or date math such as now-7d")
+		}
+	}
+	return from, to, nil
+}
+
+type queryCount struct {
+	Query string `json:"query"`
+	Count int    `json:"count"`
+}
+
+// handleAnalytics counts only first pages as searches, so paging through
+// results is not counted again.
+func handleAnalytics(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseRange(c, "now-7d")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		size := parseIntWithDefault(c.Query("size"), 10)
+		if size <= 0 || size > 100 {
+			size = 10
+		}
+		summary, err := summarizeSearches(c.Request.Context(), es, from, to, size)
+		if err != nil {
+			log.Printf("analytics: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "analytics request failed"})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// summarizeSearches aggregates the search log between from and to, keeping the size most common queries.
+func summarizeSearches(ctx context.Context, es *elasticsearch.Client, from, to string, size int) (gin.H, error) {
+	topQueries := map[string]interface{}{
+		"terms": map[string]interface{}{"field": "query", "size": size, "exclude": []string{""}},
+	}
+	body, err := encodeBody(map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": from, "lte": to}}},
+		"aggs": map[string]interface{}{
+			"searches": map[string]interface{}{
+				"filter": firstPageSearches,
+				"aggs": map[string]interface{}{
+					"top_queries": topQueries,
+					"zero_results": map[string]interface{}{
+						"filter": map[string]interface{}{"term": map[string]interface{}{"hits": 0}},
+						"aggs":   map[string]interface{}{"queries": topQueries},
+					},
+					"latency": map[string]interface{}{
+						"percentiles": map[string]interface{}{"field": "latency_ms", "percents": []float64{50, 90, 99}},
+					},
+				},
+			},
+			"clicks": map[string]interface{}{
+				"filter": map[string]interface{}{"term": map[string]interface{}{"event": "click"}},
+				"aggs": map[string]interface{}{
+					"searches": map[string]interface{}{"cardinality": map[string]interface{}{"field": "search_id"}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := es.Search(es.Search.WithContext(ctx), es.Search.WithIndex(searchLogIndex), es.Search.WithBody(body))
+	if err != nil {
+		return nil, fmt.Errorf("analytics request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("analytics response error: %s", res.String())
+	}
+
+	type buckets struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int    `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	var result struct {
+		Aggregations struct {
+			Searches struct {
+				DocCount    int     `json:"doc_count"`
+				TopQueries  buckets `json:"top_queries"`
+				ZeroResults struct {
+					DocCount int     `json:"doc_count"`
+					Queries  buckets `json:"queries"`
+				} `json:"zero_results"`
+				Latency struct {
+					Values map[string]*float64 `json:"values"`
+				} `json:"latency"`
+			} `json:"searches"`
+			Clicks struct {
+				DocCount int `json:"doc_count"`
+				Searches struct {
+					Value int `json:"value"`
+				} `json:"searches"`
+			} `json:"clicks"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode analytics: %w", err)
+	}
+
+	toCounts := func(b buckets) []queryCount {
+		counts := make([]queryCount, 0, len(b.Buckets))
+		for _, bucket := range b.Buckets {
+			counts = append(counts, queryCount{Query: bucket.Key, Count: bucket.DocCount})
+		}
+		return counts
+	}
+	searches := result.Aggregations.Searches
+	latency := gin.H{}
+	for _, percent := range []string{"50", "90", "99"} {
+		latency["p"+percent] = searches.Latency.Values[percent+".0"]
+	}
+	clickThrough := 0.0
+	if searches.DocCount > 0 {
+		clickThrough = math.Round(float64(result.Aggregations.Clicks.Searches.Value)/float64(searches.DocCount)*1000) / 1000
+	}
+
+	return gin.H{
+		"from":                 from,
+		"to":                   to,
+		"searches":             searches.DocCount,
+		"zero_result_searches": searches.ZeroResults.DocCount,
+		"top_queries":          toCounts(searches.TopQueries),
+		"zero_result_queries":  toCounts(searches.ZeroResults.Queries),
+		"latency_ms":           latency,
+		"clicks":               result.Aggregations.Clicks.DocCount,
+		"click_through_rate":   clickThrough,
+	}, nil
+}
+
+// firstPageSearches are the searches analytics count: first pages that succeeded.
+var firstPageSearches = map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+	{"term": map[string]interface{}{"event": "search"}},
+	{"term": map[string]interface{}{"page": 1}},
+	{"term": map[string]interface{}{"status": http.StatusOK}},
+}}}
+
+type positionClicks struct {
+	Position int     `json:"position"`
+	Clicks   int     `json:"clicks"`
+	CTR      float64 `json:"ctr"`
+}
+
+type queryClicks struct {
+	Query        string   `json:"query"`
+	Searches     int      `json:"searches"`
+	Clicks       int      `json:"clicks"`
+	CTR          float64  `json:"ctr"`
+	MeanPosition *float64 `json:"mean_position"`
+}
+
+func clickRate(clicks, searches int) float64 {
+	if searches == 0 {
+		return 0
+	}
+	return math.Round(float64(clicks)/float64(searches)*1000) / 1000
+}
+
+// handleClickReport breaks click-through down by result position and by query,
+// the raw material for tuning boosts or training a ranking model later.
+func handleClickReport(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseRange(c, "now-7d")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		size := parseIntWithDefault(c.Query("size"), 20)
+		if size <= 0 || size > 100 {
+			size = 20
+		}
+		clicks := map[string]interface{}{"term": map[string]interface{}{"event": "click"}}
+
+		body, err := encodeBody(map[string]interface{}{
+			"size":  0,
+			"query": map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": from, "lte": to}}},
+			"aggs": map[string]interface{}{
+				"searches": map[string]interface{}{"filter": firstPageSearches},
+				"positions": map[string]interface{}{
+					"filter": clicks,
+					"aggs": map[string]interface{}{
+						"position": map[string]interface{}{"terms": map[string]interface{}{"field": "position", "size": 50, "order": map[string]interface{}{"_key": "asc"}}},
+					},
+				},
+				"queries": map[string]interface{}{
+					"filter": map[string]interface{}{"bool": map[string]interface{}{"should": []map[string]interface{}{firstPageSearches, clicks}, "minimum_should_match": 1}},
+					"aggs": map[string]interface{}{
+						"query": map[string]interface{}{
+							"terms": map[string]interface{}{"field": "query", "size": size, "exclude": []string{""}, "order": map[string]interface{}{"searches": "desc"}},
+							"aggs": map[string]interface{}{
+								"searches": map[string]interface{}{"filter": firstPageSearches},
+								"clicks": map[string]interface{}{
+									"filter": clicks,
+									"aggs":   map[string]interface{}{"position": map[string]interface{}{"avg": map[string]interface{}{"field": "position"}}},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode click report query"})
+			return
+		}
+		res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(searchLogIndex), es.Search.WithBody(body))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "click report request failed"})
+			return
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			log.Printf("click report: %s", res.String())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "click report returned an error"})
+			return
+		}
+
+		var result struct {
+			Aggregations struct {
+				Searches struct {
+					DocCount int `json:"doc_count"`
+				} `json:"searches"`
+				Positions struct {
+					DocCount int `json:"doc_count"`
+					Position struct {
+						Buckets []struct {
+							Key      int `json:"key"`
+							DocCount int `json:"doc_count"`
+						} `json:"buckets"`
+					} `json:"position"`
+				} `json:"positions"`
+				Queries struct {
+					Query struct {
+						Buckets []struct {
+							Key      string `json:"key"`
+							Searches struct {
+								DocCount int `json:"doc_count"`
+							} `json:"searches"`
+							Clicks struct {
+								DocCount int `json:"doc_count"`
+								Position struct {
+									Value *float64 `json:"value"`
+								} `json:"position"`
+							} `json:"clicks"`
+						} `json:"buckets"`
+					} `json:"query"`
+				} `json:"queries"`
+			} `json:"aggregations"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode click report"})
+			return
+		}
+
+		searches := result.Aggregations.Searches.DocCount
+		byPosition := make([]positionClicks, 0, len(result.Aggregations.Positions.Position.Buckets))
+		for _, bucket := range result.Aggregations.Positions.Position.Buckets {
+			byPosition = append(byPosition, positionClicks{Position: bucket.Key, Clicks: bucket.DocCount, CTR: clickRate(bucket.DocCount, searches)})
+		}
+		byQuery := make([]queryClicks, 0, len(result.Aggregations.Queries.Query.Buckets))
+		for _, bucket := range result.Aggregations.Queries.Query.Buckets {
+			row := queryClicks{Query: bucket.Key, Searches: bucket.Searches.DocCount, Clicks: bucket.Clicks.DocCount, CTR: clickRate(bucket.Clicks.DocCount, bucket.Searches.DocCount)}
+			if mean := bucket.Clicks.Position.Value; mean != nil {
+				rounded := math.Round(*mean*10) / 10
+				row.MeanPosition = &rounded
+			}
+			byQuery = append(byQuery, row)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":        from,
+			"to":          to,
+			"searches":    searches,
+			"clicks":      result.Aggregations.Positions.DocCount,
+			"by_position": byPosition,
+			"by_query":    byQuery,
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleRecordClick(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantQuery  string
+	}{
+		{name: "query", body: `{"query":" nolan ","movie_id":"m1","position":2}`, wantStatus: http.StatusAccepted, wantQuery: "nolan"},
+		{name: "search id", body: `{"search_id":"s1","movie_id":"m1"}`, wantStatus: http.StatusAccepted},
+		{name: "neither", body: `{"movie_id":"m1","position":1}`, wantStatus: http.StatusBadRequest},
+		{name: "negative position", body: `{"query":"nolan","movie_id":"m1","position":-1}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &searchLogger{queue: make(chan searchLogEntry, 1)}
+			w := serve(handleRecordClick(logger), http.MethodPost, "/analytics/click", "/analytics/click", tc.body)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusAccepted {
+				if len(logger.queue) != 0 {
+					t.Fatalf("expected nothing recorded")
+				}
+				return
+			}
+			entry := <-logger.queue
+			if entry.Event != "click" || entry.MovieID != "m1" || entry.Query != tc.wantQuery {
+				t.Fatalf("expected a click on m1 for %q, got %+v", tc.wantQuery, entry)
+			}
+		})
+	}
+}
+
+func TestClickRate(t *testing.T) {
+	if got := clickRate(1, 3); got != 0.333 {
+		t.Fatalf("expected 0.333, got %v", got)
+	}
+	if got := clickRate(4, 0); got != 0 {
+		t.Fatalf("expected 0 without searches, got %v", got)
+	}
+}
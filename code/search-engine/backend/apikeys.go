@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// roleEditor may change the catalog; roleAdmin may also use /api/admin.
+	roleEditor = "editor"
+	roleAdmin  = "admin"
+	// apiKeyContextKey holds the name of the key a request used.
+	apiKeyContextKey = "api_key"
+)
+
+var roleRank = map[string]int{roleEditor: 1, roleAdmin: 2}
+
+// apiKey keeps only the SHA-256 of the key, so a keys file never holds the keys themselves.
+type apiKey struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	KeySHA256 string `json:"key_sha256"`
+	hash      []byte
+}
+
+var apiKeys []apiKey
+
+// loadAPIKeys reads API_KEYS, a comma-separated list of name:role:key, and
+// API_KEYS_FILE, a JSON list of keys with their SHA-256. ADMIN_TOKEN stays an
+// admin key on its own.
+func loadAPIKeys() error {
+	apiKeys = nil
+	if value := os.Getenv("API_KEYS"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+			if len(parts) != 3 || parts[2] == "" {
+				return fmt.Errorf("invalid API_KEYS entry %q: must be name:role:key", entry)
+			}
+			sum := sha256.Sum256([]byte(parts[2]))
+			if err := addAPIKey(apiKey{Name: parts[0], Role: parts[1], KeySHA256: hex.EncodeToString(sum[:])}); err != nil {
+				return fmt.Errorf("API_KEYS: %w", err)
+			}
+		}
+	}
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read API_KEYS_FILE: %w", err)
+		}
+		var keys []apiKey
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return fmt.Errorf("decode API_KEYS_FILE: %w", err)
+		}
+		for _, key := range keys {
+			if err := addAPIKey(key); err != nil {
+				return fmt.Errorf("API_KEYS_FILE: %w", err)
+			}
+		}
+	}
+	if !writesProtected() {
+		log.Printf("no ADMIN_TOKEN or API_KEYS set: catalog writes are open to anyone and admin endpoints are off")
+	}
+	return nil
+}
+
+func addAPIKey(key apiKey) error {
+	if key.Name == "" {
+		return fmt.Errorf("every key needs a name")
+	}
+	if _, ok := roleRank[key.Role]; !ok {
+		return fmt.Errorf("key %s: role must be %s or %s", key.Name, roleEditor, roleAdmin)
+	}
+	hash, err := hex.DecodeString(key.KeySHA256)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("key %s: key_sha256 must be a hex SHA-256", key.Name)
+	}
+	key.hash = hash
+	apiKeys = append(apiKeys, key)
+	return nil
+}
+
+func writesProtected() bool {
+	return auth.adminToken != "" || len(apiKeys) > 0
+}
+
+// presentedKey reads X-API-Key, or a bearer token as ADMIN_TOKEN always was.
+func presentedKey(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("X-API-Key")); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// authenticateKey compares against every key, so the time taken does not tell which one nearly matched.
+func authenticateKey(presented string) (apiKey, bool) {
+	var found apiKey
+	ok := false
+	if presented == "" {
+		return found, false
+	}
+	if auth.adminToken != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(auth.adminToken)) == 1 {
+		found, ok = apiKey{Name: "ADMIN_TOKEN", Role: roleAdmin}, true
+	}
+	sum := sha256.Sum256([]byte(presented))
+	for _, key := range apiKeys {
+		if subtle.ConstantTimeCompare(sum[:], key.hash) == 1 && !ok {
+			found, ok = key, true
+		}
+	}
+	return found, ok
+}
+
+// requireRole answers 401 without a valid key and 403 when the key's role is
+// too low. With no keys configured, editor routes stay open and admin routes
+// are off.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !writesProtected() {
+			if role == roleEditor {
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled, set ADMIN_TOKEN or API_KEYS to enable them"})
+			return
+		}
+		key, ok := authenticateKey(presentedKey(c))
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			return
+		}
+		if roleRank[key.Role] < roleRank[role] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this API key needs the " + role + " role"})
+			return
+		}
+		c.Set(apiKeyContextKey, key.Name)
+		c.Next()
+	}
+}
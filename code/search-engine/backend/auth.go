@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	userIndex = "users"
+	// userContextKey holds the signed-in username on the gin context.
+	userContextKey = "user"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.-]{3,32}$`)
+
+// auth signs tokens as "<username>|<expiry>" with HMAC-SHA256, so checking
+// one needs no lookup.
+var auth struct {
+	secret     []byte
+	ttl        time.Duration
+	adminToken string
+}
+
+func loadAuth() error {
+	auth.adminToken = strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+	auth.ttl = 7 * 24 * time.Hour
+	if value := os.Getenv("AUTH_TOKEN_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid AUTH_TOKEN_TTL %q: must be a positive duration such as 24h", value)
+		}
+		auth.ttl = ttl
+	}
+	if secret := os.Getenv("AUTH_SECRET"); secret != "" {
+		auth.secret = []byte(secret)
+		return nil
+	}
+	auth.secret = make([]byte, 32)
+	if _, err := rand.Read(auth.secret); err != nil {
+		return fmt.Errorf("generate auth secret: %w", err)
+	}
+	log.Printf("AUTH_SECRET is not set, sign-ins will not survive a restart")
+	return nil
+}
+
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Watchlist    []string  `json:"watchlist"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type credentials struct {
+	Username string `json:"username" binding:"required"`
+	// bcrypt only reads the first 72 bytes.
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+func ensureUserIndexes(ctx context.Context, es *elasticsearch.Client) error {
+	indexes := map[string]map[string]interface{}{
+		userIndex: {
+			"username":      map[string]interface{}{"type": "keyword"},
+			"password_hash": map[string]interface{}{"type": "keyword", "index": false},
+			"watchlist":     map[string]interface{}{"type": "keyword"},
+			"created_at":    map[string]interface{}{"type": "date"},
+		},
+		savedSearchIndex: {
+			"user":       map[string]interface{}{"type": "keyword"},
+			"name":       map[string]interface{}{"type": "keyword"},
+			"params":     map[string]interface{}{"type": "object", "enabled": false},
+			"created_at": map[string]interface{}{"type": "date"},
+		},
+	}
+	for name, properties := range indexes {
+		exists, err := es.Indices.Exists([]string{name}, es.Indices.Exists.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("check %s index exists: %w", name, err)
+		}
+		exists.Body.Close()
+		if exists.StatusCode != http.StatusNotFound {
+			continue
+		}
+		body, err := encodeBody(map[string]interface{}{"mappings": map[string]interface{}{"properties": properties}})
+		if err != nil {
+			return err
+		}
+		res, err := es.Indices.Create(name, es.Indices.Create.WithBody(body), es.Indices.Create.WithContext(ctx))
+		if err := esCall(res, err, "create "+name+" index"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func issueToken(username string) (string, time.Time) {
+	expires := time.Now().Add(auth.ttl).UTC().Truncate(time.Second)
+	payload := username + "|" + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + signToken(payload), expires
+}
+
+func signToken(payload string) string {
+	mac := hmac.New(sha256.New, auth.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifyToken(token string) (string, bool) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(signToken(string(payload)))) {
+		return "", false
+	}
+	username, expiry, ok := strings.Cut(string(payload), "|")
+	if !ok {
+		return "", false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().After(time.Unix(unix, 0)) {
+		return "", false
+	}
+	return username, true
+}
+
+func requireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		username, valid := verifyToken(strings.TrimSpace(token))
+		if !ok || !valid {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "sign in required"})
+			return
+		}
+		c.Set(userContextKey, username)
+		c.Next()
+	}
+}
+
+// requireAdmin guards /api/admin, which needs an admin key or ADMIN_TOKEN.
+func requireAdmin() gin.HandlerFunc {
+	return requireRole(roleAdmin)
+}
+
+func currentUser(c *gin.Context) string {
+	return c.GetString(userContextKey)
+}
+
+func handleRegister(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input credentials
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		username := strings.ToLower(strings.TrimSpace(input.Username))
+		if !usernamePattern.MatchString(username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "username must be 3-32 letters, digits, '.', '_', or '-'"})
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+			return
+		}
+		body, err := encodeBody(User{
+			Username:     username,
+			PasswordHash: string(hash),
+			Watchlist:    []string{},
+			CreatedAt:    time.Now().UTC(),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode user"})
+			return
+		}
+		// The username is the document id, so create fails on a taken name.
+		res, err := es.Create(userIndex, username, body,
+			es.Create.WithRefresh("true"),
+			es.Create.WithContext(c.Request.Context()))
+		if err == nil && res.StatusCode == http.StatusConflict {
+			res.Body.Close()
+			c.JSON(http.StatusConflict, gin.H{"error": "username is taken"})
+			return
+		}
+		if err := esCall(res, err, "create user"); err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+			return
+		}
+
+		token, expires := issueToken(username)
+		c.JSON(http.StatusCreated, gin.H{"username": username, "token": token, "expires_at": expires})
+	}
+}
+
+func handleLogin(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input credentials
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		username := strings.ToLower(strings.TrimSpace(input.Username))
+
+		user, err := getUser(c.Request.Context(), es, username)
+		if err != nil && !errors.Is(err, errUserNotFound) {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+			return
+		}
+		if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+			return
+		}
+
+		token, expires := issueToken(username)
+		c.JSON(http.StatusOK, gin.H{"username": username, "token": token, "expires_at": expires})
+	}
+}
+
+var errUserNotFound = errors.New("user not found")
+
+func getUser(ctx context.Context, es *elasticsearch.Client, username string) (User, error) {
+	var doc struct {
+		Source User `json:"_source"`
+	}
+	if !usernamePattern.MatchString(username) {
+		return doc.Source, errUserNotFound
+	}
+	res, err := es.Get(userIndex, username, es.Get.WithContext(ctx))
+	if err != nil {
+		return doc.Source, fmt.Errorf("get user: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return doc.Source, errUserNotFound
+	}
+	if res.IsError() {
+		return doc.Source, fmt.Errorf("get user response error: %s", res.String())
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return doc.Source, fmt.Errorf("decode user: %w", err)
+	}
+	return doc.Source, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := auth.adminToken
+	defer func() { auth.adminToken = original }()
+
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		wantStatus int
+	}{
+		{name: "disabled without ADMIN_TOKEN", adminToken: "", header: "Bearer anything", wantStatus: http.StatusForbidden},
+		{name: "missing token", adminToken: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", adminToken: "secret", header: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "user token scheme", adminToken: "secret", header: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "admin token", adminToken: "secret", header: "Bearer secret", wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			auth.adminToken = tc.adminToken
+			router := gin.New()
+			router.GET("/api/admin/analytics", requireAdmin(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/analytics", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(token string) { auth.adminToken = token }(auth.adminToken)
+	defer func() { apiKeys = nil }()
+	t.Setenv("API_KEYS", "ci:editor:edit-key,ops:admin:admin-key")
+	t.Setenv("API_KEYS_FILE", "")
+	auth.adminToken = ""
+	if err := loadAPIKeys(); err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, c.GetString(apiKeyContextKey)) }
+	router.POST("/api/movies", requireRole(roleEditor), ok)
+	router.GET("/api/admin/analytics", requireRole(roleAdmin), ok)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+		wantKey    string
+	}{
+		{name: "write without key", path: "/api/movies", wantStatus: http.StatusUnauthorized},
+		{name: "write with unknown key", path: "/api/movies", header: "X-API-Key", value: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "write with editor key", path: "/api/movies", header: "X-API-Key", value: "edit-key", wantStatus: http.StatusOK, wantKey: "ci"},
+		{name: "write with bearer admin key", path: "/api/movies", header: "Authorization", value: "Bearer admin-key", wantStatus: http.StatusOK, wantKey: "ops"},
+		{name: "admin with editor key", path: "/api/admin/analytics", header: "X-API-Key", value: "edit-key", wantStatus: http.StatusForbidden},
+		{name: "admin with admin key", path: "/api/admin/analytics", header: "X-API-Key", value: "admin-key", wantStatus: http.StatusOK, wantKey: "ops"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			method := http.MethodPost
+			if tc.path == "/api/admin/analytics" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+			if tc.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatalf("expected WWW-Authenticate on a 401")
+			}
+			if tc.wantKey != "" && w.Body.String() != tc.wantKey {
+				t.Fatalf("expected key %s, got %s", tc.wantKey, w.Body.String())
+			}
+		})
+	}
+
+	apiKeys = nil
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/movies", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected writes open without any keys, got %d", w.Code)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	defer func() { apiKeys = nil }()
+	file := filepath.Join(t.TempDir(), "keys.json")
+	hash := sha256.Sum256([]byte("file-key"))
+	os.WriteFile(file, []byte(`[{"name":"deploy","role":"admin","key_sha256":"`+hex.EncodeToString(hash[:])+`"}]`), 0o600)
+
+	tests := []struct {
+		name    string
+		keys    string
+		file    string
+		wantErr bool
+	}{
+		{name: "env and file", keys: "ci:editor:edit-key", file: file},
+		{name: "missing key", keys: "ci:editor:", wantErr: true},
+		{name: "unknown role", keys: "ci:owner:key", wantErr: true},
+		{name: "missing file", file: filepath.Join(t.TempDir(), "none.json"), wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", tc.keys)
+			t.Setenv("API_KEYS_FILE", tc.file)
+			err := loadAPIKeys()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if key, ok := authenticateKey("file-key"); !ok || key.Name != "deploy" || key.Role != roleAdmin {
+				t.Fatalf("expected the file key to authenticate, got %+v", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompressResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(compressResponses())
+	router.GET("/api/movies", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"movies": strings.Repeat("heat ", 100)})
+	})
+	router.GET("/api/posters/m1", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/jpeg", []byte("jpeg"))
+	})
+	router.GET("/api/admin/export", func(c *gin.Context) {
+		c.Header("Content-Type", "application/x-ndjson")
+		for i := 0; i < 2; i++ {
+			c.Writer.WriteString(`{"_id":"m1"}` + "\n")
+			c.Writer.Flush()
+		}
+	})
+	router.GET("/api/empty", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		target   string
+		accept   string
+		wantGzip bool
+		wantBody string
+	}{
+		{name: "json", target: "/api/movies", accept: "gzip, deflate", wantGzip: true, wantBody: "heat heat"},
+		{name: "gzip refused", target: "/api/movies", accept: "gzip;q=0", wantBody: "heat heat"},
+		{name: "no accept-encoding", target: "/api/movies", wantBody: "heat heat"},
+		{name: "image", target: "/api/posters/m1", accept: "gzip", wantBody: "jpeg"},
+		{name: "streamed ndjson", target: "/api/admin/export", accept: "gzip", wantGzip: true, wantBody: "{\"_id\":\"m1\"}\n{\"_id\":\"m1\"}\n"},
+		{name: "no content", target: "/api/empty", accept: "gzip"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept-Encoding", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tc.wantGzip {
+				t.Fatalf("expected gzip %v, got headers %v", tc.wantGzip, w.Header())
+			}
+			body := w.Body.String()
+			if gzipped {
+				reader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("read gzip: %v", err)
+				}
+				decoded, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("read gzip: %v", err)
+				}
+				body = string(decoded)
+			}
+			if !strings.Contains(body, tc.wantBody) {
+				t.Fatalf("expected %q in the body, got %q", tc.wantBody, body)
+			}
+		})
+	}
+}
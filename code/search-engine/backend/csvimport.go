@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCSVMappingBytes bounds the mapping and delimiter fields, which come before the file.
+const maxCSVMappingBytes = 64 << 10
+
+// The movie fields a spreadsheet column can fill. List columns separate items
+// with |, and credits are written Name or Name: Role, as in seed files.
+var csvFields = map[string]bool{
+	"id": true, "title": true, "description": true, "genres": true, "rating": true, "release_year": true,
+	"poster_url": true, "directors": true, "cast": true, "crew": true, "collection": true,
+	"providers": true,
+}
+
+// CSVImportError reports a row that was skipped, by field, or a batch
+// Elasticsearch partly rejected.
+type CSVImportError struct {
+	Row    int               `json:"row,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// csvMapping says which column fills each movie field.
+type csvMapping map[string]int
+
+// newCSVMapping resolves field-to-column names against the header. Without a
+// spec, columns named like movie fields are used.
+func newCSVMapping(spec map[string]string, header []string) (csvMapping, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheet apps often start a UTF-8 file with a byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, seen := columns[name]; !seen {
+			columns[name] = i
+		}
+	}
+	mapping := csvMapping{}
+	if len(spec) == 0 {
+		for field := range csvFields {
+			if i, ok := columns[field]; ok {
+				mapping[field] = i
+			}
+		}
+	}
+	for field, column := range spec {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !csvFields[field] {
+			return nil, fmt.Errorf("mapping: %q is not a movie field", field)
+		}
+		i, ok := columns[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			return nil, fmt.Errorf("mapping: the file has no %q column for %s", column, field)
+		}
+		mapping[field] = i
+	}
+	if _, ok := mapping["title"]; !ok {
+		return nil, errors.New("mapping: no column is mapped to title")
+	}
+	return mapping, nil
+}
+
+func (m csvMapping) has(field string) bool {
+	_, ok := m[field]
+	return ok
+}
+
+// movie builds a row's movie and collects every problem with it.
+func (m csvMapping) movie(record []string) (Movie, map[string]string) {
+	value := func(field string) string {
+		if i, ok := m[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	movie := Movie{
+		Title:       value("title"),
+		Description: value("description"),
+		Genres:      splitSeedList(value("genres")),
+		PosterURL:   value("poster_url"),
+		Directors:   parseSeedCredits(value("directors")),
+		Cast:        parseSeedCredits(value("cast")),
+		Crew:        parseSeedCredits(value("crew")),
+		Collection:  value("collection"),
+		Providers:   splitSeedList(value("providers")),
+	}
+	fields := map[string]string{}
+	if raw := value("rating"); raw != "" {
+		rating, err := strconv.ParseFloat(strings.Replace(raw, ",", ".", 1), 64)
+		if err != nil {
+			fields["rating"] = "must be a number"
+		}
+		movie.Rating = rating
+	}
+	if raw := value("release_year"); raw != "" {
+		year, err := strconv.Atoi(raw)
+		if err != nil {
+			fields["release_year"] = "must be a year"
+		}
+		movie.ReleaseYear = year
+	}
+	for field, message := range movieFieldErrors(&movie) {
+		if _, ok := fields[field]; !ok {
+			fields[field] = message
+		}
+	}
+	movie.ID = csvMovieID(value("id"), movie)
+	return movie, fields
+}
+
+// csvMovieID keeps ids stable across uploads, so loading a corrected
+// spreadsheet again updates its movies instead of adding copies.
+func csvMovieID(id string, movie Movie) string {
+	if id != "" {
+		return "csv-" + id
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(movie.Title) + "\x00" + strconv.Itoa(movie.ReleaseYear)))
+	return "csv-" + hex.EncodeToString(sum[:8])
+}
+
+func parseCSVDelimiter(value string) (rune, error) {
+	switch value {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	delimiter, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+		return 0, errors.New("delimiter must be a single character such as , or ; or tab")
+	}
+	return delimiter, nil
+}
+
+// handleImportCSV reads a multipart upload: an optional mapping field, a JSON
+// object of movie field to column name, an optional delimiter, and then the
+// file. The file is parsed as it arrives and written in batches, so the
+// mapping has to come first. Rows that fail validation are skipped and
+// reported; the rest are upserted.
+func handleImportCSV(es *elasticsearch.Client, alerts *alertDispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "send the file as multipart/form-data"})
+			return
+		}
+		var spec map[string]string
+		delimiter := ','
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "the upload has no file field"})
+				return
+			}
+			if err != nil {
+				if !bodyTooLarge(c, err) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				}
+				return
+			}
+			switch part.FormName() {
+			case "mapping", "delimiter":
+				value, err := io.ReadAll(io.LimitReader(part, maxCSVMappingBytes))
+				if err != nil {
+					if !bodyTooLarge(c, err) {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					}
+					return
+				}
+				if part.FormName() == "delimiter" {
+					if delimiter, err = parseCSVDelimiter(string(value)); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
+				} else if len(strings.TrimSpace(string(value))) > 0 {
+					if err := json.Unmarshal(value, &spec); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of movie field to column name"})
+						return
+					}
+				}
+			case "file":
+				importCSV(c, es, alerts, part, spec, delimiter)
+				return
+			}
+			part.Close()
+		}
+	}
+}
+
+func importCSV(c *gin.Context, es *elasticsearch.Client, alerts *alertDispatcher, file io.Reader, spec map[string]string, delimiter rune) {
+	ctx := c.Request.Context()
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the file is empty"})
+		} else if !bodyTooLarge(c, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("read header: %v", err)})
+		}
+		return
+	}
+	mapping, err := newCSVMapping(spec, header)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, imported, failed := 0, 0, 0
+	errs := []CSVImportError{}
+	report := func(importErr CSVImportError) {
+		if len(errs) < maxImportErrors {
+			errs = append(errs, importErr)
+		}
+	}
+	var batch []Movie
+	var batchRows []int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		batchFailed, created, err := upsertMovies(ctx, es, batch, mapping.has("directors") || mapping.has("cast") || mapping.has("crew"))
+		if err != nil {
+			return err
+		}
+		if batchFailed > 0 {
+			report(CSVImportError{Error: fmt.Sprintf("rows %d-%d: %d movies rejected", batchRows[0], batchRows[len(batchRows)-1], batchFailed)})
+		}
+		imported += len(batch) - batchFailed
+		failed += batchFailed
+		alerts.moviesAdded(moviesWithIDs(batch, created)...)
+		batch, batchRows = nil, nil
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if bodyTooLarge(c, err) {
+				return
+			}
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "imported": imported})
+				return
+			}
+			// A malformed row, such as a stray quote, is skipped like an invalid one.
+			rows++
+			failed++
+			report(CSVImportError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		rows++
+		row, _ := reader.FieldPos(0)
+		movie, fields := mapping.movie(record)
+		if len(fields) > 0 {
+			failed++
+			report(CSVImportError{Row: row, Fields: fields})
+			continue
+		}
+		batch = append(batch, movie)
+		batchRows = append(batchRows, row)
+		if len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				log.Printf("csv import: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "bulk request failed", "imported": imported})
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		log.Printf("csv import: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "bulk request failed", "imported": imported})
+		return
+	}
+	if rows == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the file has no rows"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rows": rows, "imported": imported, "failed": failed, "errors": errs})
+}
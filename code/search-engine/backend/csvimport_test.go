@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewCSVMapping(t *testing.T) {
+	header := []string{"\ufeffName", "Year", "title"}
+	tests := []struct {
+		name    string
+		spec    map[string]string
+		want    csvMapping
+		wantErr string
+	}{
+		{name: "spec", spec: map[string]string{"title": "name", "Release_Year": " Year "}, want: csvMapping{"title": 0, "release_year": 1}},
+		{name: "field names", want: csvMapping{"title": 2}},
+		{name: "unknown field", spec: map[string]string{"title": "Name", "budget": "Year"}, wantErr: `"budget" is not a movie field`},
+		{name: "missing column", spec: map[string]string{"title": "Movie"}, wantErr: `no "Movie" column`},
+		{name: "no title", spec: map[string]string{"release_year": "Year"}, wantErr: "no column is mapped to title"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newCSVMapping(tc.spec, header)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil || len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v (%v)", tc.want, got, err)
+			}
+			for field, column := range tc.want {
+				if got[field] != column {
+					t.Fatalf("expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleImportCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var bulk []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			json.Unmarshal(scanner.Bytes(), &line)
+			bulk = append(bulk, line)
+		}
+		w.Write([]byte(`{"items":[{"update":{"_id":"a","result":"updated"}},{"update":{"_id":"b","result":"updated"}}]}`))
+	}))
+	defer server.Close()
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("mapping", `{"title":"Name","release_year":"Year","rating":"Score","genres":"Genres"}`)
+	form.WriteField("delimiter", ";")
+	file, _ := form.CreateFormFile("file", "movies.csv")
+	io.WriteString(file, "\ufeffName;Year;Score;Genres\nHeat;1995;8,3;Crime|Drama\nAlien;1979;great;Horror\n;2001;7;\nTenet;2020;7.3;Sci-Fi\n")
+	form.Close()
+
+	router := gin.New()
+	router.POST("/import/csv", handleImportCSV(es, &alertDispatcher{queue: make(chan []Movie, 1)}))
+	req := httptest.NewRequest(http.MethodPost, "/import/csv", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Rows     int              `json:"rows"`
+		Imported int              `json:"imported"`
+		Failed   int              `json:"failed"`
+		Errors   []CSVImportError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Rows != 4 || response.Imported != 2 || response.Failed != 2 || len(response.Errors) != 2 {
+		t.Fatalf("expected 2 of 4 rows imported, got %+v", response)
+	}
+	if response.Errors[0].Row != 3 || response.Errors[0].Fields["rating"] != "must be a number" {
+		t.Fatalf("expected row 3 rejected for its rating, got %+v", response.Errors[0])
+	}
+	if response.Errors[1].Row != 4 || response.Errors[1].Fields["title"] == "" {
+		t.Fatalf("expected row 4 rejected for its title, got %+v", response.Errors[1])
+	}
+
+	if len(bulk) != 4 {
+		t.Fatalf("expected 2 bulk updates, got %v", bulk)
+	}
+	doc := bulk[1]["doc"].(map[string]interface{})
+	if doc["title"] != "Heat" || doc["rating"] != 8.3 || doc["release_year"] != 1995.0 || len(doc["genres"].([]interface{})) != 2 {
+		t.Fatalf("expected Heat with its rating and genres, got %v", doc)
+	}
+	id := bulk[0]["update"].(map[string]interface{})["_id"].(string)
+	if id != csvMovieID("", Movie{Title: "Heat", ReleaseYear: 1995}) {
+		t.Fatalf("expected a stable csv id, got %q", id)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxResultWindow is Elasticsearch's default index.max_result_window, the
+	// deepest from+size a search may reach.
+	maxResultWindow = 10000
+	// pitKeepAlive is how long a point in time survives between pages. Each
+	// page extends it.
+	pitKeepAlive = "2m"
+)
+
+var errInvalidCursor = errors.New("cursor is invalid")
+
+type searchCursor struct {
+	PIT      string            `json:"pit"`
+	After    []json.RawMessage `json:"after"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"size"`
+	Params   string            `json:"params"`
+}
+
+func encodeCursor(cursor searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (searchCursor, error) {
+	var cursor searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.PIT == "" || len(cursor.After) == 0 || cursor.Page < 1 || cursor.PageSize < 1 {
+		return searchCursor{}, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// searchParamsFingerprint stops a cursor being replayed against a different
+// search.
+func searchParamsFingerprint(c *gin.Context) string {
+	params := []string{
+		c.Query("q"),
+		strings.TrimSpace(c.Query("person")),
+		strings.ToLower(strings.Join(queryGenres(c), ",")),
+		strings.ToLower(strings.Join(queryProviders(c), ",")),
+		strings.ToLower(strings.TrimSpace(c.Query("sort"))),
+		strings.ToLower(strings.TrimSpace(c.Query("order"))),
+		strings.ToUpper(strings.TrimSpace(c.DefaultQuery("fuzziness", defaultFuzziness))),
+		strings.ToLower(strings.TrimSpace(c.Query("lang"))),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(params, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func openPointInTime(ctx context.Context, es *elasticsearch.Client, index string) (string, error) {
+	if searchEngine == engineOpenSearch {
+		return openOpenSearchPointInTime(ctx, es, index)
+	}
+	var pit struct {
+		ID string `json:"id"`
+	}
+	res, err := es.OpenPointInTime([]string{index}, pitKeepAlive, es.OpenPointInTime.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("open point in time: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", fmt.Errorf("open point in time response error: %s", res.String())
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pit); err != nil {
+		return "", fmt.Errorf("decode point in time: %w", err)
+	}
+	return pit.ID, nil
+}
+
+// closePointInTime releases a point in time. Failures only cost resources
+// until the keep-alive runs out.
+func closePointInTime(es *elasticsearch.Client, id string) {
+	if searchEngine == engineOpenSearch {
+		closeOpenSearchPointInTime(es, id)
+		return
+	}
+	body, err := encodeBody(map[string]interface{}{"id": id})
+	if err != nil {
+		log.Printf("close point in time: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := es.ClosePointInTime(es.ClosePointInTime.WithBody(body), es.ClosePointInTime.WithContext(ctx))
+	if err := esCall(res, err, "close point in time"); err != nil {
+		log.Printf("%v", err)
+	}
+}
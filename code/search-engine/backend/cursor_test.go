@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := searchCursor{
+		PIT:      "pit-id",
+		After:    []json.RawMessage{json.RawMessage(`8.8`), json.RawMessage(`"inception"`), json.RawMessage(`42`)},
+		Page:     3,
+		PageSize: 10,
+		Params:   "abc123",
+	}
+
+	decoded, err := decodeCursor(encodeCursor(cursor))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, cursor) {
+		t.Fatalf("expected %+v, got %+v", cursor, decoded)
+	}
+}
+
+func TestDecodeCursorRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "not base64", value: "%%%"},
+		{name: "not json", value: "bm90IGpzb24"},
+		{name: "missing pit", value: encodeCursor(searchCursor{After: []json.RawMessage{json.RawMessage(`1`)}, Page: 1, PageSize: 5})},
+		{name: "missing sort values", value: encodeCursor(searchCursor{PIT: "pit-id", Page: 1, PageSize: 5})},
+		{name: "zero page", value: encodeCursor(searchCursor{PIT: "pit-id", After: []json.RawMessage{json.RawMessage(`1`)}, PageSize: 5})},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := decodeCursor(tc.value); err != errInvalidCursor {
+				t.Fatalf("expected errInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSearchParamsFingerprint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fingerprint := func(url string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, url, nil)
+		return searchParamsFingerprint(c)
+	}
+
+	base := fingerprint("/api/movies?q=nolan&sort=rating")
+	if got := fingerprint("/api/movies?q=nolan&sort=RATING&page=4&pageSize=20"); got != base {
+		t.Fatalf("expected paging and sort case to be ignored, got %s and %s", base, got)
+	}
+	if got := fingerprint("/api/movies?q=nolan&sort=rating&fuzziness=AUTO"); got != base {
+		t.Fatalf("expected the default fuzziness to match an explicit one, got %s and %s", base, got)
+	}
+	for _, url := range []string{
+		"/api/movies?q=batman&sort=rating",
+		"/api/movies?q=nolan&sort=release_year",
+		"/api/movies?q=nolan&sort=rating&order=asc",
+		"/api/movies?q=nolan&sort=rating&person=Hans+Zimmer",
+		"/api/movies?q=nolan&sort=rating&fuzziness=0",
+	} {
+		if fingerprint(url) == base {
+			t.Fatalf("expected %s to have a different fingerprint", url)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxRandomMovies = 10
+
+// discoverFilters reads the genre, provider, year_from, year_to, and min_rating filters shared by random and discover.
+func discoverFilters(c *gin.Context) ([]map[string]interface{}, error) {
+	filter := []map[string]interface{}{notDeleted()}
+	if genres := queryGenres(c); len(genres) > 0 {
+		filter = append(filter, genreFilter(genres))
+	}
+	if providers := queryProviders(c); len(providers) > 0 {
+		filter = append(filter, providerFilter(providers))
+	}
+	years := map[string]interface{}{}
+	for param, bound := range map[string]string{"year_from": "gte", "year_to": "lte"} {
+		if value := c.Query(param); value != "" {
+			year, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a year", param)
+			}
+			years[bound] = year
+		}
+	}
+	if len(years) > 0 {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"release_year": years}})
+	}
+	if value := c.Query("min_rating"); value != "" {
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil || rating < 0 || rating > 10 {
+			return nil, fmt.Errorf("min_rating must be a number from 0 to 10")
+		}
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"rating": map[string]interface{}{"gte": rating}}})
+	}
+	return filter, nil
+}
+
+type discoverResult struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []searchHit `json:"hits"`
+	} `json:"hits"`
+}
+
+func (r discoverResult) movies() []Movie {
+	movies := make([]Movie, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		movie := mapToMovie(hit.Source)
+		movie.ID = hit.ID
+		movies = append(movies, movie)
+	}
+	return movies
+}
+
+// handleRandomMovies picks movies at random, a fresh draw on every request.
+func handleRandomMovies(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := discoverFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		size := parseIntWithDefault(c.Query("size"), 1)
+		if size <= 0 || size > maxRandomMovies {
+			size = 1
+		}
+
+		var result discoverResult
+		err = repo.Search(c.Request.Context(), movieIndex, map[string]interface{}{
+			"size":    size,
+			"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+			"query": map[string]interface{}{"function_score": map[string]interface{}{
+				"query":        map[string]interface{}{"bool": map[string]interface{}{"filter": filter}},
+				"random_score": map[string]interface{}{},
+				"boost_mode":   "replace",
+			}},
+		}, &result)
+		if err != nil {
+			log.Printf("random movies: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"movies": result.movies()})
+	}
+}
+
+// handleDiscoverMovies shuffles the filtered movies in an order fixed by seed, so
+// paging through a shuffle neither repeats nor skips movies unless they are
+// edited meanwhile. Boosted genres and, with boost_rated, better-rated movies
+// come up earlier.
+func handleDiscoverMovies(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := discoverFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		page, pageSize := pageParams(c)
+		if page*pageSize > maxResultWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page goes past the first %d results", maxResultWindow)})
+			return
+		}
+		seed := rand.Int63n(1 << 31)
+		if value := c.Query("seed"); value != "" {
+			if seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "seed must be a whole number"})
+				return
+			}
+		}
+
+		functions := []map[string]interface{}{
+			{"random_score": map[string]interface{}{"seed": seed, "field": "_seq_no"}},
+		}
+		if boosted := queryList(c, "boost_genre"); len(boosted) > 0 {
+			functions = append(functions, map[string]interface{}{"filter": genreFilter(boosted), "weight": 2})
+		}
+		if c.Query("boost_rated") == "true" {
+			functions = append(functions, map[string]interface{}{
+				"field_value_factor": map[string]interface{}{"field": "rating", "modifier": "log1p", "missing": 0},
+			})
+		}
+
+		var result discoverResult
+		err = repo.Search(c.Request.Context(), movieIndex, map[string]interface{}{
+			"from":    (page - 1) * pageSize,
+			"size":    pageSize,
+			"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+			"query": map[string]interface{}{"function_score": map[string]interface{}{
+				"query":      map[string]interface{}{"bool": map[string]interface{}{"filter": filter}},
+				"functions":  functions,
+				"score_mode": "multiply",
+				"boost_mode": "replace",
+			}},
+		}, &result)
+		if err != nil {
+			log.Printf("discover movies: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+		totalHits := result.Hits.Total.Value
+		c.JSON(http.StatusOK, gin.H{
+			"seed":   seed,
+			"movies": result.movies(),
+			"pagination": Pagination{
+				Page:       page,
+				PageSize:   pageSize,
+				TotalHits:  totalHits,
+				TotalPages: (totalHits + pageSize - 1) / pageSize,
+			},
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleDiscoverMovies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name          string
+		target        string
+		wantStatus    int
+		wantSeed      float64
+		wantFilters   int
+		wantFunctions int
+	}{
+		{name: "seeded shuffle", target: "/movies/discover?seed=42", wantStatus: http.StatusOK, wantSeed: 42, wantFilters: 1, wantFunctions: 1},
+		{
+			name:       "filters and boosts",
+			target:     "/movies/discover?seed=7&genre=Drama&year_from=1990&year_to=1999&min_rating=7&boost_genre=Crime&boost_rated=true",
+			wantStatus: http.StatusOK, wantSeed: 7, wantFilters: 4, wantFunctions: 3,
+		},
+		{name: "bad seed", target: "/movies/discover?seed=abc", wantStatus: http.StatusBadRequest},
+		{name: "bad year", target: "/movies/discover?year_from=nineties", wantStatus: http.StatusBadRequest},
+		{name: "rating out of range", target: "/movies/discover?min_rating=11", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			w := serve(handleDiscoverMovies(repo), http.MethodGet, "/movies/discover", tc.target, "")
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Seed float64 `json:"seed"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if response.Seed != tc.wantSeed {
+				t.Fatalf("expected seed %v echoed back, got %v", tc.wantSeed, response.Seed)
+			}
+			score := repo.searches[0]["query"].(map[string]interface{})["function_score"].(map[string]interface{})
+			functions := score["functions"].([]interface{})
+			if len(functions) != tc.wantFunctions {
+				t.Fatalf("expected %d score functions, got %v", tc.wantFunctions, functions)
+			}
+			random := functions[0].(map[string]interface{})["random_score"].(map[string]interface{})
+			if random["seed"] != tc.wantSeed {
+				t.Fatalf("expected random_score seeded with %v, got %v", tc.wantSeed, random["seed"])
+			}
+			filters, _ := score["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].([]interface{})
+			if len(filters) != tc.wantFilters {
+				t.Fatalf("expected %d filters, got %v", tc.wantFilters, filters)
+			}
+		})
+	}
+}
+
+func TestHandleRandomMovies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"hits":{"total":{"value":5},"hits":[{"_id":"m3","_source":{"title":"Heat"}}]}}`, nil
+	}
+	w := serve(handleRandomMovies(repo), http.MethodGet, "/movies/random", "/movies/random?genre=Crime&size=50", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if size := repo.searches[0]["size"]; size != float64(1) {
+		t.Fatalf("expected an oversized request to fall back to one movie, got size %v", size)
+	}
+	var response struct {
+		Movies []Movie `json:"movies"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Movies) != 1 || response.Movies[0].ID != "m3" {
+		t.Fatalf("expected movie m3, got %+v", response.Movies)
+	}
+}
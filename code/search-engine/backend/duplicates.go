@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxDuplicateCandidates = 5
+	duplicateScanPageSize  = 1000
+)
+
+// checkDuplicates answers 409 with the movies the new one looks like, unless the
+// request passes force=true. It reports whether the handler should go on.
+func checkDuplicates(c *gin.Context, repo Repository, movie Movie) bool {
+	if c.Query("force") == "true" {
+		return true
+	}
+	duplicates, err := findDuplicates(c.Request.Context(), repo, movie)
+	if err != nil {
+		// A failed check should not block writes.
+		log.Printf("duplicate check: %v", err)
+		return true
+	}
+	if len(duplicates) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "a movie with a similar title and the same year exists, pass force=true to create it anyway",
+			"duplicates": duplicates,
+		})
+		return false
+	}
+	return true
+}
+
+// findDuplicates returns movies from the same year whose title is the same
+// as the movie's, give or take case, punctuation, a leading article, and a typo.
+func findDuplicates(ctx context.Context, repo Repository, movie Movie) ([]Movie, error) {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must": []map[string]interface{}{{
+				"match": map[string]interface{}{
+					"title": map[string]interface{}{"query": movie.Title, "fuzziness": "AUTO", "operator": "and"},
+				},
+			}},
+		},
+	}
+	if movie.ReleaseYear != 0 {
+		query["bool"].(map[string]interface{})["filter"] = []map[string]interface{}{
+			{"term": map[string]interface{}{"release_year": movie.ReleaseYear}},
+		}
+	}
+	body := map[string]interface{}{
+		"size":    maxDuplicateCandidates * 2,
+		"query":   withoutDeleted(query),
+		"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID     string                 `json:"_id"`
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := repo.Search(ctx, movieIndex, body, &result); err != nil {
+		return nil, fmt.Errorf("search duplicates: %w", err)
+	}
+	duplicates := []Movie{}
+	for _, hit := range result.Hits.Hits {
+		candidate := mapToMovie(hit.Source)
+		candidate.ID = hit.ID
+		if similarTitles(candidate.Title, movie.Title) && len(duplicates) < maxDuplicateCandidates {
+			duplicates = append(duplicates, candidate)
+		}
+	}
+	return duplicates, nil
+}
+
+type duplicateEntry struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	ReleaseYear int    `json:"release_year"`
+}
+
+// handleListDuplicates scans every title through a point in time and groups
+// movies from the same year with similar titles. Clusters come back largest first.
+func handleListDuplicates(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pits, ok := repo.(pointInTimes)
+		if !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "duplicate detection needs point in time support"})
+			return
+		}
+		ctx := c.Request.Context()
+		pitID, err := pits.OpenPointInTime(ctx, movieIndex)
+		if err != nil {
+			log.Printf("list duplicates: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to scan movies"})
+			return
+		}
+
+		byYear := map[int][]duplicateEntry{}
+		scanned := 0
+		var after []json.RawMessage
+		for {
+			body := map[string]interface{}{
+				"size":             duplicateScanPageSize,
+				"pit":              map[string]interface{}{"id": pitID, "keep_alive": pitKeepAlive},
+				"sort":             []interface{}{pitTiebreaker()},
+				"_source":          []string{"title", "release_year"},
+				"query":            notDeleted(),
+				"track_total_hits": false,
+			}
+			if after != nil {
+				body["search_after"] = after
+			}
+			page := &hitStream{each: func(id string, source json.RawMessage) error {
+				var doc struct {
+					Title       string `json:"title"`
+					ReleaseYear int    `json:"release_year"`
+				}
+				if err := json.Unmarshal(source, &doc); err != nil {
+					return err
+				}
+				byYear[doc.ReleaseYear] = append(byYear[doc.ReleaseYear], duplicateEntry{ID: id, Title: doc.Title, ReleaseYear: doc.ReleaseYear})
+				return nil
+			}}
+			if err := repo.Search(ctx, "", body, page); err != nil {
+				pits.ClosePointInTime(pitID)
+				log.Printf("list duplicates: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to scan movies"})
+				return
+			}
+			if page.PitID != "" {
+				pitID = page.PitID
+			}
+			scanned += page.count
+			if page.count < duplicateScanPageSize {
+				break
+			}
+			after = page.last
+		}
+		pits.ClosePointInTime(pitID)
+
+		clusters := [][]duplicateEntry{}
+		for _, entries := range byYear {
+			clusters = append(clusters, clusterTitles(entries)...)
+		}
+		sort.Slice(clusters, func(i, j int) bool {
+			if len(clusters[i]) != len(clusters[j]) {
+				return len(clusters[i]) > len(clusters[j])
+			}
+			return clusters[i][0].Title < clusters[j][0].Title
+		})
+		c.JSON(http.StatusOK, gin.H{"scanned": scanned, "clusters": clusters})
+	}
+}
+
+// clusterTitles groups entries whose titles are similar, directly or through
+// another entry, and drops the ones with no match.
+func clusterTitles(entries []duplicateEntry) [][]duplicateEntry {
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	normalized := make([]string, len(entries))
+	for i, entry := range entries {
+		normalized[i] = normalizeTitle(entry.Title)
+	}
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			if similarNormalized(normalized[i], normalized[j]) {
+				parent[root(i)] = root(j)
+			}
+		}
+	}
+
+	groups := map[int][]duplicateEntry{}
+	for i, entry := range entries {
+		groups[root(i)] = append(groups[root(i)], entry)
+	}
+	var clusters [][]duplicateEntry
+	for _, group := range groups {
+		if len(group) > 1 {
+			sort.Slice(group, func(i, j int) bool { return group[i].ID < group[j].ID })
+			clusters = append(clusters, group)
+		}
+	}
+	return clusters
+}
+
+func similarTitles(a, b string) bool {
+	return similarNormalized(normalizeTitle(a), normalizeTitle(b))
+}
+
+// Titles of up to four characters must match exactly. Longer ones allow a
+// typo, plus one more per ten characters.
+func similarNormalized(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	longest := len([]rune(a))
+	if n := len([]rune(b)); n > longest {
+		longest = n
+	}
+	if longest <= 4 {
+		return a == b
+	}
+	return editDistance(a, b) <= 1+longest/10
+}
+
+// normalizeTitle lowercases, turns punctuation into spaces, and drops a leading article.
+func normalizeTitle(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && (words[0] == "the" || words[0] == "a" || words[0] == "an") {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// editDistance counts insertions, deletions, substitutions, and swaps of neighbouring letters.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	rows := make([][]int, len(s)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(t)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(s)][len(t)]
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSimilarTitles(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "The Godfather", b: "godfather", want: true},
+		{a: "Spider-Man", b: "Spider Man", want: true},
+		{a: "Inception", b: "Inceptoin", want: true},
+		{a: "Heat", b: "Heal", want: false},
+		{a: "Rocky", b: "Rocky II", want: false},
+		{a: "Alien", b: "Aliens", want: true},
+		{a: "The Dark Knight", b: "The Dark Knight Rises", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			if got := similarTitles(tc.a, tc.b); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleCreateMovieDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "duplicate", target: "/movies", wantStatus: http.StatusConflict},
+		{name: "forced", target: "/movies?force=true", wantStatus: http.StatusCreated},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			repo.search = func(index string, body map[string]interface{}) (string, error) {
+				return `{"hits":{"hits":[{"_id":"m1","_source":{"title":"The Godfather","release_year":1972}},{"_id":"m2","_source":{"title":"The Godfather Part II","release_year":1972}}]}}`, nil
+			}
+			alerts := &alertDispatcher{queue: make(chan []Movie, 1)}
+			w := serve(handleCreateMovie(repo, alerts), http.MethodPost, "/movies", tc.target, `{"title":"Godfather","release_year":1972}`)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusConflict {
+				return
+			}
+			var response struct {
+				Duplicates []Movie `json:"duplicates"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(response.Duplicates) != 1 || response.Duplicates[0].ID != "m1" {
+				t.Fatalf("expected m1 as the only duplicate, got %+v", response.Duplicates)
+			}
+			if len(repo.docs[movieIndex]) != 0 {
+				t.Fatalf("expected nothing indexed, got %v", repo.docs[movieIndex])
+			}
+		})
+	}
+}
+
+func TestHandleListDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newPITRepository()
+	repo.docs[movieIndex] = map[string]map[string]interface{}{
+		"m1": {"title": "The Godfather", "release_year": 1972},
+		"m2": {"title": "Godfather", "release_year": 1972},
+		"m3": {"title": "Godfather", "release_year": 1990},
+		"m4": {"title": "Heat", "release_year": 1995},
+	}
+	w := serve(handleListDuplicates(repo), http.MethodGet, "/duplicates", "/duplicates", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Scanned  int                `json:"scanned"`
+		Clusters [][]duplicateEntry `json:"clusters"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := [][]duplicateEntry{{
+		{ID: "m1", Title: "The Godfather", ReleaseYear: 1972},
+		{ID: "m2", Title: "Godfather", ReleaseYear: 1972},
+	}}
+	if response.Scanned != 4 || !reflect.DeepEqual(response.Clusters, want) {
+		t.Fatalf("expected one cluster of m1 and m2 out of 4, got %d %+v", response.Scanned, response.Clusters)
+	}
+	if len(repo.closed) != 1 {
+		t.Fatalf("expected the point in time closed, got %v", repo.closed)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	personIndex     = "people"
+	collectionIndex = "collections"
+)
+
+// PersonProfile is a person with their own page, unlike the credits stored on each movie.
+type PersonProfile struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name" binding:"required,max=200"`
+	Biography string   `json:"biography" binding:"max=5000"`
+	BirthYear int      `json:"birth_year" binding:"omitempty,min=1800,max=2100"`
+	KnownFor  []string `json:"known_for" binding:"max=50,dive,max=300"`
+}
+
+type Collection struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name" binding:"required,max=300"`
+	Description string   `json:"description" binding:"max=5000"`
+	MovieIDs    []string `json:"movie_ids" binding:"max=200"`
+}
+
+type entity interface {
+	// prepare sets the id and tidies the fields before the document is stored.
+	prepare(id string)
+}
+
+func (p *PersonProfile) prepare(id string) {
+	p.ID = id
+	p.Name = strings.TrimSpace(p.Name)
+}
+
+func (col *Collection) prepare(id string) {
+	col.ID = id
+	col.Name = strings.TrimSpace(col.Name)
+}
+
+type entityKind struct {
+	index string
+	name  string
+	new   func() entity
+}
+
+var (
+	personKind     = entityKind{index: personIndex, name: "person", new: func() entity { return &PersonProfile{} }}
+	collectionKind = entityKind{index: collectionIndex, name: "collection", new: func() entity { return &Collection{} }}
+)
+
+func ensureEntityIndexes(ctx context.Context, es *elasticsearch.Client) error {
+	text := map[string]interface{}{
+		"type":            "text",
+		"analyzer":        movieTextAnalyzer,
+		"search_analyzer": movieSearchAnalyzer,
+	}
+	name := map[string]interface{}{
+		"type":            "text",
+		"analyzer":        movieTextAnalyzer,
+		"search_analyzer": movieSearchAnalyzer,
+		"fields":          map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256}},
+	}
+	indexes := map[string]map[string]interface{}{
+		personIndex: {
+			"name":       name,
+			"biography":  text,
+			"birth_year": map[string]interface{}{"type": "integer"},
+			"known_for":  text,
+		},
+		collectionIndex: {
+			"name":        name,
+			"description": text,
+			"movie_ids":   map[string]interface{}{"type": "keyword"},
+		},
+	}
+	for index, properties := range indexes {
+		exists, err := es.Indices.Exists([]string{index}, es.Indices.Exists.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("check %s index exists: %w", index, err)
+		}
+		exists.Body.Close()
+		if exists.StatusCode != http.StatusNotFound {
+			continue
+		}
+		body, err := encodeBody(map[string]interface{}{
+			"settings": movieSettings(),
+			"mappings": map[string]interface{}{"properties": properties},
+		})
+		if err != nil {
+			return err
+		}
+		res, err := es.Indices.Create(index, es.Indices.Create.WithBody(body), es.Indices.Create.WithContext(ctx))
+		if err := esCall(res, err, "create "+index+" index"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleCreateEntity(repo Repository, kind entityKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc := kind.new()
+		fields, ok := bindFields(c, doc)
+		if !ok || !checkFields(c, kind.name, fields) {
+			return
+		}
+		id := uuid.NewString()
+		doc.prepare(id)
+		if err := repo.Index(c.Request.Context(), kind.index, id, doc); err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create " + kind.name})
+			return
+		}
+		c.JSON(http.StatusCreated, doc)
+	}
+}
+
+func handleGetEntity(repo Repository, kind entityKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		source, err := repo.Get(c.Request.Context(), kind.index, id)
+		if errors.Is(err, errDocumentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": kind.name + " not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch " + kind.name})
+			return
+		}
+		doc := kind.new()
+		if err := decodeSource(source, doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode " + kind.name})
+			return
+		}
+		doc.prepare(id)
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+func handleUpdateEntity(repo Repository, kind entityKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc := kind.new()
+		fields, ok := bindFields(c, doc)
+		if !ok || !checkFields(c, kind.name, fields) {
+			return
+		}
+		id := c.Param("id")
+		doc.prepare(id)
+		if err := repo.Index(c.Request.Context(), kind.index, id, doc); err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update " + kind.name})
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+func handleDeleteEntity(repo Repository, kind entityKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := repo.Delete(c.Request.Context(), kind.index, c.Param("id"))
+		if errors.Is(err, errDocumentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": kind.name + " not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete " + kind.name})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func decodeSource(source map[string]interface{}, out interface{}) error {
+	encoded, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+type searchGroup struct {
+	Type    string        `json:"type"`
+	Total   int           `json:"total"`
+	Results []interface{} `json:"results"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// handleSearchAll runs one multi search over movies, people, and collections and groups the hits by type.
+func handleSearchAll(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+		size := parseIntWithDefault(c.Query("size"), 5)
+		if size <= 0 || size > 20 {
+			size = 5
+		}
+
+		fuzzyMatch := func(fields ...string) map[string]interface{} {
+			return map[string]interface{}{"multi_match": map[string]interface{}{
+				"query":         query,
+				"fields":        fields,
+				"fuzziness":     "AUTO",
+				"prefix_length": 1,
+			}}
+		}
+		groups := []struct {
+			kind   string
+			search indexSearch
+			decode func(id string, source json.RawMessage) (interface{}, error)
+		}{
+			{
+				kind: "movie",
+				search: indexSearch{Index: movieIndex, Body: map[string]interface{}{
+					"size":    size,
+					"query":   withoutDeleted(movieTextQuery(query, defaultFuzziness, "")),
+					"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+				}},
+				decode: func(id string, source json.RawMessage) (interface{}, error) {
+					var fields map[string]interface{}
+					if err := json.Unmarshal(source, &fields); err != nil {
+						return nil, err
+					}
+					movie := mapToMovie(fields)
+					movie.ID = id
+					return movie, nil
+				},
+			},
+			{
+				kind: personKind.name,
+				search: indexSearch{Index: personIndex, Body: map[string]interface{}{
+					"size": size, "query": fuzzyMatch("name^3", "known_for", "biography"),
+				}},
+				decode: func(id string, source json.RawMessage) (interface{}, error) {
+					var person PersonProfile
+					err := json.Unmarshal(source, &person)
+					person.ID = id
+					return person, err
+				},
+			},
+			{
+				kind: collectionKind.name,
+				search: indexSearch{Index: collectionIndex, Body: map[string]interface{}{
+					"size": size, "query": fuzzyMatch("name^2", "description"),
+				}},
+				decode: func(id string, source json.RawMessage) (interface{}, error) {
+					var collection Collection
+					err := json.Unmarshal(source, &collection)
+					collection.ID = id
+					return collection, err
+				},
+			},
+		}
+
+		searches := make([]indexSearch, 0, len(groups))
+		for _, group := range groups {
+			searches = append(searches, group.search)
+		}
+		responses, err := repo.MultiSearch(c.Request.Context(), searches)
+		if err != nil {
+			log.Printf("search all: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+
+		results := make([]searchGroup, 0, len(groups))
+		failed := 0
+		for i, group := range groups {
+			result := searchGroup{Type: group.kind, Results: []interface{}{}}
+			var response struct {
+				Hits struct {
+					Total struct {
+						Value int `json:"value"`
+					} `json:"total"`
+					Hits []struct {
+						ID     string          `json:"_id"`
+						Source json.RawMessage `json:"_source"`
+					} `json:"hits"`
+				} `json:"hits"`
+				Error json.RawMessage `json:"error"`
+			}
+			if err := json.Unmarshal(responses[i], &response); err != nil || len(response.Error) > 0 {
+				// One index failing should not hide the matches in the others.
+				log.Printf("search all %s: %s", group.kind, responses[i])
+				result.Error = "search failed"
+				results = append(results, result)
+				failed++
+				continue
+			}
+			result.Total = response.Hits.Total.Value
+			for _, hit := range response.Hits.Hits {
+				decoded, err := group.decode(hit.ID, hit.Source)
+				if err != nil {
+					log.Printf("search all %s %s: %v", group.kind, hit.ID, err)
+					continue
+				}
+				result.Results = append(result.Results, decoded)
+			}
+			results = append(results, result)
+		}
+		if failed == len(groups) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search returned an error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"query": query, "groups": results})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEntityHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+
+	w := serve(handleCreateEntity(repo, personKind), http.MethodPost, "/people", "/people", `{"name":" Christopher Nolan ","birth_year":1970}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created PersonProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode person: %v", err)
+	}
+	if created.ID == "" || created.Name != "Christopher Nolan" {
+		t.Fatalf("expected a trimmed name and a new id, got %+v", created)
+	}
+
+	w = serve(handleGetEntity(repo, personKind), http.MethodGet, "/people/:id", "/people/"+created.ID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var fetched PersonProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &fetched); err != nil {
+		t.Fatalf("decode person: %v", err)
+	}
+	if fetched.ID != created.ID || fetched.BirthYear != 1970 {
+		t.Fatalf("expected %+v, got %+v", created, fetched)
+	}
+
+	w = serve(handleCreateEntity(repo, collectionKind), http.MethodPost, "/collections", "/collections", `{"description":"Batman"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	var invalid struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &invalid); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if invalid.Error != "invalid collection" || invalid.Fields["name"] != "is required" {
+		t.Fatalf("expected a missing name error, got %+v", invalid)
+	}
+
+	w = serve(handleDeleteEntity(repo, personKind), http.MethodDelete, "/people/:id", "/people/"+created.ID, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	w = serve(handleGetEntity(repo, personKind), http.MethodGet, "/people/:id", "/people/"+created.ID, "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleSearchAll(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	responses := map[string]string{
+		movieIndex:      `{"hits":{"total":{"value":2},"hits":[{"_id":"m1","_source":{"title":"Inception"}},{"_id":"m2","_source":{"title":"Tenet"}}]}}`,
+		personIndex:     `{"hits":{"total":{"value":1},"hits":[{"_id":"p1","_source":{"name":"Christopher Nolan"}}]}}`,
+		collectionIndex: `{"hits":{"total":{"value":0},"hits":[]}}`,
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		failIndex  string
+		wantStatus int
+		wantTotals map[string]int
+		wantErrors map[string]bool
+	}{
+		{name: "missing q", target: "/search", wantStatus: http.StatusBadRequest},
+		{
+			name:       "grouped results",
+			target:     "/search?q=nolan",
+			wantStatus: http.StatusOK,
+			wantTotals: map[string]int{"movie": 2, "person": 1, "collection": 0},
+		},
+		{
+			name:       "one index failing",
+			target:     "/search?q=nolan",
+			failIndex:  personIndex,
+			wantStatus: http.StatusOK,
+			wantTotals: map[string]int{"movie": 2, "person": 0, "collection": 0},
+			wantErrors: map[string]bool{"person": true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			repo.search = func(index string, body map[string]interface{}) (string, error) {
+				if index == tc.failIndex {
+					return "", errors.New("index_not_found_exception")
+				}
+				return responses[index], nil
+			}
+			w := serve(handleSearchAll(repo), http.MethodGet, "/search", tc.target, "")
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Groups []struct {
+					Type    string            `json:"type"`
+					Total   int               `json:"total"`
+					Results []json.RawMessage `json:"results"`
+					Error   string            `json:"error"`
+				} `json:"groups"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(response.Groups) != 3 {
+				t.Fatalf("expected three groups, got %d", len(response.Groups))
+			}
+			for _, group := range response.Groups {
+				if group.Total != tc.wantTotals[group.Type] || len(group.Results) != tc.wantTotals[group.Type] {
+					t.Fatalf("expected %d %s results, got total %d with %d results", tc.wantTotals[group.Type], group.Type, group.Total, len(group.Results))
+				}
+				if (group.Error != "") != tc.wantErrors[group.Type] {
+					t.Fatalf("unexpected error state for %s: %q", group.Type, group.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	experimentControl = "control"
+	experimentVariant = "variant"
+
+	// Context keys set by assignExperiment.
+	experimentKey        = "experiment"
+	experimentVariantKey = "experiment_variant"
+
+	// maxClientIDLength bounds X-Client-ID, which goes into the search log.
+	maxClientIDLength = 128
+)
+
+// searchExperiment sends Percent of clients to Profile instead of the boosts
+// in use, so the two rankings can be compared in the search log.
+type searchExperiment struct {
+	Name    string       `json:"name" binding:"required,max=100"`
+	Percent int          `json:"percent" binding:"min=0,max=100"`
+	Profile boostProfile `json:"profile"`
+	Started time.Time    `json:"started"`
+}
+
+var experiment atomic.Pointer[searchExperiment]
+
+func loadExperiment() error {
+	path := os.Getenv("SEARCH_EXPERIMENT_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read experiment file: %w", err)
+	}
+	var exp searchExperiment
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return fmt.Errorf("decode experiment file: %w", err)
+	}
+	if err := exp.normalize(); err != nil {
+		return fmt.Errorf("experiment file: %w", err)
+	}
+	experiment.Store(&exp)
+	return nil
+}
+
+func (e *searchExperiment) normalize() error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" || len(e.Name) > 100 {
+		return fmt.Errorf("name is required and at most 100 characters")
+	}
+	if e.Percent < 0 || e.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100")
+	}
+	if err := e.Profile.normalize(); err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+	if e.Started.IsZero() {
+		e.Started = time.Now().UTC().Truncate(time.Second)
+	}
+	return nil
+}
+
+// arm hashes the client with the experiment's name, so a client keeps its
+// ranking for the whole experiment and the next experiment splits afresh.
+func (e *searchExperiment) arm(client string) string {
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + client))
+	if binary.BigEndian.Uint64(sum[:8])%100 < uint64(e.Percent) {
+		return experimentVariant
+	}
+	return experimentControl
+}
+
+// experimentClient identifies the client by X-Client-ID, which a frontend
+// keeps in local storage, and falls back to its address.
+func experimentClient(c *gin.Context) string {
+	if id := strings.TrimSpace(c.GetHeader("X-Client-ID")); id != "" && len(id) <= maxClientIDLength {
+		return id
+	}
+	return c.ClientIP()
+}
+
+// assignExperiment puts the search in the running experiment's control or
+// variant arm. It runs before the cache, whose entries are kept per arm.
+func assignExperiment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if exp := experiment.Load(); exp != nil {
+			c.Set(experimentKey, exp)
+			c.Set(experimentVariantKey, exp.arm(experimentClient(c)))
+		}
+		c.Next()
+	}
+}
+
+// searchProfile is the boosts the search ranks with: the experiment's profile
+// in the variant arm, and the boosts in use otherwise.
+func searchProfile(c *gin.Context) boostProfile {
+	if value, ok := c.Get(experimentKey); ok && c.GetString(experimentVariantKey) == experimentVariant {
+		return value.(*searchExperiment).Profile
+	}
+	return currentBoosts()
+}
+
+func experimentName(c *gin.Context) string {
+	if value, ok := c.Get(experimentKey); ok {
+		return value.(*searchExperiment).Name
+	}
+	return ""
+}
+
+type experimentArm struct {
+	Variant      string   `json:"variant"`
+	Searches     int      `json:"searches"`
+	ZeroResults  int      `json:"zero_result_searches"`
+	Clicks       int      `json:"clicks"`
+	CTR          float64  `json:"click_through_rate"`
+	MeanPosition *float64 `json:"mean_position"`
+}
+
+// handleGetExperiment shows the running experiment and how each arm has done
+// since it started, or between from and to.
+func handleGetExperiment(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exp := experiment.Load()
+		if exp == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no experiment is running"})
+			return
+		}
+		from, to, err := parseRange(c, exp.Started.Format(time.RFC3339))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		arms, err := compareExperimentArms(c, es, exp.Name, from, to)
+		if err != nil {
+			log.Printf("experiment report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment report request failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"experiment": exp, "from": from, "to": to, "arms": arms})
+	}
+}
+
+func compareExperimentArms(c *gin.Context, es *elasticsearch.Client, name, from, to string) ([]experimentArm, error) {
+	clicks := map[string]interface{}{"term": map[string]interface{}{"event": "click"}}
+	body, err := encodeBody(map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+			{"term": map[string]interface{}{"experiment": name}},
+			{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": from, "lte": to}}},
+		}}},
+		"aggs": map[string]interface{}{
+			"variants": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "variant", "size": 2},
+				"aggs": map[string]interface{}{
+					"searches": map[string]interface{}{
+						"filter": firstPageSearches,
+						"aggs": map[string]interface{}{
+							"zero_results": map[string]interface{}{"filter": map[string]interface{}{"term": map[string]interface{}{"hits": 0}}},
+						},
+					},
+					"clicks": map[string]interface{}{
+						"filter": clicks,
+						"aggs": map[string]interface{}{
+							"searches": map[string]interface{}{"cardinality": map[string]interface{}{"field": "search_id"}},
+							"position": map[string]interface{}{"avg": map[string]interface{}{"field": "position"}},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(searchLogIndex), es.Search.WithBody(body))
+	var result struct {
+		Aggregations struct {
+			Variants struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					Searches struct {
+						DocCount    int `json:"doc_count"`
+						ZeroResults struct {
+							DocCount int `json:"doc_count"`
+						} `json:"zero_results"`
+					} `json:"searches"`
+					Clicks struct {
+						DocCount int `json:"doc_count"`
+						Searches struct {
+							Value int `json:"value"`
+						} `json:"searches"`
+						Position struct {
+							Value *float64 `json:"value"`
+						} `json:"position"`
+					} `json:"clicks"`
+				} `json:"buckets"`
+			} `json:"variants"`
+		} `json:"aggregations"`
+	}
+	if err := decodeResponse(res, err, "experiment report", &result); err != nil {
+		return nil, err
+	}
+
+	// Both arms are listed, in order, even before one has any searches.
+	arms := []experimentArm{{Variant: experimentControl}, {Variant: experimentVariant}}
+	for _, bucket := range result.Aggregations.Variants.Buckets {
+		for i := range arms {
+			if arms[i].Variant != bucket.Key {
+				continue
+			}
+			arms[i].Searches = bucket.Searches.DocCount
+			arms[i].ZeroResults = bucket.Searches.ZeroResults.DocCount
+			arms[i].Clicks = bucket.Clicks.DocCount
+			arms[i].CTR = clickRate(bucket.Clicks.Searches.Value, bucket.Searches.DocCount)
+			if mean := bucket.Clicks.Position.Value; mean != nil {
+				rounded := math.Round(*mean*10) / 10
+				arms[i].MeanPosition = &rounded
+			}
+		}
+	}
+	return arms, nil
+}
+
+// handleStartExperiment replaces the running experiment until the next
+// restart, which goes back to SEARCH_EXPERIMENT_FILE.
+func handleStartExperiment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var exp searchExperiment
+		if err := c.ShouldBindJSON(&exp); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := exp.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		experiment.Store(&exp)
+		log.Printf("search experiment %q started with %d%% of clients", exp.Name, exp.Percent)
+		c.JSON(http.StatusOK, exp)
+	}
+}
+
+// handleStopExperiment sends every search back to the boosts in use. The
+// search log keeps the experiment's entries.
+func handleStopExperiment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if exp := experiment.Swap(nil); exp != nil {
+			log.Printf("search experiment %q stopped", exp.Name)
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
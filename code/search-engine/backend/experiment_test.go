@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+func TestExperimentArm(t *testing.T) {
+	exp := searchExperiment{Name: "title-heavy", Percent: 20}
+	variants := 0
+	for i := 0; i < 10000; i++ {
+		client := fmt.Sprintf("client-%d", i)
+		arm := exp.arm(client)
+		if arm != exp.arm(client) {
+			t.Fatalf("expected %s to keep its arm", client)
+		}
+		if arm == experimentVariant {
+			variants++
+		}
+	}
+	if variants < 1700 || variants > 2300 {
+		t.Fatalf("expected about 20%% of clients in the variant, got %d of 10000", variants)
+	}
+	for _, percent := range []int{0, 100} {
+		exp.Percent = percent
+		if got := exp.arm("client-1") == experimentVariant; got != (percent == 100) {
+			t.Fatalf("expected the variant %t at %d%%, got %t", percent == 100, percent, got)
+		}
+	}
+}
+
+func TestSearchMoviesInExperiment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer experiment.Store(nil)
+	exp := searchExperiment{Name: "title-heavy", Percent: 100, Profile: boostProfile{Fields: map[string]float64{"title": 7}}}
+	if err := exp.normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	experiment.Store(&exp)
+
+	repo := newMockRepository()
+	router := gin.New()
+	router.GET("/movies", assignExperiment(), handleSearchMovies(repo))
+	req := httptest.NewRequest(http.MethodGet, "/movies?q=heat", nil)
+	req.Header.Set("X-Client-ID", "client-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	encoded, _ := json.Marshal(repo.searches[0]["query"])
+	if !strings.Contains(string(encoded), `"title^7"`) {
+		t.Fatalf("expected the experiment's title weight, got %s", encoded)
+	}
+	var response struct {
+		Experiment struct {
+			Name    string `json:"name"`
+			Variant string `json:"variant"`
+		} `json:"experiment"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Experiment.Name != "title-heavy" || response.Experiment.Variant != experimentVariant {
+		t.Fatalf("expected the variant of title-heavy, got %+v", response.Experiment)
+	}
+}
+
+func TestHandleGetExperiment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer experiment.Store(nil)
+	w := serve(handleGetExperiment(nil), http.MethodGet, "/experiment", "/experiment", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 without an experiment, got %d", w.Code)
+	}
+
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		var decoded map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&decoded)
+		encoded, _ := json.Marshal(decoded["query"])
+		query = string(encoded)
+		w.Write([]byte(`{"aggregations":{"variants":{"buckets":[{"key":"variant","searches":{"doc_count":40,"zero_results":{"doc_count":4}},` +
+			`"clicks":{"doc_count":12,"searches":{"value":10},"position":{"value":1.84}}}]}}}`))
+	}))
+	defer server.Close()
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	exp := searchExperiment{Name: "title-heavy", Percent: 50}
+	exp.normalize()
+	experiment.Store(&exp)
+
+	w = serve(handleGetExperiment(es), http.MethodGet, "/experiment", "/experiment", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(query, `"experiment":"title-heavy"`) {
+		t.Fatalf("expected the report limited to the experiment, got %s", query)
+	}
+	var response struct {
+		Arms []experimentArm `json:"arms"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Arms) != 2 || response.Arms[0].Variant != experimentControl || response.Arms[0].Searches != 0 {
+		t.Fatalf("expected an empty control arm first, got %+v", response.Arms)
+	}
+	variant := response.Arms[1]
+	if variant.Searches != 40 || variant.ZeroResults != 4 || variant.CTR != 0.25 || variant.MeanPosition == nil || *variant.MeanPosition != 1.8 {
+		t.Fatalf("expected the variant's searches and clicks, got %+v", variant)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportPageSize  = 1000
+	importBatchSize = 500
+	// An exported movie line carries its embedding, so lines can be long.
+	maxImportLine   = 16 << 20
+	maxImportErrors = 20
+)
+
+// Users and search logs hold credentials and personal data, so they are never exported.
+var exportIndexes = []string{movieIndex, reviewIndex, personIndex, collectionIndex}
+
+// exportLine is one NDJSON line. _index is the alias or index name the
+// backend uses, not the versioned index behind it, so an export can be
+// imported after a reindex.
+type exportLine struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+func exportIndexesParam(c *gin.Context) ([]string, error) {
+	requested := queryList(c, "index")
+	if len(requested) == 0 {
+		return exportIndexes, nil
+	}
+	for _, index := range requested {
+		if !isExportIndex(index) {
+			return nil, fmt.Errorf("index must be one of %s", strings.Join(exportIndexes, ", "))
+		}
+	}
+	return requested, nil
+}
+
+func isExportIndex(index string) bool {
+	for _, exportIndex := range exportIndexes {
+		if index == exportIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// handleExport streams every document as NDJSON, paging each index through a
+// point in time so documents written meanwhile neither repeat nor shift pages.
+func handleExport(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pits, ok := repo.(pointInTimes)
+		if !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "export needs point in time support"})
+			return
+		}
+		indexes, err := exportIndexesParam(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		started := false
+		exported := 0
+		for _, index := range indexes {
+			pitID, err := pits.OpenPointInTime(ctx, index)
+			if err != nil {
+				log.Printf("export %s: %v", index, err)
+				if !started {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export " + index})
+				}
+				return
+			}
+			var after []json.RawMessage
+			for {
+				body := map[string]interface{}{
+					"size":             exportPageSize,
+					"pit":              map[string]interface{}{"id": pitID, "keep_alive": pitKeepAlive},
+					"sort":             []interface{}{pitTiebreaker()},
+					"track_total_hits": false,
+				}
+				if after != nil {
+					body["search_after"] = after
+				}
+				encoder := json.NewEncoder(c.Writer)
+				page := &hitStream{each: func(id string, source json.RawMessage) error {
+					if !started {
+						c.Header("Content-Type", "application/x-ndjson")
+						c.Header("Content-Disposition", `attachment; filename="export.ndjson"`)
+						c.Status(http.StatusOK)
+						started = true
+					}
+					return encoder.Encode(exportLine{Index: index, ID: id, Source: source})
+				}}
+				if err := repo.Search(ctx, "", body, page); err != nil {
+					pits.ClosePointInTime(pitID)
+					log.Printf("export %s: %v", index, err)
+					if !started {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export " + index})
+					}
+					// The stream is cut short, which the client sees as a truncated body.
+					return
+				}
+				if page.PitID != "" {
+					pitID = page.PitID
+				}
+				c.Writer.Flush()
+				exported += page.count
+				if page.count < exportPageSize {
+					break
+				}
+				after = page.last
+			}
+			pits.ClosePointInTime(pitID)
+		}
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+		}
+		log.Printf("exported %d documents from %s", exported, strings.Join(indexes, ", "))
+	}
+}
+
+// hitStream decodes a search response one hit at a time, so a page of
+// documents is passed on as it arrives instead of held in memory whole.
+type hitStream struct {
+	PitID string
+	each  func(id string, source json.RawMessage) error
+	count int
+	last  []json.RawMessage
+}
+
+func (s *hitStream) UnmarshalJSON(data []byte) error {
+	return s.decodeFrom(bytes.NewReader(data))
+}
+
+func (s *hitStream) decodeFrom(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	return decodeObject(decoder, func(key string) error {
+		switch key {
+		case "pit_id":
+			return decoder.Decode(&s.PitID)
+		case "hits":
+			return decodeObject(decoder, func(key string) error {
+				if key != "hits" {
+					return skipValue(decoder)
+				}
+				if err := expectDelim(decoder, '['); err != nil {
+					return err
+				}
+				for decoder.More() {
+					var hit struct {
+						ID     string            `json:"_id"`
+						Source json.RawMessage   `json:"_source"`
+						Sort   []json.RawMessage `json:"sort"`
+					}
+					if err := decoder.Decode(&hit); err != nil {
+						return err
+					}
+					if err := s.each(hit.ID, hit.Source); err != nil {
+						return err
+					}
+					s.count++
+					s.last = hit.Sort
+				}
+				return expectDelim(decoder, ']')
+			})
+		}
+		return skipValue(decoder)
+	})
+}
+
+// decodeObject calls field for each key of the object next in the stream,
+// which must consume the key's value.
+func decodeObject(decoder *json.Decoder, field func(key string) error) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, want json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != want {
+		return fmt.Errorf("expected %v in the search response, got %v", want, token)
+	}
+	return nil
+}
+
+func skipValue(decoder *json.Decoder) error {
+	var skipped json.RawMessage
+	return decoder.Decode(&skipped)
+}
+
+type importBatch struct {
+	index string
+	body  bytes.Buffer
+	lines []int
+}
+
+// handleImport restores documents from an export, overwriting documents with
+// the same ids. Bad lines are skipped and reported, the rest still imported.
+func handleImport(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		imported, failed := 0, 0
+		var errs []string
+		report := func(line int, message string) {
+			failed++
+			if len(errs) < maxImportErrors {
+				errs = append(errs, fmt.Sprintf("line %d: %s", line, message))
+			}
+		}
+
+		batch := &importBatch{}
+		flush := func() error {
+			if len(batch.lines) == 0 {
+				return nil
+			}
+			batchFailed, _, err := repo.Bulk(ctx, batch.index, &batch.body)
+			if err != nil {
+				return err
+			}
+			// Bulk only logs which items failed, so the batch is reported as a whole.
+			if batchFailed > 0 && len(errs) < maxImportErrors {
+				errs = append(errs, fmt.Sprintf("lines %d-%d: %s rejected %d documents", batch.lines[0], batch.lines[len(batch.lines)-1], batch.index, batchFailed))
+			}
+			failed += batchFailed
+			imported += len(batch.lines) - batchFailed
+			batch = &importBatch{}
+			return nil
+		}
+
+		scanner := bufio.NewScanner(c.Request.Body)
+		scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+		lineNumber, documents := 0, 0
+		for scanner.Scan() {
+			lineNumber++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			documents++
+			var doc exportLine
+			if err := json.Unmarshal(line, &doc); err != nil {
+				report(lineNumber, "not a JSON object")
+				continue
+			}
+			if !isExportIndex(doc.Index) {
+				report(lineNumber, fmt.Sprintf("unknown index %q", doc.Index))
+				continue
+			}
+			if doc.ID == "" {
+				report(lineNumber, "_id is required")
+				continue
+			}
+			if len(doc.Source) == 0 || doc.Source[0] != '{' {
+				report(lineNumber, "_source must be an object")
+				continue
+			}
+			if doc.Index != batch.index || len(batch.lines) >= importBatchSize {
+				if err := flush(); err != nil {
+					log.Printf("import: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "bulk request failed", "imported": imported})
+					return
+				}
+				batch.index = doc.Index
+			}
+			if doc.Index == movieIndex {
+				doc.Source = withCollectionKey(doc.ID, doc.Source)
+			}
+			action, _ := json.Marshal(map[string]interface{}{"index": map[string]interface{}{"_id": doc.ID}})
+			batch.body.Write(action)
+			batch.body.WriteByte('\n')
+			batch.body.Write(doc.Source)
+			batch.body.WriteByte('\n')
+			batch.lines = append(batch.lines, lineNumber)
+		}
+		if err := scanner.Err(); err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, gin.H{"error": fmt.Sprintf("line %d: %v", lineNumber+1, err), "imported": imported})
+			return
+		}
+		if err := flush(); err != nil {
+			log.Printf("import: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "bulk request failed", "imported": imported})
+			return
+		}
+		if documents == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the body has no documents"})
+			return
+		}
+		if errs == nil {
+			errs = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{"imported": imported, "failed": failed, "errors": errs})
+	}
+}
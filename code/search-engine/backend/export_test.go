@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pitRepository adds point in time support, each one named after its index.
+type pitRepository struct {
+	*mockRepository
+	closed []string
+}
+
+func (r *pitRepository) OpenPointInTime(ctx context.Context, index string) (string, error) {
+	return "pit-" + index, nil
+}
+
+func (r *pitRepository) ClosePointInTime(id string) {
+	r.closed = append(r.closed, id)
+}
+
+func newPITRepository() *pitRepository {
+	repo := &pitRepository{mockRepository: newMockRepository()}
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		pit := body["pit"].(map[string]interface{})["id"].(string)
+		docs := repo.docs[strings.TrimPrefix(pit, "pit-")]
+		ids := make([]string, 0, len(docs))
+		for id := range docs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		hits := []map[string]interface{}{}
+		for i, id := range ids {
+			hits = append(hits, map[string]interface{}{"_id": id, "_source": docs[id], "sort": []int{i}})
+		}
+		response, err := json.Marshal(map[string]interface{}{"pit_id": pit, "hits": map[string]interface{}{"hits": hits}})
+		return string(response), err
+	}
+	return repo
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	source := newPITRepository()
+	source.docs[movieIndex] = map[string]map[string]interface{}{
+		"m1": {"title": "Inception", "genres": []interface{}{"Sci-Fi"}},
+		"m2": {"title": "Tenet"},
+	}
+	source.docs[personIndex] = map[string]map[string]interface{}{"p1": {"name": "Christopher Nolan"}}
+	source.docs[userIndex] = map[string]map[string]interface{}{"alice": {"password_hash": "secret"}}
+
+	w := serve(handleExport(source), http.MethodGet, "/export", "/export", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Fatalf("expected NDJSON, got %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines without users, got %d: %s", len(lines), w.Body.String())
+	}
+	if len(source.closed) != len(exportIndexes) {
+		t.Fatalf("expected every point in time closed, got %v", source.closed)
+	}
+
+	target := newMockRepository()
+	w = serve(handleImport(target), http.MethodPost, "/import", "/import", w.Body.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Imported int `json:"imported"`
+		Failed   int `json:"failed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Imported != 3 || response.Failed != 0 {
+		t.Fatalf("expected 3 imported, got %+v", response)
+	}
+	if target.docs[movieIndex]["m1"]["title"] != "Inception" || target.docs[personIndex]["p1"]["name"] != "Christopher Nolan" {
+		t.Fatalf("expected the documents restored, got %v", target.docs)
+	}
+}
+
+func TestHandleExportIndexParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newPITRepository()
+	repo.docs[movieIndex] = map[string]map[string]interface{}{"m1": {"title": "Inception"}}
+	repo.docs[reviewIndex] = map[string]map[string]interface{}{"r1": {"movie_id": "m1"}}
+
+	w := serve(handleExport(repo), http.MethodGet, "/export", "/export?index=reviews", "")
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 1 || !strings.Contains(w.Body.String(), `"_index":"reviews"`) {
+		t.Fatalf("expected only the review, got %d: %s", w.Code, w.Body.String())
+	}
+	w = serve(handleExport(repo), http.MethodGet, "/export", "/export?index=users", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	w = serve(handleExport(newMockRepository()), http.MethodGet, "/export", "/export", "")
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status 501 without point in time support, got %d", w.Code)
+	}
+}
+
+func TestHandleImport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantImported int
+		wantErrors   []string
+	}{
+		{name: "empty body", body: "\n\n", wantStatus: http.StatusBadRequest},
+		{
+			name: "bad lines are skipped",
+			body: strings.Join([]string{
+				`{"_index":"movies","_id":"m1","_source":{"title":"Inception"}}`,
+				`not json`,
+				`{"_index":"users","_id":"alice","_source":{}}`,
+				`{"_index":"movies","_source":{"title":"Tenet"}}`,
+				`{"_index":"reviews","_id":"r1","_source":"great"}`,
+				`{"_index":"reviews","_id":"r2","_source":{"movie_id":"m1"}}`,
+			}, "\n"),
+			wantStatus:   http.StatusOK,
+			wantImported: 2,
+			wantErrors: []string{
+				"line 2: not a JSON object",
+				`line 3: unknown index "users"`,
+				"line 4: _id is required",
+				"line 5: _source must be an object",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			w := serve(handleImport(repo), http.MethodPost, "/import", "/import", tc.body)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var response struct {
+				Imported int      `json:"imported"`
+				Failed   int      `json:"failed"`
+				Errors   []string `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if response.Imported != tc.wantImported || response.Failed != len(tc.wantErrors) {
+				t.Fatalf("expected %d imported and %d failed, got %+v", tc.wantImported, len(tc.wantErrors), response)
+			}
+			if strings.Join(response.Errors, "|") != strings.Join(tc.wantErrors, "|") {
+				t.Fatalf("expected errors %q, got %q", tc.wantErrors, response.Errors)
+			}
+			if _, ok := repo.docs[reviewIndex]["r2"]; !ok {
+				t.Fatalf("expected review r2 imported, got %v", repo.docs)
+			}
+		})
+	}
+}
+
+func TestHitStream(t *testing.T) {
+	response := `{"pit_id":"pit-2","took":3,"hits":{"total":{"value":2},"hits":[` +
+		`{"_id":"m1","_source":{"title":"Heat"},"sort":[1]},` +
+		`{"_id":"m2","_source":{"title":"Tenet","genres":["Sci-Fi"]},"sort":[2]}]},"_shards":{}}`
+	var ids []string
+	stream := &hitStream{each: func(id string, source json.RawMessage) error {
+		ids = append(ids, id+" "+string(source))
+		return nil
+	}}
+	if err := stream.decodeFrom(strings.NewReader(response)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stream.PitID != "pit-2" || stream.count != 2 || string(stream.last[0]) != "2" {
+		t.Fatalf("unexpected stream state %+v", stream)
+	}
+	if len(ids) != 2 || ids[1] != `m2 {"title":"Tenet","genres":["Sci-Fi"]}` {
+		t.Fatalf("unexpected hits %v", ids)
+	}
+	if err := (&hitStream{}).decodeFrom(strings.NewReader(`[]`)); err == nil {
+		t.Fatalf("expected an error for a response that is not an object")
+	}
+}
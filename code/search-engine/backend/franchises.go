@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxFranchiseMovies caps GET /api/collections/:name, far above any real franchise.
+const maxFranchiseMovies = 200
+
+// A movie's collection names its franchise, such as The Dark Knight Trilogy.
+// collection_key is what search collapses on: the lowercased collection, or the
+// movie's own id, since collapsing puts every movie without a value in one group.
+var collectionMappings = map[string]interface{}{
+	"collection":     map[string]interface{}{"type": "keyword", "ignore_above": 300},
+	"collection_key": map[string]interface{}{"type": "keyword"},
+}
+
+func collectionKey(id, collection string) string {
+	if collection = strings.ToLower(strings.TrimSpace(collection)); collection != "" {
+		return "collection:" + collection
+	}
+	return "movie:" + id
+}
+
+// Movies stored before collections existed, or imported from an older export, have no key.
+const migrateCollectionKeyScript = `
+String collection = ctx._source.collection instanceof String ? ctx._source.collection.trim().toLowerCase() : '';
+ctx._source.collection_key = collection != '' ? 'collection:' + collection : 'movie:' + ctx._id;`
+
+func migrateCollectionKeys(es *elasticsearch.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	body, err := encodeBody(map[string]interface{}{
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"must_not": []map[string]interface{}{{"exists": map[string]interface{}{"field": "collection_key"}}},
+		}},
+		"script": map[string]interface{}{"source": migrateCollectionKeyScript, "lang": "painless"},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.UpdateByQuery([]string{movieIndex},
+		es.UpdateByQuery.WithBody(body),
+		es.UpdateByQuery.WithConflicts("proceed"),
+		es.UpdateByQuery.WithRefresh(true),
+		es.UpdateByQuery.WithContext(ctx))
+	if err := checkResponse(res, err, "migrate collection keys"); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var response struct {
+		Updated int `json:"updated"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("decode collection key migration: %w", err)
+	}
+	if response.Updated > 0 {
+		log.Printf("added a collection key to %d movies", response.Updated)
+	}
+	return nil
+}
+
+// withCollectionKey adds the key to an imported movie that lacks one.
+func withCollectionKey(id string, source json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(source, &fields); err != nil || fields["collection_key"] != nil {
+		return source
+	}
+	var collection string
+	json.Unmarshal(fields["collection"], &collection)
+	fields["collection_key"], _ = json.Marshal(collectionKey(id, collection))
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return source
+	}
+	return encoded
+}
+
+// parseGroupBy accepts an empty group_by, which lists every movie.
+func parseGroupBy(value string) (string, error) {
+	switch groupBy := strings.ToLower(strings.TrimSpace(value)); groupBy {
+	case "", "collection":
+		return groupBy, nil
+	default:
+		return "", fmt.Errorf("group_by must be collection")
+	}
+}
+
+// groupByCollection keeps the best match of each collection. Pages count
+// groups rather than movies, so total hits comes from the groups aggregation.
+func groupByCollection(body map[string]interface{}) {
+	body["collapse"] = map[string]interface{}{"field": "collection_key"}
+	aggs, _ := body["aggs"].(map[string]interface{})
+	if aggs == nil {
+		aggs = map[string]interface{}{}
+		body["aggs"] = aggs
+	}
+	aggs["groups"] = map[string]interface{}{"cardinality": map[string]interface{}{"field": "collection_key"}}
+}
+
+// handleGetCollection serves a curated collection by its id. Collection ids are
+// UUIDs, so anything else is read as a franchise name and lists its movies in
+// release order.
+func handleGetCollection(repo Repository) gin.HandlerFunc {
+	getEntity := handleGetEntity(repo, collectionKind)
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.Param("id"))
+		if _, err := uuid.Parse(name); err == nil {
+			getEntity(c)
+			return
+		}
+		var result struct {
+			Hits struct {
+				Hits []struct {
+					ID     string                 `json:"_id"`
+					Source map[string]interface{} `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		err := repo.Search(c.Request.Context(), movieIndex, map[string]interface{}{
+			"size": maxFranchiseMovies,
+			"query": map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+				notDeleted(),
+				{"term": map[string]interface{}{"collection": map[string]interface{}{"value": name, "case_insensitive": true}}},
+			}}},
+			"sort": []map[string]interface{}{
+				{"release_year": map[string]interface{}{"order": "asc", "missing": "_last"}},
+				{"title.keyword": "asc"},
+			},
+			"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+		}, &result)
+		if err != nil {
+			log.Printf("collection %q: %v", name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch collection"})
+			return
+		}
+		if len(result.Hits.Hits) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+		movies := make([]Movie, 0, len(result.Hits.Hits))
+		for _, hit := range result.Hits.Hits {
+			movie := mapToMovie(hit.Source)
+			movie.ID = hit.ID
+			movies = append(movies, movie)
+		}
+		// The first movie's spelling stands for the franchise.
+		c.JSON(http.StatusOK, gin.H{"name": movies[0].Collection, "movies": movies})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWithCollectionKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{name: "collection", source: `{"title":"Heat","collection":" The Dark Knight Trilogy "}`, want: "collection:the dark knight trilogy"},
+		{name: "no collection", source: `{"title":"Heat"}`, want: "movie:m1"},
+		{name: "kept", source: `{"title":"Heat","collection_key":"collection:heat"}`, want: "collection:heat"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var fields map[string]interface{}
+			if err := json.Unmarshal(withCollectionKey("m1", json.RawMessage(tc.source)), &fields); err != nil {
+				t.Fatalf("decode source: %v", err)
+			}
+			if fields["collection_key"] != tc.want || fields["title"] != "Heat" {
+				t.Fatalf("expected key %q, got %v", tc.want, fields)
+			}
+		})
+	}
+}
+
+func TestHandleSearchMoviesGroupByCollection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"hits":{"total":{"value":7},"hits":[{"_id":"m1","_source":{"title":"Batman Begins","collection":"The Dark Knight Trilogy"}}]},"aggregations":{"groups":{"value":3}}}`, nil
+	}
+
+	w := serve(handleSearchMovies(repo), http.MethodGet, "/movies", "/movies?q=batman&group_by=collection", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	want := map[string]interface{}{"field": "collection_key"}
+	if got := repo.searches[0]["collapse"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected collapse %v, got %v", want, got)
+	}
+	var response struct {
+		Movies     []Movie    `json:"movies"`
+		Pagination Pagination `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Pagination.TotalHits != 3 || response.Movies[0].Collection != "The Dark Knight Trilogy" {
+		t.Fatalf("expected 3 groups and the collection, got %+v", response)
+	}
+
+	for _, target := range []string{"/movies?group_by=genre", "/movies?group_by=collection&paginate=cursor"} {
+		w := serve(handleSearchMovies(newPITRepository()), http.MethodGet, "/movies", target, "")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestHandleGetCollectionFranchise(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"hits":{"hits":[{"_id":"m1","_source":{"title":"Batman Begins","release_year":2005,"collection":"The Dark Knight Trilogy"}},{"_id":"m2","_source":{"title":"The Dark Knight","release_year":2008,"collection":"The Dark Knight Trilogy"}}]}}`, nil
+	}
+
+	w := serve(handleGetCollection(repo), http.MethodGet, "/collections/:id", "/collections/the%20dark%20knight%20trilogy", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Name   string  `json:"name"`
+		Movies []Movie `json:"movies"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Name != "The Dark Knight Trilogy" || len(response.Movies) != 2 || response.Movies[0].ID != "m1" {
+		t.Fatalf("expected both movies of the trilogy, got %+v", response)
+	}
+
+	// A UUID is a curated collection's id, which is not stored here.
+	w = serve(handleGetCollection(repo), http.MethodGet, "/collections/:id", "/collections/5b1c8e7a-3f0d-4c55-9f3b-2a6f4d8e9c10", "")
+	if w.Code != http.StatusNotFound || len(repo.searches) != 1 {
+		t.Fatalf("expected 404 without a franchise search, got %d after %d searches", w.Code, len(repo.searches))
+	}
+}
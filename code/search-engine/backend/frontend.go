@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Assets with a content hash in the name, like app.3f9a1c2e.js, never change under that name.
+var hashedAsset = regexp.MustCompile(`\.[0-9a-f]{8,}\.[a-z0-9]+$`)
+
+func apiNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"error": "no such endpoint"})
+}
+
+// handleNoRoute answers the paths no route matched. Under /api that is
+// apiFallback. Anything else is a frontend file, or index.html so the
+// frontend can route the path itself. An empty dir serves no frontend.
+func handleNoRoute(dir string, apiFallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		urlPath := c.Request.URL.Path
+		if urlPath == "/api" || strings.HasPrefix(urlPath, "/api/") || dir == "" {
+			apiFallback(c)
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "method not allowed"})
+			return
+		}
+		// The frontend used to live under /app.
+		if urlPath == "/app" || strings.HasPrefix(urlPath, "/app/") {
+			c.Redirect(http.StatusMovedPermanently, "/"+strings.TrimPrefix(strings.TrimPrefix(urlPath, "/app"), "/"))
+			return
+		}
+
+		name := path.Clean("/" + urlPath)
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if info, err := os.Stat(file); err != nil || info.IsDir() || name == "/index.html" {
+			// A path that looks like a file is a missing asset, not a page.
+			if path.Ext(name) != "" && name != "/index.html" {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			c.Header("Cache-Control", "no-cache")
+			c.File(filepath.Join(dir, "index.html"))
+			return
+		}
+		if hashedAsset.MatchString(name) {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			c.Header("Cache-Control", "no-cache")
+		}
+		c.File(file)
+	}
+}
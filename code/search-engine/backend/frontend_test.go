@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleNoRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":          "<html>index</html>",
+		"app.js":              "console.log('app')",
+		"app.3f9a1c2e77.js":   "console.log('hashed')",
+		"assets/logo.svg":     "<svg/>",
+		"../outside-file.txt": "secret",
+	} {
+		file := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(file), 0o755)
+		os.WriteFile(file, []byte(content), 0o644)
+	}
+	router := gin.New()
+	router.GET("/api/movies", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+	router.NoRoute(handleNoRoute(dir, apiNotFound))
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantCache  string
+	}{
+		{name: "api route wins", target: "/api/movies", wantStatus: http.StatusOK, wantBody: "{}"},
+		{name: "unknown api path", target: "/api/nope", wantStatus: http.StatusNotFound, wantBody: "no such endpoint"},
+		{name: "root", target: "/", wantStatus: http.StatusOK, wantBody: "index", wantCache: "no-cache"},
+		{name: "client route", target: "/movies/m1", wantStatus: http.StatusOK, wantBody: "index", wantCache: "no-cache"},
+		{name: "asset", target: "/app.js", wantStatus: http.StatusOK, wantBody: "'app'", wantCache: "no-cache"},
+		{name: "hashed asset", target: "/app.3f9a1c2e77.js", wantStatus: http.StatusOK, wantBody: "hashed", wantCache: "public, max-age=31536000, immutable"},
+		{name: "nested asset", target: "/assets/logo.svg", wantStatus: http.StatusOK, wantBody: "<svg/>"},
+		{name: "missing asset", target: "/missing.js", wantStatus: http.StatusNotFound},
+		{name: "traversal", target: "/../outside-file.txt", wantStatus: http.StatusNotFound},
+		{name: "old app prefix", target: "/app/", wantStatus: http.StatusMovedPermanently},
+		{name: "post to a page", method: http.MethodPost, target: "/movies", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, tc.target, nil))
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Fatalf("expected %q in the body, got %q", tc.wantBody, w.Body.String())
+			}
+			if tc.wantCache != "" && w.Header().Get("Cache-Control") != tc.wantCache {
+				t.Fatalf("expected Cache-Control %q, got %q", tc.wantCache, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+var genresMapping = map[string]interface{}{"type": "keyword"}
+
+// Other ways of writing a genre, keyed by the spelling the seed data uses.
+// TMDB, for one, says Science Fiction where the seed file says Sci-Fi.
+var genreSynonyms = map[string][]string{
+	"Sci-Fi":      {"Science Fiction", "SciFi", "SF"},
+	"Animation":   {"Animated", "Cartoon", "Cartoons"},
+	"Comedy":      {"Comedies"},
+	"Documentary": {"Documentaries", "Docs"},
+	"Drama":       {"Dramas"},
+	"Family":      {"Kids"},
+	"History":     {"Historical"},
+	"Musical":     {"Musicals"},
+	"Mystery":     {"Mysteries"},
+	"Romance":     {"Romantic"},
+	"Thriller":    {"Thrillers", "Suspense"},
+	"Western":     {"Westerns"},
+}
+
+// genreGroups finds a genre's canonical spelling by its genreKey.
+var genreGroups = func() map[string]string {
+	groups := map[string]string{}
+	for genre, synonyms := range genreSynonyms {
+		groups[genreKey(genre)] = genre
+		for _, synonym := range synonyms {
+			groups[genreKey(synonym)] = genre
+		}
+	}
+	return groups
+}()
+
+// genreKey keeps only letters and digits, so sci-fi, Sci Fi, and SCIFI agree.
+func genreKey(genre string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, genre)
+}
+
+// genreVariants lists the spellings a filter on genre should match: the genre
+// as given, then its canonical spelling and synonyms.
+func genreVariants(genre string) []string {
+	genre = strings.TrimSpace(genre)
+	variants := []string{genre}
+	if canonical, ok := genreGroups[genreKey(genre)]; ok {
+		variants = append(variants, canonical)
+		variants = append(variants, genreSynonyms[canonical]...)
+	}
+	return variants
+}
+
+// allowedGenre finds the MOVIE_GENRES spelling of genre, trying its synonyms
+// when the genre itself is not listed.
+func allowedGenre(genre string) (string, bool) {
+	for _, variant := range genreVariants(genre) {
+		if allowed, ok := allowedGenres[strings.ToLower(variant)]; ok {
+			return allowed, true
+		}
+	}
+	return "", false
+}
+
+// Movies once had a single genre keyword; this turns it into a one-item genres list.
+const migrateGenreScript = `
+if (ctx._source.genre instanceof String && ctx._source.genre != '') {
+	ctx._source.genres = [ctx._source.genre];
+} else {
+	ctx._source.genres = [];
+}
+ctx._source.remove('genre');`
+
+func migrateGenres(es *elasticsearch.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	body, err := encodeBody(map[string]interface{}{
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"filter":   []map[string]interface{}{{"exists": map[string]interface{}{"field": "genre"}}},
+			"must_not": []map[string]interface{}{{"exists": map[string]interface{}{"field": "genres"}}},
+		}},
+		"script": map[string]interface{}{"source": migrateGenreScript, "lang": "painless"},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.UpdateByQuery([]string{movieIndex},
+		es.UpdateByQuery.WithBody(body),
+		es.UpdateByQuery.WithConflicts("proceed"),
+		es.UpdateByQuery.WithRefresh(true),
+		es.UpdateByQuery.WithContext(ctx))
+	if err := checkResponse(res, err, "migrate genres"); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var response struct {
+		Updated int `json:"updated"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("decode genre migration: %w", err)
+	}
+	if response.Updated > 0 {
+		log.Printf("moved the genre of %d movies into genres", response.Updated)
+	}
+	return nil
+}
+
+// Documents written before the migration ran still have only genre.
+func mapToGenres(source map[string]interface{}) []string {
+	genres := []string{}
+	if values, ok := source["genres"].([]interface{}); ok {
+		for _, value := range values {
+			if genre, ok := value.(string); ok {
+				genres = append(genres, genre)
+			}
+		}
+	} else if genre, ok := source["genre"].(string); ok && genre != "" {
+		genres = append(genres, genre)
+	}
+	return genres
+}
+
+// genreFilter matches movies with any of the genres under any of their
+// spellings, so genre=scifi finds movies stored as Sci-Fi or Science Fiction.
+func genreFilter(genres []string) map[string]interface{} {
+	should := make([]map[string]interface{}, 0, len(genres))
+	seen := map[string]bool{}
+	for _, genre := range genres {
+		for _, variant := range genreVariants(genre) {
+			key := strings.ToLower(variant)
+			if variant == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			should = append(should, map[string]interface{}{
+				"term": map[string]interface{}{"genres": map[string]interface{}{"value": variant, "case_insensitive": true}},
+			})
+		}
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}}
+}
+
+func queryGenres(c *gin.Context) []string {
+	return queryList(c, "genre")
+}
+
+// queryList reads a repeatable parameter, also splitting comma-separated values.
+func queryList(c *gin.Context, param string) []string {
+	var values []string
+	for _, value := range c.QueryArray(param) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+type genreCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// handleListGenres lists the genres in use with their movie counts, plus any
+// unused ones from MOVIE_GENRES.
+func handleListGenres(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var result struct {
+			Aggregations struct {
+				Genres struct {
+					Buckets []struct {
+						Key      string `json:"key"`
+						DocCount int    `json:"doc_count"`
+					} `json:"buckets"`
+				} `json:"genres"`
+			} `json:"aggregations"`
+		}
+		err := repo.Search(c.Request.Context(), movieIndex, map[string]interface{}{
+			"size":  0,
+			"query": notDeleted(),
+			"aggs": map[string]interface{}{
+				"genres": map[string]interface{}{"terms": map[string]interface{}{"field": "genres", "size": 500}},
+			},
+		}, &result)
+		if err != nil {
+			log.Printf("list genres: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list genres"})
+			return
+		}
+
+		genres := make([]genreCount, 0, len(result.Aggregations.Genres.Buckets)+len(allowedGenres))
+		seen := map[string]bool{}
+		for _, bucket := range result.Aggregations.Genres.Buckets {
+			genres = append(genres, genreCount{Name: bucket.Key, Count: bucket.DocCount})
+			seen[strings.ToLower(bucket.Key)] = true
+		}
+		for key, genre := range allowedGenres {
+			if !seen[key] {
+				genres = append(genres, genreCount{Name: genre})
+			}
+		}
+		sort.SliceStable(genres, func(i, j int) bool {
+			if genres[i].Count != genres[j].Count {
+				return genres[i].Count > genres[j].Count
+			}
+			return genres[i].Name < genres[j].Name
+		})
+		c.JSON(http.StatusOK, gin.H{"genres": genres})
+	}
+}
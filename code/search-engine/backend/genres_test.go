@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMapToGenres(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]interface{}
+		want   []string
+	}{
+		{name: "genres list", source: map[string]interface{}{"genres": []interface{}{"Crime", "Drama"}}, want: []string{"Crime", "Drama"}},
+		{name: "legacy genre", source: map[string]interface{}{"genre": "Crime"}, want: []string{"Crime"}},
+		{name: "genres win over genre", source: map[string]interface{}{"genre": "Crime", "genres": []interface{}{}}, want: []string{}},
+		{name: "neither", source: map[string]interface{}{}, want: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mapToGenres(tc.source); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleListGenres(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := allowedGenres
+	defer func() { allowedGenres = original }()
+	allowedGenres = map[string]string{"drama": "Drama", "western": "Western"}
+
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"aggregations":{"genres":{"buckets":[{"key":"Drama","doc_count":3},{"key":"Crime","doc_count":3},{"key":"Sci-Fi","doc_count":5}]}}}`, nil
+	}
+	w := serve(handleListGenres(repo), http.MethodGet, "/genres", "/genres", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var response struct {
+		Genres []genreCount `json:"genres"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []genreCount{{"Sci-Fi", 5}, {"Crime", 3}, {"Drama", 3}, {"Western", 0}}
+	if !reflect.DeepEqual(response.Genres, want) {
+		t.Fatalf("expected %v, got %v", want, response.Genres)
+	}
+}
+
+func TestHandleSearchMoviesGenreFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	w := serve(handleSearchMovies(repo), http.MethodGet, "/movies", "/movies?genre=Drama&genre=crime,+sci-fi", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	encoded, _ := json.Marshal(repo.searches[0]["query"])
+	want, _ := json.Marshal(map[string]interface{}{"bool": map[string]interface{}{
+		"must":   nil,
+		"filter": []interface{}{notDeleted(), genreFilter([]string{"Drama", "crime", "sci-fi"})},
+	}})
+	if string(encoded) != string(want) {
+		t.Fatalf("expected query %s, got %s", want, encoded)
+	}
+}
+
+func TestGenreFilterSynonyms(t *testing.T) {
+	var values []string
+	for _, clause := range genreFilter([]string{" scifi ", "Sci Fi", "Heist"})["bool"].(map[string]interface{})["should"].([]map[string]interface{}) {
+		values = append(values, clause["term"].(map[string]interface{})["genres"].(map[string]interface{})["value"].(string))
+	}
+	want := []string{"scifi", "Sci-Fi", "Science Fiction", "SF", "Sci Fi", "Heist"}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("expected %q, got %q", want, values)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mockRepository struct {
+	docs     map[string]map[string]map[string]interface{}
+	search   func(index string, body map[string]interface{}) (string, error)
+	searches []map[string]interface{}
+	err      error
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{docs: map[string]map[string]map[string]interface{}{}}
+}
+
+func (m *mockRepository) Index(ctx context.Context, index, id string, doc interface{}) error {
+	if m.err != nil {
+		return m.err
+	}
+	var source map[string]interface{}
+	if err := roundTripJSON(doc, &source); err != nil {
+		return err
+	}
+	if m.docs[index] == nil {
+		m.docs[index] = map[string]map[string]interface{}{}
+	}
+	m.docs[index][id] = source
+	return nil
+}
+
+func (m *mockRepository) Get(ctx context.Context, index, id string) (map[string]interface{}, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	source, ok := m.docs[index][id]
+	if !ok {
+		return nil, errDocumentNotFound
+	}
+	return source, nil
+}
+
+func (m *mockRepository) Search(ctx context.Context, index string, body interface{}, out interface{}) error {
+	var decoded map[string]interface{}
+	if err := roundTripJSON(body, &decoded); err != nil {
+		return err
+	}
+	m.searches = append(m.searches, decoded)
+	response := `{"hits":{"total":{"value":0},"hits":[]}}`
+	if m.search != nil {
+		var err error
+		if response, err = m.search(index, decoded); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal([]byte(response), out)
+}
+
+func (m *mockRepository) MultiSearch(ctx context.Context, searches []indexSearch) ([]json.RawMessage, error) {
+	responses := make([]json.RawMessage, 0, len(searches))
+	for _, search := range searches {
+		var response json.RawMessage
+		if err := m.Search(ctx, search.Index, search.Body, &response); err != nil {
+			response, _ = json.Marshal(map[string]interface{}{"error": map[string]interface{}{"reason": err.Error()}})
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, index, id string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if _, ok := m.docs[index][id]; !ok {
+		return errDocumentNotFound
+	}
+	delete(m.docs[index], id)
+	return nil
+}
+
+func (m *mockRepository) Bulk(ctx context.Context, index string, body io.Reader) (int, []string, error) {
+	if m.err != nil {
+		return 0, nil, m.err
+	}
+	failed := 0
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		var action struct {
+			Update struct {
+				ID string `json:"_id"`
+			} `json:"update"`
+			Index *struct {
+				ID string `json:"_id"`
+			} `json:"index"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			return 0, nil, err
+		}
+		scanner.Scan()
+		if action.Index != nil {
+			var source map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &source); err != nil {
+				return 0, nil, err
+			}
+			if m.docs[index] == nil {
+				m.docs[index] = map[string]map[string]interface{}{}
+			}
+			m.docs[index][action.Index.ID] = source
+			continue
+		}
+		var update struct {
+			Doc map[string]interface{} `json:"doc"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			return 0, nil, err
+		}
+		source, ok := m.docs[index][action.Update.ID]
+		if !ok {
+			failed++
+			continue
+		}
+		for field, value := range update.Doc {
+			source[field] = value
+		}
+	}
+	return failed, nil, scanner.Err()
+}
+
+func roundTripJSON(in, out interface{}) error {
+	encoded, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+func serve(handler gin.HandlerFunc, method, route, target, body string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, handler)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleGetMovie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.docs[movieIndex] = map[string]map[string]interface{}{
+		"m1": {"title": "Heat", "release_year": 1995.0},
+	}
+
+	w := serve(handleGetMovie(repo), http.MethodGet, "/movies/:id", "/movies/m1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var movie Movie
+	if err := json.Unmarshal(w.Body.Bytes(), &movie); err != nil {
+		t.Fatalf("decode movie: %v", err)
+	}
+	if movie.ID != "m1" || movie.Title != "Heat" || movie.ReleaseYear != 1995 {
+		t.Fatalf("expected Heat (1995) with id m1, got %+v", movie)
+	}
+
+	w = serve(handleGetMovie(repo), http.MethodGet, "/movies/:id", "/movies/missing", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", w.Code)
+	}
+
+	repo.err = errors.New("cluster unavailable")
+	w = serve(handleGetMovie(repo), http.MethodGet, "/movies/:id", "/movies/m1", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", w.Code)
+	}
+}
+
+func TestHandleCreateMovie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "missing title", body: `{"genres":["Drama"]}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid poster url", body: `{"title":"Heat","poster_url":"not a url"}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed json", body: `{"title":`, wantStatus: http.StatusBadRequest},
+		{name: "valid", body: `{"title":"Heat","genres":["Crime"],"user_rating":9,"review_count":4}`, wantStatus: http.StatusCreated},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			alerts := &alertDispatcher{queue: make(chan []Movie, 1)}
+			w := serve(handleCreateMovie(repo, alerts), http.MethodPost, "/movies", "/movies", tc.body)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusCreated {
+				if len(repo.docs[movieIndex]) != 0 {
+					t.Fatalf("expected nothing indexed, got %v", repo.docs[movieIndex])
+				}
+				return
+			}
+
+			var movie Movie
+			if err := json.Unmarshal(w.Body.Bytes(), &movie); err != nil {
+				t.Fatalf("decode movie: %v", err)
+			}
+			if movie.ID == "" || movie.UserRating != 0 || movie.ReviewCount != 0 {
+				t.Fatalf("expected a new id and an empty review summary, got %+v", movie)
+			}
+			if repo.docs[movieIndex][movie.ID]["title"] != "Heat" {
+				t.Fatalf("expected Heat indexed under %s, got %v", movie.ID, repo.docs[movieIndex])
+			}
+			if len(alerts.queue) != 1 {
+				t.Fatalf("expected the new movie queued for alerts")
+			}
+		})
+	}
+}
+
+func TestHandleCreateMovieFieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		body       string
+		wantFields map[string]string
+	}{
+		{
+			name:       "rating and year out of range",
+			body:       `{"title":"Heat","rating":9000,"release_year":-5}`,
+			wantFields: map[string]string{"rating": "must be at most 10", "release_year": "must be between 1888 and " + strconv.Itoa(time.Now().Year()+10)},
+		},
+		{
+			name:       "negative rating",
+			body:       `{"title":"Heat","rating":-1}`,
+			wantFields: map[string]string{"rating": "must be at least 0"},
+		},
+		{
+			name:       "title too long",
+			body:       `{"title":"` + strings.Repeat("a", 301) + `"}`,
+			wantFields: map[string]string{"title": "must be at most 300 characters"},
+		},
+		{
+			name:       "cast member without a name",
+			body:       `{"title":"Heat","cast":[{"role":"Neil"}]}`,
+			wantFields: map[string]string{"cast[0].name": "is required"},
+		},
+		{
+			name:       "year as text",
+			body:       `{"title":"Heat","release_year":"1995"}`,
+			wantFields: map[string]string{"release_year": "must be a number"},
+		},
+		{
+			name:       "translation in an unknown language without a title",
+			body:       `{"title":"Heat","translations":{"xx":{"title":"Panas"},"id":{"description":"Perampokan"}}}`,
+			wantFields: map[string]string{"translations[xx]": "must be one of the languages " + languageCodes(), "translations[id].title": "is required"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			alerts := &alertDispatcher{queue: make(chan []Movie, 1)}
+			w := serve(handleCreateMovie(repo, alerts), http.MethodPost, "/movies", "/movies", tc.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Fields map[string]string `json:"fields"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if !reflect.DeepEqual(response.Fields, tc.wantFields) {
+				t.Fatalf("expected fields %v, got %v", tc.wantFields, response.Fields)
+			}
+		})
+	}
+}
+
+func TestValidateMovieGenres(t *testing.T) {
+	original := allowedGenres
+	defer func() { allowedGenres = original }()
+	allowedGenres = map[string]string{"sci-fi": "Sci-Fi", "drama": "Drama"}
+
+	movie := Movie{Title: "Arrival", Genres: []string{" sci-fi ", "DRAMA", "Science Fiction", "scifi", ""}}
+	if fields := validateMovie(&movie); len(fields) != 0 {
+		t.Fatalf("expected no errors, got %v", fields)
+	}
+	if !reflect.DeepEqual(movie.Genres, []string{"Sci-Fi", "Drama"}) {
+		t.Fatalf("expected genres stored as [Sci-Fi Drama], got %q", movie.Genres)
+	}
+
+	movie = Movie{Title: "Heat", Genres: []string{"Drama", "Heist"}}
+	if fields := validateMovie(&movie); fields["genres[1]"] == "" {
+		t.Fatalf("expected an error for the second genre, got %v", fields)
+	}
+
+	allowedGenres = nil
+	movie = Movie{Title: "Heat", Genres: []string{"Heist"}}
+	if fields := validateMovie(&movie); len(fields) != 0 {
+		t.Fatalf("expected any genre allowed without MOVIE_GENRES, got %v", fields)
+	}
+}
+
+func TestHandleUpdateMovieRestoresReviewStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.docs[movieIndex] = map[string]map[string]interface{}{
+		"m1": {"title": "Heat", "user_rating": 4.5, "review_count": 2},
+	}
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		if index != reviewIndex {
+			t.Fatalf("expected the review aggregate on %s, got %q", reviewIndex, index)
+		}
+		return `{"hits":{"total":{"value":2}},"aggregations":{"average":{"value":4.25}}}`, nil
+	}
+
+	w := serve(handleUpdateMovie(repo), http.MethodPut, "/movies/:id", "/movies/m1", `{"title":"Heat (1995)"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var movie Movie
+	if err := json.Unmarshal(w.Body.Bytes(), &movie); err != nil {
+		t.Fatalf("decode movie: %v", err)
+	}
+	if movie.UserRating != 4.3 || movie.ReviewCount != 2 {
+		t.Fatalf("expected rating 4.3 from 2 reviews, got %v from %d", movie.UserRating, movie.ReviewCount)
+	}
+	stored := repo.docs[movieIndex]["m1"]
+	if stored["title"] != "Heat (1995)" || stored["user_rating"] != 4.3 {
+		t.Fatalf("expected the stored movie updated with its review summary, got %v", stored)
+	}
+}
+
+func TestHandleSearchMoviesPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		target         string
+		wantStatus     int
+		wantFrom       float64
+		wantSize       float64
+		wantTotalPages int
+	}{
+		{name: "defaults", target: "/movies", wantStatus: http.StatusOK, wantFrom: 0, wantSize: 5, wantTotalPages: 3},
+		{name: "third page", target: "/movies?page=3&pageSize=4", wantStatus: http.StatusOK, wantFrom: 8, wantSize: 4, wantTotalPages: 3},
+		{name: "page size over the cap", target: "/movies?pageSize=500", wantStatus: http.StatusOK, wantFrom: 0, wantSize: 5, wantTotalPages: 3},
+		{name: "past the result window", target: "/movies?page=1000&pageSize=50", wantStatus: http.StatusBadRequest},
+		{name: "unknown sort", target: "/movies?sort=budget", wantStatus: http.StatusBadRequest},
+		{name: "invalid fuzziness", target: "/movies?q=heat&fuzziness=5", wantStatus: http.StatusBadRequest},
+		{name: "invalid paginate", target: "/movies?paginate=scroll", wantStatus: http.StatusBadRequest},
+		{name: "unknown lang", target: "/movies?q=heat&lang=xx", wantStatus: http.StatusBadRequest},
+		{name: "cursor without point in time support", target: "/movies?paginate=cursor", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newMockRepository()
+			repo.search = func(index string, body map[string]interface{}) (string, error) {
+				return `{"hits":{"total":{"value":12},"hits":[{"_id":"m1","_source":{"title":"Heat"}}]}}`, nil
+			}
+			w := serve(handleSearchMovies(repo), http.MethodGet, "/movies", tc.target, "")
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				if len(repo.searches) != 0 {
+					t.Fatalf("expected no search for a rejected request, got %d", len(repo.searches))
+				}
+				return
+			}
+
+			if len(repo.searches) != 1 {
+				t.Fatalf("expected one search, got %d", len(repo.searches))
+			}
+			body := repo.searches[0]
+			if body["from"] != tc.wantFrom || body["size"] != tc.wantSize {
+				t.Fatalf("expected from %v size %v, got from %v size %v", tc.wantFrom, tc.wantSize, body["from"], body["size"])
+			}
+			var response struct {
+				Movies     []Movie    `json:"movies"`
+				Pagination Pagination `json:"pagination"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if response.Pagination.TotalHits != 12 || response.Pagination.TotalPages != tc.wantTotalPages {
+				t.Fatalf("expected 12 hits over %d pages, got %+v", tc.wantTotalPages, response.Pagination)
+			}
+			if len(response.Movies) != 1 || response.Movies[0].ID != "m1" {
+				t.Fatalf("expected movie m1, got %+v", response.Movies)
+			}
+		})
+	}
+}
+
+func TestHandleSearchMoviesPartialResults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"timed_out":true,"_shards":{"total":2,"successful":1,"skipped":0,"failed":1,"failures":[{"index":"movies","shard":1,"reason":{"type":"node_not_connected_exception","reason":"node left"}}]},` +
+			`"hits":{"total":{"value":1},"hits":[{"_id":"m1","_source":{"title":"Heat"}}]}}`, nil
+	}
+
+	router := gin.New()
+	router.GET("/movies", func(c *gin.Context) {
+		c.Next()
+		if !c.GetBool(searchPartialKey) {
+			t.Errorf("expected the response marked partial for the cache")
+		}
+	}, handleSearchMovies(repo))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/movies?q=heat", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := repo.searches[0]["timeout"]; got != esTimeout(timeouts.search) {
+		t.Fatalf("expected the search timeout sent, got %v", got)
+	}
+	var response struct {
+		Movies []Movie    `json:"movies"`
+		Meta   SearchMeta `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := SearchMeta{
+		Partial:  true,
+		TimedOut: true,
+		Shards:   ShardStats{Total: 2, Successful: 1, Failed: 1},
+		Failures: []ShardFailure{{Index: "movies", Shard: 1, Reason: "node left"}},
+	}
+	if len(response.Movies) != 1 || !reflect.DeepEqual(response.Meta, want) {
+		t.Fatalf("expected the hit with %+v, got %+v", want, response)
+	}
+}
+
+func TestHandleSearchMoviesFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return "", &esStatusError{StatusCode: http.StatusBadRequest, Body: "parse error"}
+	}
+
+	w := serve(handleSearchMovies(repo), http.MethodGet, "/movies", "/movies?q=heat", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", w.Code)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("parse error")) {
+		t.Fatalf("expected the cluster error kept out of the response, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+// IndexStats is what GET /api/admin/index/stats reports about the movie index.
+type IndexStats struct {
+	Alias   string `json:"alias"`
+	Target  string `json:"target"`
+	Version int    `json:"version"`
+	// Movies leaves out soft-deleted ones, which are counted on their own.
+	Movies         int   `json:"movies"`
+	DeletedMovies  int   `json:"deleted_movies"`
+	StoreSizeBytes int64 `json:"store_size_bytes"`
+	// TotalSizeBytes adds the replicas.
+	TotalSizeBytes int64               `json:"total_size_bytes"`
+	Mapping        MappingStatus       `json:"mapping"`
+	Migrations     MigrationStatus     `json:"migrations"`
+	Cluster        clusterHealthStatus `json:"cluster"`
+	ClusterError   string              `json:"cluster_error,omitempty"`
+}
+
+type MappingStatus struct {
+	Version int  `json:"version"`
+	Latest  int  `json:"latest"`
+	Current bool `json:"current"`
+}
+
+// MigrationStatus counts the movies startup migrations have yet to reach.
+// Pending is true while any is left, a reindex runs, or the mapping is behind.
+type MigrationStatus struct {
+	Pending              bool `json:"pending"`
+	ReindexRunning       bool `json:"reindex_running"`
+	LegacyGenre          int  `json:"legacy_genre"`
+	WithoutCollectionKey int  `json:"without_collection_key"`
+}
+
+func handleIndexStats(es *elasticsearch.Client, reindex *reindexer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := indexStats(c.Request.Context(), es)
+		if err != nil {
+			log.Printf("index stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read index stats"})
+			return
+		}
+		stats.Migrations.ReindexRunning = reindex.running()
+		stats.Migrations.Pending = stats.Migrations.Pending || stats.Migrations.ReindexRunning
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+func indexStats(ctx context.Context, es *elasticsearch.Client) (IndexStats, error) {
+	stats := IndexStats{Alias: movieIndex, Mapping: MappingStatus{Latest: movieMappingVersion}}
+	target, err := currentMovieIndex(ctx, es)
+	if err != nil {
+		return stats, err
+	}
+	stats.Target = target
+	stats.Version, _ = parseMovieIndexVersion(target)
+
+	var sizes struct {
+		All struct {
+			Primaries struct {
+				Store struct {
+					SizeInBytes int64 `json:"size_in_bytes"`
+				} `json:"store"`
+			} `json:"primaries"`
+			Total struct {
+				Store struct {
+					SizeInBytes int64 `json:"size_in_bytes"`
+				} `json:"store"`
+			} `json:"total"`
+		} `json:"_all"`
+	}
+	res, err := es.Indices.Stats(es.Indices.Stats.WithIndex(target), es.Indices.Stats.WithMetric("store"), es.Indices.Stats.WithContext(ctx))
+	if err := decodeResponse(res, err, "index stats", &sizes); err != nil {
+		return stats, err
+	}
+	stats.StoreSizeBytes = sizes.All.Primaries.Store.SizeInBytes
+	stats.TotalSizeBytes = sizes.All.Total.Store.SizeInBytes
+
+	var mappings map[string]struct {
+		Mappings struct {
+			Meta struct {
+				MappingVersion int `json:"mapping_version"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	res, err = es.Indices.GetMapping(es.Indices.GetMapping.WithIndex(target), es.Indices.GetMapping.WithContext(ctx))
+	if err := decodeResponse(res, err, "get mapping", &mappings); err != nil {
+		return stats, err
+	}
+	stats.Mapping.Version = mappings[target].Mappings.Meta.MappingVersion
+	stats.Mapping.Current = stats.Mapping.Version >= movieMappingVersion
+
+	// Soft-deleted movies and unmigrated ones come out of one search, counted by filter.
+	body, err := encodeBody(map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"aggs": map[string]interface{}{"counts": map[string]interface{}{"filters": map[string]interface{}{"filters": map[string]interface{}{
+			"deleted":                map[string]interface{}{"term": map[string]interface{}{"deleted": true}},
+			"legacy_genre":           map[string]interface{}{"exists": map[string]interface{}{"field": "genre"}},
+			"without_collection_key": map[string]interface{}{"bool": map[string]interface{}{"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "collection_key"}}}},
+		}}}},
+	})
+	if err != nil {
+		return stats, err
+	}
+	var counts struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Counts struct {
+				Buckets map[string]struct {
+					DocCount int `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"counts"`
+		} `json:"aggregations"`
+	}
+	res, err = es.Search(es.Search.WithIndex(target), es.Search.WithBody(body), es.Search.WithContext(ctx))
+	if err := decodeResponse(res, err, "count movies", &counts); err != nil {
+		return stats, err
+	}
+	buckets := counts.Aggregations.Counts.Buckets
+	stats.DeletedMovies = buckets["deleted"].DocCount
+	stats.Movies = counts.Hits.Total.Value - stats.DeletedMovies
+	stats.Migrations.LegacyGenre = buckets["legacy_genre"].DocCount
+	stats.Migrations.WithoutCollectionKey = buckets["without_collection_key"].DocCount
+	stats.Migrations.Pending = !stats.Mapping.Current || stats.Migrations.LegacyGenre > 0 || stats.Migrations.WithoutCollectionKey > 0
+
+	// A red or unreachable cluster is worth reporting rather than failing on.
+	stats.Cluster, err = clusterHealth(ctx, es, false)
+	if err != nil {
+		stats.ClusterError = err.Error()
+	}
+	return stats, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleIndexStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	responses := map[string]string{
+		"GET /_alias/movies":          `{"movies-v3":{"aliases":{"movies":{}}}}`,
+		"GET /movies-v3/_stats/store": `{"_all":{"primaries":{"store":{"size_in_bytes":2048}},"total":{"store":{"size_in_bytes":4096}}}}`,
+		"GET /movies-v3/_mapping":     `{"movies-v3":{"mappings":{"_meta":{"mapping_version":0},"properties":{}}}}`,
+		"POST /movies-v3/_search": `{"hits":{"total":{"value":12}},"aggregations":{"counts":{"buckets":{` +
+			`"deleted":{"doc_count":2},"legacy_genre":{"doc_count":0},"without_collection_key":{"doc_count":3}}}}}`,
+		"GET /_cluster/health": `{"cluster_name":"docker-cluster","status":"yellow","number_of_nodes":1}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		body, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	w := serve(handleIndexStats(es, newReindexer(es)), http.MethodGet, "/index/stats", "/index/stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var stats IndexStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if stats.Target != "movies-v3" || stats.Version != 3 || stats.Movies != 10 || stats.DeletedMovies != 2 || stats.StoreSizeBytes != 2048 {
+		t.Fatalf("expected movies-v3 with 10 movies and 2 deleted, got %+v", stats)
+	}
+	if stats.Mapping.Current || !stats.Migrations.Pending || stats.Migrations.WithoutCollectionKey != 3 {
+		t.Fatalf("expected an outdated mapping and pending migrations, got %+v", stats)
+	}
+	if stats.Cluster.Status != "yellow" || stats.ClusterError != "" {
+		t.Fatalf("expected a yellow cluster, got %+v", stats.Cluster)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	searchRollupIndex = "search_rollups"
+	rollupTopQueries  = 50
+	// jobTimeout bounds one run, so a stuck job does not block its next run forever.
+	jobTimeout = time.Hour
+
+	jobIdle    = "idle"
+	jobRunning = "running"
+)
+
+var maintenance = struct {
+	// nightlyAt is the time after midnight UTC when the nightly jobs run.
+	nightlyAt          time.Duration
+	snapshotRepository string
+}{
+	nightlyAt: 3 * time.Hour,
+}
+
+func loadJobs() error {
+	if value := os.Getenv("MAINTENANCE_AT"); value != "" {
+		at, err := time.Parse("15:04", value)
+		if err != nil {
+			return fmt.Errorf("invalid MAINTENANCE_AT %q: must be a UTC time such as 03:00", value)
+		}
+		maintenance.nightlyAt = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	}
+	maintenance.snapshotRepository = os.Getenv("SNAPSHOT_REPOSITORY")
+	return nil
+}
+
+// nextDaily returns the first time after now that is at past midnight UTC.
+func nextDaily(now time.Time, at time.Duration) time.Time {
+	next := now.UTC().Truncate(24 * time.Hour).Add(at)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	State          string     `json:"state"`
+	Runs           int        `json:"runs"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastResult     string     `json:"last_result,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+}
+
+type scheduledJob struct {
+	name     string
+	schedule string
+	// next is nil for jobs that only run when triggered.
+	next func(now time.Time) time.Time
+	run  func(ctx context.Context) (string, error)
+	// trigger holds at most one pending run.
+	trigger chan struct{}
+
+	mu     sync.Mutex
+	status JobStatus
+}
+
+func (j *scheduledJob) update(fn func(status *JobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+}
+
+type scheduler struct {
+	jobs   []*scheduledJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// tuneRefresh turns periodic refresh of the movie index off while imports
+	// run, and back on afterwards.
+	tuneRefresh func(ctx context.Context, off bool) error
+	mu          sync.Mutex
+	imports     int
+}
+
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{ctx: ctx, cancel: cancel}
+}
+
+func (s *scheduler) add(name, schedule string, next func(now time.Time) time.Time, run func(ctx context.Context) (string, error)) {
+	s.jobs = append(s.jobs, &scheduledJob{
+		name:     name,
+		schedule: schedule,
+		next:     next,
+		run:      run,
+		trigger:  make(chan struct{}, 1),
+		status:   JobStatus{Name: name, Schedule: schedule, State: jobIdle},
+	})
+}
+
+func (s *scheduler) start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job *scheduledJob) {
+			defer s.wg.Done()
+			s.loop(job)
+		}(job)
+	}
+}
+
+// stop cancels running jobs and returns once they have given up.
+func (s *scheduler) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *scheduler) loop(job *scheduledJob) {
+	for {
+		var timer *time.Timer
+		var due <-chan time.Time
+		if job.next != nil {
+			next := job.next(time.Now())
+			job.update(func(status *JobStatus) { status.NextRunAt = &next })
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-s.ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-due:
+		case <-job.trigger:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+		s.execute(job)
+	}
+}
+
+func (s *scheduler) execute(job *scheduledJob) {
+	started := time.Now().UTC()
+	job.update(func(status *JobStatus) {
+		status.State = jobRunning
+		status.LastStartedAt = &started
+	})
+	ctx, cancel := context.WithTimeout(s.ctx, jobTimeout)
+	result, err := job.run(ctx)
+	cancel()
+	finished := time.Now().UTC()
+	job.update(func(status *JobStatus) {
+		status.State = jobIdle
+		status.Runs++
+		status.LastFinishedAt = &finished
+		status.LastResult = result
+		status.LastError = ""
+		if err != nil {
+			status.LastError = err.Error()
+		}
+	})
+	if err != nil {
+		log.Printf("job %s failed: %v", job.name, err)
+		return
+	}
+	log.Printf("job %s: %s", job.name, result)
+}
+
+// trigger queues a run of the named job. A job already queued is not queued twice.
+func (s *scheduler) trigger(name string) bool {
+	for _, job := range s.jobs {
+		if job.name == name {
+			select {
+			case job.trigger <- struct{}{}:
+			default:
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scheduler) statuses() []JobStatus {
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		statuses = append(statuses, job.status)
+		job.mu.Unlock()
+	}
+	return statuses
+}
+
+// duringImport turns refresh off for the length of an import, so bulk writes
+// skip the refresh that makes them searchable. The last import to finish turns
+// it back on, refreshes once, and queues a force merge, all before its response
+// goes out.
+func (s *scheduler) duringImport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.beginImport()
+		writer := &importWindowWriter{ResponseWriter: c.Writer, end: s.endImport}
+		defer writer.close()
+		c.Writer = writer
+		c.Request = c.Request.WithContext(deferRefresh(c.Request.Context()))
+		c.Next()
+	}
+}
+
+func (s *scheduler) beginImport() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.imports++
+	if s.imports == 1 && s.tuneRefresh != nil {
+		if err := s.tuneRefresh(s.ctx, true); err != nil {
+			log.Printf("turn off refresh for import: %v", err)
+		}
+	}
+}
+
+func (s *scheduler) endImport() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.imports--
+	if s.imports > 0 {
+		return
+	}
+	if s.tuneRefresh != nil {
+		if err := s.tuneRefresh(s.ctx, false); err != nil {
+			log.Printf("turn refresh back on after import: %v", err)
+		}
+	}
+	s.trigger(forceMergeJob)
+}
+
+// importWindowWriter ends the import window before the first byte of the response.
+type importWindowWriter struct {
+	gin.ResponseWriter
+	end   func()
+	ended bool
+}
+
+func (w *importWindowWriter) close() {
+	if !w.ended {
+		w.ended = true
+		w.end()
+	}
+}
+
+func (w *importWindowWriter) Write(data []byte) (int, error) {
+	w.close()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *importWindowWriter) WriteString(s string) (int, error) {
+	w.close()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *importWindowWriter) WriteHeaderNow() {
+	w.close()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *importWindowWriter) Flush() {
+	w.close()
+	w.ResponseWriter.Flush()
+}
+
+const (
+	forceMergeJob      = "force_merge"
+	analyticsRollupJob = "analytics_rollup"
+	snapshotJob        = "snapshot"
+)
+
+// newMaintenance schedules the index maintenance jobs. Call start to run them.
+func newMaintenance(es *elasticsearch.Client, reindex *reindexer, analytics bool) *scheduler {
+	s := newScheduler()
+	s.tuneRefresh = func(ctx context.Context, off bool) error {
+		return setRefreshInterval(ctx, es, off)
+	}
+	nightly := func(now time.Time) time.Time { return nextDaily(now, maintenance.nightlyAt) }
+	nightlySchedule := fmt.Sprintf("daily at %02d:%02d UTC", int(maintenance.nightlyAt.Hours()), int(maintenance.nightlyAt.Minutes())%60)
+
+	s.add(forceMergeJob, "after imports", nil, func(ctx context.Context) (string, error) {
+		if reindex.running() {
+			return "skipped while a reindex runs", nil
+		}
+		res, err := es.Indices.Forcemerge(
+			es.Indices.Forcemerge.WithIndex(movieIndex),
+			es.Indices.Forcemerge.WithMaxNumSegments(1),
+			es.Indices.Forcemerge.WithContext(ctx))
+		if err := esCall(res, err, "force merge"); err != nil {
+			return "", err
+		}
+		return "merged " + movieIndex + " into one segment per shard", nil
+	})
+	if analytics {
+		s.add(analyticsRollupJob, nightlySchedule, nightly, func(ctx context.Context) (string, error) {
+			return rollupSearches(ctx, es, time.Now().UTC().Truncate(24*time.Hour).Add(-24*time.Hour))
+		})
+	}
+	if maintenance.snapshotRepository != "" {
+		s.add(snapshotJob, nightlySchedule, nightly, func(ctx context.Context) (string, error) {
+			return createSnapshot(ctx, es, maintenance.snapshotRepository, time.Now().UTC())
+		})
+	}
+	return s
+}
+
+// setRefreshInterval turns periodic refresh off, or restores the default and
+// refreshes so everything written in the meantime becomes searchable.
+func setRefreshInterval(ctx context.Context, es *elasticsearch.Client, off bool) error {
+	var interval interface{}
+	if off {
+		interval = "-1"
+	}
+	body, err := encodeBody(map[string]interface{}{"index.refresh_interval": interval})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.PutSettings(body, es.Indices.PutSettings.WithIndex(movieIndex), es.Indices.PutSettings.WithContext(ctx))
+	if err := esCall(res, err, "set refresh interval"); err != nil || off {
+		return err
+	}
+	res, err = es.Indices.Refresh(es.Indices.Refresh.WithIndex(movieIndex), es.Indices.Refresh.WithContext(ctx))
+	return esCall(res, err, "refresh movies")
+}
+
+func ensureSearchRollupIndex(ctx context.Context, es *elasticsearch.Client) error {
+	exists, err := es.Indices.Exists([]string{searchRollupIndex}, es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("check search rollup index exists: %w", err)
+	}
+	exists.Body.Close()
+	if exists.StatusCode != http.StatusNotFound {
+		return nil
+	}
+
+	count := map[string]interface{}{"type": "integer"}
+	// The query lists are kept for reading back, not for searching.
+	stored := map[string]interface{}{"type": "object", "enabled": false}
+	body, err := encodeBody(map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"date":                 map[string]interface{}{"type": "date", "format": "yyyy-MM-dd"},
+				"from":                 map[string]interface{}{"type": "date"},
+				"to":                   map[string]interface{}{"type": "date"},
+				"searches":             count,
+				"zero_result_searches": count,
+				"clicks":               count,
+				"click_through_rate":   map[string]interface{}{"type": "float"},
+				"latency_ms":           map[string]interface{}{"properties": map[string]interface{}{"p50": map[string]interface{}{"type": "float"}, "p90": map[string]interface{}{"type": "float"}, "p99": map[string]interface{}{"type": "float"}}},
+				"top_queries":          stored,
+				"zero_result_queries":  stored,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.Create(searchRollupIndex, es.Indices.Create.WithBody(body), es.Indices.Create.WithContext(ctx))
+	return esCall(res, err, "create search rollup index")
+}
+
+// rollupSearches stores one day's search analytics under the date, so running
+// it again for the same day replaces the earlier rollup.
+func rollupSearches(ctx context.Context, es *elasticsearch.Client, day time.Time) (string, error) {
+	from := day.Format(time.RFC3339)
+	to := day.Add(24*time.Hour - time.Millisecond).Format(time.RFC3339Nano)
+	summary, err := summarizeSearches(ctx, es, from, to, rollupTopQueries)
+	if err != nil {
+		return "", err
+	}
+	date := day.Format("2006-01-02")
+	summary["date"] = date
+	if err := (esRepository{es}).Index(ctx, searchRollupIndex, date, summary); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rolled up %d searches from %s", summary["searches"], date), nil
+}
+
+// createSnapshot starts a snapshot of the service's indexes and returns
+// without waiting for it, since large snapshots outlast the job timeout.
+func createSnapshot(ctx context.Context, es *elasticsearch.Client, repository string, now time.Time) (string, error) {
+	name := "search-engine-" + now.Format("2006.01.02-15.04")
+	indices := []string{movieIndex, reviewIndex, personIndex, collectionIndex, userIndex, savedSearchIndex, alertIndex, searchLogIndex, searchRollupIndex}
+	body, err := encodeBody(map[string]interface{}{
+		"indices":              strings.Join(indices, ","),
+		"include_global_state": false,
+	})
+	if err != nil {
+		return "", err
+	}
+	res, err := es.Snapshot.Create(repository, name, es.Snapshot.Create.WithBody(body), es.Snapshot.Create.WithContext(ctx))
+	if err := esCall(res, err, "create snapshot"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("started snapshot %s in %s", name, repository), nil
+}
+
+func handleListJobs(jobs *scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"jobs": jobs.statuses()})
+	}
+}
+
+func handleRunJob(jobs *scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !jobs.trigger(c.Param("name")) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"queued": c.Param("name")})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNextDaily(t *testing.T) {
+	at := 3 * time.Hour
+	tests := []struct {
+		now  string
+		want string
+	}{
+		{now: "2026-10-16T01:00:00Z", want: "2026-10-16T03:00:00Z"},
+		{now: "2026-10-16T03:00:00Z", want: "2026-10-17T03:00:00Z"},
+		{now: "2026-10-16T22:30:00+07:00", want: "2026-10-17T03:00:00Z"},
+	}
+	for _, tc := range tests {
+		now, _ := time.Parse(time.RFC3339, tc.now)
+		if got := nextDaily(now, at).Format(time.RFC3339); got != tc.want {
+			t.Fatalf("nextDaily(%s): expected %s, got %s", tc.now, tc.want, got)
+		}
+	}
+}
+
+func TestSchedulerTrigger(t *testing.T) {
+	s := newScheduler()
+	ran := make(chan struct{})
+	s.add("failing", "after imports", nil, func(ctx context.Context) (string, error) {
+		defer close(ran)
+		return "", errors.New("cluster unavailable")
+	})
+	s.start()
+	defer s.stop()
+
+	if s.trigger("missing") {
+		t.Fatalf("expected an unknown job not to be triggered")
+	}
+	if !s.trigger("failing") {
+		t.Fatalf("expected the job to be triggered")
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the job to run")
+	}
+	deadline := time.Now().Add(time.Second)
+	for s.statuses()[0].Runs == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	status := s.statuses()[0]
+	if status.Runs != 1 || status.State != jobIdle || status.LastError != "cluster unavailable" || status.NextRunAt != nil {
+		t.Fatalf("expected one failed run and no next run, got %+v", status)
+	}
+}
+
+func TestDuringImport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newScheduler()
+	var calls []string
+	s.tuneRefresh = func(ctx context.Context, off bool) error {
+		if off {
+			calls = append(calls, "off")
+		} else {
+			calls = append(calls, "on")
+		}
+		return nil
+	}
+	s.add(forceMergeJob, "after imports", nil, func(ctx context.Context) (string, error) { return "", nil })
+
+	router := gin.New()
+	router.POST("/import", s.duringImport(), func(c *gin.Context) {
+		if deferred, _ := c.Request.Context().Value(deferRefreshKey{}).(bool); !deferred {
+			t.Errorf("expected bulk refresh deferred during the import")
+		}
+		calls = append(calls, "import")
+		c.JSON(http.StatusOK, gin.H{"imported": 1})
+		calls = append(calls, "responded")
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/import", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if want := []string{"off", "import", "on", "responded"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+	if len(s.jobs[0].trigger) != 1 {
+		t.Fatalf("expected a force merge queued")
+	}
+}
+
+func TestHandleListJobs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newScheduler()
+	s.add(analyticsRollupJob, "daily at 03:00 UTC", func(now time.Time) time.Time { return nextDaily(now, 3*time.Hour) }, func(ctx context.Context) (string, error) { return "", nil })
+
+	w := serve(handleListJobs(s), http.MethodGet, "/jobs", "/jobs", "")
+	var response struct {
+		Jobs []JobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Jobs) != 1 || response.Jobs[0].Name != analyticsRollupJob || response.Jobs[0].State != jobIdle {
+		t.Fatalf("expected the idle rollup job, got %+v", response.Jobs)
+	}
+
+	w = serve(handleRunJob(s), http.MethodPost, "/jobs/:name/run", "/jobs/missing/run", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", w.Code)
+	}
+	w = serve(handleRunJob(s), http.MethodPost, "/jobs/:name/run", "/jobs/"+analyticsRollupJob+"/run", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// movieLanguages maps the languages a search can target to Elasticsearch's
+// built-in analyzer for each, which stems words and drops stopwords.
+var movieLanguages = map[string]string{
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fr": "french",
+	"id": "indonesian",
+	"it": "italian",
+	"nl": "dutch",
+	"pt": "portuguese",
+}
+
+// Translation is a movie's title and description in another language.
+type Translation struct {
+	Title       string `json:"title" binding:"required,max=300"`
+	Description string `json:"description,omitempty" binding:"max=5000"`
+}
+
+func languageCodes() string {
+	codes := make([]string, 0, len(movieLanguages))
+	for code := range movieLanguages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return strings.Join(codes, ", ")
+}
+
+// parseLanguage accepts an empty lang, which searches without language fields.
+func parseLanguage(value string) (string, error) {
+	lang := strings.ToLower(strings.TrimSpace(value))
+	if _, ok := movieLanguages[lang]; lang != "" && !ok {
+		return "", fmt.Errorf("lang must be one of %s", languageCodes())
+	}
+	return lang, nil
+}
+
+// languageSubfields analyzes the original title or description once per language, as title.en, title.id, and so on.
+func languageSubfields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	for code, analyzer := range movieLanguages {
+		fields[code] = map[string]interface{}{"type": "text", "analyzer": analyzer}
+	}
+	return fields
+}
+
+func translationsMapping() map[string]interface{} {
+	properties := map[string]interface{}{}
+	for code, analyzer := range movieLanguages {
+		properties[code] = map[string]interface{}{
+			"properties": map[string]interface{}{
+				"title":       map[string]interface{}{"type": "text", "analyzer": analyzer},
+				"description": map[string]interface{}{"type": "text", "analyzer": analyzer},
+			},
+		}
+	}
+	return map[string]interface{}{"properties": properties}
+}
+
+// languageFields are the extra multi_match fields for a lang, weighted like the title and description.
+func (p boostProfile) languageFields(lang string) []string {
+	if lang == "" {
+		return nil
+	}
+	var fields []string
+	for _, field := range []string{"title", "description"} {
+		if weight := p.Fields[field]; weight > 0 {
+			fields = append(fields,
+				weightedField(field+"."+lang, weight),
+				weightedField("translations."+lang+"."+field, weight))
+		}
+	}
+	return fields
+}
+
+// validateTranslations checks the language codes and trims each translation.
+func validateTranslations(movie *Movie, fields map[string]string) {
+	for code, translation := range movie.Translations {
+		translation.Title = strings.TrimSpace(translation.Title)
+		translation.Description = strings.TrimSpace(translation.Description)
+		switch {
+		case movieLanguages[code] == "":
+			fields[fmt.Sprintf("translations[%s]", code)] = "must be one of the languages " + languageCodes()
+		case translation.Title == "":
+			fields[fmt.Sprintf("translations[%s].title", code)] = "is required"
+		default:
+			movie.Translations[code] = translation
+		}
+	}
+	if len(movie.Translations) == 0 {
+		movie.Translations = nil
+	}
+}
+
+func mapToTranslations(source interface{}) map[string]Translation {
+	raw, ok := source.(map[string]interface{})
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	translations := make(map[string]Translation, len(raw))
+	for code, value := range raw {
+		entry, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		title, _ := entry["title"].(string)
+		description, _ := entry["description"].(string)
+		translations[code] = Translation{Title: title, Description: description}
+	}
+	return translations
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMovieTextQueryLanguage(t *testing.T) {
+	tests := []struct {
+		lang       string
+		wantFields string
+	}{
+		{lang: "", wantFields: "title^2,description,genres"},
+		{lang: "id", wantFields: "title^2,description,genres,title.id^2,translations.id.title^2,description.id,translations.id.description"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.lang, func(t *testing.T) {
+			query := movieTextQuery("pencuri", "AUTO", tc.lang)
+			should := query["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+			fields := should[0]["multi_match"].(map[string]interface{})["fields"].([]string)
+			if got := strings.Join(fields, ","); got != tc.wantFields {
+				t.Fatalf("expected %s, got %s", tc.wantFields, got)
+			}
+		})
+	}
+}
+
+func TestTranslationsRoundTrip(t *testing.T) {
+	movie := Movie{Title: "Inception", Translations: map[string]Translation{"id": {Title: " Inception ", Description: "Pencuri mimpi. "}}}
+	if fields := validateMovie(&movie); len(fields) != 0 {
+		t.Fatalf("expected no errors, got %v", fields)
+	}
+	want := map[string]Translation{"id": {Title: "Inception", Description: "Pencuri mimpi."}}
+	if !reflect.DeepEqual(movie.Translations, want) {
+		t.Fatalf("expected trimmed translations %v, got %v", want, movie.Translations)
+	}
+
+	source := map[string]interface{}{
+		"title":        "Inception",
+		"translations": map[string]interface{}{"id": map[string]interface{}{"title": "Inception", "description": "Pencuri mimpi."}},
+	}
+	if got := mapToMovie(source).Translations; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v from the source, got %v", want, got)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLimits holds the per-IP search limits and the body size limits.
+type requestLimits struct {
+	search    *rateLimiter
+	expensive *rateLimiter
+	body      int64
+	importing int64
+}
+
+func newRequestLimits() (*requestLimits, error) {
+	search, err := envRate("RATE_LIMIT_SEARCH", 120)
+	if err != nil {
+		return nil, err
+	}
+	expensive, err := envRate("RATE_LIMIT_EXPENSIVE", 20)
+	if err != nil {
+		return nil, err
+	}
+	body, err := envBytes("MAX_BODY_BYTES", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	importing, err := envBytes("MAX_IMPORT_BYTES", 100<<20)
+	if err != nil {
+		return nil, err
+	}
+	return &requestLimits{search: newRateLimiter(search), expensive: newRateLimiter(expensive), body: body, importing: importing}, nil
+}
+
+func envRate(key string, fallback int) (int, error) {
+	value := getenv(key, "")
+	if value == "" {
+		return fallback, nil
+	}
+	perMinute, err := strconv.Atoi(value)
+	if err != nil || perMinute < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be requests per minute, or 0 for no limit", key, value)
+	}
+	return perMinute, nil
+}
+
+func envBytes(key string, fallback int64) (int64, error) {
+	value := getenv(key, "")
+	if value == "" {
+		return fallback, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive number of bytes", key, value)
+	}
+	return size, nil
+}
+
+// loadTrustedProxies limits which peers may set X-Forwarded-For, which the
+// rate limits key on. Unset, gin believes any peer.
+func loadTrustedProxies(router *gin.Engine) error {
+	value := getenv("TRUSTED_PROXIES", "")
+	if value == "" {
+		return nil
+	}
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES %q: %w", value, err)
+	}
+	return nil
+}
+
+func (l *requestLimits) limitSearch() gin.HandlerFunc {
+	return l.search.limit(nil)
+}
+
+// limitExpensive applies the stricter limit, to every request or only those when matches.
+func (l *requestLimits) limitExpensive(when func(*gin.Context) bool) gin.HandlerFunc {
+	return l.expensive.limit(when)
+}
+
+func (l *requestLimits) limitBody() gin.HandlerFunc {
+	return limitBody(l.body)
+}
+
+func (l *requestLimits) limitImport() gin.HandlerFunc {
+	return limitBody(l.importing)
+}
+
+func vectorSearch(c *gin.Context) bool {
+	mode := c.Query("mode")
+	return mode == "semantic" || mode == "hybrid"
+}
+
+// rateLimiter is a token bucket per client IP. Each bucket holds a minute's
+// worth of requests, so a client can spend them in a burst.
+type rateLimiter struct {
+	perMinute int
+
+	mu        sync.Mutex
+	clients   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute == 0 {
+		return nil
+	}
+	return &rateLimiter{perMinute: perMinute, clients: map[string]*tokenBucket{}, lastSweep: time.Now()}
+}
+
+// allow takes a token for the client, or says how long until one is back.
+func (rl *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	capacity := float64(rl.perMinute)
+	perSecond := capacity / 60
+
+	// A bucket idle for a minute is full again, the same as no bucket.
+	if now.Sub(rl.lastSweep) >= time.Minute {
+		for key, bucket := range rl.clients {
+			if now.Sub(bucket.updated) >= time.Minute {
+				delete(rl.clients, key)
+			}
+		}
+		rl.lastSweep = now
+	}
+	bucket, ok := rl.clients[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		rl.clients[client] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+}
+
+// limit answers 429 with Retry-After once a client is out of tokens. A nil limiter lets everything through.
+func (rl *rateLimiter) limit(when func(*gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rl == nil || (when != nil && !when(c)) {
+			c.Next()
+			return
+		}
+		if ok, wait := rl.allow(c.ClientIP(), time.Now()); !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			errorsTotal.WithLabelValues("rate_limited").Inc()
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("too many requests, try again in %ds", seconds)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// limitBody answers 413 up front when Content-Length is over the limit, and
+// caps the read for bodies sent without one.
+func limitBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("the body is larger than %d bytes", limit)})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// bodyTooLarge answers 413 when err came from a read past limitBody's cap.
+func bodyTooLarge(c *gin.Context, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("the body is larger than %d bytes", tooLarge.Limit)})
+	return true
+}
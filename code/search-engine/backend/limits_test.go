@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := newRateLimiter(60)
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		if ok, _ := limiter.allow("1.2.3.4", now); !ok {
+			t.Fatalf("expected request %d within the burst", i+1)
+		}
+	}
+	ok, wait := limiter.allow("1.2.3.4", now)
+	if ok || wait != time.Second {
+		t.Fatalf("expected a 1s wait after the burst, got %v %v", ok, wait)
+	}
+	if ok, _ := limiter.allow("5.6.7.8", now); !ok {
+		t.Fatalf("expected another client to have its own bucket")
+	}
+	if ok, _ := limiter.allow("1.2.3.4", now.Add(time.Second)); !ok {
+		t.Fatalf("expected a token back after a second")
+	}
+	limiter.allow("5.6.7.8", now.Add(2*time.Minute))
+	if _, ok := limiter.clients["1.2.3.4"]; ok {
+		t.Fatalf("expected idle buckets swept")
+	}
+	if newRateLimiter(0) != nil {
+		t.Fatalf("expected 0 to turn the limit off")
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := &requestLimits{search: newRateLimiter(2), expensive: newRateLimiter(1), body: 16}
+	router := gin.New()
+	router.GET("/api/movies", limits.limitExpensive(vectorSearch), limits.limitSearch(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/api/movies/:id/reviews", limits.limitBody(), func(c *gin.Context) {
+		var review Review
+		if err := c.ShouldBindJSON(&review); err != nil {
+			if !bodyTooLarge(c, err) {
+				c.Status(http.StatusBadRequest)
+			}
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "semantic search", target: "/api/movies?q=space&mode=semantic", wantStatus: http.StatusOK},
+		{name: "second semantic search", target: "/api/movies?q=space&mode=hybrid", wantStatus: http.StatusTooManyRequests},
+		{name: "keyword search", target: "/api/movies?q=space", wantStatus: http.StatusOK},
+		{name: "over the search limit", target: "/api/movies?q=space", wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+			if tc.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Fatalf("expected Retry-After on a 429")
+			}
+		})
+	}
+
+	body := `{"rating": 8, "text": "` + strings.Repeat("a", 32) + `"}`
+	for _, contentLength := range []int64{int64(len(body)), -1} {
+		req := httptest.NewRequest(http.MethodPost, "/api/movies/m1/reviews", strings.NewReader(body))
+		req.ContentLength = contentLength
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413 with Content-Length %d, got %d", contentLength, w.Code)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	liveSearchMaxQuery = 1024
+	liveSearchIdle     = 5 * time.Minute
+)
+
+// liveSearchDebounce is how long typing has to pause before a query runs.
+var liveSearchDebounce = 150 * time.Millisecond
+
+type liveSearchResult struct {
+	Query       string       `json:"q"`
+	Suggestions []Suggestion `json:"suggestions"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// handleLiveSearch upgrades to a WebSocket that takes the search box's text
+// as it changes and answers with title suggestions once typing pauses. Only
+// the latest text is searched; anything typed meanwhile is dropped.
+func handleLiveSearch(suggest func(ctx context.Context, prefix string, size int) ([]Suggestion, error)) gin.HandlerFunc {
+	server := websocket.Server{
+		// Any origin may connect, as with CORS on the HTTP API.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = liveSearchMaxQuery
+			serveLiveSearch(conn, suggest)
+		},
+	}
+	return func(c *gin.Context) {
+		server.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func serveLiveSearch(conn *websocket.Conn, suggest func(ctx context.Context, prefix string, size int) ([]Suggestion, error)) {
+	ctx, cancel := context.WithCancel(conn.Request().Context())
+	defer cancel()
+
+	// Holds at most the latest query, so a slow search never queues up keystrokes.
+	queries := make(chan string, 1)
+	go func() {
+		defer close(queries)
+		for {
+			conn.SetReadDeadline(time.Now().Add(liveSearchIdle))
+			var query string
+			if err := websocket.Message.Receive(conn, &query); err != nil {
+				cancel()
+				return
+			}
+			select {
+			case <-queries:
+			default:
+			}
+			queries <- strings.TrimSpace(query)
+		}
+	}()
+
+	var (
+		pending, last string
+		answered      bool
+		timer         <-chan time.Time
+	)
+	for {
+		select {
+		case query, ok := <-queries:
+			if !ok {
+				return
+			}
+			pending = query
+			timer = time.After(liveSearchDebounce)
+		case <-timer:
+			timer = nil
+			if answered && last == pending {
+				continue
+			}
+			result := liveSearchResult{Query: pending, Suggestions: []Suggestion{}}
+			if pending != "" {
+				suggestions, err := suggest(ctx, pending, maxSuggestions)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					slog.Warn("live search failed", "request_id", requestID(ctx), "error", err)
+					result.Error = "suggest request failed"
+				} else {
+					result.Suggestions = suggestions
+				}
+			}
+			if err := websocket.JSON.Send(conn, result); err != nil {
+				return
+			}
+			last, answered = pending, result.Error == ""
+		}
+	}
+}
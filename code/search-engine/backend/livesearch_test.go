@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+func TestLiveSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var mu sync.Mutex
+	var searched []string
+	suggest := func(ctx context.Context, prefix string, size int) ([]Suggestion, error) {
+		mu.Lock()
+		searched = append(searched, prefix)
+		mu.Unlock()
+		if prefix == "fail" {
+			return nil, errors.New("cluster down")
+		}
+		return []Suggestion{{ID: "m1", Title: strings.ToUpper(prefix)}}, nil
+	}
+	router := gin.New()
+	router.GET("/ws/search", handleLiveSearch(suggest))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/search", "", server.URL)
+	if err != nil {
+		t.Fatalf("expected to connect, got %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	receive := func() liveSearchResult {
+		t.Helper()
+		var result liveSearchResult
+		if err := websocket.JSON.Receive(conn, &result); err != nil {
+			t.Fatalf("expected a result, got %v", err)
+		}
+		return result
+	}
+
+	for _, query := range []string{"s", "st", "sta"} {
+		websocket.Message.Send(conn, query)
+	}
+	if result := receive(); result.Query != "sta" || len(result.Suggestions) != 1 || result.Suggestions[0].Title != "STA" {
+		t.Fatalf("expected suggestions for the last query only, got %+v", result)
+	}
+
+	websocket.Message.Send(conn, "fail")
+	if result := receive(); result.Error == "" || len(result.Suggestions) != 0 {
+		t.Fatalf("expected an error result, got %+v", result)
+	}
+
+	websocket.Message.Send(conn, " ")
+	if result := receive(); result.Query != "" || len(result.Suggestions) != 0 {
+		t.Fatalf("expected no suggestions for an empty query, got %+v", result)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(searched, ",") != "sta,fail" {
+		t.Fatalf("expected searches for sta and fail, got %v", searched)
+	}
+}
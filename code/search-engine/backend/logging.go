@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// An incoming id is kept when it looks like one, so a proxy's id carries through.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Responses that report a took time start with it, so it is always in the first bytes.
+var tookPattern = regexp.MustCompile(`"took"\s*:\s*(\d+)`)
+
+// setupLogging sends every log line, including the log package's, through
+// slog as JSON, or as text with LOG_FORMAT=text.
+func setupLogging() error {
+	var handler slog.Handler
+	switch format := getenv("LOG_FORMAT", "json"); format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q: must be json or text", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func recoverPanic(c *gin.Context, recovered interface{}) {
+	slog.Error("panic", "request_id", requestID(c.Request.Context()), "error", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+}
+
+// requestInfo follows a request through the Elasticsearch calls it makes.
+type requestInfo struct {
+	id         string
+	esRequests atomic.Int64
+	esTookMS   atomic.Int64
+}
+
+type requestInfoKey struct{}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+func requestID(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// requestLogger gives each request an id, returned in X-Request-ID, and logs
+// one line when it finishes.
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		info := &requestInfo{id: c.GetHeader(requestIDHeader)}
+		if !requestIDPattern.MatchString(info.id) {
+			info.id = uuid.NewString()
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestInfoKey{}, info))
+		c.Header(requestIDHeader, info.id)
+		c.Next()
+
+		attrs := []slog.Attr{
+			slog.String("request_id", info.id),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if query := c.Request.URL.Query(); len(query) > 0 {
+			attrs = append(attrs, slog.Any("query", query))
+		}
+		if hits, ok := c.Get(searchHitsKey); ok {
+			attrs = append(attrs, slog.Any("hits", hits))
+		}
+		if requests := info.esRequests.Load(); requests > 0 {
+			attrs = append(attrs, slog.Int64("es_requests", requests), slog.Int64("es_took_ms", info.esTookMS.Load()))
+		}
+		if cache := c.Writer.Header().Get("X-Cache"); cache != "" {
+			attrs = append(attrs, slog.String("cache", cache))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// traceElasticsearch tags the request with X-Opaque-Id, which Elasticsearch
+// puts in its slow logs and task list, and adds the took time of the response
+// to the request's total.
+func traceElasticsearch(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	info := requestInfoFrom(req.Context())
+	if info == nil {
+		return send(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Opaque-Id", info.id)
+	res, err := send(req)
+	if err != nil {
+		return res, err
+	}
+	info.esRequests.Add(1)
+	reader := bufio.NewReader(res.Body)
+	head, _ := reader.Peek(64)
+	if match := tookPattern.FindSubmatch(head); match != nil {
+		took, _ := strconv.ParseInt(string(match[1]), 10, 64)
+		info.esTookMS.Add(took)
+	}
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, res.Body}
+	return res, nil
+}
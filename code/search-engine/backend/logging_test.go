@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer slog.SetDefault(slog.Default())
+	var logs bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	var opaqueIDs []string
+	transport := metricsTransport{next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		opaqueIDs = append(opaqueIDs, req.Header.Get("X-Opaque-Id"))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"took":7,"timed_out":false,"hits":{}}`))}, nil
+	})}
+	router := gin.New()
+	router.Use(requestLogger())
+	router.GET("/movies", func(c *gin.Context) {
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/movies/_search", nil).WithContext(c.Request.Context())
+			res, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("round trip: %v", err)
+			}
+			if body, _ := io.ReadAll(res.Body); !strings.HasPrefix(string(body), `{"took":7`) {
+				t.Fatalf("expected the whole body after peeking at took, got %s", body)
+			}
+		}
+		c.Set(searchHitsKey, 3)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		wantID string
+	}{
+		{name: "generated id"},
+		{name: "incoming id", header: "proxy-1234", wantID: "proxy-1234"},
+		{name: "invalid incoming id", header: "not an id\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs.Reset()
+			opaqueIDs = nil
+			req := httptest.NewRequest(http.MethodGet, "/movies?q=heat", nil)
+			if tc.header != "" {
+				req.Header.Set(requestIDHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if id == "" || (tc.wantID != "" && id != tc.wantID) || id == tc.header && tc.wantID == "" {
+				t.Fatalf("unexpected request id %q", id)
+			}
+			if len(opaqueIDs) != 2 || opaqueIDs[0] != id {
+				t.Fatalf("expected X-Opaque-Id %s on both calls, got %v", id, opaqueIDs)
+			}
+			var line struct {
+				RequestID  string              `json:"request_id"`
+				Status     int                 `json:"status"`
+				Query      map[string][]string `json:"query"`
+				Hits       int                 `json:"hits"`
+				ESRequests int                 `json:"es_requests"`
+				ESTookMS   int                 `json:"es_took_ms"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("decode log line %q: %v", logs.String(), err)
+			}
+			if line.RequestID != id || line.Status != http.StatusOK || line.Query["q"][0] != "heat" || line.Hits != 3 {
+				t.Fatalf("unexpected log line %s", logs.String())
+			}
+			if line.ESRequests != 2 || line.ESTookMS != 14 {
+				t.Fatalf("expected 2 Elasticsearch requests taking 14ms, got %s", logs.String())
+			}
+		})
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
@@ -19,14 +22,32 @@ import (
 
 const movieIndex = "movies"
 
+var (
+	defaultFuzziness    = "AUTO"
+	didYouMeanThreshold = 3
+)
+
 // Movie represents the schema stored in Elasticsearch.
 type Movie struct {
-	ID          string  `json:"id"`
-	Title       string  `json:"title" binding:"required"`
-	Description string  `json:"description"`
-	Genre       string  `json:"genre"`
-	Rating      float64 `json:"rating"`
-	ReleaseYear int     `json:"release_year"`
+	ID          string   `json:"id"`
+	Title       string   `json:"title" binding:"required,max=300"`
+	Description string   `json:"description" binding:"max=5000"`
+	Genres      []string `json:"genres" binding:"max=10,dive,max=100"`
+	Rating      float64  `json:"rating" binding:"min=0,max=10"`
+	ReleaseYear int      `json:"release_year"`
+	PosterURL   string   `json:"poster_url" binding:"omitempty,url"`
+	Directors   []Person `json:"directors" binding:"omitempty,dive"`
+	Cast        []Person `json:"cast" binding:"omitempty,dive"`
+	Crew        []Person `json:"crew" binding:"omitempty,dive"`
+	// Collection names the franchise, such as The Dark Knight Trilogy.
+	Collection string `json:"collection,omitempty" binding:"max=300"`
+	// Providers are the streaming services it is on, such as Netflix.
+	Providers []string `json:"providers,omitempty" binding:"max=20,dive,max=100"`
+	// Translations are keyed by language code, such as id for Indonesian.
+	Translations map[string]Translation `json:"translations,omitempty" binding:"omitempty,dive"`
+	// UserRating and ReviewCount summarise the reviews and are read-only.
+	UserRating  float64 `json:"user_rating"`
+	ReviewCount int     `json:"review_count"`
 }
 
 // Pagination metadata returned to the UI.
@@ -38,21 +59,66 @@ type Pagination struct {
 }
 
 func main() {
-	es := mustCreateElasticsearchClient()
-	if err := bootstrapElasticsearch(es); err != nil {
-		log.Fatalf("failed to bootstrap Elasticsearch: %v", err)
+	if err := setupLogging(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadSearchEngine(); err != nil {
+		log.Fatal(err)
+	}
+	loadSearchSettings()
+	loadMovieValidation()
+	if err := loadSynonyms(); err != nil {
+		log.Fatalf("failed to load synonyms: %v", err)
+	}
+	if err := loadEmbeddings(); err != nil {
+		log.Fatalf("failed to set up embeddings: %v", err)
+	}
+	if err := loadTMDB(); err != nil {
+		log.Fatalf("failed to set up TMDB import: %v", err)
+	}
+	if err := loadAuth(); err != nil {
+		log.Fatalf("failed to set up sign-in: %v", err)
+	}
+	if err := loadAPIKeys(); err != nil {
+		log.Fatalf("failed to load API keys: %v", err)
+	}
+	if err := loadBoosts(); err != nil {
+		log.Fatalf("failed to load search boosts: %v", err)
+	}
+	if err := loadExperiment(); err != nil {
+		log.Fatalf("failed to load search experiment: %v", err)
+	}
+	if err := loadMetrics(); err != nil {
+		log.Fatalf("failed to set up metrics: %v", err)
+	}
+	if err := loadSeed(); err != nil {
+		log.Fatalf("failed to load seed data: %v", err)
+	}
+	if err := loadTimeouts(); err != nil {
+		log.Fatalf("failed to set up timeouts: %v", err)
+	}
+	if err := loadJobs(); err != nil {
+		log.Fatalf("failed to set up maintenance jobs: %v", err)
 	}
 
-	router := gin.Default()
-	router.Use(corsMiddleware())
+	router := gin.New()
+	if err := loadTrustedProxies(router); err != nil {
+		log.Fatalf("failed to set up trusted proxies: %v", err)
+	}
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, recoverPanic), requestLogger(), corsMiddleware(), requestMetrics(), requestTimeout(), compressResponses())
+	router.GET("/metrics", handleMetrics())
+	registerAPIDocs(router)
 
-	api := router.Group("/api")
-	{
-		api.GET("/movies", handleSearchMovies(es))
-		api.GET("/movies/:id", handleGetMovie(es))
-		api.POST("/movies", handleCreateMovie(es))
-		api.PUT("/movies/:id", handleUpdateMovie(es))
-		api.DELETE("/movies/:id", handleDeleteMovie(es))
+	stop := func() {}
+	apiFallback := apiNotFound
+	switch backend := getenv("SEARCH_BACKEND", "elasticsearch"); backend {
+	case "elasticsearch":
+		stop = setupElasticsearch(router)
+	case "memory":
+		setupMemory(router)
+		apiFallback = memoryUnsupported
+	default:
+		log.Fatalf("SEARCH_BACKEND must be elasticsearch or memory, got %q", backend)
 	}
 
 	// Serve the static frontend from ../frontend by default.
@@ -61,68 +127,317 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to resolve frontend directory: %v", err)
 	}
-	if _, err := os.Stat(absDir); err == nil {
-		router.Static("/app", absDir)
-	} else {
+	if _, err := os.Stat(absDir); err != nil {
 		log.Printf("frontend directory not found at %s, API will still be available", absDir)
+		absDir = ""
 	}
+	router.NoRoute(handleNoRoute(absDir, apiFallback))
 
 	port := getenv("PORT", "8080")
-	if err := router.Run(":" + port); err != nil {
+	if err := runServer(router, ":"+port, stop); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server failed: %v", err)
 	}
 }
 
-func mustCreateElasticsearchClient() *elasticsearch.Client {
+// setupElasticsearch returns what to run once the server has stopped.
+func setupElasticsearch(router *gin.Engine) func() {
+	es, breaker := mustCreateElasticsearchClient()
+	if err := waitForElasticsearch(es); err != nil {
+		log.Fatalf("failed to reach Elasticsearch: %v", err)
+	}
+	if err := bootstrapElasticsearch(es); err != nil {
+		log.Fatalf("failed to bootstrap Elasticsearch: %v", err)
+	}
+	breaker.arm()
+
+	reindex := newReindexer(es)
+	alerts := newAlertDispatcher(es)
+	searchLogs := newSearchLogger(es)
+	jobs := newMaintenance(es, reindex, searchLogs != nil)
+	jobs.start()
+	posters, err := newPosterProxy()
+	if err != nil {
+		log.Fatalf("failed to set up poster cache: %v", err)
+	}
+	lists, err := newListCache()
+	if err != nil {
+		log.Fatalf("failed to set up list cache: %v", err)
+	}
+	searches, err := newSearchCache()
+	if err != nil {
+		log.Fatalf("failed to set up search cache: %v", err)
+	}
+	seeds := newSeeder(es, reindex, searches)
+	limits, err := newRequestLimits()
+	if err != nil {
+		log.Fatalf("failed to set up request limits: %v", err)
+	}
+
+	router.GET("/readyz", handleReadyz(es, breaker))
+
+	repo := esRepository{es}
+	router.GET("/ws/search", guardElasticsearch(breaker), limits.limitSearch(), handleLiveSearch(func(ctx context.Context, prefix string, size int) ([]Suggestion, error) {
+		return suggestTitles(ctx, es, prefix, size)
+	}))
+	api := router.Group("/api", guardElasticsearch(breaker))
+	{
+		api.GET("/movies", limits.limitExpensive(vectorSearch), limits.limitSearch(), assignExperiment(), logSearches(searchLogs), searches.cached(), handleSearchMovies(repo))
+		api.GET("/movies/suggest", handleSuggestMovies(es))
+		api.POST("/movies/search", limits.limitSearch(), limits.limitBody(), handleQueryMovies(repo))
+		api.GET("/movies/random", handleRandomMovies(repo))
+		api.GET("/movies/discover", limits.limitSearch(), handleDiscoverMovies(repo))
+		api.GET("/movies/trending", lists.cached(), handleTrendingMovies(es))
+		api.GET("/movies/top", lists.cached(), handleTopMovies(es))
+		api.GET("/movies/:id", handleGetMovie(repo))
+		api.GET("/genres", limits.limitExpensive(nil), handleListGenres(repo))
+		api.GET("/movies/:id/similar", limits.limitExpensive(nil), handleSimilarMovies(es))
+		api.GET("/posters/:id", handlePoster(es, posters))
+		api.POST("/movies", requireRole(roleEditor), limits.limitBody(), rejectWritesDuringReindex(reindex), searches.invalidates(), handleCreateMovie(repo, alerts))
+		api.PUT("/movies/:id", requireRole(roleEditor), limits.limitBody(), rejectWritesDuringReindex(reindex), searches.invalidates(), handleUpdateMovie(repo))
+		api.DELETE("/movies/:id", requireRole(roleEditor), rejectWritesDuringReindex(reindex), searches.invalidates(), handleDeleteMovie(repo))
+		api.POST("/movies/:id/restore", requireRole(roleEditor), rejectWritesDuringReindex(reindex), searches.invalidates(), handleRestoreMovie(repo))
+
+		api.GET("/search", limits.limitSearch(), searches.cached(), handleSearchAll(repo))
+		for path, kind := range map[string]entityKind{"/people": personKind, "/collections": collectionKind} {
+			api.POST(path, requireRole(roleEditor), limits.limitBody(), searches.invalidates(), handleCreateEntity(repo, kind))
+			api.PUT(path+"/:id", requireRole(roleEditor), limits.limitBody(), searches.invalidates(), handleUpdateEntity(repo, kind))
+			api.DELETE(path+"/:id", requireRole(roleEditor), searches.invalidates(), handleDeleteEntity(repo, kind))
+		}
+		api.GET("/people/:id", handleGetEntity(repo, personKind))
+		api.GET("/collections/:id", handleGetCollection(repo))
+
+		api.GET("/movies/:id/reviews", handleListReviews(es))
+		api.POST("/movies/:id/reviews", limits.limitBody(), rejectWritesDuringReindex(reindex), searches.invalidates(), handleCreateReview(es))
+		api.DELETE("/movies/:id/reviews/:reviewId", requireRole(roleEditor), rejectWritesDuringReindex(reindex), searches.invalidates(), handleDeleteReview(es))
+		api.GET("/reviews", limits.limitSearch(), handleSearchReviews(es))
+		api.POST("/analytics/click", assignExperiment(), handleRecordClick(searchLogs))
+		// The path clicks were first reported on, kept for older clients.
+		api.POST("/search/clicks", assignExperiment(), handleRecordClick(searchLogs))
+
+		api.POST("/auth/register", handleRegister(es))
+		api.POST("/auth/login", handleLogin(es))
+		me := api.Group("/me", requireUser())
+		me.GET("/searches", handleListSavedSearches(es))
+		me.POST("/searches", handleCreateSavedSearch(es))
+		me.GET("/searches/:searchId/results", assignExperiment(), logSearches(searchLogs), handleRunSavedSearch(es))
+		me.DELETE("/searches/:searchId", handleDeleteSavedSearch(es))
+		me.GET("/watchlist", handleGetWatchlist(es))
+		me.POST("/watchlist", handleAddToWatchlist(es))
+		me.DELETE("/watchlist/:movieId", handleRemoveFromWatchlist(es))
+		me.GET("/alerts", handleListAlerts(es))
+		me.POST("/alerts", handleCreateAlert(es, alerts))
+		me.DELETE("/alerts/:alertId", handleDeleteAlert(es))
+
+		admin := api.Group("/admin", requireAdmin())
+		admin.POST("/reindex", handleStartReindex(reindex))
+		admin.POST("/embeddings/backfill", rejectWritesDuringReindex(reindex), searches.invalidates(), handleBackfillEmbeddings(es))
+		admin.GET("/reindex", handleReindexStatus(reindex))
+		admin.GET("/index/stats", handleIndexStats(es, reindex))
+		admin.GET("/analytics", handleAnalytics(es))
+		admin.GET("/analytics/clicks", handleClickReport(es))
+		admin.GET("/jobs", handleListJobs(jobs))
+		admin.POST("/jobs/:name/run", handleRunJob(jobs))
+		admin.POST("/import/tmdb", rejectWritesDuringReindex(reindex), searches.invalidates(), jobs.duringImport(), handleImportTMDB(es, alerts))
+		admin.POST("/import/csv", limits.limitImport(), rejectWritesDuringReindex(reindex), searches.invalidates(), jobs.duringImport(), handleImportCSV(es, alerts))
+		admin.GET("/boosts", handleGetBoosts())
+		admin.PUT("/boosts", searches.invalidates(), handleUpdateBoosts())
+		admin.GET("/experiment", handleGetExperiment(es))
+		admin.PUT("/experiment", searches.invalidates(), handleStartExperiment())
+		admin.DELETE("/experiment", searches.invalidates(), handleStopExperiment())
+		admin.GET("/duplicates", handleListDuplicates(repo))
+		admin.POST("/purge", rejectWritesDuringReindex(reindex), searches.invalidates(), handlePurgeMovies(repo, func(ctx context.Context, id string) error {
+			return deleteMovieReviews(ctx, es, id)
+		}))
+		admin.GET("/export", handleExport(repo))
+		admin.POST("/import", limits.limitImport(), rejectWritesDuringReindex(reindex), searches.invalidates(), jobs.duringImport(), handleImport(repo))
+		admin.POST("/seed", rejectWritesDuringReindex(reindex), searches.invalidates(), jobs.duringImport(), handleSeed(seeds))
+	}
+	return func() {
+		jobs.stop()
+		searchLogs.stop()
+	}
+}
+
+func loadSearchSettings() {
+	if value := os.Getenv("SEARCH_FUZZINESS"); value != "" {
+		fuzziness, ok := parseFuzziness(value)
+		if !ok {
+			log.Fatalf("invalid SEARCH_FUZZINESS %q: must be AUTO, 0, 1, or 2", value)
+		}
+		defaultFuzziness = fuzziness
+	}
+	if value := os.Getenv("DID_YOU_MEAN_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			log.Fatalf("invalid DID_YOU_MEAN_THRESHOLD %q: must be a non-negative integer", value)
+		}
+		didYouMeanThreshold = threshold
+	}
+}
+
+func mustCreateElasticsearchClient() (*elasticsearch.Client, *circuitBreaker) {
+	transport, err := newESTransport()
+	if err != nil {
+		log.Fatalf("invalid elasticsearch settings: %v", err)
+	}
+	var roundTripper http.RoundTripper = transport
+	if searchEngine == engineOpenSearch {
+		roundTripper = productHeaderTransport{next: transport}
+	}
 	cfg := elasticsearch.Config{
-		Addresses: []string{getenv("ELASTICSEARCH_ADDRESS", "http://localhost:9200")},
-		Username:  os.Getenv("ELASTICSEARCH_USERNAME"),
-		Password:  os.Getenv("ELASTICSEARCH_PASSWORD"),
+		Addresses:    []string{getenv("ELASTICSEARCH_ADDRESS", "http://localhost:9200")},
+		Username:     os.Getenv("ELASTICSEARCH_USERNAME"),
+		Password:     os.Getenv("ELASTICSEARCH_PASSWORD"),
+		Transport:    roundTripper,
+		DisableRetry: true,
+		// Responses are compressed already: Go's transport asks for gzip and unpacks it.
+		CompressRequestBody: getenv("ELASTICSEARCH_COMPRESS", "true") != "false",
 	}
 
 	client, err := elasticsearch.NewClient(cfg)
 	if err != nil {
 		log.Fatalf("unable to create elasticsearch client: %v", err)
 	}
-	return client
+	return client, transport.breaker
 }
 
 func bootstrapElasticsearch(es *elasticsearch.Client) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	aliasExists, err := es.Indices.ExistsAlias([]string{movieIndex}, es.Indices.ExistsAlias.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("check alias exists: %w", err)
+	}
+	aliasExists.Body.Close()
 	exists, err := es.Indices.Exists([]string{movieIndex}, es.Indices.Exists.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("check index exists: %w", err)
 	}
-	if exists.StatusCode == http.StatusNotFound {
-		if err := createMovieIndex(es); err != nil {
+	exists.Body.Close()
+
+	switch {
+	case aliasExists.StatusCode == http.StatusOK:
+		// A reindex cut short by a restart leaves the live index read-only.
+		current, err := currentMovieIndex(ctx, es)
+		if err != nil {
+			return err
+		}
+		if err := setWriteBlock(ctx, es, current, false); err != nil {
+			return err
+		}
+		// So does an import, with refresh turned off.
+		if err := setRefreshInterval(ctx, es, false); err != nil {
 			return err
 		}
+		if err := ensureTitleSubfields(es); err != nil {
+			return err
+		}
+		ensureAddedFields(es)
+	case exists.StatusCode == http.StatusNotFound:
+		if err := createMovieIndex(ctx, es, movieIndexVersion(1), true); err != nil {
+			return err
+		}
+	default:
+		if err := moveIndexBehindAlias(es); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureReviewIndex(ctx, es); err != nil {
+		return err
+	}
+	if err := ensureUserIndexes(ctx, es); err != nil {
+		return err
+	}
+	if err := ensureAlertIndex(ctx, es); err != nil {
+		return err
+	}
+	if err := ensureSearchLogIndex(ctx, es); err != nil {
+		return err
+	}
+	if err := ensureSearchRollupIndex(ctx, es); err != nil {
+		return err
+	}
+	if err := ensureEntityIndexes(ctx, es); err != nil {
+		return err
+	}
+	if err := migrateGenres(es); err != nil {
+		return err
+	}
+	if err := migrateCollectionKeys(es); err != nil {
+		return err
 	}
 
-	return seedMovies(es)
+	// A seed file can be larger than the bootstrap deadline allows for.
+	seedCtx, cancelSeed := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancelSeed()
+	return seedMovies(seedCtx, es)
 }
 
-func createMovieIndex(es *elasticsearch.Client) error {
-	mapping := map[string]interface{}{
-		"mappings": map[string]interface{}{
-			"properties": map[string]interface{}{
-				"title":        map[string]interface{}{"type": "text"},
-				"description":  map[string]interface{}{"type": "text"},
-				"genre":        map[string]interface{}{"type": "keyword"},
-				"rating":       map[string]interface{}{"type": "float"},
-				"release_year": map[string]interface{}{"type": "integer"},
-			},
+// movieMappingVersion goes up when the movie mapping changes. Startup stamps
+// it on an index that took the new fields in place; one that could not keeps
+// the old version until a reindex, which index stats reports as pending.
+const movieMappingVersion = 1
+
+func movieMappings() map[string]interface{} {
+	titleFields := languageSubfields()
+	for name, mapping := range titleSubfieldMappings {
+		titleFields[name] = mapping
+	}
+	properties := map[string]interface{}{
+		"title": map[string]interface{}{
+			"type":            "text",
+			"analyzer":        movieTextAnalyzer,
+			"search_analyzer": movieSearchAnalyzer,
+			"fields":          titleFields,
+		},
+		"description": map[string]interface{}{
+			"type":            "text",
+			"analyzer":        movieTextAnalyzer,
+			"search_analyzer": movieSearchAnalyzer,
+			"fields":          languageSubfields(),
 		},
+		"translations": translationsMapping(),
+		"genres":       genresMapping,
+		"rating":       map[string]interface{}{"type": "float"},
+		"release_year": map[string]interface{}{"type": "integer"},
+		"poster_url":   posterURLMapping,
+		"providers":    providersMapping,
+	}
+	for path, mapping := range peopleMappings() {
+		properties[path] = mapping
+	}
+	for field, mapping := range reviewStatsMappings {
+		properties[field] = mapping
+	}
+	for field, mapping := range softDeleteMappings {
+		properties[field] = mapping
+	}
+	for field, mapping := range collectionMappings {
+		properties[field] = mapping
+	}
+	if embedder != nil {
+		properties[embeddingField] = embeddingMapping()
+	}
+	return map[string]interface{}{
+		"_meta":      map[string]interface{}{"mapping_version": movieMappingVersion},
+		"properties": properties,
+	}
+}
+
+func createMovieIndex(ctx context.Context, es *elasticsearch.Client, name string, aliased bool) error {
+	body := map[string]interface{}{"settings": movieSettings(), "mappings": movieMappings()}
+	if aliased {
+		body["aliases"] = map[string]interface{}{movieIndex: map[string]interface{}{}}
 	}
 
 	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(mapping); err != nil {
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
 		return fmt.Errorf("encode mapping: %w", err)
 	}
 
-	res, err := es.Indices.Create(movieIndex, es.Indices.Create.WithBody(&buf))
+	res, err := es.Indices.Create(name, es.Indices.Create.WithBody(&buf), es.Indices.Create.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("create index: %w", err)
 	}
@@ -135,8 +450,8 @@ func createMovieIndex(es *elasticsearch.Client) error {
 	return nil
 }
 
-func seedMovies(es *elasticsearch.Client) error {
-	res, err := es.Count(es.Count.WithIndex(movieIndex))
+func seedMovies(ctx context.Context, es *elasticsearch.Client) error {
+	res, err := es.Count(es.Count.WithIndex(movieIndex), es.Count.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("count documents: %w", err)
 	}
@@ -152,80 +467,200 @@ func seedMovies(es *elasticsearch.Client) error {
 		return nil
 	}
 
-	seedData := []Movie{
-		{Title: "Inception", Description: "A thief who steals corporate secrets through dream-sharing technology.", Genre: "Sci-Fi", Rating: 8.8, ReleaseYear: 2010},
-		{Title: "The Dark Knight", Description: "Batman battles the Joker in Gotham City.", Genre: "Action", Rating: 9.0, ReleaseYear: 2008},
-		{Title: "Interstellar", Description: "Explorers travel through a wormhole in space in an attempt to ensure humanity's survival.", Genre: "Sci-Fi", Rating: 8.6, ReleaseYear: 2014},
-		{Title: "La La Land", Description: "A jazz pianist falls for an aspiring actress in Los Angeles.", Genre: "Musical", Rating: 8.0, ReleaseYear: 2016},
-		{Title: "The Godfather", Description: "The aging patriarch of an organized crime dynasty transfers control to his reluctant son.", Genre: "Crime", Rating: 9.2, ReleaseYear: 1972},
+	movies, err := seedData()
+	if err != nil {
+		return err
 	}
-
-	for _, movie := range seedData {
-		movie.ID = uuid.NewString()
-		if err := indexMovie(es, movie.ID, movie); err != nil {
-			return fmt.Errorf("seed movie %s: %w", movie.Title, err)
-		}
+	failed, _, err := upsertMovies(ctx, es, movies, true)
+	if err != nil {
+		return fmt.Errorf("seed movies: %w", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("seed movies: %d of %d failed", failed, len(movies))
 	}
-
 	return nil
 }
 
-func handleSearchMovies(es *elasticsearch.Client) gin.HandlerFunc {
+func sampleMovies() []Movie {
+	return []Movie{
+		{
+			Title: "Inception", Description: "A thief who steals corporate secrets through dream-sharing technology.", Genres: []string{"Sci-Fi", "Action"}, Rating: 8.8, ReleaseYear: 2010,
+			Directors: []Person{{Name: "Christopher Nolan"}},
+			Cast:      []Person{{Name: "Leonardo DiCaprio", Role: "Cobb"}, {Name: "Joseph Gordon-Levitt", Role: "Arthur"}, {Name: "Elliot Page", Role: "Ariadne"}},
+			Crew:      []Person{{Name: "Hans Zimmer", Role: "Composer"}, {Name: "Wally Pfister", Role: "Cinematographer"}},
+		},
+		{
+			Title: "The Dark Knight", Description: "Batman battles the Joker in Gotham City.", Genres: []string{"Action", "Crime"}, Rating: 9.0, ReleaseYear: 2008,
+			Directors: []Person{{Name: "Christopher Nolan"}},
+			Cast:      []Person{{Name: "Christian Bale", Role: "Bruce Wayne"}, {Name: "Heath Ledger", Role: "Joker"}, {Name: "Aaron Eckhart", Role: "Harvey Dent"}},
+			Crew:      []Person{{Name: "Hans Zimmer", Role: "Composer"}, {Name: "James Newton Howard", Role: "Composer"}},
+		},
+		{
+			Title: "Interstellar", Description: "Explorers travel through a wormhole in space in an attempt to ensure humanity's survival.", Genres: []string{"Sci-Fi", "Drama"}, Rating: 8.6, ReleaseYear: 2014,
+			Directors: []Person{{Name: "Christopher Nolan"}},
+			Cast:      []Person{{Name: "Matthew McConaughey", Role: "Cooper"}, {Name: "Anne Hathaway", Role: "Brand"}, {Name: "Jessica Chastain", Role: "Murph"}},
+			Crew:      []Person{{Name: "Hans Zimmer", Role: "Composer"}, {Name: "Hoyte van Hoytema", Role: "Cinematographer"}},
+		},
+		{
+			Title: "La La Land", Description: "A jazz pianist falls for an aspiring actress in Los Angeles.", Genres: []string{"Musical", "Romance"}, Rating: 8.0, ReleaseYear: 2016,
+			Directors: []Person{{Name: "Damien Chazelle"}},
+			Cast:      []Person{{Name: "Ryan Gosling", Role: "Sebastian"}, {Name: "Emma Stone", Role: "Mia"}},
+			Crew:      []Person{{Name: "Justin Hurwitz", Role: "Composer"}, {Name: "Linus Sandgren", Role: "Cinematographer"}},
+		},
+		{
+			Title: "The Godfather", Description: "The aging patriarch of an organized crime dynasty transfers control to his reluctant son.", Genres: []string{"Crime", "Drama"}, Rating: 9.2, ReleaseYear: 1972,
+			Directors: []Person{{Name: "Francis Ford Coppola"}},
+			Cast:      []Person{{Name: "Marlon Brando", Role: "Vito Corleone"}, {Name: "Al Pacino", Role: "Michael Corleone"}},
+			Crew:      []Person{{Name: "Nino Rota", Role: "Composer"}, {Name: "Gordon Willis", Role: "Cinematographer"}},
+		},
+	}
+}
+
+func handleSearchMovies(repo Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		query := c.Query("q")
-		page := parseIntWithDefault(c.Query("page"), 1)
-		pageSize := parseIntWithDefault(c.Query("pageSize"), 5)
-		if page < 1 {
-			page = 1
+		page, pageSize := pageParams(c)
+
+		// paginate=cursor pages with search_after over a point in time,
+		// which has no depth limit. Later pages pass the returned cursor.
+		paginate := c.DefaultQuery("paginate", "page")
+		var cursor searchCursor
+		if value := c.Query("cursor"); value != "" {
+			var err error
+			if cursor, err = decodeCursor(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if cursor.Params != searchParamsFingerprint(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cursor belongs to a different search"})
+				return
+			}
+			paginate = "cursor"
+			page = cursor.Page + 1
+			pageSize = cursor.PageSize
 		}
-		if pageSize <= 0 || pageSize > 50 {
-			pageSize = 5
+		if paginate != "page" && paginate != "cursor" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paginate must be page or cursor"})
+			return
+		}
+		useCursor := paginate == "cursor"
+		pits, canPage := repo.(pointInTimes)
+		if useCursor && !canPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor pagination is not available on this backend"})
+			return
 		}
 
 		from := (page - 1) * pageSize
+		if !useCursor && from+pageSize > maxResultWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page goes past the first %d results, use paginate=cursor to go deeper", maxResultWindow)})
+			return
+		}
 
-		body := map[string]interface{}{
-			"from": from,
-			"size": pageSize,
-			"sort": []map[string]interface{}{
-				{"rating": map[string]interface{}{"order": "desc"}},
-			},
+		sort, err := parseSort(c.Query("sort"), c.Query("order"), query != "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		lang, err := parseLanguage(c.Query("lang"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		groupBy, err := parseGroupBy(c.Query("group_by"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		if query == "" {
-			body["query"] = map[string]interface{}{"match_all": map[string]interface{}{}}
-		} else {
-			body["query"] = map[string]interface{}{
-				"multi_match": map[string]interface{}{
-					"query":  query,
-					"fields": []string{"title^2", "description", "genre"},
-				},
-			}
+		body := map[string]interface{}{
+			"from":    from,
+			"size":    pageSize,
+			"sort":    sort,
+			"timeout": esTimeout(timeouts.search),
 		}
 
-		var buf bytes.Buffer
-		if err := json.NewEncoder(&buf).Encode(body); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode search query"})
+		fuzziness, ok := parseFuzziness(c.DefaultQuery("fuzziness", defaultFuzziness))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fuzziness must be AUTO, 0, 1, or 2"})
 			return
 		}
 
-		res, err := es.Search(
-			es.Search.WithContext(c.Request.Context()),
-			es.Search.WithIndex(movieIndex),
-			es.Search.WithBody(&buf),
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+		mode := c.DefaultQuery("mode", "keyword")
+		switch {
+		case mode != "keyword" && mode != "semantic" && mode != "hybrid":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be keyword, semantic, or hybrid"})
 			return
+		case mode != "keyword" && embedder == nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "semantic search is not enabled on this server"})
+			return
+		case mode != "keyword" && query == "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required for semantic and hybrid search"})
+			return
+		case mode != "keyword" && useCursor:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor pagination is only available in keyword mode"})
+			return
+		case groupBy != "" && (mode != "keyword" || useCursor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group_by only works in keyword mode with page pagination"})
+			return
+		}
+
+		var must []map[string]interface{}
+		filter := []map[string]interface{}{notDeleted()}
+		if query != "" {
+			must = append(must, searchProfile(c).textQuery(query, fuzziness, lang))
+			if len(cursor.After) == 0 {
+				body["suggest"] = didYouMeanSuggester(query)
+			}
+		}
+		if person := strings.TrimSpace(c.Query("person")); person != "" {
+			filter = append(filter, personFilter(person))
+		}
+		if genres := queryGenres(c); len(genres) > 0 {
+			filter = append(filter, genreFilter(genres))
+		}
+		if providers := queryProviders(c); len(providers) > 0 {
+			filter = append(filter, providerFilter(providers))
 		}
-		defer res.Body.Close()
 
-		if res.IsError() {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "search returned an error"})
+		body["query"] = map[string]interface{}{
+			"bool": map[string]interface{}{"must": must, "filter": filter},
+		}
+		if mode != "keyword" {
+			handleVectorSearch(c, repo, mode, query, body["query"].(map[string]interface{}), filter, page, pageSize)
 			return
 		}
+		body["_source"] = map[string]interface{}{"excludes": movieSourceExcludes}
+		if len(cursor.After) == 0 {
+			body["aggs"] = map[string]interface{}{"providers": providersFacet()}
+		}
+		if groupBy == "collection" {
+			groupByCollection(body)
+		}
+
+		pitID := cursor.PIT
+		if useCursor {
+			if pitID == "" {
+				if pitID, err = pits.OpenPointInTime(c.Request.Context(), movieIndex); err != nil {
+					log.Printf("%v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start cursor pagination"})
+					return
+				}
+			}
+			// Elasticsearch adds an implicit _shard_doc tiebreaker to a point in time,
+			// so sort values are unique. OpenSearch needs it spelled out.
+			if searchEngine == engineOpenSearch {
+				body["sort"] = append(sort, pitTiebreaker())
+			}
+			delete(body, "from")
+			body["pit"] = map[string]interface{}{"id": pitID, "keep_alive": pitKeepAlive}
+			body["track_total_hits"] = true
+			if len(cursor.After) > 0 {
+				body["search_after"] = cursor.After
+			}
+		}
 
 		var searchResult struct {
+			searchShards
 			Hits struct {
 				Total struct {
 					Value int `json:"value"`
@@ -233,14 +668,45 @@ func handleSearchMovies(es *elasticsearch.Client) gin.HandlerFunc {
 				Hits []struct {
 					ID     string                 `json:"_id"`
 					Source map[string]interface{} `json:"_source"`
+					Sort   []json.RawMessage      `json:"sort"`
 				} `json:"hits"`
 			} `json:"hits"`
+			Suggest map[string][]struct {
+				Options []struct {
+					Text string `json:"text"`
+				} `json:"options"`
+			} `json:"suggest"`
+			PitID        string `json:"pit_id"`
+			Aggregations struct {
+				Groups *struct {
+					Value int `json:"value"`
+				} `json:"groups"`
+				Providers *termsBuckets `json:"providers"`
+			} `json:"aggregations"`
 		}
 
-		if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode search results"})
+		index := movieIndex
+		if useCursor {
+			index = ""
+		}
+		if err := repo.Search(c.Request.Context(), index, body, &searchResult); err != nil {
+			if useCursor && cursor.PIT != "" && statusCode(err) == http.StatusNotFound {
+				c.JSON(http.StatusGone, gin.H{"error": "cursor has expired, start the search again"})
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "search took too long, try a narrower query"})
+				return
+			}
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
 			return
 		}
+		meta := searchResult.meta()
+		if meta.Partial {
+			log.Printf("partial results for %q: timed out %t, %d of %d shards failed", query, meta.TimedOut, meta.Shards.Failed, meta.Shards.Total)
+			c.Set(searchPartialKey, true)
+		}
 
 		movies := make([]Movie, 0, len(searchResult.Hits.Hits))
 		for _, hit := range searchResult.Hits.Hits {
@@ -250,9 +716,12 @@ func handleSearchMovies(es *elasticsearch.Client) gin.HandlerFunc {
 		}
 
 		totalHits := searchResult.Hits.Total.Value
+		if groups := searchResult.Aggregations.Groups; groups != nil {
+			totalHits = groups.Value
+		}
 		totalPages := (totalHits + pageSize - 1) / pageSize
 
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"movies": movies,
 			"pagination": Pagination{
 				Page:       page,
@@ -260,132 +729,253 @@ func handleSearchMovies(es *elasticsearch.Client) gin.HandlerFunc {
 				TotalHits:  totalHits,
 				TotalPages: totalPages,
 			},
-		})
+			"meta": meta,
+		}
+		if providers := searchResult.Aggregations.Providers; providers != nil {
+			response["facets"] = gin.H{"providers": providers.counts()}
+		}
+		noteSearch(c, response, page, totalHits)
+		if useCursor {
+			// Elasticsearch may hand back a new point in time id; the
+			// newest one must be used for the next page.
+			if searchResult.PitID != "" {
+				pitID = searchResult.PitID
+			}
+			hits := searchResult.Hits.Hits
+			if len(hits) == pageSize && page*pageSize < totalHits {
+				response["next_cursor"] = encodeCursor(searchCursor{
+					PIT:      pitID,
+					After:    hits[len(hits)-1].Sort,
+					Page:     page,
+					PageSize: pageSize,
+					Params:   searchParamsFingerprint(c),
+				})
+			} else {
+				response["next_cursor"] = nil
+				go pits.ClosePointInTime(pitID)
+			}
+		}
+		if totalHits < didYouMeanThreshold {
+			for _, entry := range searchResult.Suggest["did_you_mean"] {
+				if len(entry.Options) > 0 && !strings.EqualFold(entry.Options[0].Text, query) {
+					response["did_you_mean"] = entry.Options[0].Text
+					break
+				}
+			}
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func handleGetMovie(es *elasticsearch.Client) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		id := c.Param("id")
-		res, err := es.Get(movieIndex, id, es.Get.WithContext(c.Request.Context()))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movie"})
-			return
+// movieTextQuery also matches a lang's analyzed subfields and translations, when one is given.
+func movieTextQuery(query, fuzziness, lang string) map[string]interface{} {
+	return currentBoosts().textQuery(query, fuzziness, lang)
+}
+
+// textQuery is movieTextQuery weighted by this profile, such as an experiment's.
+func (profile boostProfile) textQuery(query, fuzziness, lang string) map[string]interface{} {
+	multiMatch := map[string]interface{}{
+		"query":  query,
+		"fields": append(profile.textFields(), profile.languageFields(lang)...),
+	}
+	if profile.TieBreaker > 0 {
+		multiMatch["tie_breaker"] = profile.TieBreaker
+	}
+	if profile.MinimumShouldMatch != "" {
+		multiMatch["minimum_should_match"] = profile.MinimumShouldMatch
+	}
+	if fuzziness != "0" {
+		multiMatch["fuzziness"] = fuzziness
+		// Typos rarely hit the first letter, and pinning it keeps
+		// the expansion small.
+		multiMatch["prefix_length"] = 1
+	}
+	should := append([]map[string]interface{}{{"multi_match": multiMatch}}, peopleQueries(query, fuzziness, profile)...)
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+	}
+}
+
+var sortFields = map[string]struct {
+	field string
+	order string
+}{
+	"_score":        {"_score", "desc"},
+	"relevance":     {"_score", "desc"},
+	"rating":        {"rating", "desc"},
+	"release_year":  {"release_year", "desc"},
+	"year":          {"release_year", "desc"},
+	"title":         {"title.keyword", "asc"},
+	"title.keyword": {"title.keyword", "asc"},
+	"user_rating":   {"user_rating", "desc"},
+}
+
+// parseSort breaks ties by rating, then title, so pages stay stable.
+func parseSort(sortParam, orderParam string, hasQuery bool) ([]map[string]interface{}, error) {
+	field, order, err := resolveSort(sortParam, orderParam, hasQuery)
+	if err != nil {
+		return nil, err
+	}
+	sort := []map[string]interface{}{
+		{field: map[string]interface{}{"order": order}},
+	}
+	for _, tiebreak := range sortTiebreaks {
+		if tiebreak.field != field {
+			sort = append(sort, map[string]interface{}{tiebreak.field: map[string]interface{}{"order": tiebreak.order}})
+		}
+	}
+	return sort, nil
+}
+
+var sortTiebreaks = []struct{ field, order string }{{"rating", "desc"}, {"title.keyword", "asc"}}
+
+func resolveSort(sortParam, orderParam string, hasQuery bool) (string, string, error) {
+	sortParam = strings.ToLower(strings.TrimSpace(sortParam))
+	if sortParam == "" {
+		sortParam = "rating"
+		if hasQuery {
+			sortParam = "_score"
 		}
-		defer res.Body.Close()
+	}
+	sortField, ok := sortFields[sortParam]
+	if !ok {
+		return "", "", fmt.Errorf("sort must be one of _score, rating, release_year, title.keyword, user_rating")
+	}
+
+	order := sortField.order
+	switch strings.ToLower(strings.TrimSpace(orderParam)) {
+	case "":
+	case "asc":
+		order = "asc"
+	case "desc":
+		order = "desc"
+	default:
+		return "", "", fmt.Errorf("order must be asc or desc")
+	}
+	return sortField.field, order, nil
+}
+
+// didYouMeanSuggester reads title.suggest, which is not stemmed, so
+// corrections come back as whole words.
+func didYouMeanSuggester(query string) map[string]interface{} {
+	return map[string]interface{}{
+		"did_you_mean": map[string]interface{}{
+			"text": query,
+			"phrase": map[string]interface{}{
+				"field":      "title.suggest",
+				"size":       1,
+				"max_errors": 2,
+				"direct_generator": []map[string]interface{}{
+					{"field": "title.suggest", "suggest_mode": "always", "min_word_length": 3},
+				},
+			},
+		},
+	}
+}
 
-		if res.StatusCode == http.StatusNotFound {
+func parseFuzziness(value string) (string, bool) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "AUTO":
+		return "AUTO", true
+	case "0", "1", "2":
+		return strings.TrimSpace(value), true
+	}
+	return "", false
+}
+
+func handleGetMovie(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		source, err := repo.Get(c.Request.Context(), movieIndex, id)
+		if errors.Is(err, errDocumentNotFound) || err == nil && isDeleted(source) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
 			return
 		}
-		if res.IsError() {
+		if err != nil {
+			log.Printf("%v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movie"})
 			return
 		}
 
-		var getResponse struct {
-			Source map[string]interface{} `json:"_source"`
-		}
-		if err := json.NewDecoder(res.Body).Decode(&getResponse); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode response"})
-			return
-		}
-
-		movie := mapToMovie(getResponse.Source)
+		movie := mapToMovie(source)
 		movie.ID = id
 		c.JSON(http.StatusOK, movie)
 	}
 }
 
-func handleCreateMovie(es *elasticsearch.Client) gin.HandlerFunc {
+func handleCreateMovie(repo Repository, alerts *alertDispatcher) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input Movie
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindMovie(c, &input) || !checkDuplicates(c, repo, input) {
 			return
 		}
 
 		input.ID = uuid.NewString()
-		if err := indexMovie(es, input.ID, input); err != nil {
+		input.normalizeCredits()
+		input.UserRating, input.ReviewCount = 0, 0
+		if err := indexMovie(c.Request.Context(), repo, input.ID, input); err != nil {
+			log.Printf("%v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create movie"})
 			return
 		}
+		alerts.moviesAdded(input)
 
 		c.JSON(http.StatusCreated, input)
 	}
 }
 
-func handleUpdateMovie(es *elasticsearch.Client) gin.HandlerFunc {
+func handleUpdateMovie(repo Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		var input Movie
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindMovie(c, &input) {
+			return
+		}
+		// Replacing a deleted movie would restore it by accident.
+		if source, err := repo.Get(c.Request.Context(), movieIndex, id); err == nil && isDeleted(source) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie is deleted, restore it first"})
 			return
 		}
 
 		input.ID = id
-		if err := indexMovie(es, id, input); err != nil {
+		input.normalizeCredits()
+		if err := indexMovie(c.Request.Context(), repo, id, input); err != nil {
+			log.Printf("%v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update movie"})
 			return
 		}
-
-		c.JSON(http.StatusOK, input)
-	}
-}
-
-func handleDeleteMovie(es *elasticsearch.Client) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		id := c.Param("id")
-		res, err := es.Delete(movieIndex, id, es.Delete.WithContext(c.Request.Context()))
+		// Replacing the document dropped the review summary; restore it.
+		userRating, reviewCount, err := refreshReviewStats(c.Request.Context(), repo, id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete movie"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "movie updated but its review summary could not be restored"})
 			return
 		}
-		defer res.Body.Close()
+		input.UserRating, input.ReviewCount = userRating, reviewCount
 
-		if res.StatusCode == http.StatusNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
-			return
-		}
-		if res.IsError() {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete movie"})
-			return
-		}
-
-		c.Status(http.StatusNoContent)
+		c.JSON(http.StatusOK, input)
 	}
 }
 
-func indexMovie(es *elasticsearch.Client, id string, movie Movie) error {
-	movieJSON := map[string]interface{}{
-		"title":        movie.Title,
-		"description":  movie.Description,
-		"genre":        movie.Genre,
-		"rating":       movie.Rating,
-		"release_year": movie.ReleaseYear,
-	}
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(movieJSON); err != nil {
-		return fmt.Errorf("encode movie: %w", err)
-	}
-
-	res, err := es.Index(
-		movieIndex,
-		&buf,
-		es.Index.WithDocumentID(id),
-		es.Index.WithRefresh("true"),
-	)
-	if err != nil {
-		return fmt.Errorf("index movie: %w", err)
+func indexMovie(ctx context.Context, repo Repository, id string, movie Movie) error {
+	doc := map[string]interface{}{
+		"title":          movie.Title,
+		"description":    movie.Description,
+		"genres":         movie.Genres,
+		"rating":         movie.Rating,
+		"release_year":   movie.ReleaseYear,
+		"poster_url":     movie.PosterURL,
+		"directors":      movie.Directors,
+		"cast":           movie.Cast,
+		"crew":           movie.Crew,
+		"translations":   movie.Translations,
+		"collection":     movie.Collection,
+		"collection_key": collectionKey(id, movie.Collection),
+		"providers":      movie.Providers,
 	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		return fmt.Errorf("index response error: %s", res.String())
+	if vector := movieEmbedding(movie); vector != nil {
+		doc[embeddingField] = vector
 	}
-
-	return nil
+	return repo.Index(ctx, movieIndex, id, doc)
 }
 
 func mapToMovie(source map[string]interface{}) Movie {
@@ -396,8 +986,9 @@ func mapToMovie(source map[string]interface{}) Movie {
 	if description, ok := source["description"].(string); ok {
 		movie.Description = description
 	}
-	if genre, ok := source["genre"].(string); ok {
-		movie.Genre = genre
+	movie.Genres = mapToGenres(source)
+	if posterURL, ok := source["poster_url"].(string); ok {
+		movie.PosterURL = posterURL
 	}
 	if rating, ok := source["rating"].(float64); ok {
 		movie.Rating = rating
@@ -406,6 +997,20 @@ func mapToMovie(source map[string]interface{}) Movie {
 			movie.Rating = value
 		}
 	}
+	if userRating, ok := source["user_rating"].(float64); ok {
+		movie.UserRating = userRating
+	}
+	if reviewCount, ok := source["review_count"].(float64); ok {
+		movie.ReviewCount = int(reviewCount)
+	}
+	movie.Directors = mapToPeople(source["directors"])
+	movie.Cast = mapToPeople(source["cast"])
+	movie.Crew = mapToPeople(source["crew"])
+	movie.Translations = mapToTranslations(source["translations"])
+	if collection, ok := source["collection"].(string); ok {
+		movie.Collection = collection
+	}
+	movie.Providers = mapToProviders(source)
 	switch v := source["release_year"].(type) {
 	case float64:
 		movie.ReleaseYear = int(v)
@@ -417,6 +1022,18 @@ func mapToMovie(source map[string]interface{}) Movie {
 	return movie
 }
 
+func pageParams(c *gin.Context) (int, int) {
+	page := parseIntWithDefault(c.Query("page"), 1)
+	pageSize := parseIntWithDefault(c.Query("pageSize"), 5)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 50 {
+		pageSize = 5
+	}
+	return page, pageSize
+}
+
 func parseIntWithDefault(value string, def int) int {
 	if value == "" {
 		return def
@@ -432,7 +1049,8 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-API-Key, X-Client-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Cache")
 
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
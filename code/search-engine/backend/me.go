@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	savedSearchIndex = "saved_searches"
+	maxSavedSearches = 100
+)
+
+var savedSearchParams = map[string]bool{
+	"q": true, "person": true, "sort": true, "order": true, "fuzziness": true, "mode": true, "lang": true, "group_by": true,
+}
+
+type SavedSearch struct {
+	ID        string            `json:"id"`
+	User      string            `json:"-"`
+	Name      string            `json:"name" binding:"required,max=100"`
+	Params    map[string]string `json:"params" binding:"required"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type savedSearchDoc struct {
+	User      string            `json:"user"`
+	Name      string            `json:"name"`
+	Params    map[string]string `json:"params"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+func validateSavedSearchParams(params map[string]string) error {
+	for key := range params {
+		if !savedSearchParams[key] {
+			return fmt.Errorf("params may only contain q, person, sort, order, fuzziness, mode, and lang")
+		}
+	}
+	if _, err := parseSort(params["sort"], params["order"], params["q"] != ""); err != nil {
+		return err
+	}
+	if value, ok := params["fuzziness"]; ok {
+		if _, ok := parseFuzziness(value); !ok {
+			return fmt.Errorf("fuzziness must be AUTO, 0, 1, or 2")
+		}
+	}
+	switch params["mode"] {
+	case "", "keyword":
+	case "semantic", "hybrid":
+		if params["q"] == "" {
+			return fmt.Errorf("q is required for semantic and hybrid search")
+		}
+	default:
+		return fmt.Errorf("mode must be keyword, semantic, or hybrid")
+	}
+	return nil
+}
+
+func handleCreateSavedSearch(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input SavedSearch
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateSavedSearchParams(input.Params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing, err := listSavedSearches(c, es)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list saved searches"})
+			return
+		}
+		if len(existing) >= maxSavedSearches {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("at most %d saved searches per user", maxSavedSearches)})
+			return
+		}
+
+		input.ID = uuid.NewString()
+		input.User = currentUser(c)
+		input.CreatedAt = time.Now().UTC()
+		body, err := encodeBody(savedSearchDoc{User: input.User, Name: input.Name, Params: input.Params, CreatedAt: input.CreatedAt})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode saved search"})
+			return
+		}
+		res, err := es.Index(savedSearchIndex, body,
+			es.Index.WithDocumentID(input.ID),
+			es.Index.WithRefresh("true"),
+			es.Index.WithContext(c.Request.Context()))
+		if err := esCall(res, err, "index saved search"); err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save search"})
+			return
+		}
+		c.JSON(http.StatusCreated, input)
+	}
+}
+
+func handleListSavedSearches(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		searches, err := listSavedSearches(c, es)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list saved searches"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"searches": searches})
+	}
+}
+
+func listSavedSearches(c *gin.Context, es *elasticsearch.Client) ([]SavedSearch, error) {
+	body, err := encodeBody(map[string]interface{}{
+		"size":  maxSavedSearches,
+		"query": map[string]interface{}{"term": map[string]interface{}{"user": currentUser(c)}},
+		"sort":  []map[string]interface{}{{"created_at": map[string]interface{}{"order": "desc"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(savedSearchIndex), es.Search.WithBody(body))
+	if err != nil {
+		return nil, fmt.Errorf("search saved searches: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("search saved searches response error: %s", res.String())
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID     string         `json:"_id"`
+				Source savedSearchDoc `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode saved searches: %w", err)
+	}
+	searches := make([]SavedSearch, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		searches = append(searches, SavedSearch{ID: hit.ID, Name: hit.Source.Name, Params: hit.Source.Params, CreatedAt: hit.Source.CreatedAt})
+	}
+	return searches, nil
+}
+
+func ownSavedSearch(c *gin.Context, es *elasticsearch.Client) (savedSearchDoc, bool) {
+	var doc struct {
+		Source savedSearchDoc `json:"_source"`
+	}
+	res, err := es.Get(savedSearchIndex, c.Param("searchId"), es.Get.WithContext(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch saved search"})
+		return doc.Source, false
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved search not found"})
+		return doc.Source, false
+	}
+	if res.IsError() {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch saved search"})
+		return doc.Source, false
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode saved search"})
+		return doc.Source, false
+	}
+	if doc.Source.User != currentUser(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved search not found"})
+		return doc.Source, false
+	}
+	return doc.Source, true
+}
+
+func handleRunSavedSearch(es *elasticsearch.Client) gin.HandlerFunc {
+	search := handleSearchMovies(esRepository{es})
+	return func(c *gin.Context) {
+		saved, ok := ownSavedSearch(c, es)
+		if !ok {
+			return
+		}
+		query := url.Values{}
+		for key, value := range saved.Params {
+			query.Set(key, value)
+		}
+		incoming := c.Request.URL.Query()
+		for _, key := range []string{"page", "pageSize", "paginate", "cursor"} {
+			if value := incoming.Get(key); value != "" {
+				query.Set(key, value)
+			}
+		}
+		// Nothing has read the query yet, so gin's query cache is still
+		// empty and the search handler sees the saved params.
+		c.Request.URL.RawQuery = query.Encode()
+		search(c)
+	}
+}
+
+func handleDeleteSavedSearch(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := ownSavedSearch(c, es); !ok {
+			return
+		}
+		res, err := es.Delete(savedSearchIndex, c.Param("searchId"),
+			es.Delete.WithRefresh("true"),
+			es.Delete.WithContext(c.Request.Context()))
+		if err := esCall(res, err, "delete saved search"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete saved search"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func handleGetWatchlist(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := getUser(c.Request.Context(), es, currentUser(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch watchlist"})
+			return
+		}
+		movies := make([]Movie, 0, len(user.Watchlist))
+		if len(user.Watchlist) == 0 {
+			c.JSON(http.StatusOK, gin.H{"movies": movies})
+			return
+		}
+
+		ids := make([]string, len(user.Watchlist))
+		for i, id := range user.Watchlist {
+			ids[len(ids)-1-i] = id
+		}
+		found, err := getMovies(c, es, ids)
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch watchlist movies"})
+			return
+		}
+		for _, id := range ids {
+			if movie, ok := found[id]; ok {
+				movies = append(movies, movie)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"movies": movies})
+	}
+}
+
+func handleAddToWatchlist(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			MovieID string `json:"movie_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		exists, err := movieExists(c.Request.Context(), es, input.MovieID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+
+		err = updateWatchlist(c, es, `
+			if (ctx._source.watchlist == null) { ctx._source.watchlist = []; }
+			if (ctx._source.watchlist.contains(params.id)) { ctx.op = 'noop'; } else { ctx._source.watchlist.add(params.id); }`,
+			input.MovieID)
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update watchlist"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"movie_id": input.MovieID})
+	}
+}
+
+func handleRemoveFromWatchlist(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := updateWatchlist(c, es, `
+			if (ctx._source.watchlist == null || !ctx._source.watchlist.removeIf(id -> id == params.id)) { ctx.op = 'noop'; }`,
+			c.Param("movieId"))
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update watchlist"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func updateWatchlist(c *gin.Context, es *elasticsearch.Client, script, movieID string) error {
+	body, err := encodeBody(map[string]interface{}{
+		"script": map[string]interface{}{
+			"source": script,
+			"params": map[string]interface{}{"id": movieID},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.Update(userIndex, currentUser(c), body,
+		es.Update.WithRefresh("true"),
+		es.Update.WithRetryOnConflict(3),
+		es.Update.WithContext(c.Request.Context()))
+	return esCall(res, err, "update watchlist")
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/gin-gonic/gin"
+)
+
+var memorySortFields = map[string]string{
+	"_score":        "_score",
+	"rating":        "rating",
+	"release_year":  "release_year",
+	"title.keyword": "title_sort",
+	"user_rating":   "user_rating",
+}
+
+type memoryMovies struct {
+	index bleve.Index
+
+	mu     sync.RWMutex
+	movies map[string]Movie
+}
+
+type memoryDoc struct {
+	Title       string   `json:"title"`
+	TitleWords  string   `json:"title_words"`
+	TitleSort   string   `json:"title_sort"`
+	Description string   `json:"description"`
+	Genres      []string `json:"genres"`
+	People      []string `json:"people"`
+	Providers   []string `json:"providers"`
+	Rating      float64  `json:"rating"`
+	ReleaseYear float64  `json:"release_year"`
+	UserRating  float64  `json:"user_rating"`
+}
+
+func newMemoryMovies() (*memoryMovies, error) {
+	// As in Elasticsearch, suggestions read unstemmed title words.
+	stemmed := bleve.NewTextFieldMapping()
+	stemmed.Analyzer = en.AnalyzerName
+	words := bleve.NewTextFieldMapping()
+	words.Analyzer = standard.Name
+	exact := bleve.NewTextFieldMapping()
+	exact.Analyzer = keyword.Name
+	number := bleve.NewNumericFieldMapping()
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("title", stemmed)
+	doc.AddFieldMappingsAt("title_words", words)
+	doc.AddFieldMappingsAt("title_sort", exact)
+	doc.AddFieldMappingsAt("description", stemmed)
+	doc.AddFieldMappingsAt("genres", words)
+	doc.AddFieldMappingsAt("people", words)
+	doc.AddFieldMappingsAt("providers", exact)
+	for _, field := range []string{"rating", "release_year", "user_rating"} {
+		doc.AddFieldMappingsAt(field, number)
+	}
+	mapping := bleve.NewIndexMapping()
+	mapping.DefaultMapping = doc
+
+	index, err := bleve.NewMemOnly(mapping)
+	if err != nil {
+		return nil, fmt.Errorf("create memory index: %w", err)
+	}
+	return &memoryMovies{index: index, movies: map[string]Movie{}}, nil
+}
+
+func (m *memoryMovies) GetMovie(ctx context.Context, id string) (Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	movie, ok := m.movies[id]
+	if !ok {
+		return Movie{}, errMovieNotFound
+	}
+	return movie, nil
+}
+
+func (m *memoryMovies) PutMovie(ctx context.Context, movie Movie) error {
+	people := make([]string, 0, len(movie.Directors)+len(movie.Cast)+len(movie.Crew))
+	for _, list := range [][]Person{movie.Directors, movie.Cast, movie.Crew} {
+		for _, person := range list {
+			people = append(people, person.Name)
+		}
+	}
+	// Lowercased, as the Elasticsearch filter ignores case.
+	providers := make([]string, 0, len(movie.Providers))
+	for _, provider := range movie.Providers {
+		providers = append(providers, strings.ToLower(provider))
+	}
+	doc := memoryDoc{
+		Title:       movie.Title,
+		TitleWords:  movie.Title,
+		TitleSort:   strings.ToLower(movie.Title),
+		Description: movie.Description,
+		Genres:      movie.Genres,
+		People:      people,
+		Providers:   providers,
+		Rating:      movie.Rating,
+		ReleaseYear: float64(movie.ReleaseYear),
+		UserRating:  movie.UserRating,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.index.Index(movie.ID, doc); err != nil {
+		return fmt.Errorf("index movie: %w", err)
+	}
+	m.movies[movie.ID] = movie
+	return nil
+}
+
+func (m *memoryMovies) DeleteMovie(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.movies[id]; !ok {
+		return errMovieNotFound
+	}
+	if err := m.index.Delete(id); err != nil {
+		return fmt.Errorf("delete movie: %w", err)
+	}
+	delete(m.movies, id)
+	return nil
+}
+
+func (m *memoryMovies) SearchMovies(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	fuzziness := 1
+	if q.Fuzziness != "AUTO" {
+		fmt.Sscan(q.Fuzziness, &fuzziness)
+	}
+
+	var clauses []query.Query
+	if q.Text != "" {
+		profile := currentBoosts()
+		fields := []struct {
+			name  string
+			boost float64
+		}{
+			{"title", profile.Fields["title"]},
+			{"description", profile.Fields["description"]},
+			{"genres", profile.Fields["genres"]},
+			{"people", profile.Fields["cast"]},
+		}
+		should := make([]query.Query, 0, len(fields))
+		for _, field := range fields {
+			if field.boost == 0 {
+				continue
+			}
+			match := bleve.NewMatchQuery(q.Text)
+			match.SetField(field.name)
+			match.SetBoost(field.boost)
+			match.SetFuzziness(fuzziness)
+			match.SetPrefix(1)
+			should = append(should, match)
+		}
+		clauses = append(clauses, bleve.NewDisjunctionQuery(should...))
+	}
+	if q.Person != "" {
+		person := bleve.NewMatchQuery(q.Person)
+		person.SetField("people")
+		person.SetOperator(query.MatchQueryOperatorAnd)
+		clauses = append(clauses, person)
+	}
+	if len(q.Genres) > 0 {
+		genres := make([]query.Query, 0, len(q.Genres))
+		for _, genre := range q.Genres {
+			for _, variant := range genreVariants(genre) {
+				match := bleve.NewMatchPhraseQuery(variant)
+				match.SetField("genres")
+				genres = append(genres, match)
+			}
+		}
+		clauses = append(clauses, bleve.NewDisjunctionQuery(genres...))
+	}
+	if len(q.Providers) > 0 {
+		providers := make([]query.Query, 0, len(q.Providers))
+		for _, provider := range q.Providers {
+			term := bleve.NewTermQuery(strings.ToLower(provider))
+			term.SetField("providers")
+			providers = append(providers, term)
+		}
+		clauses = append(clauses, bleve.NewDisjunctionQuery(providers...))
+	}
+	var search query.Query = bleve.NewMatchAllQuery()
+	if len(clauses) > 0 {
+		search = bleve.NewConjunctionQuery(clauses...)
+	}
+
+	request := bleve.NewSearchRequestOptions(search, q.Size, q.From, false)
+	sort := []string{memorySortKey(q.SortField, q.Order)}
+	for _, tiebreak := range sortTiebreaks {
+		if tiebreak.field != q.SortField {
+			sort = append(sort, memorySortKey(tiebreak.field, tiebreak.order))
+		}
+	}
+	request.SortBy(append(sort, "_id"))
+
+	result, err := m.index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search movies: %w", err)
+	}
+	return m.hitsToMovies(result), int(result.Total), nil
+}
+
+func memorySortKey(field, order string) string {
+	if order == "desc" {
+		return "-" + memorySortFields[field]
+	}
+	return memorySortFields[field]
+}
+
+func (m *memoryMovies) SuggestTitles(ctx context.Context, prefix string, size int) ([]Suggestion, error) {
+	words := strings.Fields(strings.ToLower(prefix))
+	clauses := make([]query.Query, 0, len(words))
+	for _, word := range words[:len(words)-1] {
+		match := bleve.NewMatchQuery(word)
+		match.SetField("title_words")
+		clauses = append(clauses, match)
+	}
+	last := bleve.NewPrefixQuery(words[len(words)-1])
+	last.SetField("title_words")
+	clauses = append(clauses, last)
+
+	request := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(clauses...), size, 0, false)
+	request.SortBy([]string{"-_score", "title_sort"})
+	result, err := m.index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("suggest titles: %w", err)
+	}
+	movies := m.hitsToMovies(result)
+	suggestions := make([]Suggestion, 0, len(movies))
+	for _, movie := range movies {
+		suggestions = append(suggestions, Suggestion{ID: movie.ID, Title: movie.Title})
+	}
+	return suggestions, nil
+}
+
+func (m *memoryMovies) hitsToMovies(result *bleve.SearchResult) []Movie {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	movies := make([]Movie, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		// A movie deleted between the search and this lookup is skipped.
+		if movie, ok := m.movies[hit.ID]; ok {
+			movies = append(movies, movie)
+		}
+	}
+	return movies
+}
+
+func setupMemory(router *gin.Engine) {
+	movies, err := newMemoryMovies()
+	if err != nil {
+		log.Fatalf("failed to set up memory search: %v", err)
+	}
+	seeds, err := seedData()
+	if err != nil {
+		log.Fatalf("failed to load seed data: %v", err)
+	}
+	for _, movie := range seeds {
+		if err := movies.PutMovie(context.Background(), movie); err != nil {
+			log.Fatalf("failed to seed movie %s: %v", movie.Title, err)
+		}
+	}
+	log.Printf("SEARCH_BACKEND=memory: movies are kept in memory and lost on restart")
+
+	router.GET("/readyz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ready", "backend": "memory"})
+	})
+	limits, err := newRequestLimits()
+	if err != nil {
+		log.Fatalf("failed to set up request limits: %v", err)
+	}
+	router.GET("/ws/search", limits.limitSearch(), handleLiveSearch(movies.SuggestTitles))
+	api := router.Group("/api")
+	{
+		api.GET("/movies", limits.limitSearch(), handleStoreSearchMovies(movies))
+		api.GET("/movies/suggest", handleStoreSuggestMovies(movies))
+		api.GET("/movies/:id", handleStoreGetMovie(movies))
+		api.POST("/movies", requireRole(roleEditor), limits.limitBody(), handleStoreCreateMovie(movies))
+		api.PUT("/movies/:id", requireRole(roleEditor), limits.limitBody(), handleStoreUpdateMovie(movies))
+		api.DELETE("/movies/:id", requireRole(roleEditor), handleStoreDeleteMovie(movies))
+	}
+}
+
+// memoryUnsupported answers the /api routes only the Elasticsearch backend has.
+func memoryUnsupported(c *gin.Context) {
+	c.JSON(http.StatusNotImplemented, gin.H{"error": "this endpoint needs SEARCH_BACKEND=elasticsearch"})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_engine_http_request_duration_seconds",
+		Help:    "Time to answer an API request, by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	esDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_engine_elasticsearch_request_duration_seconds",
+		Help:    "Elasticsearch round-trip time per attempt, by API.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+	errorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_engine_errors_total",
+		Help: "Errors by type: elasticsearch_unreachable, elasticsearch_4xx, elasticsearch_5xx, circuit_open, rate_limited, and http_5xx.",
+	}, []string{"type"})
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_engine_cache_lookups_total",
+		Help: "Response cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+)
+
+// slowSearchThreshold is the Elasticsearch search time past which the query is logged. 0 turns it off.
+var slowSearchThreshold = time.Second
+
+func loadMetrics() error {
+	if value := getenv("SLOW_SEARCH_THRESHOLD", ""); value != "" {
+		threshold, err := time.ParseDuration(value)
+		if err != nil || threshold < 0 {
+			return fmt.Errorf("invalid SLOW_SEARCH_THRESHOLD %q: must be a duration such as 500ms", value)
+		}
+		slowSearchThreshold = threshold
+	}
+	return nil
+}
+
+func handleMetrics() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// requestMetrics times every request. Unmatched paths share one label so scans cannot grow the series.
+func requestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		requestDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		if status >= http.StatusInternalServerError {
+			errorsTotal.WithLabelValues("http_5xx").Inc()
+		}
+	}
+}
+
+func recordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// metricsTransport sits below the retries in esTransport, so each attempt is timed on its own.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := esOperation(req.URL.Path)
+	var body []byte
+	if slowSearchThreshold > 0 && (operation == "_search" || operation == "_msearch") && req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+	res, err := traceElasticsearch(req, t.next.RoundTrip)
+	elapsed := time.Since(start)
+	status := "error"
+	switch {
+	case err != nil:
+		if req.Context().Err() == nil {
+			errorsTotal.WithLabelValues("elasticsearch_unreachable").Inc()
+		}
+	case res.StatusCode >= http.StatusInternalServerError:
+		errorsTotal.WithLabelValues("elasticsearch_5xx").Inc()
+	case res.StatusCode >= http.StatusBadRequest && res.StatusCode != http.StatusNotFound:
+		// A 404 is how Elasticsearch answers lookups of missing documents and indexes.
+		errorsTotal.WithLabelValues("elasticsearch_4xx").Inc()
+	}
+	if res != nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	esDuration.WithLabelValues(operation, status).Observe(elapsed.Seconds())
+	if body != nil && elapsed >= slowSearchThreshold {
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			if reader, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+				body, _ = io.ReadAll(reader)
+			}
+		}
+		slog.Warn("slow search",
+			"request_id", requestID(req.Context()),
+			"method", req.Method,
+			"path", req.URL.Path,
+			"duration_ms", elapsed.Milliseconds(),
+			"body", string(bytes.TrimSpace(body)))
+	}
+	return res, err
+}
+
+// esOperation names the API a request calls by its first underscore segment,
+// such as _search or _doc. Index management calls have none.
+func esOperation(path string) string {
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "_") {
+			return segment
+		}
+	}
+	return "index"
+}
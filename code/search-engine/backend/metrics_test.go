@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestESOperation(t *testing.T) {
+	tests := map[string]string{
+		"/movies/_search":           "_search",
+		"/_msearch":                 "_msearch",
+		"/movies/_doc/m1":           "_doc",
+		"/movies/_update/m1":        "_update",
+		"/_pit":                     "_pit",
+		"/people":                   "index",
+		"/movies-v2/_settings":      "_settings",
+		"/reviews/_delete_by_query": "_delete_by_query",
+	}
+	for path, want := range tests {
+		if got := esOperation(path); got != want {
+			t.Fatalf("expected %s for %s, got %s", want, path, got)
+		}
+	}
+}
+
+func TestMetricsTransportLogsSlowSearches(t *testing.T) {
+	defer func(threshold time.Duration) { slowSearchThreshold = threshold }(slowSearchThreshold)
+	slowSearchThreshold = 20 * time.Millisecond
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	transport := metricsTransport{next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		if !strings.Contains(string(body), "inception") {
+			t.Fatalf("expected the body passed on, got %q", body)
+		}
+		if strings.HasSuffix(req.URL.Path, "_search") {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})}
+
+	for _, path := range []string{"/movies/_search", "/movies/_doc/m1"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"query":{"match":{"title":"inception"}}}`))
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatalf("round trip: %v", err)
+		}
+	}
+	if !strings.Contains(logs.String(), "slow search") || !strings.Contains(logs.String(), "path=/movies/_search") || !strings.Contains(logs.String(), "inception") {
+		t.Fatalf("expected the slow search logged with its body, got %q", logs.String())
+	}
+	if strings.Contains(logs.String(), "_doc") {
+		t.Fatalf("expected only searches logged, got %q", logs.String())
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestMetrics())
+	router.GET("/metrics", handleMetrics())
+	router.GET("/api/movies/:id", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	recordCacheLookup("search", true)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/movies/m1", nil))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`search_engine_http_request_duration_seconds_count{method="GET",route="/api/movies/:id",status="500"}`,
+		`search_engine_errors_total{type="http_5xx"}`,
+		`search_engine_cache_lookups_total{cache="search",result="hit"}`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected %s in the metrics", want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	paths, _ := spec["paths"].(map[string]interface{})
+	for _, path := range []string{"/api/movies", "/api/movies/{id}", "/api/genres", "/api/search"} {
+		if _, ok := paths[path]; !ok {
+			t.Fatalf("expected %s documented", path)
+		}
+	}
+
+	// Every $ref must point at something under components.
+	var check func(value interface{})
+	check = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				var target interface{} = spec
+				for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					node, _ := target.(map[string]interface{})
+					target = node[part]
+				}
+				if target == nil {
+					t.Fatalf("expected %s to resolve", ref)
+				}
+			}
+			for _, child := range v {
+				check(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				check(child)
+			}
+		}
+	}
+	check(spec)
+}
+
+func TestRegisterAPIDocs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerAPIDocs(router)
+
+	tests := []struct {
+		target   string
+		wantType string
+	}{
+		{target: "/api/openapi.json", wantType: "application/json"},
+		{target: "/api/docs", wantType: "text/html; charset=utf-8"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tc.wantType {
+				t.Fatalf("expected content type %q, got %q", tc.wantType, got)
+			}
+		})
+	}
+}
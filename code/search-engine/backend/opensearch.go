@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// OpenSearch forked from Elasticsearch 7.10 and still answers the APIs this
+// backend uses, with three exceptions: the v8 client's product check, the point
+// in time endpoints, and the point in time tiebreaker. SEARCH_ENGINE picks the
+// flavour; everything else talks to either cluster the same way.
+const (
+	engineElasticsearch = "elasticsearch"
+	engineOpenSearch    = "opensearch"
+)
+
+var searchEngine = engineElasticsearch
+
+func loadSearchEngine() error {
+	switch engine := strings.ToLower(strings.TrimSpace(getenv("SEARCH_ENGINE", engineElasticsearch))); engine {
+	case engineElasticsearch, engineOpenSearch:
+		searchEngine = engine
+		return nil
+	default:
+		return fmt.Errorf("invalid SEARCH_ENGINE %q: must be elasticsearch or opensearch", engine)
+	}
+}
+
+// The v8 client refuses any cluster whose first successful response lacks
+// X-Elastic-Product, which OpenSearch never sends.
+type productHeaderTransport struct {
+	next http.RoundTripper
+}
+
+func (t productHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err == nil && res.Header.Get("X-Elastic-Product") == "" {
+		res.Header.Set("X-Elastic-Product", "Elasticsearch")
+	}
+	return res, err
+}
+
+// pitTiebreaker makes sort values unique within a point in time. OpenSearch has
+// no _shard_doc, but the movie index has a single shard, so _doc is unique too.
+func pitTiebreaker() map[string]interface{} {
+	if searchEngine == engineOpenSearch {
+		return map[string]interface{}{"_doc": "asc"}
+	}
+	return map[string]interface{}{"_shard_doc": "asc"}
+}
+
+// OpenSearch 2.4 added points in time under _search/point_in_time, answering
+// pit_id where Elasticsearch answers id. The client has no API for them.
+func openOpenSearchPointInTime(ctx context.Context, es *elasticsearch.Client, index string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"/"+url.PathEscape(index)+"/_search/point_in_time?keep_alive="+pitKeepAlive, nil)
+	if err != nil {
+		return "", fmt.Errorf("open point in time: %w", err)
+	}
+	var pit struct {
+		ID string `json:"pit_id"`
+	}
+	if err := performOpenSearch(es, req, "open point in time", &pit); err != nil {
+		return "", err
+	}
+	return pit.ID, nil
+}
+
+func closeOpenSearchPointInTime(es *elasticsearch.Client, id string) {
+	body, err := encodeBody(map[string]interface{}{"pit_id": []string{id}})
+	if err != nil {
+		log.Printf("close point in time: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/_search/point_in_time", body)
+	if err != nil {
+		log.Printf("close point in time: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := performOpenSearch(es, req, "close point in time", nil); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// performOpenSearch sends a request the client has no API for and decodes the
+// response into out, when given.
+func performOpenSearch(es *elasticsearch.Client, req *http.Request, action string, out interface{}) error {
+	res, err := es.Perform(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("%s response error: [%d] %s", action, res.StatusCode, message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestLoadSearchEngine(t *testing.T) {
+	defer func() { searchEngine = engineElasticsearch }()
+
+	t.Setenv("SEARCH_ENGINE", "OpenSearch")
+	if err := loadSearchEngine(); err != nil || searchEngine != engineOpenSearch {
+		t.Fatalf("expected opensearch, got %q (%v)", searchEngine, err)
+	}
+	t.Setenv("SEARCH_ENGINE", "solr")
+	if err := loadSearchEngine(); err == nil {
+		t.Fatalf("expected an unknown engine to be rejected")
+	}
+}
+
+func TestOpenSearchPointInTime(t *testing.T) {
+	searchEngine = engineOpenSearch
+	defer func() { searchEngine = engineElasticsearch }()
+
+	var requests []string
+	var closed map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodDelete {
+			json.NewDecoder(r.Body).Decode(&closed)
+			w.Write([]byte(`{"pits":[{"successful":true}]}`))
+			return
+		}
+		w.Write([]byte(`{"pit_id":"o1"}`))
+	}))
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{server.URL},
+		Transport: productHeaderTransport{next: http.DefaultTransport},
+	})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	id, err := openPointInTime(context.Background(), es, movieIndex)
+	if err != nil || id != "o1" {
+		t.Fatalf("expected point in time o1, got %q (%v)", id, err)
+	}
+	closePointInTime(es, id)
+
+	want := []string{
+		"POST /" + movieIndex + "/_search/point_in_time?keep_alive=" + pitKeepAlive,
+		"DELETE /_search/point_in_time?",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Fatalf("expected %v, got %v", want, requests)
+	}
+	if !reflect.DeepEqual(closed, map[string][]string{"pit_id": {"o1"}}) {
+		t.Fatalf("expected the point in time closed by pit_id, got %v", closed)
+	}
+	if got := pitTiebreaker(); !reflect.DeepEqual(got, map[string]interface{}{"_doc": "asc"}) {
+		t.Fatalf("expected a _doc tiebreaker, got %v", got)
+	}
+}
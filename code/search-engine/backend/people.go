@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+type Person struct {
+	Name string `json:"name" binding:"required,max=200"`
+	Role string `json:"role"`
+}
+
+var peopleFields = []struct {
+	path string
+}{
+	{"directors"},
+	{"cast"},
+	{"crew"},
+}
+
+// personMapping is nested, so a name and a role only match together when
+// they belong to the same person.
+func personMapping() map[string]interface{} {
+	keyword := map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256}}
+	return map[string]interface{}{
+		"type": "nested",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "text", "fields": keyword},
+			"role": map[string]interface{}{"type": "text", "fields": keyword},
+		},
+	}
+}
+
+func peopleMappings() map[string]interface{} {
+	mappings := map[string]interface{}{}
+	for _, field := range peopleFields {
+		mappings[field.path] = personMapping()
+	}
+	return mappings
+}
+
+// ensureAddedFields maps credits up front; otherwise the first movie written
+// with credits would map them as plain objects.
+func ensureAddedFields(es *elasticsearch.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	properties := peopleMappings()
+	properties["poster_url"] = posterURLMapping
+	properties["genres"] = genresMapping
+	properties["translations"] = translationsMapping()
+	properties["providers"] = providersMapping
+	for field, mapping := range reviewStatsMappings {
+		properties[field] = mapping
+	}
+	for field, mapping := range softDeleteMappings {
+		properties[field] = mapping
+	}
+	for field, mapping := range collectionMappings {
+		properties[field] = mapping
+	}
+	if embedder != nil {
+		properties[embeddingField] = embeddingMapping()
+	}
+	body, err := encodeBody(map[string]interface{}{
+		"_meta":      map[string]interface{}{"mapping_version": movieMappingVersion},
+		"properties": properties,
+	})
+	if err == nil {
+		res, putErr := es.Indices.PutMapping([]string{movieIndex}, body, es.Indices.PutMapping.WithContext(ctx))
+		err = esCall(res, putErr, "put added fields mapping")
+	}
+	if err != nil {
+		// An index that already mapped credits as objects needs a reindex.
+		log.Printf("could not map credit and review fields, run POST /api/admin/reindex: %v", err)
+	}
+}
+
+func peopleQueries(query, fuzziness string, profile boostProfile) []map[string]interface{} {
+	queries := make([]map[string]interface{}, 0, len(peopleFields))
+	for _, field := range peopleFields {
+		boost := profile.Fields[field.path]
+		if boost == 0 {
+			continue
+		}
+		multiMatch := map[string]interface{}{
+			"query":  query,
+			"fields": []string{field.path + ".name^2", field.path + ".role"},
+		}
+		if fuzziness != "0" {
+			multiMatch["fuzziness"] = fuzziness
+			multiMatch["prefix_length"] = 1
+		}
+		queries = append(queries, map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path":       field.path,
+				"query":      map[string]interface{}{"multi_match": multiMatch},
+				"score_mode": "max",
+				"boost":      boost,
+			},
+		})
+	}
+	return queries
+}
+
+func personFilter(name string) map[string]interface{} {
+	should := make([]map[string]interface{}, 0, len(peopleFields))
+	for _, field := range peopleFields {
+		should = append(should, map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path": field.path,
+				"query": map[string]interface{}{
+					"match": map[string]interface{}{
+						field.path + ".name": map[string]interface{}{"query": name, "operator": "and"},
+					},
+				},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+	}
+}
+
+func mapToPeople(value interface{}) []Person {
+	items, ok := value.([]interface{})
+	if !ok {
+		return []Person{}
+	}
+	people := make([]Person, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		person := Person{}
+		person.Name, _ = fields["name"].(string)
+		person.Role, _ = fields["role"].(string)
+		if person.Name != "" {
+			people = append(people, person)
+		}
+	}
+	return people
+}
+
+func (m *Movie) normalizeCredits() {
+	for _, people := range []*[]Person{&m.Directors, &m.Cast, &m.Crew} {
+		if *people == nil {
+			*people = []Person{}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Registered for image.Decode.
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const maxPosterBytes = 10 << 20
+
+var posterWidths = map[string]int{
+	"small":  185,
+	"medium": 500,
+}
+
+var errPosterNotFound = errors.New("poster not found")
+
+// posterProxy fetches only allowedHosts, since poster_url is user input.
+type posterProxy struct {
+	dir          string
+	allowedHosts map[string]bool
+	client       *http.Client
+}
+
+func newPosterProxy() (*posterProxy, error) {
+	dir := getenv("POSTER_CACHE_DIR", filepath.Join(os.TempDir(), "search-engine-posters"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create poster cache: %w", err)
+	}
+	hosts := map[string]bool{}
+	for _, host := range strings.Split(getenv("POSTER_ALLOWED_HOSTS", "image.tmdb.org"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+	return &posterProxy{
+		dir:          dir,
+		allowedHosts: hosts,
+		client:       &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+func (p *posterProxy) posterAllowed(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return false
+	}
+	return p.allowedHosts[strings.ToLower(parsed.Hostname())]
+}
+
+// cachePath is keyed by the poster URL, so changing a movie's poster never
+// serves the old image.
+func (p *posterProxy) cachePath(posterURL, size string) string {
+	sum := sha256.Sum256([]byte(posterURL))
+	return filepath.Join(p.dir, hex.EncodeToString(sum[:16])+"-"+size+".jpg")
+}
+
+// fetch writes under a temporary name and renames, so concurrent requests
+// never see half a file.
+func (p *posterProxy) fetch(ctx context.Context, posterURL, path string, width int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, posterURL, nil)
+	if err != nil {
+		return fmt.Errorf("build poster request: %w", err)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download poster: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return errPosterNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("download poster: upstream returned %d", res.StatusCode)
+	}
+
+	source, _, err := image.Decode(io.LimitReader(res.Body, maxPosterBytes))
+	if err != nil {
+		return fmt.Errorf("decode poster: %w", err)
+	}
+	resized := source
+	if bounds := source.Bounds(); bounds.Dx() > width {
+		height := bounds.Dy() * width / bounds.Dx()
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), source, bounds, draw.Over, nil)
+		resized = scaled
+	}
+
+	file, err := os.CreateTemp(p.dir, "poster-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create poster file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if err := jpeg.Encode(file, resized, &jpeg.Options{Quality: 85}); err != nil {
+		file.Close()
+		return fmt.Errorf("encode poster: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write poster: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("store poster: %w", err)
+	}
+	return nil
+}
+
+func moviePosterURL(ctx context.Context, es *elasticsearch.Client, id string) (string, error) {
+	res, err := es.Get(movieIndex, id, es.Get.WithSourceIncludes("poster_url"), es.Get.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get movie: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return "", errPosterNotFound
+	}
+	if res.IsError() {
+		return "", fmt.Errorf("get movie response error: %s", res.String())
+	}
+	var doc struct {
+		Source struct {
+			PosterURL string `json:"poster_url"`
+		} `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return "", fmt.Errorf("decode movie: %w", err)
+	}
+	if doc.Source.PosterURL == "" {
+		return "", errPosterNotFound
+	}
+	return doc.Source.PosterURL, nil
+}
+
+func handlePoster(es *elasticsearch.Client, posters *posterProxy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		size := c.DefaultQuery("size", "medium")
+		width, ok := posterWidths[size]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be small or medium"})
+			return
+		}
+
+		posterURL, err := moviePosterURL(c.Request.Context(), es, c.Param("id"))
+		if errors.Is(err, errPosterNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "poster not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("poster %s: %v", c.Param("id"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load movie"})
+			return
+		}
+		if !posters.posterAllowed(posterURL) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "poster host is not allowed"})
+			return
+		}
+
+		path := posters.cachePath(posterURL, size)
+		if _, err := os.Stat(path); err != nil {
+			err := posters.fetch(c.Request.Context(), posterURL, path, width)
+			if errors.Is(err, errPosterNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "poster not found"})
+				return
+			}
+			if err != nil {
+				log.Printf("poster %s: %v", c.Param("id"), err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch poster"})
+				return
+			}
+		}
+
+		// Cached files never change: a new poster_url gets a new file.
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.File(path)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProviderFacets caps the providers facet; there are only so many streaming services.
+const maxProviderFacets = 20
+
+// Providers are the services a movie streams on, such as Netflix or Prime Video.
+var providersMapping = map[string]interface{}{"type": "keyword", "ignore_above": 100}
+
+// Common spellings of the big services, so Prime and Amazon Prime Video land in one facet bucket.
+var providerAliases = map[string]string{
+	"netflix":            "Netflix",
+	"prime":              "Prime Video",
+	"prime video":        "Prime Video",
+	"amazon prime":       "Prime Video",
+	"amazon prime video": "Prime Video",
+	"disney+":            "Disney+",
+	"disney plus":        "Disney+",
+	"hulu":               "Hulu",
+	"max":                "Max",
+	"hbo max":            "Max",
+	"apple tv+":          "Apple TV+",
+	"apple tv plus":      "Apple TV+",
+	"paramount+":         "Paramount+",
+	"paramount plus":     "Paramount+",
+	"peacock":            "Peacock",
+}
+
+func canonicalProvider(provider string) string {
+	provider = strings.Join(strings.Fields(provider), " ")
+	if canonical, ok := providerAliases[strings.ToLower(provider)]; ok {
+		return canonical
+	}
+	return provider
+}
+
+// normalizeProviders trims, deduplicates, and respells a movie's providers.
+func normalizeProviders(providers []string) []string {
+	normalized := make([]string, 0, len(providers))
+	seen := map[string]bool{}
+	for _, provider := range providers {
+		provider = canonicalProvider(provider)
+		key := strings.ToLower(provider)
+		if provider == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, provider)
+	}
+	return normalized
+}
+
+// queryProviders reads provider, which repeats or takes a comma-separated list.
+func queryProviders(c *gin.Context) []string {
+	providers := queryList(c, "provider")
+	for i, provider := range providers {
+		providers[i] = canonicalProvider(provider)
+	}
+	return providers
+}
+
+// providerFilter matches movies on any of the providers.
+func providerFilter(providers []string) map[string]interface{} {
+	should := make([]map[string]interface{}, 0, len(providers))
+	for _, provider := range providers {
+		should = append(should, map[string]interface{}{
+			"term": map[string]interface{}{"providers": map[string]interface{}{"value": provider, "case_insensitive": true}},
+		})
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}}
+}
+
+func mapToProviders(source map[string]interface{}) []string {
+	values, _ := source["providers"].([]interface{})
+	var providers []string
+	for _, value := range values {
+		if provider, ok := value.(string); ok {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// providersFacet counts the matches on each service, for narrowing a search.
+func providersFacet() map[string]interface{} {
+	return map[string]interface{}{"terms": map[string]interface{}{"field": "providers", "size": maxProviderFacets}}
+}
+
+type termsBuckets struct {
+	Buckets []struct {
+		Key      string `json:"key"`
+		DocCount int    `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+func (t *termsBuckets) counts() []genreCount {
+	counts := make([]genreCount, 0, len(t.Buckets))
+	for _, bucket := range t.Buckets {
+		counts = append(counts, genreCount{Name: bucket.Key, Count: bucket.DocCount})
+	}
+	return counts
+}
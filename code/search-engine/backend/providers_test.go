@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeProviders(t *testing.T) {
+	got := normalizeProviders([]string{" netflix ", "Amazon  Prime", "Prime Video", "", "Mubi", "NETFLIX"})
+	want := []string{"Netflix", "Prime Video", "Mubi"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSearchMoviesByProvider(t *testing.T) {
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"hits":{"total":{"value":1},"hits":[{"_id":"m1","_source":{"title":"Arrival","providers":["Netflix"]}}]},` +
+			`"aggregations":{"providers":{"buckets":[{"key":"Netflix","doc_count":1},{"key":"Max","doc_count":1}]}}}`, nil
+	}
+
+	w := serve(handleSearchMovies(repo), http.MethodGet, "/movies", "/movies?q=sci-fi&provider=netflix,hbo+max", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var want map[string]interface{}
+	roundTripJSON(providerFilter([]string{"Netflix", "Max"}), &want)
+	filter := repo.searches[0]["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].([]interface{})
+	if !reflect.DeepEqual(filter[len(filter)-1], want) {
+		t.Fatalf("expected the provider filter %v, got %v", want, filter)
+	}
+
+	var response struct {
+		Movies []Movie `json:"movies"`
+		Facets struct {
+			Providers []genreCount `json:"providers"`
+		} `json:"facets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Movies) != 1 || !reflect.DeepEqual(response.Movies[0].Providers, []string{"Netflix"}) {
+		t.Fatalf("expected Arrival on Netflix, got %+v", response.Movies)
+	}
+	if len(response.Facets.Providers) != 2 || response.Facets.Providers[1] != (genreCount{Name: "Max", Count: 1}) {
+		t.Fatalf("expected a providers facet, got %+v", response.Facets.Providers)
+	}
+}
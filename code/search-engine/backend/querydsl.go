@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /api/movies/search takes part of the Elasticsearch query DSL, for
+// boolean combinations the query parameters can't express. Clauses, their
+// options, and fields are allow-listed: scripts, wildcards, regexps, and
+// anything else that could scan the whole index or read hidden fields are refused.
+const (
+	maxDSLDepth   = 8
+	maxDSLClauses = 64
+	maxDSLTerms   = 100
+)
+
+// Fields are checked by their first segment, so title.en and cast.name pass.
+var dslFields = map[string]bool{
+	"title": true, "description": true, "translations": true, "genres": true,
+	"rating": true, "release_year": true, "user_rating": true, "review_count": true,
+	"collection": true, "directors": true, "cast": true, "crew": true,
+	"providers": true,
+}
+
+// Options each single-field clause accepts besides its field.
+var dslFieldOptions = map[string]map[string]bool{
+	"match":        {"query": true, "operator": true, "fuzziness": true, "minimum_should_match": true, "boost": true},
+	"match_phrase": {"query": true, "slop": true, "boost": true},
+	"term":         {"value": true, "boost": true, "case_insensitive": true},
+	"prefix":       {"value": true, "boost": true, "case_insensitive": true},
+	"range":        {"gt": true, "gte": true, "lt": true, "lte": true, "boost": true},
+}
+
+var dslMultiMatchOptions = map[string]bool{
+	"query": true, "fields": true, "type": true, "operator": true, "fuzziness": true,
+	"minimum_should_match": true, "tie_breaker": true, "boost": true,
+}
+
+var dslMultiMatchTypes = map[string]bool{
+	"best_fields": true, "most_fields": true, "cross_fields": true, "phrase": true, "phrase_prefix": true, "bool_prefix": true,
+}
+
+var dslBoolOccurrences = map[string]bool{"must": true, "should": true, "filter": true, "must_not": true}
+
+type dslValidator struct {
+	clauses int
+}
+
+// validateDSL reports the first thing the query may not do, with its path,
+// such as query.bool.must[1].script.
+func validateDSL(query map[string]interface{}) error {
+	v := &dslValidator{}
+	return v.clause("query", query, 1)
+}
+
+func (v *dslValidator) clause(path string, value interface{}, depth int) error {
+	clause, ok := value.(map[string]interface{})
+	if !ok || len(clause) != 1 {
+		return fmt.Errorf("%s must be an object holding exactly one clause", path)
+	}
+	if depth > maxDSLDepth {
+		return fmt.Errorf("%s nests deeper than %d clauses", path, maxDSLDepth)
+	}
+	if v.clauses++; v.clauses > maxDSLClauses {
+		return fmt.Errorf("query has more than %d clauses", maxDSLClauses)
+	}
+	for name, body := range clause {
+		path += "." + name
+		switch name {
+		case "bool":
+			return v.boolClause(path, body, depth)
+		case "nested":
+			return v.nestedClause(path, body, depth)
+		case "match", "match_phrase", "term", "prefix", "range":
+			return fieldClause(path, name, body)
+		case "terms":
+			return termsClause(path, body)
+		case "exists":
+			return existsClause(path, body)
+		case "multi_match":
+			return multiMatchClause(path, body)
+		default:
+			return fmt.Errorf("%s is not an allowed clause", path)
+		}
+	}
+	return nil
+}
+
+func (v *dslValidator) boolClause(path string, body interface{}, depth int) error {
+	options, ok := body.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an object", path)
+	}
+	for name, value := range options {
+		switch {
+		case dslBoolOccurrences[name]:
+			clauses, isList := value.([]interface{})
+			if !isList {
+				if err := v.clause(path+"."+name, value, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			for i, clause := range clauses {
+				if err := v.clause(fmt.Sprintf("%s.%s[%d]", path, name, i), clause, depth+1); err != nil {
+					return err
+				}
+			}
+		case name == "minimum_should_match" || name == "boost":
+			if !isScalar(value) {
+				return fmt.Errorf("%s.%s must be a number or string", path, name)
+			}
+		default:
+			return fmt.Errorf("%s.%s is not an allowed option", path, name)
+		}
+	}
+	return nil
+}
+
+// Credits are nested, so a name and a role only match within one person.
+func (v *dslValidator) nestedClause(path string, body interface{}, depth int) error {
+	options, ok := body.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an object", path)
+	}
+	for name, value := range options {
+		switch name {
+		case "path":
+			nestedPath, _ := value.(string)
+			if !isPeopleField(nestedPath) {
+				return fmt.Errorf("%s.path must be directors, cast, or crew", path)
+			}
+		case "query":
+			if err := v.clause(path+".query", value, depth+1); err != nil {
+				return err
+			}
+		case "score_mode":
+			if !isScalar(value) {
+				return fmt.Errorf("%s.score_mode must be a string", path)
+			}
+		default:
+			return fmt.Errorf("%s.%s is not an allowed option", path, name)
+		}
+	}
+	if options["path"] == nil || options["query"] == nil {
+		return fmt.Errorf("%s needs a path and a query", path)
+	}
+	return nil
+}
+
+func isPeopleField(path string) bool {
+	for _, field := range peopleFields {
+		if field.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldClause checks clauses shaped {"<field>": value} or {"<field>": {options}}.
+func fieldClause(path, name string, body interface{}) error {
+	fields, ok := body.(map[string]interface{})
+	if !ok || len(fields) != 1 {
+		return fmt.Errorf("%s must name exactly one field", path)
+	}
+	for field, value := range fields {
+		if err := checkDSLField(path, field); err != nil {
+			return err
+		}
+		options, isObject := value.(map[string]interface{})
+		if !isObject {
+			if name == "range" || !isScalar(value) {
+				return fmt.Errorf("%s.%s must be an object of options", path, field)
+			}
+			continue
+		}
+		for option, optionValue := range options {
+			if !dslFieldOptions[name][option] {
+				return fmt.Errorf("%s.%s.%s is not an allowed option", path, field, option)
+			}
+			if !isScalar(optionValue) {
+				return fmt.Errorf("%s.%s.%s must be a number, string, or boolean", path, field, option)
+			}
+		}
+	}
+	return nil
+}
+
+func termsClause(path string, body interface{}) error {
+	options, ok := body.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an object", path)
+	}
+	fields := 0
+	for name, value := range options {
+		if name == "boost" {
+			if !isScalar(value) {
+				return fmt.Errorf("%s.boost must be a number", path)
+			}
+			continue
+		}
+		if err := checkDSLField(path, name); err != nil {
+			return err
+		}
+		values, isList := value.([]interface{})
+		if !isList || len(values) > maxDSLTerms {
+			return fmt.Errorf("%s.%s must be a list of at most %d values", path, name, maxDSLTerms)
+		}
+		for _, term := range values {
+			if !isScalar(term) {
+				return fmt.Errorf("%s.%s must hold numbers, strings, or booleans", path, name)
+			}
+		}
+		fields++
+	}
+	if fields != 1 {
+		return fmt.Errorf("%s must name exactly one field", path)
+	}
+	return nil
+}
+
+func existsClause(path string, body interface{}) error {
+	options, ok := body.(map[string]interface{})
+	if !ok || len(options) != 1 {
+		return fmt.Errorf("%s must be {\"field\": name}", path)
+	}
+	field, isString := options["field"].(string)
+	if !isString {
+		return fmt.Errorf("%s must be {\"field\": name}", path)
+	}
+	return checkDSLField(path, field)
+}
+
+func multiMatchClause(path string, body interface{}) error {
+	options, ok := body.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an object", path)
+	}
+	for name, value := range options {
+		if !dslMultiMatchOptions[name] {
+			return fmt.Errorf("%s.%s is not an allowed option", path, name)
+		}
+		if name != "fields" {
+			if !isScalar(value) {
+				return fmt.Errorf("%s.%s must be a number, string, or boolean", path, name)
+			}
+			continue
+		}
+		fields, isList := value.([]interface{})
+		if !isList || len(fields) == 0 {
+			return fmt.Errorf("%s.fields must be a list of field names", path)
+		}
+		for _, field := range fields {
+			name, isString := field.(string)
+			if !isString {
+				return fmt.Errorf("%s.fields must be a list of field names", path)
+			}
+			// A field may carry a boost, as in title^2.
+			name, _, _ = strings.Cut(name, "^")
+			if err := checkDSLField(path+".fields", name); err != nil {
+				return err
+			}
+		}
+	}
+	if options["query"] == nil || options["fields"] == nil {
+		return fmt.Errorf("%s needs a query and fields", path)
+	}
+	if kind, set := options["type"]; set && !dslMultiMatchTypes[fmt.Sprint(kind)] {
+		return fmt.Errorf("%s.type %v is not supported", path, kind)
+	}
+	return nil
+}
+
+func checkDSLField(path, field string) error {
+	root, _, _ := strings.Cut(field, ".")
+	if !dslFields[root] || strings.ContainsAny(field, "*?") {
+		return fmt.Errorf("%s: field %q is not searchable", path, field)
+	}
+	return nil
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// handleQueryMovies pages like GET /api/movies, minus cursors, and never
+// returns deleted movies whatever the query says.
+func handleQueryMovies(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Query    map[string]interface{} `json:"query" binding:"required"`
+			Sort     string                 `json:"sort"`
+			Order    string                 `json:"order"`
+			Page     int                    `json:"page"`
+			PageSize int                    `json:"page_size"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateDSL(input.Query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		page, pageSize := input.Page, input.PageSize
+		if page < 1 {
+			page = 1
+		}
+		if pageSize <= 0 || pageSize > 50 {
+			pageSize = 5
+		}
+		if page*pageSize > maxResultWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page goes past the first %d results", maxResultWindow)})
+			return
+		}
+		sort, err := parseSort(input.Sort, input.Order, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var result struct {
+			searchShards
+			discoverResult
+		}
+		err = repo.Search(c.Request.Context(), movieIndex, map[string]interface{}{
+			"from":    (page - 1) * pageSize,
+			"size":    pageSize,
+			"sort":    sort,
+			"timeout": esTimeout(timeouts.search),
+			"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+			"query": map[string]interface{}{"bool": map[string]interface{}{
+				"must":   []interface{}{input.Query},
+				"filter": []map[string]interface{}{notDeleted()},
+			}},
+		}, &result)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "search took too long, try a narrower query"})
+			return
+		case statusCode(err) == http.StatusBadRequest:
+			// Allowed clauses can still hold values Elasticsearch rejects, such as a bad fuzziness.
+			log.Printf("query movies: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the query was rejected, check its values"})
+			return
+		case err != nil:
+			log.Printf("query movies: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+
+		totalHits := result.Hits.Total.Value
+		c.JSON(http.StatusOK, gin.H{
+			"movies": result.movies(),
+			"pagination": Pagination{
+				Page:       page,
+				PageSize:   pageSize,
+				TotalHits:  totalHits,
+				TotalPages: (totalHits + pageSize - 1) / pageSize,
+			},
+			"meta": result.meta(),
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateDSL(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{
+			name: "bool combination",
+			query: `{"bool":{"must":[{"match":{"title":"batman"}}],"should":{"term":{"genres":"Crime"}},
+				"must_not":[{"range":{"release_year":{"lt":2000}}},{"exists":{"field":"collection"}}],"minimum_should_match":0}}`,
+		},
+		{
+			name:  "nested credits",
+			query: `{"nested":{"path":"cast","query":{"bool":{"filter":[{"term":{"cast.name.keyword":"Al Pacino"}},{"match":{"cast.role":"detective"}}]}}}}`,
+		},
+		{name: "multi match with boosts", query: `{"multi_match":{"query":"heat","fields":["title^2","description.en"],"type":"best_fields"}}`},
+		{name: "terms", query: `{"terms":{"genres":["Crime","Drama"],"boost":2}}`},
+		{name: "script", query: `{"bool":{"must":[{"match":{"title":"x"}},{"script":{"script":"true"}}]}}`, wantErr: "query.bool.must[1].script is not an allowed clause"},
+		{name: "hidden field", query: `{"term":{"deleted":true}}`, wantErr: `field "deleted" is not searchable`},
+		{name: "wildcard field", query: `{"multi_match":{"query":"x","fields":["*"]}}`, wantErr: `field "*" is not searchable`},
+		{name: "unknown option", query: `{"match":{"title":{"query":"x","analyzer":"keyword"}}}`, wantErr: "query.match.title.analyzer is not an allowed option"},
+		{name: "two clauses", query: `{"match":{"title":"x"},"term":{"genres":"Crime"}}`, wantErr: "exactly one clause"},
+		{name: "nested path", query: `{"nested":{"path":"translations","query":{"match":{"title":"x"}}}}`, wantErr: "directors, cast, or crew"},
+		{name: "range shorthand", query: `{"range":{"rating":7}}`, wantErr: "must be an object of options"},
+		{name: "too deep", query: strings.Repeat(`{"bool":{"must":`, 8) + `{"match":{"title":"x"}}` + strings.Repeat(`}}`, 8), wantErr: "nests deeper"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var query map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.query), &query); err != nil {
+				t.Fatalf("decode query: %v", err)
+			}
+			err := validateDSL(query)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected the query allowed, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHandleQueryMovies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		return `{"hits":{"total":{"value":6},"hits":[{"_id":"m1","_source":{"title":"Heat"}}]}}`, nil
+	}
+
+	w := serve(handleQueryMovies(repo), http.MethodPost, "/movies/search", "/movies/search",
+		`{"query":{"match":{"title":"heat"}},"sort":"rating","page":2,"page_size":5}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := repo.searches[0]
+	var want map[string]interface{}
+	roundTripJSON(map[string]interface{}{"bool": map[string]interface{}{
+		"must":   []interface{}{map[string]interface{}{"match": map[string]interface{}{"title": "heat"}}},
+		"filter": []map[string]interface{}{notDeleted()},
+	}}, &want)
+	if !reflect.DeepEqual(body["query"], want) || body["from"] != float64(5) {
+		t.Fatalf("expected the query wrapped to skip deleted movies from 5, got %v", body)
+	}
+	var response struct {
+		Movies     []Movie    `json:"movies"`
+		Pagination Pagination `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Movies) != 1 || response.Pagination.TotalPages != 2 {
+		t.Fatalf("expected one movie on page 2 of 2, got %+v", response)
+	}
+
+	w = serve(handleQueryMovies(repo), http.MethodPost, "/movies/search", "/movies/search", `{"query":{"regexp":{"title":".*"}}}`)
+	if w.Code != http.StatusBadRequest || len(repo.searches) != 1 {
+		t.Fatalf("expected 400 without a search, got %d after %d searches", w.Code, len(repo.searches))
+	}
+}
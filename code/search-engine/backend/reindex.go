@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/gin-gonic/gin"
+)
+
+// reindexPollRetries is how many task checks in a row may fail.
+const (
+	reindexPollInterval = time.Second
+	reindexPollRetries  = 10
+)
+
+func movieIndexVersion(version int) string {
+	return fmt.Sprintf("%s-v%d", movieIndex, version)
+}
+
+func parseMovieIndexVersion(name string) (int, bool) {
+	version, err := strconv.Atoi(strings.TrimPrefix(name, movieIndex+"-v"))
+	if err != nil || !strings.HasPrefix(name, movieIndex+"-v") || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+func esCall(res *esapi.Response, err error, action string) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("%s response error: %s", action, res.String())
+	}
+	return nil
+}
+
+func encodeBody(body interface{}) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	return &buf, nil
+}
+
+// moveIndexBehindAlias upgrades a deployment from before aliasing, where movies was a concrete index.
+func moveIndexBehindAlias(es *elasticsearch.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	dest := movieIndexVersion(1)
+	log.Printf("moving index %s behind an alias as %s", movieIndex, dest)
+	// An upgrade cut short by a restart leaves its partial copy behind.
+	res, err := es.Indices.Delete([]string{dest}, es.Indices.Delete.WithContext(ctx), es.Indices.Delete.WithIgnoreUnavailable(true))
+	if err := esCall(res, err, "delete stale index"); err != nil {
+		return err
+	}
+	if err := createMovieIndex(ctx, es, dest, false); err != nil {
+		return err
+	}
+
+	body, err := encodeBody(map[string]interface{}{
+		"source": map[string]interface{}{"index": movieIndex},
+		"dest":   map[string]interface{}{"index": dest},
+	})
+	if err != nil {
+		return err
+	}
+	res, err = es.Reindex(body, es.Reindex.WithContext(ctx), es.Reindex.WithRefresh(true), es.Reindex.WithWaitForCompletion(true))
+	if err := esCall(res, err, "copy legacy index"); err != nil {
+		return err
+	}
+
+	return swapAlias(ctx, es, movieIndex, dest, true)
+}
+
+func currentMovieIndex(ctx context.Context, es *elasticsearch.Client) (string, error) {
+	res, err := es.Indices.GetAlias(es.Indices.GetAlias.WithName(movieIndex), es.Indices.GetAlias.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get alias: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", fmt.Errorf("get alias response error: %s", res.String())
+	}
+
+	var aliases map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&aliases); err != nil {
+		return "", fmt.Errorf("decode alias: %w", err)
+	}
+	if len(aliases) != 1 {
+		return "", fmt.Errorf("alias %s points at %d indexes, expected 1", movieIndex, len(aliases))
+	}
+	for name := range aliases {
+		return name, nil
+	}
+	return "", nil
+}
+
+func swapAlias(ctx context.Context, es *elasticsearch.Client, source, dest string, removeSource bool) error {
+	remove := map[string]interface{}{"remove": map[string]interface{}{"index": source, "alias": movieIndex}}
+	if removeSource {
+		remove = map[string]interface{}{"remove_index": map[string]interface{}{"index": source}}
+	}
+	body, err := encodeBody(map[string]interface{}{
+		"actions": []map[string]interface{}{
+			{"add": map[string]interface{}{"index": dest, "alias": movieIndex}},
+			remove,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.UpdateAliases(body, es.Indices.UpdateAliases.WithContext(ctx))
+	return esCall(res, err, "swap alias")
+}
+
+func setWriteBlock(ctx context.Context, es *elasticsearch.Client, index string, blocked bool) error {
+	body, err := encodeBody(map[string]interface{}{"index.blocks.write": blocked})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.PutSettings(body, es.Indices.PutSettings.WithIndex(index), es.Indices.PutSettings.WithContext(ctx))
+	return esCall(res, err, "set write block")
+}
+
+type ReindexJob struct {
+	State      string     `json:"state"`
+	TaskID     string     `json:"task_id"`
+	Source     string     `json:"source"`
+	Dest       string     `json:"dest"`
+	KeepOld    bool       `json:"keep_old"`
+	Total      int        `json:"total"`
+	Created    int        `json:"created"`
+	Updated    int        `json:"updated"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+const (
+	reindexRunning   = "running"
+	reindexCompleted = "completed"
+	reindexFailed    = "failed"
+)
+
+var (
+	errReindexRunning    = errors.New("a reindex is already running")
+	errReindexTaskFailed = errors.New("reindex task failed")
+)
+
+type reindexer struct {
+	es *elasticsearch.Client
+
+	mu  sync.Mutex
+	job *ReindexJob
+}
+
+func newReindexer(es *elasticsearch.Client) *reindexer {
+	return &reindexer{es: es}
+}
+
+func (r *reindexer) running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.job != nil && r.job.State == reindexRunning
+}
+
+func (r *reindexer) snapshot() *ReindexJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job == nil {
+		return nil
+	}
+	job := *r.job
+	return &job
+}
+
+func (r *reindexer) update(fn func(job *ReindexJob)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.job)
+}
+
+func (r *reindexer) start(ctx context.Context, keepOld bool) (*ReindexJob, error) {
+	r.mu.Lock()
+	if r.job != nil && r.job.State == reindexRunning {
+		r.mu.Unlock()
+		return nil, errReindexRunning
+	}
+	job := &ReindexJob{State: reindexRunning, KeepOld: keepOld, StartedAt: time.Now().UTC()}
+	r.job = job
+	r.mu.Unlock()
+
+	if err := r.begin(ctx); err != nil {
+		r.finish(err)
+		return nil, err
+	}
+	go r.watch()
+	return r.snapshot(), nil
+}
+
+func (r *reindexer) begin(ctx context.Context) error {
+	source, err := currentMovieIndex(ctx, r.es)
+	if err != nil {
+		return err
+	}
+	version, ok := parseMovieIndexVersion(source)
+	if !ok {
+		return fmt.Errorf("alias %s points at %s, which is not a versioned index", movieIndex, source)
+	}
+	dest := movieIndexVersion(version + 1)
+	r.update(func(job *ReindexJob) { job.Source, job.Dest = source, dest })
+
+	// A reindex cut short by a restart leaves its partial copy behind.
+	res, err := r.es.Indices.Delete([]string{dest}, r.es.Indices.Delete.WithContext(ctx),
+		r.es.Indices.Delete.WithIgnoreUnavailable(true))
+	if err := esCall(res, err, "delete stale index"); err != nil {
+		return err
+	}
+	if err := createMovieIndex(ctx, r.es, dest, false); err != nil {
+		return err
+	}
+	if err := setWriteBlock(ctx, r.es, source, true); err != nil {
+		return err
+	}
+
+	body, err := encodeBody(map[string]interface{}{
+		"source": map[string]interface{}{"index": source},
+		"dest":   map[string]interface{}{"index": dest},
+	})
+	if err != nil {
+		return err
+	}
+	res, err = r.es.Reindex(body, r.es.Reindex.WithContext(ctx), r.es.Reindex.WithWaitForCompletion(false))
+	if err != nil {
+		return fmt.Errorf("start reindex: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("start reindex response error: %s", res.String())
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
+		return fmt.Errorf("decode reindex task: %w", err)
+	}
+	r.update(func(job *ReindexJob) { job.TaskID = started.Task })
+	return nil
+}
+
+func (r *reindexer) watch() {
+	ticker := time.NewTicker(reindexPollInterval)
+	defer ticker.Stop()
+	failures := 0
+	for range ticker.C {
+		done, err := r.poll()
+		// The task keeps running while it cannot be reached.
+		if err != nil && !errors.Is(err, errReindexTaskFailed) && failures < reindexPollRetries {
+			failures++
+			log.Printf("reindex: check task (attempt %d of %d): %v", failures, reindexPollRetries, err)
+			continue
+		}
+		if err != nil {
+			r.finish(err)
+			return
+		}
+		failures = 0
+		if done {
+			r.finish(r.complete())
+			return
+		}
+	}
+}
+
+func (r *reindexer) poll() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	taskID := r.snapshot().TaskID
+	res, err := r.es.Tasks.Get(taskID, r.es.Tasks.Get.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("get reindex task: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return false, fmt.Errorf("get reindex task response error: %s", res.String())
+	}
+
+	var task struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status struct {
+				Total   int `json:"total"`
+				Created int `json:"created"`
+				Updated int `json:"updated"`
+			} `json:"status"`
+		} `json:"task"`
+		Error *struct {
+			Reason string `json:"reason"`
+		} `json:"error"`
+		Response struct {
+			Failures []json.RawMessage `json:"failures"`
+		} `json:"response"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&task); err != nil {
+		return false, fmt.Errorf("decode reindex task: %w", err)
+	}
+
+	r.update(func(job *ReindexJob) {
+		job.Total = task.Task.Status.Total
+		job.Created = task.Task.Status.Created
+		job.Updated = task.Task.Status.Updated
+	})
+	switch {
+	case task.Error != nil:
+		return false, fmt.Errorf("%w: %s", errReindexTaskFailed, task.Error.Reason)
+	case len(task.Response.Failures) > 0:
+		return false, fmt.Errorf("%w for %d documents: %s", errReindexTaskFailed, len(task.Response.Failures), task.Response.Failures[0])
+	}
+	return task.Completed, nil
+}
+
+func (r *reindexer) complete() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job := r.snapshot()
+	res, err := r.es.Indices.Refresh(r.es.Indices.Refresh.WithIndex(job.Dest), r.es.Indices.Refresh.WithContext(ctx))
+	if err := esCall(res, err, "refresh new index"); err != nil {
+		return err
+	}
+	if err := swapAlias(ctx, r.es, job.Source, job.Dest, !job.KeepOld); err != nil {
+		return err
+	}
+	// The new index is live now, so a failure here must not fail the job.
+	if job.KeepOld {
+		if err := setWriteBlock(ctx, r.es, job.Source, false); err != nil {
+			log.Printf("reindex: unblock %s: %v", job.Source, err)
+		}
+	}
+	return nil
+}
+
+// finish records the outcome. On failure the task is cancelled, the old
+// index is made writable again, and the copy is deleted.
+func (r *reindexer) finish(err error) {
+	job := r.snapshot()
+	if err != nil {
+		log.Printf("reindex %s -> %s failed: %v", job.Source, job.Dest, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		// A running task would recreate the deleted copy with dynamic mappings.
+		if job.TaskID != "" {
+			res, cancelErr := r.es.Tasks.Cancel(r.es.Tasks.Cancel.WithTaskID(job.TaskID),
+				r.es.Tasks.Cancel.WithWaitForCompletion(true), r.es.Tasks.Cancel.WithContext(ctx))
+			if cancelErr := esCall(res, cancelErr, "cancel reindex task"); cancelErr != nil {
+				log.Printf("reindex: %v", cancelErr)
+			}
+		}
+		if job.Source != "" {
+			if unblockErr := setWriteBlock(ctx, r.es, job.Source, false); unblockErr != nil {
+				log.Printf("reindex: unblock %s: %v", job.Source, unblockErr)
+			}
+		}
+		if job.Dest != "" {
+			res, deleteErr := r.es.Indices.Delete([]string{job.Dest}, r.es.Indices.Delete.WithContext(ctx),
+				r.es.Indices.Delete.WithIgnoreUnavailable(true))
+			if deleteErr := esCall(res, deleteErr, "delete partial index"); deleteErr != nil {
+				log.Printf("reindex: %v", deleteErr)
+			}
+		}
+	} else {
+		log.Printf("reindex %s -> %s completed", job.Source, job.Dest)
+	}
+
+	r.update(func(job *ReindexJob) {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		job.State = reindexCompleted
+		if err != nil {
+			job.State = reindexFailed
+			job.Error = err.Error()
+		}
+	})
+}
+
+func handleStartReindex(r *reindexer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keepOld, err := strconv.ParseBool(c.DefaultQuery("keep_old", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "keep_old must be true or false"})
+			return
+		}
+
+		job, err := r.start(c.Request.Context(), keepOld)
+		if errors.Is(err, errReindexRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": r.snapshot()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start reindex: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func handleReindexStatus(r *reindexer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job := r.snapshot()
+		if job == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no reindex has run since the server started"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+func rejectWritesDuringReindex(r *reindexer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r.running() {
+			c.Header("Retry-After", "5")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "a reindex is in progress, try again shortly"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxFieldBoost = 100
+
+// boostProfile weights the fields a text search matches. Credits fields
+// weight the nested query for each kind of credit.
+type boostProfile struct {
+	Fields             map[string]float64 `json:"fields"`
+	TieBreaker         float64            `json:"tie_breaker"`
+	MinimumShouldMatch string             `json:"minimum_should_match,omitempty"`
+}
+
+// Counts like 2, percentages like 75%, negatives, and combinations like 3<90%.
+var minimumShouldMatchPattern = regexp.MustCompile(`^(-?\d+%?|(\d+<-?\d+%?)( \d+<-?\d+%?)*)$`)
+
+func defaultBoostProfile() boostProfile {
+	return boostProfile{Fields: map[string]float64{
+		"title":       2,
+		"description": 1,
+		"genres":      1,
+		"directors":   1.5,
+		"cast":        1.2,
+		"crew":        1,
+	}}
+}
+
+var boosts atomic.Pointer[boostProfile]
+
+func init() {
+	profile := defaultBoostProfile()
+	boosts.Store(&profile)
+}
+
+func currentBoosts() boostProfile {
+	return *boosts.Load()
+}
+
+func loadBoosts() error {
+	path := os.Getenv("SEARCH_BOOSTS_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read boosts file: %w", err)
+	}
+	var profile boostProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return fmt.Errorf("decode boosts file: %w", err)
+	}
+	if err := profile.normalize(); err != nil {
+		return fmt.Errorf("boosts file: %w", err)
+	}
+	boosts.Store(&profile)
+	return nil
+}
+
+// normalize checks the profile and fills in fields it leaves out with their default weights.
+func (p *boostProfile) normalize() error {
+	defaults := defaultBoostProfile().Fields
+	fields := make(map[string]float64, len(defaults))
+	for field, weight := range p.Fields {
+		if _, ok := defaults[field]; !ok {
+			known := make([]string, 0, len(defaults))
+			for name := range defaults {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown field %q, must be one of %s", field, strings.Join(known, ", "))
+		}
+		if weight < 0 || weight > maxFieldBoost {
+			return fmt.Errorf("the weight of %s must be between 0 and %d", field, maxFieldBoost)
+		}
+		fields[field] = weight
+	}
+	for field, weight := range defaults {
+		if _, ok := fields[field]; !ok {
+			fields[field] = weight
+		}
+	}
+	if fields["title"] == 0 && fields["description"] == 0 && fields["genres"] == 0 {
+		return fmt.Errorf("at least one of title, description, and genres needs a weight")
+	}
+	p.Fields = fields
+	if p.TieBreaker < 0 || p.TieBreaker > 1 {
+		return fmt.Errorf("tie_breaker must be between 0 and 1")
+	}
+	p.MinimumShouldMatch = strings.TrimSpace(p.MinimumShouldMatch)
+	if p.MinimumShouldMatch != "" && !minimumShouldMatchPattern.MatchString(p.MinimumShouldMatch) {
+		return fmt.Errorf("minimum_should_match must be a count or a percentage such as 2 or 75%%")
+	}
+	return nil
+}
+
+// textFields lists the multi_match fields with their weights. A weight of 0 leaves the field out.
+func (p boostProfile) textFields() []string {
+	var fields []string
+	for _, field := range []string{"title", "description", "genres"} {
+		if weight := p.Fields[field]; weight > 0 {
+			fields = append(fields, weightedField(field, weight))
+		}
+	}
+	return fields
+}
+
+func weightedField(field string, weight float64) string {
+	if weight == 1 {
+		return field
+	}
+	return fmt.Sprintf("%s^%g", field, weight)
+}
+
+func handleGetBoosts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, currentBoosts())
+	}
+}
+
+// handleUpdateBoosts replaces the profile until the next restart, which goes
+// back to SEARCH_BOOSTS_FILE. Fields left out get their default weights, so {}
+// restores the defaults.
+func handleUpdateBoosts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var profile boostProfile
+		if err := c.ShouldBindJSON(&profile); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := profile.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		boosts.Store(&profile)
+		log.Printf("search boosts changed: %+v", profile)
+		c.JSON(http.StatusOK, profile)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBoostProfileNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		wantErr string
+	}{
+		{name: "empty keeps the defaults", profile: `{}`},
+		{name: "partial", profile: `{"fields":{"title":5,"crew":0},"tie_breaker":0.3,"minimum_should_match":"75%"}`},
+		{name: "combination", profile: `{"minimum_should_match":"2<-25% 9<-3"}`},
+		{name: "unknown field", profile: `{"fields":{"plot":2}}`, wantErr: `unknown field "plot"`},
+		{name: "negative weight", profile: `{"fields":{"title":-1}}`, wantErr: "between 0 and 100"},
+		{name: "no text fields", profile: `{"fields":{"title":0,"description":0,"genres":0}}`, wantErr: "needs a weight"},
+		{name: "tie breaker", profile: `{"tie_breaker":2}`, wantErr: "tie_breaker"},
+		{name: "minimum should match", profile: `{"minimum_should_match":"most"}`, wantErr: "minimum_should_match"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var profile boostProfile
+			if err := json.Unmarshal([]byte(tc.profile), &profile); err != nil {
+				t.Fatalf("decode profile: %v", err)
+			}
+			err := profile.normalize()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(profile.Fields) != len(defaultBoostProfile().Fields) {
+				t.Fatalf("expected every field weighted, got %v", profile.Fields)
+			}
+		})
+	}
+}
+
+func TestMovieTextQueryUsesBoosts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func() {
+		profile := defaultBoostProfile()
+		boosts.Store(&profile)
+	}()
+
+	w := serve(handleUpdateBoosts(), http.MethodPut, "/boosts", "/boosts", `{"fields":{"title":4,"description":0,"crew":0},"tie_breaker":0.2,"minimum_should_match":"2"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = serve(handleGetBoosts(), http.MethodGet, "/boosts", "/boosts", "")
+	var profile boostProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("decode profile: %v", err)
+	}
+	if profile.Fields["title"] != 4 || profile.Fields["cast"] != 1.2 {
+		t.Fatalf("expected the new title weight and the default cast weight, got %v", profile.Fields)
+	}
+
+	query := movieTextQuery("heat", "AUTO", "")
+	should := query["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+	multiMatch := should[0]["multi_match"].(map[string]interface{})
+	if fields := strings.Join(multiMatch["fields"].([]string), ","); fields != "title^4,genres" {
+		t.Fatalf("expected title^4,genres, got %s", fields)
+	}
+	if multiMatch["tie_breaker"] != 0.2 || multiMatch["minimum_should_match"] != "2" {
+		t.Fatalf("expected tie_breaker and minimum_should_match, got %v", multiMatch)
+	}
+	// The crew query is dropped with its weight.
+	if len(should) != 3 {
+		t.Fatalf("expected the text query and two credit queries, got %d", len(should))
+	}
+
+	w = serve(handleUpdateBoosts(), http.MethodPut, "/boosts", "/boosts", `{"fields":{"title":1000}}`)
+	if w.Code != http.StatusBadRequest || currentBoosts().Fields["title"] != 4 {
+		t.Fatalf("expected a rejected profile to leave the boosts alone, got %d and %v", w.Code, currentBoosts().Fields)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+var errDocumentNotFound = errors.New("document not found")
+
+// Repository is the document storage behind the movie handlers, so they can
+// be tested without a cluster.
+type Repository interface {
+	Index(ctx context.Context, index, id string, doc interface{}) error
+	Get(ctx context.Context, index, id string) (map[string]interface{}, error)
+	// Search decodes the response into out. An empty index searches a point
+	// in time named in the body.
+	Search(ctx context.Context, index string, body interface{}, out interface{}) error
+	// MultiSearch runs several searches in one request. Each response is
+	// returned raw, since one search can fail while the others succeed.
+	MultiSearch(ctx context.Context, searches []indexSearch) ([]json.RawMessage, error)
+	Delete(ctx context.Context, index, id string) error
+	// Bulk returns how many items failed and the ids of documents it created.
+	// Item failures are logged; only a failed request is an error.
+	Bulk(ctx context.Context, index string, body io.Reader) (int, []string, error)
+}
+
+type indexSearch struct {
+	Index string
+	Body  interface{}
+}
+
+// responseStream is a Search target that reads the response as it arrives.
+type responseStream interface {
+	decodeFrom(r io.Reader) error
+}
+
+// pointInTimes is implemented by repositories that support cursor pagination.
+type pointInTimes interface {
+	OpenPointInTime(ctx context.Context, index string) (string, error)
+	ClosePointInTime(id string)
+}
+
+type esStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *esStatusError) Error() string {
+	return fmt.Sprintf("elasticsearch returned %d: %s", e.StatusCode, e.Body)
+}
+
+func statusCode(err error) int {
+	var statusErr *esStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+type esRepository struct {
+	es *elasticsearch.Client
+}
+
+func (r esRepository) Index(ctx context.Context, index, id string, doc interface{}) error {
+	body, err := encodeBody(doc)
+	if err != nil {
+		return err
+	}
+	res, err := r.es.Index(index, body,
+		r.es.Index.WithDocumentID(id),
+		r.es.Index.WithRefresh("true"),
+		r.es.Index.WithContext(ctx))
+	return esCall(res, err, "index "+id)
+}
+
+func (r esRepository) Get(ctx context.Context, index, id string) (map[string]interface{}, error) {
+	res, err := r.es.Get(index, id, r.es.Get.WithSourceExcludes(movieSourceExcludes...), r.es.Get.WithContext(ctx))
+	if err := checkResponse(res, err, "get "+id); err != nil {
+		return nil, notFound(err)
+	}
+	defer res.Body.Close()
+	var doc struct {
+		Source map[string]interface{} `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", id, err)
+	}
+	return doc.Source, nil
+}
+
+func (r esRepository) Search(ctx context.Context, index string, body interface{}, out interface{}) error {
+	encoded, err := encodeBody(body)
+	if err != nil {
+		return err
+	}
+	options := []func(*esapi.SearchRequest){r.es.Search.WithBody(encoded), r.es.Search.WithContext(ctx)}
+	if index != "" {
+		options = append(options, r.es.Search.WithIndex(index))
+	}
+	res, err := r.es.Search(options...)
+	if err := checkResponse(res, err, "search"); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if stream, ok := out.(responseStream); ok {
+		if err := stream.decodeFrom(res.Body); err != nil {
+			return fmt.Errorf("decode search response: %w", err)
+		}
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode search response: %w", err)
+	}
+	return nil
+}
+
+func (r esRepository) MultiSearch(ctx context.Context, searches []indexSearch) ([]json.RawMessage, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, search := range searches {
+		if err := encoder.Encode(map[string]interface{}{"index": search.Index}); err != nil {
+			return nil, err
+		}
+		if err := encoder.Encode(search.Body); err != nil {
+			return nil, fmt.Errorf("encode search: %w", err)
+		}
+	}
+	res, err := r.es.Msearch(&buf, r.es.Msearch.WithContext(ctx))
+	if err := checkResponse(res, err, "multi search"); err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var response struct {
+		Responses []json.RawMessage `json:"responses"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decode multi search response: %w", err)
+	}
+	if len(response.Responses) != len(searches) {
+		return nil, fmt.Errorf("multi search returned %d responses for %d searches", len(response.Responses), len(searches))
+	}
+	return response.Responses, nil
+}
+
+func (r esRepository) Delete(ctx context.Context, index, id string) error {
+	res, err := r.es.Delete(index, id, r.es.Delete.WithContext(ctx))
+	if err := checkResponse(res, err, "delete "+id); err != nil {
+		return notFound(err)
+	}
+	return res.Body.Close()
+}
+
+type deferRefreshKey struct{}
+
+// deferRefresh makes bulk writes skip the refresh that makes them searchable,
+// for imports that refresh once at the end.
+func deferRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferRefreshKey{}, true)
+}
+
+func (r esRepository) Bulk(ctx context.Context, index string, body io.Reader) (int, []string, error) {
+	refresh := "true"
+	if deferred, _ := ctx.Value(deferRefreshKey{}).(bool); deferred {
+		refresh = "false"
+	}
+	res, err := r.es.Bulk(body, r.es.Bulk.WithIndex(index), r.es.Bulk.WithRefresh(refresh), r.es.Bulk.WithContext(ctx))
+	if err := checkResponse(res, err, "bulk"); err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Items []map[string]struct {
+			ID     string          `json:"_id"`
+			Result string          `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, nil, fmt.Errorf("decode bulk response: %w", err)
+	}
+	failed := 0
+	var created []string
+	for _, item := range response.Items {
+		for action, result := range item {
+			switch {
+			case len(result.Error) > 0:
+				failed++
+				log.Printf("bulk %s %s: %s", action, result.ID, result.Error)
+			case result.Result == "created":
+				created = append(created, result.ID)
+			}
+		}
+	}
+	return failed, created, nil
+}
+
+func (r esRepository) OpenPointInTime(ctx context.Context, index string) (string, error) {
+	return openPointInTime(ctx, r.es, index)
+}
+
+func (r esRepository) ClosePointInTime(id string) {
+	closePointInTime(r.es, id)
+}
+
+// checkResponse is esCall for responses whose body is still needed: the body
+// is only closed on failure.
+func checkResponse(res *esapi.Response, err error, action string) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	if res.IsError() {
+		defer res.Body.Close()
+		return fmt.Errorf("%s: %w", action, &esStatusError{StatusCode: res.StatusCode, Body: res.String()})
+	}
+	return nil
+}
+
+// decodeResponse checks a response and decodes its body into out.
+func decodeResponse(res *esapi.Response, err error, action string, out interface{}) error {
+	if err := checkResponse(res, err, action); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", action, err)
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if statusCode(err) == http.StatusNotFound {
+		return errDocumentNotFound
+	}
+	return err
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/gin-gonic/gin"
+)
+
+var errCircuitOpen = errors.New("elasticsearch circuit breaker is open")
+
+// readOnlyEndpoints are POST endpoints that change nothing, so they are as
+// safe to retry as a GET.
+var readOnlyEndpoints = map[string]bool{
+	"_search": true, "_msearch": true, "_mget": true, "_count": true, "_analyze": true, "_field_caps": true,
+}
+
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	armed    bool
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// arm starts counting failures, so startup can wait for the cluster without
+// tripping the breaker.
+func (b *circuitBreaker) arm() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.armed = true
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.armed || b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.armed {
+		return
+	}
+	wasOpen := b.failures >= b.threshold
+	b.probing = false
+	if ok {
+		if wasOpen {
+			log.Printf("elasticsearch is reachable again, closing circuit breaker")
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		if !wasOpen {
+			log.Printf("elasticsearch failed %d times in a row, opening circuit breaker for %s", b.failures, b.cooldown)
+		}
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) retryAfter() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.armed || b.failures < b.threshold {
+		return 0, false
+	}
+	wait := b.cooldown - time.Since(b.openedAt)
+	if wait <= 0 && !b.probing {
+		return 0, false
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, true
+}
+
+func (b *circuitBreaker) state() string {
+	if _, open := b.retryAfter(); open {
+		return "open"
+	}
+	return "closed"
+}
+
+// esTransport retries only idempotent requests. The client's own retries are
+// off: they would also replay writes such as indexing without an id.
+type esTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	breaker    *circuitBreaker
+	// timeout bounds calls made without a deadline of their own.
+	timeout time.Duration
+}
+
+func newESTransport() (*esTransport, error) {
+	maxRetries, err := envInt("ES_MAX_RETRIES", 3, 0)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := envInt("ES_BREAKER_THRESHOLD", 5, 1)
+	if err != nil {
+		return nil, err
+	}
+	cooldown := 30 * time.Second
+	if value := getenv("ES_BREAKER_COOLDOWN", ""); value != "" {
+		cooldown, err = time.ParseDuration(value)
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("invalid ES_BREAKER_COOLDOWN %q: must be a positive duration such as 30s", value)
+		}
+	}
+	timeout := 30 * time.Second
+	if value := getenv("ES_REQUEST_TIMEOUT", ""); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid ES_REQUEST_TIMEOUT %q: must be a positive duration such as 30s", value)
+		}
+	}
+	return &esTransport{
+		next:       metricsTransport{next: http.DefaultTransport},
+		maxRetries: maxRetries,
+		breaker:    &circuitBreaker{threshold: threshold, cooldown: cooldown},
+		timeout:    timeout,
+	}, nil
+}
+
+func envInt(key string, fallback, min int) (int, error) {
+	value := getenv(key, "")
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min {
+		return 0, fmt.Errorf("invalid %s %q: must be a whole number of at least %d", key, value, min)
+	}
+	return parsed, nil
+}
+
+func (t *esTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Deadline(); ok || t.timeout <= 0 {
+		return t.roundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	res, err := t.roundTrip(req.WithContext(ctx))
+	if res == nil {
+		cancel()
+		return res, err
+	}
+	// The deadline has to outlive RoundTrip, since the caller still reads the body.
+	res.Body = cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (t *esTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	retries := 0
+	var body []byte
+	if isIdempotent(req) {
+		retries = t.maxRetries
+		if req.Body != nil {
+			var err error
+			if body, err = io.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+			req.Body.Close()
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !t.breaker.allow() {
+			markOutage(req.Context())
+			errorsTotal.WithLabelValues("circuit_open").Inc()
+			return nil, errCircuitOpen
+		}
+		if body != nil {
+			req = req.Clone(req.Context())
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		res, err := t.next.RoundTrip(req)
+		if req.Context().Err() != nil {
+			// The caller gave up, which says nothing about the cluster.
+			t.breaker.release()
+			return res, err
+		}
+		failed := err != nil || isUnavailable(res.StatusCode)
+		t.breaker.record(!failed)
+		if !failed {
+			return res, nil
+		}
+		if attempt >= retries {
+			markOutage(req.Context())
+			return res, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		select {
+		case <-time.After(retryBackoff(attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func isUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// isIdempotent leaves out creates and deletes: a retried create that went
+// through would report a conflict, and a retried delete a 404.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPut:
+		return !strings.Contains(req.URL.Path, "/_create/")
+	case http.MethodPost:
+		path := strings.TrimSuffix(req.URL.Path, "/")
+		return readOnlyEndpoints[path[strings.LastIndex(path, "/")+1:]]
+	}
+	return false
+}
+
+func retryBackoff(attempt int) time.Duration {
+	wait := 100 * time.Millisecond << attempt
+	return wait + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func waitForElasticsearch(es *elasticsearch.Client) error {
+	timeout := 2 * time.Minute
+	if value := getenv("ES_STARTUP_TIMEOUT", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid ES_STARTUP_TIMEOUT %q: must be a positive duration such as 2m", value)
+		}
+		timeout = parsed
+	}
+	deadline := time.Now().Add(timeout)
+	wait := time.Second
+	for {
+		_, err := clusterHealth(context.Background(), es, true)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("elasticsearch not ready after %s: %w", timeout, err)
+		}
+		log.Printf("waiting for elasticsearch: %v (retrying in %s)", err, wait)
+		time.Sleep(wait)
+		wait = min(wait*2, 30*time.Second)
+	}
+}
+
+type clusterHealthStatus struct {
+	ClusterName         string  `json:"cluster_name"`
+	Status              string  `json:"status"`
+	NumberOfNodes       int     `json:"number_of_nodes"`
+	ActiveShardsPercent float64 `json:"active_shards_percent_as_number"`
+	UnassignedShards    int     `json:"unassigned_shards"`
+}
+
+func clusterHealth(ctx context.Context, es *elasticsearch.Client, waitForYellow bool) (clusterHealthStatus, error) {
+	var health clusterHealthStatus
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	options := []func(*esapi.ClusterHealthRequest){es.Cluster.Health.WithContext(ctx)}
+	if waitForYellow {
+		options = append(options, es.Cluster.Health.WithWaitForStatus("yellow"), es.Cluster.Health.WithTimeout(4*time.Second))
+	}
+	res, err := es.Cluster.Health(options...)
+	if err != nil {
+		return health, err
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return health, fmt.Errorf("decode cluster health: %w", err)
+	}
+	// Health answers 408 when the wait times out, with the body still set.
+	if res.IsError() && res.StatusCode != http.StatusRequestTimeout {
+		return health, fmt.Errorf("cluster health response error: %s", res.Status())
+	}
+	if health.Status == "" || health.Status == "red" || (waitForYellow && res.StatusCode == http.StatusRequestTimeout) {
+		return health, fmt.Errorf("cluster status is %q", health.Status)
+	}
+	return health, nil
+}
+
+type outageKey struct{}
+
+func markOutage(ctx context.Context) {
+	if outage, ok := ctx.Value(outageKey{}).(*atomic.Bool); ok {
+		outage.Store(true)
+	}
+}
+
+func guardElasticsearch(breaker *circuitBreaker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if wait, open := breaker.retryAfter(); open {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "search is temporarily unavailable, try again shortly"})
+			return
+		}
+		outage := new(atomic.Bool)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), outageKey{}, outage))
+		c.Writer = &outageWriter{ResponseWriter: c.Writer, outage: outage, breaker: breaker}
+		c.Next()
+	}
+}
+
+type outageWriter struct {
+	gin.ResponseWriter
+	outage  *atomic.Bool
+	breaker *circuitBreaker
+}
+
+func (w *outageWriter) WriteHeader(code int) {
+	if code == http.StatusInternalServerError && w.outage.Load() {
+		wait, open := w.breaker.retryAfter()
+		if !open {
+			wait = time.Second
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		code = http.StatusServiceUnavailable
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// handleReadyz treats yellow as ready, since a single-node cluster never has
+// replicas assigned.
+func handleReadyz(es *elasticsearch.Client, breaker *circuitBreaker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health, err := clusterHealth(c.Request.Context(), es, false)
+		status := http.StatusOK
+		body := gin.H{"status": "ready", "circuit_breaker": breaker.state()}
+		if health.Status != "" {
+			body["elasticsearch"] = health
+		}
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			body["status"] = "unavailable"
+			body["error"] = err.Error()
+		}
+		c.JSON(status, body)
+	}
+}
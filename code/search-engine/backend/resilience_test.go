@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 2, cooldown: time.Hour}
+	breaker.arm()
+
+	breaker.record(false)
+	if !breaker.allow() || breaker.state() != "closed" {
+		t.Fatalf("expected the breaker to stay closed below the threshold, got %s", breaker.state())
+	}
+	breaker.record(false)
+	if breaker.allow() {
+		t.Fatalf("expected the breaker to reject requests once open")
+	}
+	if breaker.state() != "open" {
+		t.Fatalf("expected open, got %s", breaker.state())
+	}
+	if wait, open := breaker.retryAfter(); !open || wait < time.Minute {
+		t.Fatalf("expected a retry-after close to the cooldown, got %s", wait)
+	}
+}
+
+func TestCircuitBreakerIgnoresFailuresUntilArmed(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 1, cooldown: time.Hour}
+
+	breaker.record(false)
+	breaker.record(false)
+	if !breaker.allow() || breaker.state() != "closed" {
+		t.Fatalf("expected failures before arm to be ignored")
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		probeOK   bool
+		wantState string
+	}{
+		{name: "successful probe closes", probeOK: true, wantState: "closed"},
+		{name: "failed probe reopens", probeOK: false, wantState: "open"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			breaker := &circuitBreaker{threshold: 1, cooldown: time.Millisecond}
+			breaker.arm()
+			breaker.record(false)
+			time.Sleep(5 * time.Millisecond)
+
+			if !breaker.allow() {
+				t.Fatalf("expected one probe after the cooldown")
+			}
+			if breaker.allow() {
+				t.Fatalf("expected a second request to wait for the probe")
+			}
+
+			if !tc.probeOK {
+				breaker.cooldown = time.Hour
+			}
+			breaker.record(tc.probeOK)
+			if got := breaker.state(); got != tc.wantState {
+				t.Fatalf("expected %s, got %s", tc.wantState, got)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerReleaseFreesProbe(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 1, cooldown: time.Millisecond}
+	breaker.arm()
+	breaker.record(false)
+	time.Sleep(5 * time.Millisecond)
+
+	if !breaker.allow() {
+		t.Fatalf("expected a probe after the cooldown")
+	}
+	breaker.release()
+	if !breaker.allow() {
+		t.Fatalf("expected the probe slot to be free after release")
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{method: http.MethodGet, path: "/movies/_doc/1", want: true},
+		{method: http.MethodHead, path: "/movies", want: true},
+		{method: http.MethodPut, path: "/movies/_doc/1", want: true},
+		{method: http.MethodPut, path: "/movies/_create/1", want: false},
+		{method: http.MethodPost, path: "/movies/_search", want: true},
+		{method: http.MethodPost, path: "/movies/_count/", want: true},
+		{method: http.MethodPost, path: "/movies/_doc", want: false},
+		{method: http.MethodPost, path: "/_bulk", want: false},
+		{method: http.MethodDelete, path: "/movies/_doc/1", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if got := isIdempotent(req); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestESTransportRetries(t *testing.T) {
+	tests := []struct {
+		method    string
+		wantCalls int
+	}{
+		{method: http.MethodGet, wantCalls: 3},
+		{method: http.MethodDelete, wantCalls: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.method, func(t *testing.T) {
+			calls := 0
+			transport := &esTransport{
+				next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+					calls++
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader(""))}, nil
+				}),
+				maxRetries: 2,
+				breaker:    &circuitBreaker{threshold: 10, cooldown: time.Hour},
+			}
+
+			res, err := transport.RoundTrip(httptest.NewRequest(tc.method, "/movies/_doc/1", nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got %d", res.StatusCode)
+			}
+			if calls != tc.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tc.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestESTransportRejectsWhenOpen(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 1, cooldown: time.Hour}
+	breaker.arm()
+	breaker.record(false)
+	transport := &esTransport{
+		next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			t.Fatalf("expected no request while the breaker is open")
+			return nil, nil
+		}),
+		breaker: breaker,
+	}
+
+	if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/movies/_search", nil)); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected errCircuitOpen, got %v", err)
+	}
+}
+
+func TestESTransportTimeout(t *testing.T) {
+	var deadlines []bool
+	transport := &esTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			_, ok := req.Context().Deadline()
+			deadlines = append(deadlines, ok)
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+		}),
+		breaker: &circuitBreaker{threshold: 10, cooldown: time.Hour},
+		timeout: time.Minute,
+	}
+
+	res, err := transport.RoundTrip(httptest.NewRequest(http.MethodPut, "/movies/_doc/1", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body, err := io.ReadAll(res.Body); err != nil || string(body) != "{}" {
+		t.Fatalf("expected the body readable after RoundTrip, got %q %v", body, err)
+	}
+	res.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPut, "/movies/_doc/1", nil).WithContext(ctx)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deadlines) != 2 || !deadlines[0] || !deadlines[1] {
+		t.Fatalf("expected every call to carry a deadline, got %v", deadlines)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const reviewIndex = "reviews"
+
+type Review struct {
+	ID        string    `json:"id"`
+	MovieID   string    `json:"movie_id"`
+	Author    string    `json:"author" binding:"max=100"`
+	Rating    int       `json:"rating" binding:"required,min=1,max=10"`
+	Text      string    `json:"text" binding:"max=5000"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var reviewStatsMappings = map[string]interface{}{
+	"user_rating":  map[string]interface{}{"type": "float"},
+	"review_count": map[string]interface{}{"type": "integer"},
+}
+
+func ensureReviewIndex(ctx context.Context, es *elasticsearch.Client) error {
+	exists, err := es.Indices.Exists([]string{reviewIndex}, es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("check review index exists: %w", err)
+	}
+	exists.Body.Close()
+	if exists.StatusCode != http.StatusNotFound {
+		return nil
+	}
+
+	body, err := encodeBody(map[string]interface{}{
+		"settings": movieSettings(),
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"movie_id": map[string]interface{}{"type": "keyword"},
+				"author":   map[string]interface{}{"type": "keyword"},
+				"rating":   map[string]interface{}{"type": "integer"},
+				"text": map[string]interface{}{
+					"type":            "text",
+					"analyzer":        movieTextAnalyzer,
+					"search_analyzer": movieSearchAnalyzer,
+				},
+				"created_at": map[string]interface{}{"type": "date"},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.Indices.Create(reviewIndex, es.Indices.Create.WithBody(body), es.Indices.Create.WithContext(ctx))
+	return esCall(res, err, "create review index")
+}
+
+// refreshReviewStats recomputes rather than increments, which keeps the
+// numbers right after a failed write or a PUT.
+func refreshReviewStats(ctx context.Context, repo Repository, movieID string) (float64, int, error) {
+	var aggregate struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Average struct {
+				Value *float64 `json:"value"`
+			} `json:"average"`
+		} `json:"aggregations"`
+	}
+	err := repo.Search(ctx, reviewIndex, map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query":            map[string]interface{}{"term": map[string]interface{}{"movie_id": movieID}},
+		"aggs": map[string]interface{}{
+			"average": map[string]interface{}{"avg": map[string]interface{}{"field": "rating"}},
+		},
+	}, &aggregate)
+	if err != nil {
+		return 0, 0, fmt.Errorf("aggregate reviews: %w", err)
+	}
+
+	count := aggregate.Hits.Total.Value
+	average := 0.0
+	if aggregate.Aggregations.Average.Value != nil {
+		average = math.Round(*aggregate.Aggregations.Average.Value*10) / 10
+	}
+
+	var update bytes.Buffer
+	encoder := json.NewEncoder(&update)
+	encoder.Encode(map[string]interface{}{"update": map[string]interface{}{"_id": movieID, "retry_on_conflict": 3}})
+	encoder.Encode(map[string]interface{}{"doc": map[string]interface{}{"user_rating": average, "review_count": count}})
+	failed, _, err := repo.Bulk(ctx, movieIndex, &update)
+	if err != nil {
+		return 0, 0, fmt.Errorf("update review stats: %w", err)
+	}
+	if failed > 0 {
+		return 0, 0, fmt.Errorf("update review stats for %s failed", movieID)
+	}
+	return average, count, nil
+}
+
+// movieExists is false for soft-deleted movies too.
+func movieExists(ctx context.Context, es *elasticsearch.Client, id string) (bool, error) {
+	res, err := es.Get(movieIndex, id, es.Get.WithSourceIncludes("deleted"), es.Get.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		var doc struct {
+			Source map[string]interface{} `json:"_source"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+			return false, fmt.Errorf("decode movie: %w", err)
+		}
+		return !isDeleted(doc.Source), nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("movie exists response error: %s", res.String())
+}
+
+func handleCreateReview(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieID := c.Param("id")
+		var input Review
+		if err := c.ShouldBindJSON(&input); err != nil {
+			if !bodyTooLarge(c, err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		exists, err := movieExists(c.Request.Context(), es, movieID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+
+		input.ID = uuid.NewString()
+		input.MovieID = movieID
+		input.Author = strings.TrimSpace(input.Author)
+		input.CreatedAt = time.Now().UTC()
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(input); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode review"})
+			return
+		}
+		res, err := es.Index(reviewIndex, &buf,
+			es.Index.WithDocumentID(input.ID),
+			es.Index.WithRefresh("true"),
+			es.Index.WithContext(c.Request.Context()))
+		if err := esCall(res, err, "index review"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create review"})
+			return
+		}
+
+		if _, _, err := refreshReviewStats(c.Request.Context(), esRepository{es}, movieID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "review saved but the movie rating could not be updated"})
+			return
+		}
+		c.JSON(http.StatusCreated, input)
+	}
+}
+
+func handleListReviews(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := []map[string]interface{}{
+			{"term": map[string]interface{}{"movie_id": c.Param("id")}},
+		}
+		searchReviews(c, es, nil, filter, []map[string]interface{}{
+			{"created_at": map[string]interface{}{"order": "desc"}},
+		})
+	}
+}
+
+func handleSearchReviews(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var must, filter []map[string]interface{}
+		if query := strings.TrimSpace(c.Query("q")); query != "" {
+			must = append(must, map[string]interface{}{
+				"match": map[string]interface{}{"text": map[string]interface{}{"query": query}},
+			})
+		}
+		if movieID := c.Query("movie_id"); movieID != "" {
+			filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"movie_id": movieID}})
+		}
+		searchReviews(c, es, must, filter, []map[string]interface{}{
+			{"_score": map[string]interface{}{"order": "desc"}},
+			{"created_at": map[string]interface{}{"order": "desc"}},
+		})
+	}
+}
+
+func searchReviews(c *gin.Context, es *elasticsearch.Client, must, filter, sort []map[string]interface{}) {
+	page := parseIntWithDefault(c.Query("page"), 1)
+	pageSize := parseIntWithDefault(c.Query("pageSize"), 10)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 50 {
+		pageSize = 10
+	}
+
+	body, err := encodeBody(map[string]interface{}{
+		"from":  (page - 1) * pageSize,
+		"size":  pageSize,
+		"sort":  sort,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"must": must, "filter": filter}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode review query"})
+		return
+	}
+	res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(reviewIndex), es.Search.WithBody(body))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "review search failed"})
+		return
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "review search returned an error"})
+		return
+	}
+
+	var searchResult struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source Review `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode reviews"})
+		return
+	}
+
+	reviews := make([]Review, 0, len(searchResult.Hits.Hits))
+	for _, hit := range searchResult.Hits.Hits {
+		reviews = append(reviews, hit.Source)
+	}
+	totalHits := searchResult.Hits.Total.Value
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"pagination": Pagination{
+			Page:       page,
+			PageSize:   pageSize,
+			TotalHits:  totalHits,
+			TotalPages: (totalHits + pageSize - 1) / pageSize,
+		},
+	})
+}
+
+func handleDeleteReview(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieID, reviewID := c.Param("id"), c.Param("reviewId")
+		res, err := es.Get(reviewIndex, reviewID, es.Get.WithContext(c.Request.Context()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch review"})
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+			return
+		}
+		if res.IsError() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch review"})
+			return
+		}
+		var getResponse struct {
+			Source Review `json:"_source"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&getResponse); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode review"})
+			return
+		}
+		if getResponse.Source.MovieID != movieID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+			return
+		}
+
+		deleteRes, err := es.Delete(reviewIndex, reviewID,
+			es.Delete.WithRefresh("true"),
+			es.Delete.WithContext(c.Request.Context()))
+		if err := esCall(deleteRes, err, "delete review"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete review"})
+			return
+		}
+
+		if _, _, err := refreshReviewStats(c.Request.Context(), esRepository{es}, movieID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "review deleted but the movie rating could not be updated"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func deleteMovieReviews(ctx context.Context, es *elasticsearch.Client, movieID string) error {
+	body, err := encodeBody(map[string]interface{}{
+		"query": map[string]interface{}{"term": map[string]interface{}{"movie_id": movieID}},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := es.DeleteByQuery([]string{reviewIndex}, body,
+		es.DeleteByQuery.WithConflicts("proceed"),
+		es.DeleteByQuery.WithRefresh(true),
+		es.DeleteByQuery.WithContext(ctx))
+	return esCall(res, err, "delete movie reviews")
+}
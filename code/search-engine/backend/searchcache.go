@@ -0,0 +1,196 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchCache keeps recent search responses in memory, least recently used
+// out first. Writes purge it, so a TTL only has to cover changes made
+// elsewhere, like another replica.
+type searchCache struct {
+	ttl      time.Duration
+	capacity int
+
+	mu sync.Mutex
+	// generation counts purges, so a search that started before one is not stored after it.
+	generation uint64
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type cachedSearch struct {
+	key     string
+	body    map[string]json.RawMessage
+	page    int
+	hits    int
+	expires time.Time
+}
+
+func newSearchCache() (*searchCache, error) {
+	ttl := 30 * time.Second
+	if value := getenv("SEARCH_CACHE_TTL", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid SEARCH_CACHE_TTL %q: must be a duration such as 30s", value)
+		}
+		ttl = parsed
+	}
+	capacity := 1000
+	if value := getenv("SEARCH_CACHE_SIZE", ""); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("invalid SEARCH_CACHE_SIZE %q: must be a positive number of responses", value)
+		}
+		capacity = parsed
+	}
+	return &searchCache{ttl: ttl, capacity: capacity, order: list.New(), entries: map[string]*list.Element{}}, nil
+}
+
+// searchCacheKey sorts the parameters and drops empty ones, so equivalent searches share an entry.
+func searchCacheKey(c *gin.Context) string {
+	params := c.Request.URL.Query()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	key.WriteString(c.Request.URL.Path)
+	for _, name := range names {
+		values := make([]string, 0, len(params[name]))
+		for _, value := range params[name] {
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			key.WriteString("\x00" + name + "=" + value)
+		}
+	}
+	// The arms of an experiment rank differently.
+	if variant := c.GetString(experimentVariantKey); variant != "" {
+		key.WriteString("\x00\x00" + experimentName(c) + "=" + variant)
+	}
+	return key.String()
+}
+
+// cached serves a stored response when there is one. Cursor pages are not
+// cached, since each continues its own point in time.
+func (sc *searchCache) cached() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sc.ttl <= 0 || c.Query("paginate") == "cursor" || c.Query("cursor") != "" {
+			c.Next()
+			return
+		}
+		key := searchCacheKey(c)
+		entry, ok := sc.get(key)
+		recordCacheLookup("search", ok)
+		if ok {
+			body := make(map[string]json.RawMessage, len(entry.body)+1)
+			for field, value := range entry.body {
+				body[field] = value
+			}
+			// Clicks on a cached page still belong to this search.
+			if id := c.GetString(searchIDKey); id != "" {
+				body["search_id"], _ = json.Marshal(id)
+			}
+			c.Set(searchPageKey, entry.page)
+			c.Set(searchHitsKey, entry.hits)
+			c.Header("X-Cache", "HIT")
+			c.JSON(http.StatusOK, body)
+			c.Abort()
+			return
+		}
+
+		sc.mu.Lock()
+		generation := sc.generation
+		sc.mu.Unlock()
+		writer := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Header("X-Cache", "MISS")
+		c.Next()
+		if writer.Status() != http.StatusOK || c.GetBool(searchPartialKey) {
+			return
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(writer.body.Bytes(), &body); err != nil {
+			return
+		}
+		delete(body, "search_id")
+		sc.put(generation, &cachedSearch{
+			key:     key,
+			body:    body,
+			page:    c.GetInt(searchPageKey),
+			hits:    c.GetInt(searchHitsKey),
+			expires: time.Now().Add(sc.ttl),
+		})
+	}
+}
+
+func (sc *searchCache) get(key string) (*cachedSearch, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	element, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedSearch)
+	if time.Now().After(entry.expires) {
+		sc.order.Remove(element)
+		delete(sc.entries, key)
+		return nil, false
+	}
+	sc.order.MoveToFront(element)
+	return entry, true
+}
+
+func (sc *searchCache) put(generation uint64, entry *cachedSearch) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if generation != sc.generation {
+		return
+	}
+	if element, ok := sc.entries[entry.key]; ok {
+		element.Value = entry
+		sc.order.MoveToFront(element)
+		return
+	}
+	sc.entries[entry.key] = sc.order.PushFront(entry)
+	for sc.order.Len() > sc.capacity {
+		oldest := sc.order.Back()
+		sc.order.Remove(oldest)
+		delete(sc.entries, oldest.Value.(*cachedSearch).key)
+	}
+}
+
+func (sc *searchCache) purge() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.generation++
+	sc.order.Init()
+	sc.entries = map[string]*list.Element{}
+}
+
+// invalidates purges the cache after a write that succeeded.
+func (sc *searchCache) invalidates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() < http.StatusBadRequest {
+			sc.purge()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestSearchCache(capacity int) *searchCache {
+	sc, _ := newSearchCache()
+	sc.capacity = capacity
+	return sc
+}
+
+func TestSearchCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sc := newTestSearchCache(2)
+	searches, ids := 0, 0
+	router := gin.New()
+	// Stands in for logSearches, which hands every search a new id.
+	router.Use(func(c *gin.Context) {
+		ids++
+		c.Set(searchIDKey, fmt.Sprintf("search-%d", ids))
+	})
+	router.GET("/movies", sc.cached(), func(c *gin.Context) {
+		searches++
+		response := gin.H{"movies": []string{c.Query("q")}, "run": searches}
+		noteSearch(c, response, 1, 1)
+		c.JSON(http.StatusOK, response)
+	})
+	router.POST("/movies", sc.invalidates(), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	get := func(target string) (string, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return w.Header().Get("X-Cache"), body
+	}
+
+	if state, _ := get("/movies?q=heat&sort=rating"); state != "MISS" {
+		t.Fatalf("expected a miss, got %q", state)
+	}
+	state, body := get("/movies?sort=rating&q=%20heat&page=")
+	if state != "HIT" || searches != 1 {
+		t.Fatalf("expected the reordered query to hit, got %q after %d searches", state, searches)
+	}
+	if body["search_id"] != fmt.Sprintf("search-%d", ids) {
+		t.Fatalf("expected the hit to carry its own search id, got %v", body["search_id"])
+	}
+
+	if state, _ := get("/movies?q=heat&paginate=cursor"); state != "" {
+		t.Fatalf("expected cursor pages to bypass the cache, got %q", state)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/movies", nil))
+	if state, _ := get("/movies?q=heat&sort=rating"); state != "MISS" {
+		t.Fatalf("expected a write to purge the cache, got %q", state)
+	}
+
+	get("/movies?q=alien")
+	get("/movies?q=heat&sort=rating")
+	get("/movies?q=tenet")
+	if state, _ := get("/movies?q=alien"); state != "MISS" {
+		t.Fatalf("expected the least recently used entry evicted, got %q", state)
+	}
+	if state, _ := get("/movies?q=tenet"); state != "HIT" {
+		t.Fatalf("expected the newest entry kept, got %q", state)
+	}
+}
+
+func TestSearchCacheSkipsStaleGeneration(t *testing.T) {
+	sc := newTestSearchCache(10)
+	sc.mu.Lock()
+	generation := sc.generation
+	sc.mu.Unlock()
+	sc.purge()
+	sc.put(generation, &cachedSearch{key: "k", expires: time.Now().Add(time.Minute)})
+	if _, ok := sc.get("k"); ok {
+		t.Fatalf("expected a search that started before a purge not to be stored")
+	}
+}
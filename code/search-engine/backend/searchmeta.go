@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// searchPartialKey marks a response built from partial results, which the search cache skips.
+const searchPartialKey = "search_partial"
+
+// SearchMeta says whether a page of results is complete. A search that runs
+// past SEARCH_TIMEOUT, or loses some shards, answers with what it found.
+type SearchMeta struct {
+	Partial  bool           `json:"partial"`
+	TimedOut bool           `json:"timed_out"`
+	Shards   ShardStats     `json:"shards"`
+	Failures []ShardFailure `json:"failures,omitempty"`
+}
+
+type ShardStats struct {
+	Total      int `json:"total"`
+	Successful int `json:"successful"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+type ShardFailure struct {
+	Index  string `json:"index,omitempty"`
+	Shard  int    `json:"shard"`
+	Reason string `json:"reason"`
+}
+
+// searchShards is the part of a search response that reports on shards.
+type searchShards struct {
+	TimedOut bool `json:"timed_out"`
+	Shards   struct {
+		ShardStats
+		Failures []struct {
+			Index  string `json:"index"`
+			Shard  int    `json:"shard"`
+			Reason struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"reason"`
+		} `json:"failures"`
+	} `json:"_shards"`
+}
+
+func (s searchShards) meta() SearchMeta {
+	meta := SearchMeta{
+		Partial:  s.TimedOut || s.Shards.Failed > 0,
+		TimedOut: s.TimedOut,
+		Shards:   s.Shards.ShardStats,
+	}
+	for _, failure := range s.Shards.Failures {
+		reason := failure.Reason.Reason
+		if reason == "" {
+			reason = failure.Reason.Type
+		}
+		meta.Failures = append(meta.Failures, ShardFailure{Index: failure.Index, Shard: failure.Shard, Reason: reason})
+	}
+	return meta
+}
+
+// esTimeout spells a duration the way Elasticsearch reads one.
+func esTimeout(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var errInvalidSeedData = errors.New("invalid seed data")
+
+var seedSettings struct {
+	file     string
+	interval time.Duration
+	prune    bool
+}
+
+func loadSeed() error {
+	seedSettings.file = strings.TrimSpace(os.Getenv("SEED_FILE"))
+	seedSettings.interval = 0
+	if value := os.Getenv("SEED_SYNC_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Minute {
+			return fmt.Errorf("invalid SEED_SYNC_INTERVAL %q: must be a duration of at least 1m", value)
+		}
+		seedSettings.interval = interval
+	}
+	seedSettings.prune = os.Getenv("SEED_SYNC_PRUNE") == "true"
+	// Fail at startup rather than on the first sync.
+	_, err := seedData()
+	return err
+}
+
+// seedData reads and validates SEED_FILE, or returns the sample movies
+// without one. Every movie gets its seed id.
+func seedData() ([]Movie, error) {
+	movies := sampleMovies()
+	if seedSettings.file != "" {
+		var err error
+		if movies, err = readSeedFile(seedSettings.file); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidSeedData, err)
+		}
+	}
+	seen := map[string]bool{}
+	for i := range movies {
+		movie := &movies[i]
+		// The sample movies skip validation, so a MOVIE_GENRES list without their genres still starts.
+		if seedSettings.file != "" {
+			if err := checkSeedMovie(movie); err != nil {
+				return nil, fmt.Errorf("%w: movie %d (%q): %v", errInvalidSeedData, i+1, movie.Title, err)
+			}
+		}
+		movie.ID = seedID(*movie)
+		if seen[movie.ID] {
+			return nil, fmt.Errorf("%w: movie %d (%q) duplicates an earlier movie", errInvalidSeedData, i+1, movie.Title)
+		}
+		seen[movie.ID] = true
+		movie.normalizeCredits()
+	}
+	return movies, nil
+}
+
+func readSeedFile(path string) ([]Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open seed file: %w", err)
+	}
+	defer file.Close()
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return parseSeedJSON(file)
+	case ".csv":
+		return parseSeedCSV(file)
+	default:
+		return nil, fmt.Errorf("seed file must end in .json or .csv, got %q", ext)
+	}
+}
+
+func parseSeedJSON(r io.Reader) ([]Movie, error) {
+	var movies []Movie
+	if err := json.NewDecoder(r).Decode(&movies); err != nil {
+		return nil, fmt.Errorf("decode seed file: %w", err)
+	}
+	return movies, nil
+}
+
+// parseSeedCSV reads a header row naming the columns. List columns separate
+// items with |, and credits are written Name or Name: Role as in the UI.
+func parseSeedCSV(r io.Reader) ([]Movie, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read seed file header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("seed file has no title column")
+	}
+
+	var movies []Movie
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return movies, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read seed file: %w", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		movie := Movie{
+			ID:          field("id"),
+			Title:       field("title"),
+			Description: field("description"),
+			Genres:      splitSeedList(field("genres")),
+			PosterURL:   field("poster_url"),
+			Directors:   parseSeedCredits(field("directors")),
+			Cast:        parseSeedCredits(field("cast")),
+			Crew:        parseSeedCredits(field("crew")),
+			Providers:   splitSeedList(field("providers")),
+		}
+		if value := field("rating"); value != "" {
+			if movie.Rating, err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("seed file line %d: rating must be a number", line)
+			}
+		}
+		if value := field("release_year"); value != "" {
+			if movie.ReleaseYear, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("seed file line %d: release_year must be a year", line)
+			}
+		}
+		movies = append(movies, movie)
+	}
+}
+
+func splitSeedList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseSeedCredits(value string) []Person {
+	var people []Person
+	for _, item := range splitSeedList(value) {
+		name, role, _ := strings.Cut(item, ":")
+		people = append(people, Person{Name: strings.TrimSpace(name), Role: strings.TrimSpace(role)})
+	}
+	return people
+}
+
+func checkSeedMovie(movie *Movie) error {
+	if err := binding.Validator.ValidateStruct(movie); err != nil {
+		var invalid validator.ValidationErrors
+		if errors.As(err, &invalid) {
+			return fmt.Errorf("%s %s", fieldPath(invalid[0]), fieldMessage(invalid[0]))
+		}
+		return err
+	}
+	for field, message := range validateMovie(movie) {
+		return fmt.Errorf("%s %s", field, message)
+	}
+	return nil
+}
+
+// seedID keeps ids stable across syncs, so a sync updates the movies it
+// wrote before instead of adding copies. Ids from the file are prefixed too,
+// which keeps them apart from movies created through the API.
+func seedID(movie Movie) string {
+	if movie.ID != "" {
+		return "seed-" + movie.ID
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(movie.Title) + "\x00" + strconv.Itoa(movie.ReleaseYear)))
+	return "seed-" + hex.EncodeToString(sum[:8])
+}
+
+type seedResult struct {
+	Upserted int `json:"upserted"`
+	Failed   int `json:"failed"`
+	Deleted  int `json:"deleted"`
+}
+
+type seeder struct {
+	es       *elasticsearch.Client
+	reindex  *reindexer
+	searches *searchCache
+	// mu keeps the periodic job and the endpoint from syncing at once.
+	mu sync.Mutex
+}
+
+func newSeeder(es *elasticsearch.Client, reindex *reindexer, searches *searchCache) *seeder {
+	s := &seeder{es: es, reindex: reindex, searches: searches}
+	if seedSettings.interval > 0 {
+		go s.run()
+	}
+	return s
+}
+
+func (s *seeder) run() {
+	ticker := time.NewTicker(seedSettings.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.reindex.running() {
+			log.Printf("seed sync skipped while a reindex runs")
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		result, err := s.sync(ctx, seedSettings.prune)
+		cancel()
+		s.searches.purge()
+		if err != nil {
+			log.Printf("seed sync: %v", err)
+			continue
+		}
+		log.Printf("seed sync: %d upserted, %d failed, %d deleted", result.Upserted, result.Failed, result.Deleted)
+	}
+}
+
+// sync writes every seed movie, keeping the review stats of movies already
+// there. With prune, movies missing from the seed data are deleted along with
+// their reviews.
+func (s *seeder) sync(ctx context.Context, prune bool) (seedResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result seedResult
+	movies, err := seedData()
+	if err != nil {
+		return result, err
+	}
+	failed, _, err := upsertMovies(ctx, s.es, movies, true)
+	if err != nil {
+		return result, err
+	}
+	result.Upserted = len(movies) - failed
+	result.Failed = failed
+	if !prune {
+		return result, nil
+	}
+
+	ids := make([]string, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	if result.Deleted, err = deleteByQuery(ctx, s.es, movieIndex, map[string]interface{}{
+		"bool": map[string]interface{}{"must_not": []map[string]interface{}{{"ids": map[string]interface{}{"values": ids}}}},
+	}); err != nil {
+		return result, err
+	}
+	_, err = deleteByQuery(ctx, s.es, reviewIndex, map[string]interface{}{
+		"bool": map[string]interface{}{"must_not": []map[string]interface{}{{"terms": map[string]interface{}{"movie_id": ids}}}},
+	})
+	return result, err
+}
+
+func deleteByQuery(ctx context.Context, es *elasticsearch.Client, index string, query map[string]interface{}) (int, error) {
+	body, err := encodeBody(map[string]interface{}{"query": query})
+	if err != nil {
+		return 0, err
+	}
+	res, err := es.DeleteByQuery([]string{index}, body,
+		es.DeleteByQuery.WithConflicts("proceed"),
+		es.DeleteByQuery.WithRefresh(true),
+		es.DeleteByQuery.WithContext(ctx))
+	if err := checkResponse(res, err, "delete from "+index); err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	var response struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("decode delete by query: %w", err)
+	}
+	return response.Deleted, nil
+}
+
+// handleSeed syncs the seed data now, even when the index already has movies.
+func handleSeed(s *seeder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := s.sync(c.Request.Context(), c.Query("prune") == "true")
+		if errors.Is(err, errInvalidSeedData) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("seed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to seed movies", "upserted": result.Upserted})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
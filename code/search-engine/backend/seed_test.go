@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSeedCSV(t *testing.T) {
+	input := strings.Join([]string{
+		"title,release_year,rating,genres,directors,cast",
+		`Heat,1995,8.3,Crime | Thriller,Michael Mann,"Al Pacino: Vincent Hanna|Robert De Niro: Neil McCauley"`,
+		"Alien,1979,,Horror,,",
+	}, "\n")
+	movies, err := parseSeedCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(movies) != 2 {
+		t.Fatalf("expected 2 movies, got %d", len(movies))
+	}
+	heat := movies[0]
+	if heat.Title != "Heat" || heat.ReleaseYear != 1995 || heat.Rating != 8.3 {
+		t.Fatalf("unexpected movie %+v", heat)
+	}
+	if strings.Join(heat.Genres, ",") != "Crime,Thriller" {
+		t.Fatalf("expected two genres, got %q", heat.Genres)
+	}
+	if len(heat.Cast) != 2 || heat.Cast[1] != (Person{Name: "Robert De Niro", Role: "Neil McCauley"}) {
+		t.Fatalf("unexpected cast %+v", heat.Cast)
+	}
+	if len(heat.Directors) != 1 || heat.Directors[0].Role != "" {
+		t.Fatalf("unexpected directors %+v", heat.Directors)
+	}
+
+	if _, err := parseSeedCSV(strings.NewReader("title,rating\nHeat,great\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a rating error on line 2, got %v", err)
+	}
+}
+
+func TestSeedData(t *testing.T) {
+	defer func() { seedSettings.file = "" }()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		wantTitle string
+		wantErr   string
+	}{
+		{name: "sample movies", wantTitle: "Inception"},
+		{
+			name:      "json file",
+			file:      "movies.json",
+			content:   `[{"id":"heat","title":"Heat","release_year":1995},{"title":"Alien","genres":["Horror"]}]`,
+			wantTitle: "Heat",
+		},
+		{name: "unknown extension", file: "movies.txt", content: "Heat", wantErr: "must end in .json or .csv"},
+		{name: "invalid movie", file: "invalid.json", content: `[{"title":"Heat","release_year":1700}]`, wantErr: "release_year must be between"},
+		{name: "missing title", file: "untitled.csv", content: "title,release_year\n,1995\n", wantErr: "title is required"},
+		{name: "duplicates", file: "twice.json", content: `[{"title":"Heat","release_year":1995},{"title":"heat","release_year":1995}]`, wantErr: "duplicates an earlier movie"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			seedSettings.file = ""
+			if tc.file != "" {
+				seedSettings.file = filepath.Join(dir, tc.file)
+				if err := os.WriteFile(seedSettings.file, []byte(tc.content), 0o644); err != nil {
+					t.Fatalf("write seed file: %v", err)
+				}
+			}
+			movies, err := seedData()
+			if tc.wantErr != "" {
+				if !errors.Is(err, errInvalidSeedData) || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("seed data: %v", err)
+			}
+			if movies[0].Title != tc.wantTitle {
+				t.Fatalf("expected %s first, got %s", tc.wantTitle, movies[0].Title)
+			}
+			for _, movie := range movies {
+				if !strings.HasPrefix(movie.ID, "seed-") || movie.Cast == nil {
+					t.Fatalf("expected a seed id and normalized credits, got %+v", movie)
+				}
+			}
+			again, _ := seedData()
+			if again[len(again)-1].ID != movies[len(movies)-1].ID {
+				t.Fatalf("expected stable ids, got %s and %s", movies[len(movies)-1].ID, again[len(again)-1].ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	embeddingField = "description_embedding"
+
+	// maxVectorWindow bounds how deep semantic and hybrid results go, since
+	// every page re-runs kNN over the whole window.
+	maxVectorWindow = 1000
+	minVectorWindow = 50
+	// rrfRankConstant is the k in 1/(k + rank), the usual RRF default.
+	rrfRankConstant = 60
+	embedBatchSize  = 32
+)
+
+var movieSourceExcludes = []string{embeddingField}
+
+type embeddingClient struct {
+	url        string
+	apiKey     string
+	model      string
+	dimensions int
+	// sendDimensions is set when EMBEDDINGS_DIMENSIONS asked the provider
+	// to shorten its vectors.
+	sendDimensions bool
+	client         *http.Client
+}
+
+var embedder *embeddingClient
+
+func loadEmbeddings() error {
+	url := strings.TrimRight(os.Getenv("EMBEDDINGS_URL"), "/")
+	if url == "" {
+		return nil
+	}
+	if searchEngine == engineOpenSearch {
+		return fmt.Errorf("semantic search needs Elasticsearch: OpenSearch has no dense_vector field or top-level knn search")
+	}
+	client := &embeddingClient{
+		url:    url,
+		apiKey: os.Getenv("EMBEDDINGS_API_KEY"),
+		model:  getenv("EMBEDDINGS_MODEL", "text-embedding-3-small"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if value := os.Getenv("EMBEDDINGS_DIMENSIONS"); value != "" {
+		dimensions, err := strconv.Atoi(value)
+		if err != nil || dimensions < 1 {
+			return fmt.Errorf("invalid EMBEDDINGS_DIMENSIONS %q: must be a positive integer", value)
+		}
+		client.dimensions, client.sendDimensions = dimensions, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	vectors, err := client.embed(ctx, []string{"dimension probe"})
+	if err != nil {
+		return fmt.Errorf("probe embeddings provider: %w", err)
+	}
+	if client.sendDimensions && len(vectors[0]) != client.dimensions {
+		return fmt.Errorf("provider returned %d dimensions, EMBEDDINGS_DIMENSIONS is %d", len(vectors[0]), client.dimensions)
+	}
+	client.dimensions = len(vectors[0])
+	embedder = client
+	log.Printf("semantic search enabled with %s (%d dimensions)", client.model, client.dimensions)
+	return nil
+}
+
+func (e *embeddingClient) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	request := map[string]interface{}{"model": e.model, "input": texts}
+	if e.sendDimensions {
+		request["dimensions"] = e.dimensions
+	}
+	body, err := encodeBody(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url+"/embeddings", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var buf bytes.Buffer
+		buf.ReadFrom(res.Body)
+		return nil, fmt.Errorf("embeddings provider returned %s: %s", res.Status, strings.TrimSpace(buf.String()))
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decode embeddings: %w", err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings provider returned %d vectors for %d inputs", len(response.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range response.Data {
+		if item.Index < 0 || item.Index >= len(texts) || len(item.Embedding) == 0 {
+			return nil, errors.New("embeddings provider returned a malformed vector")
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+func embeddingMapping() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "dense_vector",
+		"dims":       embedder.dimensions,
+		"index":      true,
+		"similarity": "cosine",
+	}
+}
+
+func embeddingText(title, description string) string {
+	return strings.TrimSpace(title + ". " + description)
+}
+
+// movieEmbedding logs a failure rather than failing the write; the backfill
+// endpoint catches up later.
+func movieEmbedding(movie Movie) []float32 {
+	if embedder == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	vectors, err := embedder.embed(ctx, []string{embeddingText(movie.Title, movie.Description)})
+	if err != nil {
+		log.Printf("embed movie %s: %v", movie.ID, err)
+		return nil
+	}
+	return vectors[0]
+}
+
+func vectorWindow(from, size int) (int, error) {
+	window := from + size
+	if window > maxVectorWindow {
+		return 0, fmt.Errorf("semantic and hybrid results stop at %d; narrow the search", maxVectorWindow)
+	}
+	if window < minVectorWindow {
+		window = minVectorWindow
+	}
+	return window, nil
+}
+
+func knnClause(vector []float32, window int, filter []map[string]interface{}) map[string]interface{} {
+	numCandidates := window * 2
+	if numCandidates < 100 {
+		numCandidates = 100
+	}
+	knn := map[string]interface{}{
+		"field":          embeddingField,
+		"query_vector":   vector,
+		"k":              window,
+		"num_candidates": numCandidates,
+	}
+	if len(filter) > 0 {
+		knn["filter"] = filter
+	}
+	return knn
+}
+
+type searchHit struct {
+	ID     string                 `json:"_id"`
+	Source map[string]interface{} `json:"_source"`
+}
+
+type searchHits struct {
+	Total struct {
+		Value int `json:"value"`
+	} `json:"total"`
+	Hits []searchHit `json:"hits"`
+}
+
+// handleVectorSearch fuses rankings itself because the rrf ranker is not
+// available on every version and license.
+func handleVectorSearch(c *gin.Context, repo Repository, mode, query string, keywordQuery map[string]interface{},
+	filter []map[string]interface{}, page, pageSize int) {
+	from := (page - 1) * pageSize
+	window, err := vectorWindow(from, pageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vectors, err := embedder.embed(c.Request.Context(), []string{query})
+	if err != nil {
+		log.Printf("embed query: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "embeddings provider is unavailable"})
+		return
+	}
+	knn := knnClause(vectors[0], window, filter)
+	source := map[string]interface{}{"excludes": movieSourceExcludes}
+
+	var hits []searchHit
+	var totalHits int
+	if mode == "semantic" {
+		var searchResult struct {
+			Hits searchHits `json:"hits"`
+		}
+		body := map[string]interface{}{"knn": knn, "from": from, "size": pageSize, "_source": source}
+		if err := repo.Search(c.Request.Context(), movieIndex, body, &searchResult); err != nil {
+			log.Printf("semantic search: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+		hits, totalHits = searchResult.Hits.Hits, searchResult.Hits.Total.Value
+	} else {
+		responses, err := repo.MultiSearch(c.Request.Context(), []indexSearch{
+			{Index: movieIndex, Body: map[string]interface{}{"query": keywordQuery, "size": window, "_source": source}},
+			{Index: movieIndex, Body: map[string]interface{}{"knn": knn, "size": window, "_source": source}},
+		})
+		if err != nil {
+			log.Printf("hybrid search: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+		rankings := make([][]searchHit, 0, len(responses))
+		for _, raw := range responses {
+			var response struct {
+				Hits  searchHits      `json:"hits"`
+				Error json.RawMessage `json:"error"`
+			}
+			if err := json.Unmarshal(raw, &response); err != nil || len(response.Error) > 0 {
+				log.Printf("hybrid search: %s", raw)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "search returned an error"})
+				return
+			}
+			rankings = append(rankings, response.Hits.Hits)
+		}
+		fused := fuseRankings(rankings...)
+		totalHits = len(fused)
+		if from < len(fused) {
+			end := from + pageSize
+			if end > len(fused) {
+				end = len(fused)
+			}
+			hits = fused[from:end]
+		}
+	}
+
+	movies := make([]Movie, 0, len(hits))
+	for _, hit := range hits {
+		movie := mapToMovie(hit.Source)
+		movie.ID = hit.ID
+		movies = append(movies, movie)
+	}
+	response := gin.H{
+		"mode":   mode,
+		"movies": movies,
+		"pagination": Pagination{
+			Page:       page,
+			PageSize:   pageSize,
+			TotalHits:  totalHits,
+			TotalPages: (totalHits + pageSize - 1) / pageSize,
+		},
+	}
+	noteSearch(c, response, page, totalHits)
+	c.JSON(http.StatusOK, response)
+}
+
+// fuseRankings is reciprocal rank fusion: each hit scores 1/(60 + rank) in
+// every list it appears in.
+func fuseRankings(rankings ...[]searchHit) []searchHit {
+	scores := map[string]float64{}
+	var order []searchHit
+	for _, ranking := range rankings {
+		for rank, hit := range ranking {
+			if _, seen := scores[hit.ID]; !seen {
+				order = append(order, hit)
+			}
+			scores[hit.ID] += 1 / float64(rrfRankConstant+rank+1)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i].ID] > scores[order[j].ID]
+	})
+	return order
+}
+
+func handleBackfillEmbeddings(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if embedder == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "semantic search is not enabled; set EMBEDDINGS_URL"})
+			return
+		}
+		limit := parseIntWithDefault(c.Query("limit"), 100)
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+
+		body, err := encodeBody(map[string]interface{}{
+			"size":             limit,
+			"track_total_hits": true,
+			"_source":          []string{"title", "description"},
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": embeddingField}},
+				},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode backfill query"})
+			return
+		}
+		res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(movieIndex), es.Search.WithBody(body))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "backfill search failed"})
+			return
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "backfill search returned an error"})
+			return
+		}
+		var searchResult struct {
+			Hits searchHits `json:"hits"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode backfill search"})
+			return
+		}
+
+		hits := searchResult.Hits.Hits
+		updated := 0
+		for start := 0; start < len(hits); start += embedBatchSize {
+			end := start + embedBatchSize
+			if end > len(hits) {
+				end = len(hits)
+			}
+			batch := hits[start:end]
+			texts := make([]string, len(batch))
+			for i, hit := range batch {
+				title, _ := hit.Source["title"].(string)
+				description, _ := hit.Source["description"].(string)
+				texts[i] = embeddingText(title, description)
+			}
+			vectors, err := embedder.embed(c.Request.Context(), texts)
+			if err != nil {
+				log.Printf("backfill embeddings: %v", err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "embeddings provider is unavailable", "updated": updated})
+				return
+			}
+
+			var bulk bytes.Buffer
+			encoder := json.NewEncoder(&bulk)
+			for i, hit := range batch {
+				encoder.Encode(map[string]interface{}{"update": map[string]interface{}{"_id": hit.ID}})
+				encoder.Encode(map[string]interface{}{"doc": map[string]interface{}{embeddingField: vectors[i]}})
+			}
+			failed, _, err := esRepository{es}.Bulk(c.Request.Context(), movieIndex, &bulk)
+			if err != nil {
+				log.Printf("backfill embeddings: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store embeddings", "updated": updated})
+				return
+			}
+			updated += len(batch) - failed
+		}
+
+		c.JSON(http.StatusOK, gin.H{"updated": updated, "remaining": searchResult.Hits.Total.Value - updated})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request deadlines bound every Elasticsearch call a handler makes. Admin
+// endpoints get longer, since exports and imports run through the whole catalog.
+// Searches tell Elasticsearch to stop early, so results come back before the
+// request's deadline, even if incomplete.
+var timeouts = struct {
+	request  time.Duration
+	admin    time.Duration
+	search   time.Duration
+	shutdown time.Duration
+}{
+	request:  10 * time.Second,
+	admin:    10 * time.Minute,
+	search:   5 * time.Second,
+	shutdown: 20 * time.Second,
+}
+
+func loadTimeouts() error {
+	for key, target := range map[string]*time.Duration{
+		"REQUEST_TIMEOUT":       &timeouts.request,
+		"ADMIN_REQUEST_TIMEOUT": &timeouts.admin,
+		"SEARCH_TIMEOUT":        &timeouts.search,
+		"SHUTDOWN_TIMEOUT":      &timeouts.shutdown,
+	} {
+		value := getenv(key, "")
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid %s %q: must be a positive duration such as 10s", key, value)
+		}
+		*target = parsed
+	}
+	if timeouts.search >= timeouts.request {
+		return fmt.Errorf("SEARCH_TIMEOUT (%s) must be shorter than REQUEST_TIMEOUT (%s)", timeouts.search, timeouts.request)
+	}
+	return nil
+}
+
+// requestTimeout gives each request a deadline. A handler that fails because
+// the deadline passed answers 504 rather than 500. WebSockets stay open as long
+// as the client keeps them busy, so they get none.
+func requestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/ws/") {
+			c.Next()
+			return
+		}
+		timeout := timeouts.request
+		if strings.HasPrefix(c.Request.URL.Path, "/api/admin/") {
+			timeout = timeouts.admin
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &deadlineWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Next()
+	}
+}
+
+type deadlineWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *deadlineWriter) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// runServer serves until SIGINT or SIGTERM, then lets requests in flight
+// finish for up to SHUTDOWN_TIMEOUT before running stop.
+func runServer(handler http.Handler, addr string, stop func()) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+	log.Printf("listening on %s", addr)
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for requests in flight", timeouts.shutdown)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), timeouts.shutdown)
+	defer cancelShutdown()
+	err := server.Shutdown(shutdownCtx)
+	stop()
+	if err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
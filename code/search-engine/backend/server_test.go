@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(request, admin time.Duration) { timeouts.request, timeouts.admin = request, admin }(timeouts.request, timeouts.admin)
+	timeouts.request, timeouts.admin = 10*time.Millisecond, time.Hour
+
+	router := gin.New()
+	router.Use(requestTimeout())
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search movies"})
+		case <-time.After(50 * time.Millisecond):
+			c.Status(http.StatusOK)
+		}
+	}
+	router.GET("/api/movies", slow)
+	router.GET("/api/admin/export", slow)
+	router.GET("/api/genres", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list genres"})
+	})
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{target: "/api/movies", wantStatus: http.StatusGatewayTimeout},
+		{target: "/api/admin/export", wantStatus: http.StatusOK},
+		{target: "/api/genres", wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestLoadTimeoutsSearchWithinRequest(t *testing.T) {
+	defer func(request, search time.Duration) { timeouts.request, timeouts.search = request, search }(timeouts.request, timeouts.search)
+
+	t.Setenv("REQUEST_TIMEOUT", "3s")
+	t.Setenv("SEARCH_TIMEOUT", "3s")
+	if err := loadTimeouts(); err == nil {
+		t.Fatalf("expected a search timeout as long as the request's to be rejected")
+	}
+	t.Setenv("SEARCH_TIMEOUT", "1500ms")
+	if err := loadTimeouts(); err != nil || esTimeout(timeouts.search) != "1500ms" {
+		t.Fatalf("expected a 1500ms search timeout, got %s (%v)", timeouts.search, err)
+	}
+}
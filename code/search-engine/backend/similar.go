@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSimilarMovies = 5
+	maxSimilarMovies     = 20
+)
+
+func handleSimilarMovies(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		size := parseIntWithDefault(c.Query("size"), defaultSimilarMovies)
+		if size <= 0 || size > maxSimilarMovies {
+			size = defaultSimilarMovies
+		}
+
+		exists, err := movieExists(c.Request.Context(), es, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+
+		body, err := encodeBody(map[string]interface{}{
+			"size":    size,
+			"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must": map[string]interface{}{
+						"more_like_this": map[string]interface{}{
+							"fields": []string{"title", "description", "genres"},
+							"like":   []map[string]interface{}{{"_index": movieIndex, "_id": id}},
+							// The catalogue is small, so terms that appear
+							// once are still worth matching on.
+							"min_term_freq":        1,
+							"min_doc_freq":         1,
+							"max_query_terms":      25,
+							"minimum_should_match": "10%",
+						},
+					},
+					"must_not": map[string]interface{}{
+						"ids": map[string]interface{}{"values": []string{id}},
+					},
+					"filter": notDeleted(),
+				},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode similar query"})
+			return
+		}
+
+		res, err := es.Search(
+			es.Search.WithContext(c.Request.Context()),
+			es.Search.WithIndex(movieIndex),
+			es.Search.WithBody(body),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "similar request failed"})
+			return
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "similar returned an error"})
+			return
+		}
+
+		var searchResult struct {
+			Hits struct {
+				Hits []struct {
+					ID     string                 `json:"_id"`
+					Source map[string]interface{} `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode similar movies"})
+			return
+		}
+
+		movies := make([]Movie, 0, len(searchResult.Hits.Hits))
+		for _, hit := range searchResult.Hits.Hits {
+			movie := mapToMovie(hit.Source)
+			movie.ID = hit.ID
+			movies = append(movies, movie)
+		}
+		c.JSON(http.StatusOK, gin.H{"movies": movies})
+	}
+}
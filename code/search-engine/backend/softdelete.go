@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const purgePageSize = 500
+
+var softDeleteMappings = map[string]interface{}{
+	"deleted":    map[string]interface{}{"type": "boolean"},
+	"deleted_at": map[string]interface{}{"type": "date"},
+}
+
+// notDeleted keeps soft-deleted movies out of a search. Every movie query filters with it.
+func notDeleted() map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": map[string]interface{}{"term": map[string]interface{}{"deleted": true}},
+		},
+	}
+}
+
+// withoutDeleted wraps a query so it skips soft-deleted movies.
+func withoutDeleted(query map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"must": query, "filter": notDeleted()},
+	}
+}
+
+func isDeleted(source map[string]interface{}) bool {
+	deleted, _ := source["deleted"].(bool)
+	return deleted
+}
+
+// setDeleted flips the flag in place, keeping the rest of the document and its embedding.
+func setDeleted(ctx context.Context, repo Repository, id string, deleted bool) error {
+	doc := map[string]interface{}{"deleted": deleted, "deleted_at": nil}
+	if deleted {
+		doc["deleted_at"] = time.Now().UTC()
+	}
+	var update bytes.Buffer
+	encoder := json.NewEncoder(&update)
+	encoder.Encode(map[string]interface{}{"update": map[string]interface{}{"_id": id, "retry_on_conflict": 3}})
+	encoder.Encode(map[string]interface{}{"doc": doc})
+	failed, _, err := repo.Bulk(ctx, movieIndex, &update)
+	if err != nil {
+		return fmt.Errorf("mark movie %s deleted=%t: %w", id, deleted, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("mark movie %s deleted=%t failed", id, deleted)
+	}
+	return nil
+}
+
+// handleDeleteMovie soft-deletes: the movie and its reviews stay stored until
+// purged, so POST /api/movies/:id/restore can bring them back.
+func handleDeleteMovie(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		source, err := repo.Get(c.Request.Context(), movieIndex, id)
+		if errors.Is(err, errDocumentNotFound) || err == nil && isDeleted(source) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+		if err == nil {
+			err = setDeleted(c.Request.Context(), repo, id, true)
+		}
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete movie"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func handleRestoreMovie(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		source, err := repo.Get(c.Request.Context(), movieIndex, id)
+		if errors.Is(err, errDocumentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+		if err == nil && isDeleted(source) {
+			err = setDeleted(c.Request.Context(), repo, id, false)
+		}
+		if err != nil {
+			log.Printf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore movie"})
+			return
+		}
+		movie := mapToMovie(source)
+		movie.ID = id
+		c.JSON(http.StatusOK, movie)
+	}
+}
+
+// handlePurgeMovies deletes soft-deleted movies and their reviews for good.
+// older_than_days keeps recent deletions around for a while longer.
+func handlePurgeMovies(repo Repository, deleteReviews func(ctx context.Context, movieID string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("older_than_days", "0"))
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than_days must be a whole number of days"})
+			return
+		}
+		cutoff := time.Now().UTC().AddDate(0, 0, -days)
+		ctx := c.Request.Context()
+
+		purged := 0
+		for {
+			var result struct {
+				Hits struct {
+					Hits []struct {
+						ID string `json:"_id"`
+					} `json:"hits"`
+				} `json:"hits"`
+			}
+			err := repo.Search(ctx, movieIndex, map[string]interface{}{
+				"size":    purgePageSize,
+				"_source": false,
+				"query": map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+					{"term": map[string]interface{}{"deleted": true}},
+					{"range": map[string]interface{}{"deleted_at": map[string]interface{}{"lte": cutoff}}},
+				}}},
+			}, &result)
+			if err != nil {
+				log.Printf("purge movies: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "purge failed", "purged": purged})
+				return
+			}
+			for _, hit := range result.Hits.Hits {
+				if err := repo.Delete(ctx, movieIndex, hit.ID); err != nil && !errors.Is(err, errDocumentNotFound) {
+					log.Printf("purge movie %s: %v", hit.ID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "purge failed", "purged": purged})
+					return
+				}
+				if err := deleteReviews(ctx, hit.ID); err != nil {
+					log.Printf("movie %s purged but its reviews were not: %v", hit.ID, err)
+				}
+				purged++
+			}
+			// Purged movies drop out of the next search, so it starts over.
+			if len(result.Hits.Hits) < purgePageSize {
+				break
+			}
+		}
+		log.Printf("purged %d deleted movies", purged)
+		c.JSON(http.StatusOK, gin.H{"purged": purged})
+	}
+}
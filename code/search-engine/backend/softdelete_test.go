@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleDeleteAndRestoreMovie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.docs[movieIndex] = map[string]map[string]interface{}{"m1": {"title": "Heat"}}
+
+	w := serve(handleDeleteMovie(repo), http.MethodDelete, "/movies/:id", "/movies/m1", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	stored, ok := repo.docs[movieIndex]["m1"]
+	if !ok || stored["deleted"] != true || stored["deleted_at"] == nil {
+		t.Fatalf("expected m1 kept and flagged deleted, got %v", stored)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler gin.HandlerFunc
+		method  string
+		body    string
+	}{
+		{name: "get", handler: handleGetMovie(repo), method: http.MethodGet},
+		{name: "delete again", handler: handleDeleteMovie(repo), method: http.MethodDelete},
+		{name: "update", handler: handleUpdateMovie(repo), method: http.MethodPut, body: `{"title":"Heat"}`},
+	} {
+		w := serve(tc.handler, tc.method, "/movies/:id", "/movies/m1", tc.body)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status 404, got %d: %s", tc.name, w.Code, w.Body.String())
+		}
+	}
+
+	w = serve(handleRestoreMovie(repo), http.MethodPost, "/movies/:id/restore", "/movies/m1/restore", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var movie Movie
+	if err := json.Unmarshal(w.Body.Bytes(), &movie); err != nil {
+		t.Fatalf("decode movie: %v", err)
+	}
+	if movie.ID != "m1" || movie.Title != "Heat" || repo.docs[movieIndex]["m1"]["deleted"] != false {
+		t.Fatalf("expected m1 restored, got %+v and %v", movie, repo.docs[movieIndex]["m1"])
+	}
+
+	w = serve(handleRestoreMovie(repo), http.MethodPost, "/movies/:id/restore", "/movies/missing/restore", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for a missing movie, got %d", w.Code)
+	}
+}
+
+func TestHandlePurgeMovies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newMockRepository()
+	repo.docs[movieIndex] = map[string]map[string]interface{}{
+		"m1": {"title": "Heat", "deleted": true},
+		"m2": {"title": "Ronin"},
+	}
+	repo.search = func(index string, body map[string]interface{}) (string, error) {
+		if _, ok := repo.docs[movieIndex]["m1"]; !ok {
+			return `{"hits":{"hits":[]}}`, nil
+		}
+		return `{"hits":{"hits":[{"_id":"m1"}]}}`, nil
+	}
+	var deletedReviews []string
+	deleteReviews := func(ctx context.Context, movieID string) error {
+		deletedReviews = append(deletedReviews, movieID)
+		return nil
+	}
+
+	w := serve(handlePurgeMovies(repo, deleteReviews), http.MethodPost, "/purge", "/purge?older_than_days=30", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != `{"purged":1}` {
+		t.Fatalf("expected one movie purged, got %s", w.Body.String())
+	}
+	if _, ok := repo.docs[movieIndex]["m1"]; ok {
+		t.Fatalf("expected m1 purged")
+	}
+	if _, ok := repo.docs[movieIndex]["m2"]; !ok {
+		t.Fatalf("expected m2 kept")
+	}
+	if len(deletedReviews) != 1 || deletedReviews[0] != "m1" {
+		t.Fatalf("expected the reviews of m1 deleted, got %v", deletedReviews)
+	}
+
+	w = serve(handlePurgeMovies(repo, deleteReviews), http.MethodPost, "/purge", "/purge?older_than_days=soon", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errMovieNotFound = errors.New("movie not found")
+
+type MovieStore interface {
+	GetMovie(ctx context.Context, id string) (Movie, error)
+	PutMovie(ctx context.Context, movie Movie) error
+	DeleteMovie(ctx context.Context, id string) error
+}
+
+type MovieQuery struct {
+	Text      string
+	Person    string
+	Genres    []string
+	Providers []string
+	SortField string
+	Order     string
+	Fuzziness string
+	From      int
+	Size      int
+}
+
+type MovieSearcher interface {
+	SearchMovies(ctx context.Context, query MovieQuery) ([]Movie, int, error)
+	SuggestTitles(ctx context.Context, prefix string, size int) ([]Suggestion, error)
+}
+
+func handleStoreSearchMovies(searcher MovieSearcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		page, pageSize := pageParams(c)
+		if c.Query("cursor") != "" || c.DefaultQuery("paginate", "page") != "page" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor pagination needs SEARCH_BACKEND=elasticsearch"})
+			return
+		}
+		if mode := c.DefaultQuery("mode", "keyword"); mode != "keyword" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "semantic search is not enabled on this server"})
+			return
+		}
+		field, order, err := resolveSort(c.Query("sort"), c.Query("order"), query != "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fuzziness, ok := parseFuzziness(c.DefaultQuery("fuzziness", defaultFuzziness))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fuzziness must be AUTO, 0, 1, or 2"})
+			return
+		}
+
+		movies, totalHits, err := searcher.SearchMovies(c.Request.Context(), MovieQuery{
+			Text:      query,
+			Person:    strings.TrimSpace(c.Query("person")),
+			Genres:    queryGenres(c),
+			Providers: queryProviders(c),
+			SortField: field,
+			Order:     order,
+			Fuzziness: fuzziness,
+			From:      (page - 1) * pageSize,
+			Size:      pageSize,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search request failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"movies": movies,
+			"pagination": Pagination{
+				Page:       page,
+				PageSize:   pageSize,
+				TotalHits:  totalHits,
+				TotalPages: (totalHits + pageSize - 1) / pageSize,
+			},
+		})
+	}
+}
+
+func handleStoreSuggestMovies(searcher MovieSearcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		size := parseIntWithDefault(c.Query("size"), maxSuggestions)
+		if size <= 0 || size > maxSuggestions {
+			size = maxSuggestions
+		}
+		if query == "" {
+			c.JSON(http.StatusOK, gin.H{"suggestions": []Suggestion{}})
+			return
+		}
+		suggestions, err := searcher.SuggestTitles(c.Request.Context(), query, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "suggest request failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	}
+}
+
+func handleStoreGetMovie(store MovieStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movie, err := store.GetMovie(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, errMovieNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movie"})
+			return
+		}
+		c.JSON(http.StatusOK, movie)
+	}
+}
+
+func handleStoreCreateMovie(store MovieStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input Movie
+		if !bindMovie(c, &input) {
+			return
+		}
+
+		input.ID = uuid.NewString()
+		input.normalizeCredits()
+		input.UserRating, input.ReviewCount = 0, 0
+		if err := store.PutMovie(c.Request.Context(), input); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create movie"})
+			return
+		}
+		c.JSON(http.StatusCreated, input)
+	}
+}
+
+func handleStoreUpdateMovie(store MovieStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input Movie
+		if !bindMovie(c, &input) {
+			return
+		}
+
+		input.ID = c.Param("id")
+		input.normalizeCredits()
+		input.UserRating, input.ReviewCount = 0, 0
+		if err := store.PutMovie(c.Request.Context(), input); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update movie"})
+			return
+		}
+		c.JSON(http.StatusOK, input)
+	}
+}
+
+func handleStoreDeleteMovie(store MovieStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := store.DeleteMovie(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, errMovieNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete movie"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
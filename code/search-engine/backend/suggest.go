@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSuggestions = 10
+	suggestTimeout = 500 * time.Millisecond
+)
+
+type Suggestion struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+var titleSubfieldMappings = map[string]interface{}{
+	"suggest": map[string]interface{}{"type": "search_as_you_type"},
+	"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256},
+}
+
+var titleSubfields = []string{"title.suggest", "title.keyword"}
+
+func ensureTitleSubfields(es *elasticsearch.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := es.Indices.GetFieldMapping(titleSubfields,
+		es.Indices.GetFieldMapping.WithIndex(movieIndex),
+		es.Indices.GetFieldMapping.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("get title mapping: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("get title mapping response error: %s", res.String())
+	}
+	var fieldMapping map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&fieldMapping); err != nil {
+		return fmt.Errorf("decode title mapping: %w", err)
+	}
+	// The response is keyed by the index behind the alias.
+	for _, index := range fieldMapping {
+		if len(index.Mappings) == len(titleSubfields) {
+			return nil
+		}
+	}
+
+	// Indexes this old also predate the custom analyzers, so title is plain
+	// text; naming an analyzer here would conflict with it.
+	var buf bytes.Buffer
+	mapping := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "text", "fields": titleSubfieldMappings},
+		},
+	}
+	if err := json.NewEncoder(&buf).Encode(mapping); err != nil {
+		return fmt.Errorf("encode mapping: %w", err)
+	}
+	putRes, err := es.Indices.PutMapping([]string{movieIndex}, &buf, es.Indices.PutMapping.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("put title mapping: %w", err)
+	}
+	defer putRes.Body.Close()
+	if putRes.IsError() {
+		return fmt.Errorf("put title mapping response error: %s", putRes.String())
+	}
+
+	updateRes, err := es.UpdateByQuery([]string{movieIndex},
+		es.UpdateByQuery.WithConflicts("proceed"),
+		es.UpdateByQuery.WithRefresh(true),
+		es.UpdateByQuery.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("reindex titles: %w", err)
+	}
+	defer updateRes.Body.Close()
+	if updateRes.IsError() {
+		return fmt.Errorf("reindex titles response error: %s", updateRes.String())
+	}
+	return nil
+}
+
+func handleSuggestMovies(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		size := parseIntWithDefault(c.Query("size"), maxSuggestions)
+		if size <= 0 || size > maxSuggestions {
+			size = maxSuggestions
+		}
+		suggestions, err := suggestTitles(c.Request.Context(), es, c.Query("q"), size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "suggest request failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	}
+}
+
+// suggestTitles returns titles starting with the query's words, for typeahead.
+func suggestTitles(ctx context.Context, es *elasticsearch.Client, query string, size int) ([]Suggestion, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []Suggestion{}, nil
+	}
+	body := map[string]interface{}{
+		"size":             size,
+		"track_total_hits": false,
+		"_source":          []string{"title"},
+		"query": withoutDeleted(map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query": query,
+				"type":  "bool_prefix",
+				"fields": []string{
+					"title.suggest",
+					"title.suggest._2gram",
+					"title.suggest._3gram",
+				},
+			},
+		}),
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, fmt.Errorf("encode suggest query: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+	res, err := es.Search(
+		es.Search.WithContext(ctx),
+		es.Search.WithIndex(movieIndex),
+		es.Search.WithBody(&buf),
+		es.Search.WithFilterPath("hits.hits._id", "hits.hits._source.title"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("suggest request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("suggest response error: %s", res.String())
+	}
+
+	var suggestResult struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					Title string `json:"title"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&suggestResult); err != nil {
+		return nil, fmt.Errorf("decode suggestions: %w", err)
+	}
+
+	suggestions := make([]Suggestion, 0, len(suggestResult.Hits.Hits))
+	for _, hit := range suggestResult.Hits.Hits {
+		suggestions = append(suggestions, Suggestion{ID: hit.ID, Title: hit.Source.Title})
+	}
+	return suggestions, nil
+}
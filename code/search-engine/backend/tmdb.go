@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tmdbImageBase = "https://image.tmdb.org/t/p/w500"
+	// maxImportPages bounds one import request; TMDB serves 20 movies a page.
+	maxImportPages = 25
+	// tmdbLastPage is the deepest page TMDB lists serve.
+	tmdbLastPage = 500
+	// tmdbMaxRetries is how often one TMDB request is retried after 429 Too
+	// Many Requests.
+	tmdbMaxRetries = 3
+)
+
+var posterURLMapping = map[string]interface{}{"type": "keyword", "index": false}
+
+type tmdbClient struct {
+	baseURL  string
+	apiKey   string
+	interval time.Duration
+	client   *http.Client
+
+	mu     sync.Mutex
+	next   time.Time
+	genres map[int]string
+}
+
+var tmdb *tmdbClient
+
+func loadTMDB() error {
+	apiKey := os.Getenv("TMDB_API_KEY")
+	if apiKey == "" {
+		return nil
+	}
+	rate := 20
+	if value := os.Getenv("TMDB_REQUESTS_PER_SECOND"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid TMDB_REQUESTS_PER_SECOND %q: must be a positive integer", value)
+		}
+		rate = parsed
+	}
+	tmdb = &tmdbClient{
+		baseURL:  strings.TrimRight(getenv("TMDB_BASE_URL", "https://api.themoviedb.org/3"), "/"),
+		apiKey:   apiKey,
+		interval: time.Second / time.Duration(rate),
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+	return nil
+}
+
+func (t *tmdbClient) wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(t.interval)
+	t.mu.Unlock()
+	return sleepContext(ctx, delay)
+}
+
+func (t *tmdbClient) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	// v4 read access tokens are JWTs and go in the Authorization header;
+	// v3 keys go in the query string.
+	bearer := strings.HasPrefix(t.apiKey, "eyJ")
+	if !bearer {
+		params.Set("api_key", t.apiKey)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(ctx); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+path+"?"+params.Encode(), nil)
+		if err != nil {
+			return fmt.Errorf("build tmdb request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		if bearer {
+			req.Header.Set("Authorization", "Bearer "+t.apiKey)
+		}
+		res, err := t.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("tmdb %s: %w", path, err)
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests && attempt < tmdbMaxRetries {
+			res.Body.Close()
+			delay := time.Second
+			if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			log.Printf("tmdb rate limited, retrying %s in %s", path, delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = decodeTMDBResponse(res, path, out)
+		res.Body.Close()
+		return err
+	}
+}
+
+func decodeTMDBResponse(res *http.Response, path string, out interface{}) error {
+	if res.StatusCode != http.StatusOK {
+		var failure struct {
+			StatusMessage string `json:"status_message"`
+		}
+		json.NewDecoder(res.Body).Decode(&failure)
+		return fmt.Errorf("tmdb %s returned %d: %s", path, res.StatusCode, failure.StatusMessage)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode tmdb %s: %w", path, err)
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *tmdbClient) genreNames(ctx context.Context) (map[int]string, error) {
+	t.mu.Lock()
+	genres := t.genres
+	t.mu.Unlock()
+	if genres != nil {
+		return genres, nil
+	}
+
+	var response struct {
+		Genres []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"genres"`
+	}
+	if err := t.get(ctx, "/genre/movie/list", nil, &response); err != nil {
+		return nil, err
+	}
+	genres = make(map[int]string, len(response.Genres))
+	for _, genre := range response.Genres {
+		genres[genre.ID] = genre.Name
+	}
+	t.mu.Lock()
+	t.genres = genres
+	t.mu.Unlock()
+	return genres, nil
+}
+
+type tmdbMovie struct {
+	ID          int     `json:"id"`
+	Title       string  `json:"title"`
+	Overview    string  `json:"overview"`
+	GenreIDs    []int   `json:"genre_ids"`
+	ReleaseDate string  `json:"release_date"`
+	VoteAverage float64 `json:"vote_average"`
+	PosterPath  string  `json:"poster_path"`
+}
+
+type tmdbPage struct {
+	Page       int         `json:"page"`
+	TotalPages int         `json:"total_pages"`
+	Results    []tmdbMovie `json:"results"`
+}
+
+func (m tmdbMovie) toMovie(genres map[int]string) Movie {
+	movie := Movie{
+		ID:          "tmdb-" + strconv.Itoa(m.ID),
+		Title:       strings.TrimSpace(m.Title),
+		Description: strings.TrimSpace(m.Overview),
+		Rating:      m.VoteAverage,
+	}
+	for _, id := range m.GenreIDs {
+		if name, ok := genres[id]; ok {
+			movie.Genres = append(movie.Genres, name)
+		}
+	}
+	if len(m.ReleaseDate) >= 4 {
+		movie.ReleaseYear, _ = strconv.Atoi(m.ReleaseDate[:4])
+	}
+	if m.PosterPath != "" {
+		movie.PosterURL = tmdbImageBase + m.PosterPath
+	}
+	return movie
+}
+
+type tmdbImportRequest struct {
+	Query    string `json:"query"`
+	FromPage int    `json:"from_page"`
+	ToPage   int    `json:"to_page"`
+}
+
+// handleImportTMDB keys documents by TMDB id, so importing again keeps
+// credits and review stats.
+func handleImportTMDB(es *elasticsearch.Client, alerts *alertDispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tmdb == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "TMDB import is not enabled; set TMDB_API_KEY"})
+			return
+		}
+		var input tmdbImportRequest
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.FromPage == 0 {
+			input.FromPage = 1
+		}
+		if input.ToPage == 0 {
+			input.ToPage = input.FromPage
+		}
+		if input.FromPage < 1 || input.ToPage < input.FromPage || input.ToPage > tmdbLastPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pages must satisfy 1 <= from_page <= to_page <= %d", tmdbLastPage)})
+			return
+		}
+		if input.ToPage-input.FromPage+1 > maxImportPages {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("import at most %d pages at a time", maxImportPages)})
+			return
+		}
+
+		ctx := c.Request.Context()
+		genres, err := tmdb.genreNames(ctx)
+		if err != nil {
+			log.Printf("tmdb import: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to load TMDB genres"})
+			return
+		}
+
+		path, params := "/movie/popular", url.Values{}
+		if query := strings.TrimSpace(input.Query); query != "" {
+			path = "/search/movie"
+			params.Set("query", query)
+		}
+
+		imported, failed, pages, totalPages := 0, 0, 0, 0
+		for page := input.FromPage; page <= input.ToPage; page++ {
+			params.Set("page", strconv.Itoa(page))
+			var result tmdbPage
+			if err := tmdb.get(ctx, path, params, &result); err != nil {
+				log.Printf("tmdb import: %v", err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "TMDB request failed", "imported": imported, "failed": failed, "pages": pages})
+				return
+			}
+			pages++
+			totalPages = result.TotalPages
+
+			movies := make([]Movie, 0, len(result.Results))
+			for _, item := range result.Results {
+				if movie := item.toMovie(genres); movie.Title != "" {
+					movies = append(movies, movie)
+				}
+			}
+			if len(movies) > 0 {
+				pageFailed, created, err := upsertMovies(ctx, es, movies, false)
+				if err != nil {
+					log.Printf("tmdb import: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store imported movies", "imported": imported, "failed": failed, "pages": pages})
+					return
+				}
+				imported += len(movies) - pageFailed
+				failed += pageFailed
+				alerts.moviesAdded(moviesWithIDs(movies, created)...)
+			}
+			if page >= result.TotalPages {
+				break
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"imported": imported, "failed": failed, "pages": pages, "total_pages": totalPages})
+	}
+}
+
+// upsertMovies writes movies by id, keeping the review stats of those already
+// stored. Their credits are kept too unless credits is set.
+func upsertMovies(ctx context.Context, es *elasticsearch.Client, movies []Movie, credits bool) (int, []string, error) {
+	var vectors [][]float32
+	if embedder != nil {
+		texts := make([]string, len(movies))
+		for i, movie := range movies {
+			texts[i] = embeddingText(movie.Title, movie.Description)
+		}
+		var err error
+		if vectors, err = embedder.embed(ctx, texts); err != nil {
+			// The backfill endpoint picks these up later.
+			log.Printf("embed imported movies: %v", err)
+			vectors = nil
+		}
+	}
+
+	var bulk bytes.Buffer
+	encoder := json.NewEncoder(&bulk)
+	for i, movie := range movies {
+		doc := map[string]interface{}{
+			"title":        movie.Title,
+			"description":  movie.Description,
+			"genres":       movie.Genres,
+			"rating":       movie.Rating,
+			"release_year": movie.ReleaseYear,
+			"poster_url":   movie.PosterURL,
+		}
+		if credits {
+			doc["directors"] = movie.Directors
+			doc["cast"] = movie.Cast
+			doc["crew"] = movie.Crew
+		}
+		// Left out when empty, so an import keeps translations added since.
+		if len(movie.Translations) > 0 {
+			doc["translations"] = movie.Translations
+		}
+		// The same goes for the collection.
+		if movie.Collection != "" {
+			doc["collection"] = movie.Collection
+			doc["collection_key"] = collectionKey(movie.ID, movie.Collection)
+		}
+		// And for providers, which the import does not fetch.
+		if len(movie.Providers) > 0 {
+			doc["providers"] = movie.Providers
+		}
+		if vectors != nil {
+			doc[embeddingField] = vectors[i]
+		}
+		upsert := map[string]interface{}{"user_rating": 0, "review_count": 0, "collection_key": collectionKey(movie.ID, "")}
+		for field, value := range doc {
+			upsert[field] = value
+		}
+		encoder.Encode(map[string]interface{}{"update": map[string]interface{}{"_id": movie.ID}})
+		encoder.Encode(map[string]interface{}{"doc": doc, "upsert": upsert})
+	}
+	return esRepository{es}.Bulk(ctx, movieIndex, &bulk)
+}
+
+func moviesWithIDs(movies []Movie, ids []string) []Movie {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var matched []Movie
+	for _, movie := range movies {
+		if wanted[movie.ID] {
+			matched = append(matched, movie)
+		}
+	}
+	return matched
+}
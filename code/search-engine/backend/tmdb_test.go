@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTMDBMovieToMovie(t *testing.T) {
+	genres := map[int]string{18: "Drama", 878: "Science Fiction"}
+
+	tests := []struct {
+		name  string
+		input tmdbMovie
+		want  Movie
+	}{
+		{
+			name: "full result",
+			input: tmdbMovie{
+				ID: 27205, Title: " Inception ", Overview: "A thief who steals secrets. ",
+				GenreIDs: []int{99, 878, 18}, ReleaseDate: "2010-07-15", VoteAverage: 8.4, PosterPath: "/poster.jpg",
+			},
+			want: Movie{
+				ID: "tmdb-27205", Title: "Inception", Description: "A thief who steals secrets.",
+				Genres: []string{"Science Fiction", "Drama"}, ReleaseYear: 2010, Rating: 8.4, PosterURL: tmdbImageBase + "/poster.jpg",
+			},
+		},
+		{
+			name:  "missing optional fields",
+			input: tmdbMovie{ID: 7, Title: "Untitled", GenreIDs: []int{1}, ReleaseDate: "20"},
+			want:  Movie{ID: "tmdb-7", Title: "Untitled"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.input.toMovie(genres)
+			if got.ID != tc.want.ID || got.Title != tc.want.Title || got.Description != tc.want.Description ||
+				strings.Join(got.Genres, ",") != strings.Join(tc.want.Genres, ",") || got.ReleaseYear != tc.want.ReleaseYear || got.Rating != tc.want.Rating ||
+				got.PosterURL != tc.want.PosterURL {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeTMDBResponse(t *testing.T) {
+	t.Run("page", func(t *testing.T) {
+		res := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(
+			`{"page":2,"total_pages":5,"results":[{"id":1,"title":"Heat","genre_ids":[80]}]}`))}
+		var page tmdbPage
+		if err := decodeTMDBResponse(res, "/search/movie", &page); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if page.Page != 2 || page.TotalPages != 5 || len(page.Results) != 1 || page.Results[0].Title != "Heat" {
+			t.Fatalf("unexpected page: %+v", page)
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		res := &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(strings.NewReader(
+			`{"status_message":"Invalid API key"}`))}
+		err := decodeTMDBResponse(res, "/movie/popular", &tmdbPage{})
+		if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Invalid API key") {
+			t.Fatalf("expected the status and TMDB message, got %v", err)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		res := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{`))}
+		if err := decodeTMDBResponse(res, "/movie/popular", &tmdbPage{}); err == nil {
+			t.Fatalf("expected a decode error")
+		}
+	})
+}
+
+func TestTMDBClientAuthentication(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantQuery  string
+		wantHeader string
+	}{
+		{name: "v3 key", apiKey: "abc123", wantQuery: "abc123"},
+		{name: "v4 token", apiKey: "eyJhbGciOi", wantHeader: "Bearer eyJhbGciOi"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotQuery, gotHeader string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.Query().Get("api_key")
+				gotHeader = r.Header.Get("Authorization")
+				w.Write([]byte(`{"genres":[{"id":18,"name":"Drama"}]}`))
+			}))
+			defer server.Close()
+
+			client := &tmdbClient{baseURL: server.URL, apiKey: tc.apiKey, client: server.Client()}
+			genres, err := client.genreNames(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if genres[18] != "Drama" {
+				t.Fatalf("expected genre 18 to be Drama, got %q", genres[18])
+			}
+			if gotQuery != tc.wantQuery || gotHeader != tc.wantHeader {
+				t.Fatalf("expected api_key %q and Authorization %q, got %q and %q", tc.wantQuery, tc.wantHeader, gotQuery, gotHeader)
+			}
+		})
+	}
+}
+
+func TestMoviesWithIDs(t *testing.T) {
+	movies := []Movie{{ID: "tmdb-1"}, {ID: "tmdb-2"}, {ID: "tmdb-3"}}
+
+	got := moviesWithIDs(movies, []string{"tmdb-3", "tmdb-1", "tmdb-9"})
+	if len(got) != 2 || got[0].ID != "tmdb-1" || got[1].ID != "tmdb-3" {
+		t.Fatalf("expected tmdb-1 and tmdb-3, got %+v", got)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+)
+
+const maxCachedLists = 256
+
+type listCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedList
+}
+
+type cachedList struct {
+	body    []byte
+	expires time.Time
+}
+
+func newListCache() (*listCache, error) {
+	ttl := time.Minute
+	if value := getenv("LIST_CACHE_TTL", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid LIST_CACHE_TTL %q: must be a duration such as 30s", value)
+		}
+		ttl = parsed
+	}
+	return &listCache{ttl: ttl, entries: map[string]cachedList{}}, nil
+}
+
+func (lc *listCache) cached() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if lc.ttl <= 0 {
+			c.Next()
+			return
+		}
+		cacheControl := fmt.Sprintf("public, max-age=%d", int(lc.ttl.Seconds()))
+		key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+
+		lc.mu.Lock()
+		entry, ok := lc.entries[key]
+		lc.mu.Unlock()
+		hit := ok && time.Now().Before(entry.expires)
+		recordCacheLookup("list", hit)
+		if hit {
+			c.Header("X-Cache", "HIT")
+			c.Header("Cache-Control", cacheControl)
+			c.Data(http.StatusOK, "application/json; charset=utf-8", entry.body)
+			c.Abort()
+			return
+		}
+
+		writer := &bodyRecorder{ResponseWriter: c.Writer, cacheControl: cacheControl}
+		c.Writer = writer
+		c.Header("X-Cache", "MISS")
+		c.Next()
+		if writer.Status() != http.StatusOK {
+			return
+		}
+
+		lc.mu.Lock()
+		defer lc.mu.Unlock()
+		if len(lc.entries) >= maxCachedLists {
+			now := time.Now()
+			for k, e := range lc.entries {
+				if now.After(e.expires) {
+					delete(lc.entries, k)
+				}
+			}
+			if len(lc.entries) >= maxCachedLists {
+				return
+			}
+		}
+		lc.entries[key] = cachedList{body: writer.body.Bytes(), expires: time.Now().Add(lc.ttl)}
+	}
+}
+
+type bodyRecorder struct {
+	gin.ResponseWriter
+	cacheControl string
+	body         bytes.Buffer
+}
+
+func (w *bodyRecorder) WriteHeader(code int) {
+	if code == http.StatusOK && w.cacheControl != "" {
+		w.Header().Set("Cache-Control", w.cacheControl)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodyRecorder) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+type trendingMovie struct {
+	Movie
+	Clicks int `json:"clicks"`
+}
+
+func handleTrendingMovies(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days := parseIntWithDefault(c.Query("days"), 7)
+		if days <= 0 || days > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 90"})
+			return
+		}
+		size := parseIntWithDefault(c.Query("size"), 10)
+		if size <= 0 || size > 50 {
+			size = 10
+		}
+
+		body, err := encodeBody(map[string]interface{}{
+			"size": 0,
+			"query": map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+				{"term": map[string]interface{}{"event": "click"}},
+				{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", days)}}},
+			}}},
+			"aggs": map[string]interface{}{
+				// Ask for extra buckets in case some movies were deleted.
+				"movies": map[string]interface{}{"terms": map[string]interface{}{"field": "movie_id", "size": size * 2}},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode trending query"})
+			return
+		}
+		res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(searchLogIndex), es.Search.WithBody(body))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "trending request failed"})
+			return
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			log.Printf("trending: %s", res.String())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "trending returned an error"})
+			return
+		}
+		var result struct {
+			Aggregations struct {
+				Movies struct {
+					Buckets []struct {
+						Key      string `json:"key"`
+						DocCount int    `json:"doc_count"`
+					} `json:"buckets"`
+				} `json:"movies"`
+			} `json:"aggregations"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode trending results"})
+			return
+		}
+
+		buckets := result.Aggregations.Movies.Buckets
+		movies := make([]trendingMovie, 0, size)
+		if len(buckets) > 0 {
+			ids := make([]string, len(buckets))
+			for i, bucket := range buckets {
+				ids[i] = bucket.Key
+			}
+			found, err := getMovies(c, es, ids)
+			if err != nil {
+				log.Printf("trending: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch trending movies"})
+				return
+			}
+			for _, bucket := range buckets {
+				if movie, ok := found[bucket.Key]; ok && len(movies) < size {
+					movies = append(movies, trendingMovie{Movie: movie, Clicks: bucket.DocCount})
+				}
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"days": days, "movies": movies})
+	}
+}
+
+func getMovies(c *gin.Context, es *elasticsearch.Client, ids []string) (map[string]Movie, error) {
+	body, err := encodeBody(map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	res, err := es.Mget(body,
+		es.Mget.WithIndex(movieIndex),
+		es.Mget.WithSourceExcludes(movieSourceExcludes...),
+		es.Mget.WithContext(c.Request.Context()))
+	if err != nil {
+		return nil, fmt.Errorf("get movies: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("get movies response error: %s", res.String())
+	}
+	var result struct {
+		Docs []struct {
+			ID     string                 `json:"_id"`
+			Found  bool                   `json:"found"`
+			Source map[string]interface{} `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode movies: %w", err)
+	}
+	movies := make(map[string]Movie, len(result.Docs))
+	for _, doc := range result.Docs {
+		if doc.Found && !isDeleted(doc.Source) {
+			movie := mapToMovie(doc.Source)
+			movie.ID = doc.ID
+			movies[doc.ID] = movie
+		}
+	}
+	return movies, nil
+}
+
+// handleTopMovies takes min_reviews, which stops a single 10/10 review from
+// topping the list.
+func handleTopMovies(es *elasticsearch.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		minReviews := parseIntWithDefault(c.Query("min_reviews"), 3)
+		if minReviews < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_reviews must be at least 1"})
+			return
+		}
+		size := parseIntWithDefault(c.Query("size"), 10)
+		if size <= 0 || size > 50 {
+			size = 10
+		}
+
+		filter := []map[string]interface{}{
+			notDeleted(),
+			{"range": map[string]interface{}{"review_count": map[string]interface{}{"gte": minReviews}}},
+		}
+		if genre := strings.TrimSpace(c.Query("genre")); genre != "" {
+			filter = append(filter, genreFilter([]string{genre}))
+		}
+		body, err := encodeBody(map[string]interface{}{
+			"size":    size,
+			"query":   map[string]interface{}{"bool": map[string]interface{}{"filter": filter}},
+			"_source": map[string]interface{}{"excludes": movieSourceExcludes},
+			"sort": []map[string]interface{}{
+				{"user_rating": map[string]interface{}{"order": "desc"}},
+				{"review_count": map[string]interface{}{"order": "desc"}},
+				{"title.keyword": map[string]interface{}{"order": "asc"}},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode top movies query"})
+			return
+		}
+		res, err := es.Search(es.Search.WithContext(c.Request.Context()), es.Search.WithIndex(movieIndex), es.Search.WithBody(body))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "top movies request failed"})
+			return
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "top movies returned an error"})
+			return
+		}
+		var result struct {
+			Hits searchHits `json:"hits"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode top movies"})
+			return
+		}
+		movies := make([]Movie, 0, len(result.Hits.Hits))
+		for _, hit := range result.Hits.Hits {
+			movie := mapToMovie(hit.Source)
+			movie.ID = hit.ID
+			movies = append(movies, movie)
+		}
+		c.JSON(http.StatusOK, gin.H{"min_reviews": minReviews, "movies": movies})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// The first films date from 1888; announced films can be a few years out.
+const (
+	minReleaseYear    = 1888
+	releaseYearsAhead = 10
+)
+
+// Empty allows any genre. Keys are lowercase, values the spelling to store.
+var allowedGenres map[string]string
+
+// Field errors name fields as the JSON does. This has to run before any struct is validated, since the validator caches field names.
+func init() {
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+func loadMovieValidation() {
+	allowedGenres = nil
+	if value := os.Getenv("MOVIE_GENRES"); value != "" {
+		allowedGenres = map[string]string{}
+		for _, genre := range strings.Split(value, ",") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				allowedGenres[strings.ToLower(genre)] = genre
+			}
+		}
+		if len(allowedGenres) == 0 {
+			log.Fatalf("invalid MOVIE_GENRES %q: must be a comma-separated list of genres", value)
+		}
+	}
+}
+
+// bindMovie answers 400 with one message per invalid field and reports whether the movie is usable.
+func bindMovie(c *gin.Context, movie *Movie) bool {
+	fields, ok := bindFields(c, movie)
+	if !ok {
+		return false
+	}
+	for field, message := range validateMovie(movie) {
+		if _, ok := fields[field]; !ok {
+			fields[field] = message
+		}
+	}
+	return checkFields(c, "movie", fields)
+}
+
+// bindFields binds the body and collects the field errors. It answers 400 itself only when the body is not JSON.
+func bindFields(c *gin.Context, v interface{}) (map[string]string, bool) {
+	fields := map[string]string{}
+	err := c.ShouldBindJSON(v)
+	var invalid validator.ValidationErrors
+	var wrongType *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid):
+		for _, fieldErr := range invalid {
+			fields[fieldPath(fieldErr)] = fieldMessage(fieldErr)
+		}
+	case errors.As(err, &wrongType):
+		fields[wrongType.Field] = typeMessage(wrongType.Type.Kind())
+	case bodyTooLarge(c, err):
+		return nil, false
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return fields, true
+}
+
+// movieFieldErrors validates a movie built outside a request, as bindMovie does.
+func movieFieldErrors(movie *Movie) map[string]string {
+	fields := map[string]string{}
+	var invalid validator.ValidationErrors
+	if err := binding.Validator.ValidateStruct(movie); errors.As(err, &invalid) {
+		for _, fieldErr := range invalid {
+			fields[fieldPath(fieldErr)] = fieldMessage(fieldErr)
+		}
+	}
+	for field, message := range validateMovie(movie) {
+		if _, ok := fields[field]; !ok {
+			fields[field] = message
+		}
+	}
+	return fields
+}
+
+func checkFields(c *gin.Context, kind string, fields map[string]string) bool {
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + kind, "fields": fields})
+		return false
+	}
+	return true
+}
+
+// validateMovie covers the rules a struct tag can't express, and tidies the genres: trimmed, deduplicated, and in their allow-list spelling.
+func validateMovie(movie *Movie) map[string]string {
+	fields := map[string]string{}
+	maxYear := time.Now().Year() + releaseYearsAhead
+	if movie.ReleaseYear != 0 && (movie.ReleaseYear < minReleaseYear || movie.ReleaseYear > maxYear) {
+		fields["release_year"] = fmt.Sprintf("must be between %d and %d", minReleaseYear, maxYear)
+	}
+	genres := make([]string, 0, len(movie.Genres))
+	seen := map[string]bool{}
+	for i, genre := range movie.Genres {
+		genre = strings.TrimSpace(genre)
+		if genre == "" {
+			continue
+		}
+		if allowedGenres != nil {
+			allowed, ok := allowedGenre(genre)
+			if !ok {
+				fields[fmt.Sprintf("genres[%d]", i)] = "must be one of the genres in MOVIE_GENRES"
+				continue
+			}
+			genre = allowed
+		}
+		key := strings.ToLower(genre)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		genres = append(genres, genre)
+	}
+	movie.Genres = genres
+	movie.Collection = strings.TrimSpace(movie.Collection)
+	movie.Providers = normalizeProviders(movie.Providers)
+	validateTranslations(movie, fields)
+	return fields
+}
+
+// fieldPath drops the struct name, so cast[0].name rather than Movie.cast[0].name.
+func fieldPath(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	text := fieldErr.Kind() == reflect.String
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if text {
+			return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+		}
+		return "must be at least " + fieldErr.Param()
+	case "max":
+		if text {
+			return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+		}
+		return "must be at most " + fieldErr.Param()
+	case "url":
+		return "must be a valid URL"
+	}
+	return "is invalid"
+}
+
+func typeMessage(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Float64:
+		return "must be a number"
+	case reflect.String:
+		return "must be a string"
+	case reflect.Slice:
+		return "must be a list"
+	}
+	return "has the wrong type"
+}
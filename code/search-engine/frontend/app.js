@@ -6,11 +6,39 @@ let currentPage = 1;
 let totalPages = 1;
 let currentQuery = "";
 let currentPageSize = 5;
+let currentSort = "";
+let currentPerson = "";
+let currentProvider = "";
+let currentMode = "keyword";
+let currentGroupBy = "";
+// Set while paging through a saved search, which the server re-runs.
+let currentSavedSearch = null;
+// Identifies the results on screen when reporting which one was picked.
+let currentSearchId = null;
+let authToken = localStorage.getItem("authToken");
+let authUser = localStorage.getItem("authUser");
+let apiKey = localStorage.getItem("apiKey") || "";
+// Keeps this browser in the same arm of a search experiment across visits.
+const clientId =
+  localStorage.getItem("clientId") || `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+localStorage.setItem("clientId", clientId);
 
 const resultsContainer = document.getElementById("results");
 const pageInfo = document.getElementById("page-info");
 const prevPageBtn = document.getElementById("prev-page");
 const nextPageBtn = document.getElementById("next-page");
+const suggestionsList = document.getElementById("title-suggestions");
+const didYouMean = document.getElementById("did-you-mean");
+const didYouMeanText = document.getElementById("did-you-mean-text");
+const otherResults = document.getElementById("other-results");
+const partialResults = document.getElementById("partial-results");
+const providerSelect = document.getElementById("provider");
+
+let suggestTimer;
+let suggestController;
+// Open while the live search socket is up; typeahead falls back to fetch otherwise.
+let liveSearch = null;
+let liveSearchRetry = 1000;
 
 async function searchMovies() {
   const params = new URLSearchParams({
@@ -20,24 +48,180 @@ async function searchMovies() {
   if (currentQuery.trim()) {
     params.set("q", currentQuery.trim());
   }
+  if (currentPerson.trim()) {
+    params.set("person", currentPerson.trim());
+  }
+  if (currentProvider) {
+    params.set("provider", currentProvider);
+  }
+  if (currentMode !== "keyword") {
+    params.set("mode", currentMode);
+  }
+  if (currentSort) {
+    const [sort, order] = currentSort.split(":");
+    params.set("sort", sort);
+    params.set("order", order);
+  }
+  if (currentGroupBy && currentMode === "keyword") {
+    params.set("group_by", currentGroupBy);
+  }
+
+  let url = `${apiBase}/movies?${params.toString()}`;
+  if (currentSavedSearch) {
+    url = `${apiBase}/me/searches/${currentSavedSearch}/results?page=${currentPage}&pageSize=${currentPageSize}`;
+  }
 
   togglePaginationButtons(true);
   try {
-    const response = await fetch(`${apiBase}/movies?${params.toString()}`);
+    const response = await authFetch(url);
     if (!response.ok) {
-      throw new Error("Search failed");
+      const error = await response.json().catch(() => ({}));
+      throw new Error(error.error || "Search failed");
     }
     const data = await response.json();
+    currentSearchId = data.search_id || null;
     renderResults(data.movies);
+    renderDidYouMean(data.did_you_mean);
+    renderProviderFacet(data.facets && data.facets.providers);
+    partialResults.hidden = !(data.meta && data.meta.partial);
     updatePagination(data.pagination);
+    if (currentPage === 1 && !currentSavedSearch) {
+      searchOtherResults(currentQuery.trim());
+    }
   } catch (error) {
     resultsContainer.innerHTML = `<p class="error">${error.message}</p>`;
+    renderDidYouMean();
+    partialResults.hidden = true;
     pageInfo.textContent = "";
   } finally {
     togglePaginationButtons(false);
   }
 }
 
+// Typeahead: send the text over the live search socket, which answers once
+// typing pauses. Without it, ask the suggest endpoint once typing pauses,
+// cancelling any request still in flight.
+function queueSuggestions(value) {
+  if (liveSearch) {
+    liveSearch.send(value.trim());
+    return;
+  }
+  clearTimeout(suggestTimer);
+  suggestTimer = setTimeout(() => fetchSuggestions(value.trim()), 150);
+}
+
+function connectLiveSearch() {
+  if (!window.location.origin.includes("http") || !("WebSocket" in window)) {
+    return;
+  }
+  const scheme = window.location.protocol === "https:" ? "wss" : "ws";
+  const socket = new WebSocket(`${scheme}://${window.location.host}/ws/search`);
+  socket.addEventListener("open", () => {
+    liveSearch = socket;
+    liveSearchRetry = 1000;
+  });
+  socket.addEventListener("message", (event) => {
+    const data = JSON.parse(event.data);
+    if (!data.error) {
+      renderSuggestions(data.suggestions);
+    }
+  });
+  socket.addEventListener("close", () => {
+    liveSearch = null;
+    setTimeout(connectLiveSearch, liveSearchRetry);
+    liveSearchRetry = Math.min(liveSearchRetry * 2, 60000);
+  });
+}
+
+async function fetchSuggestions(query) {
+  if (suggestController) {
+    suggestController.abort();
+  }
+  if (!query) {
+    suggestionsList.innerHTML = "";
+    return;
+  }
+  suggestController = new AbortController();
+  try {
+    const response = await fetch(
+      `${apiBase}/movies/suggest?${new URLSearchParams({ q: query })}`,
+      { signal: suggestController.signal }
+    );
+    if (!response.ok) {
+      return;
+    }
+    const data = await response.json();
+    renderSuggestions(data.suggestions);
+  } catch (error) {
+    if (error.name !== "AbortError") {
+      suggestionsList.innerHTML = "";
+    }
+  }
+}
+
+function renderSuggestions(suggestions) {
+  suggestionsList.innerHTML = "";
+  (suggestions || []).forEach((suggestion) => {
+    const option = document.createElement("option");
+    option.value = suggestion.title;
+    suggestionsList.appendChild(option);
+  });
+}
+
+// People and collections matching the query, shown above the movies.
+async function searchOtherResults(query) {
+  otherResults.hidden = true;
+  otherResults.innerHTML = "";
+  if (!query) return;
+  try {
+    const response = await fetch(
+      `${apiBase}/search?${new URLSearchParams({ q: query, size: 3 })}`
+    );
+    if (!response.ok) return;
+    const data = await response.json();
+    (data.groups || [])
+      .filter((group) => group.type !== "movie" && group.results.length > 0)
+      .forEach((group) => {
+        const line = document.createElement("p");
+        const label = document.createElement("strong");
+        label.textContent = group.type === "person" ? "People: " : "Collections: ";
+        line.appendChild(label);
+        line.append(group.results.map((result) => result.name).join(", "));
+        otherResults.appendChild(line);
+        otherResults.hidden = false;
+      });
+  } catch (error) {
+    otherResults.hidden = true;
+  }
+}
+
+function formatGenres(movie) {
+  return movie.genres && movie.genres.length ? movie.genres.join(", ") : "Unknown genre";
+}
+
+function renderDidYouMean(correction) {
+  didYouMean.hidden = !correction;
+  didYouMeanText.textContent = correction || "";
+}
+
+// Offers the services among the matches, keeping the one chosen even when the
+// facet no longer lists it. Semantic results carry no facet, so the list stays.
+function renderProviderFacet(providers) {
+  if (!providers) return;
+  providerSelect.innerHTML = '<option value="">Any service</option>';
+  const names = providers.map((provider) => provider.name);
+  if (currentProvider && !names.some((name) => name.toLowerCase() === currentProvider.toLowerCase())) {
+    providers = [{ name: currentProvider }, ...providers];
+  }
+  providers.forEach((provider) => {
+    const option = document.createElement("option");
+    option.value = provider.name;
+    option.textContent = provider.count === undefined ? provider.name : `${provider.name} (${provider.count})`;
+    option.selected = provider.name.toLowerCase() === currentProvider.toLowerCase();
+    providerSelect.appendChild(option);
+  });
+}
+
 function renderResults(movies) {
   resultsContainer.innerHTML = "";
   if (!movies || movies.length === 0) {
@@ -46,22 +230,462 @@ function renderResults(movies) {
   }
 
   const template = document.getElementById("movie-template");
-  movies.forEach((movie) => {
+  movies.forEach((movie, index) => {
     const node = template.content.cloneNode(true);
+    const position = (currentPage - 1) * currentPageSize + index + 1;
     node.querySelector(".title").textContent = movie.title;
+    if (movie.poster_url) {
+      const poster = node.querySelector(".poster");
+      poster.src = `${apiBase}/posters/${encodeURIComponent(movie.id)}?size=small`;
+      poster.alt = `${movie.title} poster`;
+      poster.hidden = false;
+    }
     node.querySelector(
       ".meta"
-    ).textContent = `${movie.genre || "Unknown genre"} • Rating ${
+    ).textContent = `${formatGenres(movie)} • Rating ${
       movie.rating ?? "n/a"
-    } • ${movie.release_year || "Year n/a"}`;
+    } • ${movie.release_year || "Year n/a"}${
+      movie.collection ? ` • ${movie.collection}` : ""
+    }${
+      movie.providers && movie.providers.length ? ` • On ${movie.providers.join(", ")}` : ""
+    }${
+      movie.review_count
+        ? ` • Users ${movie.user_rating} (${movie.review_count} reviews)`
+        : ""
+    }`;
+    node.querySelector(".credits").textContent = describeCredits(movie);
     node.querySelector(".description").textContent = movie.description || "";
     node.querySelector(
       ".identifier"
     ).textContent = `Document ID: ${movie.id}`;
+    const similarList = node.querySelector(".similar-list");
+    node
+      .querySelector(".similar-button")
+      .addEventListener("click", () => {
+        reportClick(movie.id, position);
+        loadSimilar(movie.id, similarList);
+      });
+    node
+      .querySelector(".watchlist-button")
+      .addEventListener("click", () => {
+        reportClick(movie.id, position);
+        addToWatchlist(movie.id);
+      });
     resultsContainer.appendChild(node);
   });
 }
 
+// reportClick tells search analytics which result was picked. It is best
+// effort and never blocks the UI.
+function reportClick(movieId, position) {
+  const query = currentSavedSearch ? "" : currentQuery.trim();
+  if (!currentSearchId && !query) return;
+  fetch(`${apiBase}/analytics/click`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json", "X-Client-ID": clientId },
+    body: JSON.stringify({ search_id: currentSearchId || undefined, query, movie_id: movieId, position }),
+    keepalive: true,
+  }).catch(() => {});
+}
+
+async function loadSimilar(id, list) {
+  list.hidden = false;
+  list.innerHTML = "<li>Loading...</li>";
+  try {
+    const response = await fetch(`${apiBase}/movies/${id}/similar`);
+    if (!response.ok) {
+      throw new Error("Could not load similar movies");
+    }
+    const data = await response.json();
+    list.innerHTML = "";
+    if (!data.movies || data.movies.length === 0) {
+      list.innerHTML = "<li>No similar movies yet.</li>";
+      return;
+    }
+    data.movies.forEach((movie) => {
+      const item = document.createElement("li");
+      item.textContent = `${movie.title} (${movie.release_year || "n/a"}) • ${formatGenres(movie)}`;
+      list.appendChild(item);
+    });
+  } catch (error) {
+    list.innerHTML = `<li class="error">${error.message}</li>`;
+  }
+}
+
+// loadDiscoverList fills one of the Discover lists. describe turns a movie
+// into the text after its title.
+async function loadDiscoverList(list, url, empty, describe) {
+  list.innerHTML = "<li>Loading...</li>";
+  try {
+    const response = await fetch(url);
+    if (!response.ok) {
+      throw await readError(response, "Could not load movies");
+    }
+    const data = await response.json();
+    list.innerHTML = "";
+    if (data.movies.length === 0) {
+      list.innerHTML = `<li>${empty}</li>`;
+      return;
+    }
+    data.movies.forEach((movie) => {
+      const item = document.createElement("li");
+      item.textContent = `${movie.title} (${movie.release_year || "n/a"}) • ${describe(movie)}`;
+      list.appendChild(item);
+    });
+  } catch (error) {
+    list.innerHTML = "";
+    const item = document.createElement("li");
+    item.className = "error";
+    item.textContent = error.message;
+    list.appendChild(item);
+  }
+}
+
+function loadTrending() {
+  loadDiscoverList(
+    document.getElementById("trending"),
+    `${apiBase}/movies/trending?days=7&size=5`,
+    "Nothing picked from searches yet.",
+    (movie) => `${movie.clicks} picks`
+  );
+}
+
+function loadTopRated() {
+  const genre = document.getElementById("top-genre").value.trim();
+  const params = new URLSearchParams({ size: 5 });
+  if (genre) params.set("genre", genre);
+  loadDiscoverList(
+    document.getElementById("top-rated"),
+    `${apiBase}/movies/top?${params.toString()}`,
+    "No movies with enough reviews yet.",
+    (movie) => `Users ${movie.user_rating} (${movie.review_count} reviews)`
+  );
+}
+
+function loadRandomMovie() {
+  const genre = document.getElementById("random-genre").value.trim();
+  const params = new URLSearchParams();
+  if (genre) params.set("genre", genre);
+  loadDiscoverList(
+    document.getElementById("random-movie"),
+    `${apiBase}/movies/random?${params.toString()}`,
+    "No movies match.",
+    (movie) => formatGenres(movie)
+  );
+}
+
+function authFetch(url, options = {}) {
+  const headers = { "X-Client-ID": clientId, ...(options.headers || {}) };
+  if (authToken) {
+    headers.Authorization = `Bearer ${authToken}`;
+  }
+  return fetch(url, { ...options, headers });
+}
+
+function editorFetch(url, options = {}) {
+  const headers = { ...(options.headers || {}) };
+  if (apiKey) {
+    headers["X-API-Key"] = apiKey;
+  }
+  return fetch(url, { ...options, headers });
+}
+
+async function readError(response, fallback) {
+  if (response.status === 401) {
+    signOut();
+    return new Error("Please sign in again");
+  }
+  const error = await response.json().catch(() => ({}));
+  return new Error(errorMessage(error, fallback));
+}
+
+function errorMessage(error, fallback) {
+  if (error.fields) {
+    return Object.entries(error.fields)
+      .map(([field, message]) => `${field} ${message}`)
+      .join("; ");
+  }
+  return error.error || fallback;
+}
+
+async function handleAuth(event) {
+  event.preventDefault();
+  const action = event.submitter?.dataset.action || "login";
+  const data = new FormData(event.target);
+  try {
+    const response = await fetch(`${apiBase}/auth/${action}`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        username: data.get("username"),
+        password: data.get("password"),
+      }),
+    });
+    if (!response.ok) {
+      throw await readError(response, "Unable to sign in");
+    }
+    const session = await response.json();
+    authToken = session.token;
+    authUser = session.username;
+    localStorage.setItem("authToken", authToken);
+    localStorage.setItem("authUser", authUser);
+    event.target.reset();
+    setStatus("library", "");
+    renderLibrary();
+  } catch (error) {
+    setStatus("library", error.message, "error");
+  }
+}
+
+function signOut() {
+  authToken = null;
+  authUser = null;
+  currentSavedSearch = null;
+  localStorage.removeItem("authToken");
+  localStorage.removeItem("authUser");
+  renderLibrary();
+}
+
+function renderLibrary() {
+  const signedIn = Boolean(authToken);
+  document.getElementById("auth-form").hidden = signedIn;
+  document.getElementById("library").hidden = !signedIn;
+  if (!signedIn) return;
+  document.getElementById("library-user").textContent = authUser;
+  loadSavedSearches();
+  loadWatchlist();
+  loadAlerts();
+}
+
+async function loadSavedSearches() {
+  const list = document.getElementById("saved-searches");
+  try {
+    const response = await authFetch(`${apiBase}/me/searches`);
+    if (!response.ok) {
+      throw await readError(response, "Could not load saved searches");
+    }
+    const data = await response.json();
+    list.innerHTML = "";
+    if (data.searches.length === 0) {
+      list.innerHTML = "<li>No saved searches yet.</li>";
+      return;
+    }
+    data.searches.forEach((search) => {
+      const item = document.createElement("li");
+      const run = document.createElement("button");
+      run.type = "button";
+      run.className = "link-button";
+      run.textContent = search.name;
+      run.addEventListener("click", () => {
+        currentSavedSearch = search.id;
+        currentPage = 1;
+        searchMovies();
+      });
+      const remove = document.createElement("button");
+      remove.type = "button";
+      remove.className = "link-button";
+      remove.textContent = "remove";
+      remove.addEventListener("click", () => deleteSavedSearch(search.id));
+      item.append(run, " ", remove);
+      list.appendChild(item);
+    });
+  } catch (error) {
+    setStatus("library", error.message, "error");
+  }
+}
+
+async function handleSaveSearch(event) {
+  event.preventDefault();
+  const params = {};
+  if (currentQuery.trim()) params.q = currentQuery.trim();
+  if (currentPerson.trim()) params.person = currentPerson.trim();
+  if (currentMode !== "keyword") params.mode = currentMode;
+  if (currentSort) {
+    [params.sort, params.order] = currentSort.split(":");
+  }
+  try {
+    const response = await authFetch(`${apiBase}/me/searches`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        name: document.getElementById("saved-search-name").value,
+        params,
+      }),
+    });
+    if (!response.ok) {
+      throw await readError(response, "Unable to save search");
+    }
+    event.target.reset();
+    setStatus("library", "Search saved", "success");
+    loadSavedSearches();
+  } catch (error) {
+    setStatus("library", error.message, "error");
+  }
+}
+
+async function deleteSavedSearch(id) {
+  const response = await authFetch(`${apiBase}/me/searches/${id}`, { method: "DELETE" });
+  if (!response.ok) {
+    setStatus("library", (await readError(response, "Unable to remove search")).message, "error");
+    return;
+  }
+  if (currentSavedSearch === id) {
+    currentSavedSearch = null;
+  }
+  loadSavedSearches();
+}
+
+async function loadWatchlist() {
+  const list = document.getElementById("watchlist");
+  try {
+    const response = await authFetch(`${apiBase}/me/watchlist`);
+    if (!response.ok) {
+      throw await readError(response, "Could not load watchlist");
+    }
+    const data = await response.json();
+    list.innerHTML = "";
+    if (data.movies.length === 0) {
+      list.innerHTML = "<li>Your watchlist is empty.</li>";
+      return;
+    }
+    data.movies.forEach((movie) => {
+      const item = document.createElement("li");
+      const remove = document.createElement("button");
+      remove.type = "button";
+      remove.className = "link-button";
+      remove.textContent = "remove";
+      remove.addEventListener("click", () => removeFromWatchlist(movie.id));
+      item.append(`${movie.title} (${movie.release_year || "n/a"}) `, remove);
+      list.appendChild(item);
+    });
+  } catch (error) {
+    setStatus("library", error.message, "error");
+  }
+}
+
+async function addToWatchlist(id) {
+  if (!authToken) {
+    setStatus("library", "Sign in to keep a watchlist", "error");
+    return;
+  }
+  const response = await authFetch(`${apiBase}/me/watchlist`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ movie_id: id }),
+  });
+  if (!response.ok) {
+    setStatus("library", (await readError(response, "Unable to update watchlist")).message, "error");
+    return;
+  }
+  setStatus("library", "Added to watchlist", "success");
+  loadWatchlist();
+}
+
+async function removeFromWatchlist(id) {
+  const response = await authFetch(`${apiBase}/me/watchlist/${encodeURIComponent(id)}`, { method: "DELETE" });
+  if (!response.ok) {
+    setStatus("library", (await readError(response, "Unable to update watchlist")).message, "error");
+    return;
+  }
+  loadWatchlist();
+}
+
+async function loadAlerts() {
+  const list = document.getElementById("alerts");
+  try {
+    const response = await authFetch(`${apiBase}/me/alerts`);
+    if (!response.ok) {
+      throw await readError(response, "Could not load alerts");
+    }
+    const data = await response.json();
+    list.innerHTML = "";
+    if (data.alerts.length === 0) {
+      list.innerHTML = "<li>No alerts yet.</li>";
+      return;
+    }
+    data.alerts.forEach((alert) => {
+      const item = document.createElement("li");
+      const criteria = [alert.genre, alert.keywords && `"${alert.keywords}"`].filter(Boolean).join(" + ");
+      const remove = document.createElement("button");
+      remove.type = "button";
+      remove.className = "link-button";
+      remove.textContent = "remove";
+      remove.addEventListener("click", () => deleteAlert(alert.id));
+      item.append(`${alert.name}: ${criteria} `, remove);
+      list.appendChild(item);
+    });
+  } catch (error) {
+    setStatus("library", error.message, "error");
+  }
+}
+
+async function handleCreateAlert(event) {
+  event.preventDefault();
+  const payload = {};
+  new FormData(event.target).forEach((value, key) => {
+    if (value.trim()) payload[key] = value.trim();
+  });
+  try {
+    const response = await authFetch(`${apiBase}/me/alerts`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(payload),
+    });
+    if (!response.ok) {
+      throw await readError(response, "Unable to create alert");
+    }
+    event.target.reset();
+    setStatus("library", "Alert created", "success");
+    loadAlerts();
+  } catch (error) {
+    setStatus("library", error.message, "error");
+  }
+}
+
+async function deleteAlert(id) {
+  const response = await authFetch(`${apiBase}/me/alerts/${id}`, { method: "DELETE" });
+  if (!response.ok) {
+    setStatus("library", (await readError(response, "Unable to remove alert")).message, "error");
+    return;
+  }
+  loadAlerts();
+}
+
+function describeCredits(movie) {
+  const pieces = [];
+  if (movie.directors && movie.directors.length) {
+    pieces.push(`Directed by ${movie.directors.map((person) => person.name).join(", ")}`);
+  }
+  if (movie.cast && movie.cast.length) {
+    pieces.push(`Starring ${movie.cast.slice(0, 3).map((person) => person.name).join(", ")}`);
+  }
+  return pieces.join(" • ");
+}
+
+// Credits are edited one person per line as "Name" or "Name: Role".
+function parseCredits(text) {
+  return text
+    .split("\n")
+    .map((line) => line.trim())
+    .filter(Boolean)
+    .map((line) => {
+      const separator = line.indexOf(":");
+      if (separator === -1) {
+        return { name: line };
+      }
+      return {
+        name: line.slice(0, separator).trim(),
+        role: line.slice(separator + 1).trim(),
+      };
+    });
+}
+
+function formatCredits(people) {
+  return (people || [])
+    .map((person) => (person.role ? `${person.name}: ${person.role}` : person.name))
+    .join("\n");
+}
+
 function updatePagination(pagination) {
   if (!pagination) {
     pageInfo.textContent = "";
@@ -88,7 +712,11 @@ function readForm(form) {
   const payload = {};
   data.forEach((value, key) => {
     if (value === "") return;
-    if (key === "rating" || key === "release_year") {
+    if (key === "directors" || key === "cast" || key === "crew") {
+      payload[key] = parseCredits(value);
+    } else if (key === "genres" || key === "providers") {
+      payload[key] = value.split(",").map((item) => item.trim()).filter(Boolean);
+    } else if (key === "rating" || key === "release_year") {
       const numeric = Number(value);
       if (!Number.isNaN(numeric)) {
         payload[key] = numeric;
@@ -115,14 +743,30 @@ async function handleCreate(event) {
   const payload = readForm(event.target);
   setStatus("create", "Creating movie...");
   try {
-    const response = await fetch(`${apiBase}/movies`, {
-      method: "POST",
-      headers: { "Content-Type": "application/json" },
-      body: JSON.stringify(payload),
-    });
+    const create = (query = "") =>
+      editorFetch(`${apiBase}/movies${query}`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(payload),
+      });
+    let response = await create();
+    if (response.status === 409) {
+      const conflict = await response.json().catch(() => ({}));
+      const similar = (conflict.duplicates || [])
+        .map((movie) => `${movie.title} (${movie.release_year || "year unknown"}, id ${movie.id})`)
+        .join("\n");
+      if (!similar) {
+        throw new Error(errorMessage(conflict, "Unable to create movie"));
+      }
+      if (!window.confirm(`Similar movies already exist:\n${similar}\n\nCreate it anyway?`)) {
+        setStatus("create", "Not created", "error");
+        return;
+      }
+      response = await create("?force=true");
+    }
     if (!response.ok) {
       const error = await response.json().catch(() => ({}));
-      throw new Error(error.error || "Unable to create movie");
+      throw new Error(errorMessage(error, "Unable to create movie"));
     }
     const movie = await response.json();
     setStatus("create", `Created movie with id ${movie.id}`, "success");
@@ -151,11 +795,17 @@ async function handleLoadMovie() {
     form.querySelector('input[name="title"]').value = movie.title || "";
     form.querySelector('textarea[name="description"]').value =
       movie.description || "";
-    form.querySelector('input[name="genre"]').value = movie.genre || "";
+    form.querySelector('input[name="genres"]').value = (movie.genres || []).join(", ");
     form.querySelector('input[name="rating"]').value =
       movie.rating ?? "";
     form.querySelector('input[name="release_year"]').value =
       movie.release_year ?? "";
+    form.querySelector('input[name="poster_url"]').value = movie.poster_url || "";
+    form.querySelector('input[name="collection"]').value = movie.collection || "";
+    form.querySelector('input[name="providers"]').value = (movie.providers || []).join(", ");
+    form.querySelector('textarea[name="directors"]').value = formatCredits(movie.directors);
+    form.querySelector('textarea[name="cast"]').value = formatCredits(movie.cast);
+    form.querySelector('textarea[name="crew"]').value = formatCredits(movie.crew);
     setStatus("update", "Movie loaded", "success");
   } catch (error) {
     setStatus("update", error.message, "error");
@@ -174,14 +824,14 @@ async function handleUpdate(event) {
   delete payload.id;
   setStatus("update", "Updating movie...");
   try {
-    const response = await fetch(`${apiBase}/movies/${id}`, {
+    const response = await editorFetch(`${apiBase}/movies/${id}`, {
       method: "PUT",
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify(payload),
     });
     if (!response.ok) {
       const error = await response.json().catch(() => ({}));
-      throw new Error(error.error || "Unable to update movie");
+      throw new Error(errorMessage(error, "Unable to update movie"));
     }
     setStatus("update", "Movie updated", "success");
     searchMovies();
@@ -199,14 +849,15 @@ async function handleDelete(event) {
   }
   setStatus("delete", "Deleting movie...");
   try {
-    const response = await fetch(`${apiBase}/movies/${id}`, {
+    const response = await editorFetch(`${apiBase}/movies/${id}`, {
       method: "DELETE",
     });
     if (response.status === 404) {
       throw new Error("Movie not found");
     }
     if (!response.ok) {
-      throw new Error("Unable to delete movie");
+      const error = await response.json().catch(() => ({}));
+      throw new Error(errorMessage(error, "Unable to delete movie"));
     }
     setStatus("delete", "Movie deleted", "success");
     event.target.reset();
@@ -216,11 +867,70 @@ async function handleDelete(event) {
   }
 }
 
+async function handleRestore() {
+  const form = document.getElementById("delete-form");
+  const id = form.querySelector('input[name="id"]').value.trim();
+  if (!id) {
+    setStatus("delete", "Movie ID is required", "error");
+    return;
+  }
+  setStatus("delete", "Restoring movie...");
+  try {
+    const response = await editorFetch(`${apiBase}/movies/${id}/restore`, {
+      method: "POST",
+    });
+    if (response.status === 404) {
+      throw new Error("Movie not found");
+    }
+    if (!response.ok) {
+      const error = await response.json().catch(() => ({}));
+      throw new Error(errorMessage(error, "Unable to restore movie"));
+    }
+    const movie = await response.json();
+    setStatus("delete", `Restored "${movie.title}"`, "success");
+    form.reset();
+    searchMovies();
+  } catch (error) {
+    setStatus("delete", error.message, "error");
+  }
+}
+
 function setupEventListeners() {
   document.getElementById("search-form").addEventListener("submit", (event) => {
     event.preventDefault();
     currentQuery = document.getElementById("search-query").value;
     currentPageSize = Number(document.getElementById("page-size").value);
+    currentSort = document.getElementById("sort").value;
+    currentPerson = document.getElementById("search-person").value;
+    currentProvider = providerSelect.value;
+    currentMode = document.getElementById("mode").value;
+    currentGroupBy = document.getElementById("group-by-collection").checked ? "collection" : "";
+    currentSavedSearch = null;
+    currentPage = 1;
+    searchMovies();
+  });
+
+  document.getElementById("sort").addEventListener("change", (event) => {
+    currentSort = event.target.value;
+    currentSavedSearch = null;
+    currentPage = 1;
+    searchMovies();
+  });
+
+  providerSelect.addEventListener("change", (event) => {
+    currentProvider = event.target.value;
+    currentSavedSearch = null;
+    currentPage = 1;
+    searchMovies();
+  });
+
+  document.getElementById("search-query").addEventListener("input", (event) => {
+    queueSuggestions(event.target.value);
+  });
+
+  didYouMeanText.addEventListener("click", () => {
+    currentQuery = didYouMeanText.textContent;
+    document.getElementById("search-query").value = currentQuery;
     currentPage = 1;
     searchMovies();
   });
@@ -239,13 +949,42 @@ function setupEventListeners() {
     }
   });
 
+  document.getElementById("top-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    loadTopRated();
+  });
+  document.getElementById("random-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    loadRandomMovie();
+  });
+
+  document.getElementById("auth-form").addEventListener("submit", handleAuth);
+  document.getElementById("sign-out").addEventListener("click", signOut);
+  document.getElementById("save-search-form").addEventListener("submit", handleSaveSearch);
+  document.getElementById("alert-form").addEventListener("submit", handleCreateAlert);
+
+  const apiKeyInput = document.getElementById("api-key");
+  apiKeyInput.value = apiKey;
+  apiKeyInput.addEventListener("change", (event) => {
+    apiKey = event.target.value.trim();
+    if (apiKey) {
+      localStorage.setItem("apiKey", apiKey);
+    } else {
+      localStorage.removeItem("apiKey");
+    }
+  });
   document.getElementById("create-form").addEventListener("submit", handleCreate);
   document.getElementById("update-form").addEventListener("submit", handleUpdate);
   document.getElementById("delete-form").addEventListener("submit", handleDelete);
+  document.getElementById("restore-movie").addEventListener("click", handleRestore);
   document.getElementById("load-movie").addEventListener("click", handleLoadMovie);
 }
 
 document.addEventListener("DOMContentLoaded", () => {
   setupEventListeners();
+  connectLiveSearch();
+  renderLibrary();
   searchMovies();
+  loadTrending();
+  loadTopRated();
 });
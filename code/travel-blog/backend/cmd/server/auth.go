@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scopeAnonymous = ""
+	scopeReadOnly  = "read-only"
+	scopeReadWrite = "read-write"
+	scopeAdmin     = "admin"
+)
+
+const apiTokenPrefix = "tb_"
+
+var scopeRank = map[string]int{
+	scopeAnonymous: 0,
+	scopeReadOnly:  1,
+	scopeReadWrite: 2,
+	scopeAdmin:     3,
+}
+
+// APIToken is stored as a SHA-256 hash; the plain token is returned once.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// authConfig leaves authentication off unless ADMIN_TOKEN is set.
+type authConfig struct {
+	adminToken  string
+	publicReads bool
+}
+
+func authConfigFromEnv() authConfig {
+	config := authConfig{adminToken: strings.TrimSpace(os.Getenv("ADMIN_TOKEN")), publicReads: true}
+	if raw := os.Getenv("PUBLIC_READS"); raw != "" {
+		if value, err := strconv.ParseBool(raw); err == nil {
+			config.publicReads = value
+		}
+	}
+	return config
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *App) requiredScope(c *gin.Context) string {
+	path := c.FullPath()
+	switch {
+	case path == "/api/health":
+		return scopeAnonymous
+	case strings.HasPrefix(path, "/api/tokens"), strings.HasPrefix(path, "/api/admin/"):
+		return scopeAdmin
+	}
+	if isViewBeacon(c) {
+		return a.readScope()
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return a.readScope()
+	default:
+		return scopeReadWrite
+	}
+}
+
+func (a *App) readScope() string {
+	if a.auth.publicReads {
+		return scopeAnonymous
+	}
+	return scopeReadOnly
+}
+
+func (a *App) authenticate(c *gin.Context) {
+	if a.auth.adminToken == "" {
+		c.Next()
+		return
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if token == "" && c.Request.Method == http.MethodGet && c.FullPath() == "/api/events" {
+		// EventSource cannot set headers. Only here, since request logs record the URL.
+		token = c.Query("access_token")
+	}
+
+	scope := scopeAnonymous
+	if token != "" {
+		var err error
+		scope, err = a.tokenScope(c, token)
+		if err != nil {
+			respondError(c, err)
+			c.Abort()
+			return
+		}
+		if scope == scopeAnonymous {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or revoked API token"})
+			return
+		}
+	}
+
+	needed := a.requiredScope(c)
+	if scopeRank[scope] < scopeRank[needed] {
+		if scope == scopeAnonymous {
+			c.Header("WWW-Authenticate", `Bearer realm="travel-blog"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "an API token is required"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this token's scope (" + scope + ") does not allow " + needed + " access"})
+		return
+	}
+	c.Next()
+}
+
+func (a *App) tokenScope(c *gin.Context, token string) (string, error) {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.auth.adminToken)) == 1 {
+		return scopeAdmin, nil
+	}
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return scopeAnonymous, nil
+	}
+
+	var id int64
+	var scope string
+	err := a.conn(c).QueryRow(`SELECT id, scope FROM api_tokens WHERE token_hash=$1 AND revoked_at IS NULL`, hashToken(token)).
+		Scan(&id, &scope)
+	if err == sql.ErrNoRows {
+		return scopeAnonymous, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Record usage at most once a minute so busy scripts do not write on every request.
+	_, err = a.conn(c).Exec(`UPDATE api_tokens SET last_used_at = NOW()
+        WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`, id)
+	return scope, err
+}
+
+func (a *App) createToken(c *gin.Context) {
+	var input struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	var errs validationErrors
+	name := errs.requiredText("name", input.Name, maxNameLength)
+	scope := strings.TrimSpace(input.Scope)
+	if scope == "" {
+		scope = scopeReadOnly
+	}
+	if scope != scopeReadOnly && scope != scopeReadWrite {
+		errs.add("scope", "must be %s or %s", scopeReadOnly, scopeReadWrite)
+	}
+	if len(errs) > 0 {
+		respondValidation(c, errs)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		respondError(c, err)
+		return
+	}
+	token := APIToken{Name: name, Scope: scope, Token: apiTokenPrefix + hex.EncodeToString(secret)}
+	token.Prefix = token.Token[:len(apiTokenPrefix)+8]
+
+	err := a.conn(c).QueryRow(`INSERT INTO api_tokens(name, scope, prefix, token_hash) VALUES($1, $2, $3, $4)
+        RETURNING id, created_at`, token.Name, token.Scope, token.Prefix, hashToken(token.Token)).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+func (a *App) listTokens(c *gin.Context) {
+	rows, err := a.conn(c).Query(`SELECT id, name, scope, prefix, created_at, last_used_at, revoked_at
+        FROM api_tokens ORDER BY created_at DESC`)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var token APIToken
+		if err := rows.Scan(&token.ID, &token.Name, &token.Scope, &token.Prefix, &token.CreatedAt, &token.LastUsedAt, &token.RevokedAt); err != nil {
+			respondError(c, err)
+			return
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, tokens)
+}
+
+func (a *App) revokeToken(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := a.conn(c).Exec(`UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id=$1`, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxCachedResponses = 256
+
+// responseCache is cleared by writes through the API; others (seed, another
+// replica) show up only when entries expire.
+type responseCache struct {
+	ttl    time.Duration
+	maxAge time.Duration
+
+	mu           sync.Mutex
+	generation   int64
+	lastModified time.Time
+	entries      map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+func newResponseCacheFromEnv() *responseCache {
+	return &responseCache{
+		ttl:          envDuration("RESPONSE_CACHE_TTL", 0),
+		maxAge:       envDuration("HTTP_CACHE_MAX_AGE", 0),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		entries:      map[string]cachedResponse{},
+	}
+}
+
+func (rc *responseCache) invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.generation++
+	// HTTP dates have one-second resolution, so a write must not share the previous Last-Modified second.
+	now := time.Now().UTC().Truncate(time.Second)
+	if !now.After(rc.lastModified) {
+		now = rc.lastModified.Add(time.Second)
+	}
+	rc.lastModified = now
+	rc.entries = map[string]cachedResponse{}
+}
+
+func (rc *responseCache) modified() (time.Time, int64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.lastModified, rc.generation
+}
+
+func (rc *responseCache) get(key string) (cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	entry, ok := rc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return cachedResponse{}, false
+	}
+	return entry, true
+}
+
+func (rc *responseCache) put(key string, generation int64, entry cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if generation != rc.generation {
+		return
+	}
+	if len(rc.entries) >= maxCachedResponses {
+		now := time.Now()
+		for k, e := range rc.entries {
+			if now.After(e.expires) {
+				delete(rc.entries, k)
+			}
+		}
+		if len(rc.entries) >= maxCachedResponses {
+			return
+		}
+	}
+	entry.expires = time.Now().Add(rc.ttl)
+	rc.entries[key] = entry
+}
+
+// cacheHeaders adds Cache-Control and Last-Modified to content reads, answers
+// If-Modified-Since with 304, and clears the cache after successful writes.
+// View beacons are not writes here; the view counter clears it when it
+// flushes their counts.
+func (a *App) cacheHeaders(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.Next()
+		if c.Request.Method != http.MethodOptions && !isViewBeacon(c) && c.Writer.Status() < http.StatusBadRequest {
+			a.cache.invalidate()
+		}
+		return
+	}
+	if !cacheableRead(c.FullPath()) {
+		c.Next()
+		return
+	}
+
+	lastModified, _ := a.cache.modified()
+	visibility := "public"
+	if a.auth.adminToken != "" && !a.auth.publicReads {
+		visibility = "private"
+	}
+	if a.cache.maxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, int(a.cache.maxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", visibility+", no-cache")
+	}
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	c.Writer.Header().Add("Vary", "Accept")
+
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !lastModified.After(since) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	c.Next()
+}
+
+func cacheableRead(path string) bool {
+	switch {
+	case path == "", path == "/api/health", path == "/api/events":
+		return false
+	case strings.HasPrefix(path, "/api/tokens"), strings.HasPrefix(path, uploadsPath):
+		return false
+	}
+	return true
+}
+
+func (a *App) cacheResponse(c *gin.Context) {
+	if a.cache.ttl <= 0 {
+		c.Next()
+		return
+	}
+
+	key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode() + "|" + c.GetHeader("Accept")
+	if entry, ok := a.cache.get(key); ok {
+		c.Header("X-Cache", "HIT")
+		c.Data(entry.status, entry.contentType, entry.body)
+		c.Abort()
+		return
+	}
+
+	_, generation := a.cache.modified()
+	writer := &captureWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Header("X-Cache", "MISS")
+	c.Next()
+
+	if writer.Status() == http.StatusOK {
+		a.cache.put(key, generation, cachedResponse{
+			status:      http.StatusOK,
+			contentType: writer.Header().Get("Content-Type"),
+			body:        writer.body.Bytes(),
+		})
+	}
+}
+
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, lastModified: time.Now().UTC().Truncate(time.Second), entries: map[string]cachedResponse{}}
+}
+
+func TestCacheHeadersNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := &App{cache: newTestCache(0)}
+	router := gin.New()
+	router.Use(app.cacheHeaders)
+	router.GET("/api/countries", func(c *gin.Context) { c.JSON(http.StatusOK, []Country{}) })
+	router.POST("/api/countries", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	router.POST("/api/countries/:id/view", func(c *gin.Context) { c.Status(http.StatusAccepted) })
+	router.GET("/api/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(method, path, since string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	first := serve(http.MethodGet, "/api/countries", "")
+	lastModified := first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || lastModified == "" || first.Header().Get("Cache-Control") != "public, no-cache" {
+		t.Fatalf("expected 200 with Last-Modified and no-cache, got %d %v", first.Code, first.Header())
+	}
+
+	tests := []struct {
+		name       string
+		since      string
+		wantStatus int
+	}{
+		{name: "unchanged", since: lastModified, wantStatus: http.StatusNotModified},
+		{name: "older copy", since: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), wantStatus: http.StatusOK},
+		{name: "unparsable date", since: "yesterday", wantStatus: http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := serve(http.MethodGet, "/api/countries", tc.since); res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, res.Code)
+			}
+		})
+	}
+
+	if res := serve(http.MethodGet, "/api/health", lastModified); res.Code != http.StatusOK || res.Header().Get("Last-Modified") != "" {
+		t.Fatalf("expected health to skip the cache headers, got %d %v", res.Code, res.Header())
+	}
+	serve(http.MethodPost, "/api/countries/1/view", "")
+	if res := serve(http.MethodGet, "/api/countries", lastModified); res.Code != http.StatusNotModified {
+		t.Fatalf("expected a view beacon not to count as a write, got %d", res.Code)
+	}
+	serve(http.MethodPost, "/api/countries", "")
+	if res := serve(http.MethodGet, "/api/countries", lastModified); res.Code != http.StatusOK {
+		t.Fatalf("expected a write to end the 304s, got %d", res.Code)
+	}
+}
+
+func TestResponseCachePutSkipsStaleGeneration(t *testing.T) {
+	cache := newTestCache(time.Minute)
+
+	_, before := cache.modified()
+	cache.invalidate()
+	cache.put("/api/countries?|", before, cachedResponse{status: http.StatusOK, body: []byte("stale")})
+	if _, ok := cache.get("/api/countries?|"); ok {
+		t.Fatalf("expected a response built before a write to be dropped")
+	}
+
+	_, current := cache.modified()
+	cache.put("/api/countries?|", current, cachedResponse{status: http.StatusOK, body: []byte("fresh")})
+	entry, ok := cache.get("/api/countries?|")
+	if !ok || string(entry.body) != "fresh" {
+		t.Fatalf("expected the current response to be cached, got %q (%v)", entry.body, ok)
+	}
+
+	cache.invalidate()
+	if _, ok := cache.get("/api/countries?|"); ok {
+		t.Fatalf("expected invalidate to clear the entries")
+	}
+}
+
+func TestResponseCacheInvalidateMovesBySecond(t *testing.T) {
+	cache := newTestCache(0)
+	// A Last-Modified ahead of the clock stands in for writes within one second.
+	ahead := time.Now().UTC().Truncate(time.Second).Add(time.Minute)
+	cache.lastModified = ahead
+
+	cache.invalidate()
+	first, _ := cache.modified()
+	cache.invalidate()
+	second, _ := cache.modified()
+
+	if !first.Equal(ahead.Add(time.Second)) || !second.Equal(ahead.Add(2*time.Second)) {
+		t.Fatalf("expected each write to move Last-Modified by a second, got %s then %s", first, second)
+	}
+	if first.Nanosecond() != 0 || second.Nanosecond() != 0 {
+		t.Fatalf("expected whole seconds, got %s and %s", first, second)
+	}
+}
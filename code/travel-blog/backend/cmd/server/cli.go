@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage: server <command> [flags]
+
+Commands:
+  serve                        start the HTTP API (default)
+  migrate up|down              create or drop the database schema
+  seed --file <path>           load countries and places from a JSON file
+  export --format json [--output <path>]
+                               write all countries and places to stdout or a file
+
+All commands read DATABASE_URL.
+`)
+}
+
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: server migrate up|down")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	app := &App{db: db}
+	switch args[0] {
+	case "up":
+		if err := app.ensureSchema(); err != nil {
+			return err
+		}
+		log.Print("schema is up to date")
+	case "down":
+		if err := app.dropSchema(); err != nil {
+			return err
+		}
+		log.Print("schema dropped")
+	default:
+		return fmt.Errorf("unknown direction %q, expected up or down", args[0])
+	}
+	return nil
+}
+
+func (a *App) dropSchema() error {
+	queries := []string{
+		`DROP TABLE IF EXISTS api_tokens;`,
+		`DROP TABLE IF EXISTS translations;`,
+		`DROP TABLE IF EXISTS places;`,
+		`DROP TABLE IF EXISTS countries;`,
+		`DROP FUNCTION IF EXISTS set_updated_at();`,
+	}
+	for _, q := range queries {
+		if _, err := a.db.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type seedCountry struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	ISOCode       string `json:"iso_code"`
+	CoverImageURL string `json:"cover_image_url"`
+	AccentColor   string `json:"accent_color"`
+	Archived      bool   `json:"archived"`
+	Pinned        bool   `json:"pinned"`
+	Position      int    `json:"position"`
+	Places        []struct {
+		Name         string       `json:"name"`
+		Category     string       `json:"category"`
+		City         string       `json:"city"`
+		Description  string       `json:"description"`
+		Latitude     *float64     `json:"latitude"`
+		Longitude    *float64     `json:"longitude"`
+		VisitedAt    *string      `json:"visited_at"`
+		WebsiteURL   string       `json:"website_url"`
+		MapsURL      string       `json:"maps_url"`
+		Phone        string       `json:"phone"`
+		OpeningHours OpeningHours `json:"opening_hours"`
+		Status       string       `json:"status"`
+	} `json:"places"`
+}
+
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := flags.String("file", "", "path to a JSON array of countries with nested places")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("--file is required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var countries []seedCountry
+	if err := json.Unmarshal(data, &countries); err != nil {
+		return fmt.Errorf("parse %s: %w", *file, err)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	app := &App{db: db}
+	if err := app.ensureSchema(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	places, skipped := 0, 0
+	for _, country := range countries {
+		var errs validationErrors
+		name := errs.requiredText("name", country.Name, maxNameLength)
+		countryDescription := errs.optionalText("description", country.Description, maxDescriptionLength)
+		isoCode := errs.isoCode("iso_code", country.ISOCode)
+		coverImageURL := errs.imageURL("cover_image_url", country.CoverImageURL)
+		accentColor := errs.accentColor("accent_color", country.AccentColor)
+		if err := errs.err(); err != nil {
+			return fmt.Errorf("seed country %q: %w", country.Name, err)
+		}
+
+		// Reuse an existing country with the same name so seeding is repeatable.
+		var countryID int64
+		err := tx.QueryRow(`SELECT id FROM countries WHERE LOWER(name) = LOWER($1)`, name).Scan(&countryID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(`INSERT INTO countries(name, description, iso_code, cover_image_url, accent_color, archived, pinned, position)
+                VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+				name, countryDescription, isoCode, coverImageURL, accentColor, country.Archived, country.Pinned, country.Position).Scan(&countryID)
+		}
+		if err != nil {
+			return fmt.Errorf("seed country %s: %w", name, err)
+		}
+
+		for _, place := range country.Places {
+			var errs validationErrors
+			placeName := errs.requiredText("name", place.Name, maxNameLength)
+			category := errs.category("category", place.Category)
+			city := errs.optionalText("city", place.City, maxCityLength)
+			description := errs.optionalText("description", place.Description, maxDescriptionLength)
+			errs.coordinates(place.Latitude, place.Longitude)
+			websiteURL := errs.webURL("website_url", place.WebsiteURL)
+			mapsURL := errs.mapsURL("maps_url", place.MapsURL)
+			phone := errs.phone("phone", place.Phone)
+			hours := errs.openingHours("opening_hours", place.OpeningHours)
+
+			// Exports write RFC 3339, hand-written files usually plain dates.
+			var visitedAt *time.Time
+			if place.VisitedAt != nil && *place.VisitedAt != "" {
+				t, err := time.Parse(time.RFC3339, *place.VisitedAt)
+				if err == nil {
+					errs.checkVisitDate("visited_at", t)
+					visitedAt = &t
+				} else {
+					visitedAt = errs.visitDate("visited_at", place.VisitedAt)
+				}
+			}
+			status := errs.placeStatus("status", place.Status, visitedAt)
+			if err := errs.err(); err != nil {
+				return fmt.Errorf("seed place %s: %w", place.Name, err)
+			}
+
+			// Places already in the country under the same name are skipped.
+			res, err := tx.Exec(`INSERT INTO places(country_id, name, category, city, description, latitude, longitude, visited_at,
+                    website_url, maps_url, phone, opening_hours, status)
+                SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+                WHERE NOT EXISTS (SELECT 1 FROM places WHERE country_id = $1 AND LOWER(name) = LOWER($2))`,
+				countryID, placeName, category, city, description, place.Latitude, place.Longitude, visitedAt,
+				websiteURL, mapsURL, phone, hours, status)
+			if err != nil {
+				return fmt.Errorf("seed place %s: %w", place.Name, err)
+			}
+			if inserted, _ := res.RowsAffected(); inserted > 0 {
+				places++
+			} else {
+				skipped++
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("seeded %d countries and %d places from %s, skipped %d existing places", len(countries), places, *file, skipped)
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "json", "output format (json)")
+	output := flags.String("output", "", "file to write instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" {
+		return fmt.Errorf("unsupported format %q, only json is available", *format)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	app := &App{db: db}
+	countries, err := fetchCountries(app.db)
+	if err != nil {
+		return err
+	}
+	if countries == nil {
+		countries = []Country{}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(countries)
+}
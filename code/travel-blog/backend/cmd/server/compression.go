@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultCompressionMinBytes = 1024
+
+var (
+	gzipWriters   = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(io.Discard, 5) }}
+)
+
+func compressionMinBytes() int {
+	raw := os.Getenv("COMPRESSION_MIN_BYTES")
+	if raw == "" {
+		return defaultCompressionMinBytes
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 0 {
+		log.Printf("ignoring invalid COMPRESSION_MIN_BYTES %q", raw)
+		return defaultCompressionMinBytes
+	}
+	return size
+}
+
+func compressResponses(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minBytes: minBytes}
+		c.Writer = writer
+		defer func() {
+			if err := writer.close(); err != nil {
+				log.Printf("compression: %v", err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch name {
+		case "*":
+			name = "br"
+		case "br", "gzip":
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	if bestQ <= 0 {
+		return ""
+	}
+	return best
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minBytes int
+	buf      bytes.Buffer
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() >= w.minBytes {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush decides right away so streamed responses are never held in the buffer.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(w.buf.Len() >= w.minBytes); err != nil {
+			log.Printf("compression: %v", err)
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			log.Printf("compression: %v", err)
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" && compressibleType(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.encoder = w.newEncoder()
+	}
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	buffered := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	_, err := w.Write(buffered)
+	return err
+}
+
+func (w *compressWriter) newEncoder() io.WriteCloser {
+	if w.encoding == "br" {
+		encoder := brotliWriters.Get().(*brotli.Writer)
+		encoder.Reset(w.ResponseWriter)
+		return pooledEncoder{encoder, &brotliWriters}
+	}
+	encoder := gzipWriters.Get().(*gzip.Writer)
+	encoder.Reset(w.ResponseWriter)
+	return pooledEncoder{encoder, &gzipWriters}
+}
+
+func (w *compressWriter) close() error {
+	if !w.decided {
+		return w.decide(false)
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type pooledEncoder struct {
+	flushWriteCloser
+	pool *sync.Pool
+}
+
+func (e pooledEncoder) Close() error {
+	err := e.flushWriteCloser.Close()
+	e.pool.Put(e.flushWriteCloser)
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const uploadsPath = "/api/uploads"
+
+const maxCoverBytes = 5 << 20
+
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+func uploadDir() string {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+func (a *App) uploadCover(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCoverBytes+1<<20)
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		respondValidation(c, validationErrors{{Field: "image", Message: "is required as a multipart file"}})
+		return
+	}
+	defer file.Close()
+	if header.Size > maxCoverBytes {
+		respondValidation(c, validationErrors{{Field: "image", Message: fmt.Sprintf("must be at most %d MiB", maxCoverBytes>>20)}})
+		return
+	}
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ext, ok := coverExtensions[http.DetectContentType(sniff[:n])]
+	if !ok {
+		respondValidation(c, validationErrors{{Field: "image", Message: "must be a JPEG, PNG, GIF, or WebP image"}})
+		return
+	}
+
+	var previous string
+	if err := a.conn(c).QueryRow(`SELECT cover_image_url FROM countries WHERE id=$1`, id).Scan(&previous); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		respondError(c, err)
+		return
+	}
+	name := fmt.Sprintf("country-%d-%s%s", id, hex.EncodeToString(suffix), ext)
+	path := filepath.Join(uploadDir(), name)
+
+	if err := writeUpload(path, io.MultiReader(bytes.NewReader(sniff[:n]), file)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var country *Country
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		if _, err := tx.Exec(`UPDATE countries SET cover_image_url=$1 WHERE id=$2`, uploadsPath+"/"+name, id); err != nil {
+			return err
+		}
+		var err error
+		country, err = fetchCountry(tx, id)
+		return err
+	})
+	if err != nil {
+		os.Remove(path)
+		respondError(c, err)
+		return
+	}
+
+	removeUpload(previous)
+	a.contentChanged("updated", "country", id, id)
+
+	a.respond(c, http.StatusOK, country)
+}
+
+func writeUpload(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func removeUpload(coverURL string) {
+	name, ok := strings.CutPrefix(coverURL, uploadsPath+"/")
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) {
+		return
+	}
+	if err := os.Remove(filepath.Join(uploadDir(), name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("uploads: remove %s: %v", name, err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultDuplicateThreshold = 0.4
+
+type DuplicatePlaces struct {
+	Place      Place   `json:"place"`
+	Duplicate  Place   `json:"duplicate"`
+	Similarity float64 `json:"similarity"`
+}
+
+var (
+	errMergeSamePlace    = errors.New("a place cannot be merged into itself")
+	errMergeOtherCountry = errors.New("places in different countries cannot be merged")
+)
+
+func (a *App) listDuplicatePlaces(c *gin.Context) {
+	countryID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	threshold := defaultDuplicateThreshold
+	if raw := c.Query("threshold"); raw != "" {
+		threshold, err = strconv.ParseFloat(raw, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a number greater than 0 and at most 1"})
+			return
+		}
+	}
+
+	country, err := fetchCountry(a.conn(c), countryID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if country == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
+		return
+	}
+
+	rows, err := a.conn(c).Query(`SELECT a.id, b.id, similarity(a.name || ' ' || a.city, b.name || ' ' || b.city) AS score
+        FROM places a
+        JOIN places b ON b.country_id = a.country_id AND b.id > a.id
+        WHERE a.country_id = $1 AND similarity(a.name || ' ' || a.city, b.name || ' ' || b.city) >= $2
+        ORDER BY score DESC, a.id, b.id`, countryID, threshold)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	places := make(map[int64]Place, len(country.Places))
+	for _, place := range country.Places {
+		places[place.ID] = place
+	}
+
+	duplicates := []DuplicatePlaces{}
+	for rows.Next() {
+		var placeID, duplicateID int64
+		var score float64
+		if err := rows.Scan(&placeID, &duplicateID, &score); err != nil {
+			respondError(c, err)
+			return
+		}
+		duplicates = append(duplicates, DuplicatePlaces{
+			Place:      places[placeID],
+			Duplicate:  places[duplicateID],
+			Similarity: score,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, duplicates)
+}
+
+func (a *App) mergePlace(c *gin.Context) {
+	placeID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var input struct {
+		DuplicateID int64 `json:"duplicate_id"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.DuplicateID <= 0 {
+		respondValidation(c, validationErrors{{Field: "duplicate_id", Message: "is required"}})
+		return
+	}
+
+	var kept, duplicate Place
+	refreshWeather := false
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		if placeID == input.DuplicateID {
+			return errMergeSamePlace
+		}
+
+		var err error
+		kept, err = scanPlace(tx.QueryRow(`SELECT `+placeColumns+` FROM places WHERE id=$1 FOR UPDATE`, placeID))
+		if err != nil {
+			return err
+		}
+		duplicate, err = scanPlace(tx.QueryRow(`SELECT `+placeColumns+` FROM places WHERE id=$1 FOR UPDATE`, input.DuplicateID))
+		if err != nil {
+			return err
+		}
+		if duplicate.CountryID != kept.CountryID {
+			return errMergeOtherCountry
+		}
+
+		merged := kept
+		if merged.City == "" {
+			merged.City = duplicate.City
+		}
+		if merged.Description == "" {
+			merged.Description = duplicate.Description
+		}
+		if merged.WebsiteURL == "" {
+			merged.WebsiteURL = duplicate.WebsiteURL
+		}
+		if merged.MapsURL == "" {
+			merged.MapsURL = duplicate.MapsURL
+		}
+		if merged.Phone == "" {
+			merged.Phone = duplicate.Phone
+		}
+		if merged.Hours == nil {
+			merged.Hours = duplicate.Hours
+		}
+		if merged.Latitude == nil && duplicate.Latitude != nil {
+			merged.Latitude, merged.Longitude = duplicate.Latitude, duplicate.Longitude
+			refreshWeather = true
+		}
+		if merged.VisitedAt == nil && duplicate.VisitedAt != nil {
+			merged.VisitedAt, merged.Status = duplicate.VisitedAt, duplicate.Status
+			refreshWeather = true
+		}
+		// A visit on either copy wins; a planned date is not a visit date.
+		if duplicate.Status == statusVisited && merged.Status != statusVisited {
+			merged.Status, merged.VisitedAt = statusVisited, duplicate.VisitedAt
+			refreshWeather = true
+		}
+
+		_, err = tx.Exec(`UPDATE places SET city=$1, description=$2, latitude=$3, longitude=$4, visited_at=$5,
+                website_url=$6, maps_url=$7, phone=$8, opening_hours=$9, view_count=view_count + $10,
+                status=$11
+            WHERE id=$12`,
+			merged.City, merged.Description, merged.Latitude, merged.Longitude, merged.VisitedAt,
+			merged.WebsiteURL, merged.MapsURL, merged.Phone, merged.Hours, duplicate.ViewCount, merged.Status, placeID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE translations SET place_id=$1
+            WHERE place_id=$2 AND locale NOT IN (SELECT locale FROM translations WHERE place_id=$1)`,
+			placeID, input.DuplicateID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM places WHERE id=$1`, input.DuplicateID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errMergeSamePlace), errors.Is(err, errMergeOtherCountry):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err == sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+		default:
+			respondError(c, err)
+		}
+		return
+	}
+
+	if refreshWeather {
+		a.recordWeather(c.Request.Context(), a.conn(c), placeID)
+	}
+	country, err := fetchCountry(a.conn(c), kept.CountryID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	a.contentChanged("deleted", "place", duplicate.ID, duplicate.CountryID)
+	a.contentChanged("updated", "place", kept.ID, kept.CountryID)
+
+	a.respond(c, http.StatusOK, country)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const envelopeMediaType = "application/vnd.travel-blog.envelope+json"
+
+type Envelope struct {
+	Data  interface{}       `json:"data"`
+	Meta  gin.H             `json:"meta"`
+	Links map[string]string `json:"links"`
+}
+
+type pageRequest struct {
+	Page int
+	Size int
+}
+
+func envelopeByDefault() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("RESPONSE_ENVELOPE"))
+	return enabled
+}
+
+func (a *App) wantsEnvelope(c *gin.Context) bool {
+	return a.envelope || strings.Contains(c.GetHeader("Accept"), envelopeMediaType)
+}
+
+func parsePageRequest(c *gin.Context) (pageRequest, error) {
+	var page pageRequest
+	if c.Query("page") == "" && c.Query("page_size") == "" {
+		return page, nil
+	}
+
+	page.Page, page.Size = 1, 20
+	if raw := c.Query("page"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return page, fmt.Errorf("page must be a positive integer")
+		}
+		page.Page = parsed
+	}
+	if raw := c.Query("page_size"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return page, fmt.Errorf("page_size must be between 1 and 100")
+		}
+		page.Size = parsed
+	}
+	return page, nil
+}
+
+func (p pageRequest) offset() int {
+	if p.Size == 0 {
+		return 0
+	}
+	return (p.Page - 1) * p.Size
+}
+
+func (a *App) respond(c *gin.Context, status int, data interface{}) {
+	if !a.wantsEnvelope(c) {
+		respondJSON(c, status, data)
+		return
+	}
+
+	addResourceLinks(data)
+	a.writeEnvelope(c, status, data, gin.H{}, map[string]string{"self": c.Request.URL.RequestURI()})
+}
+
+func (a *App) respondList(c *gin.Context, data interface{}, count, total int, page pageRequest) {
+	if !a.wantsEnvelope(c) {
+		respondJSON(c, http.StatusOK, data)
+		return
+	}
+
+	addResourceLinks(data)
+	meta := gin.H{"count": count, "total": total}
+	links := map[string]string{"self": c.Request.URL.RequestURI()}
+	if page.Size > 0 {
+		totalPages := (total + page.Size - 1) / page.Size
+		meta["page"] = page.Page
+		meta["page_size"] = page.Size
+		meta["total_pages"] = totalPages
+		if page.Page < totalPages {
+			links["next"] = pageLink(c, page.Page+1)
+		}
+		if page.Page > 1 {
+			links["prev"] = pageLink(c, page.Page-1)
+		}
+	}
+	a.writeEnvelope(c, http.StatusOK, data, meta, links)
+}
+
+func (a *App) writeEnvelope(c *gin.Context, status int, data interface{}, meta gin.H, links map[string]string) {
+	if raw := c.Query("fields"); raw != "" {
+		selection := parseFieldSelection(raw)
+		if len(selection) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fields must list at least one field"})
+			return
+		}
+		pruned, err := selection.prune(data)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		data = pruned
+	}
+
+	c.Header("Content-Type", envelopeMediaType)
+	c.JSON(status, Envelope{Data: data, Meta: meta, Links: links})
+}
+
+func pageLink(c *gin.Context, page int) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+func countryLinks(id int64) map[string]string {
+	self := fmt.Sprintf("/api/countries/%d", id)
+	return map[string]string{
+		"self":         self,
+		"translations": self + "/translations",
+	}
+}
+
+func placeLinks(place Place) map[string]string {
+	self := fmt.Sprintf("/api/places/%d", place.ID)
+	return map[string]string{
+		"self":         self,
+		"country":      fmt.Sprintf("/api/countries/%d", place.CountryID),
+		"translations": self + "/translations",
+	}
+}
+
+func addResourceLinks(data interface{}) {
+	switch v := data.(type) {
+	case []Country:
+		for i := range v {
+			addCountryLinks(&v[i])
+		}
+	case *Country:
+		addCountryLinks(v)
+	case *Place:
+		v.Links = placeLinks(*v)
+	}
+}
+
+func addCountryLinks(country *Country) {
+	country.Links = countryLinks(country.ID)
+	for i := range country.Places {
+		country.Places[i].Links = placeLinks(country.Places[i])
+	}
+}
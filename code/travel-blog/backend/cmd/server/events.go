@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventHistorySize  = 256
+	eventHeartbeat    = 15 * time.Second
+	subscriberBacklog = 32
+)
+
+type ContentEvent struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	Entity     string    `json:"entity"`
+	EntityID   int64     `json:"entity_id"`
+	CountryID  int64     `json:"country_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type EventBroker struct {
+	mu sync.Mutex
+	// epoch is the boot time in milliseconds. IDs count up from it, so an ID
+	// from an earlier process is always below it.
+	epoch       int64
+	nextID      int64
+	history     []ContentEvent
+	subscribers map[chan ContentEvent]struct{}
+}
+
+func newEventBroker() *EventBroker {
+	epoch := time.Now().UnixMilli()
+	return &EventBroker{epoch: epoch, nextID: epoch, subscribers: make(map[chan ContentEvent]struct{})}
+}
+
+func (b *EventBroker) Publish(eventType, entity string, entityID, countryID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event := ContentEvent{
+		ID:         b.nextID,
+		Type:       eventType,
+		Entity:     entity,
+		EntityID:   entityID,
+		CountryID:  countryID,
+		OccurredAt: time.Now().UTC(),
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the events after lastID and a channel for new ones. When
+// history cannot cover lastID, because it is from another process, ahead of
+// the newest event, or older than the oldest one kept, resetID is the newest
+// event's ID instead.
+func (b *EventBroker) Subscribe(lastID int64) (missed []ContentEvent, resetID int64, ch chan ContentEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > 0 {
+		oldest := b.nextID + 1
+		if len(b.history) > 0 {
+			oldest = b.history[0].ID
+		}
+		if lastID < b.epoch || lastID > b.nextID || lastID < oldest-1 {
+			resetID = b.nextID
+		} else {
+			for _, event := range b.history {
+				if event.ID > lastID {
+					missed = append(missed, event)
+				}
+			}
+		}
+	}
+
+	ch = make(chan ContentEvent, subscriberBacklog)
+	b.subscribers[ch] = struct{}{}
+	return missed, resetID, ch
+}
+
+func (b *EventBroker) Unsubscribe(ch chan ContentEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (a *App) streamEvents(c *gin.Context) {
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	var since int64
+	if lastID != "" {
+		parsed, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		since = parsed
+	}
+
+	missed, resetID, ch := a.events.Subscribe(since)
+	defer a.events.Unsubscribe(ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if resetID > 0 {
+		if err := writeReset(c, resetID); err != nil {
+			return
+		}
+	}
+	for _, event := range missed {
+		if err := writeEvent(c, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(c, event); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeEvent(c *gin.Context, event ContentEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\ndata: %s\n\n", event.ID, data)
+	return err
+}
+
+// writeReset tells a client that the events it missed cannot be replayed, so
+// it should refetch. The id moves its Last-Event-ID to the current event.
+func writeReset(c *gin.Context, id int64) error {
+	_, err := fmt.Fprintf(c.Writer, "id: %d\nevent: reset\ndata: {\"type\":\"reset\"}\n\n", id)
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestEventBrokerSubscribe(t *testing.T) {
+	broker := newEventBroker()
+	for i := 0; i < eventHistorySize+10; i++ {
+		broker.Publish("updated", "place", int64(i), 1)
+	}
+	oldest := broker.history[0].ID
+	newest := broker.history[len(broker.history)-1].ID
+
+	tests := []struct {
+		name       string
+		lastID     int64
+		wantMissed int
+		wantReset  bool
+	}{
+		{name: "new client", lastID: 0},
+		{name: "up to date", lastID: newest},
+		{name: "a few behind", lastID: newest - 3, wantMissed: 3},
+		{name: "just before the oldest kept", lastID: oldest - 1, wantMissed: eventHistorySize},
+		{name: "older than history", lastID: oldest - 2, wantReset: true},
+		{name: "from an earlier process", lastID: broker.epoch - 1, wantReset: true},
+		{name: "ahead of the newest", lastID: newest + 1, wantReset: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			missed, resetID, ch := broker.Subscribe(tc.lastID)
+			defer broker.Unsubscribe(ch)
+
+			if len(missed) != tc.wantMissed {
+				t.Fatalf("expected %d missed events, got %d", tc.wantMissed, len(missed))
+			}
+			if tc.wantMissed > 0 && missed[len(missed)-1].ID != newest {
+				t.Fatalf("expected replay to end at %d, got %d", newest, missed[len(missed)-1].ID)
+			}
+			if tc.wantReset && resetID != newest {
+				t.Fatalf("expected a reset to %d, got %d", newest, resetID)
+			}
+			if !tc.wantReset && resetID != 0 {
+				t.Fatalf("expected no reset, got one to %d", resetID)
+			}
+		})
+	}
+}
+
+func TestEventBrokerResetsBeforeFirstEvent(t *testing.T) {
+	broker := newEventBroker()
+
+	if _, resetID, ch := broker.Subscribe(broker.epoch); resetID != 0 {
+		t.Fatalf("expected the epoch itself to be covered, got a reset to %d", resetID)
+	} else {
+		broker.Unsubscribe(ch)
+	}
+	if _, resetID, ch := broker.Subscribe(5); resetID != broker.epoch {
+		t.Fatalf("expected an ID from another process to reset to %d, got %d", broker.epoch, resetID)
+	} else {
+		broker.Unsubscribe(ch)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fieldSelection map[string]fieldSelection
+
+func parseFieldSelection(raw string) fieldSelection {
+	root := fieldSelection{}
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		node := root
+		for _, part := range strings.Split(path, ".") {
+			child, ok := node[part]
+			if !ok {
+				child = fieldSelection{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+func (s fieldSelection) apply(value interface{}) interface{} {
+	if len(s) == 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(s))
+		for key, child := range s {
+			if field, ok := v[key]; ok {
+				pruned[key] = child.apply(field)
+			}
+		}
+		return pruned
+	case []interface{}:
+		for i := range v {
+			v[i] = s.apply(v[i])
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func respondJSON(c *gin.Context, status int, v interface{}) {
+	raw := c.Query("fields")
+	if raw == "" {
+		c.JSON(status, v)
+		return
+	}
+
+	selection := parseFieldSelection(raw)
+	if len(selection) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fields must list at least one field"})
+		return
+	}
+
+	pruned, err := selection.prune(v)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(status, pruned)
+}
+
+func (s fieldSelection) prune(v interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return s.apply(generic), nil
+}
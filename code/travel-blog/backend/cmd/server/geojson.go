@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const geoJSONContentType = "application/geo+json"
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string        `json:"type"`
+	ID         int64         `json:"id"`
+	Geometry   *geoJSONPoint `json:"geometry"`
+	Properties gin.H         `json:"properties"`
+}
+
+// geoJSONPoint is in GeoJSON order: longitude, then latitude.
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func newGeoJSONPoint(latitude, longitude float64) *geoJSONPoint {
+	return &geoJSONPoint{Type: "Point", Coordinates: [2]float64{longitude, latitude}}
+}
+
+func respondGeoJSON(c *gin.Context, features []geoJSONFeature) {
+	if features == nil {
+		features = []geoJSONFeature{}
+	}
+	c.Header("Content-Type", geoJSONContentType)
+	c.JSON(http.StatusOK, geoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+}
+
+// countriesGeoJSON places each visited country at the average position of its
+// places, since there are no border shapes in the database.
+func (a *App) countriesGeoJSON(c *gin.Context) {
+	rows, err := a.conn(c).Query(`SELECT c.id, c.name, c.iso_code, c.accent_color, COUNT(p.id),
+            AVG(p.latitude), AVG(p.longitude),
+            MIN(p.visited_at) FILTER (WHERE p.status = 'visited'), MAX(p.visited_at) FILTER (WHERE p.status = 'visited')
+        FROM countries c
+        JOIN places p ON p.country_id = c.id
+        WHERE NOT c.archived
+        GROUP BY c.id
+        HAVING COUNT(*) FILTER (WHERE p.status = 'visited') > 0
+        ORDER BY c.name`)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var features []geoJSONFeature
+	for rows.Next() {
+		var id int64
+		var name, isoCode, accentColor string
+		var places int
+		var latitude, longitude sql.NullFloat64
+		var firstVisit, lastVisit *time.Time
+		if err := rows.Scan(&id, &name, &isoCode, &accentColor, &places, &latitude, &longitude, &firstVisit, &lastVisit); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		feature := geoJSONFeature{
+			Type: "Feature",
+			ID:   id,
+			Properties: gin.H{
+				"name":         name,
+				"iso_code":     isoCode,
+				"accent_color": accentColor,
+				"place_count":  places,
+				"first_visit":  firstVisit,
+				"last_visit":   lastVisit,
+			},
+		}
+		if latitude.Valid && longitude.Valid {
+			feature.Geometry = newGeoJSONPoint(latitude.Float64, longitude.Float64)
+		}
+		features = append(features, feature)
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondGeoJSON(c, features)
+}
+
+func (a *App) placesGeoJSON(c *gin.Context) {
+	query := `SELECT p.id, p.name, p.category, p.city, p.latitude, p.longitude, p.visited_at, p.status, c.id, c.name, c.iso_code
+        FROM places p
+        JOIN countries c ON c.id = p.country_id
+        WHERE NOT c.archived AND p.latitude IS NOT NULL AND p.longitude IS NOT NULL`
+	var args []interface{}
+	if raw := c.Query("country_id"); raw != "" {
+		countryID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "country_id must be an integer"})
+			return
+		}
+		args = append(args, countryID)
+		query += ` AND c.id = $` + strconv.Itoa(len(args))
+	}
+	if category := c.Query("category"); category != "" {
+		args = append(args, category)
+		query += ` AND LOWER(p.category) = LOWER($` + strconv.Itoa(len(args)) + `)`
+	}
+	status, ok := statusQuery(c)
+	if !ok {
+		return
+	}
+	if status != "" {
+		args = append(args, status)
+		query += ` AND p.status = $` + strconv.Itoa(len(args))
+	}
+	query += ` ORDER BY p.id`
+
+	rows, err := a.conn(c).Query(query, args...)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var features []geoJSONFeature
+	for rows.Next() {
+		var id, countryID int64
+		var name, category, city, status, countryName, isoCode string
+		var latitude, longitude float64
+		var visitedAt *time.Time
+		if err := rows.Scan(&id, &name, &category, &city, &latitude, &longitude, &visitedAt, &status, &countryID, &countryName, &isoCode); err != nil {
+			respondError(c, err)
+			return
+		}
+		features = append(features, geoJSONFeature{
+			Type:     "Feature",
+			ID:       id,
+			Geometry: newGeoJSONPoint(latitude, longitude),
+			Properties: gin.H{
+				"name":         name,
+				"category":     category,
+				"city":         city,
+				"visited_at":   visitedAt,
+				"status":       status,
+				"country_id":   countryID,
+				"country_name": countryName,
+				"iso_code":     isoCode,
+			},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondGeoJSON(c, features)
+}
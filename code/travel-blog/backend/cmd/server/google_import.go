@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxImportBytes = 10 << 20
+
+var errDryRun = errors.New("dry run")
+
+var (
+	// mapsPlacePattern reads the place from !3d<lat>!4d<lng>; @<lat>,<lng> is the
+	// viewport and only a fallback.
+	mapsPlacePattern    = regexp.MustCompile(`!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)`)
+	mapsViewportPattern = regexp.MustCompile(`@(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)`)
+	mapsQueryPattern    = regexp.MustCompile(`[?&]q=(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)`)
+)
+
+type importRow struct {
+	Name        string
+	Description string
+	Address     string
+	Country     string
+	ISOCode     string
+	Latitude    *float64
+	Longitude   *float64
+	MapsURL     string
+}
+
+type ImportResult struct {
+	DryRun           bool           `json:"dry_run"`
+	CountriesCreated []string       `json:"countries_created"`
+	Places           []ImportedItem `json:"places"`
+	Created          int            `json:"created"`
+	Skipped          int            `json:"skipped"`
+}
+
+type ImportedItem struct {
+	Row       int      `json:"row"`
+	Name      string   `json:"name"`
+	Country   string   `json:"country"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Status    string   `json:"status"`
+	Reason    string   `json:"reason,omitempty"`
+}
+
+// takeoutCollection covers Takeout's lower-case and title-case keys.
+type takeoutCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			Title          string           `json:"Title"`
+			GoogleMapsURL  string           `json:"google_maps_url"`
+			LegacyMapsURL  string           `json:"Google Maps URL"`
+			Location       *takeoutLocation `json:"location"`
+			LegacyLocation *takeoutLocation `json:"Location"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+type takeoutLocation struct {
+	Name              string `json:"name"`
+	BusinessName      string `json:"Business Name"`
+	Address           string `json:"address"`
+	LegacyAddress     string `json:"Address"`
+	CountryCode       string `json:"country_code"`
+	LegacyCountryCode string `json:"Country Code"`
+	GeoCoordinates    *struct {
+		Latitude  flexFloat `json:"Latitude"`
+		Longitude flexFloat `json:"Longitude"`
+	} `json:"Geo Coordinates"`
+}
+
+// flexFloat accepts quoted coordinates, as in older exports.
+type flexFloat struct {
+	value *float64
+}
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "" || text == "null" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid coordinate %q", text)
+	}
+	f.value = &value
+	return nil
+}
+
+func (a *App) importGoogleMaps(c *gin.Context) {
+	dryRun, err := parseBoolQuery(c, "dry_run")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var errs validationErrors
+	category := errs.category("category", c.DefaultQuery("category", "other"))
+	fallbackCountry := errs.optionalText("country", c.Query("country"), maxNameLength)
+	if len(errs) > 0 {
+		respondValidation(c, errs)
+		return
+	}
+
+	data, err := readImportBody(c)
+	if err != nil {
+		respondValidation(c, validationErrors{{Field: "file", Message: err.Error()}})
+		return
+	}
+	rows, err := parseGoogleMapsExport(data)
+	if err != nil {
+		respondValidation(c, validationErrors{{Field: "file", Message: err.Error()}})
+		return
+	}
+
+	result := ImportResult{DryRun: dryRun, CountriesCreated: []string{}, Places: []ImportedItem{}}
+	touched := map[int64]bool{}
+	var importer *placeImporter
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		var err error
+		importer, err = newPlaceImporter(tx, category)
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			item, countryID, err := importer.add(row, fallbackCountry)
+			if err != nil {
+				return err
+			}
+			item.Row = i + 1
+			if item.Status == "created" {
+				result.Created++
+				touched[countryID] = true
+			} else {
+				result.Skipped++
+			}
+			result.Places = append(result.Places, item)
+		}
+		result.CountriesCreated = append(result.CountriesCreated, importer.createdNames...)
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		respondError(c, err)
+		return
+	}
+
+	if !dryRun {
+		for countryID := range touched {
+			eventType := "updated"
+			if importer.created[countryID] {
+				eventType = "created"
+			}
+			a.contentChanged(eventType, "country", countryID, countryID)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func readImportBody(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes+1<<20)
+
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			return nil, errors.New("is required as a multipart file")
+		}
+		defer file.Close()
+		r = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImportBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportBytes {
+		return nil, fmt.Errorf("must be at most %d MiB", maxImportBytes>>20)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("is required")
+	}
+	return data, nil
+}
+
+func parseGoogleMapsExport(data []byte) ([]importRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseTakeoutGeoJSON(trimmed)
+	}
+	return parseSavedListCSV(data)
+}
+
+func parseTakeoutGeoJSON(data []byte) ([]importRow, error) {
+	var collection takeoutCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("must be a GeoJSON FeatureCollection: %v", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, errors.New("must be a GeoJSON FeatureCollection")
+	}
+
+	rows := make([]importRow, 0, len(collection.Features))
+	for _, feature := range collection.Features {
+		props := feature.Properties
+		location := props.Location
+		if location == nil {
+			location = props.LegacyLocation
+		}
+		if location == nil {
+			location = &takeoutLocation{}
+		}
+
+		row := importRow{
+			Name:    firstNonEmpty(location.Name, location.BusinessName, props.Title),
+			Address: firstNonEmpty(location.Address, location.LegacyAddress),
+			ISOCode: firstNonEmpty(location.CountryCode, location.LegacyCountryCode),
+			MapsURL: firstNonEmpty(props.GoogleMapsURL, props.LegacyMapsURL),
+		}
+		// Takeout writes [0, 0] for places it has no position for.
+		if coords := feature.Geometry.Coordinates; len(coords) >= 2 && (coords[0] != 0 || coords[1] != 0) {
+			longitude, latitude := coords[0], coords[1]
+			row.Latitude, row.Longitude = &latitude, &longitude
+		} else if geo := location.GeoCoordinates; geo != nil && geo.Latitude.value != nil && geo.Longitude.value != nil {
+			row.Latitude, row.Longitude = geo.Latitude.value, geo.Longitude.value
+		}
+		rows = append(rows, row.withDefaults())
+	}
+	return rows, nil
+}
+
+func parseSavedListCSV(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("must be a Google Maps GeoJSON or CSV export: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("has no header row")
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				if value := strings.TrimSpace(record[i]); value != "" {
+					return value
+				}
+			}
+		}
+		return ""
+	}
+	if _, ok := columns["title"]; !ok {
+		if _, ok := columns["name"]; !ok {
+			return nil, errors.New("must have a Title or Name column")
+		}
+	}
+
+	rows := make([]importRow, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := importRow{
+			Name:    field(record, "title", "name"),
+			Address: field(record, "address"),
+			Country: field(record, "country"),
+			ISOCode: field(record, "country code", "country_code", "iso_code"),
+			MapsURL: field(record, "url", "google maps url"),
+		}
+		var notes []string
+		for _, name := range []string{"note", "comment", "description"} {
+			if value := field(record, name); value != "" {
+				notes = append(notes, value)
+			}
+		}
+		row.Description = strings.Join(notes, "\n\n")
+
+		latitude, errLat := strconv.ParseFloat(field(record, "latitude", "lat"), 64)
+		longitude, errLng := strconv.ParseFloat(field(record, "longitude", "lng", "lon"), 64)
+		if errLat == nil && errLng == nil {
+			row.Latitude, row.Longitude = &latitude, &longitude
+		}
+		rows = append(rows, row.withDefaults())
+	}
+	return rows, nil
+}
+
+func (r importRow) withDefaults() importRow {
+	if r.Latitude == nil {
+		r.Latitude, r.Longitude = coordinatesFromMapsURL(r.MapsURL)
+	}
+	parts := strings.Split(r.Address, ",")
+	if r.Country == "" && len(parts) > 1 {
+		r.Country = strings.TrimSpace(parts[len(parts)-1])
+	}
+	if r.Name == "" {
+		r.Name = strings.TrimSpace(parts[0])
+	}
+	return r
+}
+
+func coordinatesFromMapsURL(mapsURL string) (*float64, *float64) {
+	for _, pattern := range []*regexp.Regexp{mapsPlacePattern, mapsQueryPattern, mapsViewportPattern} {
+		match := pattern.FindStringSubmatch(mapsURL)
+		if match == nil {
+			continue
+		}
+		latitude, errLat := strconv.ParseFloat(match[1], 64)
+		longitude, errLng := strconv.ParseFloat(match[2], 64)
+		if errLat == nil && errLng == nil {
+			return &latitude, &longitude
+		}
+	}
+	return nil, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+type placeImporter struct {
+	tx           queryer
+	category     string
+	byName       map[string]int64
+	byISOCode    map[string]int64
+	names        map[int64]string
+	placeNames   map[int64]map[string]bool
+	created      map[int64]bool
+	createdNames []string
+}
+
+func newPlaceImporter(tx queryer, category string) (*placeImporter, error) {
+	importer := &placeImporter{
+		tx:         tx,
+		category:   category,
+		byName:     map[string]int64{},
+		byISOCode:  map[string]int64{},
+		names:      map[int64]string{},
+		placeNames: map[int64]map[string]bool{},
+		created:    map[int64]bool{},
+	}
+
+	rows, err := tx.Query(`SELECT id, name, iso_code FROM countries`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name, isoCode string
+		if err := rows.Scan(&id, &name, &isoCode); err != nil {
+			return nil, err
+		}
+		importer.remember(id, name, isoCode)
+	}
+	return importer, rows.Err()
+}
+
+func (p *placeImporter) remember(id int64, name, isoCode string) {
+	p.byName[strings.ToLower(name)] = id
+	if isoCode != "" {
+		p.byISOCode[isoCode] = id
+	}
+	p.names[id] = name
+}
+
+func (p *placeImporter) add(row importRow, fallbackCountry string) (ImportedItem, int64, error) {
+	item := ImportedItem{Name: row.Name, Latitude: row.Latitude, Longitude: row.Longitude, Status: "skipped"}
+
+	var errs validationErrors
+	name := errs.requiredText("name", row.Name, maxNameLength)
+	description := errs.optionalText("description", row.Description, maxDescriptionLength)
+	errs.coordinates(row.Latitude, row.Longitude)
+	mapsURL := errs.mapsURL("maps_url", row.MapsURL)
+	isoCode := errs.isoCode("iso_code", row.ISOCode)
+	if len(errs) > 0 {
+		item.Reason = errs.Error()
+		return item, 0, nil
+	}
+
+	countryID, err := p.country(row.Country, isoCode, fallbackCountry)
+	if err != nil {
+		var fieldErrs validationErrors
+		if errors.As(err, &fieldErrs) {
+			item.Reason = fieldErrs.Error()
+			return item, 0, nil
+		}
+		return item, 0, err
+	}
+	item.Country = p.names[countryID]
+
+	existing, err := p.existingPlaces(countryID)
+	if err != nil {
+		return item, 0, err
+	}
+	key := strings.ToLower(name)
+	if existing[key] {
+		item.Reason = fmt.Sprintf("%s already has a place named %q", item.Country, name)
+		return item, 0, nil
+	}
+
+	// Saved places are places to go, not visits.
+	_, err = p.tx.Exec(`INSERT INTO places(country_id, name, category, description, latitude, longitude, maps_url, status)
+        VALUES($1, $2, $3, $4, $5, $6, $7, $8)`,
+		countryID, name, p.category, description, row.Latitude, row.Longitude, mapsURL, statusWishlist)
+	if err != nil {
+		return item, 0, err
+	}
+	existing[key] = true
+	item.Status = "created"
+	return item, countryID, nil
+}
+
+func (p *placeImporter) country(name, isoCode, fallback string) (int64, error) {
+	if id, ok := p.byISOCode[isoCode]; ok {
+		return id, nil
+	}
+	if name == "" {
+		name = fallback
+	}
+	if name == "" {
+		return 0, validationErrors{{Field: "country", Message: "could not be determined; pass ?country= for rows without an address"}}
+	}
+	if id, ok := p.byName[strings.ToLower(name)]; ok {
+		return id, nil
+	}
+
+	var errs validationErrors
+	name = errs.requiredText("country", name, maxNameLength)
+	if err := errs.err(); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := p.tx.QueryRow(`INSERT INTO countries(name, iso_code, position)
+        VALUES($1, $2, (SELECT COALESCE(MAX(position), 0) + 1 FROM countries)) RETURNING id`, name, isoCode).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	p.remember(id, name, isoCode)
+	p.placeNames[id] = map[string]bool{}
+	p.created[id] = true
+	p.createdNames = append(p.createdNames, name)
+	return id, nil
+}
+
+func (p *placeImporter) existingPlaces(countryID int64) (map[string]bool, error) {
+	if names, ok := p.placeNames[countryID]; ok {
+		return names, nil
+	}
+	rows, err := p.tx.Query(`SELECT LOWER(name) FROM places WHERE country_id=$1`, countryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	p.placeNames[countryID] = names
+	return names, rows.Err()
+}
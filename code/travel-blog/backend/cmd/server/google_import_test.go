@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseGoogleMapsExport(t *testing.T) {
+	type wantRow struct {
+		name, country, isoCode string
+		latitude, longitude    float64
+		noCoordinates          bool
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    []wantRow
+		wantErr string
+	}{
+		{
+			name: "geojson",
+			data: `{"type": "FeatureCollection", "features": [{"geometry": {"coordinates": [135.7727, 34.9671]},
+				"properties": {"google_maps_url": "https://maps.google.com/?cid=1", "location": {"name": "Fushimi Inari", "address": "Kyoto, Japan", "country_code": "JP"}}}]}`,
+			want: []wantRow{{name: "Fushimi Inari", country: "Japan", isoCode: "JP", latitude: 34.9671, longitude: 135.7727}},
+		},
+		{
+			name: "geojson without a position falls back to the maps url",
+			data: `{"type": "FeatureCollection", "features": [{"geometry": {"coordinates": [0, 0]},
+				"properties": {"google_maps_url": "https://www.google.com/maps/place/x/@35.0,135.0,17z/data=!3d34.9949!4d135.7850", "location": {"name": "Kiyomizu-dera"}}}]}`,
+			want: []wantRow{{name: "Kiyomizu-dera", latitude: 34.9949, longitude: 135.785}},
+		},
+		{
+			name: "geojson with title-case keys and quoted coordinates",
+			data: `{"type": "FeatureCollection", "features": [{"properties": {"Title": "Old title",
+				"Location": {"Business Name": "Nishiki Market", "Address": "Nakagyo Ward, Kyoto, Japan", "Country Code": "JP",
+				"Geo Coordinates": {"Latitude": "35.0050", "Longitude": "135.7649"}}}}]}`,
+			want: []wantRow{{name: "Nishiki Market", country: "Japan", isoCode: "JP", latitude: 35.005, longitude: 135.7649}},
+		},
+		{
+			name: "geojson with no coordinates at all",
+			data: `{"type": "FeatureCollection", "features": [{"properties": {"Title": "Somewhere"}}]}`,
+			want: []wantRow{{name: "Somewhere", noCoordinates: true}},
+		},
+		{
+			name: "csv with coordinate columns",
+			data: "\xef\xbb\xbfTitle,Note,Latitude,Longitude,Country\nArashiyama,Go early,35.0094,135.6668,Japan\n",
+			want: []wantRow{{name: "Arashiyama", country: "Japan", latitude: 35.0094, longitude: 135.6668}},
+		},
+		{
+			name: "csv with coordinates in the url",
+			data: "Title,URL\nKinkaku-ji,\"https://maps.google.com/?q=35.0394,135.7292\"\n",
+			want: []wantRow{{name: "Kinkaku-ji", latitude: 35.0394, longitude: 135.7292}},
+		},
+		{
+			name: "csv without coordinates, named from the address",
+			data: "Name,Address\n,\"Gion, Kyoto, Japan\"\nNo position,\n",
+			want: []wantRow{{name: "Gion", country: "Japan", noCoordinates: true}, {name: "No position", noCoordinates: true}},
+		},
+		{
+			name: "csv with a short row",
+			data: "Title,Note,URL\nPontocho\n",
+			want: []wantRow{{name: "Pontocho", noCoordinates: true}},
+		},
+		{
+			name: "csv with half a coordinate pair",
+			data: "Title,Latitude,Longitude\nHalf,35.0,\n",
+			want: []wantRow{{name: "Half", noCoordinates: true}},
+		},
+		{name: "csv with an unterminated quote", data: "Title,Note\n\"Broken,row\n", wantErr: "must be a Google Maps GeoJSON or CSV export"},
+		{name: "csv without a name column", data: "Address,URL\nKyoto,\n", wantErr: "must have a Title or Name column"},
+		{name: "geojson that is not a collection", data: `{"type": "Feature"}`, wantErr: "must be a GeoJSON FeatureCollection"},
+		{name: "malformed geojson", data: `{"type": "FeatureCollection", "features": [`, wantErr: "must be a GeoJSON FeatureCollection"},
+		{
+			name:    "geojson with an invalid coordinate",
+			data:    `{"type": "FeatureCollection", "features": [{"properties": {"Location": {"Geo Coordinates": {"Latitude": "north", "Longitude": "1"}}}}]}`,
+			wantErr: `invalid coordinate "north"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rows, err := parseGoogleMapsExport([]byte(tc.data))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(rows) != len(tc.want) {
+				t.Fatalf("expected %d rows, got %d: %+v", len(tc.want), len(rows), rows)
+			}
+			for i, want := range tc.want {
+				row := rows[i]
+				if row.Name != want.name || row.Country != want.country || row.ISOCode != want.isoCode {
+					t.Fatalf("row %d: expected %q in %q (%q), got %q in %q (%q)", i, want.name, want.country, want.isoCode, row.Name, row.Country, row.ISOCode)
+				}
+				if want.noCoordinates {
+					if row.Latitude != nil || row.Longitude != nil {
+						t.Fatalf("row %d: expected no coordinates, got %v, %v", i, *row.Latitude, *row.Longitude)
+					}
+					continue
+				}
+				if row.Latitude == nil || row.Longitude == nil || *row.Latitude != want.latitude || *row.Longitude != want.longitude {
+					t.Fatalf("row %d: expected %v, %v, got %v, %v", i, want.latitude, want.longitude, row.Latitude, row.Longitude)
+				}
+			}
+		})
+	}
+}
+
+// insertRecorder is a queryer that only accepts place inserts.
+type insertRecorder struct {
+	inserted []string
+}
+
+func (r *insertRecorder) Exec(query string, args ...interface{}) (sql.Result, error) {
+	r.inserted = append(r.inserted, args[1].(string))
+	return driver.RowsAffected(1), nil
+}
+
+func (r *insertRecorder) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (r *insertRecorder) QueryRow(query string, args ...interface{}) *sql.Row {
+	panic("unexpected query: " + query)
+}
+
+func (r *insertRecorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.Exec(query, args...)
+}
+
+func (r *insertRecorder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.QueryRow(query, args...)
+}
+
+func TestPlaceImporterAdd(t *testing.T) {
+	latitude, longitude, outOfRange := 35.0, 135.0, 95.0
+	tests := []struct {
+		name       string
+		row        importRow
+		fallback   string
+		wantStatus string
+		wantReason string
+	}{
+		{name: "new place", row: importRow{Name: "Nijo Castle", Country: "Japan", Latitude: &latitude, Longitude: &longitude}, wantStatus: "created"},
+		{name: "without coordinates", row: importRow{Name: "Philosopher's Path", ISOCode: "jp"}, wantStatus: "created"},
+		{name: "already in the country", row: importRow{Name: "fushimi inari", Country: "japan"}, wantStatus: "skipped", wantReason: `Japan already has a place named "fushimi inari"`},
+		{name: "earlier in the same file", row: importRow{Name: "NIJO CASTLE", Country: "Japan"}, wantStatus: "skipped", wantReason: "already has a place named"},
+		{name: "fallback country", row: importRow{Name: "Todai-ji"}, fallback: "Japan", wantStatus: "created"},
+		{name: "no country", row: importRow{Name: "Nowhere"}, wantStatus: "skipped", wantReason: "could not be determined"},
+		{name: "no name", row: importRow{Country: "Japan"}, wantStatus: "skipped", wantReason: "name"},
+		{name: "latitude out of range", row: importRow{Name: "Pole", Country: "Japan", Latitude: &outOfRange, Longitude: &longitude}, wantStatus: "skipped", wantReason: "latitude"},
+		{name: "invalid iso code", row: importRow{Name: "Osaka Castle", ISOCode: "JPN"}, wantStatus: "skipped", wantReason: "iso_code"},
+	}
+
+	tx := &insertRecorder{}
+	importer := &placeImporter{
+		tx:         tx,
+		category:   "landmark",
+		byName:     map[string]int64{},
+		byISOCode:  map[string]int64{},
+		names:      map[int64]string{},
+		placeNames: map[int64]map[string]bool{1: {"fushimi inari": true}},
+		created:    map[int64]bool{},
+	}
+	importer.remember(1, "Japan", "JP")
+
+	// Rows run in order against one importer, as in a single import.
+	for _, tc := range tests {
+		item, countryID, err := importer.add(tc.row, tc.fallback)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if item.Status != tc.wantStatus || !strings.Contains(item.Reason, tc.wantReason) {
+			t.Fatalf("%s: expected %s (%q), got %s (%q)", tc.name, tc.wantStatus, tc.wantReason, item.Status, item.Reason)
+		}
+		if tc.wantStatus == "created" && (countryID != 1 || item.Country != "Japan") {
+			t.Fatalf("%s: expected the place in Japan, got country %d %q", tc.name, countryID, item.Country)
+		}
+	}
+	if got := strings.Join(tx.inserted, ","); got != "Nijo Castle,Philosopher's Path,Todai-ji" {
+		t.Fatalf("expected three inserts, got %s", got)
+	}
+}
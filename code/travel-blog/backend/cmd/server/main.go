@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,82 +17,194 @@ import (
 )
 
 type Country struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Places      []Place   `json:"places"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            int64             `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Locale        string            `json:"locale"`
+	ISOCode       string            `json:"iso_code"`
+	CoverImageURL string            `json:"cover_image_url"`
+	AccentColor   string            `json:"accent_color"`
+	Archived      bool              `json:"archived"`
+	Pinned        bool              `json:"pinned"`
+	Position      int               `json:"position"`
+	ViewCount     int64             `json:"view_count"`
+	Places        []Place           `json:"places"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Links         map[string]string `json:"links,omitempty"`
 }
 
 type Place struct {
-	ID          int64      `json:"id"`
-	CountryID   int64      `json:"country_id"`
-	Name        string     `json:"name"`
-	Category    string     `json:"category"`
-	City        string     `json:"city"`
-	Description string     `json:"description"`
-	VisitedAt   *time.Time `json:"visited_at"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID          int64             `json:"id"`
+	CountryID   int64             `json:"country_id"`
+	Name        string            `json:"name"`
+	Category    string            `json:"category"`
+	City        string            `json:"city"`
+	Description string            `json:"description"`
+	Locale      string            `json:"locale"`
+	Latitude    *float64          `json:"latitude"`
+	Longitude   *float64          `json:"longitude"`
+	VisitedAt   *time.Time        `json:"visited_at"`
+	Weather     *Weather          `json:"weather"`
+	WebsiteURL  string            `json:"website_url"`
+	MapsURL     string            `json:"maps_url"`
+	Phone       string            `json:"phone"`
+	Hours       OpeningHours      `json:"opening_hours"`
+	Status      string            `json:"status"`
+	ViewCount   int64             `json:"view_count"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Links       map[string]string `json:"links,omitempty"`
 }
 
 type App struct {
-	db *sql.DB
+	db       *sql.DB
+	weather  WeatherProvider
+	events   *EventBroker
+	search   *SearchIndexer
+	envelope bool
+	auth     authConfig
+	cache    *responseCache
+	views    *viewCounter
 }
 
 func main() {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL is required")
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		serve()
+	case "migrate":
+		err = runMigrate(args)
+	case "seed":
+		err = runSeed(args)
+	case "export":
+		err = runExport(args)
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
+	default:
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
 
-	db, err := sql.Open("pgx", dsn)
+func serve() {
+	shutdownTracing, err := setupTracing(context.Background())
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		log.Fatalf("failed to configure tracing: %v", err)
 	}
-	defer db.Close()
 
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(30 * time.Minute)
+	db, err := openDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("database ping failed: %v", err)
+	weather, err := newWeatherProviderFromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure weather provider: %v", err)
 	}
 
-	app := &App{db: db}
+	cache := newResponseCacheFromEnv()
+	app := &App{db: db, weather: weather, events: newEventBroker(), search: newSearchIndexerFromEnv(), envelope: envelopeByDefault(), auth: authConfigFromEnv(),
+		cache: cache, views: newViewCounter(db, cache.invalidate)}
 	if err := app.ensureSchema(); err != nil {
 		log.Fatalf("failed to ensure schema: %v", err)
 	}
+	if app.search != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := app.search.EnsureIndex(ctx); err != nil {
+			log.Printf("search index unavailable, writes will retry indexing: %v", err)
+		}
+		cancel()
+	}
+
+	viewsCtx, stopViews := context.WithCancel(context.Background())
+	viewsDone := make(chan struct{})
+	go func() {
+		app.views.run(viewsCtx, envDuration("VIEW_FLUSH_INTERVAL", 10*time.Second))
+		close(viewsDone)
+	}()
+	searchDone := make(chan struct{})
+	go func() {
+		if app.search != nil {
+			app.runSearchSync(viewsCtx)
+		}
+		close(searchDone)
+	}()
 
 	router := gin.Default()
+	router.Use(traceRequests())
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Last-Event-ID, traceparent, tracestate")
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 		c.Next()
 	})
+	router.Use(compressResponses(compressionMinBytes()))
+	router.Use(requestDeadline(envDuration("DB_REQUEST_TIMEOUT", 10*time.Second)))
 
 	api := router.Group("/api")
+	api.Use(app.authenticate, app.cacheHeaders)
 	{
-		api.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"status": "ok"})
-		})
+		api.GET("/health", app.health)
+
+		api.GET("/events", app.streamEvents)
+		api.GET("/search", app.searchContent)
+		api.POST("/admin/reindex", app.reindexSearch)
+
+		api.GET("/tokens", app.listTokens)
+		api.POST("/tokens", app.createToken)
+		api.DELETE("/tokens/:id", app.revokeToken)
+
+		api.POST("/import/google-maps", app.importGoogleMaps)
 
-		api.GET("/countries", app.listCountries)
+		api.GET("/popular", app.popular)
+		api.GET("/stats", app.stats)
+
+		api.GET("/map/countries.geojson", app.countriesGeoJSON)
+		api.GET("/map/places.geojson", app.placesGeoJSON)
+
+		api.GET("/countries", app.cacheResponse, app.listCountries)
 		api.POST("/countries", app.createCountry)
+		api.PUT("/countries/order", app.reorderCountries)
 		api.GET("/countries/:id", app.getCountry)
 		api.PUT("/countries/:id", app.updateCountry)
+		api.PATCH("/countries/:id", app.patchCountry)
 		api.DELETE("/countries/:id", app.deleteCountry)
+		api.POST("/countries/:id/cover", app.uploadCover)
+		api.POST("/countries/:id/archive", app.archiveCountry)
+		api.POST("/countries/:id/unarchive", app.unarchiveCountry)
+		api.POST("/countries/:id/view", app.viewCountry)
+		api.Static("/uploads", uploadDir())
+
+		api.GET("/countries/:id/translations", app.listCountryTranslations)
+		api.PUT("/countries/:id/translations/:locale", app.upsertCountryTranslation)
+		api.DELETE("/countries/:id/translations/:locale", app.deleteCountryTranslation)
 
 		api.POST("/countries/:id/places", app.createPlace)
+		api.GET("/countries/:id/places/duplicates", app.listDuplicatePlaces)
+		api.GET("/places/:id", app.getPlace)
 		api.PUT("/places/:id", app.updatePlace)
+		api.PATCH("/places/:id", app.patchPlace)
 		api.DELETE("/places/:id", app.deletePlace)
+		api.POST("/places/:id/merge", app.mergePlace)
+		api.POST("/places/:id/view", app.viewPlace)
+
+		api.GET("/places/:id/translations", app.listPlaceTranslations)
+		api.PUT("/places/:id/translations/:locale", app.upsertPlaceTranslation)
+		api.DELETE("/places/:id/translations/:locale", app.deletePlaceTranslation)
 	}
 
 	port := os.Getenv("PORT")
@@ -97,8 +212,28 @@ func main() {
 		port = "8080"
 	}
 
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("server error: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// Let in-flight requests finish and buffered spans export before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+	stopViews()
+	<-viewsDone
+	<-searchDone
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("tracing shutdown: %v", err)
 	}
 }
 
@@ -122,10 +257,41 @@ func (a *App) ensureSchema() error {
             created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
             updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
         );`,
+		`ALTER TABLE places
+            ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION,
+            ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION,
+            ADD COLUMN IF NOT EXISTS weather_temperature_c DOUBLE PRECISION,
+            ADD COLUMN IF NOT EXISTS weather_condition TEXT,
+            ADD COLUMN IF NOT EXISTS website_url TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS maps_url TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS phone TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS opening_hours JSONB,
+            ADD COLUMN IF NOT EXISTS view_count BIGINT NOT NULL DEFAULT 0,
+            ADD COLUMN IF NOT EXISTS status TEXT;`,
+		// Places without a status predate it: a visit date meant visited.
+		`UPDATE places SET status = CASE WHEN visited_at IS NULL THEN 'wishlist' ELSE 'visited' END WHERE status IS NULL;`,
+		`ALTER TABLE places
+            ALTER COLUMN status SET DEFAULT 'wishlist',
+            ALTER COLUMN status SET NOT NULL,
+            DROP CONSTRAINT IF EXISTS places_status_check,
+            ADD CONSTRAINT places_status_check CHECK (status IN ('visited', 'planned', 'wishlist'));`,
+		`ALTER TABLE countries
+            ADD COLUMN IF NOT EXISTS cover_image_url TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS accent_color TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE,
+            ADD COLUMN IF NOT EXISTS iso_code TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE,
+            ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0,
+            ADD COLUMN IF NOT EXISTS view_count BIGINT NOT NULL DEFAULT 0;`,
 		`CREATE OR REPLACE FUNCTION set_updated_at()
         RETURNS TRIGGER AS $$
         BEGIN
-            NEW.updated_at = NOW();
+            -- Flushing view counts is not an edit.
+            IF to_jsonb(NEW) - 'view_count' - 'updated_at' = to_jsonb(OLD) - 'view_count' - 'updated_at' THEN
+                NEW.updated_at = OLD.updated_at;
+            ELSE
+                NEW.updated_at = NOW();
+            END IF;
             RETURN NEW;
         END;
         $$ LANGUAGE plpgsql;`,
@@ -135,10 +301,37 @@ func (a *App) ensureSchema() error {
 		`CREATE OR REPLACE TRIGGER places_updated_at
         BEFORE UPDATE ON places
         FOR EACH ROW EXECUTE FUNCTION set_updated_at();`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS countries_name_unique_idx ON countries (LOWER(name));`,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm;`,
+		`CREATE TABLE IF NOT EXISTS translations (
+            id SERIAL PRIMARY KEY,
+            country_id INTEGER REFERENCES countries(id) ON DELETE CASCADE,
+            place_id INTEGER REFERENCES places(id) ON DELETE CASCADE,
+            locale TEXT NOT NULL,
+            description TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            CHECK ((country_id IS NULL) <> (place_id IS NULL)),
+            UNIQUE (country_id, locale),
+            UNIQUE (place_id, locale)
+        );`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+            id SERIAL PRIMARY KEY,
+            name TEXT NOT NULL,
+            scope TEXT NOT NULL CHECK (scope IN ('read-only', 'read-write')),
+            prefix TEXT NOT NULL,
+            token_hash TEXT NOT NULL UNIQUE,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            last_used_at TIMESTAMPTZ,
+            revoked_at TIMESTAMPTZ
+        );`,
 	}
 
 	for _, q := range queries {
 		if _, err := a.db.Exec(q); err != nil {
+			if isUniqueViolation(err) {
+				return fmt.Errorf("%w (remove duplicate country names before upgrading)", err)
+			}
 			return err
 		}
 	}
@@ -146,17 +339,84 @@ func (a *App) ensureSchema() error {
 	return nil
 }
 
+func duplicateCountryMessage(name string) string {
+	return fmt.Sprintf("a country named %q already exists", name)
+}
+
 func (a *App) listCountries(c *gin.Context) {
-	countries, err := a.fetchCountries()
+	lang, ok := requestLocale(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lang, expected a language tag such as en or pt-br"})
+		return
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	includeArchived, err := parseBoolQuery(c, "include_archived")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status, ok := statusQuery(c)
+	if !ok {
+		return
+	}
+
+	filter := countryFilter{Limit: page.Size, Offset: page.offset(), IncludeArchived: includeArchived}
+	countries, err := fetchCountryList(a.conn(c), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
+	}
+	if err := localizeCountries(a.conn(c), lang, countries); err != nil {
+		respondError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, countries)
+	filterPlacesByStatus(countries, status)
+
+	total := len(countries)
+	if page.Size > 0 {
+		where, args := filter.where()
+		if err := a.conn(c).QueryRow(`SELECT COUNT(*) FROM countries`+where, args...).Scan(&total); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	a.respondList(c, countries, len(countries), total, page)
+}
+
+type countryFilter struct {
+	Limit           int
+	Offset          int
+	IncludeArchived bool
+}
+
+func (f countryFilter) where() (string, []interface{}) {
+	if f.IncludeArchived {
+		return "", nil
+	}
+	return ` WHERE NOT archived`, nil
+}
+
+func fetchCountries(q queryer) ([]Country, error) {
+	return fetchCountryList(q, countryFilter{IncludeArchived: true})
 }
 
-func (a *App) fetchCountries() ([]Country, error) {
-	rows, err := a.db.Query(`SELECT id, name, description, created_at, updated_at FROM countries ORDER BY name`)
+// countryOrder falls back to the name for countries never ordered, which
+// share position 0.
+const countryOrder = ` ORDER BY pinned DESC, position, name`
+
+func fetchCountryList(q queryer, filter countryFilter) ([]Country, error) {
+	where, args := filter.where()
+	query := `SELECT ` + countryColumns + ` FROM countries` + where + countryOrder
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	}
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -164,11 +424,11 @@ func (a *App) fetchCountries() ([]Country, error) {
 
 	var countries []Country
 	for rows.Next() {
-		var country Country
-		if err := rows.Scan(&country.ID, &country.Name, &country.Description, &country.CreatedAt, &country.UpdatedAt); err != nil {
+		country, err := scanCountry(rows)
+		if err != nil {
 			return nil, err
 		}
-		places, err := a.fetchPlaces(country.ID)
+		places, err := fetchPlaces(q, country.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -183,10 +443,8 @@ func (a *App) fetchCountries() ([]Country, error) {
 	return countries, nil
 }
 
-func (a *App) fetchCountry(id int64) (*Country, error) {
-	var country Country
-	err := a.db.QueryRow(`SELECT id, name, description, created_at, updated_at FROM countries WHERE id=$1`, id).
-		Scan(&country.ID, &country.Name, &country.Description, &country.CreatedAt, &country.UpdatedAt)
+func fetchCountry(q queryer, id int64) (*Country, error) {
+	country, err := scanCountry(q.QueryRow(`SELECT `+countryColumns+` FROM countries WHERE id=$1`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -194,7 +452,7 @@ func (a *App) fetchCountry(id int64) (*Country, error) {
 		return nil, err
 	}
 
-	places, err := a.fetchPlaces(id)
+	places, err := fetchPlaces(q, id)
 	if err != nil {
 		return nil, err
 	}
@@ -202,8 +460,40 @@ func (a *App) fetchCountry(id int64) (*Country, error) {
 	return &country, nil
 }
 
-func (a *App) fetchPlaces(countryID int64) ([]Place, error) {
-	rows, err := a.db.Query(`SELECT id, country_id, name, category, city, description, visited_at, created_at, updated_at FROM places WHERE country_id=$1 ORDER BY visited_at DESC NULLS LAST, name`, countryID)
+const countryColumns = `id, name, description, iso_code, cover_image_url, accent_color, archived, pinned, position, view_count, created_at, updated_at`
+
+func scanCountry(row rowScanner) (Country, error) {
+	var country Country
+	err := row.Scan(&country.ID, &country.Name, &country.Description, &country.ISOCode, &country.CoverImageURL, &country.AccentColor,
+		&country.Archived, &country.Pinned, &country.Position, &country.ViewCount, &country.CreatedAt, &country.UpdatedAt)
+	return country, err
+}
+
+const placeColumns = `id, country_id, name, category, city, description, latitude, longitude, visited_at, weather_temperature_c, weather_condition,
+    website_url, maps_url, phone, opening_hours, status, view_count, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPlace(row rowScanner) (Place, error) {
+	var place Place
+	var temperature sql.NullFloat64
+	var condition sql.NullString
+	err := row.Scan(&place.ID, &place.CountryID, &place.Name, &place.Category, &place.City, &place.Description,
+		&place.Latitude, &place.Longitude, &place.VisitedAt, &temperature, &condition,
+		&place.WebsiteURL, &place.MapsURL, &place.Phone, &place.Hours, &place.Status, &place.ViewCount, &place.CreatedAt, &place.UpdatedAt)
+	if err != nil {
+		return place, err
+	}
+	if temperature.Valid {
+		place.Weather = &Weather{TemperatureC: temperature.Float64, Condition: condition.String}
+	}
+	return place, nil
+}
+
+func fetchPlaces(q queryer, countryID int64) ([]Place, error) {
+	rows, err := q.Query(`SELECT `+placeColumns+` FROM places WHERE country_id=$1 ORDER BY visited_at DESC NULLS LAST, name`, countryID)
 	if err != nil {
 		return nil, err
 	}
@@ -211,8 +501,8 @@ func (a *App) fetchPlaces(countryID int64) ([]Place, error) {
 
 	var places []Place
 	for rows.Next() {
-		var place Place
-		if err := rows.Scan(&place.ID, &place.CountryID, &place.Name, &place.Category, &place.City, &place.Description, &place.VisitedAt, &place.CreatedAt, &place.UpdatedAt); err != nil {
+		place, err := scanPlace(rows)
+		if err != nil {
 			return nil, err
 		}
 		places = append(places, place)
@@ -227,37 +517,53 @@ func (a *App) fetchPlaces(countryID int64) ([]Place, error) {
 
 func (a *App) createCountry(c *gin.Context) {
 	var input struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
+		Name          string `json:"name"`
+		Description   string `json:"description"`
+		ISOCode       string `json:"iso_code"`
+		CoverImageURL string `json:"cover_image_url"`
+		AccentColor   string `json:"accent_color"`
+		Pinned        bool   `json:"pinned"`
 	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
-	name := strings.TrimSpace(input.Name)
-	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+	var errs validationErrors
+	name := errs.requiredText("name", input.Name, maxNameLength)
+	description := errs.optionalText("description", input.Description, maxDescriptionLength)
+	isoCode := errs.isoCode("iso_code", input.ISOCode)
+	coverImageURL := errs.imageURL("cover_image_url", input.CoverImageURL)
+	accentColor := errs.accentColor("accent_color", input.AccentColor)
+	if len(errs) > 0 {
+		respondValidation(c, errs)
 		return
 	}
 
-	description := strings.TrimSpace(input.Description)
-
-	var id int64
-	err := a.db.QueryRow(`INSERT INTO countries(name, description) VALUES($1, $2) RETURNING id`, name, description).
-		Scan(&id)
+	var country *Country
+	err := a.withTx(c.Request.Context(), func(tx queryer) error {
+		var id int64
+		// New countries go to the end of the user's order.
+		err := tx.QueryRow(`INSERT INTO countries(name, description, iso_code, cover_image_url, accent_color, pinned, position)
+            VALUES($1, $2, $3, $4, $5, $6, (SELECT COALESCE(MAX(position), 0) + 1 FROM countries)) RETURNING id`,
+			name, description, isoCode, coverImageURL, accentColor, input.Pinned).Scan(&id)
+		if err != nil {
+			return err
+		}
+		country, err = fetchCountry(tx, id)
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": duplicateCountryMessage(name)})
+			return
+		}
+		respondError(c, err)
 		return
 	}
 
-	country, err := a.fetchCountry(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, country)
+	a.contentChanged("created", "country", country.ID, country.ID)
+
+	a.respond(c, http.StatusCreated, country)
 }
 
 func (a *App) getCountry(c *gin.Context) {
@@ -267,67 +573,34 @@ func (a *App) getCountry(c *gin.Context) {
 		return
 	}
 
-	country, err := a.fetchCountry(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if country == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, country)
-}
-
-func (a *App) updateCountry(c *gin.Context) {
-	id, err := parseIDParam(c, "id")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	lang, ok := requestLocale(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lang, expected a language tag such as en or pt-br"})
 		return
 	}
-
-	var input struct {
-		Name        *string `json:"name"`
-		Description *string `json:"description"`
-	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	status, ok := statusQuery(c)
+	if !ok {
 		return
 	}
 
-	var name interface{}
-	if input.Name != nil {
-		trimmed := strings.TrimSpace(*input.Name)
-		if trimmed != "" {
-			name = trimmed
-		} else {
-			name = ""
-		}
-	}
-
-	var description interface{}
-	if input.Description != nil {
-		description = strings.TrimSpace(*input.Description)
-	}
-
-	res, err := a.db.Exec(`UPDATE countries SET name = COALESCE($1, name), description = COALESCE($2, description) WHERE id=$3`, name, description, id)
+	country, err := fetchCountry(a.conn(c), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
+	if country == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
 		return
 	}
 
-	country, err := a.fetchCountry(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	countries := []Country{*country}
+	if err := localizeCountries(a.conn(c), lang, countries); err != nil {
+		respondError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, country)
+	filterPlacesByStatus(countries, status)
+
+	a.respond(c, http.StatusOK, &countries[0])
 }
 
 func (a *App) deleteCountry(c *gin.Context) {
@@ -337,16 +610,19 @@ func (a *App) deleteCountry(c *gin.Context) {
 		return
 	}
 
-	res, err := a.db.Exec(`DELETE FROM countries WHERE id=$1`, id)
+	var coverImageURL string
+	err = a.conn(c).QueryRow(`DELETE FROM countries WHERE id=$1 RETURNING cover_image_url`, id).Scan(&coverImageURL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
+			return
+		}
+		respondError(c, err)
 		return
 	}
+	removeUpload(coverImageURL)
+
+	a.contentChanged("deleted", "country", id, id)
 
 	c.Status(http.StatusNoContent)
 }
@@ -359,174 +635,186 @@ func (a *App) createPlace(c *gin.Context) {
 	}
 
 	var input struct {
-		Name        string  `json:"name" binding:"required"`
-		Category    string  `json:"category" binding:"required"`
-		City        string  `json:"city"`
-		Description string  `json:"description"`
-		VisitedAt   *string `json:"visited_at"`
-	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	name := strings.TrimSpace(input.Name)
-	category := strings.TrimSpace(input.Category)
-	city := strings.TrimSpace(input.City)
-	description := strings.TrimSpace(input.Description)
-
-	if name == "" || category == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name and category are required"})
+		Name         string       `json:"name"`
+		Category     string       `json:"category"`
+		City         string       `json:"city"`
+		Description  string       `json:"description"`
+		Latitude     *float64     `json:"latitude"`
+		Longitude    *float64     `json:"longitude"`
+		VisitedAt    *string      `json:"visited_at"`
+		WebsiteURL   string       `json:"website_url"`
+		MapsURL      string       `json:"maps_url"`
+		Phone        string       `json:"phone"`
+		OpeningHours OpeningHours `json:"opening_hours"`
+		Status       string       `json:"status"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	var errs validationErrors
+	name := errs.requiredText("name", input.Name, maxNameLength)
+	category := errs.category("category", input.Category)
+	city := errs.optionalText("city", input.City, maxCityLength)
+	description := errs.optionalText("description", input.Description, maxDescriptionLength)
+	errs.coordinates(input.Latitude, input.Longitude)
+	visitedAt := errs.visitDate("visited_at", input.VisitedAt)
+	websiteURL := errs.webURL("website_url", input.WebsiteURL)
+	mapsURL := errs.mapsURL("maps_url", input.MapsURL)
+	phone := errs.phone("phone", input.Phone)
+	hours := errs.openingHours("opening_hours", input.OpeningHours)
+	status := errs.placeStatus("status", input.Status, visitedAt)
+	if len(errs) > 0 {
+		respondValidation(c, errs)
 		return
 	}
 
-	var visitedAt *time.Time
-	if input.VisitedAt != nil && *input.VisitedAt != "" {
-		t, err := time.Parse("2006-01-02", *input.VisitedAt)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visited_at format, expected YYYY-MM-DD"})
-			return
-		}
-		visitedAt = &t
-	}
-
 	var id int64
-	err = a.db.QueryRow(`INSERT INTO places(country_id, name, category, city, description, visited_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING id`,
-		countryID, name, category, city, description, visitedAt).
-		Scan(&id)
+	err = a.conn(c).QueryRow(`INSERT INTO places(country_id, name, category, city, description, latitude, longitude, visited_at,
+            website_url, maps_url, phone, opening_hours, status)
+        VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		countryID, name, category, city, description, input.Latitude, input.Longitude, visitedAt,
+		websiteURL, mapsURL, phone, hours, status).Scan(&id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
+			return
+		}
+		respondError(c, err)
 		return
 	}
+	a.recordWeather(c.Request.Context(), a.conn(c), id)
 
-	country, err := a.fetchCountry(countryID)
+	country, err := fetchCountry(a.conn(c), countryID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
-	c.JSON(http.StatusCreated, country)
+
+	a.contentChanged("created", "place", id, countryID)
+
+	a.respond(c, http.StatusCreated, country)
 }
 
-func (a *App) updatePlace(c *gin.Context) {
+func (a *App) deletePlace(c *gin.Context) {
 	placeID, err := parseIDParam(c, "id")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var input struct {
-		Name        *string `json:"name"`
-		Category    *string `json:"category"`
-		City        *string `json:"city"`
-		Description *string `json:"description"`
-		VisitedAt   *string `json:"visited_at"`
-	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var countryID int64
+	var country *Country
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		err := tx.QueryRow(`DELETE FROM places WHERE id=$1 RETURNING country_id`, placeID).Scan(&countryID)
+		if err != nil {
+			return err
+		}
+		country, err = fetchCountry(tx, countryID)
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+			return
+		}
+		respondError(c, err)
 		return
 	}
 
-	setVisited := false
-	var visitedAt interface{}
-	if input.VisitedAt != nil {
-		setVisited = true
-		if *input.VisitedAt == "" {
-			visitedAt = nil
-		} else {
-			t, err := time.Parse("2006-01-02", *input.VisitedAt)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visited_at format, expected YYYY-MM-DD"})
-				return
-			}
-			visitedAt = t
-		}
-	}
+	a.contentChanged("deleted", "place", placeID, countryID)
 
-	var name interface{}
-	if input.Name != nil {
-		name = strings.TrimSpace(*input.Name)
-	}
-	var category interface{}
-	if input.Category != nil {
-		category = strings.TrimSpace(*input.Category)
-	}
-	var city interface{}
-	if input.City != nil {
-		city = strings.TrimSpace(*input.City)
-	}
-	var description interface{}
-	if input.Description != nil {
-		description = strings.TrimSpace(*input.Description)
-	}
+	a.respond(c, http.StatusOK, country)
+}
 
-	res, err := a.db.Exec(`UPDATE places SET
-        name = COALESCE($1, name),
-        category = COALESCE($2, category),
-        city = COALESCE($3, city),
-        description = COALESCE($4, description),
-        visited_at = CASE WHEN $5 THEN $6 ELSE visited_at END
-    WHERE id=$7`, name, category, city, description, setVisited, visitedAt, placeID)
+func (a *App) getPlace(c *gin.Context) {
+	placeID, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+
+	lang, ok := requestLocale(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lang, expected a language tag such as en or pt-br"})
 		return
 	}
 
-	var countryID int64
-	err = a.db.QueryRow(`SELECT country_id FROM places WHERE id=$1`, placeID).Scan(&countryID)
+	place, err := scanPlace(a.conn(c).QueryRow(`SELECT `+placeColumns+` FROM places WHERE id=$1`, placeID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+			return
+		}
+		respondError(c, err)
 		return
 	}
 
-	country, err := a.fetchCountry(countryID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	countries := []Country{{ID: place.CountryID, Places: []Place{place}}}
+	if err := localizeCountries(a.conn(c), lang, countries); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, country)
+	a.respond(c, http.StatusOK, &countries[0].Places[0])
 }
 
-func (a *App) deletePlace(c *gin.Context) {
-	placeID, err := parseIDParam(c, "id")
+func (a *App) contentChanged(eventType, entity string, entityID, countryID int64) {
+	a.events.Publish(eventType, entity, entityID, countryID)
+	a.syncSearchIndex(eventType, entity, entityID, countryID)
+}
+
+func (a *App) archiveCountry(c *gin.Context) {
+	a.setCountryArchived(c, true)
+}
+
+func (a *App) unarchiveCountry(c *gin.Context) {
+	a.setCountryArchived(c, false)
+}
+
+func (a *App) setCountryArchived(c *gin.Context, archived bool) {
+	id, err := parseIDParam(c, "id")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var countryID int64
-	if err := a.db.QueryRow(`SELECT country_id FROM places WHERE id=$1`, placeID).Scan(&countryID); err != nil {
+	var country *Country
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		res, err := tx.Exec(`UPDATE countries SET archived=$1 WHERE id=$2`, archived, id)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+		country, err = fetchCountry(tx, id)
+		return err
+	})
+	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	res, err := a.db.Exec(`DELETE FROM places WHERE id=$1`, placeID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
-		return
-	}
+	a.contentChanged("updated", "country", id, id)
+
+	a.respond(c, http.StatusOK, country)
+}
 
-	country, err := a.fetchCountry(countryID)
+func parseBoolQuery(c *gin.Context, name string) (bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(raw)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return false, fmt.Errorf("%s must be true or false", name)
 	}
-
-	c.JSON(http.StatusOK, country)
+	return value, nil
 }
 
 func parseIDParam(c *gin.Context, name string) (int64, error) {
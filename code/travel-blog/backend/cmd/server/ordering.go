@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reorderCountries keeps countries left out in their relative order after the
+// listed ones.
+func (a *App) reorderCountries(c *gin.Context) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	var errs validationErrors
+	if len(input.IDs) == 0 {
+		errs.add("ids", "must list at least one country id")
+	}
+	seen := make(map[int64]bool, len(input.IDs))
+	for i, id := range input.IDs {
+		if seen[id] {
+			errs.add(fmt.Sprintf("ids[%d]", i), "repeats country %d", id)
+		}
+		seen[id] = true
+	}
+	if len(errs) > 0 {
+		respondValidation(c, errs)
+		return
+	}
+
+	var countries []Country
+	err := a.withTx(c.Request.Context(), func(tx queryer) error {
+		// Lock the table so two reorders cannot interleave their positions.
+		if _, err := tx.Exec(`LOCK TABLE countries IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+
+		var found int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM countries WHERE id = ANY($1)`, input.IDs).Scan(&found); err != nil {
+			return err
+		}
+		if found != len(input.IDs) {
+			return sql.ErrNoRows
+		}
+
+		// Move unlisted countries back first, while their old positions still describe their order.
+		if _, err := tx.Exec(`UPDATE countries c SET position = $2 + r.rank
+            FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY position, name) AS rank
+                  FROM countries WHERE NOT (id = ANY($1))) r
+            WHERE c.id = r.id`, input.IDs, len(input.IDs)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE countries c SET position = o.rank
+            FROM unnest($1::int[]) WITH ORDINALITY AS o(id, rank)
+            WHERE c.id = o.id`, input.IDs); err != nil {
+			return err
+		}
+
+		var err error
+		countries, err = fetchCountries(tx)
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondValidation(c, validationErrors{{Field: "ids", Message: "must only contain existing country ids"}})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	// Positions are not indexed for search, so only live subscribers are told.
+	a.events.Publish("reordered", "country", 0, 0)
+
+	a.respondList(c, countries, len(countries), len(countries), pageRequest{})
+}
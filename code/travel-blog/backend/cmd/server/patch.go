@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+type mergePatch map[string]json.RawMessage
+
+type patchKind int
+
+const (
+	patchText patchKind = iota
+	patchRequiredText
+	patchCategory
+	patchColor
+	patchISOCode
+	patchWebURL
+	patchMapsURL
+	patchPhone
+	patchOpeningHours
+	patchImageURL
+	patchNumber
+	patchDate
+	patchBool
+	patchStatus
+)
+
+type patchField struct {
+	column    string
+	kind      patchKind
+	maxLength int
+}
+
+var countryPatchFields = map[string]patchField{
+	"name":            {column: "name", kind: patchRequiredText, maxLength: maxNameLength},
+	"description":     {column: "description", kind: patchText, maxLength: maxDescriptionLength},
+	"iso_code":        {column: "iso_code", kind: patchISOCode},
+	"cover_image_url": {column: "cover_image_url", kind: patchImageURL},
+	"accent_color":    {column: "accent_color", kind: patchColor},
+	"pinned":          {column: "pinned", kind: patchBool},
+}
+
+var placePatchFields = map[string]patchField{
+	"name":          {column: "name", kind: patchRequiredText, maxLength: maxNameLength},
+	"category":      {column: "category", kind: patchCategory},
+	"city":          {column: "city", kind: patchText, maxLength: maxCityLength},
+	"description":   {column: "description", kind: patchText, maxLength: maxDescriptionLength},
+	"latitude":      {column: "latitude", kind: patchNumber},
+	"longitude":     {column: "longitude", kind: patchNumber},
+	"visited_at":    {column: "visited_at", kind: patchDate},
+	"website_url":   {column: "website_url", kind: patchWebURL},
+	"maps_url":      {column: "maps_url", kind: patchMapsURL},
+	"phone":         {column: "phone", kind: patchPhone},
+	"opening_hours": {column: "opening_hours", kind: patchOpeningHours},
+	"status":        {column: "status", kind: patchStatus},
+}
+
+func bindMergePatch(c *gin.Context, checkContentType bool) (mergePatch, int, error) {
+	if checkContentType {
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || (mediaType != mergePatchContentType && mediaType != "application/json") {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type, use %s", mergePatchContentType)
+		}
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&raw); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, http.StatusBadRequest, errors.New("patch body must be a JSON object")
+	}
+
+	var patch mergePatch
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return patch, 0, nil
+}
+
+func (p mergePatch) has(field string) bool {
+	_, ok := p[field]
+	return ok
+}
+
+func (p mergePatch) isNull(field string) bool {
+	raw, ok := p[field]
+	return ok && bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+func (p mergePatch) assignments(fields map[string]patchField) ([]string, []interface{}, error) {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs validationErrors
+	var sets []string
+	var args []interface{}
+	for _, name := range names {
+		field, ok := fields[name]
+		if !ok {
+			errs.add(name, "is not a known field")
+			continue
+		}
+		args = append(args, p.value(name, field, &errs))
+		sets = append(sets, fmt.Sprintf("%s = $%d", field.column, len(args)))
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return sets, args, nil
+}
+
+func (p mergePatch) value(name string, field patchField, errs *validationErrors) interface{} {
+	if p.isNull(name) {
+		switch field.kind {
+		case patchRequiredText, patchCategory, patchStatus:
+			errs.add(name, "cannot be null")
+			return nil
+		case patchBool:
+			return false
+		case patchText, patchColor, patchISOCode, patchImageURL, patchWebURL, patchMapsURL, patchPhone:
+			return ""
+		default:
+			return nil
+		}
+	}
+
+	raw := p[name]
+	switch field.kind {
+	case patchText, patchRequiredText, patchCategory, patchColor, patchISOCode, patchImageURL, patchWebURL, patchMapsURL, patchPhone, patchStatus:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			errs.add(name, "must be a string")
+			return nil
+		}
+		switch field.kind {
+		case patchCategory:
+			return errs.category(name, text)
+		case patchColor:
+			return errs.accentColor(name, text)
+		case patchISOCode:
+			return errs.isoCode(name, text)
+		case patchImageURL:
+			return errs.imageURL(name, text)
+		case patchWebURL:
+			return errs.webURL(name, text)
+		case patchMapsURL:
+			return errs.mapsURL(name, text)
+		case patchPhone:
+			return errs.phone(name, text)
+		case patchStatus:
+			// Checked against visited_at once the patch is applied.
+			status := strings.ToLower(strings.TrimSpace(text))
+			for _, allowed := range placeStatuses {
+				if status == allowed {
+					return status
+				}
+			}
+			errs.add(name, "must be one of: %s", strings.Join(placeStatuses, ", "))
+			return status
+		case patchRequiredText:
+			return errs.requiredText(name, text, field.maxLength)
+		default:
+			return errs.optionalText(name, text, field.maxLength)
+		}
+	case patchOpeningHours:
+		var hours OpeningHours
+		if err := json.Unmarshal(raw, &hours); err != nil {
+			errs.add(name, "must be an object of weekday opening periods")
+			return nil
+		}
+		return errs.openingHours(name, hours)
+	case patchNumber:
+		var number float64
+		if err := json.Unmarshal(raw, &number); err != nil {
+			errs.add(name, "must be a number")
+			return nil
+		}
+		return number
+	case patchBool:
+		var flag bool
+		if err := json.Unmarshal(raw, &flag); err != nil {
+			errs.add(name, "must be a boolean")
+			return nil
+		}
+		return flag
+	case patchDate:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			errs.add(name, "must be a string")
+			return nil
+		}
+		if t := errs.visitDate(name, &text); t != nil {
+			return *t
+		}
+		return nil
+	}
+	errs.add(name, "is not supported")
+	return nil
+}
+
+func validatePatchCoordinates(p mergePatch, errs *validationErrors) {
+	if p.has("latitude") != p.has("longitude") || p.isNull("latitude") != p.isNull("longitude") {
+		errs.add("latitude", "must be set or cleared together with longitude")
+		return
+	}
+	if !p.has("latitude") || p.isNull("latitude") {
+		return
+	}
+
+	var latitude, longitude float64
+	if json.Unmarshal(p["latitude"], &latitude) != nil || json.Unmarshal(p["longitude"], &longitude) != nil {
+		// assignments reports the type error.
+		return
+	}
+	errs.coordinates(&latitude, &longitude)
+}
+
+func (a *App) updateCountry(c *gin.Context) {
+	a.applyCountryPatch(c, false)
+}
+
+func (a *App) patchCountry(c *gin.Context) {
+	a.applyCountryPatch(c, true)
+}
+
+func (a *App) applyCountryPatch(c *gin.Context, checkContentType bool) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patch, status, err := bindMergePatch(c, checkContentType)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	sets, args, err := patch.assignments(countryPatchFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var country *Country
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		found, err := execPatch(tx, "countries", sets, args, id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+		country, err = fetchCountry(tx, id)
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "country not found"})
+			return
+		}
+		if isUniqueViolation(err) {
+			var name string
+			json.Unmarshal(patch["name"], &name)
+			c.JSON(http.StatusConflict, gin.H{"error": duplicateCountryMessage(strings.TrimSpace(name))})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	a.contentChanged("updated", "country", id, id)
+
+	a.respond(c, http.StatusOK, country)
+}
+
+func (a *App) updatePlace(c *gin.Context) {
+	a.applyPlacePatch(c, false)
+}
+
+func (a *App) patchPlace(c *gin.Context) {
+	a.applyPlacePatch(c, true)
+}
+
+func (a *App) applyPlacePatch(c *gin.Context, checkContentType bool) {
+	placeID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patch, status, err := bindMergePatch(c, checkContentType)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	var errs validationErrors
+	validatePatchCoordinates(patch, &errs)
+	sets, args, err := patch.assignments(placePatchFields)
+	if err != nil {
+		errs = append(errs, err.(validationErrors)...)
+	}
+	if len(errs) > 0 {
+		respondValidation(c, errs)
+		return
+	}
+
+	var countryID int64
+	err = a.withTx(c.Request.Context(), func(tx queryer) error {
+		found, err := execPatch(tx, "places", sets, args, placeID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+
+		// Status and visit date can arrive separately, so check them on the patched row.
+		if patch.has("status") || patch.has("visited_at") {
+			var placeStatus string
+			var visitedAt *time.Time
+			if err := tx.QueryRow(`SELECT status, visited_at FROM places WHERE id=$1`, placeID).Scan(&placeStatus, &visitedAt); err != nil {
+				return err
+			}
+			var errs validationErrors
+			errs.placeStatus("status", placeStatus, visitedAt)
+			if err := errs.err(); err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRow(`SELECT country_id FROM places WHERE id=$1`, placeID).Scan(&countryID)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+	if patch.has("visited_at") || patch.has("latitude") {
+		a.recordWeather(c.Request.Context(), a.conn(c), placeID)
+	}
+
+	country, err := fetchCountry(a.conn(c), countryID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	a.contentChanged("updated", "place", placeID, countryID)
+
+	a.respond(c, http.StatusOK, country)
+}
+
+func execPatch(q queryer, table string, sets []string, args []interface{}, id int64) (bool, error) {
+	if len(sets) == 0 {
+		var exists int
+		err := q.QueryRow(`SELECT 1 FROM `+table+` WHERE id=$1`, id).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	args = append(args, id)
+	res, err := q.Exec(fmt.Sprintf(`UPDATE %s SET %s WHERE id=$%d`, table, strings.Join(sets, ", "), len(args)), args...)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
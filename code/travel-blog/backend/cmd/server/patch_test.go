@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBindMergePatchContentType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "merge patch", contentType: mergePatchContentType, body: `{"city": "Kyoto"}`},
+		{name: "plain json", contentType: "application/json; charset=utf-8", body: `{"city": "Kyoto"}`},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: `city=Kyoto`, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "array", contentType: mergePatchContentType, body: `[{"city": "Kyoto"}]`, wantStatus: http.StatusBadRequest},
+		{name: "malformed", contentType: mergePatchContentType, body: `{"city":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPatch, "/api/places/1", strings.NewReader(tc.body))
+			c.Request.Header.Set("Content-Type", tc.contentType)
+
+			_, status, err := bindMergePatch(c, true)
+			if status != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d (%v)", tc.wantStatus, status, err)
+			}
+			if (err != nil) != (tc.wantStatus != 0) {
+				t.Fatalf("unexpected error result: %v", err)
+			}
+		})
+	}
+}
+
+func TestMergePatchAssignments(t *testing.T) {
+	patch := mergePatch{
+		"city":        []byte(`" Kyoto "`),
+		"description": []byte(`null`),
+		"latitude":    []byte(`null`),
+		"longitude":   []byte(`null`),
+	}
+
+	sets, args, err := patch.assignments(placePatchFields)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantSets := []string{"city = $1", "description = $2", "latitude = $3", "longitude = $4"}
+	if !reflect.DeepEqual(sets, wantSets) {
+		t.Fatalf("expected sets %v, got %v", wantSets, sets)
+	}
+	wantArgs := []interface{}{"Kyoto", "", nil, nil}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestMergePatchAssignmentsRejectsInvalidMembers(t *testing.T) {
+	patch := mergePatch{
+		"name":     []byte(`null`),
+		"category": []byte(`"spaceport"`),
+		"pinned":   []byte(`true`),
+		"latitude": []byte(`"north"`),
+	}
+
+	_, _, err := patch.assignments(placePatchFields)
+	errs, ok := err.(validationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+
+	got := map[string]string{}
+	for _, fieldErr := range errs {
+		got[fieldErr.Field] = fieldErr.Message
+	}
+	want := map[string]string{
+		"name":     "cannot be null",
+		"pinned":   "is not a known field",
+		"latitude": "must be a number",
+	}
+	for field, message := range want {
+		if got[field] != message {
+			t.Fatalf("expected %s %q, got %q", field, message, got[field])
+		}
+	}
+	if _, ok := got["category"]; !ok {
+		t.Fatalf("expected an error for category, got %v", errs)
+	}
+}
+
+func TestMergePatchNullBooleanClears(t *testing.T) {
+	sets, args, err := mergePatch{"pinned": []byte(`null`)}.assignments(countryPatchFields)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sets) != 1 || args[0] != false {
+		t.Fatalf("expected pinned = false, got %v %v", sets, args)
+	}
+}
+
+func TestValidatePatchCoordinates(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   mergePatch
+		wantErr bool
+	}{
+		{name: "both set", patch: mergePatch{"latitude": []byte(`35.0`), "longitude": []byte(`135.7`)}},
+		{name: "both cleared", patch: mergePatch{"latitude": []byte(`null`), "longitude": []byte(`null`)}},
+		{name: "neither", patch: mergePatch{"city": []byte(`"Kyoto"`)}},
+		{name: "only latitude", patch: mergePatch{"latitude": []byte(`35.0`)}, wantErr: true},
+		{name: "one cleared", patch: mergePatch{"latitude": []byte(`null`), "longitude": []byte(`135.7`)}, wantErr: true},
+		{name: "out of range", patch: mergePatch{"latitude": []byte(`95`), "longitude": []byte(`135.7`)}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs validationErrors
+			validatePatchCoordinates(tc.patch, &errs)
+			if (len(errs) > 0) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	phonePattern     = regexp.MustCompile(`^\+?[0-9][0-9 ()./-]{3,28}[0-9]$`)
+	clockTimePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$|^24:00$`)
+	weekdays         = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+)
+
+// OpeningHours maps days to periods. An empty list means closed; a missing
+// day is unknown.
+type OpeningHours map[string][]OpeningPeriod
+
+// OpeningPeriod with a close time before the open time runs past midnight.
+type OpeningPeriod struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+func (h *OpeningHours) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	default:
+		return fmt.Errorf("cannot scan %T into opening hours", src)
+	}
+}
+
+func (h OpeningHours) Value() (driver.Value, error) {
+	if h == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func (v *validationErrors) webURL(field, value string) string {
+	value = v.optionalText(field, value, maxURLLength)
+	if value == "" {
+		return value
+	}
+	if parsed, err := url.Parse(value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.add(field, "must be an http(s) URL")
+	}
+	return value
+}
+
+func (v *validationErrors) mapsURL(field, value string) string {
+	value = v.webURL(field, value)
+	if value == "" {
+		return value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return value
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host != "goo.gl" && host != "maps.app.goo.gl" && !strings.Contains(host, "google.") {
+		v.add(field, "must be a Google Maps link")
+	}
+	return value
+}
+
+func (v *validationErrors) phone(field, value string) string {
+	value = strings.TrimSpace(value)
+	if value != "" && !phonePattern.MatchString(value) {
+		v.add(field, "must be a phone number such as +81 3-1234-5678")
+	}
+	return value
+}
+
+func (v *validationErrors) openingHours(field string, hours OpeningHours) OpeningHours {
+	if hours == nil {
+		return nil
+	}
+	normalized := make(OpeningHours, len(hours))
+	for day, periods := range hours {
+		key := strings.ToLower(strings.TrimSpace(day))
+		if !isWeekday(key) {
+			v.add(field+"."+day, "must be one of %s", strings.Join(weekdays, ", "))
+			continue
+		}
+		if periods == nil {
+			periods = []OpeningPeriod{}
+		}
+		for i, period := range periods {
+			path := fmt.Sprintf("%s.%s[%d]", field, key, i)
+			if !clockTimePattern.MatchString(period.Open) {
+				v.add(path+".open", "must be a time formatted as HH:MM")
+			}
+			if !clockTimePattern.MatchString(period.Close) {
+				v.add(path+".close", "must be a time formatted as HH:MM")
+			}
+			if period.Open == period.Close {
+				v.add(path, "must not open and close at the same time")
+			}
+		}
+		normalized[key] = periods
+	}
+	return normalized
+}
+
+func isWeekday(day string) bool {
+	for _, weekday := range weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func statusQuery(c *gin.Context) (string, bool) {
+	status := strings.ToLower(strings.TrimSpace(c.Query("status")))
+	if status == "" {
+		return "", true
+	}
+	for _, allowed := range placeStatuses {
+		if status == allowed {
+			return status, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of: " + strings.Join(placeStatuses, ", ")})
+	return "", false
+}
+
+func filterPlacesByStatus(countries []Country, status string) {
+	if status == "" {
+		return
+	}
+	for i := range countries {
+		var kept []Place
+		for _, place := range countries[i].Places {
+			if place.Status == status {
+				kept = append(kept, place)
+			}
+		}
+		countries[i].Places = kept
+	}
+}
+
+type StatusCounts struct {
+	Visited  int `json:"visited"`
+	Planned  int `json:"planned"`
+	Wishlist int `json:"wishlist"`
+	Total    int `json:"total"`
+}
+
+func (s *StatusCounts) add(status string, n int) {
+	switch status {
+	case statusVisited:
+		s.Visited += n
+	case statusPlanned:
+		s.Planned += n
+	case statusWishlist:
+		s.Wishlist += n
+	}
+	s.Total += n
+}
+
+type CountryStats struct {
+	ID      int64        `json:"id"`
+	Name    string       `json:"name"`
+	ISOCode string       `json:"iso_code"`
+	Places  StatusCounts `json:"places"`
+}
+
+func (a *App) stats(c *gin.Context) {
+	rows, err := a.conn(c).Query(`SELECT c.id, c.name, c.iso_code, p.status, COUNT(p.id)
+        FROM countries c
+        LEFT JOIN places p ON p.country_id = c.id
+        WHERE NOT c.archived
+        GROUP BY c.id, p.status
+        ORDER BY c.pinned DESC, c.position, c.name, c.id`)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var totals StatusCounts
+	byCountry := []CountryStats{}
+	for rows.Next() {
+		var id int64
+		var name, isoCode string
+		var status *string
+		var count int
+		if err := rows.Scan(&id, &name, &isoCode, &status, &count); err != nil {
+			respondError(c, err)
+			return
+		}
+		if len(byCountry) == 0 || byCountry[len(byCountry)-1].ID != id {
+			byCountry = append(byCountry, CountryStats{ID: id, Name: name, ISOCode: isoCode})
+		}
+		if status != nil {
+			byCountry[len(byCountry)-1].Places.add(*status, count)
+			totals.add(*status, count)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	visitedCountries := 0
+	for _, country := range byCountry {
+		if country.Places.Visited > 0 {
+			visitedCountries++
+		}
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"places":            totals,
+		"countries":         len(byCountry),
+		"countries_visited": visitedCountries,
+		"by_country":        byCountry,
+	})
+}
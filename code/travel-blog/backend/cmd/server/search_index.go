@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchIndexer mirrors countries and places into Elasticsearch. index is an
+// alias, so a reindex can build a new index and swap it in.
+type SearchIndexer struct {
+	client   *http.Client
+	baseURL  string
+	index    string
+	username string
+	password string
+
+	// pending maps a country waiting to sync to the place documents to delete with it.
+	mu      sync.Mutex
+	pending map[int64][]string
+	wake    chan struct{}
+
+	// indexing is held during a sync or reindex, so writes during a reindex
+	// land in the new index.
+	indexing sync.Mutex
+}
+
+type searchDocument struct {
+	Type        string     `json:"type"`
+	ID          int64      `json:"id"`
+	CountryID   int64      `json:"country_id"`
+	CountryName string     `json:"country_name"`
+	Name        string     `json:"name"`
+	Category    string     `json:"category,omitempty"`
+	City        string     `json:"city,omitempty"`
+	Description string     `json:"description"`
+	VisitedAt   *time.Time `json:"visited_at,omitempty"`
+	Location    *geoPoint  `json:"location,omitempty"`
+}
+
+type geoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func newSearchIndexerFromEnv() *SearchIndexer {
+	baseURL := strings.TrimRight(os.Getenv("ELASTICSEARCH_URL"), "/")
+	if baseURL == "" {
+		return nil
+	}
+	index := os.Getenv("ELASTICSEARCH_INDEX")
+	if index == "" {
+		index = "travel-blog"
+	}
+	return &SearchIndexer{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		baseURL:  baseURL,
+		index:    index,
+		username: os.Getenv("ELASTICSEARCH_USERNAME"),
+		password: os.Getenv("ELASTICSEARCH_PASSWORD"),
+		pending:  map[int64][]string{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (s *SearchIndexer) do(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	payload, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, res.StatusCode, err
+	}
+	return payload, res.StatusCode, nil
+}
+
+func (s *SearchIndexer) doJSON(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	payload, status, err := s.do(ctx, method, path, "application/json", reader)
+	if err != nil {
+		return nil, err
+	}
+	if status >= 300 {
+		return nil, fmt.Errorf("elasticsearch %s %s returned %d: %s", method, path, status, payload)
+	}
+	return payload, nil
+}
+
+func (s *SearchIndexer) EnsureIndex(ctx context.Context) error {
+	_, status, err := s.do(ctx, http.MethodHead, "/"+s.index, "", nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	return s.createIndex(ctx, s.newIndexName(), true)
+}
+
+func (s *SearchIndexer) newIndexName() string {
+	return fmt.Sprintf("%s-%d", s.index, time.Now().UnixMilli())
+}
+
+func (s *SearchIndexer) createIndex(ctx context.Context, name string, aliased bool) error {
+	mapping := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"type":         map[string]interface{}{"type": "keyword"},
+				"id":           map[string]interface{}{"type": "long"},
+				"country_id":   map[string]interface{}{"type": "long"},
+				"country_name": map[string]interface{}{"type": "text", "fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword"}}},
+				"name":         map[string]interface{}{"type": "text", "fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword"}}},
+				"category":     map[string]interface{}{"type": "keyword"},
+				"city":         map[string]interface{}{"type": "text"},
+				"description":  map[string]interface{}{"type": "text"},
+				"visited_at":   map[string]interface{}{"type": "date"},
+				"location":     map[string]interface{}{"type": "geo_point"},
+			},
+		},
+	}
+	if aliased {
+		mapping["aliases"] = map[string]interface{}{s.index: map[string]interface{}{}}
+	}
+	_, err := s.doJSON(ctx, http.MethodPut, "/"+name, mapping)
+	return err
+}
+
+func (s *SearchIndexer) swapAlias(ctx context.Context, target string) error {
+	payload, status, err := s.do(ctx, http.MethodGet, "/_alias/"+s.index, "", nil)
+	if err != nil {
+		return err
+	}
+	previous := map[string]json.RawMessage{}
+	switch status {
+	case http.StatusOK:
+		if err := json.Unmarshal(payload, &previous); err != nil {
+			return err
+		}
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("elasticsearch GET /_alias/%s returned %d: %s", s.index, status, payload)
+	}
+
+	actions := []interface{}{
+		map[string]interface{}{"add": map[string]interface{}{"index": target, "alias": s.index}},
+	}
+	for name := range previous {
+		actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": name, "alias": s.index}})
+	}
+	if len(previous) == 0 {
+		_, status, err := s.do(ctx, http.MethodHead, "/"+s.index, "", nil)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusOK {
+			actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": s.index}})
+		}
+	}
+	if _, err := s.doJSON(ctx, http.MethodPost, "/_aliases", map[string]interface{}{"actions": actions}); err != nil {
+		return err
+	}
+
+	for name := range previous {
+		if _, err := s.doJSON(ctx, http.MethodDelete, "/"+name, nil); err != nil {
+			log.Printf("search: delete old index %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func documentID(entity string, id int64) string {
+	return fmt.Sprintf("%s-%d", entity, id)
+}
+
+func countryDocuments(country Country) []searchDocument {
+	docs := []searchDocument{{
+		Type:        "country",
+		ID:          country.ID,
+		CountryID:   country.ID,
+		CountryName: country.Name,
+		Name:        country.Name,
+		Description: country.Description,
+	}}
+	for _, place := range country.Places {
+		doc := searchDocument{
+			Type:        "place",
+			ID:          place.ID,
+			CountryID:   country.ID,
+			CountryName: country.Name,
+			Name:        place.Name,
+			Category:    place.Category,
+			City:        place.City,
+			Description: place.Description,
+			VisitedAt:   place.VisitedAt,
+		}
+		if place.Latitude != nil && place.Longitude != nil {
+			doc.Location = &geoPoint{Lat: *place.Latitude, Lon: *place.Longitude}
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func (s *SearchIndexer) Bulk(ctx context.Context, index string, docs []searchDocument, deleteIDs []string) error {
+	if len(docs) == 0 && len(deleteIDs) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, doc := range docs {
+		action := map[string]interface{}{"index": map[string]interface{}{"_index": index, "_id": documentID(doc.Type, doc.ID)}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+	for _, id := range deleteIDs {
+		action := map[string]interface{}{"delete": map[string]interface{}{"_index": index, "_id": id}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+	}
+
+	payload, status, err := s.do(ctx, http.MethodPost, "/_bulk?refresh=true", "application/x-ndjson", &buf)
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("elasticsearch bulk returned %d: %s", status, payload)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return err
+	}
+	if result.Errors {
+		return fmt.Errorf("elasticsearch bulk reported item errors: %s", payload)
+	}
+	return nil
+}
+
+func (s *SearchIndexer) DeleteCountry(ctx context.Context, countryID int64) error {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{"term": map[string]interface{}{"country_id": countryID}},
+	}
+	_, err := s.doJSON(ctx, http.MethodPost, "/"+s.index+"/_delete_by_query?refresh=true", query)
+	return err
+}
+
+func (a *App) syncSearchIndex(eventType, entity string, entityID, countryID int64) {
+	if a.search == nil {
+		return
+	}
+
+	s := a.search
+	s.mu.Lock()
+	deleteIDs := s.pending[countryID]
+	if entity == "place" && eventType == "deleted" {
+		deleteIDs = append(deleteIDs, documentID("place", entityID))
+	}
+	s.pending[countryID] = deleteIDs
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *App) runSearchSync(ctx context.Context) {
+	for {
+		select {
+		case <-a.search.wake:
+			a.flushSearchQueue(context.Background())
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			a.flushSearchQueue(final)
+			cancel()
+			return
+		}
+	}
+}
+
+func (a *App) flushSearchQueue(ctx context.Context) {
+	s := a.search
+	s.indexing.Lock()
+	defer s.indexing.Unlock()
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[int64][]string{}
+	s.mu.Unlock()
+
+	for countryID, deleteIDs := range pending {
+		a.syncCountry(ctx, countryID, deleteIDs)
+	}
+}
+
+func (a *App) syncCountry(ctx context.Context, countryID int64, deleteIDs []string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	country, err := fetchCountry(ctxDB{db: a.db, ctx: ctx}, countryID)
+	if err != nil {
+		log.Printf("search: load country %d: %v", countryID, err)
+		return
+	}
+	if country == nil || country.Archived {
+		if err := a.search.DeleteCountry(ctx, countryID); err != nil {
+			log.Printf("search: delete country %d: %v", countryID, err)
+		}
+		return
+	}
+
+	if err := a.search.Bulk(ctx, a.search.index, countryDocuments(*country), deleteIDs); err != nil {
+		log.Printf("search: index country %d: %v", countryID, err)
+	}
+}
+
+func (a *App) reindexSearch(c *gin.Context) {
+	if a.search == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "search indexing is not configured"})
+		return
+	}
+
+	a.search.indexing.Lock()
+	defer a.search.indexing.Unlock()
+
+	ctx := c.Request.Context()
+	target := a.search.newIndexName()
+	if err := a.search.createIndex(ctx, target, false); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	dropTarget := func() {
+		if _, err := a.search.doJSON(context.Background(), http.MethodDelete, "/"+target, nil); err != nil {
+			log.Printf("search: delete unused index %s: %v", target, err)
+		}
+	}
+
+	countries, err := fetchCountries(a.conn(c))
+	if err != nil {
+		dropTarget()
+		respondError(c, err)
+		return
+	}
+
+	var docs []searchDocument
+	places := 0
+	indexed := 0
+	for _, country := range countries {
+		if country.Archived {
+			continue
+		}
+		docs = append(docs, countryDocuments(country)...)
+		places += len(country.Places)
+		indexed++
+	}
+	if err := a.search.Bulk(ctx, target, docs, nil); err != nil {
+		dropTarget()
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if err := a.search.swapAlias(ctx, target); err != nil {
+		dropTarget()
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"index": a.search.index, "backing_index": target, "countries": indexed, "places": places})
+}
+
+func (a *App) searchContent(c *gin.Context) {
+	if a.search == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "search indexing is not configured"})
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	filters := []interface{}{}
+	if entityType := c.Query("type"); entityType != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"type": entityType}})
+	}
+
+	body := map[string]interface{}{
+		"size": 20,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":     q,
+						"fields":    []string{"name^3", "city^2", "country_name^2", "category", "description"},
+						"fuzziness": "AUTO",
+					},
+				},
+				"filter": filters,
+			},
+		},
+	}
+
+	payload, err := a.search.doJSON(c.Request.Context(), http.MethodPost, "/"+a.search.index+"/_search", body)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Score  float64        `json:"_score"`
+				Source searchDocument `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	type searchHit struct {
+		searchDocument
+		Score float64 `json:"score"`
+	}
+	hits := make([]searchHit, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		hits = append(hits, searchHit{searchDocument: hit.Source, Score: hit.Score})
+	}
+
+	respondJSON(c, http.StatusOK, hits)
+}
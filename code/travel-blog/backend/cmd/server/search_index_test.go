@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestIndexer(url string) *SearchIndexer {
+	return &SearchIndexer{client: http.DefaultClient, baseURL: url, index: "travel-blog", username: "elastic", password: "secret"}
+}
+
+func TestCountryDocuments(t *testing.T) {
+	latitude, longitude := 35.0116, 135.7681
+	country := Country{ID: 1, Name: "Japan", Description: "Islands", Places: []Place{
+		{ID: 10, Name: "Kyoto", Category: "city", City: "Kyoto", Latitude: &latitude, Longitude: &longitude},
+		{ID: 11, Name: "Half pinned", Latitude: &latitude},
+	}}
+
+	docs := countryDocuments(country)
+	if len(docs) != 3 {
+		t.Fatalf("expected the country and two places, got %+v", docs)
+	}
+	if got := docs[0]; got.Type != "country" || got.ID != 1 || got.CountryID != 1 || got.Name != "Japan" || got.Location != nil {
+		t.Fatalf("unexpected country document: %+v", got)
+	}
+	kyoto := docs[1]
+	if kyoto.Type != "place" || kyoto.ID != 10 || kyoto.CountryID != 1 || kyoto.CountryName != "Japan" || kyoto.City != "Kyoto" {
+		t.Fatalf("unexpected place document: %+v", kyoto)
+	}
+	if kyoto.Location == nil || kyoto.Location.Lat != latitude || kyoto.Location.Lon != longitude {
+		t.Fatalf("expected a geo point for Kyoto, got %+v", kyoto.Location)
+	}
+	if docs[2].Location != nil {
+		t.Fatalf("expected no geo point without a longitude, got %+v", docs[2].Location)
+	}
+}
+
+func TestSearchIndexerBulk(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  string
+	}{
+		{name: "accepted", status: http.StatusOK, response: `{"errors":false,"items":[]}`},
+		{name: "item errors", status: http.StatusOK, response: `{"errors":true,"items":[{"index":{"status":400}}]}`, wantErr: "reported item errors"},
+		{name: "request rejected", status: http.StatusBadRequest, response: `{"error":"bad"}`, wantErr: "bulk returned 400"},
+		{name: "unreadable response", status: http.StatusOK, response: `not json`, wantErr: "invalid character"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var lines []string
+			var request *http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request = r
+				scanner := bufio.NewScanner(r.Body)
+				for scanner.Scan() {
+					lines = append(lines, scanner.Text())
+				}
+				w.WriteHeader(tc.status)
+				io.WriteString(w, tc.response)
+			}))
+			defer server.Close()
+
+			docs := []searchDocument{{Type: "country", ID: 1, CountryID: 1, Name: "Japan"}}
+			err := newTestIndexer(server.URL).Bulk(context.Background(), "travel-blog-1", docs, []string{"place-7"})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if request.Method != http.MethodPost || request.URL.Path != "/_bulk" || request.URL.RawQuery != "refresh=true" {
+				t.Fatalf("unexpected request %s %s", request.Method, request.URL)
+			}
+			if got := request.Header.Get("Content-Type"); got != "application/x-ndjson" {
+				t.Fatalf("expected an NDJSON body, got %q", got)
+			}
+			if user, pass, ok := request.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+				t.Fatalf("expected basic auth, got %q %q", user, pass)
+			}
+			want := []string{
+				`{"index":{"_id":"country-1","_index":"travel-blog-1"}}`,
+				`{"type":"country","id":1,"country_id":1,"country_name":"","name":"Japan","description":""}`,
+				`{"delete":{"_id":"place-7","_index":"travel-blog-1"}}`,
+			}
+			if !reflect.DeepEqual(lines, want) {
+				t.Fatalf("unexpected bulk body:\n%s", strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestSearchIndexerBulkSkipsEmpty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	}))
+	defer server.Close()
+
+	if err := newTestIndexer(server.URL).Bulk(context.Background(), "travel-blog-1", nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSearchIndexerSwapAlias(t *testing.T) {
+	tests := []struct {
+		name        string
+		aliasStatus int
+		aliases     string
+		indexExists bool
+		wantActions []string
+		wantDeleted []string
+	}{
+		{
+			name:        "moves the alias off the old index",
+			aliasStatus: http.StatusOK,
+			aliases:     `{"travel-blog-1":{"aliases":{"travel-blog":{}}}}`,
+			wantActions: []string{"add travel-blog-2", "remove travel-blog-1"},
+			wantDeleted: []string{"/travel-blog-1"},
+		},
+		{
+			name:        "replaces a plain index with the alias",
+			aliasStatus: http.StatusNotFound,
+			aliases:     `{}`,
+			indexExists: true,
+			wantActions: []string{"add travel-blog-2", "remove_index travel-blog"},
+		},
+		{
+			name:        "first index",
+			aliasStatus: http.StatusNotFound,
+			aliases:     `{}`,
+			wantActions: []string{"add travel-blog-2"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var actions, deleted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/_alias/travel-blog":
+					w.WriteHeader(tc.aliasStatus)
+					io.WriteString(w, tc.aliases)
+				case r.Method == http.MethodHead && r.URL.Path == "/travel-blog":
+					if !tc.indexExists {
+						w.WriteHeader(http.StatusNotFound)
+					}
+				case r.Method == http.MethodPost && r.URL.Path == "/_aliases":
+					var body struct {
+						Actions []map[string]struct {
+							Index string `json:"index"`
+							Alias string `json:"alias"`
+						} `json:"actions"`
+					}
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Errorf("decode actions: %v", err)
+					}
+					for _, action := range body.Actions {
+						for kind, target := range action {
+							actions = append(actions, kind+" "+target.Index)
+						}
+					}
+					io.WriteString(w, `{"acknowledged":true}`)
+				case r.Method == http.MethodDelete:
+					deleted = append(deleted, r.URL.Path)
+					io.WriteString(w, `{"acknowledged":true}`)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer server.Close()
+
+			if err := newTestIndexer(server.URL).swapAlias(context.Background(), "travel-blog-2"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actions, tc.wantActions) {
+				t.Fatalf("expected actions %v, got %v", tc.wantActions, actions)
+			}
+			if !reflect.DeepEqual(deleted, tc.wantDeleted) {
+				t.Fatalf("expected deleted indexes %v, got %v", tc.wantDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestSearchIndexerSwapAliasFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("expected no changes after a failed alias lookup, got %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := newTestIndexer(server.URL).swapAlias(context.Background(), "travel-blog-2")
+	if err == nil || !strings.Contains(err.Error(), "returned 503") {
+		t.Fatalf("expected the alias lookup error, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+type Translation struct {
+	Locale      string    `json:"locale"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func defaultLocale() string {
+	if locale := normalizeLocale(os.Getenv("DEFAULT_LOCALE")); locale != "" {
+		return locale
+	}
+	return "en"
+}
+
+func normalizeLocale(value string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(value), "_", "-"))
+}
+
+func localeChain(lang string) []string {
+	var chain []string
+	for lang != "" {
+		chain = append(chain, lang)
+		idx := strings.LastIndex(lang, "-")
+		if idx < 0 {
+			break
+		}
+		lang = lang[:idx]
+	}
+	return chain
+}
+
+func requestLocale(c *gin.Context) (string, bool) {
+	lang := normalizeLocale(c.Query("lang"))
+	if lang == "" || lang == defaultLocale() {
+		return "", true
+	}
+	return lang, localePattern.MatchString(lang)
+}
+
+func localizeCountries(q queryer, lang string, countries []Country) error {
+	if lang == "" || len(countries) == 0 {
+		for i := range countries {
+			countries[i].Locale = defaultLocale()
+			for j := range countries[i].Places {
+				countries[i].Places[j].Locale = defaultLocale()
+			}
+		}
+		return nil
+	}
+
+	var countryIDs, placeIDs []int64
+	for _, country := range countries {
+		countryIDs = append(countryIDs, country.ID)
+		for _, place := range country.Places {
+			placeIDs = append(placeIDs, place.ID)
+		}
+	}
+
+	chain := localeChain(lang)
+	countryTexts, err := loadTranslations(q, "country_id", countryIDs, chain)
+	if err != nil {
+		return err
+	}
+	placeTexts, err := loadTranslations(q, "place_id", placeIDs, chain)
+	if err != nil {
+		return err
+	}
+
+	for i := range countries {
+		countries[i].Locale = defaultLocale()
+		if text, ok := pickTranslation(countryTexts[countries[i].ID], chain); ok {
+			countries[i].Description = text.Description
+			countries[i].Locale = text.Locale
+		}
+		for j := range countries[i].Places {
+			place := &countries[i].Places[j]
+			place.Locale = defaultLocale()
+			if text, ok := pickTranslation(placeTexts[place.ID], chain); ok {
+				place.Description = text.Description
+				place.Locale = text.Locale
+			}
+		}
+	}
+	return nil
+}
+
+func loadTranslations(q queryer, column string, ids []int64, locales []string) (map[int64][]Translation, error) {
+	texts := make(map[int64][]Translation)
+	if len(ids) == 0 {
+		return texts, nil
+	}
+
+	rows, err := q.Query(`SELECT `+column+`, locale, description, created_at, updated_at FROM translations
+        WHERE `+column+` = ANY($1) AND locale = ANY($2)`, ids, locales)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var text Translation
+		if err := rows.Scan(&id, &text.Locale, &text.Description, &text.CreatedAt, &text.UpdatedAt); err != nil {
+			return nil, err
+		}
+		texts[id] = append(texts[id], text)
+	}
+	return texts, rows.Err()
+}
+
+func pickTranslation(texts []Translation, chain []string) (Translation, bool) {
+	for _, locale := range chain {
+		for _, text := range texts {
+			if text.Locale == locale {
+				return text, true
+			}
+		}
+	}
+	return Translation{}, false
+}
+
+func (a *App) listCountryTranslations(c *gin.Context) {
+	a.listTranslations(c, "country_id", "country not found", `SELECT 1 FROM countries WHERE id=$1`)
+}
+
+func (a *App) listPlaceTranslations(c *gin.Context) {
+	a.listTranslations(c, "place_id", "place not found", `SELECT 1 FROM places WHERE id=$1`)
+}
+
+func (a *App) upsertCountryTranslation(c *gin.Context) {
+	a.upsertTranslation(c, "country_id", "country not found", `SELECT 1 FROM countries WHERE id=$1`)
+}
+
+func (a *App) upsertPlaceTranslation(c *gin.Context) {
+	a.upsertTranslation(c, "place_id", "place not found", `SELECT 1 FROM places WHERE id=$1`)
+}
+
+func (a *App) deleteCountryTranslation(c *gin.Context) {
+	a.deleteTranslation(c, "country_id")
+}
+
+func (a *App) deletePlaceTranslation(c *gin.Context) {
+	a.deleteTranslation(c, "place_id")
+}
+
+func (a *App) listTranslations(c *gin.Context, column, notFound, existsQuery string) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists int
+	if err := a.conn(c).QueryRow(existsQuery, id).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	rows, err := a.conn(c).Query(`SELECT locale, description, created_at, updated_at FROM translations WHERE `+column+`=$1 ORDER BY locale`, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	translations := []Translation{}
+	for rows.Next() {
+		var text Translation
+		if err := rows.Scan(&text.Locale, &text.Description, &text.CreatedAt, &text.UpdatedAt); err != nil {
+			respondError(c, err)
+			return
+		}
+		translations = append(translations, text)
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, translations)
+}
+
+func (a *App) upsertTranslation(c *gin.Context, column, notFound, existsQuery string) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	locale := normalizeLocale(c.Param("locale"))
+	if !localePattern.MatchString(locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid locale, expected a language tag such as en or pt-br"})
+		return
+	}
+	if locale == defaultLocale() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the default locale is stored on the record itself, update its description instead"})
+		return
+	}
+
+	var input struct {
+		Description string `json:"description"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+	var errs validationErrors
+	description := errs.requiredText("description", input.Description, maxDescriptionLength)
+	if len(errs) > 0 {
+		respondValidation(c, errs)
+		return
+	}
+
+	var exists int
+	if err := a.conn(c).QueryRow(existsQuery, id).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	var text Translation
+	err = a.conn(c).QueryRow(`INSERT INTO translations(`+column+`, locale, description) VALUES($1, $2, $3)
+        ON CONFLICT (`+column+`, locale)
+        DO UPDATE SET description = EXCLUDED.description, updated_at = NOW()
+        RETURNING locale, description, created_at, updated_at`, id, locale, description).
+		Scan(&text.Locale, &text.Description, &text.CreatedAt, &text.UpdatedAt)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, text)
+}
+
+func (a *App) deleteTranslation(c *gin.Context, column string) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := a.conn(c).Exec(`DELETE FROM translations WHERE `+column+`=$1 AND locale=$2`, id, normalizeLocale(c.Param("locale")))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "translation not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
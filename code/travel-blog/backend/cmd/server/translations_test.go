@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLocaleChain(t *testing.T) {
+	tests := []struct {
+		lang string
+		want []string
+	}{
+		{lang: "pt", want: []string{"pt"}},
+		{lang: "pt-br", want: []string{"pt-br", "pt"}},
+		{lang: "zh-hant-tw", want: []string{"zh-hant-tw", "zh-hant", "zh"}},
+		{lang: "", want: nil},
+	}
+
+	for _, tc := range tests {
+		if got := localeChain(tc.lang); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("localeChain(%q): expected %v, got %v", tc.lang, tc.want, got)
+		}
+	}
+}
+
+func TestPickTranslation(t *testing.T) {
+	texts := []Translation{
+		{Locale: "pt", Description: "Português"},
+		{Locale: "pt-br", Description: "Português do Brasil"},
+		{Locale: "fr", Description: "Français"},
+	}
+
+	tests := []struct {
+		name       string
+		lang       string
+		texts      []Translation
+		wantLocale string
+	}{
+		{name: "exact match", lang: "pt-br", texts: texts, wantLocale: "pt-br"},
+		{name: "falls back to the base language", lang: "pt-pt", texts: texts, wantLocale: "pt"},
+		{name: "most specific wins over order", lang: "pt-br", texts: []Translation{texts[0], texts[1]}, wantLocale: "pt-br"},
+		{name: "no translation", lang: "de-at", texts: texts},
+		{name: "nothing stored", lang: "pt", texts: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			text, ok := pickTranslation(tc.texts, localeChain(tc.lang))
+			if tc.wantLocale == "" {
+				if ok {
+					t.Fatalf("expected no translation, got %+v", text)
+				}
+				return
+			}
+			if !ok || text.Locale != tc.wantLocale {
+				t.Fatalf("expected %s, got %+v (%v)", tc.wantLocale, text, ok)
+			}
+		})
+	}
+}
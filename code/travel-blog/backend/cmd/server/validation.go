@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxNameLength        = 200
+	maxCityLength        = 100
+	maxDescriptionLength = 5000
+	maxURLLength         = 2048
+)
+
+var (
+	accentColorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+	isoCodePattern     = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+var defaultPlaceCategories = []string{
+	"restaurant", "cafe", "bar", "museum", "landmark", "park", "beach",
+	"nature", "hotel", "market", "shopping", "nightlife", "other",
+}
+
+const (
+	statusVisited  = "visited"
+	statusPlanned  = "planned"
+	statusWishlist = "wishlist"
+)
+
+var placeStatuses = []string{statusVisited, statusPlanned, statusWishlist}
+
+var earliestVisit = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type validationErrors []FieldError
+
+func (v *validationErrors) add(field, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v validationErrors) Error() string {
+	parts := make([]string, len(v))
+	for i, fieldErr := range v {
+		parts[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// err returns nil when empty, avoiding a typed-nil error.
+func (v validationErrors) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *validationErrors) requiredText(field, value string, maxLength int) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		v.add(field, "is required")
+		return value
+	}
+	return v.optionalText(field, value, maxLength)
+}
+
+func (v *validationErrors) optionalText(field, value string, maxLength int) string {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) > maxLength {
+		v.add(field, "must be at most %d characters", maxLength)
+	}
+	return value
+}
+
+func (v *validationErrors) category(field, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		v.add(field, "is required")
+		return value
+	}
+	allowed := placeCategories()
+	for _, category := range allowed {
+		if value == category {
+			return value
+		}
+	}
+	v.add(field, "must be one of: %s", strings.Join(allowed, ", "))
+	return value
+}
+
+func (v *validationErrors) accentColor(field, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value != "" && !accentColorPattern.MatchString(value) {
+		v.add(field, "must be a hex color such as #1e90ff")
+	}
+	return value
+}
+
+func (v *validationErrors) isoCode(field, value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value != "" && !isoCodePattern.MatchString(value) {
+		v.add(field, "must be a two-letter ISO 3166-1 code such as JP")
+	}
+	return value
+}
+
+func (v *validationErrors) imageURL(field, value string) string {
+	if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, uploadsPath+"/") {
+		return v.optionalText(field, trimmed, maxURLLength)
+	}
+	return v.webURL(field, value)
+}
+
+func (v *validationErrors) coordinates(latitude, longitude *float64) {
+	if latitude == nil && longitude != nil {
+		v.add("latitude", "is required when longitude is set")
+	}
+	if longitude == nil && latitude != nil {
+		v.add("longitude", "is required when latitude is set")
+	}
+	if latitude != nil && (*latitude < -90 || *latitude > 90) {
+		v.add("latitude", "must be between -90 and 90")
+	}
+	if longitude != nil && (*longitude < -180 || *longitude > 180) {
+		v.add("longitude", "must be between -180 and 180")
+	}
+}
+
+func (v *validationErrors) visitDate(field string, value *string) *time.Time {
+	if value == nil || *value == "" {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", *value)
+	if err != nil {
+		v.add(field, "must be a date formatted as YYYY-MM-DD")
+		return nil
+	}
+	v.checkVisitDate(field, t)
+	return &t
+}
+
+func (v *validationErrors) checkVisitDate(field string, t time.Time) {
+	if t.Before(earliestVisit) {
+		v.add(field, "must be on or after %s", earliestVisit.Format("2006-01-02"))
+	}
+}
+
+func (v *validationErrors) placeStatus(field, value string, visitedAt *time.Time) string {
+	status := strings.ToLower(strings.TrimSpace(value))
+	if status == "" {
+		status = statusWishlist
+		if visitedAt != nil {
+			status = statusVisited
+		}
+	}
+	switch status {
+	case statusVisited:
+		// One day of slack for "today" in timezones ahead of UTC.
+		if visitedAt != nil && visitedAt.After(time.Now().UTC().AddDate(0, 0, 1)) {
+			v.add("visited_at", "cannot be in the future for visited places; use status planned")
+		}
+	case statusPlanned:
+	case statusWishlist:
+		if visitedAt != nil {
+			v.add("visited_at", "must be empty for wishlist places")
+		}
+	default:
+		v.add(field, "must be one of: %s", strings.Join(placeStatuses, ", "))
+	}
+	return status
+}
+
+func placeCategories() []string {
+	raw := os.Getenv("PLACE_CATEGORIES")
+	if strings.TrimSpace(raw) == "" {
+		return defaultPlaceCategories
+	}
+	var categories []string
+	for _, category := range strings.Split(raw, ",") {
+		if category = strings.ToLower(strings.TrimSpace(category)); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+func validateCoordinates(latitude, longitude *float64) error {
+	var errs validationErrors
+	errs.coordinates(latitude, longitude)
+	return errs.err()
+}
+
+func bindJSON(c *gin.Context, dst interface{}) bool {
+	err := json.NewDecoder(c.Request.Body).Decode(dst)
+	if err == nil {
+		return true
+	}
+
+	var errs validationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		errs.add("body", "is required")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		errs.add(typeErr.Field, "must be %s", jsonTypeName(typeErr.Type))
+	default:
+		errs.add("body", "must be a valid JSON object")
+	}
+	respondValidation(c, errs)
+	return false
+}
+
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+func respondValidation(c *gin.Context, errs validationErrors) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "errors": errs})
+}
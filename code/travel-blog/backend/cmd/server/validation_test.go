@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidationErrorsCollectsEveryField(t *testing.T) {
+	var errs validationErrors
+	name := errs.requiredText("name", "   ", maxNameLength)
+	category := errs.category("category", " Museum ")
+	color := errs.accentColor("accent_color", "blue")
+	isoCode := errs.isoCode("iso_code", "jp")
+	errs.coordinates(floatPtr(91), nil)
+
+	if name != "" {
+		t.Fatalf("expected trimmed empty name, got %q", name)
+	}
+	if category != "museum" {
+		t.Fatalf("expected category museum, got %q", category)
+	}
+	if color != "blue" {
+		t.Fatalf("expected color to be returned as given, got %q", color)
+	}
+	if isoCode != "JP" {
+		t.Fatalf("expected iso code JP, got %q", isoCode)
+	}
+
+	want := []string{"name", "accent_color", "longitude", "latitude"}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, field := range want {
+		if errs[i].Field != field {
+			t.Fatalf("expected error %d on %s, got %s", i, field, errs[i].Field)
+		}
+	}
+}
+
+func TestValidationErrorsErrIsNilWhenEmpty(t *testing.T) {
+	var errs validationErrors
+	if err := errs.err(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+}
+
+func TestValidationTextLength(t *testing.T) {
+	var errs validationErrors
+	errs.optionalText("city", strings.Repeat("é", maxCityLength), maxCityLength)
+	if len(errs) != 0 {
+		t.Fatalf("expected %d runes to be allowed, got %v", maxCityLength, errs)
+	}
+	errs.optionalText("city", strings.Repeat("é", maxCityLength+1), maxCityLength)
+	if len(errs) != 1 || errs[0].Message != "must be at most 100 characters" {
+		t.Fatalf("expected one length error, got %v", errs)
+	}
+}
+
+func TestValidationCategory(t *testing.T) {
+	t.Setenv("PLACE_CATEGORIES", "temple, Onsen")
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "configured", value: "Onsen"},
+		{name: "default only", value: "museum", wantErr: true},
+		{name: "empty", value: " ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs validationErrors
+			errs.category("category", tc.value)
+			if (len(errs) > 0) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidationVisitDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   *string
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "missing", value: nil, wantNil: true},
+		{name: "empty", value: stringPtr(""), wantNil: true},
+		{name: "valid", value: stringPtr("2023-04-05")},
+		{name: "wrong format", value: stringPtr("05/04/2023"), wantNil: true, wantErr: true},
+		{name: "too early", value: stringPtr("1850-01-01"), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs validationErrors
+			got := errs.visitDate("visited_at", tc.value)
+			if (got == nil) != tc.wantNil {
+				t.Fatalf("expected nil date %v, got %v", tc.wantNil, got)
+			}
+			if (len(errs) > 0) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestBindJSONReportsFieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantField string
+		wantMsg   string
+	}{
+		{name: "empty body", body: "", wantField: "body", wantMsg: "is required"},
+		{name: "malformed", body: "{", wantField: "body", wantMsg: "must be a valid JSON object"},
+		{name: "wrong type", body: `{"name": 3}`, wantField: "name", wantMsg: "must be a string"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(res)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/countries", strings.NewReader(tc.body))
+
+			var input struct {
+				Name string `json:"name"`
+			}
+			if bindJSON(c, &input) {
+				t.Fatalf("expected bindJSON to fail")
+			}
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+			}
+
+			var payload struct {
+				Errors []FieldError `json:"errors"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(payload.Errors) != 1 || payload.Errors[0].Field != tc.wantField || payload.Errors[0].Message != tc.wantMsg {
+				t.Fatalf("expected %s %s, got %v", tc.wantField, tc.wantMsg, payload.Errors)
+			}
+		})
+	}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPendingViews bounds the maps so a client posting random ids cannot grow
+// them.
+const maxPendingViews = 10000
+
+type viewCounter struct {
+	db viewExecer
+	// written runs after a flush that changed counts, so cached reads that
+	// show them are refreshed.
+	written func()
+
+	mu        sync.Mutex
+	countries map[int64]int64
+	places    map[int64]int64
+}
+
+type viewExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func newViewCounter(db viewExecer, written func()) *viewCounter {
+	return &viewCounter{db: db, written: written, countries: map[int64]int64{}, places: map[int64]int64{}}
+}
+
+func (v *viewCounter) add(entity string, id int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	pending := v.places
+	if entity == "country" {
+		pending = v.countries
+	}
+	if _, ok := pending[id]; !ok && len(pending) >= maxPendingViews {
+		return
+	}
+	pending[id]++
+}
+
+func (v *viewCounter) run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			v.flush(ctx)
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			v.flush(final)
+			cancel()
+			return
+		}
+	}
+}
+
+func (v *viewCounter) flush(ctx context.Context) {
+	v.mu.Lock()
+	countries, places := v.countries, v.places
+	v.countries, v.places = map[int64]int64{}, map[int64]int64{}
+	v.mu.Unlock()
+
+	wrote := false
+	for table, counts := range map[string]map[int64]int64{"countries": countries, "places": places} {
+		if len(counts) == 0 {
+			continue
+		}
+		ids := make([]int64, 0, len(counts))
+		views := make([]int64, 0, len(counts))
+		for id, n := range counts {
+			ids = append(ids, id)
+			views = append(views, n)
+		}
+		result, err := v.db.ExecContext(ctx, `UPDATE `+table+` t SET view_count = t.view_count + v.n
+            FROM unnest($1::int[], $2::bigint[]) AS v(id, n)
+            WHERE t.id = v.id`, ids, views)
+		if err != nil {
+			// Keep the counts for the next flush rather than losing them.
+			log.Printf("views: flush %s: %v", table, err)
+			v.restore(table, counts)
+			continue
+		}
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			wrote = true
+		}
+	}
+	if wrote && v.written != nil {
+		v.written()
+	}
+}
+
+func (v *viewCounter) restore(table string, counts map[int64]int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	pending := v.places
+	if table == "countries" {
+		pending = v.countries
+	}
+	for id, n := range counts {
+		pending[id] += n
+	}
+}
+
+func isViewBeacon(c *gin.Context) bool {
+	return c.Request.Method == http.MethodPost && strings.HasSuffix(c.FullPath(), "/:id/view")
+}
+
+func (a *App) viewCountry(c *gin.Context) {
+	a.recordView(c, "country")
+}
+
+func (a *App) viewPlace(c *gin.Context) {
+	a.recordView(c, "place")
+}
+
+func (a *App) recordView(c *gin.Context, entity string) {
+	id, err := parseIDParam(c, "id")
+	// Ids are SERIAL columns; a larger value would fail the whole flush.
+	if err != nil || id <= 0 || id > math.MaxInt32 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+	a.views.add(entity, id)
+	c.Status(http.StatusAccepted)
+}
+
+type PopularCountry struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	ISOCode   string `json:"iso_code"`
+	ViewCount int64  `json:"view_count"`
+}
+
+type PopularPlace struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	City        string `json:"city"`
+	CountryID   int64  `json:"country_id"`
+	CountryName string `json:"country_name"`
+	ViewCount   int64  `json:"view_count"`
+}
+
+func (a *App) popular(c *gin.Context) {
+	limit := 10
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 50 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer between 1 and 50"})
+			return
+		}
+		limit = parsed
+	}
+
+	countries := []PopularCountry{}
+	rows, err := a.conn(c).Query(`SELECT id, name, iso_code, view_count FROM countries
+        WHERE NOT archived AND view_count > 0
+        ORDER BY view_count DESC, name LIMIT $1`, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var country PopularCountry
+		if err := rows.Scan(&country.ID, &country.Name, &country.ISOCode, &country.ViewCount); err != nil {
+			respondError(c, err)
+			return
+		}
+		countries = append(countries, country)
+	}
+	if err := rows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	places := []PopularPlace{}
+	placeRows, err := a.conn(c).Query(`SELECT p.id, p.name, p.category, p.city, c.id, c.name, p.view_count
+        FROM places p
+        JOIN countries c ON c.id = p.country_id
+        WHERE NOT c.archived AND p.view_count > 0
+        ORDER BY p.view_count DESC, p.name LIMIT $1`, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer placeRows.Close()
+	for placeRows.Next() {
+		var place PopularPlace
+		if err := placeRows.Scan(&place.ID, &place.Name, &place.Category, &place.City, &place.CountryID, &place.CountryName, &place.ViewCount); err != nil {
+			respondError(c, err)
+			return
+		}
+		places = append(places, place)
+	}
+	if err := placeRows.Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{"countries": countries, "places": places})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeViewExecer struct {
+	rows int64
+	err  error
+}
+
+func (f *fakeViewExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return driver.RowsAffected(f.rows), nil
+}
+
+func TestViewFlushMovesLastModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		db           *fakeViewExecer
+		view         bool
+		wantModified bool
+	}{
+		{name: "counts written", db: &fakeViewExecer{rows: 1}, view: true, wantModified: true},
+		{name: "nothing pending", db: &fakeViewExecer{rows: 1}},
+		{name: "unknown id", db: &fakeViewExecer{rows: 0}, view: true},
+		{name: "flush failed", db: &fakeViewExecer{err: errors.New("connection refused")}, view: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := &responseCache{lastModified: time.Now().UTC().Truncate(time.Second), entries: map[string]cachedResponse{}}
+			app := &App{cache: cache, views: newViewCounter(tc.db, cache.invalidate)}
+			router := gin.New()
+			router.Use(app.cacheHeaders)
+			router.GET("/api/popular", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"countries": []PopularCountry{}, "places": []PopularPlace{}})
+			})
+
+			get := func(since string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/api/popular", nil)
+				if since != "" {
+					req.Header.Set("If-Modified-Since", since)
+				}
+				res := httptest.NewRecorder()
+				router.ServeHTTP(res, req)
+				return res
+			}
+
+			lastModified := get("").Header().Get("Last-Modified")
+			if res := get(lastModified); res.Code != http.StatusNotModified {
+				t.Fatalf("expected 304 before the flush, got %d", res.Code)
+			}
+
+			if tc.view {
+				app.views.add("place", 1)
+			}
+			app.views.flush(context.Background())
+
+			res := get(lastModified)
+			if tc.wantModified {
+				if res.Code != http.StatusOK {
+					t.Fatalf("expected 200 after a flush that wrote counts, got %d", res.Code)
+				}
+				if res.Header().Get("Last-Modified") == lastModified {
+					t.Fatalf("expected Last-Modified to move past %s", lastModified)
+				}
+			} else if res.Code != http.StatusNotModified {
+				t.Fatalf("expected 304 when the flush wrote nothing, got %d", res.Code)
+			}
+		})
+	}
+}
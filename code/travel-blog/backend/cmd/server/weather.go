@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type Weather struct {
+	TemperatureC float64 `json:"temperature_c"`
+	Condition    string  `json:"condition"`
+}
+
+// WeatherProvider returns a nil snapshot and nil error when there is no data
+// for that day.
+type WeatherProvider interface {
+	HistoricalWeather(ctx context.Context, latitude, longitude float64, date time.Time) (*Weather, error)
+}
+
+func newWeatherProviderFromEnv() (WeatherProvider, error) {
+	switch provider := strings.ToLower(strings.TrimSpace(os.Getenv("WEATHER_PROVIDER"))); provider {
+	case "", "none":
+		return nil, nil
+	case "open-meteo":
+		baseURL := os.Getenv("OPEN_METEO_URL")
+		if baseURL == "" {
+			baseURL = "https://archive-api.open-meteo.com/v1/archive"
+		}
+		return &openMeteoProvider{
+			client:  &http.Client{Timeout: 10 * time.Second},
+			baseURL: baseURL,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown WEATHER_PROVIDER %q", provider)
+	}
+}
+
+type openMeteoProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+func (p *openMeteoProvider) HistoricalWeather(ctx context.Context, latitude, longitude float64, date time.Time) (*Weather, error) {
+	day := date.Format("2006-01-02")
+	query := url.Values{}
+	query.Set("latitude", fmt.Sprintf("%.4f", latitude))
+	query.Set("longitude", fmt.Sprintf("%.4f", longitude))
+	query.Set("start_date", day)
+	query.Set("end_date", day)
+	query.Set("daily", "temperature_2m_mean,weather_code")
+	query.Set("timezone", "auto")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open-meteo returned status %d", res.StatusCode)
+	}
+
+	var payload struct {
+		Daily struct {
+			Temperature []*float64 `json:"temperature_2m_mean"`
+			WeatherCode []*int     `json:"weather_code"`
+		} `json:"daily"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	if len(payload.Daily.Temperature) == 0 || payload.Daily.Temperature[0] == nil {
+		return nil, nil
+	}
+
+	weather := &Weather{TemperatureC: *payload.Daily.Temperature[0]}
+	if len(payload.Daily.WeatherCode) > 0 && payload.Daily.WeatherCode[0] != nil {
+		weather.Condition = describeWeatherCode(*payload.Daily.WeatherCode[0])
+	}
+	return weather, nil
+}
+
+func describeWeatherCode(code int) string {
+	switch {
+	case code == 0:
+		return "Clear sky"
+	case code <= 3:
+		return "Partly cloudy"
+	case code == 45 || code == 48:
+		return "Fog"
+	case code >= 51 && code <= 57:
+		return "Drizzle"
+	case code >= 61 && code <= 67:
+		return "Rain"
+	case code >= 71 && code <= 77:
+		return "Snow"
+	case code >= 80 && code <= 82:
+		return "Rain showers"
+	case code == 85 || code == 86:
+		return "Snow showers"
+	case code >= 95:
+		return "Thunderstorm"
+	default:
+		return "Unknown"
+	}
+}
+
+// recordWeather runs after the write commits, since the lookup can take
+// seconds.
+func (a *App) recordWeather(ctx context.Context, q queryer, placeID int64) {
+	if a.weather == nil {
+		return
+	}
+
+	var latitude, longitude *float64
+	var visitedAt *time.Time
+	err := q.QueryRowContext(ctx, `SELECT latitude, longitude, visited_at FROM places WHERE id=$1`, placeID).
+		Scan(&latitude, &longitude, &visitedAt)
+	if err != nil {
+		log.Printf("weather: load place %d: %v", placeID, err)
+		return
+	}
+
+	if latitude == nil || longitude == nil || visitedAt == nil || visitedAt.After(time.Now()) {
+		if _, err := q.ExecContext(ctx, `UPDATE places SET weather_temperature_c = NULL, weather_condition = NULL WHERE id=$1`, placeID); err != nil {
+			log.Printf("weather: clear place %d: %v", placeID, err)
+		}
+		return
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	weather, err := a.weather.HistoricalWeather(lookupCtx, *latitude, *longitude, *visitedAt)
+	if err != nil {
+		log.Printf("weather: lookup place %d: %v", placeID, err)
+		return
+	}
+	if weather == nil {
+		return
+	}
+
+	if _, err := q.ExecContext(ctx, `UPDATE places SET weather_temperature_c = $1, weather_condition = $2 WHERE id=$3`,
+		weather.TemperatureC, weather.Condition, placeID); err != nil {
+		log.Printf("weather: store place %d: %v", placeID, err)
+	}
+}
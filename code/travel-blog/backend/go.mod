@@ -3,18 +3,30 @@ module travel-blog-backend
 go 1.21
 
 require (
+    github.com/XSAM/otelsql v0.29.0
+    github.com/andybalholm/brotli v1.1.0
     github.com/gin-gonic/gin v1.9.1
     github.com/jackc/pgx/v5 v5.5.4
+    go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin v0.49.0
+    go.opentelemetry.io/otel v1.24.0
+    go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.24.0
+    go.opentelemetry.io/otel/sdk v1.24.0
 )
 
 require (
     github.com/bytedance/sonic v1.9.1 // indirect
+    github.com/cenkalti/backoff/v4 v4.2.1 // indirect
     github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
     github.com/gabriel-vasile/mimetype v1.4.2 // indirect
+    github.com/gin-contrib/sse v0.1.0 // indirect
+    github.com/go-logr/logr v1.4.1 // indirect
+    github.com/go-logr/stdr v1.2.2 // indirect
     github.com/go-playground/locales v0.14.1 // indirect
     github.com/go-playground/universal-translator v0.18.1 // indirect
     github.com/go-playground/validator/v10 v10.15.1 // indirect
     github.com/goccy/go-json v0.10.2 // indirect
+    github.com/golang/protobuf v1.5.3 // indirect
+    github.com/grpc-ecosystem/grpc-gateway/v2 v2.19.0 // indirect
     github.com/jackc/pgpassfile v1.0.0 // indirect
     github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
     github.com/jackc/puddle/v2 v2.2.1 // indirect
@@ -27,10 +39,19 @@ require (
     github.com/pelletier/go-toml/v2 v2.1.0 // indirect
     github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
     github.com/ugorji/go/codec v1.2.11 // indirect
+    go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.24.0 // indirect
+    go.opentelemetry.io/otel/metric v1.24.0 // indirect
+    go.opentelemetry.io/otel/trace v1.24.0 // indirect
+    go.opentelemetry.io/proto/otlp v1.1.0 // indirect
     golang.org/x/arch v0.6.0 // indirect
-    golang.org/x/crypto v0.12.0 // indirect
-    golang.org/x/net v0.10.0 // indirect
-    golang.org/x/sys v0.11.0 // indirect
-    golang.org/x/text v0.11.0 // indirect
-    google.golang.org/protobuf v1.31.0 // indirect
+    golang.org/x/crypto v0.19.0 // indirect
+    golang.org/x/net v0.21.0 // indirect
+    golang.org/x/sync v0.5.0 // indirect
+    golang.org/x/sys v0.17.0 // indirect
+    golang.org/x/text v0.14.0 // indirect
+    google.golang.org/genproto/googleapis/api v0.0.0-20240102182953-50ed04b92917 // indirect
+    google.golang.org/genproto/googleapis/rpc v0.0.0-20240102182953-50ed04b92917 // indirect
+    google.golang.org/grpc v1.61.1 // indirect
+    google.golang.org/protobuf v1.32.0 // indirect
+    gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -6,15 +6,26 @@ const placeTemplate = document.getElementById("placeTemplate");
 const refreshBtn = document.getElementById("refreshBtn");
 const adminAlerts = document.getElementById("adminAlerts");
 
+const apiTokenInput = document.getElementById("apiToken");
+apiTokenInput.value = localStorage.getItem("apiToken") || "";
+apiTokenInput.addEventListener("change", () => {
+  localStorage.setItem("apiToken", apiTokenInput.value.trim());
+});
+
+function authHeaders() {
+  const token = apiTokenInput.value.trim();
+  return token ? { Authorization: `Bearer ${token}` } : {};
+}
+
 async function fetchJSON(url, options = {}) {
   const response = await fetch(url, {
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/json", ...authHeaders() },
     ...options,
   });
 
   if (!response.ok) {
     const message = await response.text();
-    throw new Error(message || `Request failed with status ${response.status}`);
+    throw new Error(describeError(message) || `Request failed with status ${response.status}`);
   }
 
   if (response.status === 204) {
@@ -24,6 +35,20 @@ async function fetchJSON(url, options = {}) {
   return response.json();
 }
 
+// describeError turns a validation response into "name is required; ..." and
+// falls back to the raw body for anything else.
+function describeError(body) {
+  try {
+    const payload = JSON.parse(body);
+    if (Array.isArray(payload.errors)) {
+      return payload.errors.map((err) => `${err.field} ${err.message}`).join("; ");
+    }
+    return payload.error || body;
+  } catch {
+    return body;
+  }
+}
+
 function renderAlert(type, message) {
   const el = document.createElement("div");
   el.className = `alert ${type}`;
@@ -47,6 +72,19 @@ function formatDate(value) {
   });
 }
 
+function applyCountryTheme(clone, country) {
+  const card = clone.querySelector(".country-card");
+  if (country.accent_color) {
+    card.style.setProperty("--accent", country.accent_color);
+  }
+  if (country.cover_image_url) {
+    const cover = clone.querySelector(".country-cover");
+    cover.src = country.cover_image_url;
+    cover.alt = country.name;
+    cover.hidden = false;
+  }
+}
+
 function renderCountries(data) {
   countriesList.innerHTML = "";
   const select = document.getElementById("placeCountry");
@@ -64,10 +102,26 @@ function renderCountries(data) {
 
   select.disabled = false;
 
-  for (const country of data) {
+  data.forEach((country, index) => {
     const clone = countryTemplate.content.cloneNode(true);
     clone.querySelector(".country-name").textContent = country.name;
     clone.querySelector(".country-description").textContent = country.description || "";
+    applyCountryTheme(clone, country);
+    const archiveToggle = clone.querySelector(".archive-toggle");
+    archiveToggle.textContent = country.archived ? "Unarchive" : "Archive";
+    archiveToggle.addEventListener("click", () => toggleArchived(country));
+    if (country.archived) {
+      clone.querySelector(".country-card").classList.add("archived");
+    }
+    const pinToggle = clone.querySelector(".pin-toggle");
+    pinToggle.textContent = country.pinned ? "Unpin" : "Pin";
+    pinToggle.addEventListener("click", () => togglePinned(country));
+    const moveUp = clone.querySelector(".move-up");
+    moveUp.disabled = index === 0;
+    moveUp.addEventListener("click", () => moveCountry(data, index, -1));
+    const moveDown = clone.querySelector(".move-down");
+    moveDown.disabled = index === data.length - 1;
+    moveDown.addEventListener("click", () => moveCountry(data, index, 1));
 
     const placesList = clone.querySelector(".places");
     if (!country.places || !country.places.length) {
@@ -81,7 +135,13 @@ function renderCountries(data) {
         placeNode.querySelector(".place-name").textContent = place.name;
         const metaPieces = [place.category];
         if (place.city) metaPieces.push(place.city);
-        if (place.visited_at) metaPieces.push(`Visited ${formatDate(place.visited_at)}`);
+        if (place.status === "planned") {
+          metaPieces.push(place.visited_at ? `Planned for ${formatDate(place.visited_at)}` : "Planned");
+        } else if (place.status === "wishlist") {
+          metaPieces.push("Wishlist");
+        } else if (place.visited_at) {
+          metaPieces.push(`Visited ${formatDate(place.visited_at)}`);
+        }
         placeNode.querySelector(".place-meta").textContent = metaPieces.filter(Boolean).join(" • ");
         placeNode.querySelector(".place-description").textContent = place.description || "";
         placesList.appendChild(placeNode);
@@ -94,14 +154,14 @@ function renderCountries(data) {
     option.value = country.id;
     option.textContent = country.name;
     select.appendChild(option);
-  }
+  });
 }
 
 async function loadCountries() {
   refreshBtn.disabled = true;
   refreshBtn.textContent = "Loading...";
   try {
-    const data = await fetchJSON(`${API_BASE}/countries`);
+    const data = await fetchJSON(`${API_BASE}/countries?include_archived=true`);
     renderCountries(data);
   } catch (error) {
     renderAlert("error", error.message);
@@ -111,12 +171,59 @@ async function loadCountries() {
   }
 }
 
+async function toggleArchived(country) {
+  const action = country.archived ? "unarchive" : "archive";
+  try {
+    await fetchJSON(`${API_BASE}/countries/${country.id}/${action}`, { method: "POST" });
+    renderAlert("success", `${country.archived ? "Restored" : "Archived"} ${country.name}`);
+    await loadCountries();
+  } catch (error) {
+    renderAlert("error", error.message);
+  }
+}
+
+async function togglePinned(country) {
+  try {
+    await fetchJSON(`${API_BASE}/countries/${country.id}`, {
+      method: "PATCH",
+      body: JSON.stringify({ pinned: !country.pinned }),
+    });
+    renderAlert("success", `${country.pinned ? "Unpinned" : "Pinned"} ${country.name}`);
+    await loadCountries();
+  } catch (error) {
+    renderAlert("error", error.message);
+  }
+}
+
+// moveCountry swaps a country with its neighbour and saves the whole order.
+// Pinned countries always list first, so moving across that boundary only
+// changes the order they return to once unpinned.
+async function moveCountry(countries, index, delta) {
+  const ids = countries.map((country) => country.id);
+  const target = index + delta;
+  if (target < 0 || target >= ids.length) return;
+  [ids[index], ids[target]] = [ids[target], ids[index]];
+  try {
+    await fetchJSON(`${API_BASE}/countries/order`, {
+      method: "PUT",
+      body: JSON.stringify({ ids }),
+    });
+    await loadCountries();
+  } catch (error) {
+    renderAlert("error", error.message);
+  }
+}
+
 async function handleCountrySubmit(event) {
   event.preventDefault();
   const payload = {
     name: document.getElementById("countryName").value.trim(),
     description: document.getElementById("countryDescription").value.trim(),
+    iso_code: document.getElementById("countryIsoCode").value.trim(),
+    cover_image_url: document.getElementById("countryCoverUrl").value.trim(),
+    accent_color: document.getElementById("countryAccentColor").value.trim(),
   };
+  const coverFile = document.getElementById("countryCoverFile").files[0];
 
   if (!payload.name) {
     renderAlert("error", "Country name is required");
@@ -124,10 +231,13 @@ async function handleCountrySubmit(event) {
   }
 
   try {
-    await fetchJSON(`${API_BASE}/countries`, {
+    const country = await fetchJSON(`${API_BASE}/countries`, {
       method: "POST",
       body: JSON.stringify(payload),
     });
+    if (coverFile) {
+      await uploadCover(country.id, coverFile);
+    }
     renderAlert("success", `Added ${payload.name}`);
     event.target.reset();
     await loadCountries();
@@ -136,6 +246,20 @@ async function handleCountrySubmit(event) {
   }
 }
 
+async function uploadCover(countryId, file) {
+  const form = new FormData();
+  form.append("image", file);
+  const response = await fetch(`${API_BASE}/countries/${countryId}/cover`, {
+    method: "POST",
+    headers: authHeaders(),
+    body: form,
+  });
+  if (!response.ok) {
+    const message = await response.text();
+    throw new Error(describeError(message) || `Cover upload failed with status ${response.status}`);
+  }
+}
+
 async function handlePlaceSubmit(event) {
   event.preventDefault();
   const countryId = document.getElementById("placeCountry").value;
@@ -144,7 +268,11 @@ async function handlePlaceSubmit(event) {
     category: document.getElementById("placeCategory").value.trim(),
     city: document.getElementById("placeCity").value.trim(),
     description: document.getElementById("placeDescription").value.trim(),
+    status: document.getElementById("placeStatus").value || undefined,
     visited_at: document.getElementById("placeVisitedAt").value || undefined,
+    website_url: document.getElementById("placeWebsite").value.trim(),
+    maps_url: document.getElementById("placeMapsUrl").value.trim(),
+    phone: document.getElementById("placePhone").value.trim(),
   };
 
   if (!countryId || !payload.name || !payload.category) {
@@ -165,7 +293,58 @@ async function handlePlaceSubmit(event) {
   }
 }
 
+// runImport posts the selected export. A dry run lists what would happen
+// without saving anything.
+async function runImport(dryRun) {
+  const file = document.getElementById("importFile").files[0];
+  if (!file) {
+    renderAlert("error", "Choose a Google Maps export first");
+    return;
+  }
+  const params = new URLSearchParams({ dry_run: String(dryRun) });
+  const country = document.getElementById("importCountry").value.trim();
+  if (country) params.set("country", country);
+
+  const form = new FormData();
+  form.append("file", file);
+  try {
+    const response = await fetch(`${API_BASE}/import/google-maps?${params}`, {
+      method: "POST",
+      headers: authHeaders(),
+      body: form,
+    });
+    if (!response.ok) {
+      const message = await response.text();
+      throw new Error(describeError(message) || `Import failed with status ${response.status}`);
+    }
+    const result = await response.json();
+    renderImportPreview(result);
+    const verb = dryRun ? "Would import" : "Imported";
+    renderAlert("success", `${verb} ${result.created} places, skipping ${result.skipped}`);
+    if (!dryRun) await loadCountries();
+  } catch (error) {
+    renderAlert("error", error.message);
+  }
+}
+
+function renderImportPreview(result) {
+  const list = document.getElementById("importPreview");
+  list.innerHTML = "";
+  for (const item of result.places) {
+    const li = document.createElement("li");
+    li.className = item.status;
+    const where = item.country ? ` (${item.country})` : "";
+    li.textContent = `${item.name || `Row ${item.row}`}${where}: ${item.reason || item.status}`;
+    list.appendChild(li);
+  }
+}
+
 refreshBtn.addEventListener("click", loadCountries);
+document.getElementById("importPreviewBtn").addEventListener("click", () => runImport(true));
+document.getElementById("importForm").addEventListener("submit", (event) => {
+  event.preventDefault();
+  runImport(false);
+});
 document.getElementById("countryForm").addEventListener("submit", handleCountrySubmit);
 document.getElementById("placeForm").addEventListener("submit", handlePlaceSubmit);
 
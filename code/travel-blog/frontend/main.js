@@ -36,8 +36,81 @@ function formatDate(value) {
   });
 }
 
+function applyCountryTheme(clone, country) {
+  const card = clone.querySelector(".country-card");
+  if (country.accent_color) {
+    card.style.setProperty("--accent", country.accent_color);
+  }
+  if (country.cover_image_url) {
+    const cover = clone.querySelector(".country-cover");
+    cover.src = country.cover_image_url;
+    cover.alt = country.name;
+    cover.hidden = false;
+  }
+}
+
+const WEEKDAY_LABELS = { mon: "Mon", tue: "Tue", wed: "Wed", thu: "Thu", fri: "Fri", sat: "Sat", sun: "Sun" };
+
+function renderPlaceLinks(container, place) {
+  const addLink = (href, label) => {
+    const link = document.createElement("a");
+    link.href = href;
+    link.textContent = label;
+    link.target = "_blank";
+    link.rel = "noopener";
+    container.append(link, " ");
+  };
+  if (place.website_url) addLink(place.website_url, "Website");
+  if (place.maps_url) addLink(place.maps_url, "Map");
+  if (place.phone) addLink(`tel:${place.phone.replace(/[^+0-9]/g, "")}`, place.phone);
+
+  if (place.opening_hours) {
+    const hours = Object.entries(WEEKDAY_LABELS)
+      .filter(([day]) => day in place.opening_hours)
+      .map(([day, label]) => {
+        const periods = place.opening_hours[day];
+        const text = periods.length ? periods.map((p) => `${p.open}–${p.close}`).join(", ") : "closed";
+        return `${label} ${text}`;
+      });
+    if (hours.length) {
+      const line = document.createElement("span");
+      line.className = "place-hours";
+      line.textContent = hours.join(" · ");
+      container.append(line);
+    }
+  }
+  container.hidden = !container.childNodes.length;
+}
+
+// Views are counted once per page load, when a card is at least half on
+// screen. sendBeacon does not hold up navigation and needs no response.
+const viewed = new Set();
+const viewObserver =
+  "IntersectionObserver" in window
+    ? new IntersectionObserver(
+        (entries) => {
+          for (const entry of entries) {
+            if (!entry.isIntersecting) continue;
+            const { viewPath } = entry.target.dataset;
+            viewObserver.unobserve(entry.target);
+            if (viewed.has(viewPath)) continue;
+            viewed.add(viewPath);
+            navigator.sendBeacon(`${API_BASE}/${viewPath}/view`);
+          }
+        },
+        { threshold: 0.5 }
+      )
+    : null;
+
+function trackView(element, viewPath) {
+  if (!viewObserver || !navigator.sendBeacon) return;
+  element.dataset.viewPath = viewPath;
+  viewObserver.observe(element);
+}
+
 function renderCountries(data) {
   countriesList.innerHTML = "";
+  viewObserver?.disconnect();
 
   if (!data.length) {
     countriesList.innerHTML = '<p class="empty">No destinations yet. Check back soon!</p>';
@@ -48,6 +121,8 @@ function renderCountries(data) {
     const clone = countryTemplate.content.cloneNode(true);
     clone.querySelector(".country-name").textContent = country.name;
     clone.querySelector(".country-description").textContent = country.description || "";
+    applyCountryTheme(clone, country);
+    trackView(clone.querySelector(".country-card"), `countries/${country.id}`);
 
     const placesList = clone.querySelector(".places");
     if (!country.places || !country.places.length) {
@@ -61,9 +136,17 @@ function renderCountries(data) {
         placeNode.querySelector(".place-name").textContent = place.name;
         const metaPieces = [place.category];
         if (place.city) metaPieces.push(place.city);
-        if (place.visited_at) metaPieces.push(`Visited ${formatDate(place.visited_at)}`);
+        if (place.status === "planned") {
+          metaPieces.push(place.visited_at ? `Planned for ${formatDate(place.visited_at)}` : "Planned");
+        } else if (place.status === "wishlist") {
+          metaPieces.push("Wishlist");
+        } else if (place.visited_at) {
+          metaPieces.push(`Visited ${formatDate(place.visited_at)}`);
+        }
         placeNode.querySelector(".place-meta").textContent = metaPieces.filter(Boolean).join(" • ");
         placeNode.querySelector(".place-description").textContent = place.description || "";
+        renderPlaceLinks(placeNode.querySelector(".place-links"), place);
+        trackView(placeNode.querySelector(".place-item"), `places/${place.id}`);
         placesList.appendChild(placeNode);
       }
     }